@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/pkg/api"
+)
+
+// checkBaselineFlags rejects baseline flags that cannot work together with
+// the other flags.
+func checkBaselineFlags() error {
+	if !updateBaseline {
+		if baselineFile != "" {
+			if _, err := os.Stat(baselineFile); err != nil {
+				return fmt.Errorf("baseline file does not exist: %s", baselineFile)
+			}
+		}
+		return nil
+	}
+	switch {
+	case baselineFile == "":
+		return fmt.Errorf("--update-baseline needs --baseline to name the file to write")
+	case batch || watch:
+		return fmt.Errorf("--update-baseline cannot be combined with --batch or --watch")
+	}
+	return nil
+}
+
+// sendBaseline reports whether the request carries the baseline file. A
+// baseline that is being created does not exist yet.
+func sendBaseline() bool {
+	if baselineFile == "" {
+		return false
+	}
+	_, err := os.Stat(baselineFile)
+	return err == nil
+}
+
+// writeBaseline replaces the baseline file with every finding of response,
+// including those the previous baseline already listed. Findings that were
+// fixed drop out of it.
+func writeBaseline(response *ValidateResponse) error {
+	diagnostics := append(append([]Diagnostic{}, response.Diagnostics...), response.Baselined...)
+	baseline := api.NewBaseline(diagnostics)
+
+	file, err := os.Create(baselineFile)
+	if err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("writing baseline: %w", err))
+	}
+	defer file.Close()
+	enc := yaml.NewEncoder(file)
+	enc.SetIndent(2)
+	if err := enc.Encode(baseline); err != nil {
+		return fmt.Errorf("writing baseline: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("writing baseline: %w", err)
+	}
+
+	fmt.Fprintf(infoOut(), "\nBaseline %s updated: %d findings\n", baselineFile, len(baseline.Findings))
+	return nil
+}
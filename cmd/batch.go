@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// concurrency is the number of files validated at a time in batch mode.
+var concurrency int
+
+// BatchReport is the machine-readable result of a batch run.
+type BatchReport struct {
+	Status   string       `json:"status" yaml:"status"`
+	ExitCode int          `json:"exit_code" yaml:"exit_code"`
+	Summary  BatchSummary `json:"summary" yaml:"summary"`
+	Results  []*Report    `json:"results" yaml:"results"`
+}
+
+type BatchSummary struct {
+	Total   int `json:"total" yaml:"total"`
+	Passed  int `json:"passed" yaml:"passed"`
+	Failed  int `json:"failed" yaml:"failed"`
+	Errors  int `json:"errors" yaml:"errors"`
+	Skipped int `json:"skipped" yaml:"skipped"`
+}
+
+// runBatch validates every wiring file on its own, together with the fab file
+// if any, and reports the results as a summary. The exit code is the most
+// severe one of all files.
+//
+// Up to --concurrency files are validated at a time. Results keep the order of
+// the files regardless of when they finish.
+func runBatch() error {
+	reports := make([]*Report, len(wiringFiles))
+	var (
+		mu      sync.Mutex
+		stopped bool
+		wg      sync.WaitGroup
+	)
+	slots := make(chan struct{}, concurrency)
+	for i, file := range wiringFiles {
+		slots <- struct{}{}
+
+		mu.Lock()
+		skip := stopped
+		mu.Unlock()
+		if skip {
+			<-slots
+			reports[i] = &Report{
+				Status:      statusSkipped,
+				Diagnostics: []Diagnostic{},
+				Files:       ReportFiles{Wiring: []string{file}, Fab: fabFile},
+				Server:      serverURL,
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, file string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if verbose {
+				fmt.Fprintf(infoOut(), "Validating %s\n", file)
+			}
+			wiring := []string{file}
+			start := time.Now()
+			response, err := requestValidation(wiring)
+			reports[i] = newReport(wiring, response, err, time.Since(start))
+
+			if failFast && reports[i].Status != statusPassed {
+				mu.Lock()
+				stopped = true
+				mu.Unlock()
+			}
+		}(i, file)
+	}
+	wg.Wait()
+
+	batchReport := newBatchReport(reports)
+	if quiet > 0 {
+		writeQuietStatus(batchReport.Status)
+	} else if err := writeBatchReport(os.Stdout, batchReport); err != nil {
+		return err
+	}
+
+	if batchReport.ExitCode != exitOK {
+		return silentExit(batchReport.ExitCode, fmt.Errorf("%d of %d files did not pass", batchReport.Summary.Failed+batchReport.Summary.Errors, batchReport.Summary.Total))
+	}
+	return nil
+}
+
+func newBatchReport(reports []*Report) *BatchReport {
+	batchReport := &BatchReport{
+		Status:  statusPassed,
+		Summary: BatchSummary{Total: len(reports)},
+		Results: reports,
+	}
+	for _, report := range reports {
+		switch report.Status {
+		case statusPassed:
+			batchReport.Summary.Passed++
+		case statusFailed:
+			batchReport.Summary.Failed++
+		case statusError:
+			batchReport.Summary.Errors++
+		case statusSkipped:
+			batchReport.Summary.Skipped++
+		}
+		if report.ExitCode > batchReport.ExitCode {
+			batchReport.ExitCode = report.ExitCode
+		}
+	}
+
+	switch {
+	case batchReport.Summary.Errors > 0:
+		batchReport.Status = statusError
+	case batchReport.Summary.Failed > 0:
+		batchReport.Status = statusFailed
+	}
+	return batchReport
+}
+
+func writeBatchReport(w io.Writer, batchReport *BatchReport) error {
+	switch outputFormat {
+	case outputText:
+		return writeSummaryTable(w, batchReport)
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(batchReport)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(batchReport); err != nil {
+			return err
+		}
+		return enc.Close()
+	case outputJUnit:
+		return writeJUnit(w, batchReport.Results)
+	case outputSARIF:
+		return writeSARIF(w, batchReport.Results)
+	case outputMarkdown:
+		return writeMarkdown(w, batchReport.Results)
+	}
+	return fmt.Errorf("unsupported output format %q", outputFormat)
+}
+
+// writeSummaryTable prints one row per file followed by the totals. Verbose
+// mode adds the full output of every file that did not pass.
+func writeSummaryTable(w io.Writer, batchReport *BatchReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tRESULT\tDURATION\tDETAILS")
+	for _, report := range batchReport.Results {
+		result, details, duration := "PASS", "", "-"
+		switch report.Status {
+		case statusFailed:
+			result, details = "FAIL", firstError(report)
+		case statusError:
+			result, details = "ERROR", report.Error
+		case statusSkipped:
+			result = "SKIP"
+		}
+		if report.Status != statusSkipped {
+			duration = (time.Duration(report.DurationMs) * time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", report.Files.Wiring[0], result, duration, details)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	summary := batchReport.Summary
+	fmt.Fprintf(w, "\n%d files: %d passed, %d failed, %d errors, %d skipped\n",
+		summary.Total, summary.Passed, summary.Failed, summary.Errors, summary.Skipped)
+
+	if verbose {
+		for _, report := range batchReport.Results {
+			if report.Status == statusPassed || report.Status == statusSkipped || report.Output == "" {
+				continue
+			}
+			fmt.Fprintf(w, "\n--- %s ---\n%s\n", report.Files.Wiring[0], report.Output)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// maxCommentSize is the size limit of GitHub comments in characters, which
+// counting bytes stays below.
+const maxCommentSize = 65536
+
+var (
+	commentRepo   string
+	commentPR     int
+	commentToken  string
+	commentAPIURL string
+	commentID     string
+	// stickyComment is set by the comment command for validateOnce to post
+	// its result to
+	stickyComment *pullRequestComment
+)
+
+func newCommentCommand() *cobra.Command {
+	// Only a run of this command posts
+	stickyComment = nil
+	cmd := &cobra.Command{
+		Use:   "comment",
+		Short: "Validate files and post the result as a pull request comment",
+		Long: `Validate wiring files like the validator command does and post the result as
+a Markdown comment on a GitHub pull request, see -o markdown. The comment is
+sticky: later runs edit the comment of the first one instead of adding a
+comment per push. Use --id to keep several sticky comments apart, e.g. one
+per site.
+
+In GitHub Actions the repository, the pull request number, the API URL and
+the token default to GITHUB_REPOSITORY, GITHUB_REF, GITHUB_API_URL and
+GITHUB_TOKEN; the token needs write access to pull requests. The result is
+printed as usual and the exit code is that of the validation, unless the
+comment cannot be posted.
+
+Examples:
+  validator comment -w wiring/ -f fab.yaml
+  validator comment -w wiring.yaml --repo acme/fabric --pr 42 --id site-a
+
+` + exitCodesHelp,
+		Args: cobra.NoArgs,
+		RunE: runComment,
+	}
+
+	cmd.Flags().StringArrayVarP(&wiringArgs, "wiring", "w", nil, "Wiring diagram file, directory, glob pattern, http(s) URL or - for stdin, repeatable (required)")
+	cmd.Flags().StringVarP(&fabFile, "fab", "f", "", "Path or http(s) URL of fabricator config file, or - for stdin (optional)")
+	cmd.Flags().StringVar(&commentRepo, "repo", "", "GitHub repository of the pull request, owner/name (default $GITHUB_REPOSITORY)")
+	cmd.Flags().IntVar(&commentPR, "pr", 0, "Number of the pull request (default from $GITHUB_REF)")
+	cmd.Flags().StringVar(&commentToken, "github-token", "", "GitHub token allowed to comment (prefer $GITHUB_TOKEN)")
+	cmd.Flags().StringVar(&commentAPIURL, "github-api-url", "", "GitHub API URL, for GitHub Enterprise (default $GITHUB_API_URL or https://api.github.com)")
+	cmd.Flags().StringVar(&commentID, "id", "", "Name of the sticky comment, for several of them on one pull request")
+	addValidationFlags(cmd)
+	addClientFlags(cmd)
+
+	cmd.MarkFlagRequired("wiring")
+
+	return cmd
+}
+
+func runComment(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := setupValidation(cmd); err != nil {
+		return err
+	}
+	if batch {
+		return withExitCode(exitInputError, fmt.Errorf("--batch cannot be combined with a comment on one validation"))
+	}
+	comment, err := newPullRequestComment()
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	stickyComment = comment
+	if err := validateInputFiles(); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	printConfiguration()
+
+	if err := fetchRemoteInputs(append(append([]string{}, wiringFiles...), fabFile), uploadLimit); err != nil {
+		return err
+	}
+
+	return validateOnce()
+}
+
+// pullRequestComment is the sticky comment of a pull request.
+type pullRequestComment struct {
+	apiURL string
+	repo   string
+	number int
+	token  string
+	// marker is hidden in the comment to find it again
+	marker string
+	client *http.Client
+}
+
+// dashes are runs of dashes, which would end the HTML comment of a marker.
+var dashes = regexp.MustCompile(`-{2,}`)
+
+// pullRequestRef matches the refs GitHub Actions checks pull requests out at.
+var pullRequestRef = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// newPullRequestComment returns the comment the flags, or without them the
+// GitHub Actions environment, point at.
+func newPullRequestComment() (*pullRequestComment, error) {
+	comment := &pullRequestComment{
+		apiURL: strings.TrimRight(firstNonEmpty(commentAPIURL, os.Getenv("GITHUB_API_URL"), "https://api.github.com"), "/"),
+		repo:   firstNonEmpty(commentRepo, os.Getenv("GITHUB_REPOSITORY")),
+		number: commentPR,
+		token:  firstNonEmpty(commentToken, os.Getenv("GITHUB_TOKEN")),
+		marker: "<!-- hh-validator -->",
+	}
+	client, err := newNetworkClient()
+	if err != nil {
+		return nil, err
+	}
+	comment.client = client
+	if commentID != "" {
+		comment.marker = fmt.Sprintf("<!-- hh-validator:%s -->", dashes.ReplaceAllString(commentID, "-"))
+	}
+	if comment.number == 0 {
+		if match := pullRequestRef.FindStringSubmatch(os.Getenv("GITHUB_REF")); match != nil {
+			comment.number, _ = strconv.Atoi(match[1])
+		}
+	}
+
+	switch {
+	case !strings.Contains(comment.repo, "/"):
+		return nil, fmt.Errorf("--repo owner/name or GITHUB_REPOSITORY is required")
+	case comment.number <= 0:
+		return nil, fmt.Errorf("--pr or a GITHUB_REF of a pull request is required")
+	case comment.token == "":
+		return nil, fmt.Errorf("--github-token or GITHUB_TOKEN is required")
+	}
+	return comment, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// githubComment is a comment of the GitHub REST API.
+type githubComment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+}
+
+// post renders the report as Markdown and edits the sticky comment to show
+// it, or creates the comment on the first run.
+func (p *pullRequestComment) post(result *Report) error {
+	var body bytes.Buffer
+	fmt.Fprintln(&body, p.marker)
+	if err := writeMarkdown(&body, []*Report{result}); err != nil {
+		return err
+	}
+	text := body.String()
+	if len(text) > maxCommentSize {
+		notice := "\n\n_The report was cut to fit into a comment, see the CI log for all of it._\n"
+		text = strings.ToValidUTF8(text[:maxCommentSize-len(notice)], "") + notice
+	}
+
+	existing, err := p.find()
+	if err != nil {
+		return err
+	}
+	posted := &githubComment{}
+	if existing != nil {
+		err = p.request(http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", p.repo, existing.ID), map[string]string{"body": text}, posted)
+	} else {
+		err = p.request(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", p.repo, p.number), map[string]string{"body": text}, posted)
+	}
+	if err != nil {
+		return err
+	}
+
+	action := "Posted"
+	if existing != nil {
+		action = "Updated"
+	}
+	fmt.Fprintf(infoOut(), "%s comment %s\n", action, posted.HTMLURL)
+	return nil
+}
+
+// find returns the sticky comment, nil if there is none yet.
+func (p *pullRequestComment) find() (*githubComment, error) {
+	for page := 1; ; page++ {
+		comments := []githubComment{}
+		path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100&page=%d", p.repo, p.number, page)
+		if err := p.request(http.MethodGet, path, nil, &comments); err != nil {
+			return nil, err
+		}
+		for i := range comments {
+			if strings.HasPrefix(comments[i].Body, p.marker) {
+				return &comments[i], nil
+			}
+		}
+		if len(comments) < 100 {
+			return nil, nil
+		}
+	}
+}
+
+// request calls the GitHub API and decodes its response into v. Rejected
+// requests, e.g. with a token that may not comment, are input errors.
+func (p *pullRequestComment) request(method, path string, body any, v any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, p.apiURL+path, reader)
+	if err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("invalid GitHub API URL: %w", err))
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return withExitCode(exitServerError, fmt.Errorf("failed to reach GitHub: %w", err))
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return withExitCode(exitServerError, fmt.Errorf("failed to read GitHub response: %w", err))
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &failure)
+		code := exitServerError
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			code = exitInputError
+		}
+		return withExitCode(code, fmt.Errorf("GitHub answered %s %s with %s: %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, failure.Message))
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return withExitCode(exitServerError, fmt.Errorf("failed to parse GitHub response: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCLICommentProxy(t *testing.T) {
+	isolate(t)
+	wiring := writeFile(t, t.TempDir(), "wiring.yaml", testWiring)
+	server := newFakeServer(t)
+	// The proxy answers for GitHub, the server on localhost is not proxied
+	var mu sync.Mutex
+	requests := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.Host+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			w.Write([]byte("[]"))
+			return
+		}
+		json.NewEncoder(w).Encode(githubComment{ID: 1, HTMLURL: "https://github.invalid/acme/fabric/pull/42#issuecomment-1"})
+	}))
+	defer proxy.Close()
+
+	if code, output := cli(t, "comment", "-w", wiring, "-s", server.URL, "--proxy", proxy.URL,
+		"--repo", "acme/fabric", "--pr", "42", "--github-token", "secret", "--github-api-url", "http://github.invalid"); code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s", code, output)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"GET github.invalid/repos/acme/fabric/issues/42/comments", "POST github.invalid/repos/acme/fabric/issues/42/comments"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("the proxy got %v, want %v", requests, want)
+	}
+	if got := len(server.received()); got != 1 {
+		t.Errorf("the server got %d requests, want 1", got)
+	}
+}
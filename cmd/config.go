@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/http/httpproxy"
+	"gopkg.in/yaml.v3"
+
+	"validator/pkg/client"
+)
+
+// cliConfig holds the defaults read from the CLI configuration file.
+type cliConfig struct {
+	Server     string `yaml:"server"`
+	Timeout    int    `yaml:"timeout"`
+	Output     string `yaml:"output"`
+	Proxy      string `yaml:"proxy"`
+	Token      string `yaml:"token"`
+	AuthHeader string `yaml:"auth_header"`
+	TLS        struct {
+		CACert             string `yaml:"ca_cert"`
+		Cert               string `yaml:"cert"`
+		Key                string `yaml:"key"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	} `yaml:"tls"`
+}
+
+var (
+	configFile         string
+	token              string
+	authHeader         string
+	proxyURL           string
+	keyringOnce        sync.Once
+	caCert             string
+	clientCert         string
+	clientKey          string
+	insecureSkipVerify bool
+)
+
+// addClientFlags registers the flags of every command that talks to a server.
+// Their defaults come from the environment and config file, see applyConfig.
+func addClientFlags(cmd *cobra.Command) {
+	// The stored token is looked up again for the new --token
+	keyringOnce = sync.Once{}
+	cmd.Flags().StringVarP(&serverURL, "server", "s", "http://localhost:8080", "Validator server URL")
+	cmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Request timeout in seconds")
+	cmd.Flags().StringVar(&configFile, "config", "", "CLI config file (default ~/.config/hh-validator/config.yaml)")
+	cmd.Flags().StringVar(&token, "token", "", "Auth token sent to the server (prefer VALIDATOR_TOKEN or validator login)")
+	cmd.Flags().StringVar(&authHeader, "auth-header", "", "Send the token as is in this header, e.g. X-API-Key, instead of as a bearer token")
+	cmd.Flags().StringVar(&proxyURL, "proxy", "", "HTTP(S) proxy URL, overrides HTTP_PROXY and HTTPS_PROXY")
+	cmd.Flags().StringVar(&caCert, "cacert", "", "CA certificate file to verify the server with")
+	cmd.Flags().StringVar(&clientCert, "cert", "", "Client certificate file for mutual TLS")
+	cmd.Flags().StringVar(&clientKey, "key", "", "Private key file of the client certificate")
+	cmd.Flags().BoolVar(&insecureSkipVerify, "insecure-skip-verify", false, "Skip TLS certificate verification")
+}
+
+// defaultConfigPath returns ~/.config/hh-validator/config.yaml, honoring
+// XDG_CONFIG_HOME.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "hh-validator", "config.yaml")
+}
+
+// loadCLIConfig reads the configuration file. A missing default file is not
+// an error, a missing file that was asked for explicitly is.
+func loadCLIConfig(path string, explicit bool) (*cliConfig, error) {
+	cfg := &cliConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyConfig fills in every flag the user did not set from the VALIDATOR_*
+// environment variables, then from the configuration file. Flags always take
+// precedence.
+func applyConfig(cmd *cobra.Command) error {
+	path, explicit := configFile, cmd.Flags().Changed("config")
+	if !explicit {
+		if env := os.Getenv("VALIDATOR_CONFIG"); env != "" {
+			path, explicit = env, true
+		} else {
+			path = defaultConfigPath()
+		}
+	}
+	cfg, err := loadCLIConfig(path, explicit)
+	if err != nil {
+		return err
+	}
+
+	timeout := ""
+	if cfg.Timeout != 0 {
+		timeout = strconv.Itoa(cfg.Timeout)
+	}
+	insecure := ""
+	if cfg.TLS.InsecureSkipVerify {
+		insecure = "true"
+	}
+
+	settings := []struct {
+		flag, env, value string
+	}{
+		{"server", "VALIDATOR_SERVER", cfg.Server},
+		{"timeout", "VALIDATOR_TIMEOUT", timeout},
+		{"output", "VALIDATOR_OUTPUT", cfg.Output},
+		{"token", "VALIDATOR_TOKEN", cfg.Token},
+		{"auth-header", "VALIDATOR_AUTH_HEADER", cfg.AuthHeader},
+		{"proxy", "VALIDATOR_PROXY", cfg.Proxy},
+		{"cacert", "VALIDATOR_CACERT", cfg.TLS.CACert},
+		{"cert", "VALIDATOR_CERT", cfg.TLS.Cert},
+		{"key", "VALIDATOR_KEY", cfg.TLS.Key},
+		{"insecure-skip-verify", "VALIDATOR_INSECURE_SKIP_VERIFY", insecure},
+	}
+	for _, setting := range settings {
+		flag := cmd.Flags().Lookup(setting.flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		value, source := setting.value, path
+		if env, ok := os.LookupEnv(setting.env); ok {
+			value, source = env, setting.env
+		}
+		if value == "" {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid %s from %s: %w", setting.flag, source, err)
+		}
+	}
+
+	return nil
+}
+
+// newHTTPClient returns the client used to talk to the server, set up with the
+// configured timeout and TLS settings.
+func newHTTPClient() (*http.Client, error) {
+	if local {
+		return newLocalClient()
+	}
+	return newNetworkClient()
+}
+
+// newNetworkClient returns a client with the configured timeout, proxy and TLS
+// settings that goes over the network even with --local, for the hosts other
+// than the server.
+func newNetworkClient() (*http.Client, error) {
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// The default transport honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if proxyURL != "" {
+		if _, err := url.Parse(proxyURL); err != nil {
+			return nil, withExitCode(exitInputError, fmt.Errorf("invalid proxy URL: %w", err))
+		}
+		proxy := (&httpproxy.Config{
+			HTTPProxy:  proxyURL,
+			HTTPSProxy: proxyURL,
+			NoProxy:    noProxy(),
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxy(req.URL)
+		}
+	}
+	return &http.Client{
+		Timeout:   time.Duration(timeout) * time.Second,
+		Transport: transport,
+	}, nil
+}
+
+// newTLSConfig returns the TLS settings of the flags: the CA certificate to
+// verify the server with and the client certificate.
+func newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, withExitCode(exitInputError, fmt.Errorf("failed to read CA certificate: %w", err))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, withExitCode(exitInputError, fmt.Errorf("no certificates found in %s", caCert))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (clientCert == "") != (clientKey == "") {
+		return nil, withExitCode(exitInputError, fmt.Errorf("--cert and --key must be given together"))
+	}
+	if clientCert != "" {
+		pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, withExitCode(exitInputError, fmt.Errorf("failed to load client certificate: %w", err))
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+	return tlsConfig, nil
+}
+
+// noProxy returns the hosts excluded from proxying by the environment.
+func noProxy() string {
+	if value := os.Getenv("NO_PROXY"); value != "" {
+		return value
+	}
+	return os.Getenv("no_proxy")
+}
+
+// authToken returns the configured auth token, or without one the token
+// stored by `validator login`.
+func authToken() string {
+	keyringOnce.Do(func() {
+		if token == "" {
+			token = keyringToken()
+		}
+	})
+	return token
+}
+
+// authorize adds the auth token, if any, to a request.
+func authorize(req *http.Request) {
+	switch token := authToken(); {
+	case token == "":
+	case authHeader != "":
+		req.Header.Set(authHeader, token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// newClient returns the validator client of the configured server, sending
+// requests with newHTTPClient and retrying them as the flags say.
+func newClient() (*client.Client, error) {
+	httpClient, err := newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(serverURL,
+		client.WithHTTPClient(httpClient),
+		client.WithToken(authToken()),
+		client.WithAuthHeader(authHeader),
+		client.WithRetries(retries, retryBackoff),
+		client.WithRetryHook(reportRetry),
+		client.WithDebug(func(format string, args ...any) {
+			if verbose {
+				fmt.Fprintf(infoOut(), format+"\n", args...)
+			}
+		}),
+	), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func TestCLIEnvironmentHelp(t *testing.T) {
+	isolate(t)
+	documented := map[string]string{}
+	for _, match := range regexp.MustCompile(`(?m)^  --(\S+) +(VALIDATOR_\S+)$`).FindAllStringSubmatch(newRootCommand().Long, -1) {
+		documented[match[1]] = match[2]
+	}
+
+	// Every client flag but --config has its variable listed in the help
+	client := &cobra.Command{}
+	addClientFlags(client)
+	client.Flags().VisitAll(func(flag *pflag.Flag) {
+		if _, ok := documented[flag.Name]; !ok && flag.Name != "config" {
+			t.Errorf("--%s is not listed with its environment variable", flag.Name)
+		}
+	})
+
+	// And the variables listed set their flags
+	for name, env := range documented {
+		flag := newRootCommand().Flags().Lookup(name)
+		if flag == nil {
+			t.Errorf("%s is listed for --%s, which does not exist", env, name)
+			continue
+		}
+		value := map[string]string{"int": "7", "bool": "true"}[flag.Value.Type()]
+		if value == "" {
+			value = "http://listed.example.com"
+		}
+		t.Setenv(env, value)
+		cmd := newRootCommand()
+		if err := applyConfig(cmd); err != nil {
+			t.Fatal(err)
+		}
+		if got := cmd.Flags().Lookup(name).Value.String(); got != value {
+			t.Errorf("%s=%s set --%s to %q", env, value, name, got)
+		}
+		t.Setenv(env, "")
+	}
+}
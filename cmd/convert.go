@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"validator/internal/wiring"
+)
+
+var convertWrite bool
+
+func newConvertCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert FILE...",
+		Short: "Upgrade wiring and fabricator files to the current API versions",
+		Long: `Upgrade objects written against deprecated API versions, such as
+wiring.githedgehog.com/v1alpha2, to the current ones: apiVersion is replaced,
+moved fields are renamed and fields the newer versions require are set to
+their defaults. Each argument may be a file, a directory, a glob pattern, an
+http(s) URL or - for stdin. The result is formatted like validator fmt.
+
+The converted files are printed, or with --write rewritten in place; the
+changes are listed on stderr. Conversion runs locally; servers offer the same
+as POST /convert.
+
+Examples:
+  validator convert old-wiring.yaml > wiring.yaml
+  validator convert --write wiring/`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runConvert,
+	}
+
+	cmd.Flags().BoolVar(&convertWrite, "write", false, "Rewrite the files in place")
+
+	return cmd
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	files, err := rewriteInputs(args)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	for _, file := range files {
+		data, err := readInput(file)
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+		converted, changes, err := wiring.Convert(data, displayName(file))
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+
+		for _, change := range changes {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", displayName(file), describeConversion(change))
+		}
+		if convertWrite {
+			if err := writeInPlace(file, data, converted); err != nil {
+				return withExitCode(exitInputError, err)
+			}
+		} else {
+			printRewritten(file, converted, len(files) > 1)
+		}
+	}
+	return nil
+}
+
+func describeConversion(change wiring.Conversion) string {
+	switch change.Type {
+	case wiring.Upgraded:
+		return fmt.Sprintf("%s: upgraded %s to %s", change.Object, change.From, change.To)
+	case wiring.Renamed:
+		return fmt.Sprintf("%s: renamed %s to %s", change.Object, change.From, change.Path)
+	default:
+		return fmt.Sprintf("%s: set %s to %q", change.Object, change.Path, change.To)
+	}
+}
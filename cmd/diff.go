@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/wiring"
+)
+
+var noColor bool
+
+// DiffReport is what `validator diff` prints with --output json or yaml.
+type DiffReport struct {
+	Old     []string              `json:"old" yaml:"old"`
+	New     []string              `json:"new" yaml:"new"`
+	Summary DiffSummary           `json:"summary" yaml:"summary"`
+	Changes []wiring.ObjectChange `json:"changes" yaml:"changes"`
+}
+
+type DiffSummary struct {
+	Added   int `json:"added" yaml:"added"`
+	Removed int `json:"removed" yaml:"removed"`
+	Changed int `json:"changed" yaml:"changed"`
+}
+
+func newDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Show object-level changes between two wiring diagrams",
+		Long: `Compare two wiring diagrams object by object and show which switches,
+servers, connections etc. were added, removed or changed, down to the changed
+fields. OLD and NEW may each be a file, a directory, a glob pattern, an
+http(s) URL or - for stdin. The comparison runs locally.
+
+Exits with 0 when there are no differences, 1 when there are and 2 on errors.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runDiff,
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json, yaml")
+	cmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if outputFormat != outputText && outputFormat != outputJSON && outputFormat != outputYAML {
+		return withExitCode(exitInputError, fmt.Errorf("unsupported output format %q, must be one of: text, json, yaml", outputFormat))
+	}
+	if err := checkStdinUse(args); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	oldFiles, oldObjects, err := loadObjects(args[0])
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	newFiles, newObjects, err := loadObjects(args[1])
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	report := &DiffReport{Old: oldFiles, New: newFiles, Changes: wiring.Diff(oldObjects, newObjects)}
+	for _, change := range report.Changes {
+		switch change.Type {
+		case wiring.Added:
+			report.Summary.Added++
+		case wiring.Removed:
+			report.Summary.Removed++
+		case wiring.Changed:
+			report.Summary.Changed++
+		}
+	}
+
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case outputYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err = enc.Encode(report); err == nil {
+			err = enc.Close()
+		}
+	default:
+		writeDiff(os.Stdout, report, useColor())
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(report.Changes) > 0 {
+		return silentExit(exitValidationFailed, fmt.Errorf("wiring diagrams differ"))
+	}
+	return nil
+}
+
+// loadObjects parses all wiring files an argument stands for.
+func loadObjects(arg string) ([]string, []*wiring.Object, error) {
+	files, err := expandWiringArg(arg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := fetchRemoteInputs(files, defaultLimit); err != nil {
+		return nil, nil, err
+	}
+
+	objects := []*wiring.Object{}
+	for _, file := range files {
+		reader, _, err := openInput(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		parsed, err := wiring.Parse(data, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, parsed...)
+	}
+	return files, objects, nil
+}
+
+// useColor reports whether to color output, honoring NO_COLOR and only
+// coloring terminals.
+func useColor() bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+func writeDiff(w io.Writer, report *DiffReport, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	if len(report.Changes) == 0 {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+
+	for _, change := range report.Changes {
+		key := (&wiring.Object{Kind: change.Kind, Name: change.Name, Namespace: change.Namespace}).Key()
+		switch change.Type {
+		case wiring.Added:
+			fmt.Fprintln(w, paint(colorGreen, "+ "+key))
+		case wiring.Removed:
+			fmt.Fprintln(w, paint(colorRed, "- "+key))
+		case wiring.Changed:
+			fmt.Fprintln(w, paint(colorYellow, "~ "+key))
+			for _, field := range change.Fields {
+				switch {
+				case field.Old == "":
+					fmt.Fprintf(w, "    %s\n", paint(colorGreen, fmt.Sprintf("+ %s: %s", field.Path, field.New)))
+				case field.New == "":
+					fmt.Fprintf(w, "    %s\n", paint(colorRed, fmt.Sprintf("- %s: %s", field.Path, field.Old)))
+				default:
+					fmt.Fprintf(w, "    ~ %s: %s → %s\n", field.Path, paint(colorRed, field.Old), paint(colorGreen, field.New))
+				}
+			}
+		}
+	}
+
+	summary := report.Summary
+	fmt.Fprintf(w, "\n%d objects differ: %d added, %d removed, %d changed\n",
+		len(report.Changes), summary.Added, summary.Removed, summary.Changed)
+}
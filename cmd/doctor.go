@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/http/httpproxy"
+
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+// Outcomes of the checks of `validator doctor`.
+const (
+	checkOK      = "ok"
+	checkWarning = "warning"
+	checkFailed  = "failed"
+	checkSkipped = "skipped"
+)
+
+// DoctorCheck is one line of the checklist of `validator doctor`: what was
+// checked, how it went and, unless it went well, how to fix it.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// DoctorReport is what `validator doctor` prints with --output json.
+type DoctorReport struct {
+	Server string        `json:"server"`
+	OK     bool          `json:"ok"`
+	Checks []DoctorCheck `json:"checks"`
+}
+
+var doctorFiles []string
+
+func newDoctorCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the environment the CLI talks to the validator service in",
+		Long: `Check everything between the CLI and a validator service, in order: the CLI
+configuration, the files given with -w and -f, DNS, the TCP connection, the TLS
+handshake, the health of the server, the credentials and whether the versions
+of client and server are compatible. Every check is printed with how to fix
+it when it fails. Checks that depend on a failed one are skipped.
+
+Exits with 3 when a check failed, warnings do not fail.
+
+Examples:
+  validator doctor -s https://validator.internal
+  validator doctor -s https://validator.internal -w wiring.yaml -f fab.yaml`,
+		Args: cobra.NoArgs,
+		RunE: runDoctor,
+	}
+
+	cmd.Flags().StringArrayVarP(&doctorFiles, "wiring", "w", nil, "Wiring file, directory or glob pattern to check for readability, repeatable")
+	cmd.Flags().StringVarP(&fabFile, "fab", "f", "", "Fabricator config file to check for readability")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json")
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	report := &DoctorReport{OK: true}
+	add := func(check DoctorCheck) {
+		report.Checks = append(report.Checks, check)
+		report.OK = report.OK && check.Status != checkFailed
+	}
+
+	if err := applyConfig(cmd); err != nil {
+		add(DoctorCheck{Name: "config", Status: checkFailed, Detail: err.Error(), Hint: "fix or remove the config file, see --config and VALIDATOR_CONFIG"})
+	} else {
+		add(checkCLIConfig(cmd))
+	}
+	switch {
+	case outputFormat == outputText || outputFormat == outputJSON:
+	case !cmd.Flags().Changed("output"):
+		outputFormat = outputText
+	default:
+		return withExitCode(exitInputError, fmt.Errorf("unsupported output format %q, must be one of: text, json", outputFormat))
+	}
+	report.Server = serverURL
+
+	add(checkFiles())
+	for _, check := range checkServer() {
+		add(check)
+	}
+
+	if outputFormat == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeDoctor(os.Stdout, report)
+	}
+
+	if !report.OK {
+		return silentExit(exitServerError, errors.New("doctor found problems"))
+	}
+	return nil
+}
+
+// checkCLIConfig reports the config file the settings were read from.
+func checkCLIConfig(cmd *cobra.Command) DoctorCheck {
+	path := configFile
+	if !cmd.Flags().Changed("config") {
+		if path = os.Getenv("VALIDATOR_CONFIG"); path == "" {
+			path = defaultConfigPath()
+		}
+	}
+	if _, err := os.Stat(path); path == "" || errors.Is(err, os.ErrNotExist) {
+		return DoctorCheck{Name: "config", Status: checkOK, Detail: "no config file, using flags and VALIDATOR_* variables"}
+	}
+	return DoctorCheck{Name: "config", Status: checkOK, Detail: "read " + path}
+}
+
+// checkFiles reads the files given with -w and -f, as a validation would.
+func checkFiles() DoctorCheck {
+	check := DoctorCheck{Name: "files"}
+	if len(doctorFiles) == 0 && fabFile == "" {
+		check.Status, check.Detail = checkSkipped, "no files given"
+		check.Hint = "pass -w and -f to check the files you validate"
+		return check
+	}
+
+	files := []string{}
+	if len(doctorFiles) > 0 {
+		resolved, err := resolveWiringFiles(doctorFiles)
+		if err != nil {
+			check.Status, check.Detail = checkFailed, err.Error()
+			check.Hint = "check the paths and patterns given with -w"
+			return check
+		}
+		files = append(files, resolved...)
+	}
+	if fabFile != "" {
+		files = append(files, fabFile)
+	}
+
+	checked := 0
+	for _, file := range files {
+		if file == stdinArg || isRemoteInput(file) {
+			continue
+		}
+		f, err := os.Open(file)
+		if err == nil {
+			_, err = io.Copy(io.Discard, f)
+			f.Close()
+		}
+		if err != nil {
+			check.Status, check.Detail = checkFailed, err.Error()
+			check.Hint = "make the file readable by " + currentUser() + ", or check its path"
+			return check
+		}
+		if info, _ := os.Stat(file); info != nil && info.Size() > uploadLimit(file) {
+			check.Status = checkWarning
+			check.Detail = fmt.Sprintf("%s is larger than the %d bytes the server accepts", file, uploadLimit(file))
+			check.Hint = "split the wiring, or raise the upload_limits of the server"
+			return check
+		}
+		checked++
+	}
+	check.Status, check.Detail = checkOK, fmt.Sprintf("%d readable", checked)
+	return check
+}
+
+func currentUser() string {
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return "the current user"
+}
+
+// checkServer checks the way to the server step by step, skipping the
+// steps after the first that failed.
+func checkServer() []DoctorCheck {
+	names := []string{"dns", "connect", "tls", "health", "auth", "version"}
+	checks := []DoctorCheck{}
+	skip := func(reason string) []DoctorCheck {
+		for _, name := range names[len(checks):] {
+			checks = append(checks, DoctorCheck{Name: name, Status: checkSkipped, Detail: reason})
+		}
+		return checks
+	}
+
+	u, err := url.Parse(serverURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		checks = append(checks, DoctorCheck{Name: "dns", Status: checkFailed, Detail: fmt.Sprintf("invalid server URL %q", serverURL), Hint: "pass an http(s) URL such as https://validator.internal with --server or VALIDATOR_SERVER"})
+		return skip("invalid server URL")
+	}
+	ctx := context.Background()
+	deadline := time.Duration(timeout) * time.Second
+
+	// Through a proxy, DNS and the connection are the proxy's
+	target, via := u, ""
+	if proxy := serverProxy(u); proxy != nil {
+		target, via = proxy, " (proxy)"
+	}
+	port := target.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[target.Scheme]
+	}
+
+	dns := DoctorCheck{Name: "dns", Status: checkOK}
+	if ip := net.ParseIP(target.Hostname()); ip != nil {
+		dns.Detail = target.Hostname() + " is an address"
+	} else {
+		lookupCtx, cancel := context.WithTimeout(ctx, deadline)
+		addrs, err := net.DefaultResolver.LookupHost(lookupCtx, target.Hostname())
+		cancel()
+		if err != nil {
+			dns.Status, dns.Detail = checkFailed, err.Error()
+			dns.Hint = "check the host name of --server" + via + ", /etc/resolv.conf and whether a VPN is needed to resolve it"
+			checks = append(checks, dns)
+			return skip("DNS failed")
+		}
+		dns.Detail = fmt.Sprintf("%s%s resolves to %s", target.Hostname(), via, strings.Join(addrs, ", "))
+	}
+	checks = append(checks, dns)
+
+	address := net.JoinHostPort(target.Hostname(), port)
+	started := time.Now()
+	conn, err := net.DialTimeout("tcp", address, deadline)
+	if err != nil {
+		checks = append(checks, DoctorCheck{Name: "connect", Status: checkFailed, Detail: err.Error(),
+			Hint: "check that the server" + via + " runs and listens on " + address + ", and that no firewall blocks the port"})
+		return skip("no connection")
+	}
+	conn.Close()
+	checks = append(checks, DoctorCheck{Name: "connect", Status: checkOK, Detail: fmt.Sprintf("connected to %s%s in %s", address, via, time.Since(started).Round(time.Millisecond))})
+
+	checks = append(checks, checkTLS(u, address, via, deadline))
+	if checks[len(checks)-1].Status == checkFailed {
+		return skip("TLS failed")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		checks = append(checks, DoctorCheck{Name: "health", Status: checkFailed, Detail: err.Error()})
+		return skip("no client")
+	}
+	health := checkHealth(ctx, c)
+	checks = append(checks, health)
+	if health.Status == checkFailed && health.Detail == "" {
+		return skip("the server did not answer")
+	}
+
+	capabilities, err := c.Capabilities(ctx)
+	checks = append(checks, checkAuth(capabilities, err))
+	checks = append(checks, checkVersion(ctx, c, capabilities, err))
+	return checks
+}
+
+// serverProxy returns the proxy requests to u go through, nil without one.
+func serverProxy(u *url.URL) *url.URL {
+	config := httpproxy.FromEnvironment()
+	if proxyURL != "" {
+		config = &httpproxy.Config{HTTPProxy: proxyURL, HTTPSProxy: proxyURL, NoProxy: noProxy()}
+	}
+	proxy, err := config.ProxyFunc()(u)
+	if err != nil {
+		return nil
+	}
+	return proxy
+}
+
+// checkTLS shakes hands with the server the way the client does. Through a
+// proxy the handshake is left to the health check.
+func checkTLS(u *url.URL, address, via string, deadline time.Duration) DoctorCheck {
+	check := DoctorCheck{Name: "tls"}
+	switch {
+	case u.Scheme != "https":
+		check.Status, check.Detail = checkSkipped, "plain HTTP"
+		if !isLoopback(u.Hostname()) {
+			check.Status = checkWarning
+			check.Hint = "tokens and uploads cross the network unencrypted, use an https:// server URL if the server offers one"
+		}
+		return check
+	case via != "":
+		check.Status, check.Detail = checkSkipped, "through a proxy, checked with the health of the server"
+		return check
+	}
+
+	config, err := newTLSConfig()
+	if err != nil {
+		check.Status, check.Detail = checkFailed, err.Error()
+		check.Hint = "check the files given with --cacert, --cert and --key"
+		return check
+	}
+	config.ServerName = u.Hostname()
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: deadline}, "tcp", address, config)
+	if err != nil {
+		check.Status, check.Detail = checkFailed, err.Error()
+		var unknown x509.UnknownAuthorityError
+		var hostname x509.HostnameError
+		var invalid x509.CertificateInvalidError
+		switch {
+		case errors.As(err, &unknown):
+			check.Hint = "the server certificate is signed by a CA this machine does not trust, pass it with --cacert"
+		case errors.As(err, &hostname):
+			check.Hint = "the server certificate is not for " + u.Hostname() + ", use the host name it was issued for"
+		case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+			check.Hint = "the server certificate expired or the clock of this machine is wrong"
+		case strings.Contains(err.Error(), "certificate required") || strings.Contains(err.Error(), "bad certificate"):
+			check.Hint = "the server requires a client certificate, pass it with --cert and --key"
+		default:
+			check.Hint = "check that the server speaks TLS on this port, or use an http:// URL"
+		}
+		return check
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	check.Status = checkOK
+	check.Detail = tls.VersionName(state.Version)
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		check.Detail += fmt.Sprintf(", certificate valid until %s", leaf.NotAfter.Format("2006-01-02"))
+		if until := time.Until(leaf.NotAfter); until < 14*24*time.Hour {
+			check.Status = checkWarning
+			check.Hint = fmt.Sprintf("the server certificate expires in %d days, renew it", int(until.Hours()/24))
+		}
+	}
+	if insecureSkipVerify {
+		check.Status = checkWarning
+		check.Hint = "the certificate is not verified with --insecure-skip-verify, pass the CA with --cacert instead"
+	}
+	return check
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkHealth asks /health, failing without a Detail when no answer came.
+func checkHealth(ctx context.Context, c *client.Client) DoctorCheck {
+	check := DoctorCheck{Name: "health"}
+	health, err := c.Health(ctx)
+	if err != nil {
+		check.Status = checkFailed
+		var status *client.StatusError
+		switch {
+		case errors.As(err, &status) && (status.StatusCode == http.StatusUnauthorized || status.StatusCode == http.StatusForbidden):
+			// Left to the auth check
+			check.Status, check.Detail = checkSkipped, "the credentials were refused"
+		case errors.As(err, &status):
+			check.Detail = err.Error()
+			check.Hint = "the server answered, but not like a validator service; check the URL and any proxy or ingress in front of it"
+		default:
+			check.Hint = "the server accepted the connection but did not answer: " + err.Error()
+		}
+		return check
+	}
+
+	check.Status, check.Detail = checkOK, health.Status
+	if health.HHFabVersion != "" {
+		check.Detail += " (" + health.HHFabVersion + ")"
+	}
+	failing := []string{}
+	for _, dependency := range health.Dependencies {
+		if !dependency.OK {
+			failing = append(failing, dependency.Name+": "+dependency.Detail)
+		}
+	}
+	switch {
+	case health.Status == "unhealthy":
+		check.Status = checkFailed
+		check.Detail += ": " + health.Error
+		check.Hint = "the server cannot validate, ask its operators; `validator health` shows its checks"
+	case health.Status != "healthy" || len(failing) > 0:
+		check.Status = checkWarning
+		if health.Error != "" {
+			check.Detail += ": " + health.Error
+		}
+		if len(failing) > 0 {
+			check.Detail += "; not ready: " + strings.Join(failing, "; ")
+		}
+		check.Hint = "validations may be slow, refused or checked against schemas only until the server recovers"
+	}
+	return check
+}
+
+// checkAuth reports the role the credentials get, from /capabilities.
+func checkAuth(capabilities *CapabilitiesResponse, err error) DoctorCheck {
+	check := DoctorCheck{Name: "auth"}
+	var status *client.StatusError
+	switch {
+	case errors.As(err, &status) && status.StatusCode == http.StatusUnauthorized:
+		check.Status, check.Detail = checkFailed, err.Error()
+		check.Hint = "the token was refused, check --token, VALIDATOR_TOKEN and --auth-header, or run `validator login` again"
+		return check
+	case errors.As(err, &status) && status.StatusCode == http.StatusForbidden:
+		check.Status, check.Detail = checkFailed, err.Error()
+		check.Hint = "the server does not let these credentials or this address in, ask its operators for a token with the validator role or to allow the address"
+		return check
+	case errors.As(err, &status) && status.StatusCode == http.StatusNotFound:
+		check.Status, check.Detail = checkSkipped, "the server is too old to report the role of credentials"
+		return check
+	case err != nil:
+		check.Status, check.Detail = checkFailed, err.Error()
+		return check
+	}
+
+	check.Status = checkOK
+	credentials := "without credentials"
+	if authToken() != "" {
+		credentials = "with the token"
+	}
+	if capabilities.Role == "" {
+		check.Detail = credentials + ", the server does not report roles"
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s: role %s of tenant %s", credentials, capabilities.Role, capabilities.Tenant)
+	if capabilities.Role == api.RoleViewer {
+		check.Status = checkWarning
+		check.Hint = "viewers cannot validate; pass a token or API key with the validator role"
+	}
+	return check
+}
+
+// checkVersion compares the versions of client and server like `validator
+// version`.
+func checkVersion(ctx context.Context, c *client.Client, capabilities *CapabilitiesResponse, err error) DoctorCheck {
+	check := DoctorCheck{Name: "version"}
+	srv := &ServerVersion{URL: serverURL}
+	var status *client.StatusError
+	switch {
+	case err == nil:
+		srv.Version, srv.SchemaVersion = capabilities.Version, capabilities.SchemaVersion
+	case errors.As(err, &status) && status.StatusCode == http.StatusNotFound:
+		info, err := c.Info(ctx)
+		if err != nil {
+			check.Status, check.Detail = checkSkipped, err.Error()
+			return check
+		}
+		srv.Version = info.Version
+	default:
+		check.Status, check.Detail = checkSkipped, "the server did not report its version"
+		return check
+	}
+
+	check.Status = checkOK
+	check.Detail = fmt.Sprintf("client %s, server %s", cliVersion, srv.Version)
+	if warnings := compatibilityWarnings(clientVersion(), srv); len(warnings) > 0 {
+		check.Status = checkWarning
+		check.Detail += ": " + strings.Join(warnings, "; ")
+		check.Hint = "install the CLI matching the server, see `validator version`"
+	}
+	return check
+}
+
+func writeDoctor(w io.Writer, report *DoctorReport) {
+	marks := map[string]string{checkOK: "✓", checkWarning: "!", checkFailed: "✗", checkSkipped: "-"}
+	fmt.Fprintf(w, "Server: %s\n\n", report.Server)
+	for _, check := range report.Checks {
+		line := fmt.Sprintf("%s %s", marks[check.Status], check.Name)
+		if check.Detail != "" {
+			line += ": " + check.Detail
+		}
+		fmt.Fprintln(w, line)
+		if check.Hint != "" {
+			fmt.Fprintf(w, "    %s\n", check.Hint)
+		}
+	}
+	if report.OK {
+		fmt.Fprintln(w, "\nNo problems found.")
+	}
+}
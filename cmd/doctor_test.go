@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"validator/pkg/api"
+)
+
+// doctorServer answers like a healthy validator service with a matching
+// version, refusing /capabilities with status if it is not zero.
+func doctorServer(t *testing.T, status int) *fakeServer {
+	server := newFakeServer(t)
+	server.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/health":
+			json.NewEncoder(w).Encode(HealthResponse{Status: "healthy", Version: cliVersion})
+		case r.URL.Path == "/capabilities" && status != 0:
+			w.WriteHeader(status)
+			problem := map[int]string{http.StatusUnauthorized: api.ProblemUnauthorized, http.StatusForbidden: api.ProblemForbidden}[status]
+			json.NewEncoder(w).Encode(api.Problem{Type: problem, Title: http.StatusText(status), Status: status})
+		case r.URL.Path == "/capabilities":
+			json.NewEncoder(w).Encode(CapabilitiesResponse{Version: cliVersion, SchemaVersion: clientVersion().SchemaVersion, Role: api.RoleValidator, Tenant: "default"})
+		default:
+			http.NotFound(w, r)
+		}
+	}
+	return server
+}
+
+// doctor runs `validator doctor -o json` and returns the checks by name.
+func doctor(t *testing.T, args ...string) (int, DoctorReport, map[string]DoctorCheck) {
+	t.Helper()
+	code, output := cli(t, append([]string{"doctor", "-o", "json"}, args...)...)
+	var report DoctorReport
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("%v, output:\n%s", err, output)
+	}
+	checks := map[string]DoctorCheck{}
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+	return code, report, checks
+}
+
+func TestCLIDoctorHealthy(t *testing.T) {
+	isolate(t)
+	server := doctorServer(t, 0)
+
+	code, output := cli(t, "doctor", "-s", server.URL)
+	if code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s", code, output)
+	}
+	for _, line := range []string{
+		"Server: " + server.URL,
+		"✓ dns: 127.0.0.1 is an address",
+		"- tls: plain HTTP",
+		"✓ health: healthy",
+		"✓ auth: without credentials: role validator of tenant default",
+		"✓ version: client " + cliVersion + ", server " + cliVersion,
+		"No problems found.",
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("output lacks %q:\n%s", line, output)
+		}
+	}
+
+	_, report, _ := doctor(t, "-s", server.URL)
+	if !report.OK {
+		t.Errorf("report not OK: %+v", report.Checks)
+	}
+	for _, check := range report.Checks {
+		if check.Status == checkFailed || check.Status == checkWarning {
+			t.Errorf("check %s is %s: %s", check.Name, check.Status, check.Detail)
+		}
+	}
+}
+
+func TestCLIDoctorTLS(t *testing.T) {
+	isolate(t)
+	server := &fakeServer{}
+	server.Server = httptest.NewTLSServer(server)
+	defer server.Close()
+
+	// The test server's certificate is signed by no CA the machine trusts
+	code, report, checks := doctor(t, "-s", server.URL)
+	if code != exitServerError || report.OK {
+		t.Errorf("exit code %d, ok %v, want %d and not ok", code, report.OK, exitServerError)
+	}
+	if check := checks["connect"]; check.Status != checkOK {
+		t.Errorf("connect is %s: %s", check.Status, check.Detail)
+	}
+	if check := checks["tls"]; check.Status != checkFailed || !strings.Contains(check.Hint, "--cacert") {
+		t.Errorf("tls is %s with hint %q, want failed pointing at --cacert", check.Status, check.Hint)
+	}
+	for _, name := range []string{"health", "auth", "version"} {
+		if check := checks[name]; check.Status != checkSkipped || check.Detail != "TLS failed" {
+			t.Errorf("%s is %s: %s, want skipped after TLS failed", name, check.Status, check.Detail)
+		}
+	}
+}
+
+func TestCLIDoctorAuth(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		hint   string
+	}{
+		{http.StatusUnauthorized, "the token was refused"},
+		{http.StatusForbidden, "the validator role or to allow the address"},
+	} {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			isolate(t)
+			server := doctorServer(t, tc.status)
+
+			code, report, checks := doctor(t, "-s", server.URL, "--token", "secret")
+			if code != exitServerError || report.OK {
+				t.Errorf("exit code %d, ok %v, want %d and not ok", code, report.OK, exitServerError)
+			}
+			if check := checks["health"]; check.Status != checkOK {
+				t.Errorf("health is %s: %s", check.Status, check.Detail)
+			}
+			if check := checks["auth"]; check.Status != checkFailed || !strings.Contains(check.Hint, tc.hint) {
+				t.Errorf("auth is %s with hint %q, want failed with %q", check.Status, check.Hint, tc.hint)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+
+	"validator/pkg/client"
+)
+
+// Exit codes returned by the CLI. They are part of the CLI contract so
+// pipelines can tell transient failures from genuine configuration errors.
+const (
+	exitOK               = 0
+	exitValidationFailed = 1
+	exitInputError       = 2
+	exitServerError      = 3
+	exitTimeout          = 4
+)
+
+const exitCodesHelp = `Exit codes:
+  0  validation passed
+  1  validation failed
+  2  input error (bad flags, missing or unreadable files)
+  3  network or server error
+  4  timeout`
+
+// exitError carries the exit code for an error up to main. Silent errors
+// have already been reported to the user.
+type exitError struct {
+	code   int
+	err    error
+	silent bool
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+// silentExit exits with code without printing anything more.
+func silentExit(code int, err error) error {
+	return &exitError{code: code, err: err, silent: true}
+}
+
+func isSilent(err error) bool {
+	var tagged *exitError
+	return errors.As(err, &tagged) && tagged.silent
+}
+
+// errValidationFailed is returned once a failed validation was reported, so
+// there is nothing left to print.
+var errValidationFailed = silentExit(exitValidationFailed, errors.New("validation failed"))
+
+// exitCodeFor classifies an error. Errors not explicitly tagged are treated
+// as network errors when they come from the HTTP client and as input errors
+// otherwise, which covers cobra's flag parsing errors.
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var tagged *exitError
+	if errors.As(err, &tagged) {
+		return tagged.code
+	}
+
+	// Failed validations are results, other responses mean the server failed
+	// or rejected the request
+	var status *client.StatusError
+	if errors.As(err, &status) {
+		if status.Temporary() {
+			return exitServerError
+		}
+		return exitInputError
+	}
+	var response *client.ResponseError
+	if errors.As(err, &response) {
+		return exitServerError
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return exitTimeout
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return exitServerError
+	}
+
+	return exitInputError
+}
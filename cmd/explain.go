@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+)
+
+func newExplainCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain [CODE]",
+		Short: "Describe a diagnostic code and how to fix it",
+		Long: `Describe a diagnostic code such as HHV001, or its name such as yaml-parse,
+with its likely causes and remediation steps. Codes are shown next to every error in the validation
+output. Without a code, all known codes are listed.
+
+The catalog is built into the CLI, the server serves the same one at
+GET /explain/:code.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runExplain,
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json, yaml")
+
+	return cmd
+}
+
+func runExplain(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if outputFormat != outputText && outputFormat != outputJSON && outputFormat != outputYAML {
+		return withExitCode(exitInputError, fmt.Errorf("unsupported output format %q, must be one of: text, json, yaml", outputFormat))
+	}
+
+	if len(args) == 0 {
+		all := codes.All()
+		if outputFormat == outputText {
+			return writeCodeList(os.Stdout, all)
+		}
+		return encodeExplain(os.Stdout, all)
+	}
+
+	code, ok := codes.Lookup(args[0])
+	if !ok {
+		return withExitCode(exitInputError, fmt.Errorf("unknown code %q, run 'validator explain' to list all codes", args[0]))
+	}
+	if outputFormat == outputText {
+		writeCode(os.Stdout, code)
+		return nil
+	}
+	return encodeExplain(os.Stdout, code)
+}
+
+func encodeExplain(w io.Writer, v any) error {
+	if outputFormat == outputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func writeCodeList(w io.Writer, all []codes.Code) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODE\tNAME\tTITLE")
+	for _, code := range all {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", code.ID, code.Name, code.Title)
+	}
+	return tw.Flush()
+}
+
+func writeCode(w io.Writer, code codes.Code) {
+	fmt.Fprintf(w, "%s (%s): %s\n\n%s\n", code.ID, code.Name, code.Title, code.Description)
+	fmt.Fprintln(w, "\nLikely causes:")
+	for _, cause := range code.Causes {
+		fmt.Fprintf(w, "  - %s\n", cause)
+	}
+	fmt.Fprintln(w, "\nRemediation:")
+	for _, step := range code.Remediation {
+		fmt.Fprintf(w, "  - %s\n", step)
+	}
+}
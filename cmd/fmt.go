@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"validator/internal/wiring"
+)
+
+var (
+	fmtWrite bool
+	fmtCheck bool
+)
+
+func newFmtCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fmt FILE...",
+		Short: "Rewrite wiring and fabricator files in canonical form",
+		Long: `Format wiring and fabricator YAML canonically: apiVersion, kind, metadata and
+spec first, all other keys sorted, two-space indentation, no needless quotes and
+lists whose order does not matter sorted. Comments are kept. Each argument may
+be a file, a directory, a glob pattern, an http(s) URL or - for stdin.
+
+Formatted files make diffs show only real changes. Formatting runs locally;
+servers offer the same as POST /format.
+
+Without flags the formatted files are printed. --write rewrites local files in
+place, --check lists the files that are not formatted and exits with 1 if
+there are any.
+
+Examples:
+  validator fmt --write wiring/
+  validator fmt --check wiring/ fab.yaml`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runFmt,
+	}
+
+	cmd.Flags().BoolVar(&fmtWrite, "write", false, "Rewrite the files in place")
+	cmd.Flags().BoolVar(&fmtCheck, "check", false, "List the files that are not formatted and fail if there are any")
+	cmd.MarkFlagsMutuallyExclusive("write", "check")
+
+	return cmd
+}
+
+func runFmt(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	files, err := rewriteInputs(args)
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	unformatted := 0
+	for _, file := range files {
+		data, err := readInput(file)
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+		formatted, err := wiring.Format(data, displayName(file))
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+
+		switch {
+		case fmtCheck:
+			if !bytes.Equal(data, formatted) {
+				fmt.Println(displayName(file))
+				unformatted++
+			}
+		case fmtWrite:
+			if err := writeInPlace(file, data, formatted); err != nil {
+				return withExitCode(exitInputError, err)
+			}
+		default:
+			printRewritten(file, formatted, len(files) > 1)
+		}
+	}
+
+	if unformatted > 0 {
+		return silentExit(exitValidationFailed, fmt.Errorf("%d files are not formatted", unformatted))
+	}
+	return nil
+}
+
+// rewriteInputs expands the file, directory, glob, URL and stdin arguments of
+// commands rewriting files, and downloads remote ones.
+func rewriteInputs(args []string) ([]string, error) {
+	if err := checkStdinUse(args); err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, arg := range args {
+		expanded, err := expandWiringArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, expanded...)
+	}
+	return files, fetchRemoteInputs(files, defaultLimit)
+}
+
+func readInput(file string) ([]byte, error) {
+	reader, _, err := openInput(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// writeInPlace replaces a local file with its rewritten content, unless it
+// did not change.
+func writeInPlace(file string, data, rewritten []byte) error {
+	if file == stdinArg || isRemoteInput(file) {
+		return fmt.Errorf("cannot write %s in place", displayName(file))
+	}
+	if bytes.Equal(data, rewritten) {
+		return nil
+	}
+	if err := os.WriteFile(file, rewritten, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
+
+// printRewritten prints a rewritten file. Several files are marked like helm
+// template does, which keeps the output one valid YAML stream.
+func printRewritten(file string, rewritten []byte, several bool) {
+	if several {
+		fmt.Printf("---\n# Source: %s\n", displayName(file))
+	}
+	os.Stdout.Write(rewritten)
+}
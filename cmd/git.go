@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gitRepo   string
+	gitRef    string
+	gitPaths  []string
+	gitFab    string
+	gitStaged bool
+)
+
+func newGitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "git",
+		Short: "Validate wiring files as they are at a git ref",
+		Long: `Validate the wiring files of a git repository as they are at any commit,
+branch or tag, without checking it out. Paths are relative to the repository
+root; directories are searched recursively for YAML files. git itself is not
+needed.
+
+Examples:
+  # Validate what is on main
+  validator git --ref main --path wiring/
+
+  # Compare against your branch
+  validator git --ref my-branch --path wiring/ -f fab.yaml
+
+  # Validate what is about to be committed
+  validator git --staged --path wiring/
+
+` + exitCodesHelp,
+		Args: cobra.NoArgs,
+		RunE: runGit,
+	}
+
+	cmd.Flags().StringVarP(&gitRepo, "repo", "C", ".", "Path to the git repository")
+	cmd.Flags().StringVar(&gitRef, "ref", "HEAD", "Commit, branch or tag to validate")
+	cmd.Flags().StringArrayVar(&gitPaths, "path", []string{"."}, "Wiring file or directory in the repository, repeatable")
+	cmd.Flags().StringVarP(&gitFab, "fab", "f", "", "Fabricator config file in the repository (optional)")
+	cmd.Flags().BoolVar(&gitStaged, "staged", false, "Validate the files staged in the index instead of a ref")
+	cmd.MarkFlagsMutuallyExclusive("ref", "staged")
+	addValidationFlags(cmd)
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func runGit(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := setupValidation(cmd); err != nil {
+		return err
+	}
+
+	files, err := loadGitInputs()
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	wiringFiles = files
+
+	printConfiguration()
+
+	return validateInputs()
+}
+
+// loadGitInputs extracts the wiring files and the fab file at the ref into
+// loadedInputs, named ref:path, and returns the wiring file names. With
+// --staged they are taken from the index and named :path, as git does.
+func loadGitInputs() ([]string, error) {
+	repo, err := git.PlainOpenWithOptions(gitRepo, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening git repository %s: %w", gitRepo, err)
+	}
+	blobs, err := listGitFiles(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	explicit := map[string]bool{}
+	for _, p := range gitPaths {
+		explicit[path.Clean(p)] = true
+	}
+
+	names := make([]string, 0, len(blobs))
+	for name := range blobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	where := gitRef
+	if gitStaged {
+		where = "the index"
+	}
+	files := []string{}
+	for _, name := range names {
+		// Files named explicitly are taken whatever their extension
+		if !underGitPaths(name) || !(isYAMLFile(name) || explicit[name]) {
+			continue
+		}
+		input, err := loadGitFile(repo, name, blobs[name])
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, input)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no YAML files found at %s in %s", where, strings.Join(gitPaths, ", "))
+	}
+
+	fabFile = ""
+	if gitFab != "" {
+		name := path.Clean(gitFab)
+		hash, ok := blobs[name]
+		if !ok {
+			return nil, fmt.Errorf("%s does not exist at %s", gitFab, where)
+		}
+		if fabFile, err = loadGitFile(repo, name, hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// listGitFiles returns the blobs of all files at the ref, or in the index
+// with --staged, by their path from the repository root.
+func listGitFiles(repo *git.Repository) (map[string]plumbing.Hash, error) {
+	blobs := map[string]plumbing.Hash{}
+	if gitStaged {
+		index, err := repo.Storer.Index()
+		if err != nil {
+			return nil, fmt.Errorf("reading the git index: %w", err)
+		}
+		for _, entry := range index.Entries {
+			blobs[entry.Name] = entry.Hash
+		}
+		return blobs, nil
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(gitRef))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", gitRef, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("reading commit %s: %w", gitRef, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("reading the tree of %s: %w", gitRef, err)
+	}
+	err = tree.Files().ForEach(func(file *object.File) error {
+		blobs[file.Name] = file.Hash
+		return nil
+	})
+	return blobs, err
+}
+
+// underGitPaths reports whether the file is one of --path or below one.
+func underGitPaths(name string) bool {
+	for _, p := range gitPaths {
+		p = path.Clean(p)
+		if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func loadGitFile(repo *git.Repository, name string, hash plumbing.Hash) (string, error) {
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", name, err)
+	}
+	input := gitRef + ":" + name
+	if gitStaged {
+		input = ":" + name
+	}
+	loadedInputs[input] = loadedInput{content: content, name: path.Base(name)}
+	return input, nil
+}
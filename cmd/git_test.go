@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitFiles writes the files into the worktree of repo and commits them.
+func commitFiles(t *testing.T, repo *git.Repository, files map[string]string) {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stageFiles(t, repo, files)
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := worktree.Commit("update wiring", &git.CommitOptions{Author: signature}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stageFiles writes the files into the worktree of repo and adds them to the
+// index.
+func stageFiles(t *testing.T, repo *git.Repository, files map[string]string) {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		writeFile(t, worktree.Filesystem.Root(), name, data)
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCLIGit(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(t, repo, map[string]string{
+		"wiring/rack-1.yaml": testWiring,
+		"wiring/README.md":   "# invalid\n",
+		"other/site.yaml":    testWiring + "# invalid\n",
+	})
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := repo.CreateTag("v1", head.Hash(), &git.CreateTagOptions{Tagger: signature, Message: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(t, repo, map[string]string{"wiring/rack-1.yaml": testWiring + "# invalid\n"})
+	server := newFakeServer(t)
+
+	uploaded := func() []string {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return server.files[len(server.files)-1]
+	}
+
+	// Refs are read from the objects of the repository, tags are peeled
+	if code, output := cli(t, "git", "-C", dir, "--ref", "v1", "--path", "wiring/", "-s", server.URL); code != exitOK {
+		t.Fatalf("exit code %d at v1, output:\n%s", code, output)
+	}
+	if got := uploaded(); !reflect.DeepEqual(got, []string{"rack-1.yaml"}) {
+		t.Errorf("uploaded %v at v1, want the YAML files below wiring/", got)
+	}
+	if code, _ := cli(t, "git", "-C", dir, "--path", "wiring", "-s", server.URL); code != exitValidationFailed {
+		t.Errorf("exit code %d at HEAD, want %d", code, exitValidationFailed)
+	}
+	if code, _ := cli(t, "git", "-C", dir, "--ref", "HEAD~1", "--path", "wiring", "-f", "other/site.yaml", "-s", server.URL); code != exitValidationFailed {
+		t.Errorf("exit code %d with the fab file, want %d", code, exitValidationFailed)
+	}
+	if got := uploaded(); !reflect.DeepEqual(got, []string{"rack-1.yaml", "site.yaml"}) {
+		t.Errorf("uploaded %v with the fab file", got)
+	}
+
+	// The index holds what is about to be committed, found from within
+	// the worktree
+	stageFiles(t, repo, map[string]string{"wiring/rack-1.yaml": testWiring, "wiring/rack-2.yaml": testWiring})
+	if code, output := cli(t, "git", "-C", filepath.Join(dir, "wiring"), "--staged", "--path", "wiring/", "-s", server.URL); code != exitOK {
+		t.Fatalf("exit code %d with --staged, output:\n%s", code, output)
+	}
+	if got := uploaded(); !reflect.DeepEqual(got, []string{"rack-1.yaml", "rack-2.yaml"}) {
+		t.Errorf("uploaded %v with --staged", got)
+	}
+
+	for _, args := range [][]string{
+		{"--ref", "no-such-ref"},
+		{"--path", "missing/"},
+		{"--path", "wiring/", "-f", "missing.yaml"},
+	} {
+		args = append([]string{"git", "-C", dir, "-s", server.URL}, args...)
+		if code, _ := cli(t, args...); code != exitInputError {
+			t.Errorf("exit code %d for %s, want %d", code, strings.Join(args, " "), exitInputError)
+		}
+	}
+	if code, _ := cli(t, "git", "-C", t.TempDir(), "-s", server.URL); code != exitInputError {
+		t.Errorf("exit code %d outside a repository, want %d", code, exitInputError)
+	}
+}
+
+func TestCLIHooksPath(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	// Hooks go into the git directory
+	if code, output := cli(t, "hooks", "install", "--path", "wiring/"); code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s", code, output)
+	}
+	script, err := os.ReadFile(filepath.Join(dir, ".git", "hooks", "pre-commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(script), hookMarker) {
+		t.Errorf("hook without marker:\n%s", script)
+	}
+
+	// Or where core.hooksPath says, relative to the worktree
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Raw.Section("core").SetOption("hooksPath", "githooks")
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if code, output := cli(t, "hooks", "install", "--type", "pre-push"); code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s", code, output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "githooks", "pre-push")); err != nil {
+		t.Error(err)
+	}
+}
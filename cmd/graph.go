@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"validator/internal/topology"
+	"validator/internal/wiring"
+)
+
+var graphFormat string
+
+func newGraphCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "graph WIRING...",
+		Short: "Draw the switches, servers and connections of a wiring diagram",
+		Long: `Render a wiring diagram as a graph of its switches, servers and connections,
+as Graphviz DOT, Mermaid or SVG. Each argument may be a file, a directory, a glob
+pattern, an http(s) URL or - for stdin. The graph is built locally; servers
+offer the same as POST /topology.
+
+Devices that connections refer to but that are not defined are drawn dashed.
+
+Examples:
+  validator graph wiring/ | dot -Tsvg > wiring.svg
+  validator graph wiring.yaml -o mermaid
+  validator graph wiring.yaml -o svg > wiring.svg`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runGraph,
+	}
+
+	cmd.Flags().StringVarP(&graphFormat, "output", "o", topology.FormatDOT, "Output format: "+strings.Join(topology.Formats, ", "))
+
+	return cmd
+}
+
+func runGraph(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if !slices.Contains(topology.Formats, graphFormat) {
+		return withExitCode(exitInputError, fmt.Errorf("unsupported output format %q, must be one of: %s", graphFormat, strings.Join(topology.Formats, ", ")))
+	}
+	if err := checkStdinUse(args); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	objects := []*wiring.Object{}
+	for _, arg := range args {
+		_, parsed, err := loadObjects(arg)
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+		objects = append(objects, parsed...)
+	}
+
+	return topology.Write(os.Stdout, topology.Build(objects), graphFormat)
+}
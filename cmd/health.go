@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"validator/pkg/client"
+)
+
+// The health command reports what the validator client returns.
+type (
+	HealthResponse       = client.HealthResponse
+	ReadinessCheck       = client.ReadinessCheck
+	CapabilitiesResponse = client.CapabilitiesResponse
+)
+
+// HealthReport is what `validator health` prints with --output json.
+type HealthReport struct {
+	Server       string                `json:"server"`
+	Healthy      bool                  `json:"healthy"`
+	Ready        bool                  `json:"ready"`
+	Health       *HealthResponse       `json:"health"`
+	Capabilities *CapabilitiesResponse `json:"capabilities,omitempty"`
+}
+
+func newHealthCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Check that a validator service is up and ready",
+		Long: `Query the server's /health and /capabilities endpoints and print its version,
+the hhfab version and whether it is ready to validate. Exits with 3 when the
+server is unreachable, unhealthy or not ready, so it can serve as a smoke check
+after a deployment.`,
+		Args: cobra.NoArgs,
+		RunE: runHealth,
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json")
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func runHealth(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := applyConfig(cmd); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	switch {
+	case outputFormat == outputText || outputFormat == outputJSON:
+	case !cmd.Flags().Changed("output"):
+		// Report formats configured as default for validation do not apply here
+		outputFormat = outputText
+	default:
+		return withExitCode(exitInputError, fmt.Errorf("unsupported output format %q, must be one of: text, json", outputFormat))
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	health, err := c.Health(ctx)
+	if err != nil {
+		return unexpectedResponse("/health", err)
+	}
+	report := &HealthReport{Server: serverURL, Health: health}
+
+	// A degraded server validates without hhfab, it is not healthy but ready.
+	// Unhealthy servers answer 503
+	report.Healthy = health.Status == "healthy"
+	report.Ready = health.Status != "unhealthy"
+	for _, check := range health.Dependencies {
+		report.Ready = report.Ready && check.OK
+	}
+
+	// Older servers have no capabilities endpoint
+	if capabilities, err := c.Capabilities(ctx); err == nil {
+		report.Capabilities = capabilities
+	}
+
+	if outputFormat == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeHealth(os.Stdout, report)
+	}
+
+	if !report.Ready {
+		return silentExit(exitServerError, fmt.Errorf("server is not ready"))
+	}
+	return nil
+}
+
+func writeHealth(w io.Writer, report *HealthReport) {
+	health := report.Health
+	mark := func(ok bool) string {
+		if ok {
+			return "✓"
+		}
+		return "✗"
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Server:\t%s\n", report.Server)
+	fmt.Fprintf(tw, "Status:\t%s %s\n", mark(report.Healthy), health.Status)
+	fmt.Fprintf(tw, "Ready:\t%s %t\n", mark(report.Ready), report.Ready)
+	fmt.Fprintf(tw, "Version:\t%s\n", health.Version)
+	if health.HHFabVersion != "" {
+		fmt.Fprintf(tw, "hhfab version:\t%s\n", health.HHFabVersion)
+	}
+	fmt.Fprintf(tw, "Uptime:\t%s\n", time.Duration(health.UptimeSeconds)*time.Second)
+	fmt.Fprintf(tw, "Queue depth:\t%d\n", health.QueueDepth)
+	if report.Capabilities != nil {
+		fmt.Fprintf(tw, "Use cases:\t%s\n", strings.Join(report.Capabilities.UseCases, ", "))
+		fmt.Fprintf(tw, "Streaming:\t%t\n", report.Capabilities.Streaming)
+		if len(report.Capabilities.Templates) > 0 {
+			fmt.Fprintf(tw, "Templates:\t%s\n", strings.Join(report.Capabilities.Templates, ", "))
+		}
+	}
+	tw.Flush()
+
+	if health.Error != "" {
+		fmt.Fprintf(w, "\nError: %s\n", health.Error)
+	}
+	if len(health.Dependencies) > 0 {
+		fmt.Fprintln(w, "\nChecks:")
+		for _, check := range health.Dependencies {
+			line := fmt.Sprintf("  %s %s", mark(check.OK), check.Name)
+			if check.Detail != "" {
+				line += ": " + check.Detail
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
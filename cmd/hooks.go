@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+// hookMarker identifies hooks written by `validator hooks install`, so they
+// are the only ones overwritten or removed without --force.
+const hookMarker = "# Installed by validator hooks install"
+
+var (
+	hookType   string
+	hookPaths  []string
+	hookFab    string
+	hookServer string
+	hookLocal  bool
+	hookForce  bool
+)
+
+func newHooksCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hooks",
+		Short: "Manage git hooks that validate wiring before it leaves your machine",
+	}
+
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Install a pre-commit or pre-push hook running the validator",
+		Long: `Write a git hook into the current repository that validates the wiring files
+below the given paths. The pre-commit hook validates what is staged, the
+pre-push hook what is committed at HEAD. Either way a broken wiring diagram
+stops the commit or push; git's --no-verify skips the hook.
+
+The hook calls validator from the PATH. With --local it validates with hhfab on
+the machine, with --server against that server, and otherwise against the
+server configured through VALIDATOR_SERVER or the config file.
+
+Examples:
+  validator hooks install --path wiring/ --local
+  validator hooks install --type pre-push --path wiring/ -f fab.yaml -s https://validator.internal`,
+		Args: cobra.NoArgs,
+		RunE: runHooksInstall,
+	}
+	install.Flags().StringVar(&hookType, "type", "pre-commit", "Hook to install: pre-commit or pre-push")
+	install.Flags().StringArrayVar(&hookPaths, "path", []string{"."}, "Wiring file or directory in the repository, repeatable")
+	install.Flags().StringVarP(&hookFab, "fab", "f", "", "Fabricator config file in the repository (optional)")
+	install.Flags().StringVarP(&hookServer, "server", "s", "", "Validator server the hook uses")
+	install.Flags().BoolVar(&hookLocal, "local", false, "Make the hook validate with hhfab on the machine")
+	install.Flags().BoolVar(&hookForce, "force", false, "Overwrite an existing hook not installed by validator")
+	install.MarkFlagsMutuallyExclusive("server", "local")
+
+	uninstall := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove a hook installed by validator",
+		Args:  cobra.NoArgs,
+		RunE:  runHooksUninstall,
+	}
+	uninstall.Flags().StringVar(&hookType, "type", "pre-commit", "Hook to remove: pre-commit or pre-push")
+	uninstall.Flags().BoolVar(&hookForce, "force", false, "Remove the hook even if it was not installed by validator")
+
+	cmd.AddCommand(install, uninstall)
+	return cmd
+}
+
+func runHooksInstall(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	path, err := hookPath()
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	if err := checkHookOwner(path); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("failed to create hooks directory: %w", err))
+	}
+	if err := os.WriteFile(path, []byte(hookScript()), 0755); err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("failed to write hook: %w", err))
+	}
+	fmt.Printf("Installed %s hook at %s\n", hookType, path)
+	return nil
+}
+
+func runHooksUninstall(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	path, err := hookPath()
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Printf("No %s hook installed\n", hookType)
+		return nil
+	}
+	if err := checkHookOwner(path); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("failed to remove hook: %w", err))
+	}
+	fmt.Printf("Removed %s hook at %s\n", hookType, path)
+	return nil
+}
+
+// hookPath returns where git looks for the hook, honoring core.hooksPath.
+func hookPath() (string, error) {
+	if hookType != "pre-commit" && hookType != "pre-push" {
+		return "", fmt.Errorf("unsupported hook type %q, must be pre-commit or pre-push", hookType)
+	}
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", fmt.Errorf("opening git repository: %w", err)
+	}
+	cfg, err := repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", fmt.Errorf("reading git config: %w", err)
+	}
+	if hooks := cfg.Raw.Section("core").Option("hooksPath"); hooks != "" {
+		// Relative hook paths start at the top of the worktree
+		if !filepath.IsAbs(hooks) {
+			worktree, err := repo.Worktree()
+			if err != nil {
+				return "", err
+			}
+			hooks = filepath.Join(worktree.Filesystem.Root(), hooks)
+		}
+		return filepath.Join(hooks, hookType), nil
+	}
+
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return "", fmt.Errorf("git repository without a directory")
+	}
+	dir := storage.Filesystem().Root()
+	// Linked worktrees share the hooks of the main repository
+	if common, err := os.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		commonDir := strings.TrimSpace(string(common))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(dir, commonDir)
+		}
+		dir = commonDir
+	}
+	return filepath.Join(dir, "hooks", hookType), nil
+}
+
+// checkHookOwner refuses to touch an existing hook validator did not write,
+// unless forced.
+func checkHookOwner(path string) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) || hookForce {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !bytes.Contains(content, []byte(hookMarker)) {
+		return fmt.Errorf("%s already exists and was not installed by validator, use --force to replace it", path)
+	}
+	return nil
+}
+
+// hookScript renders the hook, a validator git invocation for the staged
+// files or HEAD.
+func hookScript() string {
+	args := []string{"validator", "git"}
+	if hookType == "pre-commit" {
+		args = append(args, "--staged")
+	} else {
+		args = append(args, "--ref", "HEAD")
+	}
+	for _, p := range hookPaths {
+		args = append(args, "--path", shellQuote(p))
+	}
+	if hookFab != "" {
+		args = append(args, "--fab", shellQuote(hookFab))
+	}
+	if hookLocal {
+		args = append(args, "--local")
+	}
+	if hookServer != "" {
+		args = append(args, "--server", shellQuote(hookServer))
+	}
+
+	return fmt.Sprintf(`#!/bin/sh
+%s, edits are lost on reinstall.
+# Skip with git %s --no-verify.
+exec %s --no-progress
+`, hookMarker, strings.TrimPrefix(hookType, "pre-"), strings.Join(args, " "))
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
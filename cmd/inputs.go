@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// resolveWiringFiles expands the -w arguments into the list of files to
+// upload. Arguments may be files, directories (searched recursively for YAML
+// files) or glob patterns. Files keep the order of the arguments, matches of a
+// single argument are sorted, and duplicates are dropped.
+func resolveWiringFiles(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wiring file is required")
+	}
+
+	files := []string{}
+	seen := map[string]bool{}
+	add := func(file string) {
+		if !seen[filepath.Clean(file)] {
+			seen[filepath.Clean(file)] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, arg := range args {
+		matches, err := expandWiringArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			add(match)
+		}
+	}
+
+	return files, nil
+}
+
+func expandWiringArg(arg string) ([]string, error) {
+	if arg == stdinArg || isRemoteInput(arg) {
+		return []string{arg}, nil
+	}
+
+	if strings.ContainsAny(arg, "*?[") {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wiring pattern %q: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no wiring files match %s", arg)
+		}
+		sort.Strings(matches)
+		return matches, nil
+	}
+
+	info, err := os.Stat(arg)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("wiring file does not exist: %s", arg)
+	} else if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{arg}, nil
+	}
+
+	matches := []string{}
+	err = filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && isYAMLFile(path) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wiring directory %s: %w", arg, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no YAML files found in %s", arg)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func isYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// stdinArg is the file name that makes -w or -f read from standard input.
+const stdinArg = "-"
+
+// stdinName is the name content read from stdin is uploaded as.
+const stdinName = "stdin.yaml"
+
+// stdinContent holds standard input once read, since requests may be sent
+// more than once with retries or concurrently in batch mode.
+var (
+	stdinOnce    sync.Once
+	stdinContent []byte
+	stdinErr     error
+)
+
+// checkStdinUse makes sure standard input is used for one input at most.
+func checkStdinUse(inputs []string) error {
+	uses := 0
+	for _, input := range inputs {
+		if input == stdinArg {
+			uses++
+		}
+	}
+	if uses > 1 {
+		return fmt.Errorf("standard input (-) can only be used for one input")
+	}
+	return nil
+}
+
+// loadedInput is the content of an input that is not a local file, fetched
+// before validation starts.
+type loadedInput struct {
+	content []byte
+	name    string
+}
+
+// loadedInputs holds downloaded and extracted inputs by their argument.
+var loadedInputs = map[string]loadedInput{}
+
+// openInput opens an input file for upload and returns the name to upload it
+// as.
+func openInput(name string) (io.ReadCloser, string, error) {
+	if input, ok := loadedInputs[name]; ok {
+		return io.NopCloser(bytes.NewReader(input.content)), input.name, nil
+	}
+	if isRemoteInput(name) {
+		return nil, "", fmt.Errorf("%s was not downloaded", name)
+	}
+	if name != stdinArg {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, "", err
+		}
+		return file, filepath.Base(name), nil
+	}
+
+	stdinOnce.Do(func() {
+		stdinContent, stdinErr = io.ReadAll(os.Stdin)
+	})
+	if stdinErr != nil {
+		return nil, "", fmt.Errorf("failed to read standard input: %w", stdinErr)
+	}
+	return io.NopCloser(bytes.NewReader(stdinContent)), stdinName, nil
+}
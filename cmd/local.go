@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/pkg/server"
+)
+
+// local makes validating commands run the server in-process, with hhfab from
+// the PATH, instead of sending the files to a server.
+var local bool
+
+var (
+	localOnce    sync.Once
+	localHandler http.Handler
+	localErr     error
+)
+
+// localTransport hands requests straight to the in-process server.
+type localTransport struct {
+	handler http.Handler
+}
+
+func (t localTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	t.handler.ServeHTTP(recorder, req)
+	return recorder.Result(), nil
+}
+
+// newLocalClient returns a client whose requests are served in-process.
+func newLocalClient() (*http.Client, error) {
+	localOnce.Do(func() {
+		if _, err := exec.LookPath("hhfab"); err != nil {
+			localErr = fmt.Errorf("--local needs hhfab on the PATH: %w", err)
+			return
+		}
+		srv, err := server.New(server.DefaultConfig())
+		if err != nil {
+			localErr = err
+			return
+		}
+		// Keep the request log out of the validation output
+		gin.SetMode(gin.ReleaseMode)
+		gin.DefaultWriter = io.Discard
+		localHandler = srv.Router()
+	})
+	if localErr != nil {
+		return nil, withExitCode(exitInputError, localErr)
+	}
+	return &http.Client{
+		Timeout:   time.Duration(timeout) * time.Second,
+		Transport: localTransport{handler: localHandler},
+	}, nil
+}
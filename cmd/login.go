@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// keyringService is the service name tokens are stored under in the OS
+// keyring, one entry per server URL.
+const keyringService = "hh-validator"
+
+var tokenStdin bool
+
+func newLoginCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Store an auth token for a server in the OS keyring",
+		Long: `Store the auth token for a server in the OS keyring (macOS Keychain, Windows
+Credential Manager or the Secret Service on Linux). Commands talking to that
+server use it whenever no token is given with --token, VALIDATOR_TOKEN or the
+config file.
+
+The token is prompted for, or read from stdin with --token-stdin:
+  echo "$TOKEN" | validator login -s https://validator.internal --token-stdin`,
+		Args: cobra.NoArgs,
+		RunE: runLogin,
+	}
+
+	cmd.Flags().BoolVar(&tokenStdin, "token-stdin", false, "Read the token from stdin")
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func newLogoutCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Remove the stored auth token for a server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			if err := applyConfig(cmd); err != nil {
+				return withExitCode(exitInputError, err)
+			}
+			if err := keyring.Delete(keyringService, serverURL); errors.Is(err, keyring.ErrNotFound) {
+				fmt.Printf("No token stored for %s\n", serverURL)
+				return nil
+			} else if err != nil {
+				return withExitCode(exitInputError, fmt.Errorf("failed to remove token from keyring: %w", err))
+			}
+			fmt.Printf("Removed token for %s\n", serverURL)
+			return nil
+		},
+	}
+
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func runLogin(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := applyConfig(cmd); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	if !cmd.Flags().Changed("token") {
+		var err error
+		if token, err = readToken(); err != nil {
+			return withExitCode(exitInputError, err)
+		}
+	}
+	if token == "" {
+		return withExitCode(exitInputError, fmt.Errorf("token must not be empty"))
+	}
+
+	if err := keyring.Set(keyringService, serverURL, token); err != nil {
+		return withExitCode(exitInputError, fmt.Errorf("failed to store token in keyring: %w", err))
+	}
+	fmt.Printf("Stored token for %s\n", serverURL)
+	return nil
+}
+
+// readToken reads the token from stdin, without echoing it on a terminal.
+func readToken() (string, error) {
+	if !tokenStdin && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "Token for %s: ", serverURL)
+		raw, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token: %w", err)
+		}
+		return strings.TrimSpace(string(raw)), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read token: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// keyringToken returns the stored token for the server, or "" when there is
+// none or no keyring is available.
+func keyringToken() string {
+	stored, err := keyring.Get(keyringService, serverURL)
+	if err != nil {
+		if verbose && !errors.Is(err, keyring.ErrNotFound) {
+			fmt.Fprintf(infoOut(), "Keyring unavailable: %v\n", err)
+		}
+		return ""
+	}
+	return stored
+}
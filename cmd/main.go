@@ -1,38 +1,91 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"validator/internal/hhfabmock"
+	"validator/internal/hhfabtape"
+	"validator/pkg/client"
 )
 
-type ValidateResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Output  string `json:"output"`
-	UseCase string `json:"use_case"`
-	Error   string `json:"error,omitempty"`
-}
+// The CLI reports the results of the validator client.
+type (
+	ValidateResponse = client.ValidateResponse
+	Summary          = client.Summary
+	ObjectResult     = client.ObjectResult
+	Diagnostic       = client.Diagnostic
+)
 
 var (
-	wiringFile string
-	fabFile    string
-	serverURL  string
-	verbose    bool
-	timeout    int
+	wiringArgs   []string
+	wiringFiles  []string
+	fabFile      string
+	serverURL    string
+	verbose      bool
+	timeout      int
+	outputFormat string
+	watch        bool
+	batch        bool
+	failFast     bool
+	strict       bool
+	kinds        []string
+	profile      string
+	parallel     bool
+	// async queues the validation as a job polled until it is done
+	async bool
+	// incremental scopes the reuse of hhfab results of unchanged objects
+	incremental string
+	// deterministic strips the timestamps and duration from the result
+	deterministic bool
+	// idempotencyKey names the validation for retried CI steps
+	idempotencyKey string
+	// baselineFile lists known findings, rewritten with updateBaseline
+	baselineFile   string
+	updateBaseline bool
 )
 
 func main() {
-	var rootCmd = &cobra.Command{
+	// Linked as hhfab, the CLI records and replays hhfab runs for tests
+	if hhfabtape.Invoked() {
+		os.Exit(hhfabtape.Main(os.Args[1:]))
+	}
+	// Run by the mock backend of serve, the CLI answers for hhfab
+	if hhfabmock.Invoked() {
+		os.Exit(hhfabmock.Main(os.Args[1:]))
+	}
+
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the CLI with args and returns its exit code.
+func run(args []string) int {
+	rootCmd := newRootCommand()
+	rootCmd.SetArgs(args)
+	if err := rootCmd.Execute(); err != nil {
+		if !isSilent(err) && quiet < 2 {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return exitCodeFor(err)
+	}
+	return exitOK
+}
+
+// newRootCommand returns the validator command with all its subcommands.
+// Their flags are bound to the package variables, reset to their defaults
+// by every call.
+func newRootCommand() *cobra.Command {
+	rootCmd := &cobra.Command{
 		Use:   "validator",
 		Short: "Validate Hedgehog Open Network Fabric configuration files",
 		Long: `The Validator CLI tool validates ONF (Open Network Fabric) configuration files
@@ -49,78 +102,313 @@ Examples:
   # Validate both wiring and fabricator config
   validator -w wiring.yaml -f fab.yaml
 
+  # Validate a bundle of files, one per rack
+  validator -w ./wiring/
+  validator -w 'racks/*.yaml' -w spines.yaml
+
+  # Validate a published wiring file, verifying its checksum
+  validator -w 'https://artifacts.example.com/wiring.yaml#sha256=<hex>'
+
+  # Validate generated wiring
+  kustomize build | validator -w -
+
   # Use custom server URL
-  validator -w wiring.yaml -s http://remote-server:8080`,
-		RunE: runValidate,
+  validator -w wiring.yaml -s http://remote-server:8080
+
+  # Machine-readable results for CI
+  validator -w wiring.yaml -o sarif > results.sarif
+
+  # HTML report for a design review
+  validator report -w wiring.yaml --html review.html
+
+  # Post the result to the pull request being checked, in GitHub Actions
+  validator comment -w wiring.yaml
+
+  # Validate each file on its own and print a summary table
+  validator -w ./sites/ --batch --fail-fast
+  validator -w ./sites/ --batch --concurrency 8
+
+  # Ride out a flaky lab network
+  validator -w wiring.yaml --retries 3 --retry-backoff 2s
+
+  # Re-validate whenever the files change
+  validator -w wiring.yaml -f fab.yaml --watch
+
+  # Check a deployed service
+  validator health -s http://remote-server:8080
+  validator version -s http://remote-server:8080
+  validator doctor -s http://remote-server:8080
+
+  # Run the validator service itself
+  validator serve --port 8080
+
+Defaults for these flags are read from their environment variables, then from
+~/.config/hh-validator/config.yaml. Flags always take precedence:
+
+  --server                VALIDATOR_SERVER
+  --timeout               VALIDATOR_TIMEOUT
+  --output                VALIDATOR_OUTPUT
+  --token                 VALIDATOR_TOKEN
+  --auth-header           VALIDATOR_AUTH_HEADER
+  --proxy                 VALIDATOR_PROXY
+  --cacert                VALIDATOR_CACERT
+  --cert                  VALIDATOR_CERT
+  --key                   VALIDATOR_KEY
+  --insecure-skip-verify  VALIDATOR_INSECURE_SKIP_VERIFY
+
+Tokens stored with 'validator login' are used last.
+
+` + exitCodesHelp,
+		RunE:          runValidate,
+		SilenceErrors: true,
 	}
 
-	rootCmd.Flags().StringVarP(&wiringFile, "wiring", "w", "", "Path to wiring diagram file (required)")
-	rootCmd.Flags().StringVarP(&fabFile, "fab", "f", "", "Path to fabricator config file (optional)")
-	rootCmd.Flags().StringVarP(&serverURL, "server", "s", "http://localhost:8080", "Validator server URL")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
-	rootCmd.Flags().IntVarP(&timeout, "timeout", "t", 30, "Request timeout in seconds")
+	rootCmd.Flags().StringArrayVarP(&wiringArgs, "wiring", "w", nil, "Wiring diagram file, directory, glob pattern, http(s) URL or - for stdin, repeatable (required)")
+	rootCmd.Flags().StringVarP(&fabFile, "fab", "f", "", "Path or http(s) URL of fabricator config file, or - for stdin (optional)")
+	rootCmd.Flags().BoolVar(&watch, "watch", false, "Watch the input files and re-validate on every change")
+	addValidationFlags(rootCmd)
+	addClientFlags(rootCmd)
 
 	rootCmd.MarkFlagRequired("wiring")
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+	rootCmd.AddCommand(newServeCommand())
+	rootCmd.AddCommand(newHealthCommand())
+	rootCmd.AddCommand(newVersionCommand())
+	rootCmd.AddCommand(newDoctorCommand())
+	rootCmd.AddCommand(newGitCommand())
+	rootCmd.AddCommand(newDiffCommand())
+	rootCmd.AddCommand(newGraphCommand())
+	rootCmd.AddCommand(newReportCommand())
+	rootCmd.AddCommand(newCommentCommand())
+	rootCmd.AddCommand(newFmtCommand())
+	rootCmd.AddCommand(newConvertCommand())
+	rootCmd.AddCommand(newSampleCommand())
+	rootCmd.AddCommand(newExplainCommand())
+	rootCmd.AddCommand(newHooksCommand())
+	rootCmd.AddCommand(newLoginCommand())
+	rootCmd.AddCommand(newLogoutCommand())
+	return rootCmd
+}
+
+// addValidationFlags registers the flags of every command that validates
+// files.
+func addValidationFlags(cmd *cobra.Command) {
+	// The upload limits are asked again from the new --server
+	serverLimitsOnce = sync.Once{}
+	serverLimits = nil
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	cmd.Flags().CountVarP(&quiet, "quiet", "q", "Only print the final status (passed, failed or error), -qq prints nothing")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: "+strings.Join(outputFormats, ", "))
+	cmd.Flags().BoolVar(&batch, "batch", false, "Validate each wiring file separately instead of as one bundle")
+	cmd.Flags().BoolVar(&failFast, "fail-fast", false, "In batch mode, stop at the first file that does not pass")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "j", 1, "In batch mode, number of files validated in parallel")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail on warnings and run the lint checks, for gating production changes")
+	cmd.Flags().StringSliceVar(&kinds, "kinds", nil, "Only validate the wiring documents of these kinds, e.g. Switch,Connection")
+	cmd.Flags().StringVar(&baselineFile, "baseline", "", "Only fail on findings this baseline file does not list")
+	cmd.Flags().BoolVar(&updateBaseline, "update-baseline", false, "Write the findings of this run to the --baseline file instead of failing on them")
+	cmd.Flags().StringVar(&profile, "profile", "", "Validation profile of the target environment, e.g. lab, prod-spine-leaf or collapsed-core")
+	cmd.Flags().BoolVar(&parallel, "parallel", false, "Let the server split the bundle into independent parts validated concurrently")
+	cmd.Flags().StringVar(&incremental, "incremental", "", "Let the server reuse hhfab results of unchanged objects from earlier validations in this scope, e.g. the repository name")
+	cmd.Flags().BoolVar(&deterministic, "deterministic", false, "Strip the timestamps of the hhfab output and the duration, so identical inputs give byte-identical results")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "Answer with the result of an earlier validation sent with this key instead of running it again, e.g. the ID of the CI job")
+	cmd.Flags().BoolVar(&local, "local", false, "Validate with hhfab on this machine instead of a server")
+	cmd.Flags().BoolVar(&async, "async", false, "Queue the validation on the server and poll for its result, for servers sharing a job queue")
+	cmd.Flags().BoolVar(&showSource, "show-source", false, "Quote the offending lines of the local files below errors")
+	cmd.Flags().BoolVar(&noProgress, "no-progress", false, "Do not show live progress on the terminal")
+	cmd.Flags().IntVar(&retries, "retries", 0, "Retry network errors, server errors and timeouts this many times")
+	cmd.Flags().DurationVar(&retryBackoff, "retry-backoff", time.Second, "Delay before the first retry, doubled for every further retry")
+	cmd.Flags().Int64Var(&maxFileSize, "max-file-size", 0, "Refuse to download http(s) inputs larger than this many bytes (default: the upload limits of the server)")
 }
 
 func runValidate(cmd *cobra.Command, args []string) error {
+	// Flags parsed fine, usage won't help with anything that fails from here
+	cmd.SilenceUsage = true
+
+	if err := setupValidation(cmd); err != nil {
+		return err
+	}
+
 	// Validate input files
 	if err := validateInputFiles(); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	printConfiguration()
+
+	// Download remote inputs
+	if err := fetchRemoteInputs(append(append([]string{}, wiringFiles...), fabFile), uploadLimit); err != nil {
 		return err
 	}
 
-	// Show configuration if verbose
-	if verbose {
-		fmt.Printf("Configuration:\n")
-		fmt.Printf("  Wiring file: %s\n", wiringFile)
-		if fabFile != "" {
-			fmt.Printf("  Fab file: %s\n", fabFile)
+	if watch {
+		return runWatch()
+	}
+
+	return validateInputs()
+}
+
+// setupValidation applies the configured defaults and checks the flags
+// shared by all validating commands.
+func setupValidation(cmd *cobra.Command) error {
+	if err := applyConfig(cmd); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	if err := checkOutputFormat(); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	if quiet > 0 {
+		if outputFormat != outputText && cmd.Flags().Changed("output") {
+			return withExitCode(exitInputError, fmt.Errorf("--quiet cannot be combined with --output %s", outputFormat))
 		}
-		fmt.Printf("  Server URL: %s\n", serverURL)
-		fmt.Printf("  Timeout: %d seconds\n", timeout)
-		fmt.Println()
+		outputFormat = outputText
+		verbose = false
+		noProgress = true
 	}
 
-	// Create multipart form request
-	body, contentType, err := createMultipartRequest()
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if concurrency < 1 {
+		return withExitCode(exitInputError, fmt.Errorf("--concurrency must be at least 1"))
+	}
+	if concurrency > 1 {
+		// One status line cannot show several requests
+		noProgress = true
 	}
 
-	// Make HTTP request
-	response, err := makeRequest(body, contentType)
-	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
+	if async && local {
+		return withExitCode(exitInputError, fmt.Errorf("--async cannot be combined with --local"))
 	}
+	if parallel && local {
+		return withExitCode(exitInputError, fmt.Errorf("--parallel cannot be combined with --local"))
+	}
+	if incremental != "" && local {
+		return withExitCode(exitInputError, fmt.Errorf("--incremental cannot be combined with --local"))
+	}
+	if idempotencyKey != "" && watch {
+		// Every change would reuse the key for different files
+		return withExitCode(exitInputError, fmt.Errorf("--idempotency-key cannot be combined with --watch"))
+	}
+
+	if retries < 0 || retryBackoff <= 0 {
+		return withExitCode(exitInputError, fmt.Errorf("--retries must not be negative and --retry-backoff must be positive"))
+	}
+
+	return nil
+}
+
+// printConfiguration shows the configuration if verbose.
+func printConfiguration() {
+	if !verbose {
+		return
+	}
+	out := infoOut()
+	fmt.Fprintf(out, "Configuration:\n")
+	fmt.Fprintf(out, "  Wiring files: %s\n", strings.Join(wiringFiles, ", "))
+	if fabFile != "" {
+		fmt.Fprintf(out, "  Fab file: %s\n", fabFile)
+	}
+	if local {
+		fmt.Fprintf(out, "  Server: local hhfab\n")
+	} else {
+		fmt.Fprintf(out, "  Server URL: %s\n", serverURL)
+	}
+	fmt.Fprintf(out, "  Timeout: %d seconds\n", timeout)
+	if strict {
+		fmt.Fprintf(out, "  Strict: warnings fail validation\n")
+	}
+	if len(kinds) > 0 {
+		fmt.Fprintf(out, "  Kinds: %s\n", strings.Join(kinds, ", "))
+	}
+	if profile != "" {
+		fmt.Fprintf(out, "  Profile: %s\n", profile)
+	}
+	if baselineFile != "" {
+		fmt.Fprintf(out, "  Baseline: %s\n", baselineFile)
+	}
+	if async {
+		fmt.Fprintf(out, "  Async: queued as a job\n")
+	}
+	if parallel {
+		fmt.Fprintf(out, "  Parallel: independent parts validated concurrently\n")
+	}
+	if incremental != "" {
+		fmt.Fprintf(out, "  Incremental: reusing results of unchanged objects in %s\n", incremental)
+	}
+	fmt.Fprintln(out)
+}
+
+// validateInputs runs one validation of all inputs, as a bundle or in batch.
+func validateInputs() error {
+	if batch {
+		return runBatch()
+	}
+	return validateOnce()
+}
+
+// validateOnce sends the input files to the server and reports the result.
+func validateOnce() error {
+	start := time.Now()
+	response, err := requestValidation(wiringFiles)
+	result := newReport(wiringFiles, response, err, time.Since(start))
 
 	// Display results
-	displayResults(response)
+	switch {
+	case quiet > 0:
+		writeQuietStatus(result.Status)
+	case outputFormat != outputText:
+		if writeErr := writeReport(os.Stdout, result); writeErr != nil {
+			return writeErr
+		}
+	case err == nil:
+		displayResults(response)
+	}
+
+	// Pull requests hear about validations that could not run as well
+	if stickyComment != nil {
+		if commentErr := stickyComment.post(result); commentErr != nil {
+			return commentErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if htmlReport != "" {
+		if err := writeHTMLReport(wiringFiles, response); err != nil {
+			return err
+		}
+	}
+
+	if updateBaseline {
+		return writeBaseline(response)
+	}
 
 	// Exit with error code if validation failed
 	if !response.Success {
-		os.Exit(1)
+		return errValidationFailed
 	}
 
 	return nil
 }
 
 func validateInputFiles() error {
-	// Check wiring file
-	if wiringFile == "" {
-		return fmt.Errorf("wiring file is required")
+	// Resolve wiring files, directories and patterns
+	files, err := resolveWiringFiles(wiringArgs)
+	if err != nil {
+		return err
 	}
+	wiringFiles = files
 
-	if _, err := os.Stat(wiringFile); os.IsNotExist(err) {
-		return fmt.Errorf("wiring file does not exist: %s", wiringFile)
+	if err := checkStdinUse(append(append([]string{}, wiringFiles...), fabFile)); err != nil {
+		return err
+	}
+
+	if err := checkBaselineFlags(); err != nil {
+		return err
 	}
 
 	// Check fab file if provided
-	if fabFile != "" {
+	if fabFile != "" && fabFile != stdinArg && !isRemoteInput(fabFile) {
 		if _, err := os.Stat(fabFile); os.IsNotExist(err) {
 			return fmt.Errorf("fab file does not exist: %s", fabFile)
 		}
@@ -129,86 +417,109 @@ func validateInputFiles() error {
 	return nil
 }
 
-func createMultipartRequest() (*bytes.Buffer, string, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	// Add wiring file
-	if err := addFileToForm(writer, "wiring", wiringFile); err != nil {
-		return nil, "", fmt.Errorf("failed to add wiring file: %w", err)
+// requestValidation uploads the wiring files as one bundle, together with the
+// fab file if any, and returns the server's verdict.
+func requestValidation(wiring []string) (*ValidateResponse, error) {
+	files, params, err := validationRequest(wiring)
+	if err != nil {
+		return nil, withExitCode(exitInputError, fmt.Errorf("failed to create request: %w", err))
 	}
-
-	// Add fab file if provided
-	if fabFile != "" {
-		if err := addFileToForm(writer, "fab", fabFile); err != nil {
-			return nil, "", fmt.Errorf("failed to add fab file: %w", err)
-		}
+	c, err := newClient()
+	if err != nil {
+		return nil, err
 	}
 
-	// Close the multipart writer
-	if err := writer.Close(); err != nil {
-		return nil, "", fmt.Errorf("failed to close multipart writer: %w", err)
+	// Show progress when there is someone to show it to, streaming the hhfab
+	// output if the server supports it
+	if showProgress() {
+		progress := startSpinner()
+		defer progress.stop()
+		params.Progress = progress.update
 	}
 
-	return body, writer.FormDataContentType(), nil
-}
-
-func addFileToForm(writer *multipart.Writer, fieldName, filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return err
+	response, err := c.ValidateBundle(context.Background(), files, params)
+	var responseErr *client.ResponseError
+	if errors.As(err, &responseErr) {
+		err = fmt.Errorf("%w, check client and server compatibility with 'validator version'", err)
 	}
-	defer file.Close()
-
-	part, err := writer.CreateFormFile(fieldName, filepath.Base(filename))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to make request: %w", err)
 	}
-
-	_, err = io.Copy(part, file)
-	return err
+	return response, nil
 }
 
-func makeRequest(body *bytes.Buffer, contentType string) (*ValidateResponse, error) {
-	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+// validationRequest reads the files of a validation and sets its parameters
+// from the flags.
+func validationRequest(wiring []string) ([]client.File, client.Params, error) {
+	params := client.Params{
+		Strict:         strict,
+		Kinds:          kinds,
+		Profile:        profile,
+		Parallel:       parallel,
+		Incremental:    incremental,
+		Deterministic:  deterministic,
+		IdempotencyKey: idempotencyKey,
+		Async:          async,
+		Wait:           time.Duration(timeout) * time.Second,
 	}
-
-	url := strings.TrimRight(serverURL, "/") + "/validate"
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, err
+	// Every file of a batch is a validation of its own
+	if idempotencyKey != "" && batch {
+		sum := sha256.Sum256([]byte(wiring[0]))
+		params.IdempotencyKey = idempotencyKey + "-" + hex.EncodeToString(sum[:8])
 	}
 
-	req.Header.Set("Content-Type", contentType)
+	// Multiple wiring files are validated together as a bundle
+	files := []client.File{}
+	for _, wiringFile := range wiring {
+		file, err := readUpload(wiringFile)
+		if err != nil {
+			return nil, params, fmt.Errorf("failed to add wiring file: %w", err)
+		}
+		files = append(files, file)
+	}
 
-	if verbose {
-		fmt.Printf("Making request to: %s\n", url)
+	if fabFile != "" {
+		file, err := readUpload(fabFile)
+		if err != nil {
+			return nil, params, fmt.Errorf("failed to add fab file: %w", err)
+		}
+		params.Fab = &file
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+	if sendBaseline() {
+		file, err := readUpload(baselineFile)
+		if err != nil {
+			return nil, params, fmt.Errorf("failed to add baseline file: %w", err)
+		}
+		params.Baseline = &file
 	}
-	defer resp.Body.Close()
 
-	responseBody, err := io.ReadAll(resp.Body)
+	return files, params, nil
+}
+
+// readUpload reads an input to upload under its name on the server.
+func readUpload(input string) (client.File, error) {
+	file, name, err := openInput(input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return client.File{}, err
 	}
+	defer file.Close()
 
-	var response ValidateResponse
-	if err := json.Unmarshal(responseBody, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return client.File{}, err
 	}
-
-	return &response, nil
+	return client.File{Name: name, Data: data}, nil
 }
 
 func displayResults(response *ValidateResponse) {
 	if response.Success {
 		fmt.Printf("✓ %s\n", response.Message)
+		writeWarnings(os.Stdout, response.Warnings)
+		writeSuppressed(os.Stdout, response.Suppressed)
+		writeBaselined(os.Stdout, response.Baselined, verbose)
 		if verbose {
+			writeObjectResults(os.Stdout, response.Objects, true)
 			fmt.Printf("\nUse case: %s\n", response.UseCase)
 			fmt.Printf("Output:\n%s\n", response.Output)
 		}
@@ -217,13 +528,27 @@ func displayResults(response *ValidateResponse) {
 		if response.Error != "" {
 			fmt.Printf("Error: %s\n", response.Error)
 		}
-		
+		if code := firstErrorCode(response.Diagnostics); code != "" {
+			fmt.Printf("Code: %s (run 'validator explain %s' for help)\n", code, code)
+		}
+		if showSource {
+			inputs := append(append([]string{}, wiringFiles...), fabFile)
+			writeSourceAnnotations(os.Stdout, response.Diagnostics, inputs, useColor())
+		}
+		writeWarnings(os.Stdout, response.Warnings)
+		writeSuppressed(os.Stdout, response.Suppressed)
+		writeBaselined(os.Stdout, response.Baselined, verbose)
+		writeObjectResults(os.Stdout, response.Objects, verbose)
+
 		if verbose && response.Output != "" {
 			fmt.Printf("\nFull output:\n%s\n", response.Output)
 		}
-		
+
 		if verbose {
 			fmt.Printf("\nUse case: %s\n", response.UseCase)
 		}
 	}
-}
\ No newline at end of file
+	if response.ResultURL != "" {
+		fmt.Printf("\nResult: %s\n", response.ResultURL)
+	}
+}
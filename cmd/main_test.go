@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"go/build"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestMain(m *testing.M) {
+	// Tokens are stored in memory instead of the keyring of the user
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// fakeServer is a validator service answering validations with success
+// unless the wiring contains "invalid", recording the requests it got.
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	files    [][]string
+	// handler, when set, answers instead
+	handler http.HandlerFunc
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{}
+	f.Server = httptest.NewServer(f)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	files := []string{}
+	invalid := false
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && params["boundary"] != "" {
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			files = append(files, part.FileName())
+			invalid = invalid || strings.Contains(string(data), "invalid")
+		}
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, r)
+	f.files = append(f.files, files)
+	handler := f.handler
+	f.mu.Unlock()
+	if handler != nil {
+		handler(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/health":
+		json.NewEncoder(w).Encode(HealthResponse{Status: "healthy", Version: "test"})
+	case "/capabilities":
+		json.NewEncoder(w).Encode(CapabilitiesResponse{})
+	case "/validate":
+		if invalid {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ValidateResponse{Message: "Validation failed", Error: "invalid wiring", UseCase: "uc1"})
+			return
+		}
+		json.NewEncoder(w).Encode(ValidateResponse{Success: true, Message: "valid", UseCase: "uc1"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// received returns the requests of the server so far.
+func (f *fakeServer) received() []*http.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*http.Request{}, f.requests...)
+}
+
+// cli runs the CLI with args in an environment of its own: a home without
+// config file and none of the VALIDATOR_* variables of the test process. It
+// returns the exit code and what was printed to stdout.
+func cli(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	stdout, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = stdout
+	code := run(args)
+	os.Stdout = saved
+	output, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout.Close()
+	return code, string(output)
+}
+
+// isolate gives the test a home and config directory of its own, without
+// the VALIDATOR_* variables of the environment.
+func isolate(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	for _, env := range os.Environ() {
+		if name, _, _ := strings.Cut(env, "="); strings.HasPrefix(name, "VALIDATOR_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy"} {
+		t.Setenv(name, "")
+	}
+	return home
+}
+
+// writeFile writes data to name in dir and returns its path.
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testWiring = "apiVersion: wiring.githedgehog.com/v1beta1\nkind: Switch\nmetadata:\n  name: leaf-01\n"
+
+func TestCLIConfigPrecedence(t *testing.T) {
+	home := isolate(t)
+	wiring := writeFile(t, t.TempDir(), "wiring.yaml", testWiring)
+	file, env, flag := newFakeServer(t), newFakeServer(t), newFakeServer(t)
+
+	// The config file sets the defaults of the flags
+	writeFile(t, home, ".config/hh-validator/config.yaml", "server: "+file.URL+"\ntoken: file-token\n")
+	if code, _ := cli(t, "-w", wiring); code != exitOK {
+		t.Fatalf("exit code %d with the config file", code)
+	}
+	if got := len(file.received()); got != 1 {
+		t.Fatalf("the server of the config file got %d requests", got)
+	}
+	if got := file.received()[0].Header.Get("Authorization"); got != "Bearer file-token" {
+		t.Errorf("Authorization %q, want the token of the config file", got)
+	}
+
+	// The environment overrides the file
+	t.Setenv("VALIDATOR_SERVER", env.URL)
+	t.Setenv("VALIDATOR_TOKEN", "env-token")
+	if code, _ := cli(t, "-w", wiring); code != exitOK {
+		t.Fatalf("exit code %d with the environment", code)
+	}
+	if got := len(env.received()); got != 1 {
+		t.Fatalf("the server of the environment got %d requests", got)
+	}
+	if got := env.received()[0].Header.Get("Authorization"); got != "Bearer env-token" {
+		t.Errorf("Authorization %q, want the token of the environment", got)
+	}
+
+	// And flags override both
+	if code, _ := cli(t, "-w", wiring, "-s", flag.URL, "--token", "flag-token", "--auth-header", "X-API-Key"); code != exitOK {
+		t.Fatalf("exit code %d with flags", code)
+	}
+	if got := len(flag.received()); got != 1 {
+		t.Fatalf("the server of the flag got %d requests", got)
+	}
+	if got := flag.received()[0].Header.Get("X-API-Key"); got != "flag-token" {
+		t.Errorf("X-API-Key %q, want the token of the flag", got)
+	}
+	if len(file.received()) != 1 || len(env.received()) != 1 {
+		t.Error("servers that were overridden got requests")
+	}
+
+	// Invalid values name where they came from
+	t.Setenv("VALIDATOR_TIMEOUT", "soon")
+	if code, _ := cli(t, "-w", wiring); code != exitInputError {
+		t.Errorf("exit code %d with an invalid VALIDATOR_TIMEOUT, want %d", code, exitInputError)
+	}
+
+	// A config file named explicitly must exist
+	t.Setenv("VALIDATOR_TIMEOUT", "")
+	os.Unsetenv("VALIDATOR_TIMEOUT")
+	if code, _ := cli(t, "-w", wiring, "--config", filepath.Join(home, "missing.yaml")); code != exitInputError {
+		t.Errorf("exit code %d with a missing --config, want %d", code, exitInputError)
+	}
+}
+
+func TestCLIStoredToken(t *testing.T) {
+	isolate(t)
+	wiring := writeFile(t, t.TempDir(), "wiring.yaml", testWiring)
+	server := newFakeServer(t)
+	if err := keyring.Set(keyringService, server.URL, "stored-token"); err != nil {
+		t.Fatal(err)
+	}
+	defer keyring.Delete(keyringService, server.URL)
+
+	// Tokens stored with validator login are used last
+	cli(t, "-w", wiring, "-s", server.URL)
+	t.Setenv("VALIDATOR_TOKEN", "env-token")
+	cli(t, "-w", wiring, "-s", server.URL)
+	requests := server.received()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if got := requests[0].Header.Get("Authorization"); got != "Bearer stored-token" {
+		t.Errorf("Authorization %q, want the stored token", got)
+	}
+	if got := requests[1].Header.Get("Authorization"); got != "Bearer env-token" {
+		t.Errorf("Authorization %q, want the token of the environment", got)
+	}
+}
+
+func TestCLIExitCodes(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	wiring := writeFile(t, dir, "wiring.yaml", testWiring)
+	invalid := writeFile(t, dir, "invalid.yaml", testWiring+"# invalid\n")
+	server := newFakeServer(t)
+	slow := newFakeServer(t)
+	slow.handler = func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+	}
+	failing := newFakeServer(t)
+	failing.handler = func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"passed", []string{"-w", wiring, "-s", server.URL}, exitOK},
+		{"failed", []string{"-w", invalid, "-s", server.URL}, exitValidationFailed},
+		{"missing file", []string{"-w", filepath.Join(dir, "missing.yaml"), "-s", server.URL}, exitInputError},
+		{"no wiring", []string{"-s", server.URL}, exitInputError},
+		{"unknown flag", []string{"-w", wiring, "--no-such-flag"}, exitInputError},
+		{"bad output", []string{"-w", wiring, "-s", server.URL, "-o", "xml"}, exitInputError},
+		{"server error", []string{"-w", wiring, "-s", failing.URL}, exitServerError},
+		{"unreachable", []string{"-w", wiring, "-s", unreachable.URL}, exitServerError},
+		{"timeout", []string{"-w", wiring, "-s", slow.URL, "--timeout", "1"}, exitTimeout},
+		{"health", []string{"health", "-s", server.URL}, exitOK},
+		{"health unreachable", []string{"health", "-s", unreachable.URL}, exitServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, output := cli(t, tc.args...); code != tc.code {
+				t.Errorf("exit code %d, want %d, output:\n%s", code, tc.code, output)
+			}
+		})
+	}
+}
+
+func TestCLIOutput(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	writeFile(t, dir, "racks/rack-1.yaml", testWiring)
+	writeFile(t, dir, "racks/rack-2.yaml", testWiring+"# invalid\n")
+	server := newFakeServer(t)
+
+	// Results are JSON for scripts
+	code, output := cli(t, "-w", filepath.Join(dir, "racks", "rack-1.yaml"), "-s", server.URL, "-o", "json")
+	if code != exitOK {
+		t.Fatalf("exit code %d", code)
+	}
+	var response ValidateResponse
+	if err := json.Unmarshal([]byte(output), &response); err != nil || !response.Success {
+		t.Errorf("output is not a successful result: %v\n%s", err, output)
+	}
+
+	// Quiet mode prints the status alone, -qq nothing
+	if _, output := cli(t, "-w", filepath.Join(dir, "racks", "rack-1.yaml"), "-s", server.URL, "-q"); strings.TrimSpace(output) != "passed" {
+		t.Errorf("-q printed %q", output)
+	}
+	if _, output := cli(t, "-w", filepath.Join(dir, "racks", "rack-1.yaml"), "-s", server.URL, "-qq"); output != "" {
+		t.Errorf("-qq printed %q", output)
+	}
+
+	// Directories are validated as one bundle, or file by file in batch mode
+	before := len(server.received())
+	if code, _ := cli(t, "-w", filepath.Join(dir, "racks"), "-s", server.URL); code != exitValidationFailed {
+		t.Errorf("exit code %d validating the bundle", code)
+	}
+	server.mu.Lock()
+	bundle := server.files[before]
+	server.mu.Unlock()
+	if len(bundle) != 2 {
+		t.Errorf("bundle uploaded %v, want both files", bundle)
+	}
+	code, output = cli(t, "-w", filepath.Join(dir, "racks"), "-s", server.URL, "--batch")
+	if code != exitValidationFailed {
+		t.Errorf("exit code %d in batch mode", code)
+	}
+	if got := len(server.received()) - before; got != 3 {
+		t.Errorf("got %d requests, want one for the bundle and one per file", got)
+	}
+	if !strings.Contains(output, "rack-1.yaml") || !strings.Contains(output, "rack-2.yaml") {
+		t.Errorf("batch summary misses files:\n%s", output)
+	}
+}
+
+func TestCLIRetries(t *testing.T) {
+	isolate(t)
+	wiring := writeFile(t, t.TempDir(), "wiring.yaml", testWiring)
+	server := newFakeServer(t)
+	var mu sync.Mutex
+	failures := 1
+	server.handler = func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(ValidateResponse{Success: true})
+	}
+
+	// Transient failures are retried with --retries
+	if code, output := cli(t, "-w", wiring, "-s", server.URL, "--retries", "2", "--retry-backoff", "10ms"); code != exitOK {
+		t.Errorf("exit code %d, output:\n%s", code, output)
+	}
+	requests := server.received()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if key := requests[0].Header.Get("Idempotency-Key"); key == "" || key != requests[1].Header.Get("Idempotency-Key") {
+		t.Error("retries do not share an Idempotency-Key")
+	}
+}
+
+func TestCLITLS(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	wiring := writeFile(t, dir, "wiring.yaml", testWiring)
+	server := &fakeServer{}
+	server.Server = httptest.NewTLSServer(server)
+	defer server.Close()
+	caCert := writeFile(t, dir, "ca.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+	// Servers are verified against the system roots or --cacert
+	if code, _ := cli(t, "-w", wiring, "-s", server.URL); code != exitServerError {
+		t.Errorf("exit code %d with an unknown CA, want %d", code, exitServerError)
+	}
+	if code, _ := cli(t, "-w", wiring, "-s", server.URL, "--cacert", caCert); code != exitOK {
+		t.Errorf("exit code %d with --cacert", code)
+	}
+	t.Setenv("VALIDATOR_INSECURE_SKIP_VERIFY", "true")
+	if code, _ := cli(t, "-w", wiring, "-s", server.URL); code != exitOK {
+		t.Errorf("exit code %d with VALIDATOR_INSECURE_SKIP_VERIFY", code)
+	}
+	os.Unsetenv("VALIDATOR_INSECURE_SKIP_VERIFY")
+
+	if code, _ := cli(t, "-w", wiring, "-s", server.URL, "--cacert", filepath.Join(dir, "missing.pem")); code != exitInputError {
+		t.Errorf("exit code %d with a missing --cacert, want %d", code, exitInputError)
+	}
+	if code, _ := cli(t, "-w", wiring, "-s", server.URL, "--cert", caCert); code != exitInputError {
+		t.Errorf("exit code %d with --cert alone, want %d", code, exitInputError)
+	}
+}
+
+func TestCLIProxy(t *testing.T) {
+	isolate(t)
+	wiring := writeFile(t, t.TempDir(), "wiring.yaml", testWiring)
+	// The proxy answers for the server it is asked for
+	proxy := newFakeServer(t)
+
+	t.Setenv("VALIDATOR_PROXY", proxy.URL)
+	if code, output := cli(t, "-w", wiring, "-s", "http://validator.invalid"); code != exitOK {
+		t.Fatalf("exit code %d, output:\n%s", code, output)
+	}
+	requests := proxy.received()
+	if len(requests) != 1 {
+		t.Fatalf("the proxy got %d requests, want 1", len(requests))
+	}
+	if got := requests[0].Host; got != "validator.invalid" {
+		t.Errorf("the proxy was asked for %q", got)
+	}
+
+	// NO_PROXY still applies
+	t.Setenv("NO_PROXY", "validator.invalid")
+	if code, _ := cli(t, "-w", wiring, "-s", "http://validator.invalid", "--retries", "0", "--timeout", "2"); code == exitOK {
+		t.Error("the request went through the proxy despite NO_PROXY")
+	}
+	if got := len(proxy.received()); got != 1 {
+		t.Errorf("the proxy got %d requests, want 1", got)
+	}
+}
+
+func TestCLIImports(t *testing.T) {
+	// The CLI talks to servers through pkg/api and pkg/client, and embeds
+	// one through pkg/server, like any other integration
+	pkg, err := build.ImportDir(".", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range pkg.Imports {
+		if path == "validator/internal/server" {
+			t.Errorf("the CLI imports %s", path)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/pkg/api"
+)
+
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputJUnit = "junit"
+	outputSARIF = "sarif"
+	// outputMarkdown is for pull request comments
+	outputMarkdown = "markdown"
+)
+
+var outputFormats = []string{outputText, outputJSON, outputYAML, outputJUnit, outputSARIF, outputMarkdown}
+
+func checkOutputFormat() error {
+	for _, format := range outputFormats {
+		if outputFormat == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %q, must be one of: %s", outputFormat, strings.Join(outputFormats, ", "))
+}
+
+// infoOut is where progress and verbose messages go. Machine-readable formats
+// keep stdout clean for the report itself.
+func infoOut() io.Writer {
+	if quiet > 0 {
+		return io.Discard
+	}
+	if outputFormat == outputText {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// quiet is the number of -q flags given.
+var quiet int
+
+// writeQuietStatus prints the bare status in quiet mode, unless asked to print
+// nothing at all.
+func writeQuietStatus(status string) {
+	if quiet == 1 {
+		fmt.Println(status)
+	}
+}
+
+// Report is the machine-readable result of a CLI run.
+type Report struct {
+	Status      string         `json:"status" yaml:"status"`
+	ExitCode    int            `json:"exit_code" yaml:"exit_code"`
+	Success     bool           `json:"success" yaml:"success"`
+	UseCase     string         `json:"use_case,omitempty" yaml:"use_case,omitempty"`
+	Mode        string         `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Profile     string         `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Message     string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Error       string         `json:"error,omitempty" yaml:"error,omitempty"`
+	Diagnostics []Diagnostic   `json:"diagnostics" yaml:"diagnostics"`
+	Warnings    []Diagnostic   `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+	Suppressed  []Diagnostic   `json:"suppressed,omitempty" yaml:"suppressed,omitempty"`
+	Baselined   []Diagnostic   `json:"baselined,omitempty" yaml:"baselined,omitempty"`
+	Objects     []ObjectResult `json:"objects,omitempty" yaml:"objects,omitempty"`
+	Summary     *Summary       `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Output      string         `json:"output,omitempty" yaml:"output,omitempty"`
+	ResultURL   string         `json:"result_url,omitempty" yaml:"result_url,omitempty"`
+	Files       ReportFiles    `json:"files" yaml:"files"`
+	Server      string         `json:"server" yaml:"server"`
+	DurationMs  int64          `json:"duration_ms" yaml:"duration_ms"`
+}
+
+type ReportFiles struct {
+	Wiring []string `json:"wiring" yaml:"wiring"`
+	Fab    string   `json:"fab,omitempty" yaml:"fab,omitempty"`
+}
+
+const (
+	statusPassed  = "passed"
+	statusFailed  = "failed"
+	statusError   = "error"
+	statusSkipped = "skipped"
+)
+
+// summarize counts diagnostics and objects like the server does.
+func summarize(diagnostics, suppressed, baselined []Diagnostic, objects []ObjectResult, elapsed time.Duration) *Summary {
+	summary := &Summary{
+		Objects:    len(objects),
+		Suppressed: len(suppressed),
+		Baselined:  len(baselined),
+		DurationMs: elapsed.Milliseconds(),
+	}
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case api.SeverityError:
+			summary.Errors++
+		case api.SeverityWarning:
+			summary.Warnings++
+		}
+	}
+	return summary
+}
+
+// newReport builds a Report from a server response, or from the error that
+// prevented getting one.
+func newReport(wiring []string, response *ValidateResponse, requestErr error, elapsed time.Duration) *Report {
+	report := &Report{
+		Diagnostics: []Diagnostic{},
+		Files:       ReportFiles{Wiring: wiring, Fab: fabFile},
+		Server:      serverURL,
+		DurationMs:  elapsed.Milliseconds(),
+	}
+
+	switch {
+	case requestErr != nil:
+		report.Status = statusError
+		report.ExitCode = exitCodeFor(requestErr)
+		report.Error = requestErr.Error()
+	case response.Success:
+		report.Status = statusPassed
+		report.Success = true
+	default:
+		report.Status = statusFailed
+		report.ExitCode = exitValidationFailed
+	}
+
+	if response != nil {
+		report.UseCase = response.UseCase
+		report.Mode = response.Mode
+		report.Profile = response.Profile
+		report.Message = response.Message
+		report.Output = response.Output
+		report.ResultURL = response.ResultURL
+		if response.Error != "" {
+			report.Error = response.Error
+		}
+		if response.Diagnostics != nil {
+			report.Diagnostics = response.Diagnostics
+		}
+		report.Warnings = response.Warnings
+		report.Suppressed = response.Suppressed
+		report.Baselined = response.Baselined
+		report.Objects = response.Objects
+		report.Summary = response.Summary
+		// Older servers send no summary
+		if report.Summary == nil {
+			report.Summary = summarize(report.Diagnostics, report.Suppressed, report.Baselined, report.Objects, elapsed)
+		}
+	}
+
+	return report
+}
+
+// writeReport renders the report in the selected machine-readable format.
+func writeReport(w io.Writer, report *Report) error {
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case outputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		return enc.Close()
+	case outputJUnit:
+		return writeJUnit(w, []*Report{report})
+	case outputSARIF:
+		return writeSARIF(w, []*Report{report})
+	case outputMarkdown:
+		return writeMarkdown(w, []*Report{report})
+	}
+	return fmt.Errorf("unsupported output format %q", outputFormat)
+}
+
+// name names the report after its files, e.g. wiring.yaml + fab.yaml.
+func (r *Report) name() string {
+	names := []string{}
+	for _, file := range r.Files.Wiring {
+		names = append(names, filepath.Base(file))
+	}
+	name := strings.Join(names, ", ")
+	if r.Files.Fab != "" {
+		name += " + " + filepath.Base(r.Files.Fab)
+	}
+	return name
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit renders one test case per report.
+func writeJUnit(w io.Writer, reports []*Report) error {
+	suite := junitTestSuite{Name: "hh-validator"}
+	var totalMs int64
+	for _, report := range reports {
+		if report.Status == statusSkipped {
+			continue
+		}
+		totalMs += report.DurationMs
+
+		testCase := junitTestCase{
+			ClassName: "hh-validator." + report.UseCase,
+			Name:      report.name(),
+			Time:      junitSeconds(report.DurationMs),
+			SystemOut: report.Output,
+		}
+
+		switch report.Status {
+		case statusFailed:
+			suite.Failures++
+			testCase.Failure = &junitProblem{
+				Message: firstError(report),
+				Type:    "validation",
+				Text:    formatDiagnostics(report.Diagnostics),
+			}
+		case statusError:
+			suite.Errors++
+			testCase.Error = &junitProblem{
+				Message: report.Error,
+				Type:    "request",
+				Text:    report.Error,
+			}
+		}
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = junitSeconds(totalMs)
+
+	suites := junitTestSuites{
+		Name:     "hh-validator",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
+
+func firstError(report *Report) string {
+	for _, d := range report.Diagnostics {
+		if d.Severity == api.SeverityError {
+			return d.Message
+		}
+	}
+	return "validation failed"
+}
+
+func formatDiagnostics(diagnostics []Diagnostic) string {
+	lines := make([]string, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		if d.Code != "" {
+			lines = append(lines, fmt.Sprintf("%s[%s]: %s", d.Severity, d.Code, d.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s", d.Severity, d.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeWarnings lists the warnings of a response, which do not fail
+// validation.
+func writeWarnings(w io.Writer, warnings []Diagnostic) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nWarnings: %d\n", len(warnings))
+	for _, line := range strings.Split(formatDiagnostics(warnings), "\n") {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// writeSuppressed lists the diagnostics acknowledged by ignore comments
+// with their reasons.
+func writeSuppressed(w io.Writer, suppressed []Diagnostic) {
+	if len(suppressed) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nSuppressed: %d\n", len(suppressed))
+	for _, d := range suppressed {
+		line := formatDiagnostics([]Diagnostic{d})
+		if d.Reason != "" {
+			line += " (" + d.Reason + ")"
+		}
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// writeBaselined counts the findings known to the baseline, and lists them
+// if all.
+func writeBaselined(w io.Writer, baselined []Diagnostic, all bool) {
+	if len(baselined) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nBaselined: %d known findings\n", len(baselined))
+	if all {
+		for _, line := range strings.Split(formatDiagnostics(baselined), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+}
+
+// writeObjectResults summarizes the per-object results and lists the objects
+// that did not pass, or all of them.
+func writeObjectResults(w io.Writer, objects []ObjectResult, all bool) {
+	if len(objects) == 0 {
+		return
+	}
+
+	counts := map[string]int{}
+	for _, object := range objects {
+		counts[object.Status]++
+	}
+	fmt.Fprintf(w, "\nObjects: %d passed, %d failed, %d with warnings, %d unknown\n",
+		counts[api.ObjectPassed], counts[api.ObjectFailed], counts[api.ObjectWarning], counts[api.ObjectUnknown])
+
+	marks := map[string]string{
+		api.ObjectPassed:  "✓",
+		api.ObjectFailed:  "✗",
+		api.ObjectWarning: "!",
+		api.ObjectUnknown: "?",
+	}
+	for _, object := range objects {
+		if !all && object.Status != api.ObjectFailed && object.Status != api.ObjectWarning {
+			continue
+		}
+		key := object.Kind + "/" + object.Name
+		if object.Namespace != "" {
+			key = object.Kind + "/" + object.Namespace + "/" + object.Name
+		}
+		fmt.Fprintf(w, "  %s %s (%s:%d)\n", marks[object.Status], key, object.File, object.Line)
+		for _, message := range object.Messages {
+			fmt.Fprintf(w, "      %s\n", message)
+		}
+	}
+}
+
+// firstErrorCode returns the code of the first error diagnostic, if any.
+func firstErrorCode(diagnostics []Diagnostic) string {
+	for _, d := range diagnostics {
+		if d.Severity == api.SeverityError && d.Code != "" {
+			return d.Code
+		}
+	}
+	return ""
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name,omitempty"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful bool `json:"executionSuccessful"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	// Suppressions mark findings acknowledged by ignore comments
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// writeSARIF renders the diagnostics of all reports as a single run.
+func writeSARIF(w io.Writer, reports []*Report) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "hh-validator",
+			Version:        cliVersion,
+			InformationURI: "https://github.com/afewell-hh/hh-validator",
+			Rules:          []sarifRule{},
+		}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: true}},
+		Results:     []sarifResult{},
+	}
+
+	rules := map[string]bool{}
+	for _, report := range reports {
+		if report.Status == statusError {
+			run.Invocations[0].ExecutionSuccessful = false
+		}
+
+		// hhfab reports against the whole bundle, findings the server could
+		// not locate are attributed to its first file
+		uri := ""
+		if len(report.Files.Wiring) > 0 {
+			uri = filepath.ToSlash(report.Files.Wiring[0])
+		}
+		inputs := append(append([]string{}, report.Files.Wiring...), report.Files.Fab)
+
+		diagnostics := append(append([]Diagnostic{}, report.Diagnostics...), report.Suppressed...)
+		for i, d := range diagnostics {
+			// rules are the diagnostic codes, diagnostics of servers that
+			// predate codes fall back to one rule per source
+			ruleID, name, description := d.Source, "", d.Source+" finding"
+			if code, ok := codes.Lookup(d.Code); ok {
+				ruleID, name, description = code.ID, code.Name, code.Title
+			}
+			if !rules[ruleID] {
+				rules[ruleID] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+					ID:               ruleID,
+					Name:             name,
+					ShortDescription: sarifMessage{Text: description},
+				})
+			}
+
+			level := "error"
+			if d.Severity == api.SeverityWarning {
+				level = "warning"
+			}
+			location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: uri}}
+			if input := inputFor(d.File, inputs); input != "" && d.Line > 0 {
+				location = sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(input)},
+					Region:           &sarifRegion{StartLine: d.Line},
+				}
+			}
+			result := sarifResult{
+				RuleID:    ruleID,
+				Level:     level,
+				Message:   sarifMessage{Text: d.Message},
+				Locations: []sarifLocation{{PhysicalLocation: location}},
+			}
+			if i >= len(report.Diagnostics) {
+				result.Suppressions = []sarifSuppression{{Kind: "inSource", Justification: d.Reason}}
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var noProgress bool
+
+// showProgress reports whether progress should be drawn, which is only the
+// case on an interactive terminal so logs and pipes are left alone.
+func showProgress() bool {
+	if noProgress {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// progressWidth keeps the status line from wrapping on narrow terminals.
+const progressWidth = 100
+
+// spinner keeps a single status line on stderr up to date: the latest hhfab
+// line when the server streams, or the elapsed time otherwise.
+type spinner struct {
+	mu    sync.Mutex
+	line  string
+	start time.Time
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func startSpinner() *spinner {
+	s := &spinner{start: time.Now(), done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			s.draw(spinnerFrames[frame%len(spinnerFrames)])
+			select {
+			case <-s.done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+func (s *spinner) update(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.line = line
+}
+
+func (s *spinner) draw(frame rune) {
+	s.mu.Lock()
+	line := s.line
+	s.mu.Unlock()
+
+	if line == "" {
+		line = fmt.Sprintf("Validating... (%s)", time.Since(s.start).Round(time.Second))
+	}
+	line = strings.TrimSpace(line)
+	if runes := []rune(line); len(runes) > progressWidth {
+		line = string(runes[:progressWidth-1]) + "…"
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%c %s", frame, line)
+}
+
+// stop clears the status line.
+func (s *spinner) stop() {
+	close(s.done)
+	s.wg.Wait()
+}
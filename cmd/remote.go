@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"validator/pkg/api"
+)
+
+var (
+	// maxFileSize overrides the upload limits of the server, 0 asks it
+	maxFileSize      int64
+	serverLimitsOnce sync.Once
+	serverLimits     *CapabilitiesResponse
+)
+
+// isRemoteInput reports whether an input argument is an http(s) URL.
+func isRemoteInput(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+// splitChecksum separates an optional #sha256=<hex> fragment from an input
+// URL.
+func splitChecksum(arg string) (string, string, error) {
+	location, fragment, found := strings.Cut(arg, "#")
+	if !found {
+		return location, "", nil
+	}
+	checksum, ok := strings.CutPrefix(fragment, "sha256=")
+	if !ok || len(checksum) != sha256.Size*2 {
+		return "", "", fmt.Errorf("invalid checksum %q in %s, expected #sha256=<64 hex digits>", fragment, location)
+	}
+	return location, strings.ToLower(checksum), nil
+}
+
+// remoteName is the name a downloaded input is uploaded as.
+func remoteName(arg string) string {
+	location, _, _ := splitChecksum(arg)
+	if u, err := url.Parse(location); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		return path.Base(u.Path)
+	}
+	return "remote.yaml"
+}
+
+// uploadLimit returns the size in bytes the server accepts the input up to:
+// --max-file-size if given, or else the upload limit of the server for wiring
+// or fab files, asked once from /capabilities. Servers that cannot be asked
+// are assumed to have the default limit.
+func uploadLimit(input string) int64 {
+	if maxFileSize > 0 {
+		return maxFileSize
+	}
+	serverLimitsOnce.Do(func() {
+		c, err := newClient()
+		if err != nil {
+			return
+		}
+		serverLimits, _ = c.Capabilities(context.Background())
+	})
+	switch {
+	case serverLimits == nil:
+		return api.MaxFileSize
+	case input == fabFile && serverLimits.UploadLimits.Fab > 0:
+		return serverLimits.UploadLimits.Fab
+	case input != fabFile && serverLimits.UploadLimits.Wiring > 0:
+		return serverLimits.UploadLimits.Wiring
+	case serverLimits.MaxFileSize > 0:
+		// Servers from before the per-field limits
+		return serverLimits.MaxFileSize
+	}
+	return api.MaxFileSize
+}
+
+// defaultLimit bounds the downloads of the commands that do not upload them.
+func defaultLimit(string) int64 {
+	return api.MaxFileSize
+}
+
+// fetchRemoteInputs downloads every URL input once, before anything is sent
+// to the validator, and verifies its checksum if one was given. Downloads
+// larger than limit returns for the input are refused.
+func fetchRemoteInputs(inputs []string, limit func(input string) int64) error {
+	var client *http.Client
+	for _, input := range inputs {
+		if _, loaded := loadedInputs[input]; !isRemoteInput(input) || loaded {
+			continue
+		}
+		location, checksum, err := splitChecksum(input)
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+
+		if client == nil {
+			// Inputs are downloaded over the network with --local too
+			if client, err = newNetworkClient(); err != nil {
+				return err
+			}
+		}
+		if verbose {
+			fmt.Fprintf(infoOut(), "Downloading %s\n", location)
+		}
+		content, err := download(client, location, limit(input))
+		if err != nil {
+			return err
+		}
+
+		if checksum != "" {
+			sum := sha256.Sum256(content)
+			if actual := hex.EncodeToString(sum[:]); actual != checksum {
+				return withExitCode(exitInputError, fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", location, checksum, actual))
+			}
+		}
+		loadedInputs[input] = loadedInput{content: content, name: remoteName(input)}
+	}
+	return nil
+}
+
+// download fetches an input of up to limit bytes. The validator's auth token
+// is deliberately not sent, the file usually lives on another host.
+func download(client *http.Client, location string, limit int64) ([]byte, error) {
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, withExitCode(exitServerError, fmt.Errorf("failed to download %s: %s", location, resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return nil, withExitCode(exitInputError, fmt.Errorf("failed to download %s: %s", location, resp.Status))
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", location, err)
+	}
+	if int64(len(content)) > limit {
+		return nil, withExitCode(exitInputError, fmt.Errorf("%s is larger than %d bytes", location, limit))
+	}
+	return content, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"validator/pkg/api"
+)
+
+func TestCLIRemoteLimits(t *testing.T) {
+	isolate(t)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wiring.yaml":
+			w.Write([]byte(testWiring))
+		case "/large.yaml":
+			w.Write([]byte(testWiring + strings.Repeat("# padding\n", 30)))
+		case "/fab.yaml":
+			w.Write([]byte(strings.Repeat("# fab\n", 20)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer files.Close()
+
+	// The server takes wiring files up to 200 bytes and fab files up to 50
+	capabilities := CapabilitiesResponse{UploadLimits: api.UploadLimits{Wiring: 200, Fab: 50}}
+	server := newFakeServer(t)
+	server.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/capabilities" {
+			json.NewEncoder(w).Encode(capabilities)
+			return
+		}
+		json.NewEncoder(w).Encode(ValidateResponse{Success: true, Message: "valid", UseCase: "uc1"})
+	}
+	// Servers from before the per-field limits only tell the one of all files
+	old := newFakeServer(t)
+	old.handler = func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/capabilities" {
+			json.NewEncoder(w).Encode(CapabilitiesResponse{MaxFileSize: 1000})
+			return
+		}
+		json.NewEncoder(w).Encode(ValidateResponse{Success: true, Message: "valid", UseCase: "uc1"})
+	}
+
+	// Downloads are kept for the process, every case fetches URLs not
+	// downloaded before
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"within the limits", []string{"-w", files.URL + "/wiring.yaml", "-s", server.URL}, exitOK},
+		{"large wiring", []string{"-w", files.URL + "/large.yaml", "-s", server.URL}, exitInputError},
+		{"large fab", []string{"-w", files.URL + "/wiring.yaml", "-f", files.URL + "/fab.yaml", "-s", server.URL}, exitInputError},
+		{"flag", []string{"-w", files.URL + "/large.yaml", "-f", files.URL + "/fab.yaml", "-s", server.URL, "--max-file-size", "1000"}, exitOK},
+		{"flag below the server", []string{"-w", files.URL + "/wiring.yaml?small", "-s", server.URL, "--max-file-size", "10"}, exitInputError},
+		{"old server", []string{"-w", files.URL + "/large.yaml?old", "-f", files.URL + "/fab.yaml?old", "-s", old.URL}, exitOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, output := cli(t, tc.args...); code != tc.code {
+				t.Errorf("exit code %d, want %d, output:\n%s", code, tc.code, output)
+			}
+		})
+	}
+}
+
+func TestCLIRemoteLocal(t *testing.T) {
+	isolate(t)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testWiring))
+	}))
+	defer files.Close()
+	// An hhfab passing every wiring
+	bin := t.TempDir()
+	writeFile(t, bin, "hhfab", "#!/bin/sh\ncase \"$1\" in version|--version) echo v0.41.1;; init) touch fab.yaml;; esac\n")
+	if err := os.Chmod(filepath.Join(bin, "hhfab"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Inputs are downloaded from their host, not from the in-process server
+	if code, output := cli(t, "--local", "-w", files.URL+"/wiring.yaml"); code != exitOK {
+		t.Errorf("exit code %d, output:\n%s", code, output)
+	}
+}
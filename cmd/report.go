@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"validator/internal/report"
+)
+
+// htmlReport is the file the report command writes its HTML report to.
+var htmlReport string
+
+func newReportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Validate files and write a standalone HTML report",
+		Long: `Validate wiring files like the validator command does and write the result as
+a standalone HTML report: the summary, the results of every object, the
+diagnostics with the offending lines of the files and the topology graph. The
+report has no external resources, so it can be attached to a design review.
+Servers render the same report for POST /validate?format=html.
+
+The result is printed as usual; the report is written whether the validation
+passes or fails.
+
+Examples:
+  validator report -w wiring/ -f fab.yaml --html review.html
+  validator report -w wiring.yaml --html review.html --strict --profile prod
+
+` + exitCodesHelp,
+		Args: cobra.NoArgs,
+		RunE: runReport,
+	}
+
+	cmd.Flags().StringArrayVarP(&wiringArgs, "wiring", "w", nil, "Wiring diagram file, directory, glob pattern, http(s) URL or - for stdin, repeatable (required)")
+	cmd.Flags().StringVarP(&fabFile, "fab", "f", "", "Path or http(s) URL of fabricator config file, or - for stdin (optional)")
+	cmd.Flags().StringVar(&htmlReport, "html", "", "File to write the HTML report to (required)")
+	addValidationFlags(cmd)
+	addClientFlags(cmd)
+
+	cmd.MarkFlagRequired("wiring")
+	cmd.MarkFlagRequired("html")
+
+	return cmd
+}
+
+func runReport(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := setupValidation(cmd); err != nil {
+		return err
+	}
+	if batch {
+		return withExitCode(exitInputError, fmt.Errorf("--batch cannot be combined with a report of one validation"))
+	}
+	if err := validateInputFiles(); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	printConfiguration()
+
+	if err := fetchRemoteInputs(append(append([]string{}, wiringFiles...), fabFile), uploadLimit); err != nil {
+		return err
+	}
+
+	return validateOnce()
+}
+
+// writeHTMLReport writes the report of a validation of the wiring files and
+// the fab file, if any, to the --html file.
+func writeHTMLReport(wiring []string, response *ValidateResponse) error {
+	input := report.Input{Response: response, Generated: time.Now()}
+	for _, wiringFile := range wiring {
+		file, err := readUpload(wiringFile)
+		if err != nil {
+			return withExitCode(exitInputError, fmt.Errorf("failed to read wiring file: %w", err))
+		}
+		input.Wiring = append(input.Wiring, report.File{Name: file.Name, Data: file.Data})
+	}
+	if fabFile != "" {
+		file, err := readUpload(fabFile)
+		if err != nil {
+			return withExitCode(exitInputError, fmt.Errorf("failed to read fab file: %w", err))
+		}
+		input.Fab = &report.File{Name: file.Name, Data: file.Data}
+	}
+
+	var page bytes.Buffer
+	if err := report.WriteHTML(&page, input); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	if err := os.WriteFile(htmlReport, page.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	fmt.Fprintf(infoOut(), "Report written to %s\n", htmlReport)
+	return nil
+}
+
+// writeMarkdown renders reports as a Markdown comment for pull requests, the
+// same as servers do for POST /validate?format=markdown.
+func writeMarkdown(w io.Writer, reports []*Report) error {
+	inputs := []report.Input{}
+	for _, r := range reports {
+		input := report.Input{Name: r.name()}
+		if r.Status != statusSkipped {
+			input.Response = &ValidateResponse{
+				Success:     r.Success,
+				Message:     r.Message,
+				Output:      r.Output,
+				UseCase:     r.UseCase,
+				Mode:        r.Mode,
+				Profile:     r.Profile,
+				Error:       r.Error,
+				Diagnostics: r.Diagnostics,
+				Warnings:    r.Warnings,
+				Suppressed:  r.Suppressed,
+				Baselined:   r.Baselined,
+				Objects:     r.Objects,
+				Summary:     r.Summary,
+				ResultURL:   r.ResultURL,
+			}
+		}
+		if r.Status == statusError {
+			input.Err = errors.New(r.Error)
+		}
+		inputs = append(inputs, input)
+	}
+	return report.WriteMarkdown(w, inputs...)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	retries      int
+	retryBackoff time.Duration
+)
+
+// reportRetry tells the user why a request is sent again, above the progress
+// line if one is drawn.
+func reportRetry(retry, retries int, delay time.Duration, err error) {
+	if showProgress() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	fmt.Fprintf(infoOut(), "Request failed, retrying in %s (%d/%d): %v\n", delay.Round(time.Millisecond), retry, retries, err)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type SampleResponse struct {
+	Success bool   `json:"success"`
+	Wiring  string `json:"wiring,omitempty"`
+	Fab     string `json:"fab,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// sampleFlags are the counts of a sample by their flag, sent as the request
+// field with - replaced by _.
+var sampleFlags = []struct {
+	name, usage string
+	value       int
+}{
+	{"spines", "Spine switches, 0 for a collapsed-core fabric", 2},
+	{"fabric-links", "Links between each spine and leaf", 2},
+	{"mclag-leaves", "Leaves in MCLAG pairs", 2},
+	{"orphan-leaves", "Leaves without redundancy", 1},
+	{"mclag-servers", "Servers attached to each MCLAG pair", 2},
+	{"unbundled-servers", "Servers with one link to each leaf", 1},
+	{"bundled-servers", "Servers with a bundle to each leaf", 1},
+}
+
+var (
+	sampleDir   string
+	sampleForce bool
+)
+
+func newSampleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sample",
+		Short: "Generate an example wiring diagram and fab.yaml",
+		Long: `Generate a known-valid wiring diagram and matching fabricator config with
+hhfab's VLAB generator, to learn from, start a fabric with or diff against. The
+server generates the files, or hhfab on this machine with --local; they are
+written to wiring.yaml and fab.yaml in --dir.
+
+Examples:
+  validator sample --dir lab/
+  validator sample --spines 0 --orphan-leaves 0 --local`,
+		Args: cobra.NoArgs,
+		RunE: runSample,
+	}
+
+	for _, flag := range sampleFlags {
+		cmd.Flags().Int(flag.name, flag.value, flag.usage)
+	}
+	cmd.Flags().StringVar(&sampleDir, "dir", ".", "Directory to write wiring.yaml and fab.yaml to")
+	cmd.Flags().BoolVar(&sampleForce, "force", false, "Overwrite existing files")
+	cmd.Flags().BoolVar(&local, "local", false, "Generate with hhfab on this machine instead of a server")
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func runSample(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := applyConfig(cmd); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+
+	paths := []string{filepath.Join(sampleDir, "wiring.yaml"), filepath.Join(sampleDir, "fab.yaml")}
+	if !sampleForce {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err == nil {
+				return withExitCode(exitInputError, fmt.Errorf("%s already exists, use --force to overwrite it", path))
+			}
+		}
+	}
+
+	// Only send what was set, the server knows the defaults
+	request := map[string]int{}
+	for _, flag := range sampleFlags {
+		if cmd.Flags().Changed(flag.name) {
+			value, _ := cmd.Flags().GetInt(flag.name)
+			request[strings.ReplaceAll(flag.name, "-", "_")] = value
+		}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	client, err := newHTTPClient()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(serverURL, "/")+"/generate/sample", bytes.NewReader(body))
+	if err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return withExitCode(exitServerError, fmt.Errorf("request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	response := &SampleResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return withExitCode(exitServerError, fmt.Errorf("failed to parse response (%s), check client and server compatibility with 'validator version': %w", resp.Status, err))
+	}
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return withExitCode(exitServerError, fmt.Errorf("server error (%d): %s", resp.StatusCode, response.Error))
+	case !response.Success:
+		if response.Output != "" {
+			fmt.Fprint(os.Stderr, response.Output)
+		}
+		return withExitCode(exitInputError, fmt.Errorf("generating the sample failed: %s", response.Error))
+	}
+
+	if err := os.MkdirAll(sampleDir, 0755); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	for i, content := range []string{response.Wiring, response.Fab} {
+		if err := os.WriteFile(paths[i], []byte(content), 0644); err != nil {
+			return withExitCode(exitInputError, fmt.Errorf("failed to write %s: %w", paths[i], err))
+		}
+	}
+	fmt.Printf("Wrote %s and %s\n", paths[0], paths[1])
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"validator/pkg/server"
+)
+
+func newServeCommand() *cobra.Command {
+	opts := server.DefaultConfig()
+	opts.Port = os.Getenv("PORT")
+	opts.ConfigFile = os.Getenv("CONFIG_FILE")
+	opts.Environment = true
+	opts.Debug = os.Getenv("DEBUG_ENDPOINTS") == "true"
+	opts.DebugAddr = os.Getenv("DEBUG_ADDR")
+
+	var backend string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the validator web service",
+		Long: `Run the validator web service in this process. This is the same server as
+the standalone validator-server binary and requires hhfab on the PATH, unless
+--backend=mock answers with canned results instead.
+
+The PORT, CONFIG_FILE, DEBUG_ENDPOINTS and DEBUG_ADDR environment variables
+are honored as defaults. SIGINT and SIGTERM stop it once the requests in
+flight are answered.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Overrides the config file like VALIDATOR_BACKEND, across reloads
+			if backend != "" {
+				os.Setenv("VALIDATOR_BACKEND", backend)
+			}
+			srv, err := server.New(opts)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			err = srv.Run(ctx)
+			if closeErr := srv.Close(); closeErr != nil {
+				log.Printf("Failed to export audit events: %v", closeErr)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Port, "port", "p", opts.Port, "Port to listen on (default 8080)")
+	cmd.Flags().StringVarP(&opts.ConfigFile, "config", "c", opts.ConfigFile, "Path to server configuration file")
+	cmd.Flags().StringVar(&backend, "backend", "", "Run validations with hhfab, or mock for canned results without it (default from the config file)")
+	cmd.Flags().BoolVar(&opts.Debug, "debug-endpoints", opts.Debug, "Serve pprof and runtime dumps on the debug address")
+	cmd.Flags().StringVar(&opts.DebugAddr, "debug-addr", opts.DebugAddr, "Address of the debug endpoints (default localhost:6060)")
+
+	return cmd
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// showSource makes text output quote the lines diagnostics point at.
+var showSource bool
+
+// sourceContext is the number of lines shown around the offending one.
+const sourceContext = 1
+
+// writeSourceAnnotations prints every located diagnostic followed by the
+// offending line of the local file, underlined, like compiler output.
+// Diagnostics without a location, or whose file is not one of the inputs, are
+// skipped.
+func writeSourceAnnotations(w io.Writer, diagnostics []Diagnostic, inputs []string, color bool) {
+	for _, d := range diagnostics {
+		if d.File == "" || d.Line <= 0 {
+			continue
+		}
+		input := inputFor(d.File, inputs)
+		if input == "" {
+			continue
+		}
+		lines, err := readLines(input)
+		if err != nil || d.Line > len(lines) {
+			continue
+		}
+
+		severity := d.Severity
+		if d.Code != "" {
+			severity += "[" + d.Code + "]"
+		}
+		if color {
+			severity = colorRed + severity + colorReset
+		}
+		fmt.Fprintf(w, "\n%s: %s\n", severity, d.Message)
+
+		first, last := max(d.Line-sourceContext, 1), min(d.Line+sourceContext, len(lines))
+		width := len(fmt.Sprint(last))
+		gutter := strings.Repeat(" ", width)
+		fmt.Fprintf(w, "%s--> %s:%d\n", gutter, displayName(input), d.Line)
+		fmt.Fprintf(w, "%s |\n", gutter)
+		for n := first; n <= last; n++ {
+			fmt.Fprintf(w, "%*d | %s\n", width, n, lines[n-1])
+			if n == d.Line {
+				fmt.Fprintf(w, "%s | %s\n", gutter, underline(lines[n-1], color))
+			}
+		}
+	}
+}
+
+// inputFor returns the input that was uploaded under name, the first one if
+// several share a base name.
+func inputFor(name string, inputs []string) string {
+	for _, input := range inputs {
+		if input == "" {
+			continue
+		}
+		if uploadName(input) == name {
+			return input
+		}
+	}
+	return ""
+}
+
+// uploadName is the file name openInput sends an input under.
+func uploadName(input string) string {
+	if loaded, ok := loadedInputs[input]; ok {
+		return loaded.name
+	}
+	if input == stdinArg {
+		return stdinName
+	}
+	return filepath.Base(input)
+}
+
+// displayName names an input for humans.
+func displayName(input string) string {
+	if input == stdinArg {
+		return "<stdin>"
+	}
+	return input
+}
+
+func readLines(input string) ([]string, error) {
+	reader, _, err := openInput(input)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.ReplaceAll(scanner.Text(), "\t", "    "))
+	}
+	return lines, scanner.Err()
+}
+
+// underline puts carets below the text of line, leaving its indentation.
+func underline(line string, color bool) string {
+	text := strings.TrimLeft(line, " ")
+	carets := strings.Repeat("^", len([]rune(strings.TrimRight(text, " "))))
+	if carets == "" {
+		carets = "^"
+	}
+	if color {
+		carets = colorRed + carets + colorReset
+	}
+	return strings.Repeat(" ", len(line)-len(text)) + carets
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+// cliVersion is the CLI version, overridden at build time via -ldflags.
+var cliVersion = "1.0.0"
+
+var clientOnly bool
+
+// VersionReport is what `validator version` prints with --output json.
+type VersionReport struct {
+	Client   ClientVersion  `json:"client"`
+	Server   *ServerVersion `json:"server,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+}
+
+type ClientVersion struct {
+	Version       string `json:"version"`
+	SchemaVersion int    `json:"schema_version"`
+	Commit        string `json:"commit,omitempty"`
+	GoVersion     string `json:"go_version"`
+	Platform      string `json:"platform"`
+}
+
+// ServerVersion is the version the server reports. SchemaVersion is 0 for
+// servers predating the capabilities endpoint.
+type ServerVersion struct {
+	URL           string `json:"url"`
+	Version       string `json:"version"`
+	SchemaVersion int    `json:"schema_version,omitempty"`
+}
+
+func newVersionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print client and server versions and check they are compatible",
+		Long: `Print the CLI build information and the version of the server it talks to.
+A warning is printed when the server's major version or response schema
+differs from what this CLI understands, which is the usual cause of
+"failed to parse response" errors.`,
+		Args: cobra.NoArgs,
+		RunE: runVersion,
+	}
+
+	cmd.Flags().BoolVar(&clientOnly, "client", false, "Only print the client version, do not contact the server")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "Output format: text, json")
+	addClientFlags(cmd)
+
+	return cmd
+}
+
+func runVersion(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+
+	if err := applyConfig(cmd); err != nil {
+		return withExitCode(exitInputError, err)
+	}
+	switch {
+	case outputFormat == outputText || outputFormat == outputJSON:
+	case !cmd.Flags().Changed("output"):
+		outputFormat = outputText
+	default:
+		return withExitCode(exitInputError, fmt.Errorf("unsupported output format %q, must be one of: text, json", outputFormat))
+	}
+
+	report := &VersionReport{Client: clientVersion()}
+
+	var serverErr error
+	if !clientOnly {
+		report.Server, serverErr = queryServerVersion()
+		if report.Server != nil {
+			report.Warnings = compatibilityWarnings(report.Client, report.Server)
+		}
+	}
+
+	if outputFormat == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeVersion(os.Stdout, report)
+	}
+
+	for _, warning := range report.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	return serverErr
+}
+
+func clientVersion() ClientVersion {
+	version := ClientVersion{
+		Version:       cliVersion,
+		SchemaVersion: api.SchemaVersion,
+		GoVersion:     runtime.Version(),
+		Platform:      runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				version.Commit = setting.Value
+			}
+		}
+	}
+	return version
+}
+
+// queryServerVersion asks /capabilities for the server and schema versions,
+// falling back to the service info of older servers.
+func queryServerVersion() (*ServerVersion, error) {
+	c, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	capabilities, err := c.Capabilities(ctx)
+	if err == nil {
+		return &ServerVersion{URL: serverURL, Version: capabilities.Version, SchemaVersion: capabilities.SchemaVersion}, nil
+	}
+	var status *client.StatusError
+	if !errors.As(err, &status) || status.StatusCode != http.StatusNotFound {
+		return nil, unexpectedResponse("/capabilities", err)
+	}
+
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, unexpectedResponse("/", err)
+	}
+	return &ServerVersion{URL: serverURL, Version: info.Version}, nil
+}
+
+// unexpectedResponse reports the server answering with an error where a
+// version was expected.
+func unexpectedResponse(path string, err error) error {
+	var status *client.StatusError
+	if errors.As(err, &status) {
+		return withExitCode(exitServerError, fmt.Errorf("unexpected response from %s: %w", path, err))
+	}
+	return err
+}
+
+// compatibilityWarnings compares what the server reports with what this CLI
+// was built against.
+func compatibilityWarnings(client ClientVersion, srv *ServerVersion) []string {
+	var warnings []string
+	if major(srv.Version) != major(client.Version) {
+		warnings = append(warnings, fmt.Sprintf("server version %s and client version %s have different major versions", srv.Version, client.Version))
+	}
+	switch {
+	case srv.SchemaVersion == 0:
+		warnings = append(warnings, "server does not report a response schema version, it may be too old for this client")
+	case srv.SchemaVersion != client.SchemaVersion:
+		warnings = append(warnings, fmt.Sprintf("server response schema %d differs from schema %d understood by this client", srv.SchemaVersion, client.SchemaVersion))
+	}
+	return warnings
+}
+
+func major(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.Index(version, "."); i >= 0 {
+		return version[:i]
+	}
+	return version
+}
+
+func writeVersion(w io.Writer, report *VersionReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Client version:\t%s\n", report.Client.Version)
+	if report.Client.Commit != "" {
+		fmt.Fprintf(tw, "Commit:\t%s\n", report.Client.Commit)
+	}
+	fmt.Fprintf(tw, "Go version:\t%s\n", report.Client.GoVersion)
+	fmt.Fprintf(tw, "Platform:\t%s\n", report.Client.Platform)
+	fmt.Fprintf(tw, "Schema version:\t%d\n", report.Client.SchemaVersion)
+	if srv := report.Server; srv != nil {
+		fmt.Fprintf(tw, "Server:\t%s\n", srv.URL)
+		fmt.Fprintf(tw, "Server version:\t%s\n", srv.Version)
+		if srv.SchemaVersion != 0 {
+			fmt.Fprintf(tw, "Server schema version:\t%d\n", srv.SchemaVersion)
+		}
+	}
+	tw.Flush()
+}
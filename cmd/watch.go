@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce groups the burst of events a single save produces.
+const watchDebounce = 300 * time.Millisecond
+
+// runWatch validates the input files now and again after every change until
+// interrupted. Results are printed as they come; failures never stop the loop.
+func runWatch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch the parent directories as editors often save by renaming a
+	// temporary file over the original, which drops watches on the file.
+	files := map[string]bool{}
+	for _, file := range append(append([]string{}, wiringFiles...), fabFile) {
+		if file == "" {
+			continue
+		}
+		if file == stdinArg || isRemoteInput(file) {
+			return withExitCode(exitInputError, fmt.Errorf("%s cannot be watched", file))
+		}
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return withExitCode(exitInputError, err)
+		}
+		files[abs] = true
+		if err := watcher.Add(filepath.Dir(abs)); err != nil {
+			return withExitCode(exitInputError, fmt.Errorf("failed to watch %s: %w", file, err))
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	lastCode := -1
+	run := func() {
+		err := validateInputs()
+		if err != nil && err != errValidationFailed && quiet < 2 {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+
+		code := exitCodeFor(err)
+		if lastCode != -1 && code != lastCode {
+			fmt.Fprintf(infoOut(), "Status changed: %s → %s\n", watchStatus(lastCode), watchStatus(code))
+		}
+		lastCode = code
+		fmt.Fprintf(infoOut(), "\nWatching for changes (Ctrl+C to stop)...\n")
+	}
+	run()
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !files[event.Name] || event.Op == fsnotify.Chmod {
+				continue
+			}
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Watch error: %v\n", err)
+		case <-debounce:
+			debounce = nil
+			fmt.Fprintf(infoOut(), "\n[%s] Change detected, re-validating...\n", time.Now().Format("15:04:05"))
+			run()
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+func watchStatus(code int) string {
+	switch code {
+	case exitOK:
+		return "passing"
+	case exitValidationFailed:
+		return "failing"
+	default:
+		return "error"
+	}
+}
@@ -0,0 +1,64 @@
+//go:build wasip1
+
+// Command require-boot is an example validator plugin. It warns about
+// switches without a boot serial or MAC, which zero-touch provisioning needs
+// to recognize them. Build it with
+//
+//	GOOS=wasip1 GOARCH=wasm go build -o require-boot.wasm ./examples/plugins/require-boot
+//
+// and copy the result into the server's plugins_dir.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type input struct {
+	Objects []struct {
+		Key      string         `json:"key"`
+		Document map[string]any `json:"document"`
+	} `json:"objects"`
+}
+
+type finding struct {
+	Object   string `json:"object"`
+	Path     string `json:"path,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func main() {
+	var in input
+	if err := json.NewDecoder(os.Stdin).Decode(&in); err != nil {
+		fmt.Fprintln(os.Stderr, "decoding input:", err)
+		os.Exit(1)
+	}
+
+	findings := []finding{}
+	for _, object := range in.Objects {
+		if object.Document["kind"] != "Switch" {
+			continue
+		}
+		spec, _ := object.Document["spec"].(map[string]any)
+		boot, _ := spec["boot"].(map[string]any)
+		if boot["serial"] == nil && boot["mac"] == nil {
+			path := "spec"
+			if boot != nil {
+				path = "spec.boot"
+			}
+			findings = append(findings, finding{
+				Object:   object.Key,
+				Path:     path,
+				Severity: "warning",
+				Message:  "no spec.boot.serial or spec.boot.mac to provision the switch by",
+			})
+		}
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(map[string]any{"findings": findings}); err != nil {
+		fmt.Fprintln(os.Stderr, "encoding output:", err)
+		os.Exit(1)
+	}
+}
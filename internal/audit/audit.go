@@ -0,0 +1,157 @@
+// Package audit records who did what on the validator server and exports
+// the events to where security operations collect them: syslog receivers,
+// HTTP event collectors such as Splunk HEC, and rotated local files.
+package audit
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Outcomes of an audited action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	// OutcomeDenied is the outcome of requests rejected for their
+	// credentials or role
+	OutcomeDenied = "denied"
+)
+
+// Event is an audited request. Action is the method and route, such as
+// "POST /validate", Path the request path naming the resource, such as
+// /history/9f2c…, and RequestID the ID its response named in X-Request-ID.
+type Event struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Action        string    `json:"action"`
+	Path          string    `json:"path"`
+	Outcome       string    `json:"outcome"`
+	Status        int       `json:"status"`
+	Tenant        string    `json:"tenant,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	Authenticated bool      `json:"authenticated"`
+	ClientIP      string    `json:"client_ip"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	DurationMS    int64     `json:"duration_ms"`
+}
+
+// OutcomeOf returns the outcome of a request answered with status.
+func OutcomeOf(status int) string {
+	switch {
+	case status == 401 || status == 403:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
+
+// Exporter sends events to a destination.
+type Exporter interface {
+	// Name names the exporter in logs and metrics
+	Name() string
+	// Export sends a batch of events in order
+	Export(events []Event) error
+	Close() error
+}
+
+const (
+	// bufferSize bounds the events waiting for the exporters; events
+	// logged while it is full are dropped rather than slow down requests
+	bufferSize = 4096
+	// batchSize bounds the events handed to an exporter at once
+	batchSize = 100
+)
+
+// Hooks are told about the fate of events, for metrics.
+type Hooks struct {
+	// Exported is called after every batch an exporter sent or failed to
+	Exported func(exporter string, events int, err error)
+	// Dropped is called for every event dropped with a full buffer
+	Dropped func()
+}
+
+// Logger hands events to its exporters in the background.
+type Logger struct {
+	exporters []Exporter
+	hooks     Hooks
+	events    chan Event
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLogger starts a Logger exporting to exporters. Without exporters it
+// returns nil, the Logger that logs nothing.
+func NewLogger(exporters []Exporter, hooks Hooks) *Logger {
+	if len(exporters) == 0 {
+		return nil
+	}
+	l := &Logger{
+		exporters: exporters,
+		hooks:     hooks,
+		events:    make(chan Event, bufferSize),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Log queues an event without waiting for the exporters.
+func (l *Logger) Log(event Event) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.events <- event:
+	default:
+		if l.hooks.Dropped != nil {
+			l.hooks.Dropped()
+		}
+	}
+}
+
+// Close exports the queued events and closes the exporters.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	l.closeOnce.Do(func() {
+		close(l.events)
+		<-l.done
+		for _, exporter := range l.exporters {
+			errs = append(errs, exporter.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for event := range l.events {
+		batch := []Event{event}
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case event, ok := <-l.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, event)
+			default:
+				break fill
+			}
+		}
+		for _, exporter := range l.exporters {
+			err := exporter.Export(batch)
+			if err != nil {
+				log.Printf("Exporting %d audit events to %s failed: %v", len(batch), exporter.Name(), err)
+			}
+			if l.hooks.Exported != nil {
+				l.hooks.Exported(exporter.Name(), len(batch), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File appends events as JSON lines to a file, rotating it before it grows
+// over its maximum size: path becomes path.1, path.1 path.2 and so on, and
+// the oldest beyond the backups kept is removed.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFile opens the file at path, creating it readable by the owner alone.
+// A zero maxSize never rotates it.
+func NewFile(path string, maxSize int64, maxBackups int) (*File, error) {
+	f := &File{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening audit log: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Name implements Exporter.
+func (f *File) Name() string { return "file" }
+
+// Export implements Exporter.
+func (f *File) Export(events []Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+		if f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+			if err := f.rotate(); err != nil {
+				return err
+			}
+		}
+		if f.file == nil {
+			if err := f.open(); err != nil {
+				return err
+			}
+		}
+		n, err := f.file.Write(line)
+		f.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *File) rotate() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil {
+			return fmt.Errorf("rotating audit log: %w", err)
+		}
+		return f.open()
+	}
+	os.Remove(f.backup(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotating audit log: %w", err)
+		}
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return fmt.Errorf("rotating audit log: %w", err)
+	}
+	return f.open()
+}
+
+func (f *File) backup(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+// Close implements Exporter.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const hecTimeout = 10 * time.Second
+
+// HEC posts events to an HTTP event collector in the format of Splunk HEC,
+// which other SIEMs accept as well.
+type HEC struct {
+	url        string
+	token      string
+	index      string
+	sourceType string
+	hostname   string
+	client     *http.Client
+}
+
+// NewHEC returns an exporter posting to url, the event endpoint of the
+// collector such as https://splunk:8088/services/collector/event, with
+// token. Events go to index, the default one of the token if empty.
+func NewHEC(url, token, index, sourceType string) *HEC {
+	hostname, _ := os.Hostname()
+	return &HEC{
+		url:        url,
+		token:      token,
+		index:      index,
+		sourceType: sourceType,
+		hostname:   hostname,
+		client:     &http.Client{Timeout: hecTimeout},
+	}
+}
+
+// hecEvent is the envelope of an event; Time is in seconds since the epoch.
+type hecEvent struct {
+	Time       float64 `json:"time"`
+	Host       string  `json:"host,omitempty"`
+	Source     string  `json:"source"`
+	SourceType string  `json:"sourcetype,omitempty"`
+	Index      string  `json:"index,omitempty"`
+	Event      Event   `json:"event"`
+}
+
+// Name implements Exporter.
+func (h *HEC) Name() string { return "http" }
+
+// Export implements Exporter, posting the batch in one request of
+// concatenated envelopes.
+func (h *HEC) Export(events []Event) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, event := range events {
+		err := encoder.Encode(hecEvent{
+			Time:       float64(event.Time.UnixMilli()) / 1000,
+			Host:       h.hostname,
+			Source:     "hh-validator",
+			SourceType: h.sourceType,
+			Index:      h.index,
+			Event:      event,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, h.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+h.token)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("answered with %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// Close implements Exporter.
+func (h *HEC) Close() error { return nil }
@@ -0,0 +1,552 @@
+// Package codes is the catalog of stable diagnostic codes. hhfab reports free
+// form messages; mapping them to codes gives users and tooling something to
+// look up and match on that does not change with hhfab's wording.
+package codes
+
+import (
+	"sort"
+	"strings"
+)
+
+// Code describes one class of problem and how to fix it.
+type Code struct {
+	ID string `json:"code" yaml:"code"`
+	// Name is a stable slug of the code for readable matching, e.g.
+	// yaml-parse
+	Name        string   `json:"name" yaml:"name"`
+	Title       string   `json:"title" yaml:"title"`
+	Description string   `json:"description" yaml:"description"`
+	Causes      []string `json:"causes" yaml:"causes"`
+	Remediation []string `json:"remediation" yaml:"remediation"`
+
+	// patterns are lower-case substrings of hhfab messages of this class,
+	// all of one entry must match.
+	patterns [][]string
+}
+
+const (
+	// Unclassified is the code of messages matching no other code.
+	Unclassified = "HHV000"
+
+	// YAMLSyntax is the code of files that are not valid YAML.
+	YAMLSyntax = "HHV001"
+
+	// UnknownKind is the code of objects of a kind or version that does not
+	// exist.
+	UnknownKind = "HHV002"
+
+	// Duplicate is the code of objects defined twice.
+	Duplicate = "HHV003"
+
+	// PortConflict is the code of switch ports used twice or not existing.
+	PortConflict = "HHV004"
+
+	// MissingReference is the code of references to undefined objects.
+	MissingReference = "HHV005"
+
+	// Overlap is the code of overlapping ranges and subnets.
+	Overlap = "HHV006"
+
+	// InvalidFabricator is the code of fabricator configs hhfab rejects.
+	InvalidFabricator = "HHV007"
+
+	// InvalidField is the code of field values that are not allowed.
+	InvalidField = "HHV008"
+
+	// FabricatorMismatch is the code of wiring that contradicts the
+	// fabricator config.
+	FabricatorMismatch = "HHV009"
+
+	// OutOfRange is the code of values outside the range allocated for
+	// them.
+	OutOfRange = "HHV010"
+
+	// SubnetTooSmall is the code of subnets without room for the hosts
+	// attached to them.
+	SubnetTooSmall = "HHV011"
+
+	// Redundancy is the code of inconsistent MCLAG and ESLAG groups.
+	Redundancy = "HHV012"
+
+	// Deprecated, Unused, SinglePointOfFailure and MissingDescription are the
+	// codes of warnings.
+	Deprecated           = "HHV013"
+	Unused               = "HHV014"
+	SinglePointOfFailure = "HHV015"
+	MissingDescription   = "HHV016"
+
+	// HHFabSkipped is the code of the warning that hhfab was not run.
+	HHFabSkipped = "HHV017"
+
+	// Topology is the code of fabrics that break the topology invariants of
+	// the validation profile.
+	Topology = "HHV018"
+
+	// Plugin is the code of findings of plugin rules that bring none of
+	// their own, and of plugins that failed.
+	Plugin = "HHV019"
+
+	// PortMismatch is the code of port speeds and breakouts that contradict
+	// each other or the connections using them.
+	PortMismatch = "HHV020"
+
+	// ResourceLimit is the code of validations whose hhfab run broke the
+	// resource limits of the server.
+	ResourceLimit = "HHV021"
+
+	// Style is the code of lines breaking the YAML style checks.
+	Style = "HHV022"
+
+	// InvalidName is the code of names breaking the Kubernetes naming
+	// constraints or the naming conventions of the validation profile.
+	InvalidName = "HHV023"
+)
+
+// catalog is ordered from the most to the least specific, the first code
+// matching a message wins.
+var catalog = []Code{
+	{
+		ID:          YAMLSyntax,
+		Name:        "yaml-parse",
+		Title:       "YAML syntax error",
+		Description: "A wiring or fabricator file is not valid YAML, so none of its objects could be loaded.",
+		Causes: []string{
+			"Wrong indentation, often tabs mixed with spaces",
+			"A missing colon after a key or a stray character",
+			"A document separator (---) missing between objects",
+		},
+		Remediation: []string{
+			"Check the line reported in the message and the lines just above it",
+			"Run the file through a YAML linter, e.g. yamllint",
+			"Indent with spaces only",
+		},
+		patterns: [][]string{
+			{"yaml:", "could not find expected"},
+			{"yaml:", "did not find expected"},
+			{"yaml:", "mapping values are not allowed"},
+			{"yaml:", "found character that cannot start"},
+			{"yaml: line"},
+		},
+	},
+	{
+		ID:          UnknownKind,
+		Name:        "unknown-kind",
+		Title:       "Unknown object kind or API version",
+		Description: "An object has a kind or apiVersion that this hhfab version does not know.",
+		Causes: []string{
+			"A typo in kind or apiVersion",
+			"The file was written for a different Fabricator release",
+			"A non-wiring manifest ended up in the wiring directory",
+		},
+		Remediation: []string{
+			"Compare kind and apiVersion with the Hedgehog wiring reference",
+			"Check which hhfab version the server runs with `validator health`",
+			"Remove manifests that are not part of the wiring diagram",
+		},
+		patterns: [][]string{
+			{"no kind"},
+			{"unknown kind"},
+			{"no matches for kind"},
+			{"not registered"},
+			{"unsupported apiversion"},
+		},
+	},
+	{
+		ID:          Duplicate,
+		Name:        "duplicate-object",
+		Title:       "Duplicate object",
+		Description: "Two objects of the same kind share a name.",
+		Causes: []string{
+			"The same object is defined in two files of a bundle",
+			"A copied object was not renamed",
+		},
+		Remediation: []string{
+			"Search the bundle for the name in the message, e.g. with `validator diff`",
+			"Give every object of a kind a unique metadata.name",
+		},
+		patterns: [][]string{
+			{"already exists"},
+			{"duplicate"},
+		},
+	},
+	{
+		ID:          PortConflict,
+		Name:        "port-conflict",
+		Title:       "Port conflict",
+		Description: "A switch port is used by more than one connection, or does not exist on the switch profile.",
+		Causes: []string{
+			"Two connections were cabled to the same port",
+			"A port name that does not exist for the switch model",
+			"Breakout ports used without configuring the breakout",
+		},
+		Remediation: []string{
+			"List the connections using the port from the message and keep only one",
+			"Check the port naming of the switch profile",
+		},
+		patterns: [][]string{
+			{"port", "already used"},
+			{"port", "in use"},
+			{"port", "not found"},
+			{"invalid port"},
+		},
+	},
+	{
+		ID:          MissingReference,
+		Name:        "unresolved-reference",
+		Title:       "Reference to a missing object",
+		Description: "An object refers to another object, such as a switch, server or VLAN namespace, that is not defined.",
+		Causes: []string{
+			"The referenced object is defined in a file that was not included",
+			"A typo in the referenced name",
+			"The referenced object was removed or renamed",
+		},
+		Remediation: []string{
+			"Validate all files of the fabric together as one bundle (-w dir/)",
+			"Check the spelling of the referenced name",
+		},
+		patterns: [][]string{
+			{"not found"},
+			{"does not exist"},
+			{"unknown switch"},
+			{"unknown server"},
+		},
+	},
+	{
+		ID:          Overlap,
+		Name:        "overlap",
+		Title:       "Address or range overlap",
+		Description: "IP subnets, VLAN ranges or ASNs of different objects overlap.",
+		Causes: []string{
+			"Two VPCs or namespaces were given the same subnet",
+			"VLAN namespace ranges that intersect",
+			"Reused ASNs",
+		},
+		Remediation: []string{
+			"Pick non-overlapping subnets and ranges",
+			"Check the fabricator config ranges the wiring has to fit into",
+		},
+		patterns: [][]string{
+			{"overlap"},
+			{"conflicts with"},
+		},
+	},
+	{
+		ID:          InvalidFabricator,
+		Name:        "invalid-fabricator-config",
+		Title:       "Invalid fabricator config",
+		Description: "The fabricator config (fab.yaml) is incomplete or inconsistent.",
+		Causes: []string{
+			"Required settings missing from a custom fab.yaml",
+			"A fab.yaml from a different Fabricator release",
+		},
+		Remediation: []string{
+			"Start from the fab.yaml generated by `hhfab init` and apply your changes",
+			"Validate with the wiring only to check whether the defaults work",
+		},
+		patterns: [][]string{
+			{"fabricator"},
+			{"fab.yaml"},
+			{"loading config"},
+		},
+	},
+	{
+		ID:          InvalidName,
+		Name:        "invalid-name",
+		Title:       "Invalid name",
+		Description: "An object name, label or reference to another object is not a valid Kubernetes name, or does not follow the naming conventions of the validation profile. hhfab only fails on it once the objects are applied, if at all.",
+		Causes: []string{
+			"Capitals, underscores or spaces in a name, e.g. Leaf_01",
+			"A switch or server name with a dot or longer than 63 characters, which cannot be a hostname",
+			"A label value longer than 63 characters or starting with a dash",
+			"A name the profile's naming patterns do not allow, e.g. leaf7 where leaf-07 is the convention",
+		},
+		Remediation: []string{
+			"Use lower-case letters, digits and dashes, starting and ending with a letter or digit",
+			"Rename the object after the convention of the profile, and every reference to it",
+		},
+		patterns: [][]string{
+			{"rfc 1123"},
+			{"dns-1123"},
+			{"a valid label must be"},
+		},
+	},
+	{
+		ID:          InvalidField,
+		Name:        "invalid-field",
+		Title:       "Invalid field value",
+		Description: "A field of an object has a value that is out of range or not allowed.",
+		Causes: []string{
+			"A misspelled enum value, e.g. a switch role",
+			"A required field left empty",
+			"A number out of range",
+		},
+		Remediation: []string{
+			"Check the field named in the message against the wiring reference",
+		},
+		patterns: [][]string{
+			{"invalid"},
+			{"must be"},
+			{"required"},
+			{"is not allowed"},
+		},
+	},
+	{
+		// Only reported by the native checks, hhfab does not compare the two
+		ID:          FabricatorMismatch,
+		Name:        "fabricator-mismatch",
+		Title:       "Wiring and fabricator config disagree",
+		Description: "The wiring diagram contradicts the fabricator config, e.g. in the control nodes, VLAN namespaces or fabric mode. hhfab partly accepts this, and the installation fails later.",
+		Causes: []string{
+			"Control nodes added to or removed from only one of the two",
+			"A VLAN namespace referenced in the wiring but not defined",
+			"Spine switches in a collapsed-core fabric, or no spines in a spine-leaf one",
+		},
+		Remediation: []string{
+			"Keep the ControlNode objects of fab.yaml and the control servers of the wiring in sync",
+			"Define every VLAN namespace the switches and VPCs refer to",
+			"Check spec.config.fabric.mode in fab.yaml against the switch roles",
+		},
+	},
+	{
+		ID:          OutOfRange,
+		Name:        "out-of-range",
+		Title:       "Value outside its allocated range",
+		Description: "A VLAN, address or similar value lies outside the range declared for it, e.g. a VPC subnet VLAN outside the ranges of its VLAN namespace.",
+		Causes: []string{
+			"A VLAN picked without checking the namespace ranges",
+			"A namespace range shrunk after values were assigned from it",
+		},
+		Remediation: []string{
+			"Pick a value inside one of the ranges named in the message",
+			"Or extend the range of the namespace",
+		},
+	},
+	{
+		ID:          SubnetTooSmall,
+		Name:        "subnet-too-small",
+		Title:       "Subnet too small",
+		Description: "A subnet has fewer usable addresses than hosts are attached to it. The network and broadcast addresses and the gateway are not usable.",
+		Causes: []string{
+			"More servers attached to a VPC subnet than planned",
+			"A prefix length copied from a different subnet",
+		},
+		Remediation: []string{
+			"Use a shorter prefix, e.g. /24 instead of /28",
+			"Or spread the attachments over several subnets",
+		},
+	},
+	{
+		ID:          Redundancy,
+		Name:        "inconsistent-redundancy",
+		Title:       "Inconsistent redundancy group",
+		Description: "An MCLAG or ESLAG group is incomplete or asymmetric: a member is missing, the MCLAG peer or session links are missing, a multi-homed connection does not use both members alike, or a switch is in two groups.",
+		Causes: []string{
+			"One switch of a pair renamed or removed",
+			"An mclagDomain connection without peer or session links",
+			"A server cabled to only one switch of the pair",
+		},
+		Remediation: []string{
+			"Give both switches of a pair the same spec.redundancy group and type",
+			"Connect MCLAG pairs with an mclagDomain connection holding peer and session links",
+			"Cable multi-homed servers to every member of the group with the same number of links",
+		},
+	},
+	{
+		ID:          Deprecated,
+		Name:        "deprecated-api-version",
+		Title:       "Deprecated API version",
+		Description: "An object uses an API version that is deprecated and will stop being accepted by a future fabric release.",
+		Causes: []string{
+			"Wiring written for an older fabric release",
+			"An example copied from outdated documentation",
+		},
+		Remediation: []string{
+			"Change apiVersion to the version named in the message",
+			"Check the release notes of the fabric for changed fields",
+		},
+	},
+	{
+		ID:          Unused,
+		Name:        "unused-object",
+		Title:       "Unused object",
+		Description: "An object is defined but nothing in the wiring refers to it.",
+		Causes: []string{
+			"A VLAN namespace left over after removing its switches or VPCs",
+			"A typo in the reference that should use the object",
+		},
+		Remediation: []string{
+			"Remove the object, or reference it where it is meant to be used",
+		},
+	},
+	{
+		ID:          SinglePointOfFailure,
+		Name:        "single-point-of-failure",
+		Title:       "Single point of failure",
+		Description: "A server is connected to a single switch, so it loses its connectivity when that switch fails.",
+		Causes: []string{
+			"A lab server cabled with an unbundled or bundled connection only",
+			"The second half of an MCLAG or ESLAG connection missing",
+		},
+		Remediation: []string{
+			"Connect the server to two switches with an mclag or eslag connection",
+			"Ignore the warning where single-homed servers are intended",
+		},
+	},
+	{
+		ID:          MissingDescription,
+		Name:        "missing-description",
+		Title:       "Missing description",
+		Description: "A switch or server has no spec.description, which strict mode requires so operators can tell devices apart.",
+		Causes: []string{
+			"Devices added without documenting their location or purpose",
+		},
+		Remediation: []string{
+			"Set spec.description, e.g. the rack and unit of the device",
+		},
+	},
+	{
+		ID:          HHFabSkipped,
+		Name:        "hhfab-skipped",
+		Title:       "Validated without hhfab",
+		Description: "The server has no hhfab and runs in schema-only mode, so only the CRD schemas and the validator's own checks were applied.",
+		Causes: []string{
+			"hhfab is not installed on the server or hhfab_path is wrong",
+			"schema_only_fallback is enabled in the server configuration",
+		},
+		Remediation: []string{
+			"Install hhfab on the server or fix hhfab_path, see `validator health`",
+			"Validate with --local where hhfab is installed before relying on the result",
+		},
+	},
+	{
+		ID:          Topology,
+		Name:        "topology-invariant",
+		Title:       "Topology does not match the profile",
+		Description: "The fabric has a different mode or number of spines or leaves than the validation profile requires.",
+		Causes: []string{
+			"The wiring was validated with the profile of another environment",
+			"Switches are missing from the bundle or were given the wrong role",
+		},
+		Remediation: []string{
+			"Validate with the profile of the target environment, listed by GET /profiles",
+			"Check the spec.role of the switches and the fabric mode in fab.yaml",
+		},
+	},
+	{
+		ID:          Plugin,
+		Name:        "plugin-finding",
+		Title:       "Finding of a plugin rule",
+		Description: "A custom rule loaded from the server's plugins directory reported a problem, or the plugin itself failed.",
+		Causes: []string{
+			"The wiring breaks a check specific to your organization",
+			"The plugin crashed, ran out of time or memory, or wrote invalid output",
+		},
+		Remediation: []string{
+			"See the message and the documentation of the plugin named in the rule",
+			"Ask the server operator to check the plugin when the message says it failed",
+		},
+	},
+	{
+		ID:          PortMismatch,
+		Name:        "port-mismatch",
+		Title:       "Port speed or breakout mismatch",
+		Description: "The speeds and breakouts configured for switch ports contradict each other or the connections using the ports, which only fails when the switches are provisioned.",
+		Causes: []string{
+			"The two ends of a fabric or MCLAG link set to different speeds",
+			"A connection using a port whole that spec.portBreakouts breaks out, or a breakout port beyond the breakout",
+			"A breakout port set to another speed than its breakout in spec.portSpeeds",
+		},
+		Remediation: []string{
+			"Set both ends of the link to the same speed, or breakouts of the same speed",
+			"Use the breakout ports, e.g. E1/55/1 for a port broken out 4x25G, or remove the breakout",
+		},
+		patterns: [][]string{
+			{"breakout"},
+			{"port", "speed"},
+		},
+	},
+	{
+		ID:          ResourceLimit,
+		Name:        "resource-limit",
+		Title:       "Resource limit exceeded",
+		Description: "hhfab used more memory or processes than the server allows a validation and was stopped, so the files were not fully validated.",
+		Causes: []string{
+			"A very large wiring diagram or fabricator config",
+			"Files built to exhaust the server, e.g. with deeply repeated structures",
+		},
+		Remediation: []string{
+			"Split the wiring into smaller bundles, or validate with ?parallel=true",
+			"Ask the server operator to raise resources.memory_mb or resources.max_pids",
+		},
+	},
+	{
+		ID:          Style,
+		Name:        "yaml-style",
+		Title:       "YAML style",
+		Description: "A line breaks the YAML style checks of the server. hhfab accepts it, but the file is harder to read or means something else to other YAML readers.",
+		Causes: []string{
+			"A mapping indented by another number of spaces than the rest of the files",
+			"A line longer than style.line_length",
+			"A boolean written yes, no, on, off or in capitals, which some YAML readers take for a string",
+			"A key given twice in a mapping, of which only the last counts",
+		},
+		Remediation: []string{
+			"Reindent the file, e.g. with an editor formatting YAML",
+			"Write booleans as true or false",
+			"Remove or merge the duplicate key",
+		},
+	},
+	{
+		ID:          Unclassified,
+		Name:        "unclassified",
+		Title:       "Unclassified error",
+		Description: "hhfab reported a problem this validator has no specific guidance for yet.",
+		Causes: []string{
+			"See the hhfab message for details",
+		},
+		Remediation: []string{
+			"Read the full output with --verbose",
+			"Search the Hedgehog documentation for the message",
+		},
+	},
+}
+
+// Lookup returns the code with the given ID or name, ignoring case.
+func Lookup(id string) (Code, bool) {
+	id = strings.TrimSpace(id)
+	for _, code := range catalog {
+		if strings.EqualFold(code.ID, id) || strings.EqualFold(code.Name, id) {
+			return code, true
+		}
+	}
+	return Code{}, false
+}
+
+// All returns every code sorted by ID.
+func All() []Code {
+	all := append([]Code{}, catalog...)
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
+}
+
+// Classify returns the code of an hhfab message.
+func Classify(message string) string {
+	message = strings.ToLower(message)
+	for _, code := range catalog {
+		for _, pattern := range code.patterns {
+			if matchesAll(message, pattern) {
+				return code.ID
+			}
+		}
+	}
+	return Unclassified
+}
+
+func matchesAll(message string, substrings []string) bool {
+	for _, s := range substrings {
+		if !strings.Contains(message, s) {
+			return false
+		}
+	}
+	return true
+}
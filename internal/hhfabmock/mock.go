@@ -0,0 +1,159 @@
+// Package hhfabmock answers for hhfab with canned results, so that frontend
+// and client developers can run the server without installing it.
+//
+// The mock stands in for hhfab wherever the server runs it: the server runs
+// its own executable with HHFAB_MOCK set, which calls Main. Validations pass
+// unless an upload asks otherwise with a magic comment:
+//
+//	# hh-validator-mock: invalid Connection leaf-01--fabric--spine-01 is not cabled
+//	# hh-validator-mock: warning Switch leaf-01 has no description
+//
+// Invalid uploads fail like hhfab finding an error with the message,
+// warnings pass with it.
+package hhfabmock
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Env marks the process as the mock hhfab.
+const Env = "HHFAB_MOCK"
+
+// Version is what the mock reports for hhfab --version.
+const Version = "v0.0.0-mock"
+
+// Directive starts the magic comments of uploads.
+const Directive = "# hh-validator-mock:"
+
+// fabricator is the fab.yaml written by init.
+const fabricator = `apiVersion: fabricator.githedgehog.com/v1beta1
+kind: Fabricator
+metadata:
+  name: default
+  namespace: fab
+spec:
+  config:
+    fabric:
+      mode: spine-leaf
+`
+
+// wiring is written by every vlab gen, whatever its flags.
+//
+//go:embed fixtures/vlab.generated.yaml
+var wiring []byte
+
+// Invoked reports whether the process stands in for hhfab.
+func Invoked() bool {
+	return os.Getenv(Env) != ""
+}
+
+// Main runs the mock hhfab with args in the working directory and returns
+// its exit code.
+func Main(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "hhfab mock: no command")
+		return 1
+	}
+	var err error
+	switch args[0] {
+	case "--version", "version":
+		fmt.Println("hhfab version " + Version)
+		return 0
+	case "init":
+		err = initDir()
+	case "validate":
+		return validate(os.Stdout)
+	case "vlab":
+		if len(args) > 1 && args[1] == "gen" {
+			err = writeFile(filepath.Join("include", "vlab.generated.yaml"), wiring)
+			break
+		}
+		err = fmt.Errorf("vlab %s is not supported", strings.Join(args[1:], " "))
+	default:
+		err = fmt.Errorf("%s is not supported", args[0])
+	}
+	if err != nil {
+		logLine(os.Stderr, "ERR", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// initDir writes the fab.yaml and include directory of `hhfab init`.
+func initDir() error {
+	if err := os.MkdirAll("include", 0755); err != nil {
+		return err
+	}
+	if err := writeFile("fab.yaml", []byte(fabricator)); err != nil {
+		return err
+	}
+	logLine(os.Stdout, "INF", "Fabricator config and wiring created")
+	return nil
+}
+
+// validate reports the magic comments of fab.yaml and the include
+// directory and fails if any of them says invalid.
+func validate(out io.Writer) int {
+	files, _ := filepath.Glob(filepath.Join("include", "*.yaml"))
+	sort.Strings(files)
+	files = append([]string{"fab.yaml"}, files...)
+
+	code := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			logLine(out, "ERR", err.Error())
+			return 1
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, Directive) {
+				continue
+			}
+			verdict, message, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, Directive)), " ")
+			message = strings.TrimSpace(message)
+			switch verdict {
+			case "invalid":
+				if message == "" {
+					message = "invalid wiring requested by " + file
+				}
+				logLine(out, "ERR", "validating: "+message)
+				code = 1
+			case "warning":
+				if message == "" {
+					message = "warning requested by " + file
+				}
+				logLine(out, "WRN", message)
+			}
+		}
+	}
+	if code == 0 {
+		logLine(out, "INF", "Fabricator config and wiring are valid")
+	}
+	return code
+}
+
+// logLine writes a line the way hhfab logs, such as
+// "06:38:17 ERR validating: ...".
+func logLine(out io.Writer, level, message string) {
+	fmt.Fprintf(out, "%s %s %s\n", time.Now().Format("15:04:05"), level, message)
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
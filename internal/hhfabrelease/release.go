@@ -0,0 +1,258 @@
+// Package hhfabrelease downloads hhfab releases and installs them side by
+// side, one directory per version, so that the server can move to a new
+// hhfab without a new container image. Every download is checked against
+// the SHA-256 checksum it was asked for with, and against a detached
+// ed25519 signature when the source has a public key, before it is
+// installed.
+package hhfabrelease
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Binary is the name of the executable in the directory of a version.
+const Binary = "hhfab"
+
+// maxSize bounds downloads, hhfab is well below it.
+const maxSize = 512 << 20
+
+var versionPattern = regexp.MustCompile(`^v?[0-9][0-9A-Za-z.+-]*$`)
+
+// Release is a version of hhfab and the SHA-256 checksum of its download.
+type Release struct {
+	Version string `yaml:"version" json:"version"`
+	SHA256  string `yaml:"sha256" json:"sha256"`
+}
+
+// ValidVersion reports whether version can name a release directory, such
+// as v0.41.0.
+func ValidVersion(version string) bool {
+	return versionPattern.MatchString(version)
+}
+
+// Validate reports versions that cannot name a directory and checksums
+// that are not 64 hexadecimal digits.
+func (r Release) Validate() error {
+	if !ValidVersion(r.Version) {
+		return fmt.Errorf("invalid hhfab version %q, expected e.g. v0.41.0", r.Version)
+	}
+	if sum, err := hex.DecodeString(r.SHA256); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("hhfab %s: sha256 must be 64 hexadecimal digits", r.Version)
+	}
+	return nil
+}
+
+// Path returns where version is installed in dir.
+func Path(dir, version string) string {
+	return filepath.Join(dir, version, Binary)
+}
+
+// Installed lists the versions installed in dir, sorted.
+func Installed(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, entry := range entries {
+		if _, err := os.Stat(Path(dir, entry.Name())); entry.IsDir() && err == nil {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// Source is where releases are downloaded from. URL and SignatureURL have
+// {version}, {os} and {arch} replaced; downloads ending in .tar.gz or .tgz
+// are archives holding the hhfab binary. Signatures are base64 or raw
+// ed25519 signatures of the download, only checked with a PublicKey.
+type Source struct {
+	URL          string
+	SignatureURL string
+	PublicKey    ed25519.PublicKey
+	Client       *http.Client
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(key string) (ed25519.PublicKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be a base64 ed25519 key of %d bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// Install downloads release, verifies it and installs it in dir, returning
+// its path and whether it was downloaded. A version already installed with
+// the checksum is left alone, one installed with another is replaced.
+func (s Source) Install(ctx context.Context, dir string, release Release) (string, bool, error) {
+	if err := release.Validate(); err != nil {
+		return "", false, err
+	}
+	path := Path(dir, release.Version)
+	if sum, err := installedSum(dir, release.Version); err == nil && sum == strings.ToLower(release.SHA256) {
+		return path, false, nil
+	}
+
+	data, err := s.get(ctx, s.URL, release.Version)
+	if err != nil {
+		return "", false, fmt.Errorf("downloading hhfab %s: %w", release.Version, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != strings.ToLower(release.SHA256) {
+		return "", false, fmt.Errorf("hhfab %s: checksum mismatch, expected %s, downloaded %s", release.Version, release.SHA256, got)
+	}
+	if s.PublicKey != nil {
+		if err := s.verify(ctx, release.Version, data); err != nil {
+			return "", false, fmt.Errorf("hhfab %s: %w", release.Version, err)
+		}
+	}
+
+	binary := data
+	if url := s.expand(s.URL, release.Version); strings.HasSuffix(url, ".tar.gz") || strings.HasSuffix(url, ".tgz") {
+		if binary, err = extract(data); err != nil {
+			return "", false, fmt.Errorf("hhfab %s: %w", release.Version, err)
+		}
+	}
+	if err := install(dir, release, data, binary); err != nil {
+		return "", false, fmt.Errorf("installing hhfab %s: %w", release.Version, err)
+	}
+	return path, true, nil
+}
+
+// verify checks the detached signature of a download.
+func (s Source) verify(ctx context.Context, version string, data []byte) error {
+	if s.SignatureURL == "" {
+		return errors.New("a public key is set without a signature_url")
+	}
+	signature, err := s.get(ctx, s.SignatureURL, version)
+	if err != nil {
+		return fmt.Errorf("downloading signature: %w", err)
+	}
+	if len(signature) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return errors.New("signature is neither raw nor base64 ed25519")
+		}
+		signature = decoded
+	}
+	if !ed25519.Verify(s.PublicKey, data, signature) {
+		return errors.New("signature does not match the public key")
+	}
+	return nil
+}
+
+func (s Source) expand(url, version string) string {
+	return strings.NewReplacer("{version}", version, "{os}", runtime.GOOS, "{arch}", runtime.GOARCH).Replace(url)
+}
+
+// get downloads the URL template for version.
+func (s Source) get(ctx context.Context, url, version string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.expand(url, version), nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", req.URL.Redacted(), resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("%s is larger than %d MiB", req.URL.Redacted(), maxSize>>20)
+	}
+	return data, nil
+}
+
+// extract returns the hhfab binary of a gzipped tar archive.
+func extract(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("the archive holds no %s", Binary)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == Binary {
+			return io.ReadAll(io.LimitReader(archive, maxSize))
+		}
+	}
+}
+
+// install writes the binary and then the checksum of its download to the
+// directory of the version, replacing an earlier install atomically.
+func install(dir string, release Release, download, binary []byte) error {
+	versionDir := filepath.Join(dir, release.Version)
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(versionDir, "."+Binary+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0755); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), Path(dir, release.Version)); err != nil {
+		return err
+	}
+	// Without the checksum the version is downloaded again next time
+	sum := sha256.Sum256(download)
+	return os.WriteFile(filepath.Join(versionDir, Binary+".sha256"), []byte(hex.EncodeToString(sum[:])+"\n"), 0644)
+}
+
+// installedSum returns the checksum of the download version was installed
+// from.
+func installedSum(dir, version string) (string, error) {
+	if _, err := os.Stat(Path(dir, version)); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, version, Binary+".sha256"))
+	return strings.TrimSpace(string(data)), err
+}
@@ -0,0 +1,246 @@
+// Package hhfabtape records the runs of hhfab and replays them, so that the
+// server can be tested end to end, workspaces, resource limits and output
+// parsing included, on machines without the binary.
+//
+// The recorder stands in for hhfab wherever the server runs it: a binary
+// named hhfab calling Main while HHFAB_TAPE names the tape, such as the
+// validator CLI linked to that name. With HHFAB_TAPE_RECORD naming the real
+// hhfab each run is passed through and appended to the tape; without it the
+// run recorded with the same arguments and the same files in the working
+// directory is played back.
+package hhfabtape
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The environment of the recorder.
+const (
+	// TapeEnv names the tape runs are recorded to and replayed from
+	TapeEnv = "HHFAB_TAPE"
+	// RecordEnv names the real hhfab while recording
+	RecordEnv = "HHFAB_TAPE_RECORD"
+)
+
+// MismatchExitCode is the exit code of replays finding no recorded run, and
+// of the recorder failing.
+const MismatchExitCode = 125
+
+// Run is a recorded run of hhfab.
+type Run struct {
+	Args []string `json:"args"`
+	// Dir maps the files of the working directory before the run to their
+	// SHA-256, empty for runs with flags only, such as --version, which do
+	// not look at it
+	Dir map[string]string `json:"dir,omitempty"`
+	// Stdout and Stderr are replayed in this order
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Files are the files the run created or changed and Removed those it
+	// removed, by their path in the working directory
+	Files   map[string][]byte `json:"files,omitempty"`
+	Removed []string          `json:"removed,omitempty"`
+}
+
+// Invoked reports whether the process stands in for hhfab: it is named
+// hhfab and HHFAB_TAPE is set.
+func Invoked() bool {
+	return os.Getenv(TapeEnv) != "" && filepath.Base(os.Args[0]) == "hhfab"
+}
+
+// Main records or replays a run of hhfab with args, as HHFAB_TAPE_RECORD
+// says, and returns the exit code of hhfab.
+func Main(args []string) int {
+	tape := os.Getenv(TapeEnv)
+	if hhfab := os.Getenv(RecordEnv); hhfab != "" {
+		return record(tape, hhfab, args)
+	}
+	return replay(tape, args)
+}
+
+// Load reads the runs of a tape, one JSON document per line.
+func Load(tape string) ([]Run, error) {
+	data, err := os.ReadFile(tape)
+	if err != nil {
+		return nil, err
+	}
+	runs := []Run{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", tape, line, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+// record runs hhfab with args in the working directory, passing its output
+// through, and appends the run to the tape. Runs are appended with a single
+// write each, so that the concurrent runs of a server do not interleave.
+func record(tape, hhfab string, args []string) int {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fail(err)
+	}
+	before, err := snapshot(dir, args)
+	if err != nil {
+		return fail(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(hhfab, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = io.MultiWriter(os.Stdout, &stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return fail(err)
+	}
+
+	run := Run{Args: args, Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: cmd.ProcessState.ExitCode()}
+	if before != nil {
+		after, err := snapshot(dir, args)
+		if err != nil {
+			return fail(err)
+		}
+		run.Dir = digests(before)
+		for path, data := range after {
+			if old, ok := before[path]; !ok || !bytes.Equal(old, data) {
+				if run.Files == nil {
+					run.Files = map[string][]byte{}
+				}
+				run.Files[path] = data
+			}
+		}
+		for path := range before {
+			if _, ok := after[path]; !ok {
+				run.Removed = append(run.Removed, path)
+			}
+		}
+		sort.Strings(run.Removed)
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return fail(err)
+	}
+	file, err := os.OpenFile(tape, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fail(err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fail(err)
+	}
+	return run.ExitCode
+}
+
+// replay plays the run of the tape with args and the files of the working
+// directory back: it writes the files the run left, prints its output and
+// returns its exit code. Without such a run it fails with
+// MismatchExitCode.
+func replay(tape string, args []string) int {
+	runs, err := Load(tape)
+	if err != nil {
+		return fail(err)
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return fail(err)
+	}
+	files, err := snapshot(dir, args)
+	if err != nil {
+		return fail(err)
+	}
+	current := digests(files)
+	for _, run := range runs {
+		if !slices.Equal(run.Args, args) || !maps.Equal(run.Dir, current) {
+			continue
+		}
+		for path, data := range run.Files {
+			target := filepath.Join(dir, filepath.FromSlash(path))
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fail(err)
+			}
+			if err := os.WriteFile(target, data, 0644); err != nil {
+				return fail(err)
+			}
+		}
+		for _, path := range run.Removed {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(path))); err != nil && !os.IsNotExist(err) {
+				return fail(err)
+			}
+		}
+		os.Stdout.WriteString(run.Stdout)
+		os.Stderr.WriteString(run.Stderr)
+		return run.ExitCode
+	}
+	fmt.Fprintf(os.Stderr, "hhfabtape: no run of hhfab %s with these files is recorded in %s\n", strings.Join(args, " "), tape)
+	return MismatchExitCode
+}
+
+// snapshot reads the regular files below dir by their slash-separated
+// path, nil for runs with flags only.
+func snapshot(dir string, args []string) (map[string][]byte, error) {
+	if !slices.ContainsFunc(args, func(arg string) bool { return !strings.HasPrefix(arg, "-") }) {
+		return nil, nil
+	}
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return files, err
+}
+
+// digests maps files to the SHA-256 of their data, nil for nil.
+func digests(files map[string][]byte) map[string]string {
+	if files == nil {
+		return nil
+	}
+	digests := make(map[string]string, len(files))
+	for path, data := range files {
+		sum := sha256.Sum256(data)
+		digests[path] = hex.EncodeToString(sum[:])
+	}
+	return digests
+}
+
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "hhfabtape: %v\n", err)
+	return MismatchExitCode
+}
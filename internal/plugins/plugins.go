@@ -0,0 +1,263 @@
+// Package plugins runs custom rules compiled to WebAssembly. A plugin is a
+// WASI command: it reads the objects of a bundle as JSON from stdin and
+// writes its findings as JSON to stdout, so it can be written in any language
+// targeting wasip1 and never sees more than the uploaded objects.
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"validator/internal/codes"
+	"validator/internal/rules"
+	"validator/internal/wiring"
+)
+
+// memoryLimitPages caps the memory of a plugin run at 256 MiB.
+const memoryLimitPages = 4096
+
+// cache keeps the machine code of compiled plugins across runs and reloads.
+var cache = wazero.NewCompilationCache()
+
+// Input is what a plugin reads from stdin.
+type Input struct {
+	Objects []InputObject `json:"objects"`
+}
+
+// InputObject is an object of the bundle with its document as parsed.
+type InputObject struct {
+	// Key identifies the object in findings, e.g. Switch/leaf-01
+	Key      string         `json:"key"`
+	File     string         `json:"file"`
+	Line     int            `json:"line"`
+	Document map[string]any `json:"document"`
+}
+
+// Output is what a plugin writes to stdout.
+type Output struct {
+	Findings []OutputFinding `json:"findings"`
+}
+
+// OutputFinding is a finding of a plugin. Object and Path, a dotted path
+// such as spec.boot.serial, locate it; Severity defaults to error and Code to
+// HHV019.
+type OutputFinding struct {
+	Object   string `json:"object,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Plugin is a compiled plugin, named after its file.
+type Plugin struct {
+	Name string
+	Path string
+	wasm []byte
+}
+
+// Set holds the plugins of a directory in name order.
+type Set struct {
+	plugins []*Plugin
+}
+
+// Load compiles every *.wasm file in dir. An empty dir loads no plugins.
+func Load(ctx context.Context, dir string) (*Set, error) {
+	set := &Set{}
+	if dir == "" {
+		return set, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading plugins: %w", err)
+	}
+	for _, entry := range entries {
+		// Skip directories and the ..data style entries of mounted volumes
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".wasm" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		wasm, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading plugin %s: %w", entry.Name(), err)
+		}
+		plugin := &Plugin{Name: strings.TrimSuffix(entry.Name(), ".wasm"), Path: path, wasm: wasm}
+		if err := plugin.compile(ctx); err != nil {
+			return nil, fmt.Errorf("compiling plugin %s: %w", entry.Name(), err)
+		}
+		set.plugins = append(set.plugins, plugin)
+	}
+	sort.Slice(set.plugins, func(i, j int) bool { return set.plugins[i].Name < set.plugins[j].Name })
+	return set, nil
+}
+
+// Names returns the names of the plugins in the order they run.
+func (s *Set) Names() []string {
+	names := []string{}
+	for _, plugin := range s.plugins {
+		names = append(names, plugin.Name)
+	}
+	return names
+}
+
+// Check runs every plugin over the objects and returns their findings in
+// plugin order, with the plugin as rule. A plugin that fails reports an error
+// finding instead of passing silently.
+func (s *Set) Check(ctx context.Context, objects []*wiring.Object) []rules.Finding {
+	findings := []rules.Finding{}
+	if len(s.plugins) == 0 {
+		return findings
+	}
+
+	input, err := encodeInput(objects)
+	for _, plugin := range s.plugins {
+		var output *Output
+		runErr := err
+		if runErr == nil {
+			output, runErr = plugin.run(ctx, input)
+		}
+		if runErr != nil {
+			findings = append(findings, rules.Finding{
+				Rule:     plugin.Name,
+				Code:     codes.Plugin,
+				Severity: rules.SeverityError,
+				Message:  fmt.Sprintf("plugin %s failed: %v", plugin.Name, runErr),
+			})
+			continue
+		}
+		findings = append(findings, plugin.findings(output, objects)...)
+	}
+	return findings
+}
+
+// newRuntime returns a runtime sharing the compilation cache, closing
+// plugins still running when ctx is done.
+func newRuntime(ctx context.Context) wazero.Runtime {
+	config := wazero.NewRuntimeConfig().
+		WithCompilationCache(cache).
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(memoryLimitPages)
+	return wazero.NewRuntimeWithConfig(ctx, config)
+}
+
+func (p *Plugin) compile(ctx context.Context) error {
+	runtime := newRuntime(ctx)
+	defer runtime.Close(ctx)
+	_, err := runtime.CompileModule(ctx, p.wasm)
+	return err
+}
+
+// run instantiates the plugin in a runtime of its own, so no state is kept
+// between validations, and decodes what it writes to stdout.
+func (p *Plugin) run(ctx context.Context, input []byte) (*Output, error) {
+	runtime := newRuntime(ctx)
+	defer runtime.Close(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+
+	compiled, err := runtime.CompileModule(ctx, p.wasm)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	config := wazero.NewModuleConfig().
+		WithName(p.Name).
+		WithArgs(p.Name).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(&stdout).
+		WithStderr(&stderr)
+	if _, err := runtime.InstantiateModule(ctx, compiled, config); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+
+	output := &Output{}
+	if err := json.Unmarshal(stdout.Bytes(), output); err != nil {
+		return nil, fmt.Errorf("decoding output: %w", err)
+	}
+	return output, nil
+}
+
+// findings converts the output of the plugin, locating findings at the
+// field of their object.
+func (p *Plugin) findings(output *Output, objects []*wiring.Object) []rules.Finding {
+	byKey := map[string]*wiring.Object{}
+	for _, object := range objects {
+		byKey[object.Key()] = object
+	}
+
+	findings := []rules.Finding{}
+	for _, out := range output.Findings {
+		finding := rules.Finding{
+			Rule:     p.Name,
+			Code:     out.Code,
+			Severity: out.Severity,
+			Message:  out.Message,
+		}
+		if finding.Code == "" {
+			finding.Code = codes.Plugin
+		}
+		if finding.Severity != rules.SeverityWarning {
+			finding.Severity = rules.SeverityError
+		}
+		if object := byKey[out.Object]; object != nil {
+			finding.Object, finding.File, finding.Line = object.Key(), object.File, object.Line
+			finding.Message = object.Key() + ": " + out.Message
+			if line := fieldLine(object, out.Path); line > 0 {
+				finding.Line, finding.Path = line, out.Path
+			}
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// fieldLine returns the line of the field at path, the first line of its
+// leaves for mappings and sequences, or 0 if the object has no such field.
+func fieldLine(object *wiring.Object, path string) int {
+	line := 0
+	if path == "" {
+		return line
+	}
+	for _, field := range wiring.Flatten(object.Node) {
+		if field.Path != path && !strings.HasPrefix(field.Path, path+".") && !strings.HasPrefix(field.Path, path+"[") {
+			continue
+		}
+		if line == 0 || field.Line < line {
+			line = field.Line
+		}
+	}
+	return line
+}
+
+func encodeInput(objects []*wiring.Object) ([]byte, error) {
+	input := Input{Objects: []InputObject{}}
+	for _, object := range objects {
+		document := map[string]any{}
+		if err := object.Node.Decode(&document); err != nil {
+			return nil, fmt.Errorf("encoding %s: %w", object.Key(), err)
+		}
+		input.Objects = append(input.Objects, InputObject{
+			Key:      object.Key(),
+			File:     object.File,
+			Line:     object.Line,
+			Document: document,
+		})
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("encoding objects: %w", err)
+	}
+	return data, nil
+}
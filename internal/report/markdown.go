@@ -0,0 +1,244 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"validator/pkg/api"
+)
+
+// maxOutputLines bounds the hhfab output quoted in Markdown, keeping its last
+// lines, since comments are limited to 65536 characters on GitHub.
+const maxOutputLines = 200
+
+var markdownEmoji = map[string]string{
+	StatusPassed:  "✅",
+	StatusFailed:  "❌",
+	StatusError:   "⚠️",
+	StatusSkipped: "⏭️",
+}
+
+// markdownVerbs complete the titles of validations.
+var markdownVerbs = map[string]string{
+	StatusPassed:  "passed",
+	StatusFailed:  "failed",
+	StatusError:   "could not run",
+	StatusSkipped: "was skipped",
+}
+
+// WriteMarkdown renders the results of validations as Markdown for GitHub and
+// GitLab comments: the status, a table of counts, the diagnostics, the
+// objects that did not pass and the hhfab output, collapsed. Several inputs,
+// e.g. of a batch, are listed in one table, with the details of those that
+// did not pass below it.
+func WriteMarkdown(w io.Writer, inputs ...Input) error {
+	out := bufio.NewWriter(w)
+	if len(inputs) == 1 {
+		status := inputs[0].Status()
+		fmt.Fprintf(out, "### %s Wiring validation %s\n\n", markdownEmoji[status], markdownVerbs[status])
+		writeMarkdownValidation(out, inputs[0])
+		return out.Flush()
+	}
+
+	status, verb, counts := StatusPassed, "passed", map[string]int{}
+	for _, input := range inputs {
+		counts[input.Status()]++
+	}
+	switch {
+	case counts[StatusError] > 0:
+		status, verb = StatusError, "had errors"
+	case counts[StatusFailed] > 0:
+		status, verb = StatusFailed, "failed"
+	}
+	fmt.Fprintf(out, "### %s Wiring validation of %d files %s\n\n", markdownEmoji[status], len(inputs), verb)
+	fmt.Fprintf(out, "%d passed, %d failed, %d errors, %d skipped\n\n", counts[StatusPassed], counts[StatusFailed], counts[StatusError], counts[StatusSkipped])
+
+	fmt.Fprintln(out, "| | File | Use case | Errors | Warnings | Duration |")
+	fmt.Fprintln(out, "|---|---|---|---:|---:|---:|")
+	for _, input := range inputs {
+		response := input.response()
+		errors, warnings, duration := "-", "-", "-"
+		if summary := response.Summary; summary != nil {
+			errors, warnings, duration = fmt.Sprint(summary.Errors), fmt.Sprint(summary.Warnings), fmt.Sprintf("%d ms", summary.DurationMs)
+		}
+		fmt.Fprintf(out, "| %s | %s | %s | %s | %s | %s |\n", markdownEmoji[input.Status()], markdownCode(input.name()),
+			markdownText(response.UseCase), errors, warnings, duration)
+	}
+
+	for _, input := range inputs {
+		if status := input.Status(); status == StatusFailed || status == StatusError {
+			fmt.Fprintf(out, "\n<details>\n<summary>%s %s %s</summary>\n\n", markdownEmoji[status], markdownText(input.name()), markdownVerbs[status])
+			writeMarkdownValidation(out, input)
+			fmt.Fprintln(out, "\n</details>")
+		}
+	}
+	return out.Flush()
+}
+
+// writeMarkdownValidation writes the details of one validation.
+func writeMarkdownValidation(out io.Writer, input Input) {
+	response := input.response()
+
+	facts := []string{}
+	if name := input.name(); name != "" {
+		facts = append(facts, "**Files** "+markdownCode(name))
+	}
+	if response.UseCase != "" {
+		facts = append(facts, "**Use case** "+response.UseCase)
+	}
+	if response.Profile != "" {
+		facts = append(facts, "**Profile** "+markdownCode(response.Profile))
+	}
+	if response.Mode != "" {
+		facts = append(facts, "**Mode** "+response.Mode)
+	}
+	if len(facts) > 0 {
+		fmt.Fprintf(out, "%s\n\n", strings.Join(facts, " · "))
+	}
+
+	if summary := response.Summary; summary != nil {
+		fmt.Fprintln(out, "| Errors | Warnings | Suppressed | Baselined | Objects | Duration |")
+		fmt.Fprintln(out, "|---:|---:|---:|---:|---:|---:|")
+		fmt.Fprintf(out, "| %d | %d | %d | %d | %d | %d ms |\n\n", summary.Errors, summary.Warnings, summary.Suppressed, summary.Baselined, summary.Objects, summary.DurationMs)
+	}
+
+	switch {
+	case response.Error != "":
+		fmt.Fprintf(out, "%s\n\n%s\n", markdownText(response.Message), markdownFence(response.Error))
+	case input.Status() == StatusFailed && len(response.Diagnostics) == 0:
+		// Older servers only point at the problem in the message
+		fmt.Fprintln(out, markdownFence(response.Message))
+	}
+
+	errors, warnings := []api.Diagnostic{}, []api.Diagnostic{}
+	for _, d := range response.Diagnostics {
+		if d.Severity == api.SeverityWarning {
+			warnings = append(warnings, d)
+		} else {
+			errors = append(errors, d)
+		}
+	}
+	writeMarkdownDiagnostics(out, "Errors", "❌", errors)
+	writeMarkdownDiagnostics(out, "Warnings", "⚠️", warnings)
+
+	acknowledged := append(append([]api.Diagnostic{}, response.Suppressed...), response.Baselined...)
+	if len(acknowledged) > 0 {
+		fmt.Fprintf(out, "<details>\n<summary>%d suppressed and %d baselined findings</summary>\n\n", len(response.Suppressed), len(response.Baselined))
+		for _, d := range acknowledged {
+			fmt.Fprintln(out, markdownDiagnostic("➖", d))
+		}
+		fmt.Fprint(out, "\n</details>\n\n")
+	}
+
+	counts := map[string]int{}
+	notPassed := []api.ObjectResult{}
+	for _, object := range response.Objects {
+		counts[object.Status]++
+		if object.Status != api.ObjectPassed {
+			notPassed = append(notPassed, object)
+		}
+	}
+	if len(response.Objects) > 0 {
+		fmt.Fprintf(out, "<details>\n<summary>Objects: %d passed, %d failed, %d with warnings, %d unknown</summary>\n\n",
+			counts[api.ObjectPassed], counts[api.ObjectFailed], counts[api.ObjectWarning], counts[api.ObjectUnknown])
+		if len(notPassed) > 0 {
+			fmt.Fprintln(out, "| Status | Object | Location | Messages |")
+			fmt.Fprintln(out, "|---|---|---|---|")
+			for _, object := range notPassed {
+				name := object.Kind + "/" + object.Name
+				if object.Namespace != "" {
+					name = object.Kind + "/" + object.Namespace + "/" + object.Name
+				}
+				messages := []string{}
+				for _, message := range object.Messages {
+					messages = append(messages, markdownText(message))
+				}
+				fmt.Fprintf(out, "| %s | %s | %s | %s |\n", object.Status, markdownCode(name),
+					markdownCode(fmt.Sprintf("%s:%d", object.File, object.Line)), strings.Join(messages, "<br>"))
+			}
+			fmt.Fprintln(out)
+		}
+		fmt.Fprint(out, "</details>\n\n")
+	}
+
+	if response.Output != "" {
+		fmt.Fprintf(out, "<details>\n<summary>hhfab output</summary>\n\n%s\n</details>\n", markdownFence(tailLines(response.Output, maxOutputLines)))
+	}
+	if response.ResultURL != "" {
+		fmt.Fprintf(out, "\n[Full result](%s)\n", response.ResultURL)
+	}
+}
+
+func writeMarkdownDiagnostics(out io.Writer, title, emoji string, diagnostics []api.Diagnostic) {
+	if len(diagnostics) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "**%s**\n\n", title)
+	for _, d := range diagnostics {
+		fmt.Fprintln(out, markdownDiagnostic(emoji, d))
+	}
+	fmt.Fprintln(out)
+}
+
+// markdownDiagnostic renders a diagnostic as a list item.
+func markdownDiagnostic(emoji string, d api.Diagnostic) string {
+	item := "- " + emoji
+	if d.Code != "" {
+		item += " **" + d.Code + "**"
+	}
+	if d.File != "" {
+		location := d.File
+		if d.Line > 0 {
+			location += fmt.Sprintf(":%d", d.Line)
+		}
+		item += " " + markdownCode(location)
+	}
+	item += " " + markdownText(d.Message)
+	if d.Reason != "" {
+		item += " _(" + markdownText(d.Reason) + ")_"
+	}
+	return item
+}
+
+var markdownEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;",
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "|", `\|`,
+	"\r\n", " ", "\n", " ",
+)
+
+// markdownText escapes s for inline text, including table cells, on one line.
+func markdownText(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// markdownCode renders s as inline code. Backticks and pipes cannot be
+// escaped inside code spans, they are replaced instead.
+func markdownCode(s string) string {
+	s = strings.NewReplacer("`", "'", "|", "¦", "\n", " ").Replace(s)
+	if s == "" {
+		return ""
+	}
+	return "`" + s + "`"
+}
+
+// markdownFence renders s as a code block, fenced with more backticks than
+// any run of them in s.
+func markdownFence(s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + strings.TrimRight(s, "\n") + "\n" + fence + "\n"
+}
+
+// tailLines returns the last n lines of s, noting how many were left out.
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) <= n {
+		return s
+	}
+	omitted := len(lines) - n
+	return fmt.Sprintf("... %d earlier lines omitted\n%s", omitted, strings.Join(lines[omitted:], "\n"))
+}
@@ -0,0 +1,229 @@
+// Package report renders validation results for people: standalone HTML
+// documents with the summary, the results of the objects, the diagnostics
+// with the source lines they point at and the topology graph, to attach to
+// design reviews, and Markdown for pull request comments.
+package report
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"validator/internal/topology"
+	"validator/internal/wiring"
+	"validator/pkg/api"
+)
+
+// sourceContext is the number of lines shown around the offending one.
+const sourceContext = 2
+
+//go:embed report.html
+var reportTemplate string
+
+var tmpl = template.Must(template.New("report").Parse(reportTemplate))
+
+// File is an uploaded file, named as uploaded.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Input is what a report is made of: the result of a validation and the
+// files that were validated.
+type Input struct {
+	// Name names the validation in reports of several, the names of the
+	// files by default
+	Name     string
+	Response *api.ValidateResponse
+	// Err is the error that kept the validation from returning a result.
+	// Validations without a Response or Err were skipped.
+	Err error
+	// Wiring are the wiring files; the graph is drawn from those that parse.
+	// Files without Data, e.g. of recorded results, are only named.
+	Wiring []File
+	// Fab is the fab.yaml, if one was uploaded
+	Fab *File
+	// Generated is when the report was made, shown in its header
+	Generated time.Time
+}
+
+// Statuses of validations.
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusError   = "error"
+	StatusSkipped = "skipped"
+)
+
+// Status returns the status of the validation.
+func (input Input) Status() string {
+	switch {
+	case input.Err != nil:
+		return StatusError
+	case input.Response == nil:
+		return StatusSkipped
+	case input.Response.Success:
+		return StatusPassed
+	}
+	return StatusFailed
+}
+
+// name returns the name of the validation.
+func (input Input) name() string {
+	if input.Name != "" {
+		return input.Name
+	}
+	names := []string{}
+	for _, file := range input.Wiring {
+		names = append(names, file.Name)
+	}
+	name := strings.Join(names, ", ")
+	if input.Fab != nil {
+		name += " + " + input.Fab.Name
+	}
+	return name
+}
+
+// response returns the response of the validation, standing in for the one
+// an error or skip left it without.
+func (input Input) response() *api.ValidateResponse {
+	switch {
+	case input.Err != nil && input.Response != nil:
+		response := *input.Response
+		response.Error = input.Err.Error()
+		if response.Message == "" {
+			response.Message = "Validation could not run"
+		}
+		return &response
+	case input.Err != nil:
+		return &api.ValidateResponse{Message: "Validation could not run", Error: input.Err.Error()}
+	case input.Response == nil:
+		return &api.ValidateResponse{Message: "Validation skipped"}
+	}
+	return input.Response
+}
+
+// WriteHTML renders the report of input.
+func WriteHTML(w io.Writer, input Input) error {
+	data, err := newPage(input)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
+}
+
+// page is the data of the template.
+type page struct {
+	*api.ValidateResponse
+	Status    string
+	Generated string
+	Files     []string
+	Errors    []diagnostic
+	Warnings  []diagnostic
+	// Acknowledged are the suppressed and baselined diagnostics
+	Acknowledged []diagnostic
+	Graph        template.HTML
+	// GraphError tells why there is no graph
+	GraphError string
+}
+
+// diagnostic is a diagnostic with the lines of its file around it.
+type diagnostic struct {
+	api.Diagnostic
+	// Note is why an acknowledged diagnostic did not count
+	Note    string
+	Excerpt []line
+}
+
+type line struct {
+	Number    int
+	Text      string
+	Offending bool
+}
+
+func newPage(input Input) (*page, error) {
+	response := input.response()
+	p := &page{
+		ValidateResponse: response,
+		Status:           input.Status(),
+		Generated:        input.Generated.UTC().Format(time.RFC3339),
+	}
+
+	sources := map[string][]string{}
+	files := append([]File{}, input.Wiring...)
+	if input.Fab != nil {
+		files = append(files, *input.Fab)
+	}
+	for _, file := range files {
+		p.Files = append(p.Files, file.Name)
+		if _, ok := sources[file.Name]; !ok {
+			sources[file.Name] = splitLines(file.Data)
+		}
+	}
+
+	for _, d := range response.Diagnostics {
+		if d.Severity == api.SeverityWarning {
+			p.Warnings = append(p.Warnings, withExcerpt(d, sources, ""))
+		} else {
+			p.Errors = append(p.Errors, withExcerpt(d, sources, ""))
+		}
+	}
+	for _, d := range response.Suppressed {
+		p.Acknowledged = append(p.Acknowledged, withExcerpt(d, sources, "suppressed"))
+	}
+	for _, d := range response.Baselined {
+		p.Acknowledged = append(p.Acknowledged, withExcerpt(d, sources, "baselined"))
+	}
+
+	objects := []*wiring.Object{}
+	for _, file := range input.Wiring {
+		if file.Data == nil {
+			p.GraphError = "the wiring files are not kept with the result"
+			break
+		}
+		parsed, err := wiring.Parse(file.Data, file.Name)
+		if err != nil {
+			p.GraphError = err.Error()
+			break
+		}
+		objects = append(objects, parsed...)
+	}
+	if p.GraphError == "" {
+		var graph bytes.Buffer
+		if err := topology.Write(&graph, topology.Build(objects), topology.FormatSVG); err != nil {
+			return nil, err
+		}
+		// The SVG writer escapes every name it draws
+		p.Graph = template.HTML(graph.String())
+	}
+	return p, nil
+}
+
+// withExcerpt quotes the lines around the line d points at, if its file is
+// one of sources.
+func withExcerpt(d api.Diagnostic, sources map[string][]string, note string) diagnostic {
+	result := diagnostic{Diagnostic: d, Note: note}
+	lines := sources[d.File]
+	if d.Line <= 0 || d.Line > len(lines) {
+		return result
+	}
+	first, last := max(d.Line-sourceContext, 1), min(d.Line+sourceContext, len(lines))
+	for n := first; n <= last; n++ {
+		result.Excerpt = append(result.Excerpt, line{Number: n, Text: lines[n-1], Offending: n == d.Line})
+	}
+	return result
+}
+
+func splitLines(data []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.ReplaceAll(scanner.Text(), "\t", "    "))
+	}
+	return lines
+}
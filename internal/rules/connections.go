@@ -0,0 +1,50 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// checkConnectionEndpoints reports Connection ports, written device/port,
+// whose device is not a Switch or Server of the bundle, or that are not
+// written that way at all.
+func checkConnectionEndpoints(objects []*wiring.Object) []Finding {
+	defined := map[string]bool{}
+	for _, object := range objects {
+		defined[object.Kind+"/"+object.Name] = true
+	}
+
+	findings := []Finding{}
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		for _, endpoint := range wiring.Endpoints(object) {
+			var code, message string
+			switch {
+			case !endpoint.Valid():
+				code = codes.InvalidField
+				message = fmt.Sprintf("%s: %s is %q, expected <%s>/<port>",
+					object.Key(), endpoint.Path, endpoint.Value, strings.ToLower(endpoint.Kind))
+			case !defined[endpoint.Kind+"/"+endpoint.Device]:
+				code = codes.MissingReference
+				message = fmt.Sprintf("%s: %s refers to %s/%s, which is not defined",
+					object.Key(), endpoint.Path, endpoint.Kind, endpoint.Device)
+			default:
+				continue
+			}
+			findings = append(findings, Finding{
+				Code:    code,
+				Message: message,
+				Object:  object.Key(),
+				File:    object.File,
+				Line:    endpoint.Line,
+				Path:    endpoint.Path,
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// Fabric modes of spec.config.fabric.mode in fab.yaml.
+const (
+	modeSpineLeaf     = "spine-leaf"
+	modeCollapsedCore = "collapsed-core"
+)
+
+// fabricator returns the Fabricator object of the bundle, nil if no fab.yaml
+// is part of it. The cross-consistency rules only run with one.
+func fabricator(objects []*wiring.Object) *wiring.Object {
+	for _, object := range objects {
+		if object.Kind == "Fabricator" {
+			return object
+		}
+	}
+	return nil
+}
+
+// mismatch reports a field of object contradicting the other side.
+func mismatch(object *wiring.Object, path []string, format string, args ...any) Finding {
+	finding := Finding{
+		Code:    codes.FabricatorMismatch,
+		Message: object.Key() + ": " + fmt.Sprintf(format, args...),
+		Object:  object.Key(),
+		File:    object.File,
+		Line:    object.Line,
+	}
+	if node := wiring.Lookup(object.Node, path...); node != nil {
+		finding.Line = node.Line
+		finding.Path = strings.Join(path, ".")
+	}
+	return finding
+}
+
+// checkControlNodes reports control nodes that only the fab.yaml or only the
+// wiring has. Wiring without control servers is not compared, recent wiring
+// does not list them.
+func checkControlNodes(objects []*wiring.Object) []Finding {
+	if fabricator(objects) == nil {
+		return nil
+	}
+
+	controlNodes := map[string]*wiring.Object{}
+	controlServers := map[string]*wiring.Object{}
+	for _, object := range objects {
+		switch {
+		case object.Kind == "ControlNode":
+			controlNodes[object.Name] = object
+		case object.Kind == "Server" && wiring.Scalar(object.Node, "spec", "type") == "control":
+			controlServers[object.Name] = object
+		}
+	}
+	if len(controlServers) == 0 {
+		return nil
+	}
+
+	findings := []Finding{}
+	for _, name := range sortedKeys(controlServers) {
+		if controlNodes[name] == nil {
+			findings = append(findings, mismatch(controlServers[name], []string{"spec", "type"},
+				"control server has no ControlNode in the fabricator config (fab.yaml has %d control nodes, the wiring %d control servers)",
+				len(controlNodes), len(controlServers)))
+		}
+	}
+	for _, name := range sortedKeys(controlNodes) {
+		if controlServers[name] == nil {
+			findings = append(findings, mismatch(controlNodes[name], []string{"metadata", "name"},
+				"control node is not a control server of the wiring (fab.yaml has %d control nodes, the wiring %d control servers)",
+				len(controlNodes), len(controlServers)))
+		}
+	}
+	return findings
+}
+
+// checkVLANNamespaces reports switches and VPCs referring to VLAN namespaces
+// defined neither in the wiring nor in the fab.yaml. hhfab always creates the
+// default namespace.
+func checkVLANNamespaces(objects []*wiring.Object) []Finding {
+	if fabricator(objects) == nil {
+		return nil
+	}
+
+	defined := map[string]bool{"default": true}
+	for _, object := range objects {
+		if object.Kind == "VLANNamespace" {
+			defined[object.Name] = true
+		}
+	}
+
+	findings := []Finding{}
+	for _, object := range objects {
+		switch object.Kind {
+		case "Switch":
+			namespaces := wiring.Lookup(object.Node, "spec", "vlanNamespaces")
+			if namespaces == nil {
+				continue
+			}
+			for i, item := range namespaces.Content {
+				if !defined[item.Value] {
+					finding := mismatch(object, []string{"spec", "vlanNamespaces"},
+						"VLAN namespace %q is not defined", item.Value)
+					finding.Path = fmt.Sprintf("spec.vlanNamespaces[%d]", i)
+					finding.Line = item.Line
+					findings = append(findings, finding)
+				}
+			}
+		case "VPC":
+			if name := wiring.Scalar(object.Node, "spec", "vlanNamespace"); name != "" && !defined[name] {
+				findings = append(findings, mismatch(object, []string{"spec", "vlanNamespace"},
+					"VLAN namespace %q is not defined", name))
+			}
+		}
+	}
+	return findings
+}
+
+// checkFabricMode reports switch roles that do not fit the fabric mode of the
+// fab.yaml: spines in a collapsed-core fabric, none in a spine-leaf one.
+func checkFabricMode(objects []*wiring.Object) []Finding {
+	fab := fabricator(objects)
+	if fab == nil {
+		return nil
+	}
+	modePath := []string{"spec", "config", "fabric", "mode"}
+	mode := wiring.Scalar(fab.Node, modePath...)
+
+	findings := []Finding{}
+	switches, spines := 0, 0
+	for _, object := range objects {
+		if object.Kind != "Switch" {
+			continue
+		}
+		switches++
+		if wiring.Scalar(object.Node, "spec", "role") != "spine" {
+			continue
+		}
+		spines++
+		if mode == modeCollapsedCore {
+			findings = append(findings, mismatch(object, []string{"spec", "role"},
+				"spine switch in a %s fabric", modeCollapsedCore))
+		}
+	}
+	if mode == modeSpineLeaf && switches > 0 && spines == 0 {
+		findings = append(findings, mismatch(fab, modePath,
+			"fabric mode is %s but none of the %d switches of the wiring is a spine", modeSpineLeaf, switches))
+	}
+	return findings
+}
+
+func sortedKeys(objects map[string]*wiring.Object) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,261 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// checkDeprecatedAPIVersions finds objects written against a deprecated API
+// version, which validator convert upgrades.
+func checkDeprecatedAPIVersions(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	for _, object := range objects {
+		replacement := wiring.Replacement(object.APIVersion)
+		if replacement == "" {
+			continue
+		}
+		line := object.Line
+		if node := wiring.Lookup(object.Node, "apiVersion"); node != nil {
+			line = node.Line
+		}
+		findings = append(findings, Finding{
+			Code:    codes.Deprecated,
+			Message: fmt.Sprintf("%s: apiVersion %s is deprecated, use %s", object.Key(), object.APIVersion, replacement),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    line,
+			Path:    "apiVersion",
+		})
+	}
+	return findings
+}
+
+// checkUnusedVLANNamespaces finds VLAN namespaces no switch or VPC uses.
+// Switches without spec.vlanNamespaces and VPCs without spec.vlanNamespace use
+// the default one. Bundles without switches are skipped, their users may be
+// defined elsewhere.
+func checkUnusedVLANNamespaces(objects []*wiring.Object) []Finding {
+	used := map[string]bool{}
+	switches := false
+	for _, object := range objects {
+		switch object.Kind {
+		case "Switch":
+			switches = true
+			namespaces := wiring.Lookup(object.Node, "spec", "vlanNamespaces")
+			if namespaces == nil || len(namespaces.Content) == 0 {
+				used["default"] = true
+				continue
+			}
+			for _, item := range namespaces.Content {
+				used[item.Value] = true
+			}
+		case "VPC":
+			name := wiring.Scalar(object.Node, "spec", "vlanNamespace")
+			if name == "" {
+				name = "default"
+			}
+			used[name] = true
+		}
+	}
+	if !switches {
+		return nil
+	}
+
+	findings := []Finding{}
+	for _, object := range objects {
+		if object.Kind != "VLANNamespace" || used[object.Name] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Code:    codes.Unused,
+			Message: fmt.Sprintf("%s: no switch or VPC uses VLAN namespace %s", object.Key(), object.Name),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    object.Line,
+		})
+	}
+	return findings
+}
+
+// checkSingleHomedServers finds servers whose connections all lead to the same
+// switch. Control nodes are left out, they are connected to the management
+// network only.
+func checkSingleHomedServers(objects []*wiring.Object) []Finding {
+	switchesOf := serverSwitches(objects)
+	findings := []Finding{}
+	for _, object := range objects {
+		if object.Kind != "Server" || wiring.Scalar(object.Node, "spec", "type") == "control" {
+			continue
+		}
+		switches := switchesOf[object.Name]
+		if len(switches) != 1 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Code:    codes.SinglePointOfFailure,
+			Message: fmt.Sprintf("%s: server is only connected to switch %s", object.Key(), sortedNames(switches)[0]),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    object.Line,
+		})
+	}
+	return findings
+}
+
+// checkServerRedundancy finds servers that are not dual-homed: connected to
+// fewer than two switches, counting every connection, so two unbundled
+// connections to different switches qualify like an MCLAG or ESLAG
+// connection to a pair. Unlike single-homed-servers it also reports servers
+// without any switch connection. Control nodes are left out, bundles without
+// switches are not checked.
+func checkServerRedundancy(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	switches := false
+	for _, object := range objects {
+		switches = switches || object.Kind == "Switch"
+	}
+	if !switches {
+		return findings
+	}
+
+	switchesOf := serverSwitches(objects)
+	for _, object := range objects {
+		if object.Kind != "Server" || wiring.Scalar(object.Node, "spec", "type") == "control" {
+			continue
+		}
+		switches := switchesOf[object.Name]
+		if len(switches) >= 2 {
+			continue
+		}
+		message := "server is not connected to any switch"
+		if len(switches) == 1 {
+			message = "server is only connected to switch " + sortedNames(switches)[0]
+		}
+		findings = append(findings, Finding{
+			Code:    codes.SinglePointOfFailure,
+			Message: fmt.Sprintf("%s: %s, the redundancy policy requires two switches or an MCLAG pair", object.Key(), message),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    object.Line,
+		})
+	}
+	return findings
+}
+
+// serverSwitches returns the switches each server has links to, by server
+// name.
+func serverSwitches(objects []*wiring.Object) map[string]map[string]bool {
+	switchesOf := map[string]map[string]bool{}
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		endpoints := wiring.Endpoints(object)
+		for _, server := range endpoints {
+			if !server.Valid() || server.Kind != "Server" {
+				continue
+			}
+			for _, peer := range endpoints {
+				if peer.Valid() && peer.Kind == "Switch" && peer.Link == server.Link {
+					if switchesOf[server.Device] == nil {
+						switchesOf[server.Device] = map[string]bool{}
+					}
+					switchesOf[server.Device][peer.Device] = true
+				}
+			}
+		}
+	}
+	return switchesOf
+}
+
+// checkUnconnectedDevices finds switches and servers no connection uses.
+func checkUnconnectedDevices(objects []*wiring.Object) []Finding {
+	connected := map[string]bool{}
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		for _, endpoint := range wiring.Endpoints(object) {
+			if endpoint.Valid() {
+				connected[endpoint.Kind+"/"+endpoint.Device] = true
+			}
+		}
+	}
+
+	findings := []Finding{}
+	for _, object := range objects {
+		if (object.Kind != "Switch" && object.Kind != "Server") || connected[object.Kind+"/"+object.Name] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Code:    codes.Unused,
+			Message: fmt.Sprintf("%s: no connection uses %s %s", object.Key(), strings.ToLower(object.Kind), object.Name),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    object.Line,
+		})
+	}
+	return findings
+}
+
+// checkUnusedIPv4Namespaces finds IPv4 namespaces no VPC uses. VPCs without
+// spec.ipv4Namespace use the default one.
+func checkUnusedIPv4Namespaces(objects []*wiring.Object) []Finding {
+	used := map[string]bool{}
+	vpcs := false
+	for _, object := range objects {
+		if object.Kind != "VPC" {
+			continue
+		}
+		vpcs = true
+		name := wiring.Scalar(object.Node, "spec", "ipv4Namespace")
+		if name == "" {
+			name = "default"
+		}
+		used[name] = true
+	}
+	if !vpcs {
+		return nil
+	}
+
+	findings := []Finding{}
+	for _, object := range objects {
+		if object.Kind != "IPv4Namespace" || used[object.Name] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Code:    codes.Unused,
+			Message: fmt.Sprintf("%s: no VPC uses IPv4 namespace %s", object.Key(), object.Name),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    object.Line,
+		})
+	}
+	return findings
+}
+
+// checkMissingDescriptions finds switches and servers without
+// spec.description.
+func checkMissingDescriptions(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	for _, object := range objects {
+		if object.Kind != "Switch" && object.Kind != "Server" {
+			continue
+		}
+		if wiring.Scalar(object.Node, "spec", "description") != "" {
+			continue
+		}
+		findings = append(findings, Finding{
+			Code:    codes.MissingDescription,
+			Message: fmt.Sprintf("%s: spec.description is not set", object.Key()),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    object.Line,
+			Path:    "spec.description",
+		})
+	}
+	return findings
+}
@@ -0,0 +1,191 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// The naming constraints of Kubernetes. Object names are DNS-1123
+// subdomains, names that become hostnames DNS-1123 labels; label keys are
+// qualified names with an optional subdomain prefix.
+var (
+	dns1123Label     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	dns1123Subdomain = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	qualifiedName    = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+)
+
+const (
+	maxLabelLength     = 63
+	maxSubdomainLength = 253
+)
+
+// hostnameKinds are the kinds whose names become hostnames.
+var hostnameKinds = map[string]bool{"Switch": true, "Server": true}
+
+// nameReferences are the fields naming other objects by kind, checked like
+// the names they refer to. VPCAttachment subnets are written vpc/subnet.
+var nameReferences = map[string][][]string{
+	"Switch": {
+		{"spec", "groups"},
+		{"spec", "redundancy", "group"},
+		{"spec", "vlanNamespaces"},
+	},
+	"VPC": {
+		{"spec", "ipv4Namespace"},
+		{"spec", "vlanNamespace"},
+	},
+	"VPCAttachment": {
+		{"spec", "connection"},
+		{"spec", "subnet"},
+	},
+	"ExternalAttachment": {
+		{"spec", "connection"},
+		{"spec", "external"},
+	},
+}
+
+// checkObjectNames reports object names, labels and references to objects
+// that Kubernetes rejects, which hhfab leaves to fail when the objects are
+// applied.
+func checkObjectNames(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	for _, object := range objects {
+		if node := wiring.Lookup(object.Node, "metadata", "name"); node != nil && node.Kind == yaml.ScalarNode {
+			if problem := nameProblem(node.Value, hostnameKinds[object.Kind]); problem != "" {
+				findings = append(findings, nameFinding(object, node, "metadata.name", "name %q %s", node.Value, problem))
+			}
+		}
+
+		if labels := wiring.Lookup(object.Node, "metadata", "labels"); labels != nil && labels.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(labels.Content); i += 2 {
+				key, value := labels.Content[i], labels.Content[i+1]
+				path := "metadata.labels." + key.Value
+				if problem := labelKeyProblem(key.Value); problem != "" {
+					findings = append(findings, nameFinding(object, key, path, "label key %q %s", key.Value, problem))
+				} else if problem := labelValueProblem(value.Value); value.Kind == yaml.ScalarNode && problem != "" {
+					findings = append(findings, nameFinding(object, value, path, "label value %q %s", value.Value, problem))
+				}
+			}
+		}
+
+		for _, path := range nameReferences[object.Kind] {
+			node := wiring.Lookup(object.Node, path...)
+			if node == nil {
+				continue
+			}
+			items := []*yaml.Node{node}
+			if node.Kind == yaml.SequenceNode {
+				items = node.Content
+			}
+			for i, item := range items {
+				if item.Kind != yaml.ScalarNode || item.Value == "" {
+					continue
+				}
+				field := strings.Join(path, ".")
+				if node.Kind == yaml.SequenceNode {
+					field += fmt.Sprintf("[%d]", i)
+				}
+				for _, name := range strings.Split(item.Value, "/") {
+					if problem := nameProblem(name, false); problem != "" {
+						findings = append(findings, nameFinding(object, item, field, "%s refers to %q, whose name %s", field, item.Value, problem))
+						break
+					}
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// nameProblem explains why name is not a DNS-1123 subdomain, or a label if
+// it is a hostname, or returns "".
+func nameProblem(name string, hostname bool) string {
+	switch {
+	case hostname && (len(name) > maxLabelLength || !dns1123Label.MatchString(name)):
+		return fmt.Sprintf("must be a lowercase RFC 1123 label: at most %d lower-case letters, digits and '-', starting and ending with a letter or digit", maxLabelLength)
+	case len(name) > maxSubdomainLength || !dns1123Subdomain.MatchString(name):
+		return fmt.Sprintf("must be a lowercase RFC 1123 subdomain: at most %d lower-case letters, digits, '-' and '.', starting and ending with a letter or digit", maxSubdomainLength)
+	}
+	return ""
+}
+
+// labelKeyProblem explains why key is not a label key, an optional DNS-1123
+// subdomain prefix and a qualified name, or returns "".
+func labelKeyProblem(key string) string {
+	name := key
+	if prefix, rest, found := strings.Cut(key, "/"); found {
+		if len(prefix) > maxSubdomainLength || !dns1123Subdomain.MatchString(prefix) {
+			return "must have a lowercase RFC 1123 subdomain as its prefix"
+		}
+		name = rest
+	}
+	if len(name) > maxLabelLength || !qualifiedName.MatchString(name) {
+		return fmt.Sprintf("must be at most %d letters, digits, '-', '_' and '.', starting and ending with a letter or digit, after an optional prefix/", maxLabelLength)
+	}
+	return ""
+}
+
+// labelValueProblem explains why value is not a label value, or returns "".
+func labelValueProblem(value string) string {
+	if value == "" || (len(value) <= maxLabelLength && qualifiedName.MatchString(value)) {
+		return ""
+	}
+	return fmt.Sprintf("must be empty or at most %d letters, digits, '-', '_' and '.', starting and ending with a letter or digit", maxLabelLength)
+}
+
+func nameFinding(object *wiring.Object, node *yaml.Node, path, format string, args ...any) Finding {
+	return Finding{
+		Code:    codes.InvalidName,
+		Message: object.Key() + ": " + fmt.Sprintf(format, args...),
+		Object:  object.Key(),
+		File:    object.File,
+		Line:    node.Line,
+		Path:    path,
+	}
+}
+
+// Naming holds the naming conventions of a profile: patterns the names of
+// objects of a kind must match in whole, by kind, with "*" for the kinds
+// without one of their own.
+type Naming map[string]string
+
+// validate reports patterns that are not regular expressions.
+func (n Naming) validate() error {
+	for kind, pattern := range n {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("naming pattern of %s: %w", kind, err)
+		}
+	}
+	return nil
+}
+
+// check reports objects whose names do not match the pattern of their kind.
+func (n Naming) check(objects []*wiring.Object) []Finding {
+	patterns := map[string]*regexp.Regexp{}
+	for kind, pattern := range n {
+		if re, err := regexp.Compile(`^(?:` + pattern + `)$`); err == nil {
+			patterns[kind] = re
+		}
+	}
+
+	findings := []Finding{}
+	for _, object := range objects {
+		kind := object.Kind
+		if patterns[kind] == nil {
+			kind = "*"
+		}
+		re := patterns[kind]
+		node := wiring.Lookup(object.Node, "metadata", "name")
+		if re == nil || node == nil || re.MatchString(object.Name) {
+			continue
+		}
+		findings = append(findings, nameFinding(object, node, "metadata.name", "name %q does not match the naming pattern %s of the profile", object.Name, n[kind]))
+	}
+	return findings
+}
@@ -0,0 +1,244 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+var (
+	// breakoutMode matches spec.portBreakouts values such as 4x25G
+	breakoutMode = regexp.MustCompile(`^(\d+)[xX](\d+(?:\.\d+)?[MG])$`)
+	// breakoutPort matches ports of a breakout, E1/55/2 of E1/55
+	breakoutPort = regexp.MustCompile(`^(E\d+/\d+)/(\d+)$`)
+)
+
+// breakout is a configured breakout of a switch port.
+type breakout struct {
+	mode  string
+	count int
+	speed string
+}
+
+// switchPorts is the port configuration of a switch.
+type switchPorts struct {
+	object    *wiring.Object
+	breakouts map[string]breakout
+	speeds    map[string]string
+}
+
+// portUse is a connection endpoint on a switch port.
+type portUse struct {
+	connection *wiring.Object
+	endpoint   wiring.Endpoint
+}
+
+// speed returns the speed port runs at as configured, spec.portSpeeds or the
+// breakout it belongs to, or "" if the switch profile's default applies.
+func (s *switchPorts) speed(port string) string {
+	if speed := s.speeds[port]; speed != "" {
+		return speed
+	}
+	if match := breakoutPort.FindStringSubmatch(port); match != nil {
+		return s.breakouts[match[1]].speed
+	}
+	return ""
+}
+
+// switchPortConfigs returns the port configuration of every switch by name.
+// Invalid breakout modes are left out.
+func switchPortConfigs(objects []*wiring.Object) map[string]*switchPorts {
+	configs := map[string]*switchPorts{}
+	for _, object := range objects {
+		if object.Kind != "Switch" {
+			continue
+		}
+		config := &switchPorts{object: object, breakouts: map[string]breakout{}, speeds: map[string]string{}}
+		for port, mode := range portMap(object, "portBreakouts") {
+			if b, ok := parseBreakout(mode); ok {
+				config.breakouts[port] = b
+			}
+		}
+		for port, speed := range portMap(object, "portSpeeds") {
+			config.speeds[port] = strings.ToUpper(speed)
+		}
+		configs[object.Name] = config
+	}
+	return configs
+}
+
+// portMap returns a spec field of a switch mapping ports to values.
+func portMap(object *wiring.Object, field string) map[string]string {
+	values := map[string]string{}
+	node := wiring.Lookup(object.Node, "spec", field)
+	if node == nil {
+		return values
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		values[node.Content[i].Value] = node.Content[i+1].Value
+	}
+	return values
+}
+
+func parseBreakout(mode string) (breakout, bool) {
+	match := breakoutMode.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(mode)))
+	if match == nil {
+		return breakout{}, false
+	}
+	count, err := strconv.Atoi(match[1])
+	if err != nil || count < 1 {
+		return breakout{}, false
+	}
+	return breakout{mode: mode, count: count, speed: match[2]}, true
+}
+
+// switchPortUses returns the connection endpoints on every port of the
+// switches of the bundle, by switch and port.
+func switchPortUses(objects []*wiring.Object, configs map[string]*switchPorts) map[string]map[string][]portUse {
+	uses := map[string]map[string][]portUse{}
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		for _, endpoint := range wiring.Endpoints(object) {
+			if !endpoint.Valid() || endpoint.Kind != "Switch" || configs[endpoint.Device] == nil {
+				continue
+			}
+			if uses[endpoint.Device] == nil {
+				uses[endpoint.Device] = map[string][]portUse{}
+			}
+			uses[endpoint.Device][endpoint.Port] = append(uses[endpoint.Device][endpoint.Port], portUse{object, endpoint})
+		}
+	}
+	return uses
+}
+
+// checkPortBreakouts verifies breakouts against the speeds and connections
+// using them: breakout modes are written like 4x25G, breakout ports are not
+// set to another speed than their breakout and the port broken out has none,
+// connections only use breakout ports that exist, and no port is used both
+// whole and broken out.
+func checkPortBreakouts(objects []*wiring.Object) []Finding {
+	configs := switchPortConfigs(objects)
+	findings := []Finding{}
+	for _, name := range sortedNames(configs) {
+		config := configs[name]
+		breakouts := portMap(config.object, "portBreakouts")
+		for _, port := range sortedNames(breakouts) {
+			b, ok := config.breakouts[port]
+			if !ok {
+				finding := mismatch(config.object, []string{"spec", "portBreakouts", port},
+					"breakout %q of port %s is not written like 4x25G", breakouts[port], port)
+				finding.Code = codes.InvalidField
+				findings = append(findings, finding)
+				continue
+			}
+			if speed := config.speeds[port]; speed != "" {
+				finding := mismatch(config.object, []string{"spec", "portSpeeds", port},
+					"port %s is broken out %s, its speed is set on the breakout ports", port, b.mode)
+				finding.Code = codes.PortMismatch
+				findings = append(findings, finding)
+			}
+		}
+		for _, port := range sortedNames(config.speeds) {
+			match := breakoutPort.FindStringSubmatch(port)
+			if match == nil {
+				continue
+			}
+			if b, ok := config.breakouts[match[1]]; ok && config.speeds[port] != b.speed {
+				finding := mismatch(config.object, []string{"spec", "portSpeeds", port},
+					"breakout port %s is set to %s, the breakout %s of %s runs at %s", port, config.speeds[port], b.mode, match[1], b.speed)
+				finding.Code = codes.PortMismatch
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	uses := switchPortUses(objects, configs)
+	for _, device := range sortedNames(uses) {
+		config, ports := configs[device], uses[device]
+		// Breakout ports in use by the port they belong to
+		brokenOut := map[string][]portUse{}
+		for _, port := range sortedNames(ports) {
+			if match := breakoutPort.FindStringSubmatch(port); match != nil {
+				brokenOut[match[1]] = append(brokenOut[match[1]], ports[port]...)
+			}
+		}
+
+		for _, port := range sortedNames(ports) {
+			for _, use := range ports[port] {
+				report := func(code, format string, args ...any) {
+					findings = append(findings, Finding{
+						Code:    code,
+						Message: use.connection.Key() + ": " + fmt.Sprintf(format, args...),
+						Object:  use.connection.Key(),
+						File:    use.connection.File,
+						Line:    use.endpoint.Line,
+						Path:    use.endpoint.Path,
+					})
+				}
+
+				if match := breakoutPort.FindStringSubmatch(port); match != nil {
+					lane, _ := strconv.Atoi(match[2])
+					if b, ok := config.breakouts[match[1]]; ok && (lane < 1 || lane > b.count) {
+						report(codes.PortMismatch, "%s uses %s/%s, which does not exist, %s is broken out %s",
+							use.endpoint.Path, device, port, match[1], b.mode)
+					}
+					continue
+				}
+				if b, ok := config.breakouts[port]; ok && b.count > 1 {
+					report(codes.PortMismatch, "%s uses %s/%s whole, it is broken out %s into %s/1 to %s/%d",
+						use.endpoint.Path, device, port, b.mode, port, port, b.count)
+				}
+				if others := brokenOut[port]; len(others) > 0 {
+					other := others[0]
+					report(codes.PortConflict, "%s uses %s/%s whole, %s uses it broken out as %s",
+						use.endpoint.Path, device, port, other.connection.Key(), other.endpoint.Value)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// checkPortSpeeds reports links between two switches whose ends are
+// configured to different speeds. Ends without a configured speed run at
+// the default of their switch profile and are not compared.
+func checkPortSpeeds(objects []*wiring.Object) []Finding {
+	configs := switchPortConfigs(objects)
+	findings := []Finding{}
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		ends := map[string]wiring.Endpoint{}
+		for _, endpoint := range wiring.Endpoints(object) {
+			if !endpoint.Valid() || endpoint.Kind != "Switch" || configs[endpoint.Device] == nil {
+				continue
+			}
+			first, ok := ends[endpoint.Link]
+			if !ok {
+				ends[endpoint.Link] = endpoint
+				continue
+			}
+			speed, firstSpeed := configs[endpoint.Device].speed(endpoint.Port), configs[first.Device].speed(first.Port)
+			if speed == "" || firstSpeed == "" || speed == firstSpeed {
+				continue
+			}
+			findings = append(findings, Finding{
+				Code: codes.PortMismatch,
+				Message: fmt.Sprintf("%s: %s runs at %s, the other end %s at %s",
+					object.Key(), endpoint.Value, speed, first.Value, firstSpeed),
+				Object: object.Key(),
+				File:   object.File,
+				Line:   endpoint.Line,
+				Path:   endpoint.Path,
+			})
+		}
+	}
+	return findings
+}
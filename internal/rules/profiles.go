@@ -0,0 +1,199 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// Profile is the acceptance bar of an environment: which rules run, whether
+// warnings fail validation and the topology the fabric must have.
+type Profile struct {
+	Description string `yaml:"description" json:"description,omitempty"`
+	// Strict runs the lint rules and fails validation on warnings
+	Strict bool `yaml:"strict" json:"strict"`
+	// Disable names rules that are not run, Enable lint rules that are run
+	// outside strict mode and policy rules
+	Disable  []string `yaml:"disable" json:"disable,omitempty"`
+	Enable   []string `yaml:"enable" json:"enable,omitempty"`
+	Topology Topology `yaml:"topology" json:"topology"`
+	// Naming are the patterns of the names of objects by kind
+	Naming Naming `yaml:"naming" json:"naming,omitempty"`
+	// APIVersions are the API versions objects may be written against, any
+	// if empty
+	APIVersions []string `yaml:"api_versions" json:"api_versions,omitempty"`
+}
+
+// Topology holds invariants of the fabric. Zero values and nil maximums do
+// not constrain it.
+type Topology struct {
+	// FabricMode is the mode the fabricator config must set
+	FabricMode string `yaml:"fabric_mode" json:"fabric_mode,omitempty"`
+	MinSpines  int    `yaml:"min_spines" json:"min_spines,omitempty"`
+	MaxSpines  *int   `yaml:"max_spines" json:"max_spines,omitempty"`
+	MinLeaves  int    `yaml:"min_leaves" json:"min_leaves,omitempty"`
+	MaxLeaves  *int   `yaml:"max_leaves" json:"max_leaves,omitempty"`
+}
+
+// Profiles returns the built-in profiles by name.
+func Profiles() map[string]Profile {
+	none, pair := 0, 2
+	return map[string]Profile{
+		"lab": {
+			Description: "Labs and virtual fabrics: single-homed servers and unused namespaces are fine",
+			Disable:     []string{"single-homed-servers", "unused-vlan-namespaces"},
+		},
+		"prod-spine-leaf": {
+			Description: "Production spine-leaf fabrics: strict, with at least two spines and two leaves",
+			Strict:      true,
+			Topology:    Topology{FabricMode: modeSpineLeaf, MinSpines: 2, MinLeaves: 2},
+		},
+		"collapsed-core": {
+			Description: "Collapsed-core fabrics: no spines and a single pair of leaves",
+			Topology:    Topology{FabricMode: modeCollapsedCore, MaxSpines: &none, MinLeaves: 2, MaxLeaves: &pair},
+		},
+	}
+}
+
+// Validate reports rules and fabric modes the profile names that do not
+// exist.
+func (p Profile) Validate() error {
+	known := map[string]bool{}
+	for _, r := range rules {
+		known[r.name] = true
+	}
+	for _, r := range append(append([]rule{}, lintRules...), policyRules...) {
+		known[r.name] = true
+	}
+	for _, name := range append(append([]string{}, p.Disable...), p.Enable...) {
+		if !known[name] {
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	if mode := p.Topology.FabricMode; mode != "" && mode != modeSpineLeaf && mode != modeCollapsedCore {
+		return fmt.Errorf("unknown fabric mode %q", mode)
+	}
+	return p.Naming.validate()
+}
+
+// CheckProfile runs the rules the profile selects followed by its topology
+// invariants, naming conventions and API versions.
+func CheckProfile(objects []*wiring.Object, profile Profile) []Finding {
+	disabled := map[string]bool{}
+	for _, name := range profile.Disable {
+		disabled[name] = true
+	}
+	enabled := map[string]bool{}
+	for _, name := range profile.Enable {
+		enabled[name] = true
+	}
+
+	selected := []rule{}
+	for _, r := range rules {
+		if !disabled[r.name] {
+			selected = append(selected, r)
+		}
+	}
+	for _, r := range lintRules {
+		if (profile.Strict || enabled[r.name]) && !disabled[r.name] {
+			selected = append(selected, r)
+		}
+	}
+	for _, r := range policyRules {
+		if enabled[r.name] && !disabled[r.name] {
+			selected = append(selected, r)
+		}
+	}
+	selected = append(selected, rule{name: "topology", severity: SeverityError, check: profile.Topology.check})
+	selected = append(selected, rule{name: "naming", severity: SeverityError, check: profile.Naming.check})
+	selected = append(selected, rule{name: "api-versions", severity: SeverityError, check: profile.checkAPIVersions})
+	return run(selected, objects)
+}
+
+// checkAPIVersions reports objects written against an API version the
+// profile does not allow.
+func (p Profile) checkAPIVersions(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	if len(p.APIVersions) == 0 {
+		return findings
+	}
+	allowed := map[string]bool{}
+	for _, version := range p.APIVersions {
+		allowed[version] = true
+	}
+	for _, object := range objects {
+		if allowed[object.APIVersion] {
+			continue
+		}
+		line := object.Line
+		if node := wiring.Lookup(object.Node, "apiVersion"); node != nil {
+			line = node.Line
+		}
+		findings = append(findings, Finding{
+			Code:    codes.InvalidField,
+			Message: fmt.Sprintf("%s: apiVersion %s is not allowed by the profile, use %s", object.Key(), object.APIVersion, strings.Join(p.APIVersions, " or ")),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    line,
+			Path:    "apiVersion",
+		})
+	}
+	return findings
+}
+
+// check reports switch counts and a fabric mode other than the topology
+// requires. Bundles without switches, such as VPC files validated on their
+// own, are not checked.
+func (t Topology) check(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	spines, leaves := []*wiring.Object{}, []*wiring.Object{}
+	for _, object := range objects {
+		if object.Kind != "Switch" {
+			continue
+		}
+		if role := wiring.Scalar(object.Node, "spec", "role"); role == "spine" {
+			spines = append(spines, object)
+		} else if strings.HasSuffix(role, "-leaf") {
+			leaves = append(leaves, object)
+		}
+	}
+	if len(spines)+len(leaves) == 0 {
+		return findings
+	}
+
+	if fab := fabricator(objects); fab != nil && t.FabricMode != "" {
+		modePath := []string{"spec", "config", "fabric", "mode"}
+		if mode := wiring.Scalar(fab.Node, modePath...); mode != t.FabricMode {
+			finding := mismatch(fab, modePath, "fabric mode is %q, the profile requires %s", mode, t.FabricMode)
+			finding.Code = codes.Topology
+			findings = append(findings, finding)
+		}
+	}
+	findings = append(findings, countSwitches("spines", spines, t.MinSpines, t.MaxSpines)...)
+	return append(findings, countSwitches("leaves", leaves, t.MinLeaves, t.MaxLeaves)...)
+}
+
+// countSwitches reports too few switches for the whole fabric and every
+// switch beyond the maximum on its own.
+func countSwitches(role string, switches []*wiring.Object, min int, max *int) []Finding {
+	findings := []Finding{}
+	if len(switches) < min {
+		findings = append(findings, Finding{
+			Code:    codes.Topology,
+			Message: fmt.Sprintf("the profile requires at least %d %s, the fabric has %d", min, role, len(switches)),
+		})
+	}
+	if max != nil && len(switches) > *max {
+		sort.Slice(switches, func(i, j int) bool { return switches[i].Name < switches[j].Name })
+		for _, object := range switches[*max:] {
+			finding := mismatch(object, []string{"spec", "role"},
+				"the profile allows at most %d %s, the fabric has %d", *max, role, len(switches))
+			finding.Code = codes.Topology
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
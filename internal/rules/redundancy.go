@@ -0,0 +1,207 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// Redundancy types of spec.redundancy.type of a Switch.
+const (
+	redundancyMCLAG = "mclag"
+	redundancyESLAG = "eslag"
+)
+
+// redundancyGroup is the switches sharing spec.redundancy.group.
+type redundancyGroup struct {
+	name     string
+	kind     string
+	members  []*wiring.Object
+	switches map[string]bool
+}
+
+func (g *redundancyGroup) memberNames() string {
+	names := []string{}
+	for _, member := range g.members {
+		names = append(names, member.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// checkRedundancyGroups verifies MCLAG and ESLAG groups: the group exists,
+// MCLAG pairs have exactly two members joined by one mclagDomain connection
+// with peer and session links, multi-homed connections use every member with
+// the same number of links, and no switch is in two MCLAG domains.
+func checkRedundancyGroups(objects []*wiring.Object) []Finding {
+	switchGroups := map[string]bool{}
+	for _, object := range objects {
+		if object.Kind == "SwitchGroup" {
+			switchGroups[object.Name] = true
+		}
+	}
+
+	findings := []Finding{}
+	report := func(object *wiring.Object, line int, path, format string, args ...any) {
+		if line == 0 {
+			line = object.Line
+		}
+		findings = append(findings, Finding{
+			Code:    codes.Redundancy,
+			Message: object.Key() + ": " + fmt.Sprintf(format, args...),
+			Object:  object.Key(),
+			File:    object.File,
+			Line:    line,
+			Path:    path,
+		})
+	}
+
+	groups := map[string]*redundancyGroup{}
+	groupOf := map[string]*redundancyGroup{}
+	order := []string{}
+	for _, object := range objects {
+		if object.Kind != "Switch" {
+			continue
+		}
+		name := wiring.Scalar(object.Node, "spec", "redundancy", "group")
+		if name == "" {
+			continue
+		}
+		kind := wiring.Scalar(object.Node, "spec", "redundancy", "type")
+		groupNode := wiring.Lookup(object.Node, "spec", "redundancy", "group")
+		if len(switchGroups) > 0 && !switchGroups[name] {
+			finding := Finding{
+				Code:    codes.MissingReference,
+				Message: fmt.Sprintf("%s: spec.redundancy.group refers to SwitchGroup/%s, which is not defined", object.Key(), name),
+				Object:  object.Key(),
+				File:    object.File,
+				Line:    groupNode.Line,
+				Path:    "spec.redundancy.group",
+			}
+			findings = append(findings, finding)
+		}
+
+		group := groups[name]
+		if group == nil {
+			group = &redundancyGroup{name: name, kind: kind, switches: map[string]bool{}}
+			groups[name] = group
+			order = append(order, name)
+		} else if group.kind != kind {
+			report(object, wiring.Lookup(object.Node, "spec", "redundancy").Line, "spec.redundancy.type",
+				"redundancy type %q differs from %q of the other members of group %s", kind, group.kind, name)
+		}
+		group.members = append(group.members, object)
+		group.switches[object.Name] = true
+		groupOf[object.Name] = group
+	}
+
+	for _, name := range order {
+		group := groups[name]
+		if group.kind == redundancyMCLAG && len(group.members) != 2 {
+			report(group.members[0], 0, "spec.redundancy.group",
+				"MCLAG group %s needs exactly 2 switches, has %d: %s", name, len(group.members), group.memberNames())
+		}
+	}
+
+	// MCLAG domains, the peer and session links between the two members
+	domains := map[string]*wiring.Object{}
+	domainOf := map[string]*wiring.Object{}
+	for _, object := range objects {
+		if object.Kind != "Connection" || wiring.ConnectionType(object) != "mclagDomain" {
+			continue
+		}
+		for _, links := range []string{"peerLinks", "sessionLinks"} {
+			if node := wiring.Lookup(object.Node, "spec", "mclagDomain", links); node == nil || len(node.Content) == 0 {
+				report(object, 0, "spec.mclagDomain."+links, "MCLAG domain has no %s", links)
+			}
+		}
+
+		devices := map[string]bool{}
+		for _, endpoint := range wiring.Endpoints(object) {
+			if endpoint.Valid() {
+				devices[endpoint.Device] = true
+			}
+		}
+		names := sortedNames(devices)
+		if len(names) != 2 {
+			report(object, 0, "spec.mclagDomain", "MCLAG domain must connect exactly 2 switches, connects %s", strings.Join(names, ", "))
+			continue
+		}
+		for _, device := range names {
+			if other := domainOf[device]; other != nil {
+				report(object, 0, "spec.mclagDomain", "switch %s is already in the MCLAG domain of %s", device, other.Key())
+			}
+			domainOf[device] = object
+		}
+		group := groupOf[names[0]]
+		if group == nil || group != groupOf[names[1]] || group.kind != redundancyMCLAG {
+			report(object, 0, "spec.mclagDomain", "switches %s are not the members of one MCLAG group", strings.Join(names, " and "))
+			continue
+		}
+		domains[group.name] = object
+	}
+
+	for _, name := range order {
+		group := groups[name]
+		if group.kind == redundancyMCLAG && len(group.members) == 2 && domains[name] == nil {
+			report(group.members[0], 0, "spec.redundancy.group", "MCLAG group %s has no mclagDomain connection between %s", name, group.memberNames())
+		}
+	}
+
+	// Multi-homed connections must use each member of one group alike
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		kind := wiring.ConnectionType(object)
+		if kind != redundancyMCLAG && kind != redundancyESLAG {
+			continue
+		}
+
+		links := map[string]int{}
+		for _, endpoint := range wiring.Endpoints(object) {
+			if endpoint.Valid() && endpoint.Kind == "Switch" {
+				links[endpoint.Device]++
+			}
+		}
+		names := sortedNames(links)
+		if len(names) == 0 {
+			continue
+		}
+		group := groupOf[names[0]]
+		if group == nil || group.kind != kind {
+			report(object, 0, "spec."+kind, "switch %s is not in a %s group", names[0], strings.ToUpper(kind))
+			continue
+		}
+		symmetric := len(names) == len(group.members)
+		for _, device := range names {
+			if !group.switches[device] {
+				report(object, 0, "spec."+kind, "switches %s are not all in %s group %s", strings.Join(names, ", "), strings.ToUpper(kind), group.name)
+				symmetric = true
+				break
+			}
+			symmetric = symmetric && links[device] == links[names[0]]
+		}
+		if !symmetric {
+			counts := []string{}
+			for _, device := range names {
+				counts = append(counts, fmt.Sprintf("%s: %d", device, links[device]))
+			}
+			report(object, 0, "spec."+kind, "links must use every member of group %s (%s) alike, have %s",
+				group.name, group.memberNames(), strings.Join(counts, ", "))
+		}
+	}
+	return findings
+}
+
+func sortedNames[V any](set map[string]V) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,92 @@
+// Package rules holds the semantic checks the validator runs on wiring
+// diagrams itself, in addition to hhfab. They only look at the parsed objects,
+// so their findings carry the exact document and field they are about.
+package rules
+
+import (
+	"validator/internal/wiring"
+)
+
+// Severities of findings. Warnings point out likely mistakes that do not
+// fail validation.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is a problem found by a rule.
+type Finding struct {
+	// Rule names the rule, Code is its diagnostic code
+	Rule     string
+	Code     string
+	Severity string
+	Message  string
+
+	// Object is the key of the offending object, File, Line and Path locate
+	// the field
+	Object string
+	File   string
+	Line   int
+	Path   string
+}
+
+// rule checks all objects of a bundle.
+type rule struct {
+	name     string
+	severity string
+	check    func(objects []*wiring.Object) []Finding
+}
+
+var rules = []rule{
+	{name: "connection-endpoints", severity: SeverityError, check: checkConnectionEndpoints},
+	{name: "object-names", severity: SeverityError, check: checkObjectNames},
+	{name: "control-nodes", severity: SeverityError, check: checkControlNodes},
+	{name: "vlan-namespaces", severity: SeverityError, check: checkVLANNamespaces},
+	{name: "fabric-mode", severity: SeverityError, check: checkFabricMode},
+	{name: "vlan-ranges", severity: SeverityError, check: checkVLANRanges},
+	{name: "subnet-overlap", severity: SeverityError, check: checkSubnetOverlap},
+	{name: "subnet-sizing", severity: SeverityError, check: checkSubnetSizing},
+	{name: "reserved-subnets", severity: SeverityError, check: checkReservedSubnets},
+	{name: "redundancy-groups", severity: SeverityError, check: checkRedundancyGroups},
+	{name: "port-breakouts", severity: SeverityError, check: checkPortBreakouts},
+	{name: "port-speeds", severity: SeverityError, check: checkPortSpeeds},
+	{name: "deprecated-api-versions", severity: SeverityWarning, check: checkDeprecatedAPIVersions},
+	{name: "unused-vlan-namespaces", severity: SeverityWarning, check: checkUnusedVLANNamespaces},
+	{name: "single-homed-servers", severity: SeverityWarning, check: checkSingleHomedServers},
+}
+
+// lintRules are style and completeness checks only run in strict mode.
+var lintRules = []rule{
+	{name: "unconnected-devices", severity: SeverityWarning, check: checkUnconnectedDevices},
+	{name: "unused-ipv4-namespaces", severity: SeverityWarning, check: checkUnusedIPv4Namespaces},
+	{name: "missing-descriptions", severity: SeverityWarning, check: checkMissingDescriptions},
+}
+
+// policyRules enforce design standards not every fabric follows. They only
+// run when a profile enables them, strict mode does not.
+var policyRules = []rule{
+	{name: "server-redundancy", severity: SeverityError, check: checkServerRedundancy},
+}
+
+// Check runs every rule over the objects of a bundle and returns the
+// findings in rule order, with the severity of their rule.
+func Check(objects []*wiring.Object) []Finding {
+	return CheckProfile(objects, Profile{})
+}
+
+// CheckStrict runs the rules of Check followed by the lint rules.
+func CheckStrict(objects []*wiring.Object) []Finding {
+	return CheckProfile(objects, Profile{Strict: true})
+}
+
+func run(rules []rule, objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	for _, r := range rules {
+		for _, finding := range r.check(objects) {
+			finding.Rule = r.name
+			finding.Severity = r.severity
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
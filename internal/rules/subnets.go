@@ -0,0 +1,249 @@
+package rules
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// subnet is a prefix declared by an object, an IPv4Namespace subnet or a VPC
+// subnet.
+type subnet struct {
+	object *wiring.Object
+	// namespace is the IPv4 namespace the prefix lives in
+	namespace string
+	// name is the VPC subnet name, "" for namespace subnets
+	name   string
+	path   string
+	line   int
+	prefix netip.Prefix
+	node   *yaml.Node
+}
+
+func (s subnet) String() string {
+	if s.name != "" {
+		return fmt.Sprintf("subnet %s %s of %s", s.name, s.prefix, s.object.Key())
+	}
+	return fmt.Sprintf("%s of %s", s.prefix, s.object.Key())
+}
+
+func (s subnet) finding(code, format string, args ...any) Finding {
+	return Finding{
+		Code:    code,
+		Message: s.object.Key() + ": " + fmt.Sprintf(format, args...),
+		Object:  s.object.Key(),
+		File:    s.object.File,
+		Line:    s.line,
+		Path:    s.path,
+	}
+}
+
+// reservedRanges may not be used for fabric subnets.
+var reservedRanges = []struct {
+	name   string
+	prefix netip.Prefix
+}{
+	{"this-network", netip.MustParsePrefix("0.0.0.0/8")},
+	{"loopback", netip.MustParsePrefix("127.0.0.0/8")},
+	{"link-local", netip.MustParsePrefix("169.254.0.0/16")},
+	{"multicast", netip.MustParsePrefix("224.0.0.0/4")},
+	{"reserved", netip.MustParsePrefix("240.0.0.0/4")},
+}
+
+// fabricatorSubnets are the subnets the fabricator config reserves for the
+// fabric itself, below spec.config.
+var fabricatorSubnets = [][]string{
+	{"control", "managementSubnet"},
+	{"fabric", "protocolSubnet"},
+	{"fabric", "vtepSubnet"},
+	{"fabric", "fabricSubnet"},
+}
+
+// collectSubnets parses the IPv4Namespace and VPC subnets. Unparseable
+// prefixes are reported as findings and left out.
+func collectSubnets(objects []*wiring.Object) ([]subnet, []subnet, []Finding) {
+	var namespaceSubnets, vpcSubnets []subnet
+	findings := []Finding{}
+	parse := func(s subnet, value string) (subnet, bool) {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil || !prefix.Addr().Is4() {
+			findings = append(findings, s.finding(codes.InvalidField, "%s is %q, expected an IPv4 prefix like 10.0.0.0/24", s.path, value))
+			return s, false
+		}
+		s.prefix = prefix.Masked()
+		return s, true
+	}
+
+	for _, object := range objects {
+		switch object.Kind {
+		case "IPv4Namespace":
+			items := wiring.Lookup(object.Node, "spec", "subnets")
+			if items == nil {
+				continue
+			}
+			for i, item := range items.Content {
+				s := subnet{object: object, namespace: object.Name, path: fmt.Sprintf("spec.subnets[%d]", i), line: item.Line, node: item}
+				if s, ok := parse(s, item.Value); ok {
+					namespaceSubnets = append(namespaceSubnets, s)
+				}
+			}
+		case "VPC":
+			namespace := wiring.Scalar(object.Node, "spec", "ipv4Namespace")
+			if namespace == "" {
+				namespace = "default"
+			}
+			subnets := wiring.Lookup(object.Node, "spec", "subnets")
+			if subnets == nil || subnets.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i+1 < len(subnets.Content); i += 2 {
+				name, spec := subnets.Content[i].Value, subnets.Content[i+1]
+				value := wiring.Lookup(spec, "subnet")
+				if value == nil {
+					continue
+				}
+				s := subnet{object: object, namespace: namespace, name: name, path: "spec.subnets." + name + ".subnet", line: value.Line, node: spec}
+				if s, ok := parse(s, value.Value); ok {
+					vpcSubnets = append(vpcSubnets, s)
+				}
+			}
+		}
+	}
+	return namespaceSubnets, vpcSubnets, findings
+}
+
+// checkSubnetOverlap reports overlapping prefixes within an IPv4 namespace,
+// VPC subnets outside the subnets of their namespace, and gateways or DHCP
+// ranges outside their subnet.
+func checkSubnetOverlap(objects []*wiring.Object) []Finding {
+	namespaceSubnets, vpcSubnets, findings := collectSubnets(objects)
+
+	for _, group := range [][]subnet{namespaceSubnets, vpcSubnets} {
+		for i, s := range group {
+			for _, other := range group[:i] {
+				if s.namespace == other.namespace && s.prefix.Overlaps(other.prefix) {
+					findings = append(findings, s.finding(codes.Overlap, "%s overlaps %s", s, other))
+				}
+			}
+		}
+	}
+
+	byNamespace := map[string][]netip.Prefix{}
+	for _, s := range namespaceSubnets {
+		byNamespace[s.namespace] = append(byNamespace[s.namespace], s.prefix)
+	}
+	for _, s := range vpcSubnets {
+		// Namespaces defined outside the bundle have unknown subnets
+		if allowed, ok := byNamespace[s.namespace]; ok && !containedIn(s.prefix, allowed) {
+			findings = append(findings, s.finding(codes.OutOfRange, "%s is outside the subnets %s of IPv4Namespace/%s",
+				s, joinPrefixes(allowed), s.namespace))
+		}
+
+		for _, field := range [][]string{{"gateway"}, {"dhcp", "range", "start"}, {"dhcp", "range", "end"}} {
+			node := wiring.Lookup(s.node, field...)
+			if node == nil || node.Kind != yaml.ScalarNode {
+				continue
+			}
+			path := "spec.subnets." + s.name + "." + strings.Join(field, ".")
+			addr, err := netip.ParseAddr(node.Value)
+			if err != nil || !s.prefix.Contains(addr) {
+				finding := s.finding(codes.OutOfRange, "%s %s is not an address of %s", path, node.Value, s.prefix)
+				finding.Line, finding.Path = node.Line, path
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// checkSubnetSizing reports VPC subnets with fewer usable addresses than
+// VPCAttachments.
+func checkSubnetSizing(objects []*wiring.Object) []Finding {
+	_, vpcSubnets, _ := collectSubnets(objects)
+
+	attachments := map[string]int{}
+	for _, object := range objects {
+		if object.Kind != "VPCAttachment" {
+			continue
+		}
+		ref := wiring.Scalar(object.Node, "spec", "subnet")
+		if !strings.Contains(ref, "/") {
+			ref += "/default"
+		}
+		attachments[ref]++
+	}
+
+	findings := []Finding{}
+	for _, s := range vpcSubnets {
+		attached := attachments[s.object.Name+"/"+s.name]
+		if usable := usableHosts(s.prefix); attached > usable {
+			findings = append(findings, s.finding(codes.SubnetTooSmall, "%s has room for %d hosts but %d VPCAttachments",
+				s, usable, attached))
+		}
+	}
+	return findings
+}
+
+// checkReservedSubnets reports subnets overlapping reserved address ranges or
+// the subnets the fabricator config reserves for the fabric.
+func checkReservedSubnets(objects []*wiring.Object) []Finding {
+	namespaceSubnets, vpcSubnets, _ := collectSubnets(objects)
+
+	type reserved struct {
+		name   string
+		prefix netip.Prefix
+	}
+	ranges := []reserved{}
+	for _, r := range reservedRanges {
+		ranges = append(ranges, reserved{r.name + " range", r.prefix})
+	}
+	if fab := fabricator(objects); fab != nil {
+		for _, field := range fabricatorSubnets {
+			value := wiring.Scalar(fab.Node, append([]string{"spec", "config"}, field...)...)
+			if prefix, err := netip.ParsePrefix(value); err == nil {
+				ranges = append(ranges, reserved{field[len(field)-1] + " of " + fab.Key(), prefix.Masked()})
+			}
+		}
+	}
+
+	findings := []Finding{}
+	for _, s := range append(namespaceSubnets, vpcSubnets...) {
+		for _, r := range ranges {
+			if s.prefix.Overlaps(r.prefix) {
+				findings = append(findings, s.finding(codes.Overlap, "%s overlaps the %s %s", s, r.name, r.prefix))
+			}
+		}
+	}
+	return findings
+}
+
+// usableHosts is the number of host addresses of a prefix less the gateway.
+func usableHosts(prefix netip.Prefix) int {
+	bits := 32 - prefix.Bits()
+	if bits < 2 {
+		return 0
+	}
+	return 1<<bits - 3
+}
+
+func containedIn(prefix netip.Prefix, subnets []netip.Prefix) bool {
+	for _, s := range subnets {
+		if s.Bits() <= prefix.Bits() && s.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPrefixes(prefixes []netip.Prefix) string {
+	parts := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, ", ")
+}
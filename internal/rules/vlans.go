@@ -0,0 +1,137 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// vlanRange is one range of a VLANNamespace, spec.ranges[i].
+type vlanRange struct {
+	namespace *wiring.Object
+	index     int
+	from, to  int
+	line      int
+}
+
+func (r vlanRange) String() string {
+	return fmt.Sprintf("%d-%d", r.from, r.to)
+}
+
+func (r vlanRange) path() string {
+	return fmt.Sprintf("spec.ranges[%d]", r.index)
+}
+
+// checkVLANRanges reports VLAN namespace ranges that overlap each other and
+// VPC subnet VLANs outside the ranges of the VPC's namespace.
+func checkVLANRanges(objects []*wiring.Object) []Finding {
+	findings := []Finding{}
+	ranges := []vlanRange{}
+	byNamespace := map[string][]vlanRange{}
+	for _, object := range objects {
+		if object.Kind != "VLANNamespace" {
+			continue
+		}
+		items := wiring.Lookup(object.Node, "spec", "ranges")
+		if items == nil {
+			continue
+		}
+		for i, item := range items.Content {
+			r := vlanRange{namespace: object, index: i, line: item.Line}
+			from, errFrom := strconv.Atoi(wiring.Scalar(item, "from"))
+			to, errTo := strconv.Atoi(wiring.Scalar(item, "to"))
+			if errFrom != nil || errTo != nil || from > to {
+				findings = append(findings, Finding{
+					Code:    codes.InvalidField,
+					Message: fmt.Sprintf("%s: %s must have numeric from <= to", object.Key(), r.path()),
+					Object:  object.Key(),
+					File:    object.File,
+					Line:    item.Line,
+					Path:    r.path(),
+				})
+				continue
+			}
+			r.from, r.to = from, to
+
+			for _, other := range ranges {
+				if r.from > other.to || other.from > r.to {
+					continue
+				}
+				findings = append(findings, Finding{
+					Code: codes.Overlap,
+					Message: fmt.Sprintf("%s: %s %s overlaps %s %s of %s",
+						object.Key(), r.path(), r, other.path(), other, other.namespace.Key()),
+					Object: object.Key(),
+					File:   object.File,
+					Line:   item.Line,
+					Path:   r.path(),
+				})
+			}
+			ranges = append(ranges, r)
+			byNamespace[object.Name] = append(byNamespace[object.Name], r)
+		}
+	}
+
+	for _, object := range objects {
+		if object.Kind != "VPC" {
+			continue
+		}
+		namespace := wiring.Scalar(object.Node, "spec", "vlanNamespace")
+		if namespace == "" {
+			namespace = "default"
+		}
+		// Namespaces defined outside the bundle, like the default one from
+		// the fabricator config, have unknown ranges
+		allowed, ok := byNamespace[namespace]
+		if !ok {
+			continue
+		}
+
+		subnets := wiring.Lookup(object.Node, "spec", "subnets")
+		if subnets == nil || subnets.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(subnets.Content); i += 2 {
+			name, vlanNode := subnets.Content[i].Value, wiring.Lookup(subnets.Content[i+1], "vlan")
+			if vlanNode == nil {
+				continue
+			}
+			vlan, err := strconv.Atoi(vlanNode.Value)
+			if err != nil || inRanges(vlan, allowed) {
+				continue
+			}
+			findings = append(findings, Finding{
+				Code: codes.OutOfRange,
+				Message: fmt.Sprintf("%s: subnet %s uses VLAN %d outside the ranges %s of VLANNamespace/%s",
+					object.Key(), name, vlan, joinRanges(allowed), namespace),
+				Object: object.Key(),
+				File:   object.File,
+				Line:   vlanNode.Line,
+				Path:   "spec.subnets." + name + ".vlan",
+			})
+		}
+	}
+	return findings
+}
+
+func inRanges(vlan int, ranges []vlanRange) bool {
+	for _, r := range ranges {
+		if vlan >= r.from && vlan <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+func joinRanges(ranges []vlanRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ", ")
+}
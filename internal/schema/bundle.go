@@ -0,0 +1,308 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// SourceEmbedded is the source of the schemas built into the validator.
+const SourceEmbedded = "embedded"
+
+//go:embed crds/*.yaml
+var embeddedCRDs embed.FS
+
+// Kind is a kind and version the bundle has a schema for, with the file it
+// was loaded from.
+type Kind struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Source     string `json:"source"`
+}
+
+// Bundle holds the schemas of the CRDs by apiVersion and kind.
+type Bundle struct {
+	schemas map[string]*Schema
+	kinds   map[string]Kind
+	groups  map[string]bool
+	// documents are the openAPIV3Schema documents as written, for
+	// exporting them
+	documents map[string]map[string]any
+}
+
+var (
+	embeddedOnce   sync.Once
+	embeddedBundle *Bundle
+	embeddedErr    error
+)
+
+// Embedded returns the bundle of CRDs built into the validator.
+func Embedded() (*Bundle, error) {
+	embeddedOnce.Do(func() {
+		embeddedBundle = &Bundle{schemas: map[string]*Schema{}, kinds: map[string]Kind{}, groups: map[string]bool{}, documents: map[string]map[string]any{}}
+		embeddedErr = embeddedBundle.loadFS(embeddedCRDs, "crds", SourceEmbedded)
+	})
+	return embeddedBundle, embeddedErr
+}
+
+// Load returns the embedded bundle updated with the CRDs of the *.yaml files
+// in dir, which replace embedded schemas of the same apiVersion and kind. An
+// empty dir returns the embedded bundle.
+func Load(dir string) (*Bundle, error) {
+	embedded, err := Embedded()
+	if err != nil || dir == "" {
+		return embedded, err
+	}
+
+	bundle := embedded.clone()
+	if err := bundle.loadFS(os.DirFS(dir), ".", dir); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func (b *Bundle) clone() *Bundle {
+	clone := &Bundle{schemas: map[string]*Schema{}, kinds: map[string]Kind{}, groups: map[string]bool{}, documents: map[string]map[string]any{}}
+	for key, schema := range b.schemas {
+		clone.schemas[key] = schema
+		clone.kinds[key] = b.kinds[key]
+		clone.documents[key] = b.documents[key]
+	}
+	for group := range b.groups {
+		clone.groups[group] = true
+	}
+	return clone
+}
+
+// loadFS adds the CRDs of the YAML files in dir of fsys. Files are named
+// after source in errors and kinds.
+func (b *Bundle) loadFS(fsys fs.FS, dir, source string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("reading schemas: %w", err)
+	}
+	for _, entry := range entries {
+		// Skip directories and the ..data style entries of mounted volumes
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("reading schema %s: %w", name, err)
+		}
+		file := name
+		if source != SourceEmbedded {
+			file = path.Join(source, name)
+		}
+		if err := b.addCRDs(data, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crd is the part of a CustomResourceDefinition the bundle needs.
+type crd struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		Group string `yaml:"group"`
+		Names struct {
+			Kind string `yaml:"kind"`
+		} `yaml:"names"`
+		Versions []struct {
+			Name   string `yaml:"name"`
+			Schema struct {
+				OpenAPIV3Schema *Schema `yaml:"openAPIV3Schema"`
+			} `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+// crdDocuments are the schemas of a CustomResourceDefinition as written.
+type crdDocuments struct {
+	Spec struct {
+		Versions []struct {
+			Schema struct {
+				OpenAPIV3Schema map[string]any `yaml:"openAPIV3Schema"`
+			} `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+// addCRDs adds every version of the CRDs of a multi-document file. Other
+// documents are ignored.
+func (b *Bundle) addCRDs(data []byte, file string) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		var doc crd
+		var documents crdDocuments
+		if err := dec.Decode(&node); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("parsing schema %s: %w", file, err)
+		}
+		if err := node.Decode(&doc); err != nil {
+			return fmt.Errorf("parsing schema %s: %w", file, err)
+		}
+		if doc.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		if err := node.Decode(&documents); err != nil {
+			return fmt.Errorf("parsing schema %s: %w", file, err)
+		}
+		for i, version := range doc.Spec.Versions {
+			schema := version.Schema.OpenAPIV3Schema
+			if schema == nil {
+				continue
+			}
+			if err := schema.compile(); err != nil {
+				return fmt.Errorf("schema %s: %s/%s: %w", file, doc.Spec.Names.Kind, version.Name, err)
+			}
+			apiVersion := doc.Spec.Group + "/" + version.Name
+			key := apiVersion + "/" + doc.Spec.Names.Kind
+			b.schemas[key] = schema
+			b.kinds[key] = Kind{APIVersion: apiVersion, Kind: doc.Spec.Names.Kind, Source: file}
+			b.groups[doc.Spec.Group] = true
+			b.documents[key] = documents.Spec.Versions[i].Schema.OpenAPIV3Schema
+		}
+	}
+}
+
+// Kinds lists the kinds of the bundle sorted by apiVersion and kind.
+func (b *Bundle) Kinds() []Kind {
+	kinds := make([]Kind, 0, len(b.kinds))
+	for _, kind := range b.kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if kinds[i].APIVersion != kinds[j].APIVersion {
+			return kinds[i].APIVersion < kinds[j].APIVersion
+		}
+		return kinds[i].Kind < kinds[j].Kind
+	})
+	return kinds
+}
+
+// Known reports whether the bundle has schemas of the API group of
+// apiVersion. Objects of other groups are not validated.
+func (b *Bundle) Known(apiVersion string) bool {
+	group, _, _ := strings.Cut(apiVersion, "/")
+	return b.groups[group]
+}
+
+// Validate checks an object against the schema of its apiVersion and kind.
+// Objects of a known group whose kind or version has no schema are reported,
+// unless the version is deprecated; metadata is only required to have a name.
+func (b *Bundle) Validate(object *wiring.Object) []Violation {
+	// Deprecated versions are left to the deprecated-api-versions warning
+	if !b.Known(object.APIVersion) || wiring.Replacement(object.APIVersion) != "" {
+		return nil
+	}
+	schema := b.schemas[object.APIVersion+"/"+object.Kind]
+	if schema == nil {
+		line := object.Line
+		if node := wiring.Lookup(object.Node, "kind"); node != nil {
+			line = node.Line
+		}
+		return []Violation{{
+			Code:    codes.UnknownKind,
+			Path:    "kind",
+			Line:    line,
+			Message: fmt.Sprintf("unknown kind %s in %s", object.Kind, object.APIVersion),
+		}}
+	}
+
+	// The API server handles apiVersion, kind and metadata itself
+	fields := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: object.Line}
+	for i := 0; i+1 < len(object.Node.Content); i += 2 {
+		switch object.Node.Content[i].Value {
+		case "apiVersion", "kind", "metadata":
+		default:
+			fields.Content = append(fields.Content, object.Node.Content[i], object.Node.Content[i+1])
+		}
+	}
+	violations := schema.validate(fields, "")
+	if object.Name == "" {
+		violations = append(violations, Violation{Code: codes.InvalidField, Path: "metadata.name", Line: object.Line, Message: "metadata.name is required"})
+	}
+	return violations
+}
+
+// WriteJSONSchemas writes the schemas to dir as JSON Schema files, named
+// <group>/<kind>_<version>.json with the kind in lower case, the layout
+// kubeconform finds them in. Strict schemas reject the fields of objects
+// they do not define, unless they preserve unknown fields.
+func (b *Bundle) WriteJSONSchemas(dir string, strict bool) error {
+	for key, document := range b.documents {
+		kind := b.kinds[key]
+		group, version, _ := strings.Cut(kind.APIVersion, "/")
+		data, err := json.Marshal(jsonSchema(document, strict))
+		if err != nil {
+			return fmt.Errorf("converting schema of %s: %w", key, err)
+		}
+		file := filepath.Join(dir, group, strings.ToLower(kind.Kind)+"_"+version+".json")
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonSchema converts an OpenAPI v3 schema to JSON Schema: nullable types
+// accept null and int-or-string fields either.
+func jsonSchema(document map[string]any, strict bool) map[string]any {
+	converted := make(map[string]any, len(document))
+	for key, value := range document {
+		switch value := value.(type) {
+		case map[string]any:
+			if key == "properties" {
+				properties := make(map[string]any, len(value))
+				for name, property := range value {
+					if property, ok := property.(map[string]any); ok {
+						properties[name] = jsonSchema(property, strict)
+					}
+				}
+				converted[key] = properties
+			} else {
+				converted[key] = jsonSchema(value, strict)
+			}
+		default:
+			converted[key] = value
+		}
+	}
+	if document["x-kubernetes-int-or-string"] == true {
+		delete(converted, "type")
+		converted["oneOf"] = []any{map[string]any{"type": "string"}, map[string]any{"type": "integer"}}
+	}
+	if typ, ok := converted["type"].(string); ok && document["nullable"] == true {
+		converted["type"] = []any{typ, "null"}
+	}
+	_, bounded := converted["additionalProperties"]
+	if strict && converted["type"] == "object" && !bounded && document["x-kubernetes-preserve-unknown-fields"] != true {
+		converted["additionalProperties"] = false
+	}
+	return converted
+}
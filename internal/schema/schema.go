@@ -0,0 +1,246 @@
+// Package schema validates objects against the OpenAPI schemas of the Fabric
+// and Fabricator CRDs, so uploads get field-level errors without hhfab. A
+// bundle of CRDs is embedded; newer ones can be loaded from a directory.
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+)
+
+// Schema is the subset of an OpenAPI v3 schema CRDs use that the validator
+// checks.
+type Schema struct {
+	Type                 string             `yaml:"type"`
+	Description          string             `yaml:"description"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	Items                *Schema            `yaml:"items"`
+	AdditionalProperties *Additional        `yaml:"additionalProperties"`
+	Enum                 []string           `yaml:"enum"`
+	Pattern              string             `yaml:"pattern"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MinLength            *int               `yaml:"minLength"`
+	MaxLength            *int               `yaml:"maxLength"`
+	MinItems             *int               `yaml:"minItems"`
+	MaxItems             *int               `yaml:"maxItems"`
+	Nullable             bool               `yaml:"nullable"`
+	PreserveUnknown      bool               `yaml:"x-kubernetes-preserve-unknown-fields"`
+	IntOrString          bool               `yaml:"x-kubernetes-int-or-string"`
+
+	pattern *regexp.Regexp
+}
+
+// Additional is the additionalProperties of a schema, either a schema for the
+// values of a map or a boolean allowing any.
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!bool" {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return node.Decode(a.Schema)
+}
+
+// Violation is a field of an object that does not match its schema. Path is
+// dotted like spec.ranges[0].from.
+type Violation struct {
+	Code    string
+	Path    string
+	Line    int
+	Message string
+}
+
+// compile prepares the patterns of s and its children.
+func (s *Schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+	for _, child := range s.Properties {
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil {
+		if err := s.AdditionalProperties.Schema.compile(); err != nil {
+			return err
+		}
+	}
+	return s.Items.compile()
+}
+
+// validate checks node, found at path, against s.
+func (s *Schema) validate(node *yaml.Node, path string) []Violation {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		// An empty value, like a bare spec:, is left out by the API server
+		return nil
+	}
+
+	violation := func(format string, args ...any) []Violation {
+		return []Violation{{Code: codes.InvalidField, Path: path, Line: node.Line, Message: fmt.Sprintf(format, args...)}}
+	}
+	if found, ok := s.matchesType(node); !ok {
+		return violation("%s must be %s, found %s", path, article(s.typeName()), found)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		return s.validateMapping(node, path)
+	case yaml.SequenceNode:
+		var violations []Violation
+		if s.MinItems != nil && len(node.Content) < *s.MinItems {
+			violations = append(violations, violation("%s must have at least %d items, has %d", path, *s.MinItems, len(node.Content))...)
+		}
+		if s.MaxItems != nil && len(node.Content) > *s.MaxItems {
+			violations = append(violations, violation("%s must have at most %d items, has %d", path, *s.MaxItems, len(node.Content))...)
+		}
+		if s.Items != nil {
+			for i, item := range node.Content {
+				violations = append(violations, s.Items.validate(item, path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+		return violations
+	}
+
+	if len(s.Enum) > 0 && !contains(s.Enum, node.Value) {
+		return violation("%s is %q, must be one of: %s", path, node.Value, strings.Join(s.Enum, ", "))
+	}
+	if s.pattern != nil && node.Tag == "!!str" && !s.pattern.MatchString(node.Value) {
+		return violation("%s is %q, must match %s", path, node.Value, s.Pattern)
+	}
+	if node.Tag == "!!str" {
+		length := len([]rune(node.Value))
+		if s.MinLength != nil && length < *s.MinLength {
+			return violation("%s must be at least %d characters long", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return violation("%s must be at most %d characters long", path, *s.MaxLength)
+		}
+	}
+	if node.Tag == "!!int" || node.Tag == "!!float" {
+		value, err := strconv.ParseFloat(node.Value, 64)
+		if err == nil && s.Minimum != nil && value < *s.Minimum {
+			return violation("%s is %s, must be at least %v", path, node.Value, *s.Minimum)
+		}
+		if err == nil && s.Maximum != nil && value > *s.Maximum {
+			return violation("%s is %s, must be at most %v", path, node.Value, *s.Maximum)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateMapping(node *yaml.Node, path string) []Violation {
+	var violations []Violation
+	present := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		present[key.Value] = true
+		child := join(path, key.Value)
+
+		switch {
+		case s.Properties[key.Value] != nil:
+			violations = append(violations, s.Properties[key.Value].validate(value, child)...)
+		case s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil:
+			violations = append(violations, s.AdditionalProperties.Schema.validate(value, child)...)
+		case s.PreserveUnknown, s.AdditionalProperties != nil && s.AdditionalProperties.Allowed, s.Properties == nil && s.AdditionalProperties == nil && s.Type == "":
+		default:
+			violations = append(violations, Violation{Code: codes.InvalidField, Path: child, Line: key.Line, Message: fmt.Sprintf("%s is not a known field", child)})
+		}
+	}
+	for _, name := range s.Required {
+		if !present[name] {
+			violations = append(violations, Violation{Code: codes.InvalidField, Path: join(path, name), Line: node.Line, Message: fmt.Sprintf("%s is required", join(path, name))})
+		}
+	}
+	return violations
+}
+
+// matchesType reports whether node has the schema's type, and if not what it
+// found instead.
+func (s *Schema) matchesType(node *yaml.Node) (string, bool) {
+	found := map[yaml.Kind]string{yaml.MappingNode: "an object", yaml.SequenceNode: "a list"}[node.Kind]
+	if node.Kind == yaml.ScalarNode {
+		found = fmt.Sprintf("%s %q", article(tagNames[node.Tag]), node.Value)
+	}
+
+	if s.IntOrString {
+		return found, node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!str")
+	}
+	switch s.Type {
+	case "":
+		return found, true
+	case "object":
+		return found, node.Kind == yaml.MappingNode
+	case "array":
+		return found, node.Kind == yaml.SequenceNode
+	case "string":
+		// Dates are strings once the YAML is converted to JSON
+		return found, node.Kind == yaml.ScalarNode && (node.Tag == "!!str" || node.Tag == "!!timestamp")
+	case "integer":
+		return found, node.Kind == yaml.ScalarNode && node.Tag == "!!int"
+	case "number":
+		return found, node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float")
+	case "boolean":
+		return found, node.Kind == yaml.ScalarNode && node.Tag == "!!bool"
+	}
+	return found, true
+}
+
+// tagNames and typeNames name YAML tags and schema types in messages.
+var (
+	tagNames  = map[string]string{"!!str": "string", "!!int": "integer", "!!float": "number", "!!bool": "boolean", "!!timestamp": "timestamp"}
+	typeNames = map[string]string{"object": "object", "array": "list", "string": "string", "integer": "integer", "number": "number", "boolean": "boolean"}
+)
+
+func (s *Schema) typeName() string {
+	if s.IntOrString {
+		return "integer or string"
+	}
+	return typeNames[s.Type]
+}
+
+// article prefixes a noun with a or an.
+func article(noun string) string {
+	if noun != "" && strings.ContainsRune("aeiou", rune(noun[0])) {
+		return "an " + noun
+	}
+	return "a " + noun
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// addressLists are the parsed prefixes of AccessConfig.
+type addressLists struct {
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	proxies []netip.Prefix
+}
+
+// parsePrefixes parses CIDR prefixes and bare addresses, which stand for
+// themselves alone.
+func parsePrefixes(field string, entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("access.%s: %q is neither an address nor a CIDR prefix", field, entry)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func loadAddressLists(cfg AccessConfig) (addressLists, error) {
+	var lists addressLists
+	var err error
+	if lists.allow, err = parsePrefixes("allow", cfg.Allow); err != nil {
+		return lists, err
+	}
+	if lists.deny, err = parsePrefixes("deny", cfg.Deny); err != nil {
+		return lists, err
+	}
+	if lists.proxies, err = parsePrefixes("trusted_proxies", cfg.TrustedProxies); err != nil {
+		return lists, err
+	}
+	return lists, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address a request came from: the peer, or the
+// last address of X-Forwarded-For the trusted proxies did not add when the
+// peer is one of them. The zero Addr is returned for peers that are no IP
+// addresses.
+func (l addressLists) clientAddr(r *http.Request) netip.Addr {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := peer.Addr().Unmap()
+	if !contains(l.proxies, addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !contains(l.proxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// clientAddress is clientAddr as a string, the address clients are rate
+// limited by. Peers that are no IP addresses are named as they are.
+func (l addressLists) clientAddress(r *http.Request) string {
+	if addr := l.clientAddr(r); addr.IsValid() {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
+
+// filterAddress rejects requests from addresses on the deny list, or off
+// the allow list when there is one, before they are authenticated.
+func (s *Server) filterAddress(c *gin.Context) {
+	lists := s.currentConfig().addresses
+	if len(lists.allow) == 0 && len(lists.deny) == 0 {
+		c.Next()
+		return
+	}
+	addr := lists.clientAddr(c.Request)
+	var list string
+	switch {
+	case contains(lists.deny, addr):
+		list = "deny"
+	case len(lists.allow) > 0 && !contains(lists.allow, addr):
+		list = "allow"
+	default:
+		c.Next()
+		return
+	}
+	addressesDenied.WithLabelValues(list).Inc()
+	abortProblem(c, http.StatusForbidden, gin.H{"error": fmt.Sprintf("address %s is not allowed", addr)})
+}
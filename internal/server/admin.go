@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errCancelled is the cause of validations cancelled by an admin.
+var errCancelled = errors.New("cancelled by an admin")
+
+// queueGate holds validations back while an admin paused the queue.
+type queueGate struct {
+	mu     sync.Mutex
+	paused bool
+	// resumed is closed by resume to wake the waiters
+	resumed chan struct{}
+}
+
+func newQueueGate() *queueGate {
+	return &queueGate{resumed: make(chan struct{})}
+}
+
+func (g *queueGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		g.paused = true
+		g.resumed = make(chan struct{})
+	}
+}
+
+func (g *queueGate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		g.paused = false
+		close(g.resumed)
+	}
+}
+
+func (g *queueGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks while the queue is paused or until ctx is done.
+func (g *queueGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	paused, resumed := g.paused, g.resumed
+	g.mu.Unlock()
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runningValidations keeps the cancel functions of the validations running
+// on this replica by ID: job IDs for jobs, request IDs for synchronous
+// validations. Of validations sharing an ID, the last one started is kept.
+type runningValidations struct {
+	mu      sync.Mutex
+	cancels map[string]*context.CancelCauseFunc
+}
+
+func newRunningValidations() *runningValidations {
+	return &runningValidations{cancels: map[string]*context.CancelCauseFunc{}}
+}
+
+// start registers a validation under id and returns its context, cancelled
+// with errCancelled by cancel, and the function to call once it finished.
+func (r *runningValidations) start(ctx context.Context, id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	r.mu.Lock()
+	r.cancels[id] = &cancel
+	r.mu.Unlock()
+	return ctx, func() {
+		r.mu.Lock()
+		if r.cancels[id] == &cancel {
+			delete(r.cancels, id)
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel cancels the validation running under id and reports whether there
+// was one.
+func (r *runningValidations) cancel(id string) bool {
+	r.mu.Lock()
+	cancel, ok := r.cancels[id]
+	r.mu.Unlock()
+	if ok {
+		(*cancel)(errCancelled)
+	}
+	return ok
+}
+
+// ids returns the IDs of the running validations, sorted.
+func (r *runningValidations) ids() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.cancels))
+	for id := range r.cancels {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// cancelledResult turns the result of a validation an admin cancelled into
+// a 503, keeping the output hhfab printed until then.
+func cancelledResult(ctx context.Context, status int, response ValidateResponse) (int, ValidateResponse) {
+	if !errors.Is(context.Cause(ctx), errCancelled) {
+		return status, response
+	}
+	response.Success = false
+	response.Message = "Validation cancelled"
+	response.Error = "the validation was " + errCancelled.Error()
+	return http.StatusServiceUnavailable, response
+}
+
+// paused answers synchronous validations refused while the queue is
+// paused with 503, telling the client when to retry.
+func (s *Server) paused(c *gin.Context, cfg *runtimeConfig) {
+	c.Header("Retry-After", strconv.Itoa(cfg.Workers.RetryAfterSec))
+	problem(c, http.StatusServiceUnavailable, ValidateResponse{
+		Success: false,
+		Message: "Validation paused",
+		Error:   fmt.Sprintf("an admin paused the validation queue, retry in %d seconds", cfg.Workers.RetryAfterSec),
+	})
+}
+
+// requireServerAdmin rejects admins of tenants other than the default one,
+// the admin endpoints act on the whole replica.
+func requireServerAdmin(c *gin.Context) {
+	if !isAdmin(c) {
+		abortProblem(c, http.StatusForbidden, gin.H{"error": "the admin endpoints are only for admins of the default tenant"})
+		return
+	}
+	c.Next()
+}
+
+// queueState returns the state of the queue of this replica.
+func (s *Server) queueState(ctx context.Context, cfg *runtimeConfig) (QueueState, error) {
+	active, waiting := s.pool.stats()
+	queued, err := s.jobs.Queued(ctx)
+	if err != nil {
+		return QueueState{}, err
+	}
+	return QueueState{
+		Paused:  s.gate.isPaused(),
+		Active:  active,
+		Workers: cfg.Workers.MaxConcurrent,
+		Waiting: waiting,
+		Queued:  queued,
+		Running: s.running.ids(),
+	}, nil
+}
+
+// sendQueueState answers with the state of the queue, setting drained for
+// drain requests.
+func (s *Server) sendQueueState(c *gin.Context, drained *bool) {
+	state, err := s.queueState(c.Request.Context(), s.currentConfig())
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	state.Drained = drained
+	sendJSON(c, http.StatusOK, state)
+}
+
+func (s *Server) getQueue(c *gin.Context) {
+	s.sendQueueState(c, nil)
+}
+
+// pauseQueue refuses synchronous validations and holds queued jobs back
+// until the queue is resumed. Running validations finish.
+func (s *Server) pauseQueue(c *gin.Context) {
+	s.gate.pause()
+	s.sendQueueState(c, nil)
+}
+
+func (s *Server) resumeQueue(c *gin.Context) {
+	s.gate.resume()
+	s.sendQueueState(c, nil)
+}
+
+// drainWorkers pauses the queue and waits for the running validations to
+// finish, at most for ?timeout= seconds, the validation timeout by default.
+// The queue stays paused until it is resumed.
+func (s *Server) drainWorkers(c *gin.Context) {
+	timeout := s.currentConfig().timeout()
+	if param := c.Query("timeout"); param != "" {
+		seconds, err := strconv.Atoi(param)
+		if err != nil || seconds <= 0 {
+			problem(c, http.StatusBadRequest, gin.H{"error": "timeout must be a positive number of seconds"})
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	s.gate.pause()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	drained := s.pool.idle(ctx)
+	s.sendQueueState(c, &drained)
+}
+
+// flushCaches removes the cached results and the idle workspaces, which are
+// initialized anew for the next validations.
+func (s *Server) flushCaches(c *gin.Context) {
+	cfg := s.currentConfig()
+	flushed := CacheFlush{}
+	if s.cache != nil {
+		n, err := s.cache.Flush(c.Request.Context())
+		if err != nil {
+			problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		flushed.Results = n
+	}
+	flushed.Workspaces = s.workspaces.drain()
+	if !cfg.schemaOnly() {
+		go s.workspaces.fill(cfg)
+	}
+	sendJSON(c, http.StatusOK, flushed)
+}
+
+// cancelJob cancels the validation running on this replica under the ID,
+// that of a job or the request ID of a synchronous validation. It is
+// answered with 503 and the output hhfab printed until then.
+func (s *Server) cancelJob(c *gin.Context) {
+	id := c.Param("id")
+	if s.running.cancel(id) {
+		sendJSON(c, http.StatusAccepted, Cancellation{ID: id, Cancelled: true})
+		return
+	}
+	job, err := s.jobs.Get(c.Request.Context(), id)
+	if errors.Is(err, ErrJobNotFound) {
+		problem(c, http.StatusNotFound, gin.H{"error": "no validation " + id + " is running"})
+		return
+	}
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	problem(c, http.StatusConflict, gin.H{"error": fmt.Sprintf("job %s is %s, not running on this replica", id, job.Status)})
+}
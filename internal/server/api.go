@@ -0,0 +1,95 @@
+package server
+
+import "validator/pkg/api"
+
+// The request and response schemas are shared with clients through pkg/api.
+type (
+	ValidateResponse     = api.ValidateResponse
+	Overload             = api.Overload
+	IdempotencyConflict  = api.IdempotencyConflict
+	Process              = api.Process
+	LimitExceeded        = api.LimitExceeded
+	UploadRejected       = api.UploadRejected
+	Summary              = api.Summary
+	IncrementalResult    = api.IncrementalResult
+	Diagram              = api.Diagram
+	Diagnostic           = api.Diagnostic
+	ObjectResult         = api.ObjectResult
+	HealthResponse       = api.HealthResponse
+	WorkerStatus         = api.WorkerStatus
+	ReadinessCheck       = api.ReadinessCheck
+	ReadinessResponse    = api.ReadinessResponse
+	CapabilitiesResponse = api.CapabilitiesResponse
+	BackendCapabilities  = api.BackendCapabilities
+	InfoResponse         = api.InfoResponse
+	Job                  = api.Job
+	StreamEvent          = api.StreamEvent
+	HistoryEntry         = api.HistoryEntry
+	HistoryResponse      = api.HistoryResponse
+	StatsResponse        = api.StatsResponse
+	DayStats             = api.DayStats
+	CodeStats            = api.CodeStats
+	WebhookEvent         = api.WebhookEvent
+	Problem              = api.Problem
+	QueueState           = api.QueueState
+	CacheFlush           = api.CacheFlush
+	Cancellation         = api.Cancellation
+	HHFabReleases        = api.HHFabReleases
+	HHFabInstall         = api.HHFabInstall
+	SelfTest             = api.SelfTest
+	SelfTestFixture      = api.SelfTestFixture
+)
+
+const (
+	ModeSchemaOnly = api.ModeSchemaOnly
+
+	ObjectPassed  = api.ObjectPassed
+	ObjectWarning = api.ObjectWarning
+	ObjectFailed  = api.ObjectFailed
+	ObjectUnknown = api.ObjectUnknown
+
+	SeverityError   = api.SeverityError
+	SeverityWarning = api.SeverityWarning
+
+	SourceHHFab       = api.SourceHHFab
+	SourceValidator   = api.SourceValidator
+	SourceSchema      = api.SourceSchema
+	SourceKubeconform = api.SourceKubeconform
+
+	StreamContentType = api.StreamContentType
+	StreamOutput      = api.StreamOutput
+	StreamResult      = api.StreamResult
+
+	JobQueued  = api.JobQueued
+	JobRunning = api.JobRunning
+	JobDone    = api.JobDone
+
+	RejectedBinary  = api.RejectedBinary
+	RejectedNUL     = api.RejectedNUL
+	RejectedDepth   = api.RejectedDepth
+	RejectedAliases = api.RejectedAliases
+
+	SchemaHeader     = api.SchemaHeader
+	SchemaVersion    = api.SchemaVersion
+	MinSchemaVersion = api.MinSchemaVersion
+
+	IdempotencyKeyHeader     = api.IdempotencyKeyHeader
+	IdempotentReplayedHeader = api.IdempotentReplayedHeader
+	IdempotencyMismatch      = api.IdempotencyMismatch
+	IdempotencyPending       = api.IdempotencyPending
+
+	ProblemContentType      = api.ProblemContentType
+	ProblemValidationFailed = api.ProblemValidationFailed
+	ProblemInvalidRequest   = api.ProblemInvalidRequest
+	ProblemUnauthorized     = api.ProblemUnauthorized
+	ProblemForbidden        = api.ProblemForbidden
+	ProblemNotFound         = api.ProblemNotFound
+	ProblemUploadTooLarge   = api.ProblemUploadTooLarge
+	ProblemImplausible      = api.ProblemImplausible
+	ProblemRateLimited      = api.ProblemRateLimited
+	ProblemOverloaded       = api.ProblemOverloaded
+	ProblemIdempotency      = api.ProblemIdempotency
+	ProblemConflict         = api.ProblemConflict
+	ProblemUnavailable      = api.ProblemUnavailable
+	ProblemInternal         = api.ProblemInternal
+)
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/audit"
+)
+
+// unaudited are the routes of probes and metrics scrapes, which carry no
+// user activity.
+var unaudited = map[string]bool{
+	"/health":  true,
+	"/livez":   true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// newAuditLogger starts the exporters of the configuration, nil without
+// any.
+func newAuditLogger(cfg AuditConfig) (*audit.Logger, error) {
+	var exporters []audit.Exporter
+	if cfg.Syslog != nil {
+		facility, appName := cfg.Syslog.Facility, cfg.Syslog.AppName
+		if facility == "" {
+			facility = "local0"
+		}
+		if appName == "" {
+			appName = "hh-validator"
+		}
+		exporter, err := audit.NewSyslog(cfg.Syslog.Address, facility, appName)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	if cfg.HTTP != nil {
+		exporters = append(exporters, audit.NewHEC(cfg.HTTP.URL, cfg.HTTP.Token, cfg.HTTP.Index, cfg.HTTP.SourceType))
+	}
+	if cfg.File != nil {
+		maxSize, maxBackups := cfg.File.MaxSizeMB, cfg.File.MaxBackups
+		if maxSize == 0 {
+			maxSize = 100
+		}
+		if maxBackups == 0 {
+			maxBackups = 5
+		}
+		exporter, err := audit.NewFile(cfg.File.Path, maxSize<<20, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		exporters = append(exporters, exporter)
+	}
+	return audit.NewLogger(exporters, audit.Hooks{
+		Exported: func(exporter string, events int, err error) {
+			result := "exported"
+			if err != nil {
+				result = "failed"
+			}
+			auditEvents.WithLabelValues(exporter, result).Add(float64(events))
+		},
+		Dropped: func() {
+			auditEvents.WithLabelValues("", "dropped").Inc()
+		},
+	}), nil
+}
+
+// validateAudit checks the exporters of the configuration.
+func validateAudit(cfg AuditConfig) error {
+	if cfg.Syslog != nil {
+		if cfg.Syslog.Address == "" {
+			return fmt.Errorf("audit.syslog.address is required")
+		}
+		if _, ok := audit.Facilities[cfg.Syslog.Facility]; cfg.Syslog.Facility != "" && !ok {
+			return fmt.Errorf("audit.syslog.facility %q is not a syslog facility", cfg.Syslog.Facility)
+		}
+	}
+	if cfg.HTTP != nil {
+		u, err := url.Parse(cfg.HTTP.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("audit.http.url %q must be an http(s) URL", cfg.HTTP.URL)
+		}
+		if cfg.HTTP.Token == "" {
+			return fmt.Errorf("audit.http.token is required")
+		}
+	}
+	if cfg.File != nil {
+		if cfg.File.Path == "" {
+			return fmt.Errorf("audit.file.path is required")
+		}
+		if cfg.File.MaxSizeMB < 0 || cfg.File.MaxBackups < 0 {
+			return fmt.Errorf("audit.file values must not be negative")
+		}
+	}
+	return nil
+}
+
+// auditRequest records an audit event for the request once it is answered,
+// including requests identify rejects.
+func (s *Server) auditRequest(c *gin.Context) {
+	if s.audit == nil || unaudited[c.Request.URL.Path] {
+		c.Next()
+		return
+	}
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	status := c.Writer.Status()
+	event := audit.Event{
+		Time:          start,
+		RequestID:     c.GetString(requestIDKey),
+		Action:        c.Request.Method + " " + route,
+		Path:          c.Request.URL.Path,
+		Outcome:       audit.OutcomeOf(status),
+		Status:        status,
+		Tenant:        c.GetString(tenantKey),
+		Role:          c.GetString(roleKey),
+		Authenticated: c.GetBool(authenticatedKey),
+		ClientIP:      s.currentConfig().addresses.clientAddress(c.Request),
+		UserAgent:     c.Request.UserAgent(),
+		DurationMS:    time.Since(start).Milliseconds(),
+	}
+	s.audit.Log(event)
+}
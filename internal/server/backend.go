@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+
+	"validator/internal/hhfabmock"
+)
+
+// The backends validations are run with.
+const (
+	// BackendHHFab runs the hhfab at hhfab_path
+	BackendHHFab = "hhfab"
+	// BackendMock answers with the canned results of the hhfabmock package,
+	// for developing without hhfab
+	BackendMock = "mock"
+	// BackendSchemaOnly never runs hhfab, validating against the schemas
+	// and native checks alone
+	BackendSchemaOnly = "schema-only"
+)
+
+// errUnsupported is returned by backends for what their capabilities do not
+// include.
+var errUnsupported = errors.New("not supported by this backend")
+
+// Validator is the backend validations are run with, selected by the
+// backend setting. Backends running hhfab initialize the workspaces
+// validations run in, others leave the uploads to the schemas and native
+// checks.
+type Validator interface {
+	// Capabilities reports what the backend supports
+	Capabilities() BackendCapabilities
+	// Available fails when the backend cannot validate, such as when hhfab
+	// is not installed
+	Available() error
+	// Version reports the version of hhfab, empty if there is none
+	Version(ctx context.Context) (string, error)
+	// Init runs `hhfab init` with args in dir and returns its output
+	Init(ctx context.Context, dir string, args ...string) ([]byte, error)
+	// Generate runs `hhfab vlab gen` with args in a directory initialized
+	// by Init and returns its output
+	Generate(ctx context.Context, dir string, args ...string) ([]byte, error)
+	// Validate runs `hhfab validate` in dir, writing its output to output,
+	// and returns how it ran, nil when it could not be started
+	Validate(ctx context.Context, dir string, output io.Writer) (*Process, error)
+}
+
+// validator returns the backend of cfg. The hhfab backend falls back to
+// schema-only while hhfab is not installed and schema_only_fallback is set.
+func (c *runtimeConfig) validator() Validator {
+	switch c.Backend {
+	case BackendMock:
+		return mockValidator()
+	case BackendSchemaOnly:
+		return schemaOnlyValidator{}
+	}
+	hhfab := hhfabValidator(c.HHFabPath, c.Resources)
+	if c.SchemaOnlyFallback && hhfab.Available() != nil {
+		return schemaOnlyValidator{}
+	}
+	return hhfab
+}
+
+// hhfab names the hhfab validations run, for telling apart the workspaces
+// and cached results of different ones.
+func (c *runtimeConfig) hhfab() string {
+	if c.Backend == BackendMock {
+		return BackendMock
+	}
+	return c.HHFabPath
+}
+
+// execValidator runs an hhfab executable.
+type execValidator struct {
+	capabilities BackendCapabilities
+	path         string
+	// env is added to the environment of hhfab
+	env       []string
+	resources ResourcesConfig
+}
+
+// hhfabValidator runs the hhfab at path within the resources limits.
+func hhfabValidator(path string, resources ResourcesConfig) *execValidator {
+	return &execValidator{
+		capabilities: BackendCapabilities{Name: BackendHHFab, HHFab: true, Samples: true, Benchmark: true, ResourceLimits: true, Canary: true},
+		path:         path,
+		resources:    resources,
+	}
+}
+
+// mockValidator runs this executable as the mock hhfab, which answers
+// without limits.
+func mockValidator() *execValidator {
+	executable, err := os.Executable()
+	if err != nil {
+		// Fails to start like a missing hhfab
+		executable = os.Args[0]
+	}
+	return &execValidator{
+		capabilities: BackendCapabilities{Name: BackendMock, HHFab: true, Samples: true, Benchmark: true},
+		path:         executable,
+		env:          []string{hhfabmock.Env + "=1"},
+	}
+}
+
+func (b *execValidator) Capabilities() BackendCapabilities {
+	return b.capabilities
+}
+
+func (b *execValidator) Available() error {
+	_, err := exec.LookPath(b.path)
+	return err
+}
+
+func (b *execValidator) Version(ctx context.Context) (string, error) {
+	output, err := b.command(ctx, "", "--version").Output()
+	return string(output), err
+}
+
+func (b *execValidator) Init(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return b.command(ctx, dir, append([]string{"init"}, args...)...).CombinedOutput()
+}
+
+func (b *execValidator) Generate(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	return b.command(ctx, dir, append([]string{"vlab", "gen"}, args...)...).CombinedOutput()
+}
+
+func (b *execValidator) Validate(ctx context.Context, dir string, output io.Writer) (*Process, error) {
+	return runHHFab(ctx, b.command(ctx, dir, "validate"), b.resources, output)
+}
+
+// command returns the command running hhfab with args in dir.
+func (b *execValidator) command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, b.path, args...)
+	cmd.Dir = dir
+	if len(b.env) > 0 {
+		cmd.Env = append(os.Environ(), b.env...)
+	}
+	return cmd
+}
+
+// schemaOnlyValidator runs no hhfab at all.
+type schemaOnlyValidator struct{}
+
+func (schemaOnlyValidator) Capabilities() BackendCapabilities {
+	return BackendCapabilities{Name: BackendSchemaOnly}
+}
+
+func (schemaOnlyValidator) Available() error {
+	return nil
+}
+
+func (schemaOnlyValidator) Version(context.Context) (string, error) {
+	return "", nil
+}
+
+func (schemaOnlyValidator) Init(context.Context, string, ...string) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (schemaOnlyValidator) Generate(context.Context, string, ...string) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (schemaOnlyValidator) Validate(context.Context, string, io.Writer) (*Process, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"io"
+	"mime/multipart"
+
+	"validator/pkg/api"
+)
+
+// The baseline format is shared with clients through pkg/api.
+type (
+	Baseline      = api.Baseline
+	BaselineEntry = api.BaselineEntry
+)
+
+// readBaseline parses an uploaded baseline.
+func readBaseline(file *multipart.FileHeader) (*Baseline, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return api.ParseBaseline(data)
+}
+
+// splitBaseline separates the diagnostics baseline lists. A nil baseline
+// lists none.
+func splitBaseline(b *Baseline, diagnostics []Diagnostic) (kept, baselined []Diagnostic) {
+	known := map[BaselineEntry]bool{}
+	if b != nil {
+		for _, entry := range b.Findings {
+			known[entry.Key()] = true
+		}
+	}
+
+	kept, baselined = []Diagnostic{}, []Diagnostic{}
+	for _, d := range diagnostics {
+		entry := BaselineEntry{Code: d.Code, Object: d.Object, Path: d.Path, Message: d.Message}
+		if known[entry.Key()] {
+			baselined = append(baselined, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	return kept, baselined
+}
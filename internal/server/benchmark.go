@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Iterations of a benchmark request.
+const (
+	defaultBenchmarkIterations = 10
+	maxBenchmarkIterations     = 100
+)
+
+// benchmarkWiring is the known-good fabric every benchmark iteration
+// validates.
+//
+//go:embed fixtures/benchmark.yaml
+var benchmarkWiring []byte
+
+// BenchmarkRequest parametrizes a benchmark. An omitted Iterations runs 10,
+// the n query parameter overrides it.
+type BenchmarkRequest struct {
+	Iterations int `json:"iterations"`
+}
+
+// BenchmarkResponse reports the latencies of hhfab init and validate over
+// the iterations of a benchmark, for capacity planning and comparing hhfab
+// versions.
+type BenchmarkResponse struct {
+	Success      bool          `json:"success"`
+	HHFabVersion string        `json:"hhfab_version,omitempty"`
+	Iterations   int           `json:"iterations"`
+	Init         *LatencyStats `json:"init,omitempty"`
+	Validate     *LatencyStats `json:"validate,omitempty"`
+	Output       string        `json:"output,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// LatencyStats summarizes the durations of a step in milliseconds.
+type LatencyStats struct {
+	MinMs  float64 `json:"min_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// newLatencyStats summarizes durations, of which there is at least one.
+// Percentiles are the nearest rank.
+func newLatencyStats(durations []time.Duration) *LatencyStats {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+	percentile := func(p int) float64 {
+		rank := (p*len(sorted) + 99) / 100
+		return ms(sorted[rank-1])
+	}
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return &LatencyStats{
+		MinMs:  ms(sorted[0]),
+		MeanMs: ms(total / time.Duration(len(sorted))),
+		P50Ms:  percentile(50),
+		P90Ms:  percentile(90),
+		P99Ms:  percentile(99),
+		MaxMs:  ms(sorted[len(sorted)-1]),
+	}
+}
+
+// postBenchmark validates the bundled fixture the requested number of times,
+// each in a freshly initialized workspace, and reports the latencies of
+// hhfab init and validate. Every iteration waits for a worker like a
+// validation, so a benchmark measures the server without starving it.
+func (s *Server) postBenchmark(c *gin.Context) {
+	cfg := s.currentConfig()
+	request := BenchmarkRequest{Iterations: defaultBenchmarkIterations}
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		problem(c, http.StatusBadRequest, BenchmarkResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+	if n, ok := c.GetQuery("n"); ok {
+		iterations, err := strconv.Atoi(n)
+		if err != nil {
+			problem(c, http.StatusBadRequest, BenchmarkResponse{Error: fmt.Sprintf("invalid n %q, must be a number", n)})
+			return
+		}
+		request.Iterations = iterations
+	}
+	if request.Iterations < 1 || request.Iterations > maxBenchmarkIterations {
+		problem(c, http.StatusBadRequest, BenchmarkResponse{Error: fmt.Sprintf("iterations must be between 1 and %d", maxBenchmarkIterations)})
+		return
+	}
+	backend := cfg.validator()
+	if !backend.Capabilities().Benchmark {
+		problem(c, http.StatusServiceUnavailable, BenchmarkResponse{Error: "hhfab is not available: the " + backend.Capabilities().Name + " backend does not run it"})
+		return
+	}
+	if err := backend.Available(); err != nil {
+		problem(c, http.StatusServiceUnavailable, BenchmarkResponse{Error: "hhfab is not available: " + err.Error()})
+		return
+	}
+
+	s.selfCheckMu.RLock()
+	response := BenchmarkResponse{HHFabVersion: s.lastSelfCheck.version, Iterations: request.Iterations}
+	s.selfCheckMu.RUnlock()
+
+	inits, validates := []time.Duration{}, []time.Duration{}
+	for i := 0; i < request.Iterations; i++ {
+		initTime, validateTime, output, err := s.benchmarkIteration(c.Request.Context(), cfg)
+		if err != nil {
+			response.Error = fmt.Sprintf("iteration %d: %s", i+1, err)
+			response.Output = string(output)
+			problem(c, http.StatusInternalServerError, response)
+			return
+		}
+		inits, validates = append(inits, initTime), append(validates, validateTime)
+	}
+
+	response.Success = true
+	response.Init = newLatencyStats(inits)
+	response.Validate = newLatencyStats(validates)
+	sendJSON(c, http.StatusOK, response)
+}
+
+// benchmarkIteration initializes a workspace and validates the fixture in
+// it, returning how long each took. The output of hhfab is returned when it
+// fails.
+func (s *Server) benchmarkIteration(ctx context.Context, cfg *runtimeConfig) (time.Duration, time.Duration, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	if err := s.pool.acquire(ctx); err != nil {
+		return 0, 0, nil, fmt.Errorf("timed out waiting for a free worker: %w", err)
+	}
+	defer s.pool.release()
+
+	started := time.Now()
+	ws, output, err := newWorkspace(ctx, cfg)
+	if err != nil {
+		return 0, 0, output, err
+	}
+	defer ws.remove()
+	initTime := time.Since(started)
+
+	if err := os.WriteFile(filepath.Join(ws.includeDir(), "wiring.yaml"), benchmarkWiring, 0644); err != nil {
+		return 0, 0, nil, err
+	}
+	started = time.Now()
+	var validateOutput bytes.Buffer
+	if _, err := cfg.validator().Validate(ctx, ws.dir, &validateOutput); err != nil {
+		return 0, 0, validateOutput.Bytes(), fmt.Errorf("hhfab validate failed on the benchmark fixture: %w", err)
+	}
+	return initTime, time.Since(started), nil, nil
+}
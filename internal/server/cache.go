@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache backends of the cache setting.
+const (
+	CacheNone   = "none"
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+)
+
+// ErrCacheMiss is returned for results that are not cached.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CachedResult is the response of a validation with its status code.
+type CachedResult struct {
+	Status   int              `json:"status"`
+	Response ValidateResponse `json:"response"`
+}
+
+// ResultCache keeps the results of validations by the hash of everything
+// they depend on, so identical requests are answered without running hhfab.
+// Implementations must be safe for concurrent use.
+type ResultCache interface {
+	// Get returns a cached result, ErrCacheMiss if there is none.
+	Get(ctx context.Context, key string) (*CachedResult, error)
+	// Set caches a result.
+	Set(ctx context.Context, key string, result *CachedResult) error
+	// Flush removes every cached result and returns how many there were.
+	Flush(ctx context.Context) (int, error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// newResultCache returns the cache of the configured backend, nil for none.
+func newResultCache(cfg CacheConfig) (ResultCache, error) {
+	ttl := time.Duration(cfg.TTLSec) * time.Second
+	switch cfg.Backend {
+	case CacheNone:
+		return nil, nil
+	case CacheMemory:
+		return NewMemoryCache(cfg.MaxEntries, ttl), nil
+	case CacheRedis:
+		return NewRedisCache(cfg.RedisURL, cfg.KeyPrefix, ttl)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// resultKey hashes a request together with what its result depends on
+// besides the uploads: the server and hhfab versions and the configuration,
+// including the content of the schemas and plugins directories.
+func resultKey(cfg *runtimeConfig, request *JobRequest, hhfabVersion string) (string, error) {
+	data, err := json.Marshal(struct {
+		Version      string      `json:"version"`
+		HHFabVersion string      `json:"hhfab_version"`
+		SchemaOnly   bool        `json:"schema_only"`
+		Config       string      `json:"config"`
+		Request      *JobRequest `json:"request"`
+	}{Version, hhfabVersion, cfg.schemaOnly(), cfg.fingerprint, request.withoutData()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// configFingerprint hashes the settings and the files of the directories
+// that change validation results.
+func configFingerprint(cfg Config) (string, error) {
+	hash := sha256.New()
+	settings, err := json.Marshal(struct {
+		HHFabPath   string
+		Backend     string
+		Profiles    any
+		Kubeconform KubeconformConfig
+		Style       StyleConfig
+	}{cfg.HHFabPath, cfg.Backend, cfg.Profiles, cfg.Kubeconform, cfg.Style})
+	if err != nil {
+		return "", err
+	}
+	hash.Write(settings)
+	for _, dir := range []string{cfg.SchemasDir, cfg.PluginsDir} {
+		if dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s\x00%d\x00", path, len(data))
+			hash.Write(data)
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("hashing %s: %w", dir, err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cachedResult looks the key of a request up in the result cache.
+func (s *Server) cachedResult(ctx context.Context, key string) (*CachedResult, bool) {
+	if key == "" {
+		return nil, false
+	}
+	result, err := s.cache.Get(ctx, key)
+	switch {
+	case err == nil:
+		cacheLookups.WithLabelValues("hit").Inc()
+		result.Response.Cached = true
+		return result, true
+	case errors.Is(err, ErrCacheMiss):
+		cacheLookups.WithLabelValues("miss").Inc()
+	default:
+		cacheLookups.WithLabelValues("error").Inc()
+		log.Printf("Result cache lookup failed: %v", err)
+	}
+	return nil, false
+}
+
+// cacheResult caches the result of a validation. Server errors are not
+// cached, the next request may not run into them.
+func (s *Server) cacheResult(ctx context.Context, key string, status int, response ValidateResponse) {
+	if key == "" || status >= http.StatusInternalServerError {
+		return
+	}
+	if err := s.cache.Set(ctx, key, &CachedResult{Status: status, Response: response}); err != nil {
+		log.Printf("Caching result failed: %v", err)
+	}
+}
+
+// requestKey returns the cache key of a request, "" when it is not cached.
+func (s *Server) requestKey(cfg *runtimeConfig, request *JobRequest) string {
+	if s.cache == nil || request.NoCache {
+		return ""
+	}
+	key, err := resultKey(cfg, request, s.hhfabVersion())
+	if err != nil {
+		log.Printf("Hashing request failed: %v", err)
+		return ""
+	}
+	return key
+}
+
+// memoryCache keeps results in the process, the oldest are evicted once it
+// holds maxEntries.
+type memoryCache struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	order      []string
+	maxEntries int
+	ttl        time.Duration
+}
+
+type memoryEntry struct {
+	result  CachedResult
+	expires time.Time
+}
+
+// NewMemoryCache returns a ResultCache of up to maxEntries results in
+// memory, each kept for ttl.
+func NewMemoryCache(maxEntries int, ttl time.Duration) ResultCache {
+	return &memoryCache{entries: map[string]memoryEntry{}, maxEntries: maxEntries, ttl: ttl}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) (*CachedResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, ErrCacheMiss
+	}
+	result := entry.result
+	return &result, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, result *CachedResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = memoryEntry{result: *result, expires: time.Now().Add(c.ttl)}
+	for len(c.order) > c.maxEntries {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	return nil
+}
+
+func (c *memoryCache) Flush(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries, c.order = map[string]memoryEntry{}, nil
+	return n, nil
+}
+
+func (c *memoryCache) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *memoryCache) Close() error {
+	return nil
+}
+
+// redisCache shares results between replicas, under <prefix>:result:<key>.
+type redisCache struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisCache returns a ResultCache in the Redis server at url with keys
+// starting with prefix, each result kept for ttl.
+func NewRedisCache(url, prefix string, ttl time.Duration) (ResultCache, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis_url: %w", err)
+	}
+	return &redisCache{client: redis.NewClient(options), prefix: prefix, ttl: ttl}, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) (*CachedResult, error) {
+	data, err := c.client.Get(ctx, c.prefix+":result:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &CachedResult{}
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("reading cached result: %w", err)
+	}
+	return result, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, result *CachedResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.prefix+":result:"+key, data, c.ttl).Err()
+}
+
+// Flush deletes the results by scanning for their keys, so other replicas
+// keep using Redis meanwhile.
+func (c *redisCache) Flush(ctx context.Context) (int, error) {
+	n := 0
+	iter := c.client.Scan(ctx, 0, c.prefix+":result:*", 100).Iterator()
+	for iter.Next(ctx) {
+		deleted, err := c.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			return n, err
+		}
+		n += int(deleted)
+	}
+	return n, iter.Err()
+}
+
+func (c *redisCache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// canaryWanted reports whether a validation is also run with the candidate
+// hhfab of canary: when the request asks for it, or sampled.
+func canaryWanted(cfg *runtimeConfig, request *JobRequest) bool {
+	if cfg.Canary.HHFabPath == "" || !cfg.validator().Capabilities().Canary {
+		return false
+	}
+	return request.Canary || rand.Float64() < cfg.Canary.SampleRate
+}
+
+// runCanary validates request with the candidate hhfab once a worker is
+// free and compares the result with status and response, those of
+// hhfab_path, logging where they diverge. The uploads of the request must
+// have been loaded, it outlives the directory they were streamed to.
+// Candidate workspaces have a pool of their own so the two hhfabs do not
+// refresh each other's.
+func (s *Server) runCanary(cfg *runtimeConfig, request *JobRequest, status int, response ValidateResponse) {
+	// Server errors, such as timeouts, say nothing about the candidate
+	if status >= http.StatusInternalServerError {
+		return
+	}
+	candidate := *cfg
+	candidate.HHFabPath = cfg.Canary.HHFabPath
+	if err := hhfabValidator(candidate.HHFabPath, cfg.Resources).Available(); err != nil {
+		canaryValidations.WithLabelValues("error").Inc()
+		log.Printf("Canary hhfab not found: %v", err)
+		return
+	}
+
+	// ctx never ends, so acquire only returns once a worker is free
+	ctx := context.Background()
+	s.pool.acquire(ctx)
+	defer s.pool.release()
+
+	tempDir, err := makeTempDir("validator-canary-*")
+	if err != nil {
+		canaryValidations.WithLabelValues("error").Inc()
+		log.Printf("Failed to create a temporary directory for the canary: %v", err)
+		return
+	}
+	defer removeTempDir(tempDir)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	v := &validation{cfg: &candidate, request: request, dir: tempDir, workspaces: s.canaryWorkspaces, started: time.Now()}
+	candidateStatus, candidateResponse := v.run(ctx)
+
+	divergences := canaryDivergences(status, response, candidateStatus, candidateResponse)
+	if len(divergences) == 0 {
+		canaryValidations.WithLabelValues("match").Inc()
+		return
+	}
+	canaryValidations.WithLabelValues("diverged").Inc()
+	files := make([]string, len(request.Wiring))
+	for i, upload := range request.Wiring {
+		files[i] = upload.Name
+	}
+	log.Printf("Canary hhfab %s diverged from %s validating %s: %s", candidate.HHFabPath, cfg.HHFabPath, strings.Join(files, ", "), strings.Join(divergences, "; "))
+}
+
+// canaryDivergences lists how the result of the candidate hhfab differs
+// from that of the current one: in the status, in success, and by the
+// diagnostics only one of them found. Output and durations are expected to
+// differ and are not compared.
+func canaryDivergences(status int, response ValidateResponse, candidateStatus int, candidate ValidateResponse) []string {
+	divergences := []string{}
+	if status != candidateStatus {
+		divergence := fmt.Sprintf("status %d, candidate %d", status, candidateStatus)
+		if candidateStatus >= http.StatusInternalServerError && candidate.Error != "" {
+			divergence += ": " + candidate.Error
+		}
+		divergences = append(divergences, divergence)
+	}
+	if response.Success != candidate.Success {
+		divergences = append(divergences, fmt.Sprintf("success %t, candidate %t", response.Success, candidate.Success))
+	}
+
+	// Diagnostics are compared as multisets, in no particular order
+	counts := map[string]int{}
+	for _, d := range response.Diagnostics {
+		counts[diagnosticKey(d)]++
+	}
+	for _, d := range candidate.Diagnostics {
+		counts[diagnosticKey(d)]--
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch n := counts[key]; {
+		case n > 0:
+			divergences = append(divergences, "only current: "+key)
+		case n < 0:
+			divergences = append(divergences, "only candidate: "+key)
+		}
+	}
+	return divergences
+}
+
+// diagnosticKey identifies a diagnostic for comparing results.
+func diagnosticKey(d Diagnostic) string {
+	key := d.Severity
+	if d.Code != "" {
+		key += " " + d.Code
+	}
+	if d.File != "" {
+		key += fmt.Sprintf(" %s:%d", d.File, d.Line)
+	}
+	if d.Object != "" {
+		key += " " + d.Object
+	}
+	return key + ": " + d.Message
+}
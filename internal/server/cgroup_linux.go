@@ -0,0 +1,150 @@
+//go:build linux
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// cgroupsSupported reports whether resource limits can be applied on this
+// platform.
+const cgroupsSupported = true
+
+// cgroup2Magic is the filesystem type of cgroup v2 mounts.
+const cgroup2Magic = 0x63677270
+
+// cgroup is a transient cgroup v2 an hhfab process runs in. The nil cgroup
+// applies no limits.
+type cgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// newCgroup creates a cgroup below cfg.CgroupRoot with the limits of cfg,
+// enabling the controllers it needs for the children of the root.
+func newCgroup(cfg ResourcesConfig) (*cgroup, error) {
+	if err := os.MkdirAll(cfg.CgroupRoot, 0755); err != nil {
+		return nil, err
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(cfg.CgroupRoot, &st); err != nil {
+		return nil, err
+	}
+	if st.Type != cgroup2Magic {
+		return nil, fmt.Errorf("%s is not on a cgroup v2 filesystem", cfg.CgroupRoot)
+	}
+
+	limits := [][2]string{}
+	controllers := []string{}
+	if cfg.CPUs > 0 {
+		controllers = append(controllers, "+cpu")
+		limits = append(limits, [2]string{"cpu.max", fmt.Sprintf("%d 100000", int64(cfg.CPUs*100000))})
+	}
+	if cfg.MemoryMB > 0 {
+		controllers = append(controllers, "+memory")
+		limits = append(limits,
+			[2]string{"memory.max", strconv.FormatInt(cfg.MemoryMB*1024*1024, 10)},
+			[2]string{"memory.swap.max", "0"},
+			// Child processes go along with the one killed
+			[2]string{"memory.oom.group", "1"})
+	}
+	if cfg.MaxPids > 0 {
+		controllers = append(controllers, "+pids")
+		limits = append(limits, [2]string{"pids.max", strconv.Itoa(cfg.MaxPids)})
+	}
+	if err := os.WriteFile(filepath.Join(cfg.CgroupRoot, "cgroup.subtree_control"), []byte(strings.Join(controllers, " ")), 0); err != nil {
+		return nil, fmt.Errorf("enabling the controllers of %s: %w", cfg.CgroupRoot, err)
+	}
+
+	dir, err := os.MkdirTemp(cfg.CgroupRoot, "hhfab-")
+	if err != nil {
+		return nil, err
+	}
+	g := &cgroup{dir: dir}
+	for _, limit := range limits {
+		err := os.WriteFile(filepath.Join(dir, limit[0]), []byte(limit[1]), 0)
+		// Without swap accounting there is no swap to limit
+		if err != nil && !(limit[0] == "memory.swap.max" && errors.Is(err, os.ErrNotExist)) {
+			g.remove()
+			return nil, fmt.Errorf("setting %s: %w", limit[0], err)
+		}
+	}
+	if g.fd, err = os.Open(dir); err != nil {
+		g.remove()
+		return nil, err
+	}
+	return g, nil
+}
+
+// apply has cmd start in the cgroup.
+func (g *cgroup) apply(cmd *exec.Cmd) {
+	if g == nil {
+		return
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(g.fd.Fd())
+}
+
+// exceeded returns the limit the processes of the cgroup broke: memory
+// when they were killed for running out of it, pids when they could not
+// fork. It is empty if they kept within the limits.
+func (g *cgroup) exceeded() string {
+	if g == nil {
+		return ""
+	}
+	if cgroupEvent(filepath.Join(g.dir, "memory.events"), "oom_kill") > 0 {
+		return "memory"
+	}
+	if cgroupEvent(filepath.Join(g.dir, "pids.events"), "max") > 0 {
+		return "pids"
+	}
+	return ""
+}
+
+// remove kills the processes left in the cgroup and removes it.
+func (g *cgroup) remove() {
+	if g == nil {
+		return
+	}
+	if g.fd != nil {
+		g.fd.Close()
+	}
+	_ = os.WriteFile(filepath.Join(g.dir, "cgroup.kill"), []byte("1"), 0)
+	// The cgroup is busy until the killed processes are gone
+	for i := 0; i < 50; i++ {
+		if err := syscall.Rmdir(g.dir); err == nil || errors.Is(err, syscall.ENOENT) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// cgroupEvent returns the count of the event in a cgroup events file.
+func cgroupEvent(path, event string) int64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, _ := strings.Cut(scanner.Text(), " ")
+		if name == event {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const cgroupsSupported = false
+
+type cgroup struct{}
+
+func newCgroup(cfg ResourcesConfig) (*cgroup, error) {
+	return nil, errors.New("resource limits need Linux cgroups v2")
+}
+
+func (g *cgroup) apply(cmd *exec.Cmd) {}
+
+func (g *cgroup) exceeded() string { return "" }
+
+func (g *cgroup) remove() {}
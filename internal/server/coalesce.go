@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// flightGroup coalesces identical validations running at the same time on a
+// replica: the first one runs hhfab, the others wait for its result instead
+// of taking a worker of their own. Pipelines fanning out across environments
+// often submit the same files at once.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a validation others wait for. done is closed once it finished or
+// was abandoned; ok tells which.
+type flight struct {
+	group    *flightGroup
+	key      string
+	done     chan struct{}
+	ok       bool
+	status   int
+	response ValidateResponse
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: map[string]*flight{}}
+}
+
+// join returns the running flight of key, or registers a new one the caller
+// leads, reported by leading. An empty key is never coalesced and returns a
+// nil flight to lead.
+func (g *flightGroup) join(key string) (f *flight, leading bool) {
+	if key == "" {
+		return nil, true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	f = &flight{group: g, key: key, done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// wait returns the result of the flight once it finished. It returns false
+// when the flight was abandoned or ended with a server error, which the
+// waiter may not run into, and when ctx is done first; the waiter then
+// validates on its own.
+func (f *flight) wait(ctx context.Context) (int, ValidateResponse, bool) {
+	select {
+	case <-f.done:
+		return f.status, f.response, f.ok
+	case <-ctx.Done():
+		return 0, ValidateResponse{}, false
+	}
+}
+
+// finish hands the result of the leader to the waiters.
+func (f *flight) finish(status int, response ValidateResponse) {
+	if f == nil {
+		return
+	}
+	f.status, f.response = status, response
+	f.ok = status < http.StatusInternalServerError
+	f.land()
+}
+
+// abandon releases the waiters of a leader that did not validate. It does
+// nothing once the flight finished, so it can be deferred.
+func (f *flight) abandon() {
+	if f == nil {
+		return
+	}
+	f.land()
+}
+
+func (f *flight) land() {
+	f.group.mu.Lock()
+	defer f.group.mu.Unlock()
+	if f.group.flights[f.key] != f {
+		return
+	}
+	delete(f.group.flights, f.key)
+	close(f.done)
+}
+
+// flightKey returns the key coalescing a request with identical ones, "" when
+// it is not coalesced. Streams are not, their waiters would miss the events.
+func (s *Server) flightKey(cfg *runtimeConfig, request *JobRequest, stream bool) string {
+	if stream {
+		return ""
+	}
+	key, err := resultKey(cfg, request, s.hhfabVersion())
+	if err != nil {
+		log.Printf("Hashing request failed: %v", err)
+		return ""
+	}
+	return key
+}
+
+// awaitFlight waits for an identical validation running on this replica,
+// returning its result marked as coalesced. Leaders get the flight to finish.
+func (s *Server) awaitFlight(ctx context.Context, key string) (f *flight, status int, response ValidateResponse, ok bool) {
+	f, leading := s.flights.join(key)
+	if leading {
+		return f, 0, ValidateResponse{}, false
+	}
+	status, response, ok = f.wait(ctx)
+	if !ok {
+		return nil, 0, ValidateResponse{}, false
+	}
+	requestsCoalesced.Inc()
+	response.Coalesced = true
+	return nil, status, response, true
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipWriter compresses the response body. The gzip stream is only started by
+// the first write, so responses without a body are sent as they are.
+type gzipWriter struct {
+	gin.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (w *gzipWriter) start() {
+	if w.gz != nil {
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.start()
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what was compressed so far, so streamed events reach the
+// client as they happen.
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// gzipBody decompresses a gzip request body, bounded by limit once
+// decompressed as well.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// compress accepts request bodies sent with Content-Encoding: gzip and
+// compresses responses for clients accepting gzip. hhfab output for large
+// fabrics is hundreds of KB of repetitive log lines.
+func (s *Server) compress(c *gin.Context) {
+	switch encoding := c.GetHeader("Content-Encoding"); encoding {
+	case "":
+	case "gzip":
+		reader, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			abortProblem(c, http.StatusBadRequest, gin.H{"error": "invalid gzip request body: " + err.Error()})
+			return
+		}
+		limit := s.currentConfig().MaxRequestSize
+		c.Request.Body = http.MaxBytesReader(c.Writer, gzipBody{reader, c.Request.Body}, limit)
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.ContentLength = -1
+	default:
+		abortProblem(c, http.StatusUnsupportedMediaType, gin.H{"error": "unsupported content encoding " + encoding + ", only gzip is accepted"})
+		return
+	}
+
+	c.Writer.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Next()
+		return
+	}
+	w := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer w.close()
+	c.Next()
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
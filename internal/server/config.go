@@ -0,0 +1,1055 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/hhfabrelease"
+	"validator/internal/plugins"
+	"validator/internal/rules"
+	"validator/internal/schema"
+)
+
+// Config holds the runtime settings of the validator server. It is loaded
+// from the YAML file named by CONFIG_FILE and reloaded whenever that file (or
+// any file it references) changes. VALIDATOR_MAX_FILE_SIZE,
+// VALIDATOR_MAX_REQUEST_SIZE, VALIDATOR_ADMIN_TOKEN, VALIDATOR_JWT_SECRET
+// and VALIDATOR_BACKEND override the settings of the file.
+type Config struct {
+	HHFabPath string `yaml:"hhfab_path"`
+	// HHFabSHA256 is the checksum the binary at hhfab_path must have, the
+	// server is not ready while it differs or the binary is missing, even with
+	// SchemaOnlyFallback
+	HHFabSHA256 string `yaml:"hhfab_sha256"`
+	TimeoutSec  int    `yaml:"timeout_seconds"`
+	// HHFabReleases downloads hhfab releases into a directory of versions,
+	// one of which may replace hhfab_path
+	HHFabReleases HHFabReleasesConfig `yaml:"hhfab_releases"`
+	// Backend is the Validator validations are run with: BackendHHFab,
+	// BackendMock or BackendSchemaOnly
+	Backend string `yaml:"backend"`
+	// MaxFileSize bounds every uploaded file without a limit of its own
+	MaxFileSize int64 `yaml:"max_file_size"`
+	// MaxRequestSize bounds whole request bodies, twice MaxFileSize if unset
+	MaxRequestSize int64              `yaml:"max_request_size"`
+	UploadLimits   UploadLimitsConfig `yaml:"upload_limits"`
+	TemplatesDir   string             `yaml:"templates_dir"`
+	// Screening rejects uploads that are not plausibly YAML before they
+	// reach hhfab
+	Screening ScreeningConfig `yaml:"screening"`
+	// SchemasDir holds CRD files replacing or adding to the embedded schemas
+	SchemasDir string `yaml:"schemas_dir"`
+	// SchemaOnlyFallback validates against the schemas and native checks
+	// alone when hhfab is not installed, instead of failing
+	SchemaOnlyFallback bool `yaml:"schema_only_fallback"`
+	// DeterministicOutput strips the timestamps and durations from every
+	// result, as deterministic=true does for a request
+	DeterministicOutput bool `yaml:"deterministic_output"`
+	// PluginsDir holds custom rules compiled to WebAssembly
+	PluginsDir string `yaml:"plugins_dir"`
+	// AdminToken enables the admin endpoints for requests presenting it as
+	// a bearer token
+	AdminToken string `yaml:"admin_token"`
+	// PublicURL is the address clients reach the server at, which result
+	// links start with; without it they start with the address requests
+	// were sent to
+	PublicURL string `yaml:"public_url"`
+	// Access restricts the addresses requests are accepted from
+	Access AccessConfig `yaml:"access"`
+	// CORS lets browser frontends on other origins call the API
+	CORS CORSConfig `yaml:"cors"`
+	// Security protects browsers viewing responses and the server from
+	// form posts of other sites
+	Security SecurityConfig `yaml:"security"`
+	// Auth names the tenant of requests by their credentials
+	Auth AuthConfig `yaml:"auth"`
+	// Tenants are the teams sharing the server by name
+	Tenants map[string]TenantConfig `yaml:"tenants"`
+	// Webhooks are told about the validations of every tenant
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	// Profiles add validation profiles to the built-in ones or replace them
+	Profiles   map[string]rules.Profile `yaml:"profiles"`
+	RateLimit  RateLimitConfig          `yaml:"rate_limit"`
+	Workers    WorkersConfig            `yaml:"workers"`
+	Resources  ResourcesConfig          `yaml:"resources"`
+	Workspaces WorkspacesConfig         `yaml:"workspaces"`
+	Readiness  ReadinessConfig          `yaml:"readiness"`
+	Temp       TempConfig               `yaml:"temp"`
+	Jobs       JobsConfig               `yaml:"jobs"`
+	Cache      CacheConfig              `yaml:"cache"`
+	History    HistoryConfig            `yaml:"history"`
+	Audit      AuditConfig              `yaml:"audit"`
+	// Idempotency keeps the answers of requests with an Idempotency-Key
+	// for their retries
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	// Canary validates requests with a candidate hhfab too, comparing the
+	// results
+	Canary CanaryConfig `yaml:"canary"`
+	// Kubeconform runs the uploads through kubeconform against the CRD
+	// schemas as well
+	Kubeconform KubeconformConfig `yaml:"kubeconform"`
+	// Style checks the YAML style of the uploads, reporting warnings
+	Style StyleConfig `yaml:"style"`
+	// SelfTest runs the fixtures of POST /selftest on a schedule and
+	// alerts when they start failing
+	SelfTest SelfTestConfig `yaml:"selftest"`
+}
+
+// UploadLimitsConfig bounds the files of a validation by form field, in
+// bytes. Wiring and Fab bound each file and default to max_file_size, Bundle
+// bounds the wiring files of a request together and defaults to
+// max_request_size.
+type UploadLimitsConfig struct {
+	Wiring int64 `yaml:"wiring" json:"wiring"`
+	Fab    int64 `yaml:"fab" json:"fab"`
+	Bundle int64 `yaml:"bundle" json:"bundle"`
+}
+
+// ScreeningConfig bounds the structure of uploaded YAML files: MaxDepth the
+// nesting of their collections and MaxAliases their anchors and aliases
+// together. Zero disables a check; binary files are always rejected.
+type ScreeningConfig struct {
+	MaxDepth   int `yaml:"max_depth"`
+	MaxAliases int `yaml:"max_aliases"`
+}
+
+// AccessConfig lists the addresses and CIDR prefixes requests are accepted
+// from, before their credentials are looked at. Addresses on Deny are
+// rejected with 403, as are all others than those on Allow when it is not
+// empty. Requests from TrustedProxies are told apart by the address they
+// forwarded in X-Forwarded-For.
+type AccessConfig struct {
+	Allow          []string `yaml:"allow"`
+	Deny           []string `yaml:"deny"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+// CORSConfig lets the pages of AllowedOrigins call the API from browsers:
+// origins such as https://ui.example.com, https://*.example.com for every
+// subdomain or * for any. Preflights are answered with AllowedMethods,
+// AllowedHeaders and a MaxAgeSec browsers cache them for; responses expose
+// ExposedHeaders to the pages. With AllowCredentials, pages may send
+// cookies and Authorization headers, which * cannot be combined with. An
+// empty AllowedOrigins leaves browsers blocked.
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	ExposedHeaders   []string `yaml:"exposed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAgeSec        int      `yaml:"max_age_seconds"`
+}
+
+// SecurityConfig sets the security headers of every response:
+// Content-Security-Policy, X-Frame-Options, Referrer-Policy, and
+// Strict-Transport-Security once HSTSMaxAgeSec is positive. Empty values
+// leave a header out. CrossOriginProtection refuses requests changing state
+// that browsers send for pages of other origins than the server and those
+// cors allows.
+type SecurityConfig struct {
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+	FrameOptions          string `yaml:"frame_options"`
+	ReferrerPolicy        string `yaml:"referrer_policy"`
+	HSTSMaxAgeSec         int    `yaml:"hsts_max_age_seconds"`
+	CrossOriginProtection bool   `yaml:"cross_origin_protection"`
+}
+
+// AuthConfig controls how requests name their tenant: with an API key of a
+// tenant, as a bearer token or in X-API-Key, or with a bearer JWT whose
+// claim names it. Requests without either belong to the default tenant,
+// unless Required rejects them with 401. DefaultRole is the role of those
+// requests and of keys and tokens that grant none, validator by default.
+type AuthConfig struct {
+	Required    bool      `yaml:"required"`
+	DefaultRole string    `yaml:"default_role"`
+	JWT         JWTConfig `yaml:"jwt"`
+}
+
+// JWTConfig verifies bearer JWTs signed with HS256 by Secret, or with RS256
+// or ES256 by the PEM public key in PublicKeyFile. TenantClaim names the
+// claim holding the tenant, tenant by default, and RolesClaim the one
+// holding the roles, a list or a space-separated string, roles by default.
+// Issuer and Audience are checked when set. Tenants named by tokens need no
+// entry in tenants.
+type JWTConfig struct {
+	Secret        string `yaml:"secret"`
+	PublicKeyFile string `yaml:"public_key_file"`
+	TenantClaim   string `yaml:"tenant_claim"`
+	RolesClaim    string `yaml:"roles_claim"`
+	Issuer        string `yaml:"issuer"`
+	Audience      string `yaml:"audience"`
+}
+
+// TenantConfig is a team sharing the server. Its history, results, jobs
+// and cached results are kept apart from those of other tenants.
+type TenantConfig struct {
+	APIKeys []APIKey `yaml:"api_keys"`
+	// TemplatesDir holds templates of the tenant, used before the shared
+	// ones of the same name
+	TemplatesDir string `yaml:"templates_dir"`
+	// RateLimit replaces the per-address limit with one shared by the
+	// requests of the tenant
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
+	// MaxConcurrent bounds the validations of the tenant running at once on
+	// a replica, 0 leaves them unbounded
+	MaxConcurrent int `yaml:"max_concurrent"`
+	// Webhooks are told about the validations of the tenant
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+}
+
+// WebhookConfig is an endpoint finished validations are posted to, signed
+// with its Secret so it can tell deliveries of the server from forged ones.
+type WebhookConfig struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// APIKey is an API key of a tenant with the roles it grants, written as the
+// bare key for the default role.
+type APIKey struct {
+	Key   string   `yaml:"key"`
+	Roles []string `yaml:"roles"`
+}
+
+// UnmarshalYAML reads a bare key or a key with its roles.
+func (k *APIKey) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&k.Key)
+	}
+	type plain APIKey
+	return node.Decode((*plain)(k))
+}
+
+// RateLimitConfig limits POST /validate per client address. A zero
+// RequestsPerMinute disables limiting.
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+// WorkersConfig bounds concurrent hhfab runs. The server reports itself as
+// not ready once MaxQueue requests are waiting for a worker, and turns
+// validations away with 503 and a Retry-After of RetryAfterSec once
+// ShedQueue are; a zero ShedQueue lets them wait. A parallel validation runs
+// up to MaxShards hhfab processes on its worker.
+type WorkersConfig struct {
+	MaxConcurrent int `yaml:"max_concurrent"`
+	MaxQueue      int `yaml:"max_queue"`
+	MaxShards     int `yaml:"max_shards"`
+	ShedQueue     int `yaml:"shed_queue"`
+	RetryAfterSec int `yaml:"retry_after_seconds"`
+}
+
+// ResourcesConfig bounds every hhfab validate run on Linux, in a transient
+// cgroup v2 below CgroupRoot that the server must be allowed to create
+// cgroups in. CPUs throttles a run to that many CPUs, a run using more than
+// MemoryMB is killed and one starting more than MaxPids processes fails.
+// Zero values leave a resource unbounded.
+type ResourcesConfig struct {
+	CgroupRoot string  `yaml:"cgroup_root"`
+	CPUs       float64 `yaml:"cpus"`
+	MemoryMB   int64   `yaml:"memory_mb"`
+	MaxPids    int     `yaml:"max_pids"`
+}
+
+// WorkspacesConfig controls the reuse of hhfab workspaces. Up to MaxIdle
+// initialized workspaces are kept ready between validations, each serving at
+// most MaxUses validations over MaxAgeSec before it is initialized anew. A
+// zero MaxIdle initializes a workspace for every validation.
+type WorkspacesConfig struct {
+	MaxIdle   int `yaml:"max_idle"`
+	MaxUses   int `yaml:"max_uses"`
+	MaxAgeSec int `yaml:"max_age_seconds"`
+}
+
+// JobsConfig selects where asynchronous validations are queued. The memory
+// backend keeps them in the replica, the redis backend shares the queue and
+// the results between replicas and keeps them across restarts. Changes only
+// take effect on restart.
+type JobsConfig struct {
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redis_url"`
+	// KeyPrefix starts the Redis keys, so deployments can share a server
+	KeyPrefix string `yaml:"key_prefix"`
+	// Runners is the number of jobs a replica takes from the queue at once
+	Runners int `yaml:"runners"`
+	// RetentionSec is how long the results of finished jobs are kept
+	RetentionSec int `yaml:"retention_seconds"`
+}
+
+// CacheConfig selects where results are cached. The memory backend keeps
+// them in the replica, the redis backend shares them so any replica answers
+// a request another one validated. Changes only take effect on restart.
+type CacheConfig struct {
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redis_url"`
+	// KeyPrefix starts the Redis keys, so deployments can share a server
+	KeyPrefix string `yaml:"key_prefix"`
+	TTLSec    int    `yaml:"ttl_seconds"`
+	// MaxEntries bounds the results of the memory backend
+	MaxEntries int `yaml:"max_entries"`
+}
+
+// IdempotencyConfig selects where the answers of requests with an
+// Idempotency-Key are kept for their retries, for TTLSec. The redis backend
+// answers retries landing on other replicas too; none ignores the header.
+// Changes only take effect on restart.
+type IdempotencyConfig struct {
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redis_url"`
+	// KeyPrefix starts the Redis keys, so deployments can share a server
+	KeyPrefix string `yaml:"key_prefix"`
+	TTLSec    int    `yaml:"ttl_seconds"`
+	// MaxEntries bounds the answers of the memory backend
+	MaxEntries int `yaml:"max_entries"`
+}
+
+// HHFabReleasesConfig downloads the hhfab releases of Install into Dir, each
+// version in a directory of its own, at startup and on POST
+// /admin/hhfab/install. URL and SignatureURL are templates of the
+// downloads, with {version}, {os} and {arch} replaced; with PublicKey, a
+// base64 ed25519 key, a download must match its signature as well as its
+// checksum. Use names the installed version validations run instead of
+// hhfab_path, CanaryVersion the one canaries run instead of
+// canary.hhfab_path.
+type HHFabReleasesConfig struct {
+	Dir           string                 `yaml:"dir"`
+	URL           string                 `yaml:"url"`
+	SignatureURL  string                 `yaml:"signature_url"`
+	PublicKey     string                 `yaml:"public_key"`
+	Install       []hhfabrelease.Release `yaml:"install"`
+	Use           string                 `yaml:"use"`
+	CanaryVersion string                 `yaml:"canary_version"`
+}
+
+// source returns where the releases are downloaded from.
+func (c HHFabReleasesConfig) source() hhfabrelease.Source {
+	source := hhfabrelease.Source{URL: c.URL, SignatureURL: c.SignatureURL}
+	if c.PublicKey != "" {
+		// Checked when the configuration was loaded
+		source.PublicKey, _ = hhfabrelease.ParsePublicKey(c.PublicKey)
+	}
+	return source
+}
+
+// CanaryConfig runs validations through the candidate hhfab at HHFabPath
+// as well, in the background, and reports where its results diverge from
+// those of hhfab_path. SampleRate is the share of validations canaried, 0
+// to 1; requests with canary=true always are. Canaries are off without a
+// candidate.
+type CanaryConfig struct {
+	HHFabPath  string  `yaml:"hhfab_path"`
+	SampleRate float64 `yaml:"sample_rate"`
+}
+
+// SelfTestConfig schedules the self-test every IntervalSec in the background,
+// never when zero. Scheduled and requested self-tests alike are exported as
+// metrics and told to Webhooks when they start failing and when they pass
+// again.
+type SelfTestConfig struct {
+	IntervalSec int             `yaml:"interval_seconds"`
+	Webhooks    []WebhookConfig `yaml:"webhooks"`
+}
+
+// KubeconformConfig runs the uploads through the kubeconform at Path, which
+// enables it, against the CRD schemas once the validator's own schema
+// checks passed. Its findings are merged into the diagnostics with
+// Severity, warning unless set to error. Strict rejects the fields the
+// schemas do not define.
+type KubeconformConfig struct {
+	Path     string `yaml:"path"`
+	Severity string `yaml:"severity"`
+	Strict   bool   `yaml:"strict"`
+}
+
+// StyleConfig enables the yamllint-style checks of the uploads. Indentation
+// is the spaces per level and LineLength the longest line, 0 disabling
+// either; Truthy flags booleans spelled other than true and false, and
+// DuplicateKeys keys given twice in a mapping. Findings are warnings.
+type StyleConfig struct {
+	Enabled       bool `yaml:"enabled"`
+	Indentation   int  `yaml:"indentation"`
+	LineLength    int  `yaml:"line_length"`
+	Truthy        bool `yaml:"truthy"`
+	DuplicateKeys bool `yaml:"duplicate_keys"`
+}
+
+// HistoryConfig selects where finished validations are recorded for
+// GET /history. The memory backend keeps them in the replica, the redis
+// backend shares them between replicas and keeps them across restarts; none
+// records nothing. Changes only take effect on restart.
+type HistoryConfig struct {
+	Backend  string `yaml:"backend"`
+	RedisURL string `yaml:"redis_url"`
+	// KeyPrefix starts the Redis keys, so deployments can share a server
+	KeyPrefix string `yaml:"key_prefix"`
+	// MaxEntries bounds the entries kept, the oldest are dropped first
+	MaxEntries int `yaml:"max_entries"`
+	// MaxPageSize caps the ?limit= of listings
+	MaxPageSize int `yaml:"max_page_size"`
+}
+
+// AuditConfig exports an audit event for every API request but the probes
+// and metrics scrapes: who, tenant, role and address, did what, with which
+// outcome. Every exporter that is set receives all events. Changes only take
+// effect on restart.
+type AuditConfig struct {
+	Syslog *AuditSyslogConfig `yaml:"syslog"`
+	HTTP   *AuditHTTPConfig   `yaml:"http"`
+	File   *AuditFileConfig   `yaml:"file"`
+}
+
+// AuditSyslogConfig sends the events as RFC 5424 messages to the receiver
+// at Address: udp://host:port, tcp://host:port, tls://host:port or
+// unix:///dev/log. Facility is local0 and AppName hh-validator by default.
+type AuditSyslogConfig struct {
+	Address  string `yaml:"address"`
+	Facility string `yaml:"facility"`
+	AppName  string `yaml:"app_name"`
+}
+
+// AuditHTTPConfig posts the events to an HTTP event collector in the format
+// of Splunk HEC, authorized with Token. Index and SourceType are optional.
+type AuditHTTPConfig struct {
+	URL        string `yaml:"url"`
+	Token      string `yaml:"token"`
+	Index      string `yaml:"index"`
+	SourceType string `yaml:"sourcetype"`
+}
+
+// AuditFileConfig appends the events as JSON lines to Path, rotated once it
+// grows over MaxSizeMB with MaxBackups rotated files kept, 100 and 5 by
+// default.
+type AuditFileConfig struct {
+	Path       string `yaml:"path"`
+	MaxSizeMB  int64  `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+// ReadinessConfig controls the checks behind GET /readyz.
+type ReadinessConfig struct {
+	SelfCheckIntervalSec int   `yaml:"self_check_interval_seconds"`
+	MinFreeDiskMB        int64 `yaml:"min_free_disk_mb"`
+}
+
+// TempConfig controls the janitor of the temporary directories validations
+// work in. Every IntervalSec it removes validator-* directories this process
+// does not use that have not changed for OrphanAgeSec, which crashed servers
+// left behind. QuotaMB bounds the space the directories take together; over
+// it the server refuses validations. A zero QuotaMB disables the quota.
+type TempConfig struct {
+	QuotaMB      int64 `yaml:"quota_mb"`
+	IntervalSec  int   `yaml:"interval_seconds"`
+	OrphanAgeSec int   `yaml:"orphan_age_seconds"`
+}
+
+// runtimeConfig is an immutable snapshot of the configuration together with
+// the content of the files it references. Handlers take one snapshot at the
+// start of a request so a reload never changes settings mid-validation.
+type runtimeConfig struct {
+	Config
+	templates map[string][]byte
+	schemas   *schema.Bundle
+	profiles  map[string]rules.Profile
+	plugins   *plugins.Set
+	// fingerprint changes whenever a reload may change validation results
+	fingerprint string
+	// tenantTemplates are the templates of every tenant by tenant name
+	tenantTemplates map[string]map[string][]byte
+	// apiKeys are the API keys with the tenants and roles they grant
+	apiKeys []apiKey
+	// jwtKey verifies RS256 and ES256 tokens, nil without public_key_file
+	jwtKey crypto.PublicKey
+	// addresses are the parsed lists of access
+	addresses addressLists
+}
+
+const configReloadDebounce = 500 * time.Millisecond
+
+// DefaultConfig is the configuration of a server without a config file.
+func DefaultConfig() Config {
+	return Config{
+		HHFabPath:   "hhfab",
+		Backend:     BackendHHFab,
+		TimeoutSec:  TimeoutSec,
+		MaxFileSize: MaxFileSize,
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "Content-Encoding", "X-API-Key"},
+			ExposedHeaders: []string{"Location", "Retry-After", "WWW-Authenticate"},
+			MaxAgeSec:      600,
+		},
+		Security: SecurityConfig{
+			// Reports style themselves inline
+			ContentSecurityPolicy: "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "no-referrer",
+			CrossOriginProtection: true,
+		},
+		Screening: ScreeningConfig{
+			MaxDepth:   64,
+			MaxAliases: 50,
+		},
+		Workers: WorkersConfig{
+			MaxConcurrent: runtime.NumCPU(),
+			MaxQueue:      4 * runtime.NumCPU(),
+			MaxShards:     4,
+			RetryAfterSec: 5,
+		},
+		Resources: ResourcesConfig{
+			CgroupRoot: "/sys/fs/cgroup/hh-validator",
+		},
+		Workspaces: WorkspacesConfig{
+			MaxIdle:   runtime.NumCPU(),
+			MaxUses:   100,
+			MaxAgeSec: 3600,
+		},
+		Readiness: ReadinessConfig{
+			SelfCheckIntervalSec: 60,
+			MinFreeDiskMB:        100,
+		},
+		Temp: TempConfig{
+			QuotaMB:      1024,
+			IntervalSec:  60,
+			OrphanAgeSec: 7200,
+		},
+		Jobs: JobsConfig{
+			Backend:      JobsMemory,
+			KeyPrefix:    "hh-validator",
+			Runners:      runtime.NumCPU(),
+			RetentionSec: 3600,
+		},
+		Cache: CacheConfig{
+			Backend:    CacheMemory,
+			KeyPrefix:  "hh-validator",
+			TTLSec:     600,
+			MaxEntries: 1000,
+		},
+		History: HistoryConfig{
+			Backend:     HistoryNone,
+			KeyPrefix:   "hh-validator",
+			MaxEntries:  10000,
+			MaxPageSize: 500,
+		},
+		Idempotency: IdempotencyConfig{
+			Backend:    IdempotencyMemory,
+			KeyPrefix:  "hh-validator",
+			TTLSec:     86400,
+			MaxEntries: 10000,
+		},
+		Style: StyleConfig{
+			Indentation:   2,
+			LineLength:    120,
+			Truthy:        true,
+			DuplicateKeys: true,
+		},
+	}
+}
+
+// validate reports incomplete release settings, releases without a valid
+// version and checksum, and public keys that are not ed25519 keys.
+func (c HHFabReleasesConfig) validate() error {
+	if c.Dir == "" && (len(c.Install) > 0 || c.Use != "" || c.CanaryVersion != "") {
+		return fmt.Errorf("hhfab_releases.dir is required to install or use releases")
+	}
+	if c.URL == "" && len(c.Install) > 0 {
+		return fmt.Errorf("hhfab_releases.url is required to install releases")
+	}
+	for _, release := range c.Install {
+		if err := release.Validate(); err != nil {
+			return fmt.Errorf("hhfab_releases.install: %w", err)
+		}
+	}
+	for _, version := range []string{c.Use, c.CanaryVersion} {
+		if version != "" && !hhfabrelease.ValidVersion(version) {
+			return fmt.Errorf("hhfab_releases: invalid hhfab version %q, expected e.g. v0.41.0", version)
+		}
+	}
+	if c.PublicKey != "" {
+		if _, err := hhfabrelease.ParsePublicKey(c.PublicKey); err != nil {
+			return fmt.Errorf("hhfab_releases.public_key: %w", err)
+		}
+	}
+	return nil
+}
+
+// currentConfig returns the active configuration snapshot.
+func (s *Server) currentConfig() *runtimeConfig {
+	return s.config.Load()
+}
+
+func (c *runtimeConfig) timeout() time.Duration {
+	return time.Duration(c.TimeoutSec) * time.Second
+}
+
+// schemaOnly reports whether validations skip hhfab, with the schema-only
+// backend or because hhfab is not installed and schema_only_fallback is
+// set.
+func (c *runtimeConfig) schemaOnly() bool {
+	return !c.validator().Capabilities().HHFab
+}
+
+// overTempQuota reports whether the temporary directories, using usage
+// bytes, exceed the quota.
+func (c *runtimeConfig) overTempQuota(usage int64) bool {
+	return c.Temp.QuotaMB > 0 && usage > c.Temp.QuotaMB*1024*1024
+}
+
+// loadConfig reads the config file at path (if any) over the defaults and
+// the VALIDATOR_* overrides of the environment, see newRuntimeConfig.
+func loadConfig(path string) (*runtimeConfig, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	}
+	if err := applyEnvironment(&cfg); err != nil {
+		return nil, err
+	}
+	return newRuntimeConfig(cfg)
+}
+
+// applyEnvironment overrides cfg with the VALIDATOR_* variables of the
+// environment.
+func applyEnvironment(cfg *Config) error {
+	for _, env := range []struct {
+		name  string
+		value *int64
+	}{
+		{"VALIDATOR_MAX_FILE_SIZE", &cfg.MaxFileSize},
+		{"VALIDATOR_MAX_REQUEST_SIZE", &cfg.MaxRequestSize},
+	} {
+		if value, ok := os.LookupEnv(env.name); ok {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", env.name, err)
+			}
+			*env.value = size
+		}
+	}
+	if token, ok := os.LookupEnv("VALIDATOR_ADMIN_TOKEN"); ok {
+		cfg.AdminToken = token
+	}
+	if secret, ok := os.LookupEnv("VALIDATOR_JWT_SECRET"); ok {
+		cfg.Auth.JWT.Secret = secret
+	}
+	if backend, ok := os.LookupEnv("VALIDATOR_BACKEND"); ok {
+		cfg.Backend = backend
+	}
+	return nil
+}
+
+// newRuntimeConfig validates cfg, merges the configured profiles over the
+// built-in ones and loads the referenced templates, schemas and plugins.
+func newRuntimeConfig(cfg Config) (*runtimeConfig, error) {
+	if err := cfg.HHFabReleases.validate(); err != nil {
+		return nil, err
+	}
+	if releases := cfg.HHFabReleases; releases.Use != "" {
+		cfg.HHFabPath = hhfabrelease.Path(releases.Dir, releases.Use)
+	}
+	if releases := cfg.HHFabReleases; releases.CanaryVersion != "" {
+		cfg.Canary.HHFabPath = hhfabrelease.Path(releases.Dir, releases.CanaryVersion)
+	}
+	if cfg.HHFabPath == "" {
+		cfg.HHFabPath = "hhfab"
+	}
+	if sum, err := hex.DecodeString(cfg.HHFabSHA256); cfg.HHFabSHA256 != "" && (err != nil || len(sum) != sha256.Size) {
+		return nil, fmt.Errorf("hhfab_sha256 must be 64 hexadecimal digits")
+	}
+	switch cfg.Backend {
+	case BackendHHFab, BackendMock, BackendSchemaOnly:
+	default:
+		return nil, fmt.Errorf("backend must be %s, %s or %s", BackendHHFab, BackendMock, BackendSchemaOnly)
+	}
+	if cfg.PublicURL != "" {
+		u, err := url.Parse(cfg.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("public_url must be an http(s) URL such as https://validator.example.com")
+		}
+		cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	}
+	if cfg.TimeoutSec <= 0 {
+		return nil, fmt.Errorf("timeout_seconds must be positive")
+	}
+	if cfg.MaxFileSize <= 0 {
+		return nil, fmt.Errorf("max_file_size must be positive")
+	}
+	if cfg.MaxRequestSize == 0 {
+		cfg.MaxRequestSize = 2 * cfg.MaxFileSize
+	}
+	if cfg.UploadLimits.Wiring == 0 {
+		cfg.UploadLimits.Wiring = cfg.MaxFileSize
+	}
+	if cfg.UploadLimits.Fab == 0 {
+		cfg.UploadLimits.Fab = cfg.MaxFileSize
+	}
+	if cfg.UploadLimits.Bundle == 0 {
+		cfg.UploadLimits.Bundle = cfg.MaxRequestSize
+	}
+	if cfg.MaxRequestSize < 0 || cfg.UploadLimits.Wiring < 0 || cfg.UploadLimits.Fab < 0 || cfg.UploadLimits.Bundle < 0 {
+		return nil, fmt.Errorf("max_request_size and upload_limits must not be negative")
+	}
+	if cfg.Screening.MaxDepth < 0 || cfg.Screening.MaxAliases < 0 {
+		return nil, fmt.Errorf("screening values must not be negative")
+	}
+	if cfg.Workers.MaxConcurrent <= 0 || cfg.Workers.MaxQueue <= 0 || cfg.Workers.MaxShards <= 0 {
+		return nil, fmt.Errorf("workers values must be positive")
+	}
+	if cfg.Workers.ShedQueue < 0 || cfg.Workers.RetryAfterSec <= 0 {
+		return nil, fmt.Errorf("workers.shed_queue must not be negative and workers.retry_after_seconds must be positive")
+	}
+	if cfg.Resources.CPUs < 0 || cfg.Resources.MemoryMB < 0 || cfg.Resources.MaxPids < 0 {
+		return nil, fmt.Errorf("resources values must not be negative")
+	}
+	if cfg.Resources.enabled() && !cgroupsSupported {
+		return nil, fmt.Errorf("resources limits need Linux cgroups v2")
+	}
+	if cfg.Workspaces.MaxIdle < 0 {
+		return nil, fmt.Errorf("workspaces.max_idle must not be negative")
+	}
+	if cfg.Workspaces.MaxUses <= 0 || cfg.Workspaces.MaxAgeSec <= 0 {
+		return nil, fmt.Errorf("workspaces.max_uses and workspaces.max_age_seconds must be positive")
+	}
+	if cfg.Readiness.SelfCheckIntervalSec <= 0 {
+		return nil, fmt.Errorf("readiness.self_check_interval_seconds must be positive")
+	}
+	if cfg.Temp.QuotaMB < 0 {
+		return nil, fmt.Errorf("temp.quota_mb must not be negative")
+	}
+	if cfg.Temp.IntervalSec <= 0 || cfg.Temp.OrphanAgeSec <= 0 {
+		return nil, fmt.Errorf("temp.interval_seconds and temp.orphan_age_seconds must be positive")
+	}
+	if cfg.RateLimit.RequestsPerMinute < 0 || cfg.RateLimit.Burst < 0 {
+		return nil, fmt.Errorf("rate_limit values must not be negative")
+	}
+	if cfg.Auth.JWT.TenantClaim == "" {
+		cfg.Auth.JWT.TenantClaim = "tenant"
+	}
+	if cfg.Auth.JWT.RolesClaim == "" {
+		cfg.Auth.JWT.RolesClaim = "roles"
+	}
+	if cfg.Auth.DefaultRole == "" {
+		cfg.Auth.DefaultRole = RoleValidator
+	}
+	if cfg.Auth.DefaultRole != RoleViewer && cfg.Auth.DefaultRole != RoleValidator {
+		return nil, fmt.Errorf("auth.default_role must be %s or %s", RoleViewer, RoleValidator)
+	}
+	apiKeys := []apiKey{}
+	keyTenants := map[string]string{}
+	for name, tenant := range cfg.Tenants {
+		if !validTenant(name) || name == DefaultTenant {
+			return nil, fmt.Errorf("invalid tenant name %q, use letters, digits, dots, dashes and underscores other than %q", name, DefaultTenant)
+		}
+		for _, key := range tenant.APIKeys {
+			switch other, ok := keyTenants[key.Key]; {
+			case key.Key == "":
+				return nil, fmt.Errorf("tenant %s: API keys must not be empty", name)
+			case key.Key == cfg.AdminToken:
+				return nil, fmt.Errorf("tenant %s: an API key is the admin token", name)
+			case ok:
+				return nil, fmt.Errorf("tenant %s: an API key is also one of tenant %s", name, other)
+			}
+			for _, role := range key.Roles {
+				if roleLevels[role] == 0 {
+					return nil, fmt.Errorf("tenant %s: unknown role %q, use %s, %s or %s", name, role, RoleViewer, RoleValidator, RoleAdmin)
+				}
+			}
+			keyTenants[key.Key] = name
+			apiKeys = append(apiKeys, apiKey{
+				hash:     sha256.Sum256([]byte(key.Key)),
+				identity: identity{tenant: name, role: highestRole(key.Roles, cfg.Auth.DefaultRole), authenticated: true},
+			})
+		}
+		if limit := tenant.RateLimit; limit != nil && (limit.RequestsPerMinute < 0 || limit.Burst < 0) {
+			return nil, fmt.Errorf("tenant %s: rate_limit values must not be negative", name)
+		}
+		if tenant.MaxConcurrent < 0 {
+			return nil, fmt.Errorf("tenant %s: max_concurrent must not be negative", name)
+		}
+		if err := validateWebhooks(tenant.Webhooks); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", name, err)
+		}
+	}
+	if err := validateWebhooks(cfg.Webhooks); err != nil {
+		return nil, err
+	}
+	switch cfg.Jobs.Backend {
+	case JobsMemory:
+	case JobsRedis:
+		if cfg.Jobs.RedisURL == "" {
+			return nil, fmt.Errorf("jobs.redis_url is required for the redis backend")
+		}
+	default:
+		return nil, fmt.Errorf("jobs.backend must be %s or %s", JobsMemory, JobsRedis)
+	}
+	if cfg.Jobs.Runners <= 0 || cfg.Jobs.RetentionSec <= 0 {
+		return nil, fmt.Errorf("jobs values must be positive")
+	}
+	switch cfg.Cache.Backend {
+	case CacheNone, CacheMemory:
+	case CacheRedis:
+		if cfg.Cache.RedisURL == "" {
+			return nil, fmt.Errorf("cache.redis_url is required for the redis backend")
+		}
+	default:
+		return nil, fmt.Errorf("cache.backend must be %s, %s or %s", CacheNone, CacheMemory, CacheRedis)
+	}
+	if cfg.Cache.TTLSec <= 0 || cfg.Cache.MaxEntries <= 0 {
+		return nil, fmt.Errorf("cache values must be positive")
+	}
+	switch cfg.History.Backend {
+	case HistoryNone, HistoryMemory:
+	case HistoryRedis:
+		if cfg.History.RedisURL == "" {
+			return nil, fmt.Errorf("history.redis_url is required for the redis backend")
+		}
+	default:
+		return nil, fmt.Errorf("history.backend must be %s, %s or %s", HistoryNone, HistoryMemory, HistoryRedis)
+	}
+	if cfg.History.MaxEntries <= 0 || cfg.History.MaxPageSize <= 0 {
+		return nil, fmt.Errorf("history values must be positive")
+	}
+	switch cfg.Idempotency.Backend {
+	case IdempotencyNone, IdempotencyMemory:
+	case IdempotencyRedis:
+		if cfg.Idempotency.RedisURL == "" {
+			return nil, fmt.Errorf("idempotency.redis_url is required for the redis backend")
+		}
+	default:
+		return nil, fmt.Errorf("idempotency.backend must be %s, %s or %s", IdempotencyNone, IdempotencyMemory, IdempotencyRedis)
+	}
+	if cfg.Idempotency.TTLSec <= 0 || cfg.Idempotency.MaxEntries <= 0 {
+		return nil, fmt.Errorf("idempotency values must be positive")
+	}
+	if cfg.Canary.SampleRate < 0 || cfg.Canary.SampleRate > 1 {
+		return nil, fmt.Errorf("canary.sample_rate must be between 0 and 1")
+	}
+	if cfg.SelfTest.IntervalSec < 0 {
+		return nil, fmt.Errorf("selftest.interval_seconds must not be negative")
+	}
+	if err := validateWebhooks(cfg.SelfTest.Webhooks); err != nil {
+		return nil, fmt.Errorf("selftest: %w", err)
+	}
+	switch cfg.Kubeconform.Severity {
+	case "":
+		cfg.Kubeconform.Severity = SeverityWarning
+	case SeverityWarning, SeverityError:
+	default:
+		return nil, fmt.Errorf("kubeconform.severity must be %s or %s", SeverityWarning, SeverityError)
+	}
+	if cfg.Style.Indentation < 0 || cfg.Style.LineLength < 0 {
+		return nil, fmt.Errorf("style values must not be negative")
+	}
+	if cfg.Security.HSTSMaxAgeSec < 0 {
+		return nil, fmt.Errorf("security.hsts_max_age_seconds must not be negative")
+	}
+	if err := validateCORS(cfg.CORS); err != nil {
+		return nil, err
+	}
+	if err := validateAudit(cfg.Audit); err != nil {
+		return nil, err
+	}
+
+	profiles := rules.Profiles()
+	for name, profile := range cfg.Profiles {
+		if err := profile.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		profiles[name] = profile
+	}
+
+	templates, err := loadTemplates(cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+	tenantTemplates := map[string]map[string][]byte{}
+	for name, tenant := range cfg.Tenants {
+		if tenantTemplates[name], err = loadTemplates(tenant.TemplatesDir); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", name, err)
+		}
+	}
+
+	var jwtKey crypto.PublicKey
+	if cfg.Auth.JWT.PublicKeyFile != "" {
+		if jwtKey, err = loadJWTKey(cfg.Auth.JWT.PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	addresses, err := loadAddressLists(cfg.Access)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas, err := schema.Load(cfg.SchemasDir)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginSet, err := plugins.Load(context.Background(), cfg.PluginsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := configFingerprint(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtimeConfig{
+		Config:          cfg,
+		templates:       templates,
+		tenantTemplates: tenantTemplates,
+		apiKeys:         apiKeys,
+		jwtKey:          jwtKey,
+		addresses:       addresses,
+		schemas:         schemas,
+		profiles:        profiles,
+		plugins:         pluginSet,
+		fingerprint:     fingerprint,
+	}, nil
+}
+
+// loadTemplates reads every *.yaml file in dir as a fabricator config
+// template keyed by the file name without extension.
+func loadTemplates(dir string) (map[string][]byte, error) {
+	templates := map[string][]byte{}
+	if dir == "" {
+		return templates, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading templates: %w", err)
+	}
+	for _, entry := range entries {
+		// Skip directories and the ..data style entries of mounted volumes
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading template %s: %w", entry.Name(), err)
+		}
+		templates[strings.TrimSuffix(entry.Name(), ext)] = data
+	}
+
+	return templates, nil
+}
+
+// watchedDirs returns the directories to watch for changes. Directories are
+// watched instead of files because mounted ConfigMaps and Secrets are updated
+// by swapping a symlink, which never touches the file itself.
+func (c *runtimeConfig) watchedDirs(configPath string) []string {
+	dirs := []string{}
+	if configPath != "" {
+		dirs = append(dirs, filepath.Dir(configPath))
+	}
+	if c.TemplatesDir != "" {
+		dirs = append(dirs, c.TemplatesDir)
+	}
+	if c.SchemasDir != "" {
+		dirs = append(dirs, c.SchemasDir)
+	}
+	if c.PluginsDir != "" {
+		dirs = append(dirs, c.PluginsDir)
+	}
+	for _, tenant := range c.Tenants {
+		if tenant.TemplatesDir != "" {
+			dirs = append(dirs, tenant.TemplatesDir)
+		}
+	}
+	return dirs
+}
+
+// watchConfig reloads the configuration whenever something under the watched
+// directories changes, until ctx is cancelled. Invalid configurations are
+// logged and ignored so a bad edit never takes down a running server.
+func (s *Server) watchConfig(ctx context.Context) error {
+	configPath := s.configPath
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watched := map[string]bool{}
+	updateWatches := func(cfg *runtimeConfig) {
+		want := map[string]bool{}
+		for _, dir := range cfg.watchedDirs(configPath) {
+			want[dir] = true
+			if !watched[dir] {
+				if err := watcher.Add(dir); err != nil {
+					log.Printf("Failed to watch %s: %v", dir, err)
+					continue
+				}
+				watched[dir] = true
+			}
+		}
+		for dir := range watched {
+			if !want[dir] {
+				watcher.Remove(dir)
+				delete(watched, dir)
+			}
+		}
+	}
+	updateWatches(s.currentConfig())
+
+	go func() {
+		defer watcher.Close()
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Editors and volume updates emit bursts of events
+				reload = time.After(configReloadDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Config watcher error: %v", err)
+			case <-reload:
+				reload = nil
+				cfg, err := s.loadConfig()
+				if err != nil {
+					log.Printf("Ignoring config change: %v", err)
+					continue
+				}
+				s.config.Store(cfg)
+				updateWatches(cfg)
+				log.Printf("Configuration reloaded")
+			}
+		}
+	}()
+
+	return nil
+}
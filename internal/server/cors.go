@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateCORS checks the allowed origins: *, or origins such as
+// https://ui.example.com whose host may start with a *. wildcard for its
+// subdomains.
+func validateCORS(cfg CORSConfig) error {
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			if cfg.AllowCredentials {
+				return fmt.Errorf("cors.allowed_origins cannot be * with allow_credentials")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("cors.allowed_origins: %q is not an origin such as https://ui.example.com", origin)
+		}
+		if strings.Contains(strings.TrimPrefix(u.Host, "*."), "*") {
+			return fmt.Errorf("cors.allowed_origins: %q may only start its host with *.", origin)
+		}
+	}
+	if cfg.MaxAgeSec < 0 {
+		return fmt.Errorf("cors.max_age_seconds must not be negative")
+	}
+	return nil
+}
+
+// allowsOrigin reports whether a browser page of origin may call the API.
+func (cfg CORSConfig) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range cfg.AllowedOrigins {
+		allowed = strings.TrimSuffix(strings.ToLower(allowed), "/")
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if scheme, host, ok := strings.Cut(allowed, "://*."); ok {
+			rest, found := strings.CutPrefix(origin, scheme+"://")
+			if found && strings.HasSuffix(rest, "."+host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cfg CORSConfig) wildcard() bool {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// cors answers the preflight requests of browsers and lets the pages of
+// the allowed origins read the responses, see CORSConfig. Preflights are
+// answered before authentication, as browsers send them without
+// credentials.
+func (s *Server) cors(c *gin.Context) {
+	cfg := s.currentConfig().CORS
+	origin := c.GetHeader("Origin")
+	if len(cfg.AllowedOrigins) == 0 || origin == "" {
+		c.Next()
+		return
+	}
+	header := c.Writer.Header()
+	header.Add("Vary", "Origin")
+	preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+	}
+	if !cfg.allowsOrigin(origin) {
+		if preflight {
+			abortProblem(c, http.StatusForbidden, gin.H{"error": "origin " + origin + " is not allowed"})
+			return
+		}
+		c.Next()
+		return
+	}
+
+	if cfg.wildcard() {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if cfg.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if len(cfg.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		}
+		c.Next()
+		return
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+	header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+	if cfg.MaxAgeSec > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSec))
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"time"
+)
+
+// defaultDebugAddr is where the debug endpoints listen unless DEBUG_ADDR
+// says otherwise, only reachable from within the pod or host.
+const defaultDebugAddr = "localhost:6060"
+
+// DebugHandler returns the handler of the debug endpoints, which Run serves
+// on the debug address when they are enabled: the net/http/pprof profiles
+// under /debug/pprof/, expvar's /debug/vars with the memory statistics, and
+// dumps of every goroutine and of the heap under /debug/dump/. They are
+// never part of Router, anyone reaching them can read the memory of the
+// process.
+func (s *Server) DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/dump/goroutines", dumpGoroutines)
+	mux.HandleFunc("/debug/dump/heap", dumpHeap)
+	return mux
+}
+
+// dumpGoroutines answers with the stacks of every goroutine, as a panic
+// would print them.
+func dumpGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// dumpHeap answers with a heap dump of the process (runtime/debug's
+// WriteHeapDump), which stops the world while it is written. It goes
+// through a temporary file since the runtime only writes it to one.
+func dumpHeap(w http.ResponseWriter, r *http.Request) {
+	dir, err := makeTempDir("validator-heapdump-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer removeTempDir(dir)
+	file, err := os.Create(filepath.Join(dir, "heap.dump"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	debug.WriteHeapDump(file.Fd())
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=heap-%s.dump", time.Now().UTC().Format("20060102T150405Z")))
+	io.Copy(w, file)
+}
+
+// serveDebug serves the debug endpoints until ctx is cancelled or the
+// listener fails, which is logged without stopping the API.
+func (s *Server) serveDebug(ctx context.Context) {
+	log.Printf("Serving debug endpoints on %s", s.debugAddr)
+	srv := &http.Server{Addr: s.debugAddr, Handler: s.DebugHandler()}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Failed to serve debug endpoints: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import "regexp"
+
+// timestampPrefix matches the time hhfab starts its log lines with, such
+// as 06:37:39 or 2024-05-01T06:37:39.123Z, with the space after it.
+var timestampPrefix = regexp.MustCompile(`(?m)^[ \t]*(?:\d{4}-\d\d-\d\d[T ])?\d\d:\d\d:\d\d(?:[.,]\d+)?(?:Z|[+-]\d\d:?\d\d)?[ \t]+`)
+
+// stripTimestamps removes the timestamps from the lines of hhfab output.
+func stripTimestamps(text string) string {
+	return timestampPrefix.ReplaceAllString(text, "")
+}
+
+// deterministicResponse strips what differs between validations of the
+// same request from response, so that its output can be compared byte by
+// byte: the timestamps of the hhfab output and the duration. The output
+// interleaves stdout and stderr in the order they happened to be read, so
+// it becomes the one followed by the other.
+func deterministicResponse(response *ValidateResponse) {
+	response.Message = stripTimestamps(response.Message)
+	response.Output = stripTimestamps(response.Output)
+	if response.Process != nil {
+		response.Process.Stdout = stripTimestamps(response.Process.Stdout)
+		response.Process.Stderr = stripTimestamps(response.Process.Stderr)
+		output := response.Process.Stdout + response.Process.Stderr
+		if response.Message == response.Output {
+			response.Message = output
+		}
+		response.Output = output
+	}
+	if response.Summary != nil {
+		response.Summary.DurationMs = 0
+	}
+}
+
+// diagnosticOutput returns the hhfab output diagnostics are parsed from:
+// output as recorded or, for deterministic requests, stdout followed by
+// stderr, so the diagnostics come in the same order every time.
+func diagnosticOutput(output string, process *Process, deterministic bool) string {
+	if !deterministic || process == nil {
+		return output
+	}
+	return process.Stdout + process.Stderr
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/codes"
+	"validator/internal/plugins"
+	"validator/internal/rules"
+	"validator/internal/schema"
+	"validator/internal/wiring"
+)
+
+// hhfabLevels maps hhfab log levels to diagnostic severities.
+var hhfabLevels = map[string]string{
+	"ERR": SeverityError,
+	"WRN": SeverityWarning,
+}
+
+// parseDiagnostics extracts the error and warning lines of hhfab output. A
+// failed run always yields at least one error.
+func parseDiagnostics(output string, failed bool) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, line := range strings.Split(output, "\n") {
+		// hhfab lines look like "06:38:17 ERR validating: ..."
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		severity, ok := hhfabLevels[fields[1]]
+		if !ok {
+			continue
+		}
+		message := strings.TrimSpace(fields[2])
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: severity,
+			Code:     codes.Classify(message),
+			Message:  message,
+			Source:   SourceHHFab,
+		})
+	}
+
+	if failed && !hasErrors(diagnostics) {
+		message := extractErrorMessage(output)
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: SeverityError,
+			Code:     codes.Classify(message),
+			Message:  message,
+			Source:   SourceHHFab,
+		})
+	}
+
+	return diagnostics
+}
+
+// sourceFile is an uploaded file, by the name the client gave it and the path
+// it was saved to. Only the documents of Kinds have been kept, if set; Lines
+// then maps the lines of the saved file to those of the upload.
+type sourceFile struct {
+	Name  string
+	Path  string
+	Kinds []string
+	Lines map[int]int
+}
+
+var yamlLine = regexp.MustCompile(`yaml: line (\d+)`)
+
+// parsedSources are the uploaded files as the validator itself parses them.
+type parsedSources struct {
+	objects []*wiring.Object
+	// complete is false when a file could not be parsed, parseError is the
+	// first parse error
+	complete   bool
+	parseError string
+	syntaxFile string
+	syntaxLine int
+}
+
+func parseSources(files []sourceFile) *parsedSources {
+	parsed := &parsedSources{complete: true}
+	for _, file := range files {
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			parsed.complete = false
+			continue
+		}
+		objects, err := wiring.Parse(data, file.Name)
+		if err != nil {
+			if parsed.complete {
+				parsed.parseError = err.Error()
+			}
+			parsed.complete = false
+			if m := yamlLine.FindStringSubmatch(err.Error()); m != nil && parsed.syntaxFile == "" {
+				parsed.syntaxFile = file.Name
+				parsed.syntaxLine, _ = strconv.Atoi(m[1])
+			}
+			continue
+		}
+		parsed.objects = append(parsed.objects, ofKinds(objects, file.Kinds)...)
+	}
+	return parsed
+}
+
+// ofKinds returns the objects of one of kinds, all objects if there are none.
+// Kinds match regardless of case.
+func ofKinds(objects []*wiring.Object, kinds []string) []*wiring.Object {
+	if len(kinds) == 0 {
+		return objects
+	}
+	found := []*wiring.Object{}
+	for _, object := range objects {
+		for _, kind := range kinds {
+			if strings.EqualFold(object.Kind, kind) {
+				found = append(found, object)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// locate attributes the hhfab diagnostics the source map could not place to
+// the uploaded files. YAML syntax errors are located by the validator's own
+// parse and other findings by the metadata.name of the first object the
+// message mentions.
+func (p *parsedSources) locate(diagnostics []Diagnostic) {
+	for i := range diagnostics {
+		d := &diagnostics[i]
+		if d.File != "" && d.Line > 0 {
+			continue
+		}
+		if d.Code == codes.YAMLSyntax {
+			if p.syntaxFile != "" {
+				d.File, d.Line = p.syntaxFile, p.syntaxLine
+			}
+			continue
+		}
+		if object := namedObject(d.Message, p.objects); object != nil {
+			d.Object, d.File, d.Line = object.Key(), object.File, object.Line
+			if name := wiring.Lookup(object.Node, "metadata", "name"); name != nil {
+				d.Line = name.Line
+			}
+		}
+	}
+}
+
+// check runs the native rules the profile selects, in strict mode the lint
+// rules too, followed by the plugins. They are skipped when a file could not
+// be parsed, the objects it defines would show up as missing.
+func (p *parsedSources) check(ctx context.Context, profile rules.Profile, pluginSet *plugins.Set) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	if !p.complete {
+		return diagnostics
+	}
+	findings := rules.CheckProfile(p.objects, profile)
+	for _, finding := range append(findings, pluginSet.Check(ctx, p.objects)...) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: finding.Severity,
+			Code:     finding.Code,
+			Message:  finding.Message,
+			Source:   SourceValidator,
+			File:     finding.File,
+			Line:     finding.Line,
+			Object:   finding.Object,
+			Path:     finding.Path,
+		})
+	}
+	return diagnostics
+}
+
+// suppress separates the diagnostics acknowledged by an ignore comment in
+// the document of their object, which get the comment's reason. Errors of
+// hhfab cannot be suppressed, it would reject the files all the same when
+// they are installed.
+func (p *parsedSources) suppress(diagnostics []Diagnostic) (kept, suppressed []Diagnostic) {
+	byKey := map[string]*wiring.Object{}
+	for _, object := range p.objects {
+		byKey[object.Key()] = object
+	}
+
+	kept, suppressed = []Diagnostic{}, []Diagnostic{}
+	for _, d := range diagnostics {
+		object := byKey[d.Object]
+		if object == nil || (d.Source == SourceHHFab && d.Severity == SeverityError) {
+			kept = append(kept, d)
+			continue
+		}
+		matched := false
+		for _, suppression := range object.Suppressions {
+			if suppresses(suppression.Code, d.Code) {
+				d.Reason, matched = suppression.Reason, true
+				break
+			}
+		}
+		if matched {
+			suppressed = append(suppressed, d)
+		} else {
+			kept = append(kept, d)
+		}
+	}
+	return kept, suppressed
+}
+
+// suppresses reports whether the code of an ignore comment, an ID or name of
+// the catalog or a plugin's own code, is code.
+func suppresses(comment, code string) bool {
+	if known, ok := codes.Lookup(comment); ok {
+		return known.ID == code
+	}
+	return strings.EqualFold(comment, code)
+}
+
+// validateSchemas checks the parsed objects against the CRD schemas of
+// bundle.
+func (p *parsedSources) validateSchemas(bundle *schema.Bundle) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, object := range p.objects {
+		for _, violation := range bundle.Validate(object) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: SeverityError,
+				Code:     violation.Code,
+				Message:  fmt.Sprintf("%s: %s", object.Key(), violation.Message),
+				Source:   SourceSchema,
+				File:     object.File,
+				Line:     violation.Line,
+				Object:   object.Key(),
+				Path:     violation.Path,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// parseDiagnostics reports the files that could not be parsed, which hhfab
+// reports otherwise.
+func (p *parsedSources) parseDiagnostics() []Diagnostic {
+	if p.complete {
+		return []Diagnostic{}
+	}
+	return []Diagnostic{{
+		Severity: SeverityError,
+		Code:     codes.Classify(p.parseError),
+		Message:  p.parseError,
+		Source:   SourceValidator,
+		File:     p.syntaxFile,
+		Line:     p.syntaxLine,
+	}}
+}
+
+// namedObject returns the object whose name appears first in message, the
+// longest name if several start at the same position.
+func namedObject(message string, objects []*wiring.Object) *wiring.Object {
+	var (
+		found *wiring.Object
+		first = len(message)
+	)
+	for _, object := range objects {
+		if object.Name == "" {
+			continue
+		}
+		pos := wordIndex(message, object.Name)
+		if pos < 0 {
+			continue
+		}
+		if pos < first || pos == first && len(object.Name) > len(found.Name) {
+			found, first = object, pos
+		}
+	}
+	return found
+}
+
+// wordIndex returns the position of the first occurrence of name in s that is
+// not part of a longer name, or -1.
+func wordIndex(s, name string) int {
+	for offset := 0; ; {
+		i := strings.Index(s[offset:], name)
+		if i < 0 {
+			return -1
+		}
+		start, end := offset+i, offset+i+len(name)
+		if (start == 0 || !isNameChar(s[start-1])) && (end == len(s) || !isNameChar(s[end])) {
+			return start
+		}
+		offset = start + 1
+	}
+}
+
+// isNameChar reports whether c may be part of a Kubernetes object name.
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.'
+}
+
+// results reports every parsed object with the diagnostics attributed to it.
+func (p *parsedSources) results(diagnostics []Diagnostic) []ObjectResult {
+	unattributed := false
+	byObject := map[string][]Diagnostic{}
+	for _, d := range diagnostics {
+		if d.Object == "" {
+			unattributed = unattributed || d.Severity == SeverityError
+			continue
+		}
+		byObject[d.Object] = append(byObject[d.Object], d)
+	}
+
+	results := []ObjectResult{}
+	for _, object := range p.objects {
+		result := ObjectResult{
+			Kind:      object.Kind,
+			Name:      object.Name,
+			Namespace: object.Namespace,
+			File:      object.File,
+			Line:      object.Line,
+			Status:    ObjectPassed,
+		}
+		if unattributed {
+			result.Status = ObjectUnknown
+		}
+		found := byObject[object.Key()]
+		if len(found) > 0 && !hasErrors(found) {
+			result.Status = ObjectWarning
+		}
+		if hasErrors(found) {
+			result.Status = ObjectFailed
+		}
+		for _, d := range found {
+			result.Messages = append(result.Messages, d.Message)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// promoteWarnings turns warnings into errors for strict mode.
+func promoteWarnings(diagnostics []Diagnostic) {
+	for i := range diagnostics {
+		if diagnostics[i].Severity == SeverityWarning {
+			diagnostics[i].Severity = SeverityError
+		}
+	}
+}
+
+// warnings returns the diagnostics of warning severity, nil if there are
+// none.
+func warnings(diagnostics []Diagnostic) []Diagnostic {
+	var found []Diagnostic
+	for _, d := range diagnostics {
+		if d.Severity == SeverityWarning {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// summarize counts the diagnostics and objects of a validation that started
+// at started.
+func summarize(diagnostics, suppressed, baselined []Diagnostic, objects []ObjectResult, started time.Time) *Summary {
+	summary := &Summary{
+		Objects:    len(objects),
+		Suppressed: len(suppressed),
+		Baselined:  len(baselined),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	for _, d := range diagnostics {
+		switch d.Severity {
+		case SeverityError:
+			summary.Errors++
+		case SeverityWarning:
+			summary.Warnings++
+		}
+	}
+	return summary
+}
+
+func firstErrorMessage(diagnostics []Diagnostic) string {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return d.Message
+		}
+	}
+	return ""
+}
+
+func hasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// explainCode describes a diagnostic code with its likely causes and
+// remediation steps.
+func explainCode(c *gin.Context) {
+	code, ok := codes.Lookup(c.Param("code"))
+	if !ok {
+		problem(c, http.StatusNotFound, gin.H{"error": "unknown code " + c.Param("code")})
+		return
+	}
+	sendJSON(c, http.StatusOK, code)
+}
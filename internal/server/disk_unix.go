@@ -0,0 +1,15 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// freeDiskBytes returns the space available to unprivileged users on the
+// filesystem holding path.
+func freeDiskBytes(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
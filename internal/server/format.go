@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/wiring"
+)
+
+// FormatResponse holds the uploaded files in canonical form.
+type FormatResponse struct {
+	Files []FormattedFile `json:"files"`
+}
+
+// FormattedFile is one uploaded file in canonical form. Field is the form
+// field it was uploaded in, wiring or fab; Changed tells whether formatting
+// changed it.
+type FormattedFile struct {
+	Field   string `json:"field"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Changed bool   `json:"changed"`
+}
+
+// ConvertResponse holds the uploaded files upgraded to the current API
+// versions.
+type ConvertResponse struct {
+	Files []ConvertedFile `json:"files"`
+}
+
+// ConvertedFile is one uploaded file after conversion, with the changes made
+// to its objects.
+type ConvertedFile struct {
+	Field   string              `json:"field"`
+	Name    string              `json:"name"`
+	Content string              `json:"content"`
+	Changes []wiring.Conversion `json:"changes"`
+}
+
+// upload is an uploaded wiring or fab file.
+type upload struct {
+	field string
+	name  string
+	data  []byte
+}
+
+// readUploads reads the wiring and fab files of a request, in this order.
+// It responds with an error and returns false when the request has none or
+// they cannot be read.
+func readUploads(c *gin.Context) ([]upload, bool) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		problem(c, http.StatusBadRequest, gin.H{"error": "failed to parse multipart form: " + err.Error()})
+		return nil, false
+	}
+	if len(form.File["wiring"])+len(form.File["fab"]) == 0 {
+		problem(c, http.StatusBadRequest, gin.H{"error": "wiring or fab file is required"})
+		return nil, false
+	}
+
+	uploads := []upload{}
+	for _, field := range []string{"wiring", "fab"} {
+		for _, file := range form.File[field] {
+			f, err := file.Open()
+			if err != nil {
+				problem(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				problem(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return nil, false
+			}
+			uploads = append(uploads, upload{field: field, name: file.Filename, data: data})
+		}
+	}
+	return uploads, true
+}
+
+// postFormat re-emits the uploaded wiring and fab files in canonical form, so
+// that diffs between them only show real changes. hhfab is not run.
+func (s *Server) postFormat(c *gin.Context) {
+	uploads, ok := readUploads(c)
+	if !ok {
+		return
+	}
+
+	response := FormatResponse{Files: []FormattedFile{}}
+	for _, file := range uploads {
+		formatted, err := wiring.Format(file.data, file.name)
+		if err != nil {
+			problem(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		response.Files = append(response.Files, FormattedFile{
+			Field:   file.field,
+			Name:    file.name,
+			Content: string(formatted),
+			Changed: !bytes.Equal(file.data, formatted),
+		})
+	}
+	sendJSON(c, http.StatusOK, response)
+}
+
+// postConvert upgrades the objects of the uploaded files from deprecated API
+// versions to the current ones and reports what changed. The converted files
+// are in canonical form. hhfab is not run.
+func (s *Server) postConvert(c *gin.Context) {
+	uploads, ok := readUploads(c)
+	if !ok {
+		return
+	}
+
+	response := ConvertResponse{Files: []ConvertedFile{}}
+	for _, file := range uploads {
+		converted, changes, err := wiring.Convert(file.data, file.name)
+		if err != nil {
+			problem(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		response.Files = append(response.Files, ConvertedFile{
+			Field:   file.field,
+			Name:    file.name,
+			Content: string(converted),
+			Changes: changes,
+		})
+	}
+	sendJSON(c, http.StatusOK, response)
+}
@@ -0,0 +1,438 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// History backends of the history setting.
+const (
+	HistoryNone   = "none"
+	HistoryMemory = "memory"
+	HistoryRedis  = "redis"
+)
+
+// defaultHistoryLimit is the page size of GET /history without ?limit=.
+const defaultHistoryLimit = 50
+
+// ErrHistoryNotFound is returned for entries that do not exist or were
+// dropped.
+var ErrHistoryNotFound = errors.New("history entry not found")
+
+// historySorts are the fields history can be sorted by, with the value of
+// an entry. Values are never negative.
+var historySorts = map[string]func(*HistoryEntry) int64{
+	"created_at":  func(e *HistoryEntry) int64 { return e.CreatedAt.UnixMilli() },
+	"duration_ms": func(e *HistoryEntry) int64 { return e.DurationMs },
+	"errors":      func(e *HistoryEntry) int64 { return int64(e.Errors) },
+	"warnings":    func(e *HistoryEntry) int64 { return int64(e.Warnings) },
+}
+
+// sortMember orders entry by the value of the sort field and then its ID
+// when compared as strings, which makes it a position to continue a listing
+// from.
+func sortMember(field string, entry *HistoryEntry) string {
+	return fmt.Sprintf("%020d:%s", historySorts[field](entry), entry.ID)
+}
+
+// HistoryQuery selects entries of the history. Filters left empty match
+// every entry.
+type HistoryQuery struct {
+	// Sort is a field of historySorts, Desc orders by it descending
+	Sort string
+	Desc bool
+	// After is the sort member of the last entry of the previous page
+	After string
+	Limit int
+
+	Success *bool
+	UseCase string
+	Mode    string
+	Profile string
+	// Code matches entries with a diagnostic of the code
+	Code string
+	// File matches entries with an upload of the name
+	File  string
+	Since time.Time
+	Until time.Time
+	// Tenant matches the entries of the tenant
+	Tenant string
+}
+
+// matches reports whether entry passes the filters of q.
+func (q *HistoryQuery) matches(entry *HistoryEntry) bool {
+	contains := func(values []string, value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case q.Success != nil && entry.Success != *q.Success:
+	case q.UseCase != "" && entry.UseCase != q.UseCase:
+	case q.Mode != "" && entry.Mode != q.Mode:
+	case q.Profile != "" && entry.Profile != q.Profile:
+	case q.Code != "" && !contains(entry.Codes, q.Code):
+	case q.File != "" && !contains(entry.Files, q.File):
+	case q.Tenant != "" && entryTenant(entry) != q.Tenant:
+	case !q.Since.IsZero() && entry.CreatedAt.Before(q.Since):
+	case !q.Until.IsZero() && !entry.CreatedAt.Before(q.Until):
+	default:
+		return true
+	}
+	return false
+}
+
+// follows reports whether member comes after the position of q in its
+// order.
+func (q *HistoryQuery) follows(member string) bool {
+	if q.After == "" {
+		return true
+	}
+	if q.Desc {
+		return member < q.After
+	}
+	return member > q.After
+}
+
+// HistoryStore records finished validations for GET /history. Implementations
+// must be safe for concurrent use by the handlers of every replica sharing
+// them.
+type HistoryStore interface {
+	// Add records an entry, dropping the oldest ones beyond the maximum.
+	Add(ctx context.Context, entry *HistoryEntry) error
+	// Get returns an entry with its result, ErrHistoryNotFound if there is
+	// none.
+	Get(ctx context.Context, id string) (*HistoryEntry, error)
+	// List returns up to query.Limit entries matching the query in its
+	// order, without their results.
+	List(ctx context.Context, query HistoryQuery) ([]HistoryEntry, error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// newHistoryStore returns the store of the configured backend, nil for none.
+func newHistoryStore(cfg HistoryConfig) (HistoryStore, error) {
+	switch cfg.Backend {
+	case HistoryNone:
+		return nil, nil
+	case HistoryMemory:
+		return NewMemoryHistory(cfg.MaxEntries), nil
+	case HistoryRedis:
+		return NewRedisHistory(cfg.RedisURL, cfg.KeyPrefix, cfg.MaxEntries)
+	default:
+		return nil, fmt.Errorf("unknown history backend %q", cfg.Backend)
+	}
+}
+
+// newHistoryEntry records the response of a validation of request, that
+// took since started.
+func newHistoryEntry(request *JobRequest, status int, response ValidateResponse, started time.Time) *HistoryEntry {
+	entry := &HistoryEntry{
+		ID:         newJobID(),
+		CreatedAt:  time.Now().UTC(),
+		Status:     status,
+		Success:    response.Success,
+		Tenant:     request.Tenant,
+		UseCase:    response.UseCase,
+		Mode:       response.Mode,
+		Profile:    response.Profile,
+		Files:      []string{},
+		Warnings:   len(response.Warnings),
+		DurationMs: time.Since(started).Milliseconds(),
+		Cached:     response.Cached,
+		Result:     &response,
+	}
+	for _, upload := range request.Wiring {
+		entry.Files = append(entry.Files, upload.Name)
+	}
+	if request.Fab != nil {
+		entry.Files = append(entry.Files, request.Fab.Name)
+	}
+	codes := map[string]bool{}
+	for _, d := range response.Diagnostics {
+		if d.Severity == SeverityError {
+			entry.Errors++
+		}
+		if d.Code != "" && !codes[d.Code] {
+			codes[d.Code] = true
+			entry.Codes = append(entry.Codes, d.Code)
+		}
+	}
+	sort.Strings(entry.Codes)
+	return entry
+}
+
+// recordResult counts a finished validation in the metrics of its tenant,
+// adds it to the history, if enabled, and tells the webhooks of the tenant,
+// returning the result with a link to it below baseURL. Failing to record it
+// does not fail the validation, the result is returned without a link.
+func (s *Server) recordResult(ctx context.Context, baseURL string, entry *HistoryEntry) ValidateResponse {
+	result := "failed"
+	if entry.Success {
+		result = "passed"
+	}
+	validations.WithLabelValues(entryTenant(entry), result).Inc()
+
+	if s.history != nil {
+		entry.Result.ResultURL = baseURL + "/results/" + entry.ID
+		if err := s.history.Add(ctx, entry); err != nil {
+			log.Printf("Recording history failed: %v", err)
+			entry.Result.ResultURL = ""
+		}
+	}
+	s.notifyWebhooks(entry)
+	return *entry.Result
+}
+
+func (s *Server) historyEnabled(c *gin.Context) bool {
+	if s.history == nil {
+		problem(c, http.StatusNotFound, gin.H{"error": "history is disabled, configure history.backend to enable it"})
+		return false
+	}
+	return true
+}
+
+// getHistory lists recorded validations, newest first unless ?sort= names
+// another field, prefixed with - to sort it descending. Pages hold ?limit=
+// entries, up to history.max_page_size, and continue with ?cursor=.
+func (s *Server) getHistory(c *gin.Context) {
+	if !s.historyEnabled(c) {
+		return
+	}
+	cfg := s.currentConfig()
+	query, err := parseHistoryQuery(c, cfg.History.MaxPageSize)
+	if err != nil {
+		problem(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scopeHistoryQuery(c, &query)
+
+	// One entry beyond the page tells whether another one follows
+	limit := query.Limit
+	query.Limit++
+	entries, err := s.history.List(c.Request.Context(), query)
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	response := HistoryResponse{Entries: entries}
+	if len(entries) > limit {
+		response.Entries = entries[:limit]
+		response.NextCursor = encodeHistoryCursor(query.Sort, query.Desc, sortMember(query.Sort, &entries[limit-1]))
+	}
+	sendJSON(c, http.StatusOK, response)
+}
+
+func (s *Server) getHistoryEntry(c *gin.Context) {
+	if !s.historyEnabled(c) {
+		return
+	}
+	entry, err := s.history.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && !visibleTo(c, entry.Tenant) {
+		err = ErrHistoryNotFound
+	}
+	if errors.Is(err, ErrHistoryNotFound) {
+		problem(c, http.StatusNotFound, gin.H{"error": "unknown history entry " + c.Param("id")})
+		return
+	}
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	sendJSON(c, http.StatusOK, entry)
+}
+
+// scopeHistoryQuery limits query to the entries of the tenant of the
+// request. The admin token sees every tenant, or the one of ?tenant=.
+func scopeHistoryQuery(c *gin.Context, query *HistoryQuery) {
+	query.Tenant = tenantOf(c)
+	if isAdmin(c) {
+		query.Tenant = c.Query("tenant")
+	}
+}
+
+// entryTenant returns the tenant of entry, the default one for entries
+// recorded before tenants.
+func entryTenant(entry *HistoryEntry) string {
+	if entry.Tenant == "" {
+		return DefaultTenant
+	}
+	return entry.Tenant
+}
+
+// parseHistoryQuery reads the sort, pagination and filters of a listing.
+func parseHistoryQuery(c *gin.Context, maxLimit int) (HistoryQuery, error) {
+	query := HistoryQuery{Sort: "created_at", Desc: true, Limit: defaultHistoryLimit}
+	if value := c.Query("sort"); value != "" {
+		query.Desc = strings.HasPrefix(value, "-")
+		query.Sort = strings.TrimPrefix(value, "-")
+		if historySorts[query.Sort] == nil {
+			return query, fmt.Errorf("cannot sort by %q, use created_at, duration_ms, errors or warnings", query.Sort)
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, fmt.Errorf("limit must be a positive number")
+		}
+		query.Limit = limit
+	}
+	if query.Limit > maxLimit {
+		query.Limit = maxLimit
+	}
+	if value := c.Query("cursor"); value != "" {
+		after, err := decodeHistoryCursor(value, query.Sort, query.Desc)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	if value := c.Query("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("success must be true or false")
+		}
+		query.Success = &success
+	}
+	query.UseCase = c.Query("use_case")
+	query.Mode = c.Query("mode")
+	query.Profile = c.Query("profile")
+	query.Code = c.Query("code")
+	query.File = c.Query("file")
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"since", &query.Since}, {"until", &query.Until}} {
+		if value := c.Query(bound.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%s must be an RFC 3339 time such as 2024-05-01T00:00:00Z", bound.name)
+			}
+			*bound.value = t
+		}
+	}
+	return query, nil
+}
+
+// encodeHistoryCursor returns the opaque cursor continuing a listing after
+// member. It carries the order, so a cursor cannot continue a listing
+// sorted differently.
+func encodeHistoryCursor(field string, desc bool, member string) string {
+	order := field
+	if desc {
+		order = "-" + field
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(order + "|" + member))
+}
+
+func decodeHistoryCursor(cursor, field string, desc bool) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor")
+	}
+	order, member, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return "", fmt.Errorf("invalid cursor")
+	}
+	if desc {
+		field = "-" + field
+	}
+	if order != field {
+		return "", fmt.Errorf("the cursor continues a listing sorted by %s, not %s", order, field)
+	}
+	return member, nil
+}
+
+// memoryHistory keeps entries in the process, the oldest are dropped once
+// it holds maxEntries.
+type memoryHistory struct {
+	mu         sync.Mutex
+	entries    []*HistoryEntry
+	maxEntries int
+}
+
+// NewMemoryHistory returns a HistoryStore of up to maxEntries entries in
+// memory.
+func NewMemoryHistory(maxEntries int) HistoryStore {
+	return &memoryHistory{maxEntries: maxEntries}
+}
+
+func (h *memoryHistory) Add(ctx context.Context, entry *HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stored := *entry
+	h.entries = append(h.entries, &stored)
+	if len(h.entries) > h.maxEntries {
+		h.entries = h.entries[len(h.entries)-h.maxEntries:]
+	}
+	return nil
+}
+
+func (h *memoryHistory) Get(ctx context.Context, id string) (*HistoryEntry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, entry := range h.entries {
+		if entry.ID == id {
+			found := *entry
+			return &found, nil
+		}
+	}
+	return nil, ErrHistoryNotFound
+}
+
+func (h *memoryHistory) List(ctx context.Context, query HistoryQuery) ([]HistoryEntry, error) {
+	type sorted struct {
+		member string
+		entry  *HistoryEntry
+	}
+	h.mu.Lock()
+	matching := []sorted{}
+	for _, entry := range h.entries {
+		member := sortMember(query.Sort, entry)
+		if query.follows(member) && query.matches(entry) {
+			matching = append(matching, sorted{member, entry})
+		}
+	}
+	h.mu.Unlock()
+
+	sort.Slice(matching, func(i, j int) bool {
+		if query.Desc {
+			return matching[i].member > matching[j].member
+		}
+		return matching[i].member < matching[j].member
+	})
+	entries := []HistoryEntry{}
+	for _, m := range matching {
+		if len(entries) == query.Limit {
+			break
+		}
+		entry := *m.entry
+		entry.Result = nil
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (h *memoryHistory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (h *memoryHistory) Close() error {
+	return nil
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisHistoryBatch is how many entries a listing reads from Redis at once
+// while filtering.
+const redisHistoryBatch = 100
+
+// redisHistory shares the history between replicas through Redis. Entries
+// are hashes <prefix>:history:<id> of the entry and its result as JSON,
+// indexed by the sorted sets <prefix>:history:by:<field> of their sort
+// members, so listings continue from a cursor without reading the entries
+// before it.
+type redisHistory struct {
+	client     *redis.Client
+	prefix     string
+	maxEntries int
+}
+
+// NewRedisHistory returns a HistoryStore in the Redis server at url with keys
+// starting with prefix, keeping up to maxEntries entries.
+func NewRedisHistory(url, prefix string, maxEntries int) (HistoryStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis_url: %w", err)
+	}
+	return &redisHistory{client: redis.NewClient(options), prefix: prefix, maxEntries: maxEntries}, nil
+}
+
+func (h *redisHistory) key(parts ...string) string {
+	return h.prefix + ":history:" + strings.Join(parts, ":")
+}
+
+func (h *redisHistory) Add(ctx context.Context, entry *HistoryEntry) error {
+	summary := *entry
+	summary.Result = nil
+	summaryData, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	resultData, err := json.Marshal(entry.Result)
+	if err != nil {
+		return err
+	}
+	_, err = h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, h.key(entry.ID), "summary", summaryData, "result", resultData)
+		for field := range historySorts {
+			pipe.ZAdd(ctx, h.key("by", field), redis.Z{Member: sortMember(field, entry)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return h.trim(ctx)
+}
+
+// trim drops the oldest entries beyond maxEntries.
+func (h *redisHistory) trim(ctx context.Context) error {
+	count, err := h.client.ZCard(ctx, h.key("by", "created_at")).Result()
+	if err != nil || count <= int64(h.maxEntries) {
+		return err
+	}
+	oldest, err := h.client.ZRangeByLex(ctx, h.key("by", "created_at"), &redis.ZRangeBy{
+		Min: "-", Max: "+", Count: count - int64(h.maxEntries),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, member := range oldest {
+		_, id, _ := strings.Cut(member, ":")
+		entry, err := h.summary(ctx, id)
+		if errors.Is(err, ErrHistoryNotFound) {
+			// Dropped by another replica
+			h.client.ZRem(ctx, h.key("by", "created_at"), member)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = h.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, h.key(id))
+			for field := range historySorts {
+				pipe.ZRem(ctx, h.key("by", field), sortMember(field, entry))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *redisHistory) summary(ctx context.Context, id string) (*HistoryEntry, error) {
+	data, err := h.client.HGet(ctx, h.key(id), "summary").Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrHistoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &HistoryEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, fmt.Errorf("reading history entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (h *redisHistory) Get(ctx context.Context, id string) (*HistoryEntry, error) {
+	entry, err := h.summary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := h.client.HGet(ctx, h.key(id), "result").Bytes()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entry.Result); err != nil {
+			return nil, fmt.Errorf("reading history result: %w", err)
+		}
+	}
+	return entry, nil
+}
+
+// List walks the index of the sort field from the cursor in batches,
+// filtering the entries until the page is full. Time bounds narrow the walk
+// of listings sorted by creation.
+func (h *redisHistory) List(ctx context.Context, query HistoryQuery) ([]HistoryEntry, error) {
+	low, high := "-", "+"
+	if query.Sort == "created_at" {
+		if !query.Since.IsZero() {
+			low = fmt.Sprintf("[%020d:", query.Since.UnixMilli())
+		}
+		if !query.Until.IsZero() {
+			high = fmt.Sprintf("[%020d;", query.Until.UnixMilli())
+		}
+	}
+	if query.After != "" {
+		if query.Desc {
+			high = "(" + query.After
+		} else {
+			low = "(" + query.After
+		}
+	}
+
+	entries := []HistoryEntry{}
+	for {
+		by := &redis.ZRangeBy{Min: low, Max: high, Count: redisHistoryBatch}
+		var members []string
+		var err error
+		if query.Desc {
+			members, err = h.client.ZRevRangeByLex(ctx, h.key("by", query.Sort), by).Result()
+		} else {
+			members, err = h.client.ZRangeByLex(ctx, h.key("by", query.Sort), by).Result()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		summaries := make([]*redis.StringCmd, len(members))
+		_, err = h.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, member := range members {
+				_, id, _ := strings.Cut(member, ":")
+				summaries[i] = pipe.HGet(ctx, h.key(id), "summary")
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		for _, summary := range summaries {
+			data, err := summary.Bytes()
+			if errors.Is(err, redis.Nil) {
+				// Dropped since the index was read
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			entry := HistoryEntry{}
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return nil, fmt.Errorf("reading history entry: %w", err)
+			}
+			if query.matches(&entry) {
+				entries = append(entries, entry)
+				if len(entries) == query.Limit {
+					return entries, nil
+				}
+			}
+		}
+
+		if len(members) < redisHistoryBatch {
+			return entries, nil
+		}
+		if query.Desc {
+			high = "(" + members[len(members)-1]
+		} else {
+			low = "(" + members[len(members)-1]
+		}
+	}
+}
+
+func (h *redisHistory) Ping(ctx context.Context) error {
+	return h.client.Ping(ctx).Err()
+}
+
+func (h *redisHistory) Close() error {
+	return h.client.Close()
+}
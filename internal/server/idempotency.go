@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Idempotency backends of the idempotency setting.
+const (
+	IdempotencyNone   = "none"
+	IdempotencyMemory = "memory"
+	IdempotencyRedis  = "redis"
+)
+
+// maxIdempotencyKey bounds the length of Idempotency-Key headers.
+const maxIdempotencyKey = 255
+
+// IdempotencyRecord is what is kept under an Idempotency-Key: the hash of
+// the request that used it first and, once that request was answered, its
+// result, or the job it was queued as.
+type IdempotencyRecord struct {
+	RequestHash string `json:"request_hash"`
+	// Pending is set while the first request with the key runs
+	Pending  bool              `json:"pending,omitempty"`
+	Status   int               `json:"status,omitempty"`
+	Response *ValidateResponse `json:"response,omitempty"`
+	Job      *Job              `json:"job,omitempty"`
+}
+
+// IdempotencyStore keeps the records of Idempotency-Keys. Implementations
+// must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Claim keeps the pending record under key for ttl unless the key is
+	// taken, and returns the record holding it, nil if the claim succeeded.
+	Claim(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error)
+	// Finish replaces the pending record of key by that of the answer.
+	Finish(ctx context.Context, key string, record *IdempotencyRecord) error
+	// Release removes the pending record of a request that ended without
+	// an answer to replay.
+	Release(ctx context.Context, key string) error
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// newIdempotencyStore returns the store of the configured backend, nil for
+// none.
+func newIdempotencyStore(cfg IdempotencyConfig) (IdempotencyStore, error) {
+	ttl := time.Duration(cfg.TTLSec) * time.Second
+	switch cfg.Backend {
+	case IdempotencyNone:
+		return nil, nil
+	case IdempotencyMemory:
+		return NewMemoryIdempotency(cfg.MaxEntries, ttl), nil
+	case IdempotencyRedis:
+		return NewRedisIdempotency(cfg.RedisURL, cfg.KeyPrefix, ttl)
+	default:
+		return nil, fmt.Errorf("unknown idempotency backend %q", cfg.Backend)
+	}
+}
+
+// idempotentRequest is a request that claimed its Idempotency-Key. Its
+// answer is kept for the replays unless it failed with a server error,
+// which the next attempt may not run into. A nil idempotentRequest stands
+// for requests without a key.
+type idempotentRequest struct {
+	store    IdempotencyStore
+	key      string
+	hash     string
+	finished bool
+}
+
+// claimIdempotency claims the Idempotency-Key of the request, if it has
+// one. Retries of the request with the key are answered with the result of
+// the first, and true is returned; so are requests reusing the key for
+// another request or sent while the first still runs, which are turned
+// away.
+func (s *Server) claimIdempotency(c *gin.Context, cfg *runtimeConfig, request *JobRequest, async bool) (*idempotentRequest, bool) {
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if key == "" || s.idempotency == nil {
+		return nil, false
+	}
+	if len(key) > maxIdempotencyKey || !printable(key) {
+		problem(c, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Invalid parameters",
+			Error:   fmt.Sprintf("%s must be 1 to %d printable ASCII characters", IdempotencyKeyHeader, maxIdempotencyKey),
+		})
+		return nil, true
+	}
+	hash, err := idempotencyHash(request, async)
+	if err != nil {
+		log.Printf("Hashing request failed: %v", err)
+		return nil, false
+	}
+
+	// Keys are kept apart by tenant, claims expire once the request would
+	// have timed out
+	sum := sha256.Sum256([]byte(request.Tenant + "\x00" + key))
+	r := &idempotentRequest{store: s.idempotency, key: hex.EncodeToString(sum[:]), hash: hash}
+	record, err := r.store.Claim(c.Request.Context(), r.key, &IdempotencyRecord{RequestHash: hash, Pending: true}, cfg.timeout()+time.Minute)
+	if err != nil {
+		idempotentRequests.WithLabelValues("error").Inc()
+		log.Printf("Claiming idempotency key failed: %v", err)
+		return nil, false
+	}
+	switch {
+	case record == nil:
+		idempotentRequests.WithLabelValues("claimed").Inc()
+		return r, false
+	case record.RequestHash != hash:
+		idempotentRequests.WithLabelValues(IdempotencyMismatch).Inc()
+		problem(c, http.StatusUnprocessableEntity, ValidateResponse{
+			Success:     false,
+			Message:     "Idempotency key reused",
+			Error:       fmt.Sprintf("%s %q was used for a different request", IdempotencyKeyHeader, key),
+			Idempotency: &IdempotencyConflict{Key: key, Reason: IdempotencyMismatch},
+		})
+	case record.Pending:
+		idempotentRequests.WithLabelValues(IdempotencyPending).Inc()
+		problem(c, http.StatusConflict, ValidateResponse{
+			Success:     false,
+			Message:     "Request in progress",
+			Error:       fmt.Sprintf("the request with %s %q is still running, retry once it finished", IdempotencyKeyHeader, key),
+			Idempotency: &IdempotencyConflict{Key: key, Reason: IdempotencyPending},
+		})
+	case record.Job != nil:
+		idempotentRequests.WithLabelValues("replayed").Inc()
+		job := record.Job
+		if current, err := s.jobs.Get(c.Request.Context(), job.ID); err == nil {
+			job = current
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Header("Location", "/jobs/"+job.ID)
+		sendJSON(c, http.StatusAccepted, job)
+	default:
+		idempotentRequests.WithLabelValues("replayed").Inc()
+		c.Header(IdempotentReplayedHeader, "true")
+		respond(c, request, nil, record.Status, *record.Response)
+	}
+	return nil, true
+}
+
+// idempotencyHash hashes what a request asks for, the uploads by their
+// digests; the format and streaming of its answer are left out.
+func idempotencyHash(request *JobRequest, async bool) (string, error) {
+	data, err := json.Marshal(struct {
+		Request *JobRequest `json:"request"`
+		Async   bool        `json:"async"`
+	}{request.withoutData(), async})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// finish keeps the answer of the request for its replays.
+func (r *idempotentRequest) finish(ctx context.Context, status int, response ValidateResponse) {
+	if r == nil || status >= http.StatusInternalServerError {
+		return
+	}
+	r.keep(ctx, &IdempotencyRecord{RequestHash: r.hash, Status: status, Response: &response})
+}
+
+// finishJob keeps the job an asynchronous request was queued as.
+func (r *idempotentRequest) finishJob(ctx context.Context, job *Job) {
+	if r == nil {
+		return
+	}
+	r.keep(ctx, &IdempotencyRecord{RequestHash: r.hash, Job: job})
+}
+
+func (r *idempotentRequest) keep(ctx context.Context, record *IdempotencyRecord) {
+	if err := r.store.Finish(ctx, r.key, record); err != nil {
+		log.Printf("Keeping idempotent result failed: %v", err)
+		return
+	}
+	r.finished = true
+}
+
+// release frees the key of a request that was not finished, so it can be
+// sent again.
+func (r *idempotentRequest) release(ctx context.Context) {
+	if r == nil || r.finished {
+		return
+	}
+	if err := r.store.Release(ctx, r.key); err != nil {
+		log.Printf("Releasing idempotency key failed: %v", err)
+	}
+}
+
+// memoryIdempotency keeps the records in the process, the oldest are
+// evicted once it holds maxEntries.
+type memoryIdempotency struct {
+	mu         sync.Mutex
+	entries    map[string]memoryIdempotencyEntry
+	order      []string
+	maxEntries int
+	ttl        time.Duration
+}
+
+type memoryIdempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+// NewMemoryIdempotency returns an IdempotencyStore of up to maxEntries
+// records in memory, each answer kept for ttl.
+func NewMemoryIdempotency(maxEntries int, ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotency{entries: map[string]memoryIdempotencyEntry{}, maxEntries: maxEntries, ttl: ttl}
+}
+
+func (m *memoryIdempotency) Claim(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if entry, ok := m.entries[key]; ok && time.Now().Before(entry.expires) {
+		taken := entry.record
+		return &taken, nil
+	}
+	m.set(key, record, ttl)
+	return nil, nil
+}
+
+func (m *memoryIdempotency) Finish(ctx context.Context, key string, record *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, record, m.ttl)
+	return nil
+}
+
+func (m *memoryIdempotency) set(key string, record *IdempotencyRecord, ttl time.Duration) {
+	if _, ok := m.entries[key]; !ok {
+		m.order = append(m.order, key)
+	}
+	m.entries[key] = memoryIdempotencyEntry{record: *record, expires: time.Now().Add(ttl)}
+	for len(m.order) > m.maxEntries {
+		delete(m.entries, m.order[0])
+		m.order = m.order[1:]
+	}
+}
+
+func (m *memoryIdempotency) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.entries[key]; ok {
+		delete(m.entries, key)
+		for i, k := range m.order {
+			if k == key {
+				m.order = append(m.order[:i], m.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryIdempotency) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryIdempotency) Close() error {
+	return nil
+}
+
+// redisIdempotency shares the records between replicas, under
+// <prefix>:idempotency:<key>, so a retry landing on another replica is
+// answered too.
+type redisIdempotency struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisIdempotency returns an IdempotencyStore in the Redis server at
+// url with keys starting with prefix, each answer kept for ttl.
+func NewRedisIdempotency(url, prefix string, ttl time.Duration) (IdempotencyStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis_url: %w", err)
+	}
+	return &redisIdempotency{client: redis.NewClient(options), prefix: prefix, ttl: ttl}, nil
+}
+
+func (r *redisIdempotency) Claim(ctx context.Context, key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	// A record expiring between the two commands is claimed on the retry
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := r.client.SetNX(ctx, r.prefix+":idempotency:"+key, data, ttl).Result()
+		if err != nil || claimed {
+			return nil, err
+		}
+		taken, err := r.client.Get(ctx, r.prefix+":idempotency:"+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing := &IdempotencyRecord{}
+		if err := json.Unmarshal(taken, existing); err != nil {
+			return nil, fmt.Errorf("reading idempotency record: %w", err)
+		}
+		return existing, nil
+	}
+	return nil, fmt.Errorf("idempotency key %s changed while claiming it", key)
+}
+
+func (r *redisIdempotency) Finish(ctx context.Context, key string, record *IdempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, r.prefix+":idempotency:"+key, data, r.ttl).Err()
+}
+
+func (r *redisIdempotency) Release(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.prefix+":idempotency:"+key).Err()
+}
+
+func (r *redisIdempotency) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *redisIdempotency) Close() error {
+	return r.client.Close()
+}
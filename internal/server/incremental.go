@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"validator/internal/wiring"
+)
+
+// incrementalGroup is a group of related objects, cached by the hash of
+// their documents and everything hhfab validates them against.
+type incrementalGroup struct {
+	members []int
+	key     string
+	// reused are the diagnostics of the group passing hhfab earlier, with
+	// lines relative to the start of their object; nil if it is validated
+	reused []Diagnostic
+}
+
+// incrementalPlan splits the wiring files of an incremental validation into
+// groups validated by hhfab anew and those unchanged since an earlier one.
+type incrementalPlan struct {
+	objects []fileObject
+	files   int
+	groups  []incrementalGroup
+}
+
+// planIncremental looks up the groups of related objects of the wiring files
+// among the results of earlier validations in the scope of the request. fab
+// is the fab.yaml hhfab validates them with. It returns nil when the files
+// cannot be parsed.
+func (v *validation) planIncremental(ctx context.Context, files []sourceFile, fab []byte) *incrementalPlan {
+	objects, groups, ok := relatedGroups(files)
+	if !ok || len(groups) == 0 {
+		return nil
+	}
+
+	// Every group depends on the objects of the shared kinds and fab.yaml
+	shared := []*wiring.Object{}
+	for _, o := range objects {
+		if sharedKinds[o.object.Kind] {
+			shared = append(shared, o.object)
+		}
+	}
+	sharedData, err := wiring.Encode(shared)
+	if err != nil {
+		return nil
+	}
+	base := sha256.New()
+	for _, part := range [][]byte{[]byte(Version), []byte(v.hhfabVersion), []byte(v.cfg.fingerprint), []byte(v.request.Tenant), []byte(v.request.Incremental), fab, sharedData} {
+		fmt.Fprintf(base, "%d\x00", len(part))
+		base.Write(part)
+	}
+	dependencies := base.Sum(nil)
+
+	plan := &incrementalPlan{objects: objects, files: len(files)}
+	for _, members := range groups {
+		group := []*wiring.Object{}
+		for _, i := range members {
+			group = append(group, objects[i].object)
+		}
+		data, err := wiring.Encode(group)
+		if err != nil {
+			return nil
+		}
+		hash := sha256.New()
+		hash.Write(dependencies)
+		hash.Write(data)
+		g := incrementalGroup{members: members, key: "incremental:" + hex.EncodeToString(hash.Sum(nil))}
+
+		cached, err := v.cache.Get(ctx, g.key)
+		switch {
+		case err == nil:
+			g.reused = append([]Diagnostic{}, cached.Response.Diagnostics...)
+		case !errors.Is(err, ErrCacheMiss):
+			log.Printf("Incremental result lookup failed: %v", err)
+		}
+		plan.groups = append(plan.groups, g)
+	}
+	return plan
+}
+
+// result counts the groups of the plan and those reused, nil without a plan.
+func (p *incrementalPlan) result() *IncrementalResult {
+	if p == nil {
+		return nil
+	}
+	result := &IncrementalResult{Groups: len(p.groups)}
+	for _, g := range p.groups {
+		if g.reused != nil {
+			result.Reused++
+		}
+	}
+	return result
+}
+
+// changed returns the objects hhfab validates: those of the groups without
+// an earlier result and the shared ones, or nil without a plan or if every
+// group has one.
+func (p *incrementalPlan) changed() *shard {
+	if p == nil {
+		return nil
+	}
+	members := map[int]bool{}
+	for _, g := range p.groups {
+		if g.reused == nil {
+			for _, i := range g.members {
+				members[i] = true
+			}
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	s := &shard{files: make([][]*wiring.Object, p.files)}
+	for i, o := range p.objects {
+		if members[i] || sharedKinds[o.object.Kind] {
+			s.files[o.file] = append(s.files[o.file], o.object)
+		}
+	}
+	return s
+}
+
+// reusedDiagnostics returns the diagnostics of the reused groups, located in
+// the uploads of this validation.
+func (p *incrementalPlan) reusedDiagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, g := range p.groups {
+		for _, d := range g.reused {
+			if object := p.object(g, d.Object); object != nil {
+				d.File, d.Line = object.File, object.Line+d.Line
+			} else {
+				d.File, d.Line = "", 0
+			}
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// object returns the object of the group with key, nil if there is none.
+func (p *incrementalPlan) object(g incrementalGroup, key string) *wiring.Object {
+	for _, i := range g.members {
+		if p.objects[i].object.Key() == key {
+			return p.objects[i].object
+		}
+	}
+	return nil
+}
+
+// store caches the hhfab results of the groups validated anew, which passed
+// with diagnostics. Nothing is stored when a diagnostic cannot be told apart
+// by group.
+func (p *incrementalPlan) store(ctx context.Context, cache ResultCache, diagnostics []Diagnostic) {
+	byGroup := map[int][]Diagnostic{}
+	for _, d := range diagnostics {
+		found := false
+		for i, g := range p.groups {
+			if object := p.object(g, d.Object); g.reused == nil && object != nil {
+				d.Line -= object.Line
+				byGroup[i] = append(byGroup[i], d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	for i, g := range p.groups {
+		if g.reused != nil {
+			continue
+		}
+		result := &CachedResult{Status: http.StatusOK, Response: ValidateResponse{Success: true, Diagnostics: byGroup[i]}}
+		if err := cache.Set(ctx, g.key, result); err != nil {
+			log.Printf("Caching incremental result failed: %v", err)
+			return
+		}
+	}
+}
+
+// writeShard replaces the wiring files with the objects of s, so that hhfab
+// only loads those, mapping their lines to the uploads.
+func writeShard(files []sourceFile, s *shard) error {
+	for i := range files {
+		file := &files[i]
+		data, lines, err := encodeObjects(s.files[i], file.Name)
+		if err != nil {
+			return err
+		}
+		file.Lines = lines
+		if err := os.WriteFile(file.Path, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// integrityResult is the last verification of the hhfab binary against
+// hhfab_sha256. The size and modification time tell readiness probes
+// whether the binary has to be hashed again.
+type integrityResult struct {
+	path      string
+	expected  string
+	size      int64
+	modTime   time.Time
+	err       string
+	checkedAt time.Time
+}
+
+// verifyHHFab compares the hhfab of cfg with hhfab_sha256 and logs when the
+// outcome changes. Unless force is set, a binary of the same size and
+// modification time as at the last verification is not hashed again.
+func (s *Server) verifyHHFab(cfg *runtimeConfig, force bool) integrityResult {
+	s.integrityMu.Lock()
+	defer s.integrityMu.Unlock()
+
+	last := s.lastIntegrity
+	result := integrityResult{path: cfg.HHFabPath, expected: strings.ToLower(cfg.HHFabSHA256), checkedAt: time.Now()}
+	path, err := exec.LookPath(cfg.HHFabPath)
+	var info os.FileInfo
+	if err == nil {
+		info, err = os.Stat(path)
+	}
+	switch {
+	case err != nil:
+		result.err = fmt.Sprintf("hhfab at %s is missing: %s", cfg.HHFabPath, err)
+	case !force && last.path == result.path && last.expected == result.expected && last.size == info.Size() && last.modTime.Equal(info.ModTime()):
+		return last
+	default:
+		result.size, result.modTime = info.Size(), info.ModTime()
+		if sum, err := fileSHA256(path); err != nil {
+			result.err = fmt.Sprintf("hhfab at %s could not be read: %s", cfg.HHFabPath, err)
+		} else if sum != result.expected {
+			result.err = fmt.Sprintf("hhfab at %s changed: its sha256 is %s, hhfab_sha256 expects %s", cfg.HHFabPath, sum, result.expected)
+		}
+	}
+
+	switch {
+	case result.err != "" && result.err != last.err:
+		log.Printf("Integrity check failed, not ready: %s", result.err)
+	case result.err == "" && last.err != "":
+		log.Printf("hhfab at %s matches hhfab_sha256 again", cfg.HHFabPath)
+	}
+	s.lastIntegrity = result
+	return result
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// pinsHHFab reports whether hhfab_sha256 applies: to the hhfab of the hhfab
+// backend, also while schema_only_fallback stands in for a missing binary.
+func (c *runtimeConfig) pinsHHFab() bool {
+	return c.HHFabSHA256 != "" && c.Backend == BackendHHFab
+}
+
+// checkIntegrity fails readiness while the hhfab binary is missing or does
+// not match hhfab_sha256.
+func (s *Server) checkIntegrity(cfg *runtimeConfig) ReadinessCheck {
+	check := ReadinessCheck{Name: "hhfab-integrity"}
+	if !cfg.pinsHHFab() {
+		check.OK = true
+		check.Detail = "not used by the " + cfg.Backend + " backend"
+		return check
+	}
+	if result := s.verifyHHFab(cfg, false); result.err != "" {
+		check.Detail = result.err
+	} else {
+		check.OK = true
+		check.Detail = "sha256 " + result.expected
+	}
+	return check
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tempPrefix starts the names of all temporary directories of the server,
+// which the janitor accounts for.
+const tempPrefix = "validator-"
+
+// tempDirs are the temporary directories of this process. The janitor never
+// removes them, however old they are.
+var tempDirs = struct {
+	sync.Mutex
+	dirs map[string]bool
+}{dirs: map[string]bool{}}
+
+// makeTempDir creates a temporary directory like os.MkdirTemp and registers
+// it as in use until removeTempDir removes it. pattern starts with
+// tempPrefix.
+func makeTempDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	tempDirs.Lock()
+	tempDirs.dirs[dir] = true
+	tempDirs.Unlock()
+	return dir, nil
+}
+
+// removeTempDir removes a directory created by makeTempDir.
+func removeTempDir(dir string) error {
+	err := os.RemoveAll(dir)
+	tempDirs.Lock()
+	delete(tempDirs.dirs, dir)
+	tempDirs.Unlock()
+	return err
+}
+
+func ownTempDir(dir string) bool {
+	tempDirs.Lock()
+	defer tempDirs.Unlock()
+	return tempDirs.dirs[dir]
+}
+
+// sweepResult is what a sweep of the temporary root found.
+type sweepResult struct {
+	// usage is the size of the remaining temporary directories in bytes
+	usage   int64
+	dirs    int
+	removed int
+}
+
+// sweepTempDirs removes the temporary directories in root that are not in
+// use by this process and have not been modified for orphanAge, left behind
+// by servers that crashed or were killed, and measures the remaining ones.
+func sweepTempDirs(root string, orphanAge time.Duration) sweepResult {
+	result := sweepResult{}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		log.Printf("Failed to list temporary directories: %v", err)
+		return result
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempPrefix) {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since it was listed
+			continue
+		}
+		if !ownTempDir(dir) && time.Since(info.ModTime()) > orphanAge {
+			if err := os.RemoveAll(dir); err != nil {
+				log.Printf("Failed to remove orphaned directory %s: %v", dir, err)
+			} else {
+				log.Printf("Removed orphaned directory %s", dir)
+				result.removed++
+				continue
+			}
+		}
+		result.dirs++
+		result.usage += dirSize(dir)
+	}
+	return result
+}
+
+// dirSize returns the size of the files below dir. Files removed while it
+// walks are skipped.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// runJanitor periodically removes orphaned temporary directories and
+// enforces the quota of the temporary root. While the server uses more than
+// the quota, idle workspaces are dropped and validations are refused until
+// running ones finish and free space.
+func (s *Server) runJanitor(ctx context.Context) {
+	for {
+		cfg := s.currentConfig()
+		result := sweepTempDirs(os.TempDir(), time.Duration(cfg.Temp.OrphanAgeSec)*time.Second)
+		tempUsage.Set(float64(result.usage))
+		tempDirCount.Set(float64(result.dirs))
+		tempOrphansRemoved.Add(float64(result.removed))
+		s.tempUsage.Store(result.usage)
+
+		if cfg.overTempQuota(result.usage) {
+			log.Printf("Temporary directories use %d MB, over the quota of %d MB", result.usage/(1024*1024), cfg.Temp.QuotaMB)
+			s.workspaces.drain()
+		}
+
+		if !sleep(ctx, time.Duration(cfg.Temp.IntervalSec)*time.Second) {
+			return
+		}
+	}
+}
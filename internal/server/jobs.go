@@ -0,0 +1,316 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Job backends of the jobs setting.
+const (
+	JobsMemory = "memory"
+	JobsRedis  = "redis"
+)
+
+// jobRecoverInterval is how often runners look for jobs of replicas that
+// stopped while running them.
+const jobRecoverInterval = time.Minute
+
+// ErrJobNotFound is returned for jobs that do not exist or have expired.
+var ErrJobNotFound = errors.New("job not found")
+
+// JobQueue holds the state of asynchronous validations and the queue of
+// those waiting to run. Implementations must be safe for concurrent use by
+// the handlers and runners of every replica sharing them.
+type JobQueue interface {
+	// Enqueue stores a new queued job with its request.
+	Enqueue(ctx context.Context, job *Job, request *JobRequest) error
+	// Dequeue blocks until a job is queued or ctx is done, and returns it
+	// marked running with its request.
+	Dequeue(ctx context.Context) (*Job, *JobRequest, error)
+	// Finish stores the result of a job taken by Dequeue.
+	Finish(ctx context.Context, job *Job) error
+	// Get returns a job, ErrJobNotFound if it does not exist or expired.
+	Get(ctx context.Context, id string) (*Job, error)
+	// Recover queues jobs again that have been running for longer than
+	// olderThan, which the replica running them must have lost, and returns
+	// how many.
+	Recover(ctx context.Context, olderThan time.Duration) (int, error)
+	// Queued returns the number of jobs waiting to run.
+	Queued(ctx context.Context) (int, error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// newJobQueue returns the queue of the configured backend.
+func newJobQueue(cfg JobsConfig) (JobQueue, error) {
+	retention := time.Duration(cfg.RetentionSec) * time.Second
+	switch cfg.Backend {
+	case JobsMemory:
+		return NewMemoryQueue(retention), nil
+	case JobsRedis:
+		return NewRedisQueue(cfg.RedisURL, cfg.KeyPrefix, retention)
+	default:
+		return nil, fmt.Errorf("unknown jobs backend %q", cfg.Backend)
+	}
+}
+
+func newJobID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// submitJob queues a validation and answers with the queued job, which it
+// returns, nil if it could not be queued.
+func (s *Server) submitJob(c *gin.Context, request *JobRequest) *Job {
+	job := &Job{ID: newJobID(), Status: JobQueued, CreatedAt: time.Now().UTC(), Tenant: request.Tenant}
+	if err := s.jobs.Enqueue(c.Request.Context(), job, request); err != nil {
+		problem(c, http.StatusServiceUnavailable, ValidateResponse{
+			Success: false,
+			Message: "Failed to queue validation",
+			Error:   err.Error(),
+			UseCase: request.useCase(),
+		})
+		return nil
+	}
+	c.Header("Location", "/jobs/"+job.ID)
+	sendJSON(c, http.StatusAccepted, job)
+	return job
+}
+
+func (s *Server) getJob(c *gin.Context) {
+	job, err := s.jobs.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && !visibleTo(c, job.Tenant) {
+		err = ErrJobNotFound
+	}
+	if errors.Is(err, ErrJobNotFound) {
+		problem(c, http.StatusNotFound, gin.H{"error": "unknown job " + c.Param("id")})
+		return
+	}
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	sendJSON(c, http.StatusOK, job)
+}
+
+// runJobs takes jobs from the queue and validates them, runners jobs at a
+// time, while the workers they share with synchronous requests allow. Once
+// ctx is cancelled no more jobs are taken, the ones taken still finish.
+func (s *Server) runJobs(ctx context.Context, runners int) {
+	for i := 0; i < runners; i++ {
+		go func() {
+			for {
+				// Jobs stay queued while an admin paused the queue
+				if s.gate.wait(ctx) != nil {
+					return
+				}
+				job, request, err := s.jobs.Dequeue(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					log.Printf("Failed to take a job: %v", err)
+					sleep(ctx, time.Second)
+					continue
+				}
+				s.runJob(context.WithoutCancel(ctx), job, request)
+			}
+		}()
+	}
+
+	// Jobs run at most for the timeout, once a worker is free
+	go func() {
+		for {
+			if !sleep(ctx, jobRecoverInterval) {
+				return
+			}
+			olderThan := 2*s.currentConfig().timeout() + jobRecoverInterval
+			if n, err := s.jobs.Recover(ctx, olderThan); err != nil {
+				log.Printf("Failed to recover jobs: %v", err)
+			} else if n > 0 {
+				log.Printf("Queued %d lost jobs again", n)
+			}
+		}
+	}()
+}
+
+// runJob validates the request of a job once a worker is free. Jobs wait for
+// workers as long as it takes, the timeout only applies to the validation.
+func (s *Server) runJob(ctx context.Context, job *Job, request *JobRequest) {
+	cfg := s.currentConfig()
+	key := s.requestKey(cfg, request)
+	var status int
+	var response ValidateResponse
+	if cached, ok := s.cachedResult(ctx, key); ok {
+		status, response = cached.Status, cached.Response
+	} else if flight, joined, result, ok := s.awaitFlight(ctx, s.flightKey(cfg, request, false)); ok {
+		status, response = joined, result
+	} else {
+		// ctx never ends, so acquire only returns once a worker is free
+		s.pool.acquire(ctx)
+		cfg = s.currentConfig()
+		running, stop := s.running.start(ctx, job.ID)
+		status, response = s.runJobValidation(running, cfg, request)
+		status, response = cancelledResult(running, status, response)
+		stop()
+		s.pool.release()
+		flight.finish(status, response)
+		s.cacheResult(ctx, key, status, response)
+	}
+	if canaryWanted(cfg, request) {
+		go s.runCanary(cfg, request, status, response)
+	}
+
+	// The history comes first so that the job links to its entry
+	entry := newHistoryEntry(request, status, response, *job.StartedAt)
+	entry.JobID = job.ID
+	response = s.recordResult(ctx, request.BaseURL, entry)
+
+	finished := time.Now().UTC()
+	job.Status, job.FinishedAt = JobDone, &finished
+	job.HTTPStatus, job.Result = status, &response
+	if err := s.jobs.Finish(ctx, job); err != nil {
+		log.Printf("Failed to store the result of job %s: %v", job.ID, err)
+	}
+}
+
+// runJobValidation runs the request of a job in a temporary directory of its
+// own, the uploads of the request were read when it was queued.
+func (s *Server) runJobValidation(ctx context.Context, cfg *runtimeConfig, request *JobRequest) (int, ValidateResponse) {
+	tempDir, err := makeTempDir("validator-*")
+	if err != nil {
+		return http.StatusInternalServerError, ValidateResponse{
+			Success: false,
+			Message: "Failed to create temporary directory",
+			Error:   err.Error(),
+			UseCase: request.useCase(),
+		}
+	}
+	defer removeTempDir(tempDir)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	v := &validation{cfg: cfg, request: request, dir: tempDir, workspaces: s.workspaces, cache: s.cache, hhfabVersion: s.hhfabVersion(), started: time.Now()}
+	return v.run(ctx)
+}
+
+// memoryQueue keeps jobs in the process. Jobs are lost on restart and only
+// run by this replica.
+type memoryQueue struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	requests  map[string]*JobRequest
+	pending   []string
+	wake      chan struct{}
+	retention time.Duration
+}
+
+// NewMemoryQueue returns a JobQueue keeping jobs in memory, and the results
+// of finished jobs for retention.
+func NewMemoryQueue(retention time.Duration) JobQueue {
+	return &memoryQueue{
+		jobs:      map[string]*Job{},
+		requests:  map[string]*JobRequest{},
+		wake:      make(chan struct{}),
+		retention: retention,
+	}
+}
+
+func (q *memoryQueue) Enqueue(ctx context.Context, job *Job, request *JobRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	stored := *job
+	q.jobs[job.ID] = &stored
+	q.requests[job.ID] = request
+	q.pending = append(q.pending, job.ID)
+	close(q.wake)
+	q.wake = make(chan struct{})
+	return nil
+}
+
+func (q *memoryQueue) Dequeue(ctx context.Context) (*Job, *JobRequest, error) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			id := q.pending[0]
+			q.pending = q.pending[1:]
+			job := q.jobs[id]
+			started := time.Now().UTC()
+			job.Status, job.StartedAt = JobRunning, &started
+			running, request := *job, q.requests[id]
+			q.mu.Unlock()
+			return &running, request, nil
+		}
+		wake := q.wake
+		q.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+func (q *memoryQueue) Finish(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stored := *job
+	q.jobs[job.ID] = &stored
+	delete(q.requests, job.ID)
+	return nil
+}
+
+func (q *memoryQueue) Get(ctx context.Context, id string) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	found := *job
+	return &found, nil
+}
+
+// Recover has nothing to do, running jobs end with the process.
+func (q *memoryQueue) Recover(ctx context.Context, olderThan time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (q *memoryQueue) Queued(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending), nil
+}
+
+func (q *memoryQueue) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (q *memoryQueue) Close() error {
+	return nil
+}
+
+// expire drops finished jobs older than the retention. The caller holds mu.
+func (q *memoryQueue) expire() {
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > q.retention {
+			delete(q.jobs, id)
+		}
+	}
+}
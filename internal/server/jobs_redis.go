@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisDequeueWait bounds each blocking wait for a job, so Dequeue notices
+// a cancelled context.
+const redisDequeueWait = 5 * time.Second
+
+// redisQueue shares jobs between replicas through Redis. Queued job IDs are
+// in the list <prefix>:queue, moved to <prefix>:running while a replica runs
+// them; jobs and their requests are stored as JSON under <prefix>:job:<id>
+// and <prefix>:request:<id>.
+type redisQueue struct {
+	client    *redis.Client
+	prefix    string
+	retention time.Duration
+}
+
+// NewRedisQueue returns a JobQueue in the Redis server at url, such as
+// redis://localhost:6379/0, with keys starting with prefix. Results of
+// finished jobs expire after retention.
+func NewRedisQueue(url, prefix string, retention time.Duration) (JobQueue, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("parsing redis_url: %w", err)
+	}
+	// Blocking waits end with the context of the runner
+	options.ContextTimeoutEnabled = true
+	return &redisQueue{client: redis.NewClient(options), prefix: prefix, retention: retention}, nil
+}
+
+func (q *redisQueue) key(parts ...string) string {
+	key := q.prefix
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return key
+}
+
+func (q *redisQueue) Enqueue(ctx context.Context, job *Job, request *JobRequest) error {
+	jobData, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	requestData, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, q.key("job", job.ID), jobData, 0)
+		pipe.Set(ctx, q.key("request", job.ID), requestData, 0)
+		pipe.LPush(ctx, q.key("queue"), job.ID)
+		return nil
+	})
+	return err
+}
+
+func (q *redisQueue) Dequeue(ctx context.Context) (*Job, *JobRequest, error) {
+	for {
+		id, err := q.client.BLMove(ctx, q.key("queue"), q.key("running"), "RIGHT", "LEFT", redisDequeueWait).Result()
+		if errors.Is(err, redis.Nil) {
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		job, err := q.Get(ctx, id)
+		if err != nil {
+			// Jobs deleted from Redis are dropped
+			if errors.Is(err, ErrJobNotFound) {
+				q.client.LRem(ctx, q.key("running"), 1, id)
+				continue
+			}
+			return nil, nil, err
+		}
+		request := &JobRequest{}
+		data, err := q.client.Get(ctx, q.key("request", id)).Bytes()
+		if err == nil {
+			err = json.Unmarshal(data, request)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading request of job %s: %w", id, err)
+		}
+
+		started := time.Now().UTC()
+		job.Status, job.StartedAt = JobRunning, &started
+		if err := q.store(ctx, q.client, job, 0); err != nil {
+			return nil, nil, err
+		}
+		return job, request, nil
+	}
+}
+
+func (q *redisQueue) Finish(ctx context.Context, job *Job) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if err := q.store(ctx, pipe, job, q.retention); err != nil {
+			return err
+		}
+		pipe.Del(ctx, q.key("request", job.ID))
+		pipe.LRem(ctx, q.key("running"), 1, job.ID)
+		return nil
+	})
+	return err
+}
+
+func (q *redisQueue) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := q.client.Get(ctx, q.key("job", id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("reading job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// Recover queues running jobs again whose replica stopped. Only the replica
+// removing a job from the running list queues it, so concurrent recoveries
+// do not run a job twice. A job taken by Dequeue but not marked running yet
+// counts from its creation; validations are idempotent, so recovering one
+// early only costs a second run.
+func (q *redisQueue) Recover(ctx context.Context, olderThan time.Duration) (int, error) {
+	ids, err := q.client.LRange(ctx, q.key("running"), 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	recovered := 0
+	for _, id := range ids {
+		job, err := q.Get(ctx, id)
+		if errors.Is(err, ErrJobNotFound) {
+			q.client.LRem(ctx, q.key("running"), 1, id)
+			continue
+		}
+		if err != nil {
+			return recovered, err
+		}
+		since := job.CreatedAt
+		if job.StartedAt != nil {
+			since = *job.StartedAt
+		}
+		if job.Status == JobDone || time.Since(since) <= olderThan {
+			continue
+		}
+		removed, err := q.client.LRem(ctx, q.key("running"), 1, id).Result()
+		if err != nil {
+			return recovered, err
+		}
+		if removed == 0 {
+			continue
+		}
+		job.Status, job.StartedAt = JobQueued, nil
+		if err := q.store(ctx, q.client, job, 0); err != nil {
+			return recovered, err
+		}
+		if err := q.client.RPush(ctx, q.key("queue"), id).Err(); err != nil {
+			return recovered, err
+		}
+		recovered++
+	}
+	return recovered, nil
+}
+
+func (q *redisQueue) Queued(ctx context.Context) (int, error) {
+	n, err := q.client.LLen(ctx, q.key("queue")).Result()
+	return int(n), err
+}
+
+func (q *redisQueue) Ping(ctx context.Context) error {
+	return q.client.Ping(ctx).Err()
+}
+
+func (q *redisQueue) Close() error {
+	return q.client.Close()
+}
+
+// store saves a job, expiring after ttl unless it is 0.
+func (q *redisQueue) store(ctx context.Context, client redis.Cmdable, job *Job, ttl time.Duration) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, q.key("job", job.ID), data, ttl).Err()
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// jwtLeeway tolerates clocks of token issuers running apart from ours.
+const jwtLeeway = time.Minute
+
+var errInvalidJWT = errors.New("invalid token")
+
+// loadJWTKey reads the PEM public key tokens signed with RS256 or ES256 are
+// verified with.
+func loadJWTKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT public key %s is not PEM encoded", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing JWT public key: %w", err)
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("JWT public key %s is neither an RSA nor an ECDSA key", path)
+}
+
+// verifyJWT checks the signature and the time, issuer and audience claims
+// of token and returns its claims. HS256 tokens are verified with the
+// secret, RS256 and ES256 ones with key; other algorithms, none among them,
+// are refused.
+func verifyJWT(token string, cfg JWTConfig, key crypto.PublicKey, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+
+	valid := false
+	switch header.Alg {
+	case "HS256":
+		if cfg.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(cfg.Secret))
+			mac.Write(signed)
+			valid = hmac.Equal(signature, mac.Sum(nil))
+		}
+	case "RS256":
+		if pub, ok := key.(*rsa.PublicKey); ok {
+			valid = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+		}
+	case "ES256":
+		if pub, ok := key.(*ecdsa.PublicKey); ok && len(signature) == 64 {
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			valid = ecdsa.Verify(pub, digest[:], r, s)
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: bad signature or unsupported algorithm %q", errInvalidJWT, header.Alg)
+	}
+
+	claims := map[string]any{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, fmt.Errorf("%w: expired", errInvalidJWT)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: not valid yet", errInvalidJWT)
+	}
+	if cfg.Issuer != "" && claims["iss"] != cfg.Issuer {
+		return nil, fmt.Errorf("%w: wrong issuer", errInvalidJWT)
+	}
+	if cfg.Audience != "" && !jwtAudience(claims["aud"], cfg.Audience) {
+		return nil, fmt.Errorf("%w: wrong audience", errInvalidJWT)
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errInvalidJWT
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errInvalidJWT
+	}
+	return nil
+}
+
+// jwtAudience reports whether the aud claim, a string or a list of them,
+// names audience.
+func jwtAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/internal/wiring"
+)
+
+// kubeconformOutput is what kubeconform -output json prints: the resources
+// that did not pass.
+type kubeconformOutput struct {
+	Resources []struct {
+		Filename         string               `json:"filename"`
+		Kind             string               `json:"kind"`
+		Name             string               `json:"name"`
+		Status           string               `json:"status"`
+		Msg              string               `json:"msg"`
+		ValidationErrors []kubeconformFinding `json:"validationErrors"`
+	} `json:"resources"`
+}
+
+// kubeconformFinding is a field of a resource that does not match its
+// schema, by its JSON pointer.
+type kubeconformFinding struct {
+	Path string `json:"path"`
+	Msg  string `json:"msg"`
+}
+
+// runKubeconform runs the saved uploads through the kubeconform of cfg
+// against the CRD schemas, exported to the temporary directory of the
+// validation, and returns its findings located in the uploads. Objects of
+// kinds without a schema are left alone. A kubeconform that cannot run is
+// reported with a warning instead of failing the validation.
+func (v *validation) runKubeconform(ctx context.Context, sources []sourceFile, parsed *parsedSources) []Diagnostic {
+	cfg := v.cfg.Kubeconform
+	if cfg.Path == "" || len(sources) == 0 {
+		return nil
+	}
+	skipped := func(err error) []Diagnostic {
+		log.Printf("kubeconform could not run: %v", err)
+		return []Diagnostic{{
+			Severity: SeverityWarning,
+			Message:  "kubeconform could not run, its checks were skipped: " + err.Error(),
+			Source:   SourceKubeconform,
+		}}
+	}
+
+	schemas := filepath.Join(v.dir, "kubeconform")
+	if err := v.cfg.schemas.WriteJSONSchemas(schemas, cfg.Strict); err != nil {
+		return skipped(err)
+	}
+	args := []string{"-output", "json", "-ignore-missing-schemas", "-schema-location", filepath.Join(schemas, "{{ .Group }}", "{{ .ResourceKind }}_{{ .ResourceAPIVersion }}.json")}
+	if cfg.Strict {
+		args = append(args, "-strict")
+	}
+	byPath := map[string]string{}
+	for _, source := range sources {
+		args = append(args, source.Path)
+		byPath[source.Path] = source.Name
+	}
+
+	// kubeconform exits with 1 when resources are invalid
+	stdout, err := exec.CommandContext(ctx, cfg.Path, args...).Output()
+	var output kubeconformOutput
+	if jsonErr := json.Unmarshal(stdout, &output); jsonErr != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		} else if err == nil {
+			err = jsonErr
+		}
+		return skipped(err)
+	}
+
+	diagnostics := []Diagnostic{}
+	for _, resource := range output.Resources {
+		if resource.Status != "statusInvalid" && resource.Status != "statusError" {
+			continue
+		}
+		file := byPath[resource.Filename]
+		var object *wiring.Object
+		for _, o := range parsed.objects {
+			if o.File == file && o.Kind == resource.Kind && o.Name == resource.Name {
+				object = o
+				break
+			}
+		}
+		findings := resource.ValidationErrors
+		if len(findings) == 0 {
+			findings = append(findings, kubeconformFinding{Msg: resource.Msg})
+		}
+		for _, finding := range findings {
+			d := Diagnostic{
+				Severity: cfg.Severity,
+				Code:     codes.InvalidField,
+				Message:  finding.Msg,
+				Source:   SourceKubeconform,
+				File:     file,
+				Path:     dottedPath(finding.Path),
+			}
+			if d.Path != "" {
+				d.Message = d.Path + ": " + d.Message
+			}
+			if object != nil {
+				d.Object, d.Line = object.Key(), pointerLine(object, finding.Path)
+				d.Message = object.Key() + ": " + d.Message
+			}
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// pointerSegments splits a JSON pointer such as /spec/ranges/0/from.
+func pointerSegments(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return nil
+	}
+	segments := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+	}
+	return segments
+}
+
+// dottedPath writes a JSON pointer the way schema violations do, such as
+// spec.ranges[0].from.
+func dottedPath(pointer string) string {
+	path := ""
+	for _, segment := range pointerSegments(pointer) {
+		if _, err := strconv.Atoi(segment); err == nil {
+			path += "[" + segment + "]"
+		} else if path == "" {
+			path = segment
+		} else {
+			path += "." + segment
+		}
+	}
+	return path
+}
+
+// pointerLine returns the line of the field of object a JSON pointer names,
+// or of the closest field above it that exists.
+func pointerLine(object *wiring.Object, pointer string) int {
+	line := object.Line
+	node := object.Node
+	for _, segment := range pointerSegments(pointer) {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					line, next = node.Content[i].Line, node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(segment); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+				line = next.Line
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics is the registry served on GET /metrics.
+var metrics = prometheus.NewRegistry()
+
+var (
+	// validations counts finished validations by tenant and result: passed
+	// or failed
+	validations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "validations_total",
+		Help:      "Finished validations by tenant and result (passed, failed).",
+	}, []string{"tenant", "result"})
+
+	// cacheLookups counts result cache lookups by result: hit, miss or
+	// error. The hit rate is hits over all lookups.
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "cache_lookups_total",
+		Help:      "Result cache lookups by result (hit, miss, error).",
+	}, []string{"result"})
+
+	// workspaceInits counts `hhfab init` runs, which the workspace pool
+	// keeps off the hot path
+	workspaceInits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "workspace_inits_total",
+		Help:      "hhfab workspaces initialized.",
+	})
+
+	// requestsShed counts requests turned away while too many were waiting
+	// for a worker
+	requestsShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "requests_shed_total",
+		Help:      "Requests turned away with 503 while the worker queue was full.",
+	})
+
+	// requestsCoalesced counts requests answered with the result of an
+	// identical one validated at the same time
+	requestsCoalesced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "requests_coalesced_total",
+		Help:      "Requests answered with the result of an identical concurrent validation.",
+	})
+
+	// idempotentRequests counts requests with an Idempotency-Key by result:
+	// claimed by the first request, replayed, mismatch or pending when
+	// turned away, or error when the store failed
+	idempotentRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "idempotent_requests_total",
+		Help:      "Requests with an Idempotency-Key by result (claimed, replayed, mismatch, pending, error).",
+	}, []string{"result"})
+
+	// canaryValidations counts validations run with the candidate hhfab of
+	// canary by result: match or diverged from hhfab_path, or error when the
+	// candidate could not run
+	canaryValidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "canary_validations_total",
+		Help:      "Validations run with the candidate hhfab by result (match, diverged, error).",
+	}, []string{"result"})
+
+	// webhookDeliveries counts webhook deliveries by result: delivered, or
+	// failed once the attempts ran out
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook deliveries by result (delivered, failed).",
+	}, []string{"result"})
+
+	// addressesDenied counts requests rejected for their address, by the
+	// list that rejected them: deny, or allow for addresses not on it
+	addressesDenied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "addresses_denied_total",
+		Help:      "Requests rejected for their address by list (deny, allow).",
+	}, []string{"list"})
+
+	// auditEvents counts audit events by exporter and result: exported,
+	// failed, or dropped before reaching the exporters
+	auditEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "audit_events_total",
+		Help:      "Audit events by exporter and result (exported, failed, dropped).",
+	}, []string{"exporter", "result"})
+
+	// resourceLimitKills counts hhfab runs that broke a resource limit, by
+	// limit: memory or pids
+	resourceLimitKills = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "resource_limit_exceeded_total",
+		Help:      "hhfab runs that broke a resource limit, by limit (memory, pids).",
+	}, []string{"limit"})
+
+	// tempUsage, tempDirCount and tempOrphansRemoved report the temporary
+	// directories as of the last sweep of the janitor
+	tempUsage = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "validator",
+		Name:      "temp_usage_bytes",
+		Help:      "Size of the temporary directories of the server.",
+	})
+	tempDirCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "validator",
+		Name:      "temp_dirs",
+		Help:      "Temporary directories of the server.",
+	})
+	tempOrphansRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "temp_orphans_removed_total",
+		Help:      "Orphaned temporary directories removed by the janitor.",
+	})
+
+	// selfTests counts self-tests by trigger, scheduled or requested, and
+	// result: passed or failed. selfTestFixturePassed and selfTestLastPassed
+	// report the fixtures of the last one and when one last passed.
+	selfTests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "validator",
+		Name:      "selftests_total",
+		Help:      "Self-tests by trigger (scheduled, requested) and result (passed, failed).",
+	}, []string{"trigger", "result"})
+	selfTestFixturePassed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "validator",
+		Name:      "selftest_fixture_passed",
+		Help:      "Whether each fixture passed the last self-test, 1 or 0.",
+	}, []string{"fixture"})
+	selfTestLastPassed = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "validator",
+		Name:      "selftest_last_success_timestamp_seconds",
+		Help:      "Unix time of the last self-test that passed.",
+	})
+)
+
+func init() {
+	metrics.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		validations,
+		cacheLookups,
+		workspaceInits,
+		requestsShed,
+		webhookDeliveries,
+		auditEvents,
+		addressesDenied,
+		resourceLimitKills,
+		requestsCoalesced,
+		idempotentRequests,
+		canaryValidations,
+		tempUsage,
+		tempDirCount,
+		tempOrphansRemoved,
+		selfTests,
+		selfTestFixturePassed,
+		selfTestLastPassed,
+	)
+}
+
+// getMetrics serves the metrics in the Prometheus text format, compressed by
+// the middleware of the router.
+func getMetrics() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(metrics, promhttp.HandlerOpts{DisableCompression: true}))
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errOverloaded is returned by tryAcquire to requests it turns away.
+var errOverloaded = errors.New("too many requests are waiting for a worker")
+
+// workerPool bounds the number of hhfab runs executing at once. Requests over
+// the limit wait in line; the limit is read on every attempt so configuration
+// reloads resize the pool without dropping waiters.
+type workerPool struct {
+	mu      sync.Mutex
+	active  int
+	waiting int
+	wake    chan struct{}
+	limit   func() int
+}
+
+func newWorkerPool(limit func() int) *workerPool {
+	return &workerPool{wake: make(chan struct{}), limit: limit}
+}
+
+// acquire blocks until a worker slot is free or ctx is done.
+func (p *workerPool) acquire(ctx context.Context) error {
+	return p.tryAcquire(ctx, 0)
+}
+
+// tryAcquire is acquire for requests that would rather be turned away than
+// wait in line behind maxWaiting others, failing with errOverloaded. A zero
+// maxWaiting lets them wait however long the line is.
+func (p *workerPool) tryAcquire(ctx context.Context, maxWaiting int) error {
+	p.mu.Lock()
+	if maxWaiting > 0 && p.active >= p.limit() && p.waiting >= maxWaiting {
+		p.mu.Unlock()
+		return errOverloaded
+	}
+	p.waiting++
+	for p.active >= p.limit() {
+		wake := p.wake
+		p.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.waiting--
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+		p.mu.Lock()
+	}
+	p.waiting--
+	p.active++
+	p.mu.Unlock()
+	return nil
+}
+
+// saturated reports whether tryAcquire would turn requests away.
+func (p *workerPool) saturated(maxWaiting int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maxWaiting > 0 && p.active >= p.limit() && p.waiting >= maxWaiting
+}
+
+// release frees a slot taken by acquire and wakes the waiters.
+func (p *workerPool) release() {
+	p.mu.Lock()
+	p.active--
+	close(p.wake)
+	p.wake = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// idle blocks until no validation holds a worker or ctx is done, and
+// reports whether the workers went idle.
+func (p *workerPool) idle(ctx context.Context) bool {
+	p.mu.Lock()
+	for p.active > 0 {
+		wake := p.wake
+		p.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return false
+		}
+		p.mu.Lock()
+	}
+	p.mu.Unlock()
+	return true
+}
+
+// stats returns the number of running and queued validations.
+func (p *workerPool) stats() (active, waiting int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active, p.waiting
+}
+
+// shed answers a request turned away while the worker queue is full, or
+// timed out waiting for a worker, with 503, telling the client when to retry
+// instead of leaving it waiting until it times out.
+func (s *Server) shed(c *gin.Context, cfg *runtimeConfig, useCase string) {
+	_, waiting := s.pool.stats()
+	requestsShed.Inc()
+	retryAfter := cfg.Workers.RetryAfterSec
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	problem(c, http.StatusServiceUnavailable, ValidateResponse{
+		Success: false,
+		Message: "Server overloaded",
+		Error:   fmt.Sprintf("%d requests are waiting for a worker, retry in %d seconds", waiting, retryAfter),
+		UseCase: useCase,
+		Overload: &Overload{
+			Waiting:       waiting,
+			ShedQueue:     cfg.Workers.ShedQueue,
+			RetryAfterSec: retryAfter,
+		},
+	})
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader carries the ID of a request, which problem documents
+	// name as their instance
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// requestIDPattern bounds the request IDs taken over from clients and
+// proxies, which end up in logs and audit events.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// requestID names every request with the ID of its X-Request-ID header, or
+// a new random one, and answers with it.
+func requestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = newJobID()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(RequestIDHeader, id)
+	c.Next()
+}
+
+// problemType returns the problem type of a response with status and the
+// members of body.
+func problemType(status int, members map[string]any) string {
+	switch status {
+	case http.StatusBadRequest:
+		// Validation results name their use case, rejected requests none
+		if useCase, _ := members["use_case"].(string); useCase != "" {
+			return ProblemValidationFailed
+		}
+		return ProblemInvalidRequest
+	case http.StatusUnauthorized:
+		return ProblemUnauthorized
+	case http.StatusForbidden:
+		return ProblemForbidden
+	case http.StatusNotFound:
+		return ProblemNotFound
+	case http.StatusRequestEntityTooLarge:
+		return ProblemUploadTooLarge
+	case http.StatusConflict:
+		if members["idempotency"] != nil {
+			return ProblemIdempotency
+		}
+		return ProblemConflict
+	case http.StatusUnprocessableEntity:
+		if members["idempotency"] != nil {
+			return ProblemIdempotency
+		}
+		return ProblemImplausible
+	case http.StatusTooManyRequests:
+		return ProblemRateLimited
+	case http.StatusServiceUnavailable:
+		if members["overload"] != nil {
+			return ProblemOverloaded
+		}
+		return ProblemUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return ProblemInternal
+	}
+	return ProblemInvalidRequest
+}
+
+// problem answers with a problem document (RFC 7807) for status: the
+// members of body, such as the diagnostics of a failed validation or the
+// limit an upload exceeded, extended by type, title, status, detail and
+// instance. The title is the message of body, or else the text of status,
+// the detail its error. Both stay in the document as message and error for
+// older clients.
+func problem(c *gin.Context, status int, body any) {
+	members := map[string]any{}
+	if data, err := json.Marshal(body); err == nil {
+		json.Unmarshal(data, &members)
+	}
+	// Version 1 of the response schema had no problem documents
+	if schemaOf(c) < 2 {
+		sendJSON(c, status, members)
+		return
+	}
+	title, _ := members["message"].(string)
+	if title == "" {
+		title = http.StatusText(status)
+	}
+	members["type"] = problemType(status, members)
+	members["title"] = title
+	members["status"] = status
+	if detail, _ := members["error"].(string); detail != "" {
+		members["detail"] = detail
+	}
+	if id := c.GetString(requestIDKey); id != "" {
+		members["instance"] = id
+	}
+	writeJSON(c, status, ProblemContentType, members)
+}
+
+// abortProblem answers with a problem document and stops the handlers of
+// the request.
+func abortProblem(c *gin.Context, status int, body any) {
+	problem(c, status, body)
+	c.Abort()
+}
+
+// respondJSON answers with body as JSON for 2xx statuses, as a problem
+// document otherwise.
+func respondJSON(c *gin.Context, status int, body any) {
+	if status >= 200 && status <= 299 {
+		sendJSON(c, status, body)
+		return
+	}
+	problem(c, status, body)
+}
+
+// noRoute answers requests to paths and methods the API does not serve.
+func noRoute(c *gin.Context) {
+	problem(c, http.StatusNotFound, gin.H{"error": "no endpoint " + c.Request.Method + " " + c.Request.URL.Path})
+}
+
+// recovered answers requests whose handler panicked.
+func recovered(c *gin.Context, err any) {
+	abortProblem(c, http.StatusInternalServerError, gin.H{"error": "internal server error"})
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const rateLimitIdleExpiry = 10 * time.Minute
+
+// rateLimiter is a token bucket per client key. Rates are passed on every
+// call so configuration reloads take effect without resetting the buckets.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*tokenBucket{}}
+}
+
+func (l *rateLimiter) allow(key string, cfg RateLimitConfig, now time.Time) bool {
+	if cfg.RequestsPerMinute == 0 {
+		return true
+	}
+	burst := float64(cfg.Burst)
+	if burst == 0 {
+		burst = float64(cfg.RequestsPerMinute)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > rateLimitIdleExpiry {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Minutes() * float64(cfg.RequestsPerMinute)
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimit rejects requests from clients that exceeded the configured rate.
+// Clients are told apart by tenant and address, X-Forwarded-For only counting
+// from trusted proxies, and tenants with a rate limit of their own share it
+// among their addresses.
+func (s *Server) rateLimit(c *gin.Context) {
+	cfg := s.currentConfig()
+	tenant := tenantOf(c)
+	key, limit := tenant+"/"+cfg.addresses.clientAddress(c.Request), cfg.RateLimit
+	if own := cfg.Tenants[tenant].RateLimit; own != nil {
+		key, limit = tenant, *own
+	}
+	if !s.limiter.allow(key, limit, time.Now()) {
+		abortProblem(c, http.StatusTooManyRequests, ValidateResponse{
+			Success: false,
+			Message: "Rate limit exceeded",
+			Error:   "too many validation requests, retry later",
+		})
+		return
+	}
+	c.Next()
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selfCheckResult caches the last run of `hhfab init` so readiness probes stay
+// cheap while still proving the binary actually works.
+type selfCheckResult struct {
+	ok        bool
+	err       string
+	version   string
+	checkedAt time.Time
+}
+
+// runSelfChecks periodically initializes a throwaway hhfab workspace, after
+// hashing the hhfab binary in full when hhfab_sha256 is set.
+func (s *Server) runSelfChecks(ctx context.Context) {
+	for {
+		cfg := s.currentConfig()
+		if cfg.pinsHHFab() {
+			s.verifyHHFab(cfg, true)
+		}
+		result := selfCheck(cfg)
+
+		s.selfCheckMu.Lock()
+		s.lastSelfCheck = result
+		s.selfCheckMu.Unlock()
+
+		if !sleep(ctx, time.Duration(cfg.Readiness.SelfCheckIntervalSec)*time.Second) {
+			return
+		}
+	}
+}
+
+func selfCheck(cfg *runtimeConfig) selfCheckResult {
+	result := selfCheckResult{checkedAt: time.Now()}
+
+	tempDir, err := makeTempDir("validator-selfcheck-*")
+	if err != nil {
+		result.err = fmt.Sprintf("creating temporary directory: %s", err)
+		return result
+	}
+	defer removeTempDir(tempDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout())
+	defer cancel()
+
+	backend := cfg.validator()
+	if version, err := backend.Version(ctx); err == nil {
+		result.version = strings.TrimSpace(version)
+	}
+
+	if output, err := backend.Init(ctx, tempDir, "--dev"); err != nil {
+		result.err = fmt.Sprintf("hhfab init failed: %s: %s", err, output)
+		return result
+	}
+
+	result.ok = true
+	return result
+}
+
+// getLiveness reports that the process is up and serving requests.
+func getLiveness(c *gin.Context) {
+	sendJSON(c, http.StatusOK, gin.H{"status": "alive"})
+}
+
+// getReadiness reports whether the server can take validation traffic.
+func (s *Server) getReadiness(c *gin.Context) {
+	checks := s.readinessChecks(s.currentConfig())
+
+	status := http.StatusOK
+	response := ReadinessResponse{Status: "ready", Checks: checks}
+	for _, check := range checks {
+		if !check.OK {
+			status = http.StatusServiceUnavailable
+			response.Status = "not ready"
+		}
+	}
+	sendJSON(c, status, response)
+}
+
+func (s *Server) readinessChecks(cfg *runtimeConfig) []ReadinessCheck {
+	checks := []ReadinessCheck{
+		s.checkSelfTest(cfg),
+		checkDiskSpace(cfg),
+		s.checkTempQuota(cfg),
+		s.checkQueue(cfg),
+		s.checkJobs(cfg),
+	}
+	if cfg.HHFabSHA256 != "" {
+		checks = append(checks, s.checkIntegrity(cfg))
+	}
+	if s.cache != nil {
+		checks = append(checks, s.checkCache(cfg))
+	}
+	if s.history != nil {
+		checks = append(checks, s.checkHistory(cfg))
+	}
+	if s.idempotency != nil {
+		checks = append(checks, s.checkIdempotency(cfg))
+	}
+	return checks
+}
+
+func (s *Server) checkSelfTest(cfg *runtimeConfig) ReadinessCheck {
+	s.selfCheckMu.RLock()
+	result := s.lastSelfCheck
+	s.selfCheckMu.RUnlock()
+
+	check := ReadinessCheck{Name: "hhfab"}
+	if cfg.schemaOnly() {
+		check.OK = true
+		check.Detail = "not available, validating against schemas only"
+		return check
+	}
+	interval := time.Duration(cfg.Readiness.SelfCheckIntervalSec) * time.Second
+	switch {
+	case result.checkedAt.IsZero():
+		check.Detail = "self-check has not completed yet"
+	case !result.ok:
+		check.Detail = result.err
+	case time.Since(result.checkedAt) > 3*interval:
+		check.Detail = fmt.Sprintf("last successful self-check at %s is stale", result.checkedAt.Format(time.RFC3339))
+	default:
+		check.OK = true
+	}
+	return check
+}
+
+func checkDiskSpace(cfg *runtimeConfig) ReadinessCheck {
+	check := ReadinessCheck{Name: "disk"}
+	free, err := freeDiskBytes(os.TempDir())
+	if err != nil {
+		// Nothing to check against, don't block traffic over it
+		check.OK = true
+		check.Detail = err.Error()
+		return check
+	}
+
+	freeMB := int64(free / (1024 * 1024))
+	check.Detail = fmt.Sprintf("%d MB free in %s", freeMB, os.TempDir())
+	check.OK = freeMB >= cfg.Readiness.MinFreeDiskMB
+	return check
+}
+
+func (s *Server) checkTempQuota(cfg *runtimeConfig) ReadinessCheck {
+	usage := s.tempUsage.Load()
+	check := ReadinessCheck{Name: "temp", OK: !cfg.overTempQuota(usage)}
+	if cfg.Temp.QuotaMB > 0 {
+		check.Detail = fmt.Sprintf("%d MB of %d MB quota used", usage/(1024*1024), cfg.Temp.QuotaMB)
+	} else {
+		check.Detail = fmt.Sprintf("%d MB used, no quota", usage/(1024*1024))
+	}
+	return check
+}
+
+func (s *Server) checkQueue(cfg *runtimeConfig) ReadinessCheck {
+	active, waiting := s.pool.stats()
+	if s.gate.isPaused() {
+		return ReadinessCheck{
+			Name:   "queue",
+			Detail: fmt.Sprintf("paused by an admin, %d running", active),
+		}
+	}
+	return ReadinessCheck{
+		Name:   "queue",
+		OK:     waiting < cfg.Workers.MaxQueue,
+		Detail: fmt.Sprintf("%d running, %d waiting (max %d)", active, waiting, cfg.Workers.MaxQueue),
+	}
+}
+
+func (s *Server) checkJobs(cfg *runtimeConfig) ReadinessCheck {
+	check := ReadinessCheck{Name: "jobs", OK: true, Detail: cfg.Jobs.Backend}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.jobs.Ping(ctx); err != nil {
+		check.OK = false
+		check.Detail = fmt.Sprintf("%s: %s", cfg.Jobs.Backend, err)
+	}
+	return check
+}
+
+func (s *Server) checkCache(cfg *runtimeConfig) ReadinessCheck {
+	check := ReadinessCheck{Name: "cache", OK: true, Detail: cfg.Cache.Backend}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.cache.Ping(ctx); err != nil {
+		check.OK = false
+		check.Detail = fmt.Sprintf("%s: %s", cfg.Cache.Backend, err)
+	}
+	return check
+}
+
+func (s *Server) checkHistory(cfg *runtimeConfig) ReadinessCheck {
+	check := ReadinessCheck{Name: "history", OK: true, Detail: cfg.History.Backend}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.history.Ping(ctx); err != nil {
+		check.OK = false
+		check.Detail = fmt.Sprintf("%s: %s", cfg.History.Backend, err)
+	}
+	return check
+}
+
+func (s *Server) checkIdempotency(cfg *runtimeConfig) ReadinessCheck {
+	check := ReadinessCheck{Name: "idempotency", OK: true, Detail: cfg.Idempotency.Backend}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.idempotency.Ping(ctx); err != nil {
+		check.OK = false
+		check.Detail = fmt.Sprintf("%s: %s", cfg.Idempotency.Backend, err)
+	}
+	return check
+}
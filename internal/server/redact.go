@@ -0,0 +1,57 @@
+package server
+
+import (
+	"os"
+
+	"validator/internal/redact"
+)
+
+// redactor returns the Redactor of the secrets of the fab file of the
+// request, uploaded or from a template, so they are never logged, stored or
+// answered with. Read before the upload is saved to the workspace.
+func (r *JobRequest) redactor() *redact.Redactor {
+	var secrets []string
+	if r.Fab != nil {
+		data := r.Fab.Data
+		if data == nil && r.Fab.path != "" {
+			// Unreadable uploads fail the validation when they are saved
+			data, _ = os.ReadFile(r.Fab.path)
+		}
+		secrets = append(secrets, redact.Find(data)...)
+	}
+	secrets = append(secrets, redact.Find(r.Template)...)
+	return redact.New(secrets...)
+}
+
+// redactResponse masks the secrets in the text of response: its messages,
+// the hhfab output, the error and every diagnostic.
+func redactResponse(r *redact.Redactor, response *ValidateResponse) {
+	if r == nil {
+		return
+	}
+	response.Message = r.String(response.Message)
+	response.Output = r.String(response.Output)
+	response.Error = r.String(response.Error)
+	if response.Process != nil {
+		response.Process.Stdout = r.String(response.Process.Stdout)
+		response.Process.Stderr = r.String(response.Process.Stderr)
+	}
+	for _, diagnostics := range [][]Diagnostic{response.Diagnostics, response.Warnings, response.Suppressed, response.Baselined} {
+		redactDiagnostics(r, diagnostics)
+	}
+	for i := range response.Objects {
+		for j, message := range response.Objects[i].Messages {
+			response.Objects[i].Messages[j] = r.String(message)
+		}
+	}
+}
+
+func redactDiagnostics(r *redact.Redactor, diagnostics []Diagnostic) {
+	if r == nil {
+		return
+	}
+	for i := range diagnostics {
+		diagnostics[i].Message = r.String(diagnostics[i].Message)
+		diagnostics[i].Reason = r.String(diagnostics[i].Reason)
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/hhfabrelease"
+)
+
+// installTimeout bounds the download of one release.
+const installTimeout = 10 * time.Minute
+
+// installReleases installs the hhfab releases of cfg that are missing.
+// Failures are logged, validations fail readiness until their hhfab is
+// installed.
+func installReleases(cfg *runtimeConfig) {
+	releases := cfg.HHFabReleases
+	source := releases.source()
+	for _, release := range releases.Install {
+		ctx, cancel := context.WithTimeout(context.Background(), installTimeout)
+		path, downloaded, err := source.Install(ctx, releases.Dir, release)
+		cancel()
+		switch {
+		case err != nil:
+			log.Printf("hhfab %s could not be installed: %v", release.Version, err)
+		case downloaded:
+			log.Printf("Installed hhfab %s at %s", release.Version, path)
+		}
+	}
+}
+
+// getHHFabReleases lists the hhfab versions installed in the release
+// directory.
+func (s *Server) getHHFabReleases(c *gin.Context) {
+	releases := s.currentConfig().HHFabReleases
+	if releases.Dir == "" {
+		problem(c, http.StatusNotFound, gin.H{"error": "hhfab releases are not managed, configure hhfab_releases.dir to enable them"})
+		return
+	}
+	installed, err := hhfabrelease.Installed(releases.Dir)
+	if err != nil {
+		problem(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sendJSON(c, http.StatusOK, HHFabReleases{
+		Dir:           releases.Dir,
+		Installed:     installed,
+		Use:           releases.Use,
+		CanaryVersion: releases.CanaryVersion,
+	})
+}
+
+// installHHFab downloads the hhfab release of the request, a version and
+// the SHA-256 checksum of its download, and installs it once verified. The
+// release is not used until hhfab_releases.use or canary_version name it.
+func (s *Server) installHHFab(c *gin.Context) {
+	releases := s.currentConfig().HHFabReleases
+	if releases.Dir == "" || releases.URL == "" {
+		problem(c, http.StatusNotFound, gin.H{"error": "hhfab releases are not managed, configure hhfab_releases.dir and url to enable them"})
+		return
+	}
+	var release hhfabrelease.Release
+	if err := c.ShouldBindJSON(&release); err != nil && !errors.Is(err, io.EOF) {
+		problem(c, http.StatusBadRequest, gin.H{"error": "invalid request body: " + err.Error()})
+		return
+	}
+	if err := release.Validate(); err != nil {
+		problem(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), installTimeout)
+	defer cancel()
+	path, downloaded, err := releases.source().Install(ctx, releases.Dir, release)
+	if err != nil {
+		problem(c, http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if downloaded {
+		log.Printf("Installed hhfab %s at %s", release.Version, path)
+	}
+	sendJSON(c, http.StatusOK, HHFabInstall{Version: release.Version, Path: path, Downloaded: downloaded})
+}
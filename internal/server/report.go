@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/redact"
+	"validator/internal/report"
+)
+
+// Formats of the results of POST /validate, chosen with the format query
+// parameter.
+const (
+	formatJSON     = "json"
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+)
+
+// resultFormats lists the formats of POST /validate, JSON first as the
+// default.
+var resultFormats = []string{formatJSON, formatHTML, formatMarkdown}
+
+// reportContentTypes are the content types of the formats rendered by
+// internal/report.
+var reportContentTypes = map[string]string{
+	formatHTML:     "text/html; charset=utf-8",
+	formatMarkdown: "text/markdown; charset=utf-8",
+}
+
+// writeFormattedReport sends the result as an HTML or Markdown report with
+// the status of the JSON response. HTML reports quote the uploads, which
+// were loaded into the request for them.
+func writeFormattedReport(c *gin.Context, request *JobRequest, format string, status int, response ValidateResponse) {
+	input := report.Input{Response: &response, Generated: time.Now()}
+	for _, upload := range request.Wiring {
+		input.Wiring = append(input.Wiring, report.File{Name: upload.Name, Data: upload.Data})
+	}
+	if request.Fab != nil {
+		input.Fab = &report.File{Name: request.Fab.Name, Data: redact.New(redact.Find(request.Fab.Data)...).Bytes(request.Fab.Data)}
+	}
+	writeReport(c, format, status, input)
+}
+
+// writeReport renders input in the format of internal/report and sends it.
+func writeReport(c *gin.Context, format string, status int, input report.Input) {
+	var page bytes.Buffer
+	var err error
+	switch format {
+	case formatHTML:
+		err = report.WriteHTML(&page, input)
+	case formatMarkdown:
+		err = report.WriteMarkdown(&page, input)
+	}
+	if err != nil {
+		problem(c, http.StatusInternalServerError, gin.H{"error": "failed to render report: " + err.Error()})
+		return
+	}
+	c.Data(status, reportContentTypes[format], page.Bytes())
+}
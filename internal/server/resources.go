@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"sync"
+	"syscall"
+
+	"validator/internal/codes"
+)
+
+// errResourceLimits is returned when the resource limits of hhfab cannot be
+// applied, which fails the validation instead of running it unbounded.
+var errResourceLimits = errors.New("failed to apply resource limits")
+
+// resourceLimitError is returned for hhfab runs that broke a resource limit.
+type resourceLimitError struct {
+	limit string
+	cfg   ResourcesConfig
+}
+
+func (e *resourceLimitError) Error() string {
+	if e.limit == "memory" {
+		return fmt.Sprintf("resource limit exceeded: hhfab used more than %d MB of memory and was killed", e.cfg.MemoryMB)
+	}
+	return fmt.Sprintf("resource limit exceeded: hhfab tried to run more than %d processes", e.cfg.MaxPids)
+}
+
+// enabled reports whether any resource limit is configured.
+func (cfg ResourcesConfig) enabled() bool {
+	return cfg.CPUs > 0 || cfg.MemoryMB > 0 || cfg.MaxPids > 0
+}
+
+// runHHFab runs cmd, hhfab validate, writing its output to output, within
+// the resource limits, and returns how it ran, nil when it could not be
+// started. It fails with a *resourceLimitError once hhfab broke one of
+// them, and with errResourceLimits when they could not be applied.
+func runHHFab(ctx context.Context, cmd *exec.Cmd, limits ResourcesConfig, output io.Writer) (*Process, error) {
+	capture := &processCapture{output: output}
+	cmd.Stdout = captureWriter{capture, &capture.stdout}
+	cmd.Stderr = captureWriter{capture, &capture.stderr}
+	if !limits.enabled() {
+		err := cmd.Run()
+		return capture.process(ctx, cmd), err
+	}
+
+	g, err := newCgroup(limits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errResourceLimits, err)
+	}
+	defer g.remove()
+	g.apply(cmd)
+	if err := cmd.Start(); err != nil {
+		// A missing hhfab fails like without limits
+		var pathErr *fs.PathError
+		var execErr *exec.Error
+		if errors.As(err, &pathErr) || errors.As(err, &execErr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: starting hhfab in its cgroup: %v", errResourceLimits, err)
+	}
+	err = cmd.Wait()
+	if limit := g.exceeded(); limit != "" {
+		resourceLimitKills.WithLabelValues(limit).Inc()
+		return capture.process(ctx, cmd), &resourceLimitError{limit: limit, cfg: limits}
+	}
+	return capture.process(ctx, cmd), err
+}
+
+// processCapture records stdout and stderr of hhfab apart while writing
+// both to its combined output. exec copies the two streams in goroutines of
+// their own, so writes are serialized to keep the lines of the combined
+// output whole.
+type processCapture struct {
+	mu     sync.Mutex
+	output io.Writer
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+type captureWriter struct {
+	capture *processCapture
+	stream  *bytes.Buffer
+}
+
+func (w captureWriter) Write(p []byte) (int, error) {
+	w.capture.mu.Lock()
+	defer w.capture.mu.Unlock()
+	w.stream.Write(p)
+	return w.capture.output.Write(p)
+}
+
+// process returns how cmd ran, nil when it never started.
+func (c *processCapture) process(ctx context.Context, cmd *exec.Cmd) *Process {
+	state := cmd.ProcessState
+	if state == nil {
+		return nil
+	}
+	process := &Process{
+		Stdout:   c.stdout.String(),
+		Stderr:   c.stderr.String(),
+		ExitCode: state.ExitCode(),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		process.Signal = status.Signal().String()
+	}
+	return process
+}
+
+// resourceDiagnostics returns the error diagnostic of an hhfab run that broke
+// a resource limit, none for other runs.
+func resourceDiagnostics(err error) []Diagnostic {
+	var exceeded *resourceLimitError
+	if !errors.As(err, &exceeded) {
+		return nil
+	}
+	return []Diagnostic{{
+		Severity: SeverityError,
+		Code:     codes.ResourceLimit,
+		Message:  exceeded.Error(),
+		Source:   SourceValidator,
+	}}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/report"
+)
+
+// baseURL returns the address clients reach the server at: public_url, or
+// else the address of the request, as forwarded by a proxy in front.
+func baseURL(c *gin.Context, cfg *runtimeConfig) string {
+	if cfg.PublicURL != "" {
+		return cfg.PublicURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	host := c.Request.Host
+	if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+		host, _, _ = strings.Cut(forwarded, ",")
+	}
+	return scheme + "://" + strings.TrimSpace(host)
+}
+
+// getResult shows the result of a recorded validation, linked to by the
+// result_url of responses: as JSON, or as a report with ?format=html or
+// markdown. Browsers asking for HTML get the HTML report.
+func (s *Server) getResult(c *gin.Context) {
+	if !s.historyEnabled(c) {
+		return
+	}
+	format := c.Query("format")
+	if format == "" {
+		format = formatJSON
+		if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+			format = formatHTML
+		}
+	}
+	if !slices.Contains(resultFormats, format) {
+		problem(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q, must be one of: %s", format, strings.Join(resultFormats, ", "))})
+		return
+	}
+
+	entry, err := s.history.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && !visibleTo(c, entry.Tenant) {
+		err = ErrHistoryNotFound
+	}
+	if errors.Is(err, ErrHistoryNotFound) {
+		problem(c, http.StatusNotFound, gin.H{"error": "unknown result " + c.Param("id")})
+		return
+	}
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if format == formatJSON {
+		sendJSON(c, http.StatusOK, entry.Result)
+		return
+	}
+
+	// The history names the uploads without keeping them, so reports list
+	// the files without quoting them or drawing the graph
+	input := report.Input{Response: entry.Result, Generated: entry.CreatedAt}
+	for _, name := range entry.Files {
+		input.Wiring = append(input.Wiring, report.File{Name: name})
+	}
+	writeReport(c, format, http.StatusOK, input)
+}
+
+// getResultDiagram downloads the topology diagram of a recorded validation,
+// which was asked for with ?diagram=, as an attachment.
+func (s *Server) getResultDiagram(c *gin.Context) {
+	if !s.historyEnabled(c) {
+		return
+	}
+	entry, err := s.history.Get(c.Request.Context(), c.Param("id"))
+	if err == nil && !visibleTo(c, entry.Tenant) {
+		err = ErrHistoryNotFound
+	}
+	if errors.Is(err, ErrHistoryNotFound) {
+		problem(c, http.StatusNotFound, gin.H{"error": "unknown result " + c.Param("id")})
+		return
+	}
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if entry.Result == nil || entry.Result.Diagram == nil {
+		problem(c, http.StatusNotFound, gin.H{"error": "result " + entry.ID + " has no diagram, validate with ?diagram=FORMAT"})
+		return
+	}
+
+	diagram := entry.Result.Diagram
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=topology-%s.%s", entry.ID, topologyExtensions[diagram.Format]))
+	c.Data(http.StatusOK, diagram.ContentType, diagram.Content)
+}
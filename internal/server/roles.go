@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/pkg/api"
+)
+
+// Roles of requests, see pkg/api.
+const (
+	RoleViewer    = api.RoleViewer
+	RoleValidator = api.RoleValidator
+	RoleAdmin     = api.RoleAdmin
+)
+
+// roleLevels orders the roles, unknown ones are 0.
+var roleLevels = map[string]int{RoleViewer: 1, RoleValidator: 2, RoleAdmin: 3}
+
+// identity is who a request comes from: its tenant, its role and whether it
+// carried credentials at all.
+type identity struct {
+	tenant        string
+	role          string
+	authenticated bool
+}
+
+// highestRole returns the role of roles allowing the most, fallback when
+// none is known.
+func highestRole(roles []string, fallback string) string {
+	role := ""
+	for _, r := range roles {
+		if roleLevels[r] > roleLevels[role] {
+			role = r
+		}
+	}
+	if role == "" {
+		return fallback
+	}
+	return role
+}
+
+// claimRoles returns the roles of a JWT claim, a list or a space-separated
+// string of them.
+func claimRoles(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []any:
+		roles := []string{}
+		for _, r := range claim {
+			if r, ok := r.(string); ok {
+				roles = append(roles, r)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// roleOf returns the role of a request passed by identify.
+func roleOf(c *gin.Context) string {
+	if role := c.GetString(roleKey); role != "" {
+		return role
+	}
+	return RoleViewer
+}
+
+// requireRole rejects requests whose role does not allow what role does,
+// and those without credentials while auth.required is set: with 401 when
+// credentials could help, with 403 when those given do not suffice.
+func (s *Server) requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticated := c.GetBool(authenticatedKey)
+		allowed := roleLevels[roleOf(c)] >= roleLevels[role]
+		switch {
+		case !authenticated && (s.currentConfig().Auth.Required || !allowed):
+			c.Header("WWW-Authenticate", "Bearer")
+			abortProblem(c, http.StatusUnauthorized, gin.H{"error": "an API key or token with the " + role + " role is required"})
+			return
+		case !allowed:
+			abortProblem(c, http.StatusForbidden, gin.H{"error": "the " + role + " role is required"})
+			return
+		}
+		c.Next()
+	}
+}
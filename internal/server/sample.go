@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSampleDevices caps every count of a sample request.
+const maxSampleDevices = 16
+
+// SampleRequest parametrizes a generated sample. Omitted fields keep the
+// defaults of newSampleRequest; a fabric without spines is collapsed-core.
+type SampleRequest struct {
+	Spines           int `json:"spines"`
+	FabricLinks      int `json:"fabric_links"`
+	MCLAGLeaves      int `json:"mclag_leaves"`
+	OrphanLeaves     int `json:"orphan_leaves"`
+	MCLAGServers     int `json:"mclag_servers"`
+	UnbundledServers int `json:"unbundled_servers"`
+	BundledServers   int `json:"bundled_servers"`
+}
+
+// SampleResponse holds a generated wiring diagram and the matching
+// fabricator config.
+type SampleResponse struct {
+	Success bool   `json:"success"`
+	Wiring  string `json:"wiring,omitempty"`
+	Fab     string `json:"fab,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func newSampleRequest() SampleRequest {
+	return SampleRequest{
+		Spines:           2,
+		FabricLinks:      2,
+		MCLAGLeaves:      2,
+		OrphanLeaves:     1,
+		MCLAGServers:     2,
+		UnbundledServers: 1,
+		BundledServers:   1,
+	}
+}
+
+// check rejects counts hhfab cannot generate a fabric for.
+func (r SampleRequest) check() error {
+	counts := map[string]int{
+		"spines":            r.Spines,
+		"fabric_links":      r.FabricLinks,
+		"mclag_leaves":      r.MCLAGLeaves,
+		"orphan_leaves":     r.OrphanLeaves,
+		"mclag_servers":     r.MCLAGServers,
+		"unbundled_servers": r.UnbundledServers,
+		"bundled_servers":   r.BundledServers,
+	}
+	for name, count := range counts {
+		if count < 0 || count > maxSampleDevices {
+			return fmt.Errorf("%s must be between 0 and %d", name, maxSampleDevices)
+		}
+	}
+	if r.MCLAGLeaves%2 != 0 {
+		return errors.New("mclag_leaves must be even, MCLAG leaves come in pairs")
+	}
+	if r.MCLAGLeaves+r.OrphanLeaves == 0 {
+		return errors.New("a fabric needs at least one leaf")
+	}
+	if r.Spines == 0 && (r.MCLAGLeaves != 2 || r.OrphanLeaves != 0) {
+		return errors.New("a collapsed-core fabric (0 spines) needs exactly 2 mclag_leaves and no orphan_leaves")
+	}
+	return nil
+}
+
+// genArgs are the hhfab vlab gen arguments generating the sample.
+func (r SampleRequest) genArgs() []string {
+	args := []string{}
+	add := func(flag string, value int) {
+		args = append(args, "--"+flag, strconv.Itoa(value))
+	}
+	if r.Spines > 0 {
+		add("spines-count", r.Spines)
+		add("fabric-links-count", r.FabricLinks)
+	}
+	add("mclag-leafs-count", r.MCLAGLeaves)
+	add("orphan-leafs-count", r.OrphanLeaves)
+	add("mclag-servers", r.MCLAGServers)
+	add("unbundled-servers", r.UnbundledServers)
+	add("bundled-servers", r.BundledServers)
+	return args
+}
+
+// postSample generates an example wiring diagram and fab.yaml with hhfab's
+// VLAB generator, a known-valid starting point for new fabrics. The JSON body
+// is an optional SampleRequest.
+func (s *Server) postSample(c *gin.Context) {
+	cfg := s.currentConfig()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.timeout())
+	defer cancel()
+
+	request := newSampleRequest()
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		problem(c, http.StatusBadRequest, SampleResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+	if err := request.check(); err != nil {
+		problem(c, http.StatusBadRequest, SampleResponse{Error: err.Error()})
+		return
+	}
+	backend := cfg.validator()
+	if !backend.Capabilities().Samples {
+		problem(c, http.StatusServiceUnavailable, SampleResponse{Error: "hhfab is not available: the " + backend.Capabilities().Name + " backend does not generate samples"})
+		return
+	}
+
+	err := s.pool.tryAcquire(ctx, cfg.Workers.ShedQueue)
+	if errors.Is(err, errOverloaded) {
+		requestsShed.Inc()
+		c.Header("Retry-After", strconv.Itoa(cfg.Workers.RetryAfterSec))
+		problem(c, http.StatusServiceUnavailable, SampleResponse{Error: fmt.Sprintf("server overloaded, retry in %d seconds", cfg.Workers.RetryAfterSec)})
+		return
+	}
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, SampleResponse{Error: "timed out waiting for a free worker: " + err.Error()})
+		return
+	}
+	defer s.pool.release()
+
+	workDir, err := makeTempDir("validator-sample-*")
+	if err != nil {
+		problem(c, http.StatusInternalServerError, SampleResponse{Error: err.Error()})
+		return
+	}
+	defer removeTempDir(workDir)
+
+	initArgs := []string{"--dev"}
+	if request.Spines == 0 {
+		initArgs = append(initArgs, "--fabric-mode", "collapsed-core")
+	}
+	output, err := backend.Init(ctx, workDir, initArgs...)
+	if err != nil {
+		problem(c, http.StatusBadRequest, SampleResponse{Error: "hhfab init failed: " + err.Error(), Output: string(output)})
+		return
+	}
+	generated, err := backend.Generate(ctx, workDir, request.genArgs()...)
+	output = append(output, generated...)
+	if err != nil {
+		problem(c, http.StatusBadRequest, SampleResponse{Error: "hhfab vlab failed: " + err.Error(), Output: string(output)})
+		return
+	}
+
+	wiring, err := os.ReadFile(filepath.Join(workDir, "include", "vlab.generated.yaml"))
+	if err != nil {
+		problem(c, http.StatusInternalServerError, SampleResponse{Error: "reading generated wiring: " + err.Error(), Output: string(output)})
+		return
+	}
+	fab, err := os.ReadFile(filepath.Join(workDir, "fab.yaml"))
+	if err != nil {
+		problem(c, http.StatusInternalServerError, SampleResponse{Error: "reading fab.yaml: " + err.Error(), Output: string(output)})
+		return
+	}
+
+	sendJSON(c, http.StatusOK, SampleResponse{
+		Success: true,
+		Wiring:  string(wiring),
+		Fab:     string(fab),
+		Output:  string(output),
+	})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const schemaVersionKey = "schema_version"
+
+// negotiateSchema picks the response schema version of a request: the one
+// its X-Validator-Schema header pins, or else the latest. Versions the
+// server does not speak are answered with 406.
+func negotiateSchema(c *gin.Context) {
+	version := SchemaVersion
+	if pinned := strings.TrimSpace(c.GetHeader(SchemaHeader)); pinned != "" {
+		v, err := strconv.Atoi(pinned)
+		if err != nil || v < MinSchemaVersion || v > SchemaVersion {
+			c.Set(schemaVersionKey, SchemaVersion)
+			c.Header(SchemaHeader, strconv.Itoa(SchemaVersion))
+			abortProblem(c, http.StatusNotAcceptable, gin.H{
+				"error":              fmt.Sprintf("response schema %q is not supported, use %d to %d", pinned, MinSchemaVersion, SchemaVersion),
+				"supported_versions": []int{MinSchemaVersion, SchemaVersion},
+			})
+			return
+		}
+		version = v
+	}
+	c.Set(schemaVersionKey, version)
+	c.Header(SchemaHeader, strconv.Itoa(version))
+	c.Next()
+}
+
+// schemaOf returns the response schema version of a request.
+func schemaOf(c *gin.Context) int {
+	if version := c.GetInt(schemaVersionKey); version != 0 {
+		return version
+	}
+	return SchemaVersion
+}
+
+// writeJSON answers with body as JSON of the content type, with the schema
+// version of the request as the first member of objects that do not start
+// with it already.
+func writeJSON(c *gin.Context, status int, contentType string, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	if len(data) > 1 && data[0] == '{' && !bytes.HasPrefix(data, []byte(`{"schema_version":`)) {
+		member := `{"schema_version":` + strconv.Itoa(schemaOf(c))
+		if !bytes.Equal(data, []byte("{}")) {
+			member += ","
+		}
+		data = append([]byte(member), data[1:]...)
+	}
+	c.Data(status, contentType, data)
+}
+
+// sendJSON answers with body as JSON, see writeJSON.
+func sendJSON(c *gin.Context, status int, body any) {
+	writeJSON(c, status, "application/json; charset=utf-8", body)
+}
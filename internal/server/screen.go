@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// screenError rejects an upload that is not plausibly YAML, see
+// UploadRejected.
+type screenError struct {
+	reason string
+	line   int
+	limit  int
+}
+
+func (e *screenError) Error() string {
+	switch e.reason {
+	case RejectedNUL:
+		return fmt.Sprintf("line %d holds a NUL byte, binary files are not accepted", e.line)
+	case RejectedBinary:
+		return fmt.Sprintf("line %d is not UTF-8 text, binary files are not accepted", e.line)
+	case RejectedDepth:
+		return fmt.Sprintf("line %d nests collections deeper than %d levels", e.line, e.limit)
+	default:
+		return fmt.Sprintf("line %d exceeds %d anchors and aliases", e.line, e.limit)
+	}
+}
+
+// screener checks that an upload is plausibly YAML as it is streamed, so
+// the rest never reaches the disk once it is not: UTF-8 text without NUL
+// bytes or control characters, collections nested at most maxDepth levels
+// and at most maxAliases anchors and aliases, which expand to exponentially
+// large documents. Zero limits are not checked.
+//
+// It approximates the YAML grammar line by line: block collections nest by
+// indentation and "- " markers, flow collections by brackets, while quoted
+// strings, comments and block scalars are skipped.
+type screener struct {
+	maxDepth   int
+	maxAliases int
+
+	line    int
+	partial []byte
+	// indents are the indentations of the open block collections
+	indents []int
+	flow    int
+	aliases int
+	// quote is the quote of the string spanning lines, if any
+	quote byte
+	// blockIndent is the indentation of the key of the block scalar the
+	// following lines are content of, -1 outside block scalars
+	blockIndent int
+}
+
+func newScreener(cfg ScreeningConfig) *screener {
+	return &screener{maxDepth: cfg.MaxDepth, maxAliases: cfg.MaxAliases, blockIndent: -1}
+}
+
+// Write screens p, failing with a *screenError at the first violation.
+func (s *screener) Write(p []byte) (int, error) {
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if err := s.screenLine(s.partial[:i]); err != nil {
+			return 0, err
+		}
+		s.partial = s.partial[i+1:]
+	}
+	// NUL bytes fail early even in lines that never end
+	if i := bytes.IndexByte(s.partial, 0); i >= 0 {
+		return 0, &screenError{reason: RejectedNUL, line: s.line + 1}
+	}
+	return len(p), nil
+}
+
+// finish screens the last line, which has no line break.
+func (s *screener) finish() error {
+	if len(s.partial) == 0 {
+		return nil
+	}
+	line := s.partial
+	s.partial = nil
+	return s.screenLine(line)
+}
+
+func (s *screener) screenLine(line []byte) error {
+	s.line++
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if bytes.IndexByte(line, 0) >= 0 {
+		return &screenError{reason: RejectedNUL, line: s.line}
+	}
+	if !utf8.Valid(line) || bytes.ContainsFunc(line, func(r rune) bool { return r < ' ' && r != '\t' || r == 0x7f }) {
+		return &screenError{reason: RejectedBinary, line: s.line}
+	}
+
+	indent := len(line) - len(bytes.TrimLeft(line, " \t"))
+	content := string(line[indent:])
+	if s.quote == 0 && s.flow == 0 {
+		if s.blockIndent >= 0 {
+			if content == "" || indent > s.blockIndent {
+				return nil
+			}
+			s.blockIndent = -1
+		}
+		if content == "" || content[0] == '#' {
+			return nil
+		}
+		if indent == 0 && (content == "---" || content == "..." || strings.HasPrefix(content, "--- ")) {
+			s.indents = s.indents[:0]
+			return nil
+		}
+		// Every "- " opens a sequence, nested ones on the same line too
+		for {
+			for len(s.indents) > 0 && s.indents[len(s.indents)-1] > indent {
+				s.indents = s.indents[:len(s.indents)-1]
+			}
+			if len(s.indents) == 0 || s.indents[len(s.indents)-1] < indent {
+				s.indents = append(s.indents, indent)
+				if err := s.checkDepth(); err != nil {
+					return err
+				}
+			}
+			if content != "-" && !strings.HasPrefix(content, "- ") {
+				break
+			}
+			rest := strings.TrimLeft(content[1:], " ")
+			indent += len(content) - len(rest)
+			content = rest
+			if content == "" {
+				return nil
+			}
+		}
+	}
+
+	end := len(content)
+	prev := byte(' ')
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if s.quote != 0 {
+			switch {
+			case s.quote == '"' && c == '\\':
+				i++
+			case s.quote == '\'' && c == '\'' && i+1 < len(content) && content[i+1] == '\'':
+				i++
+			case c == s.quote:
+				s.quote = 0
+			}
+			prev = c
+			continue
+		}
+		start := prev == ' ' || prev == '\t' || prev == '[' || prev == '{' || prev == ','
+		switch {
+		case c == '#' && (prev == ' ' || prev == '\t'):
+			end = i
+		case (c == '"' || c == '\'') && start:
+			s.quote = c
+		case (c == '&' || c == '*') && start && i+1 < len(content) && content[i+1] != ' ':
+			s.aliases++
+			if s.maxAliases > 0 && s.aliases > s.maxAliases {
+				return &screenError{reason: RejectedAliases, line: s.line, limit: s.maxAliases}
+			}
+		case (c == '[' || c == '{') && (start || s.flow > 0):
+			s.flow++
+			if err := s.checkDepth(); err != nil {
+				return err
+			}
+		case (c == ']' || c == '}') && s.flow > 0:
+			s.flow--
+		}
+		if end < len(content) {
+			break
+		}
+		prev = c
+	}
+
+	// A key ending in | or > starts a block scalar
+	if fields := strings.Fields(content[:end]); s.quote == 0 && s.flow == 0 && len(fields) > 0 {
+		last := fields[len(fields)-1]
+		if (last[0] == '|' || last[0] == '>') && len(last) <= 3 {
+			s.blockIndent = indent
+		}
+	}
+	return nil
+}
+
+func (s *screener) checkDepth() error {
+	if s.maxDepth > 0 && len(s.indents)+s.flow > s.maxDepth {
+		return &screenError{reason: RejectedDepth, line: s.line, limit: s.maxDepth}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// securityHeaders sets the headers protecting browsers viewing responses,
+// such as HTML reports and SVG graphs, see SecurityConfig. Empty settings
+// leave their header out.
+func (s *Server) securityHeaders(c *gin.Context) {
+	cfg := s.currentConfig().Security
+	header := c.Writer.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	for name, value := range map[string]string{
+		"Content-Security-Policy": cfg.ContentSecurityPolicy,
+		"X-Frame-Options":         cfg.FrameOptions,
+		"Referrer-Policy":         cfg.ReferrerPolicy,
+	} {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	if cfg.HSTSMaxAgeSec > 0 {
+		header.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(cfg.HSTSMaxAgeSec))
+	}
+	c.Next()
+}
+
+// protectCrossOrigin rejects requests that change state sent by browser
+// pages of other origins than the server and those CORS allows, such as
+// forms of hostile pages posting to /validate with the role of requests
+// without credentials. Browsers name the site requests come from in
+// Sec-Fetch-Site, older ones the origin in Origin; clients other than
+// browsers send neither and pass.
+func (s *Server) protectCrossOrigin(c *gin.Context) {
+	cfg := s.currentConfig()
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if !cfg.Security.CrossOriginProtection {
+		c.Next()
+		return
+	}
+	origin := c.GetHeader("Origin")
+	switch site := c.GetHeader("Sec-Fetch-Site"); {
+	case site == "same-origin" || site == "none":
+		c.Next()
+		return
+	case site == "" && (origin == "" || sameOrigin(origin, baseURL(c, cfg))):
+		c.Next()
+		return
+	case origin != "" && cfg.CORS.allowsOrigin(origin):
+		c.Next()
+		return
+	}
+	if origin == "" {
+		origin = "another site"
+	}
+	abortProblem(c, http.StatusForbidden, gin.H{"error": "cross-origin request from " + origin + " refused"})
+}
+
+// sameOrigin reports whether origin is the scheme and host of base.
+func sameOrigin(origin, base string) bool {
+	u, err := url.Parse(base)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(origin, u.Scheme+"://"+u.Host)
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/codes"
+	"validator/pkg/api"
+)
+
+var (
+	//go:embed fixtures/selftest-syntax.yaml
+	selfTestSyntax []byte
+	//go:embed fixtures/selftest-reference.yaml
+	selfTestReference []byte
+)
+
+// selfTestFixture is a wiring file POST /selftest validates, with the
+// outcome it must have: success for valid ones, failing with code for the
+// others.
+type selfTestFixture struct {
+	name   string
+	wiring []byte
+	valid  bool
+	code   string
+}
+
+// selfTestFixtures are validated in order. The known-good one fails when
+// hhfab or the environment it runs in broke, the known-bad ones when the
+// checks of the validator stopped catching problems.
+var selfTestFixtures = []selfTestFixture{
+	{name: "valid", wiring: benchmarkWiring, valid: true},
+	{name: "yaml-syntax", wiring: selfTestSyntax, code: codes.YAMLSyntax},
+	{name: "missing-reference", wiring: selfTestReference, code: codes.MissingReference},
+}
+
+// Triggers of self-tests, as counted by validator_selftests_total.
+const (
+	selfTestScheduled = "scheduled"
+	selfTestRequested = "requested"
+)
+
+// postSelfTest runs the self-test, answering 503 when it failed so it can be
+// probed.
+func (s *Server) postSelfTest(c *gin.Context) {
+	response := s.runSelfTest(c.Request.Context(), s.currentConfig(), selfTestRequested)
+	if !response.Passed {
+		problem(c, http.StatusServiceUnavailable, response)
+		return
+	}
+	sendJSON(c, http.StatusOK, response)
+}
+
+// runSelfTests runs the self-test every selftest.interval_seconds, starting
+// one interval after startup so that the workspaces and hhfab releases are
+// ready by then.
+func (s *Server) runSelfTests(ctx context.Context) {
+	for {
+		interval := time.Duration(s.currentConfig().SelfTest.IntervalSec) * time.Second
+		if interval == 0 {
+			// Off until a reload sets an interval
+			if !sleep(ctx, time.Minute) {
+				return
+			}
+			continue
+		}
+		if !sleep(ctx, interval) {
+			return
+		}
+		if cfg := s.currentConfig(); cfg.SelfTest.IntervalSec > 0 {
+			s.runSelfTest(ctx, cfg, selfTestScheduled)
+		}
+	}
+}
+
+// runSelfTest validates the bundled fixtures through the whole pipeline, as
+// uploads of a validation would be, and reports for each whether it did as
+// expected. The outcome is exported as metrics and alerted, see
+// recordSelfTest.
+func (s *Server) runSelfTest(ctx context.Context, cfg *runtimeConfig, trigger string) SelfTest {
+	response := SelfTest{Passed: true, HHFabVersion: s.hhfabVersion(), Fixtures: []SelfTestFixture{}}
+	failed := []string{}
+	for _, fixture := range selfTestFixtures {
+		result := s.runSelfTestFixture(ctx, cfg, fixture)
+		response.Fixtures = append(response.Fixtures, result)
+		if !result.Passed {
+			failed = append(failed, fmt.Sprintf("%s: %s", result.Name, result.Error))
+		}
+	}
+	if len(failed) > 0 {
+		response.Passed = false
+		response.Error = "self-test failed: " + strings.Join(failed, "; ")
+	}
+	s.recordSelfTest(cfg, trigger, response)
+	return response
+}
+
+// recordSelfTest exports the outcome of a self-test as metrics and, when it
+// differs from the last one, posts it to the self-test webhooks: failing
+// self-tests are told once, until one passes again.
+func (s *Server) recordSelfTest(cfg *runtimeConfig, trigger string, response SelfTest) {
+	result := "passed"
+	if !response.Passed {
+		result = "failed"
+		log.Printf("Self-test failed: %s", response.Error)
+	}
+	selfTests.WithLabelValues(trigger, result).Inc()
+	for _, fixture := range response.Fixtures {
+		passed := 0.0
+		if fixture.Passed {
+			passed = 1
+		}
+		selfTestFixturePassed.WithLabelValues(fixture.Name).Set(passed)
+	}
+	if response.Passed {
+		selfTestLastPassed.SetToCurrentTime()
+	}
+
+	s.selfTestMu.Lock()
+	wasFailing := s.selfTestFailing
+	s.selfTestFailing = !response.Passed
+	s.selfTestMu.Unlock()
+	var event string
+	switch {
+	case !response.Passed && !wasFailing:
+		event = api.WebhookSelfTestFailed
+	case response.Passed && wasFailing:
+		event = api.WebhookSelfTestRecovered
+	default:
+		return
+	}
+	if len(cfg.SelfTest.Webhooks) == 0 {
+		return
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(WebhookEvent{Event: event, Host: host, SelfTest: &response})
+	if err != nil {
+		log.Printf("Encoding webhook event failed: %v", err)
+		return
+	}
+	for _, webhook := range cfg.SelfTest.Webhooks {
+		go deliverWebhook(webhook, event, body)
+	}
+}
+
+// runSelfTestFixture validates fixture once a worker is free, without the
+// result cache, and compares the result with the outcome it must have.
+func (s *Server) runSelfTestFixture(ctx context.Context, cfg *runtimeConfig, fixture selfTestFixture) SelfTestFixture {
+	result := SelfTestFixture{Name: fixture.name, Valid: fixture.valid, Expected: fixture.code}
+	started := time.Now()
+	defer func() {
+		result.DurationMs = time.Since(started).Milliseconds()
+	}()
+
+	waitCtx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+	if err := s.pool.acquire(waitCtx); err != nil {
+		result.Error = fmt.Sprintf("timed out waiting for a free worker: %s", err)
+		return result
+	}
+	defer s.pool.release()
+
+	digest := sha256.Sum256(fixture.wiring)
+	request := &JobRequest{
+		Wiring:  []Upload{{Name: fixture.name + ".yaml", Digest: hex.EncodeToString(digest[:]), Data: fixture.wiring}},
+		Profile: cfg.profiles[""],
+		NoCache: true,
+	}
+	status, response := s.runJobValidation(ctx, cfg, request)
+	result.Status = status
+	for _, d := range response.Diagnostics {
+		if d.Severity == SeverityError {
+			result.Code = d.Code
+			break
+		}
+	}
+
+	switch {
+	case fixture.valid && response.Success:
+		result.Passed = true
+	case fixture.valid:
+		result.Error = fmt.Sprintf("expected the fixture to validate, it failed with %d: %s", status, selfTestReason(response))
+	case response.Success:
+		result.Error = fmt.Sprintf("expected the fixture to fail with %s, it validated", fixture.code)
+	case status != http.StatusBadRequest:
+		result.Error = fmt.Sprintf("expected the fixture to fail with %s, the validation answered %d: %s", fixture.code, status, selfTestReason(response))
+	case !hasErrorCode(response, fixture.code):
+		result.Error = fmt.Sprintf("expected the fixture to fail with %s, it failed with %s", fixture.code, selfTestReason(response))
+	default:
+		result.Passed = true
+	}
+	return result
+}
+
+// hasErrorCode reports whether response has an error diagnostic of code.
+func hasErrorCode(response ValidateResponse, code string) bool {
+	for _, d := range response.Diagnostics {
+		if d.Severity == SeverityError && d.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// selfTestReason is the first error of a failed validation.
+func selfTestReason(response ValidateResponse) string {
+	for _, d := range response.Diagnostics {
+		if d.Severity == SeverityError {
+			return d.Code + ": " + d.Message
+		}
+	}
+	if response.Error != "" {
+		return response.Error
+	}
+	return response.Message
+}
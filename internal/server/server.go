@@ -0,0 +1,418 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/audit"
+	"validator/internal/rules"
+	"validator/internal/schema"
+	"validator/pkg/api"
+)
+
+type ValidateRequest struct {
+	WiringFile string `form:"wiring" binding:"required"`
+	FabFile    string `form:"fab"`
+}
+
+const (
+	MaxFileSize = api.MaxFileSize // 10MB
+	TimeoutSec  = 30
+)
+
+// Version is the server version, overridden at build time via -ldflags.
+var Version = "1.0.0"
+
+// Options configure a Server.
+type Options struct {
+	// Port to listen on, defaults to 8080
+	Port string
+	// ConfigFile is the path to the YAML configuration, optional
+	ConfigFile string
+	// Config is used instead of reading ConfigFile, for programs embedding
+	// the server. Start from DefaultConfig. The directories it references
+	// are still watched and reloaded
+	Config *Config
+	// Environment applies the VALIDATOR_* variables over Config too, as they
+	// are over ConfigFile
+	Environment bool
+	// Debug serves the debug endpoints, see DebugHandler, on DebugAddr,
+	// defaulting to localhost:6060
+	Debug     bool
+	DebugAddr string
+}
+
+// hhfabVersion is the version reported by hhfab at the last self-check.
+func (s *Server) hhfabVersion() string {
+	s.selfCheckMu.RLock()
+	defer s.selfCheckMu.RUnlock()
+	return s.lastSelfCheck.version
+}
+
+// Server is the validator web service.
+type Server struct {
+	port       string
+	configPath string
+	// embedded is the configuration the server was created with instead of
+	// a config file, nil with one
+	embedded *Config
+	// environment is set when the VALIDATOR_* variables apply over embedded
+	environment bool
+	// debugAddr is the address of the debug endpoints, empty without them
+	debugAddr  string
+	config     atomic.Pointer[runtimeConfig]
+	pool       *workerPool
+	workspaces *workspacePool
+	jobs       JobQueue
+	cache      ResultCache
+	history    HistoryStore
+	flights    *flightGroup
+	limiter    *rateLimiter
+	tenants    *tenantSlots
+	audit      *audit.Logger
+	startedAt  time.Time
+	// idempotency keeps the answers of requests by their Idempotency-Key
+	idempotency IdempotencyStore
+	// gate holds validations back while an admin paused the queue
+	gate *queueGate
+	// running are the validations running on this replica, for admins to
+	// cancel
+	running *runningValidations
+	// canaryWorkspaces are initialized with the candidate hhfab of canary
+	canaryWorkspaces *workspacePool
+	// tempUsage is the size of the temporary directories in bytes, as of
+	// the last sweep of the janitor
+	tempUsage atomic.Int64
+
+	selfCheckMu   sync.RWMutex
+	lastSelfCheck selfCheckResult
+
+	integrityMu   sync.Mutex
+	lastIntegrity integrityResult
+
+	// selfTestFailing is whether the last self-test failed, for alerting
+	// on changes only
+	selfTestMu      sync.Mutex
+	selfTestFailing bool
+}
+
+// New loads the configuration and prepares a Server. Nothing is started
+// until Run is called.
+func New(opts Options) (*Server, error) {
+	s := &Server{
+		port:        opts.Port,
+		configPath:  opts.ConfigFile,
+		embedded:    opts.Config,
+		environment: opts.Environment,
+		limiter:     newRateLimiter(),
+		tenants:     newTenantSlots(),
+		startedAt:   time.Now(),
+	}
+	if s.embedded != nil {
+		s.configPath = ""
+	}
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading configuration: %w", err)
+	}
+	if s.port == "" {
+		s.port = "8080"
+	}
+	if opts.Debug {
+		s.debugAddr = opts.DebugAddr
+		if s.debugAddr == "" {
+			s.debugAddr = defaultDebugAddr
+		}
+	}
+	s.config.Store(cfg)
+	s.pool = newWorkerPool(func() int {
+		return s.currentConfig().Workers.MaxConcurrent
+	})
+	s.workspaces = newWorkspacePool()
+	s.canaryWorkspaces = newWorkspacePool()
+	s.flights = newFlightGroup()
+	s.gate = newQueueGate()
+	s.running = newRunningValidations()
+	if s.jobs, err = newJobQueue(cfg.Jobs); err != nil {
+		return nil, fmt.Errorf("creating job queue: %w", err)
+	}
+	if s.cache, err = newResultCache(cfg.Cache); err != nil {
+		return nil, fmt.Errorf("creating result cache: %w", err)
+	}
+	if s.history, err = newHistoryStore(cfg.History); err != nil {
+		return nil, fmt.Errorf("creating history store: %w", err)
+	}
+	if s.idempotency, err = newIdempotencyStore(cfg.Idempotency); err != nil {
+		return nil, fmt.Errorf("creating idempotency store: %w", err)
+	}
+	if s.audit, err = newAuditLogger(cfg.Audit); err != nil {
+		return nil, fmt.Errorf("creating audit exporters: %w", err)
+	}
+	if cfg.pinsHHFab() {
+		s.verifyHHFab(cfg, true)
+	}
+
+	return s, nil
+}
+
+// loadConfig loads the configuration of the server: its config file, or the
+// configuration it was created with.
+func (s *Server) loadConfig() (*runtimeConfig, error) {
+	if s.embedded != nil {
+		cfg := *s.embedded
+		if s.environment {
+			if err := applyEnvironment(&cfg); err != nil {
+				return nil, err
+			}
+		}
+		return newRuntimeConfig(cfg)
+	}
+	return loadConfig(s.configPath)
+}
+
+// Router returns the HTTP handler serving the validator API.
+func (s *Server) Router() *gin.Engine {
+	r := gin.New()
+	r.Use(requestID, gin.LoggerWithFormatter(logFormat), gin.CustomRecovery(recovered), negotiateSchema)
+	r.NoRoute(noRoute)
+	r.Use(s.securityHeaders, s.auditRequest, s.filterAddress, s.cors, s.protectCrossOrigin)
+
+	// Add request size limit middleware
+	r.Use(func(c *gin.Context) {
+		limit := s.currentConfig().MaxRequestSize
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	})
+	r.Use(s.compress)
+	r.Use(s.identify)
+
+	// Routes
+	r.GET("/", s.getServiceInfo)
+	r.GET("/health", s.getHealth)
+	r.GET("/livez", getLiveness)
+	r.GET("/readyz", s.getReadiness)
+	r.GET("/capabilities", s.getCapabilities)
+	r.GET("/explain/:code", explainCode)
+	r.GET("/schemas", s.getSchemas)
+	r.GET("/profiles", s.getProfiles)
+	r.GET("/metrics", getMetrics())
+	r.POST("/validate", s.requireRole(RoleValidator), s.rateLimit, s.validateFiles)
+	r.GET("/jobs/:id", s.requireRole(RoleViewer), s.getJob)
+	r.GET("/history", s.requireRole(RoleViewer), s.getHistory)
+	r.GET("/history/:id", s.requireRole(RoleViewer), s.getHistoryEntry)
+	r.GET("/results/:id", s.requireRole(RoleViewer), s.getResult)
+	r.GET("/results/:id/diagram", s.requireRole(RoleViewer), s.getResultDiagram)
+	r.GET("/stats", s.requireRole(RoleViewer), s.getStats)
+	r.POST("/topology", s.requireRole(RoleValidator), s.rateLimit, s.postTopology)
+	r.POST("/format", s.requireRole(RoleValidator), s.rateLimit, s.postFormat)
+	r.POST("/convert", s.requireRole(RoleValidator), s.rateLimit, s.postConvert)
+	r.POST("/generate/sample", s.requireRole(RoleValidator), s.rateLimit, s.postSample)
+	r.POST("/benchmark", s.requireRole(RoleAdmin), s.postBenchmark)
+	r.POST("/selftest", s.requireRole(RoleAdmin), s.postSelfTest)
+
+	admin := r.Group("/admin", s.requireRole(RoleAdmin), requireServerAdmin)
+	admin.GET("/queue", s.getQueue)
+	admin.POST("/queue/pause", s.pauseQueue)
+	admin.POST("/queue/resume", s.resumeQueue)
+	admin.POST("/drain", s.drainWorkers)
+	admin.POST("/cache/flush", s.flushCaches)
+	admin.POST("/jobs/:id/cancel", s.cancelJob)
+	admin.GET("/hhfab", s.getHHFabReleases)
+	admin.POST("/hhfab/install", s.installHHFab)
+
+	return r
+}
+
+// Close exports the audit events still queued and closes the exporters.
+func (s *Server) Close() error {
+	return s.audit.Close()
+}
+
+// Run starts the background workers and serves the API until it fails or
+// ctx is cancelled. Then the server stops taking requests and jobs, waits up
+// to the validation timeout for the requests in flight and stops the
+// background workers.
+func (s *Server) Run(ctx context.Context) error {
+	// Set Gin mode from environment
+	if os.Getenv("GIN_MODE") == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Keep the configuration up to date
+	if cfg := s.currentConfig(); s.configPath != "" || cfg.TemplatesDir != "" || cfg.SchemasDir != "" || cfg.PluginsDir != "" {
+		if err := s.watchConfig(ctx); err != nil {
+			return fmt.Errorf("watching configuration: %w", err)
+		}
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	go s.runSelfChecks(ctx)
+	go s.runJanitor(ctx)
+	go s.runSelfTests(ctx)
+	// Workspaces are initialized with the hhfab releases once installed
+	go func(cfg *runtimeConfig) {
+		installReleases(cfg)
+		if !cfg.schemaOnly() {
+			s.workspaces.fill(cfg)
+		}
+	}(s.currentConfig())
+	s.runJobs(ctx, s.currentConfig().Jobs.Runners)
+	if s.debugAddr != "" {
+		go s.serveDebug(ctx)
+	}
+
+	log.Printf("Starting validator server on port %s", s.port)
+	srv := &http.Server{Addr: ":" + s.port, Handler: s.Router()}
+	failed := make(chan error, 1)
+	go func() {
+		failed <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-failed:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down validator server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.currentConfig().timeout())
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	if err := <-failed; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// sleep waits for d, reporting false when ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Server) getServiceInfo(c *gin.Context) {
+	response := InfoResponse{
+		Service:     "ONF Validator",
+		Description: "Validates Hedgehog Open Network Fabric configuration files",
+		Version:     Version,
+		Endpoints:   []string{"POST /validate", "POST /topology", "POST /format", "POST /convert", "POST /generate/sample", "POST /benchmark", "POST /selftest", "GET /admin/queue", "POST /admin/queue/pause", "POST /admin/queue/resume", "POST /admin/drain", "POST /admin/cache/flush", "POST /admin/jobs/:id/cancel", "GET /admin/hhfab", "POST /admin/hhfab/install", "GET /jobs/:id", "GET /history", "GET /history/:id", "GET /results/:id", "GET /results/:id/diagram", "GET /stats", "GET /health", "GET /livez", "GET /readyz", "GET /capabilities", "GET /explain/:code", "GET /schemas", "GET /profiles", "GET /metrics", "GET /"},
+	}
+	sendJSON(c, http.StatusOK, response)
+}
+
+func (s *Server) getCapabilities(c *gin.Context) {
+	cfg := s.currentConfig()
+	templates := cfg.templateNames(tenantOf(c))
+	sort.Strings(templates)
+	profiles := make([]string, 0, len(cfg.profiles))
+	for name := range cfg.profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	sendJSON(c, http.StatusOK, CapabilitiesResponse{
+		Version:        Version,
+		SchemaVersion:  schemaOf(c),
+		SchemaVersions: []int{MinSchemaVersion, SchemaVersion},
+		UseCases:       []string{"uc1", "uc2"},
+		Streaming:      true,
+		Async:          true,
+		History:        s.history != nil,
+		Templates:      templates,
+		MaxFileSize:    cfg.MaxFileSize,
+		MaxRequestSize: cfg.MaxRequestSize,
+		UploadLimits:   api.UploadLimits(cfg.UploadLimits),
+		SchemaOnly:     cfg.schemaOnly(),
+		Backend:        cfg.validator().Capabilities(),
+		Profiles:       profiles,
+		Plugins:        cfg.plugins.Names(),
+		Formats:        resultFormats,
+		Tenant:         tenantOf(c),
+		Role:           roleOf(c),
+	})
+}
+
+func (s *Server) getHealth(c *gin.Context) {
+	cfg := s.currentConfig()
+	active, waiting := s.pool.stats()
+	free, _ := freeDiskBytes(os.TempDir())
+
+	s.selfCheckMu.RLock()
+	hhfabVersion := s.lastSelfCheck.version
+	s.selfCheckMu.RUnlock()
+
+	response := HealthResponse{
+		Status:        "healthy",
+		Service:       "validator",
+		Version:       Version,
+		Timestamp:     time.Now(),
+		HHFabVersion:  hhfabVersion,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		DiskFreeBytes: free,
+		QueueDepth:    waiting,
+		Workers: WorkerStatus{
+			Active:      active,
+			Max:         cfg.Workers.MaxConcurrent,
+			Utilization: float64(active) / float64(cfg.Workers.MaxConcurrent),
+		},
+		Dependencies: s.readinessChecks(cfg),
+	}
+
+	// Check if hhfab is available, the schema-only backend does without
+	if cfg.schemaOnly() && cfg.Backend != BackendSchemaOnly {
+		response.Status = "degraded"
+		response.Error = "hhfab utility not available, validating against schemas only"
+	} else if err := cfg.validator().Available(); err != nil {
+		response.Status = "unhealthy"
+		response.Error = "hhfab utility not available"
+		sendJSON(c, http.StatusServiceUnavailable, response)
+		return
+	}
+	// A binary that changed or went missing is not the hhfab configured
+	if cfg.pinsHHFab() {
+		if result := s.verifyHHFab(cfg, false); result.err != "" {
+			response.Status = "unhealthy"
+			response.Error = result.err
+			sendJSON(c, http.StatusServiceUnavailable, response)
+			return
+		}
+	}
+
+	sendJSON(c, http.StatusOK, response)
+}
+
+// SchemasResponse lists the kinds uploads are validated against.
+type SchemasResponse struct {
+	Kinds []schema.Kind `json:"kinds"`
+}
+
+func (s *Server) getSchemas(c *gin.Context) {
+	sendJSON(c, http.StatusOK, SchemasResponse{Kinds: s.currentConfig().schemas.Kinds()})
+}
+
+// ProfilesResponse lists the validation profiles by name.
+type ProfilesResponse struct {
+	Profiles map[string]rules.Profile `json:"profiles"`
+}
+
+func (s *Server) getProfiles(c *gin.Context) {
+	sendJSON(c, http.StatusOK, ProfilesResponse{Profiles: s.currentConfig().profiles})
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/wiring"
+)
+
+// sharedKinds are definitions most objects refer to. They are copied into
+// every shard instead of joining everything referring to them into one.
+var sharedKinds = map[string]bool{
+	"IPv4Namespace": true,
+	"VLANNamespace": true,
+	"SwitchProfile": true,
+	"SwitchGroup":   true,
+}
+
+// shard is a part of the bundle validated by a hhfab run of its own: the
+// objects of each wiring file that belong to it, by file.
+type shard struct {
+	files [][]*wiring.Object
+}
+
+// fileObject is an object of the i-th wiring file.
+type fileObject struct {
+	object *wiring.Object
+	file   int
+}
+
+// relatedGroups parses the wiring files and groups their objects by
+// reference. Objects referring to each other by name, directly or as the
+// device of a port such as leaf-01/E1/1 or the VPC of a subnet such as
+// vpc-1/default, end up in the same group; objects of the shared kinds are
+// in none. Groups hold indexes of the objects, in the order of the files. It
+// returns false when the files cannot be parsed.
+func relatedGroups(files []sourceFile) ([]fileObject, [][]int, bool) {
+	objects := []fileObject{}
+	for i, file := range files {
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return nil, nil, false
+		}
+		parsed, err := wiring.Parse(data, file.Name)
+		if err != nil {
+			return nil, nil, false
+		}
+		if len(file.Kinds) > 0 {
+			parsed = ofKinds(parsed, file.Kinds)
+		}
+		for _, object := range parsed {
+			objects = append(objects, fileObject{object, i})
+		}
+	}
+
+	// Union the objects referring to each other
+	parent := make([]int, len(objects))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	byName := map[string][]int{}
+	for i, o := range objects {
+		if !sharedKinds[o.object.Kind] {
+			byName[o.object.Name] = append(byName[o.object.Name], i)
+		}
+	}
+	for i, o := range objects {
+		if sharedKinds[o.object.Kind] {
+			continue
+		}
+		for _, name := range byName[o.object.Name] {
+			parent[find(name)] = find(i)
+		}
+		for _, value := range scalars(wiring.Lookup(o.object.Node, "spec")) {
+			device, _, _ := strings.Cut(value, "/")
+			for _, name := range append(byName[value], byName[device]...) {
+				parent[find(name)] = find(i)
+			}
+		}
+	}
+
+	roots := map[int]int{}
+	groups := [][]int{}
+	for i, o := range objects {
+		if sharedKinds[o.object.Kind] {
+			continue
+		}
+		group, ok := roots[find(i)]
+		if !ok {
+			group = len(groups)
+			roots[find(i)] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+	return objects, groups, true
+}
+
+// planShards splits the wiring files into at most n shards of independent
+// objects for parallel validation, keeping related objects together. It
+// returns nil when the files cannot be parsed or hold a single group of
+// related objects.
+func planShards(files []sourceFile, n int) []shard {
+	objects, groups, ok := relatedGroups(files)
+	if !ok || len(groups) < 2 || n < 2 {
+		return nil
+	}
+
+	// Deal the largest groups first to the shard with the fewest objects
+	components := append([][]int{}, groups...)
+	sort.Slice(components, func(i, j int) bool {
+		if len(components[i]) != len(components[j]) {
+			return len(components[i]) > len(components[j])
+		}
+		return components[i][0] < components[j][0]
+	})
+	if n > len(components) {
+		n = len(components)
+	}
+	members := make([]map[int]bool, n)
+	sizes := make([]int, n)
+	for i := range members {
+		members[i] = map[int]bool{}
+	}
+	for _, component := range components {
+		smallest := 0
+		for i := range sizes {
+			if sizes[i] < sizes[smallest] {
+				smallest = i
+			}
+		}
+		for _, index := range component {
+			members[smallest][index] = true
+		}
+		sizes[smallest] += len(component)
+	}
+
+	shards := make([]shard, n)
+	for i := range shards {
+		shards[i].files = make([][]*wiring.Object, len(files))
+		for j, o := range objects {
+			if members[i][j] || sharedKinds[o.object.Kind] {
+				shards[i].files[o.file] = append(shards[i].files[o.file], o.object)
+			}
+		}
+	}
+	return shards
+}
+
+// scalars returns the scalar keys and values below node.
+func scalars(node *yaml.Node) []string {
+	values := []string{}
+	if node == nil {
+		return values
+	}
+	if node.Kind == yaml.ScalarNode {
+		return append(values, node.Value)
+	}
+	for _, child := range node.Content {
+		values = append(values, scalars(child)...)
+	}
+	return values
+}
+
+// shardResult is the outcome of hhfab runs. err is set when a shard could
+// not be run at all, failed when hhfab rejected one.
+type shardResult struct {
+	output      string
+	process     *Process
+	diagnostics []Diagnostic
+	failed      error
+	err         error
+}
+
+// runShards validates the shards concurrently, each in its own workspace
+// with the fab.yaml of workDir and fab, the uploaded fab file if any. The
+// runs stream their lines to output as they come; their results are merged:
+// the output of every run in shard order, their process the same way, and
+// the diagnostics without the duplicates of objects copied into several
+// shards.
+func (v *validation) runShards(ctx context.Context, shards []shard, workDir string, fab *sourceFile, output *outputRecorder) shardResult {
+	fabData, err := os.ReadFile(filepath.Join(workDir, "fab.yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return shardResult{err: err}
+	}
+
+	results := make([]shardResult, len(shards))
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = v.runShard(ctx, shards[i], fabData, fab, output.shard())
+		}(i)
+	}
+	wg.Wait()
+
+	merged := shardResult{diagnostics: []Diagnostic{}}
+	seen := map[Diagnostic]bool{}
+	for i, result := range results {
+		if result.err != nil {
+			return shardResult{err: fmt.Errorf("shard %d: %w", i+1, result.err)}
+		}
+		output.record(result.output)
+		merged.process = mergeProcess(merged.process, result.process, merged.failed == nil)
+		for _, d := range result.diagnostics {
+			if !seen[d] {
+				seen[d] = true
+				merged.diagnostics = append(merged.diagnostics, d)
+			}
+		}
+		if merged.failed == nil {
+			merged.failed = result.failed
+		}
+	}
+	merged.output = output.String()
+	return merged
+}
+
+func (v *validation) runShard(ctx context.Context, s shard, fabData []byte, fab *sourceFile, output *outputRecorder) shardResult {
+	cfg := v.cfg
+	ws, initOutput, err := v.workspaces.get(ctx, cfg)
+	if err != nil {
+		return shardResult{err: fmt.Errorf("%w: %s", err, initOutput)}
+	}
+	defer v.workspaces.put(ws, cfg)
+
+	sources := []sourceFile{}
+	for i, objects := range s.files {
+		if len(objects) == 0 {
+			continue
+		}
+		source := sourceFile{Name: objects[0].File, Path: filepath.Join(ws.includeDir(), wiringFileName(i, len(s.files)))}
+		data, lines, err := encodeObjects(objects, source.Name)
+		if err != nil {
+			return shardResult{err: err}
+		}
+		source.Lines = lines
+		if err := os.WriteFile(source.Path, data, 0644); err != nil {
+			return shardResult{err: err}
+		}
+		sources = append(sources, source)
+	}
+	if fabData != nil {
+		if err := os.WriteFile(ws.fabPath(), fabData, 0644); err != nil {
+			return shardResult{err: err}
+		}
+	}
+	if fab != nil {
+		sources = append(sources, sourceFile{Name: fab.Name, Path: ws.fabPath(), Lines: fab.Lines})
+	}
+
+	process, failed := cfg.validator().Validate(ctx, ws.dir, output)
+	if errors.Is(failed, errResourceLimits) {
+		return shardResult{err: failed}
+	}
+	result := shardResult{output: output.String(), process: process, failed: failed}
+	result.diagnostics = parseDiagnostics(diagnosticOutput(result.output, process, v.request.Deterministic), failed != nil)
+	result.diagnostics = append(result.diagnostics, resourceDiagnostics(failed)...)
+	newSourceMap(ws.dir, sources).translate(result.diagnostics)
+	return result
+}
+
+// mergeProcess appends the output of the run of a shard to the process of
+// the shards before it and takes its exit unless an earlier one failed.
+func mergeProcess(merged, shard *Process, takeExit bool) *Process {
+	if shard == nil {
+		return merged
+	}
+	if merged == nil {
+		copied := *shard
+		return &copied
+	}
+	merged.Stdout += shard.Stdout
+	merged.Stderr += shard.Stderr
+	merged.TimedOut = merged.TimedOut || shard.TimedOut
+	if takeExit {
+		merged.ExitCode, merged.Signal = shard.ExitCode, shard.Signal
+	}
+	return merged
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/wiring"
+)
+
+// sourceMap translates the locations hhfab reports back to the uploads.
+// hhfab only knows the workspace, where uploads are saved as
+// include/wiring-NNN.yaml and fab.yaml and extracted kinds are re-encoded,
+// and numbers the documents it loads.
+type sourceMap struct {
+	workDir string
+	// files are keyed by their name in the workspace, e.g. wiring-002.yaml
+	files map[string]*mappedFile
+	// documents are those of all wiring files, in the order hhfab loads them
+	documents []*mappedDocument
+}
+
+type mappedFile struct {
+	source    sourceFile
+	documents []*mappedDocument
+}
+
+// mappedDocument is one non-empty document of a workspace file, starting at
+// line start. Object is the object it defines if it could be parsed.
+type mappedDocument struct {
+	file   *mappedFile
+	start  int
+	object *wiring.Object
+}
+
+var (
+	// objectRef matches hhfab's numbering of loaded documents, counting from
+	// one, and the line within the document a decoding error may follow with
+	objectRef = regexp.MustCompile(`\bobject (\d+)\b(?:.*?\bline (\d+)\b)?`)
+	lineRef   = regexp.MustCompile(`^(?::(\d+)|.*?\bline (\d+)\b)`)
+	// workspaceFile matches the names of uploads in the workspace, not
+	// preceded by anything a longer file name could continue with
+	workspaceFile = regexp.MustCompile(`(?:^|[\s"'=:(\[])((?:include/)?(wiring(?:-\d{3})?\.yaml|fab\.yaml))\b`)
+)
+
+func newSourceMap(workDir string, sources []sourceFile) *sourceMap {
+	m := &sourceMap{workDir: workDir, files: map[string]*mappedFile{}}
+	for _, source := range sources {
+		file := &mappedFile{source: source}
+		m.files[filepath.Base(source.Path)] = file
+
+		data, err := os.ReadFile(source.Path)
+		if err != nil {
+			continue
+		}
+		file.documents = splitDocuments(data, source.Name)
+		for _, document := range file.documents {
+			document.file = file
+		}
+		if filepath.Base(filepath.Dir(source.Path)) == "include" {
+			m.documents = append(m.documents, file.documents...)
+		}
+	}
+	return m
+}
+
+// splitDocuments returns the non-empty documents of data. Each is parsed on
+// its own, so the valid documents of a file with syntax errors are known too.
+func splitDocuments(data []byte, name string) []*mappedDocument {
+	documents := []*mappedDocument{}
+	lines := strings.Split(string(data), "\n")
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && !strings.HasPrefix(lines[i], "---") {
+			continue
+		}
+		chunk := lines[start:i]
+		if !emptyDocument(chunk) {
+			document := &mappedDocument{start: start + 1}
+			if objects, err := wiring.Parse([]byte(strings.Join(chunk, "\n")), name); err == nil && len(objects) == 1 {
+				document.object = objects[0]
+			}
+			documents = append(documents, document)
+		}
+		start = i + 1
+	}
+	return documents
+}
+
+// emptyDocument reports whether lines hold nothing but blanks and comments.
+func emptyDocument(lines []string) bool {
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// translate points diagnostics mentioning a workspace file or a document
+// number at the upload and line, and names uploads as uploaded in messages.
+func (m *sourceMap) translate(diagnostics []Diagnostic) {
+	for i := range diagnostics {
+		d := &diagnostics[i]
+		message := strings.ReplaceAll(d.Message, m.workDir+string(filepath.Separator), "")
+
+		// The first workspace file mentioned is the one the message is about
+		var file *mappedFile
+		if loc := workspaceFile.FindStringSubmatchIndex(message); loc != nil {
+			if file = m.files[message[loc[4]:loc[5]]]; file != nil {
+				d.File = file.source.Name
+				if line := firstLine(lineRef.FindStringSubmatch(message[loc[1]:])); line > 0 {
+					d.Line = file.line(line)
+				}
+			}
+		}
+
+		if match := objectRef.FindStringSubmatch(message); match != nil {
+			documents := m.documents
+			if file != nil {
+				documents = file.documents
+			}
+			n, _ := strconv.Atoi(match[1])
+			line, _ := strconv.Atoi(match[2])
+			switch {
+			case n < 1 || n > len(documents):
+			case line > 0 && documents[n-1].object != nil:
+				// A decoding error in a valid document, the numbering does not
+				// match ours and the validator's own parse locates it instead
+			case line > 0:
+				// Lines of decoding errors count from the start of the document
+				document := documents[n-1]
+				d.File, d.Line = document.file.source.Name, document.file.line(document.start+line-1)
+			default:
+				document := documents[n-1]
+				d.File, d.Line = document.file.source.Name, document.line()
+				if document.object != nil {
+					d.Object = document.object.Key()
+				}
+			}
+		}
+
+		d.Message = m.rename(message)
+	}
+}
+
+// rename replaces the workspace names of uploads in message with the names
+// they were uploaded as.
+func (m *sourceMap) rename(message string) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range workspaceFile.FindAllStringSubmatchIndex(message, -1) {
+		if file := m.files[message[loc[4]:loc[5]]]; file != nil {
+			out.WriteString(message[last:loc[2]])
+			out.WriteString(file.source.Name)
+			last = loc[3]
+		}
+	}
+	out.WriteString(message[last:])
+	return out.String()
+}
+
+// firstLine returns the line number captured by lineRef, 0 if none.
+func firstLine(match []string) int {
+	if len(match) == 0 {
+		return 0
+	}
+	for _, group := range match[1:] {
+		if line, err := strconv.Atoi(group); err == nil {
+			return line
+		}
+	}
+	return 0
+}
+
+// line translates a line of the workspace file to the upload. Files
+// re-encoded by extraction map each line of a node to the node's original
+// line, lines between nodes to the closest node above.
+func (f *mappedFile) line(line int) int {
+	if f.source.Lines == nil {
+		return line
+	}
+	closest, original := 0, 0
+	for saved, upload := range f.source.Lines {
+		if saved <= line && saved > closest {
+			closest, original = saved, upload
+		}
+	}
+	return original
+}
+
+// line is the line in the upload the document's object starts at, or the
+// document itself if it defines none.
+func (d *mappedDocument) line() int {
+	if d.object != nil {
+		return d.file.line(d.start + d.object.Line - 1)
+	}
+	return d.file.line(d.start)
+}
+
+// mapLines records the original line of every node of saved, which is
+// original encoded again.
+func mapLines(saved, original *yaml.Node, lines map[int]int) {
+	if saved.Line > 0 && original.Line > 0 {
+		if _, ok := lines[saved.Line]; !ok {
+			lines[saved.Line] = original.Line
+		}
+	}
+	for i := 0; i < len(saved.Content) && i < len(original.Content); i++ {
+		mapLines(saved.Content[i], original.Content[i], lines)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultStatsDays is the period of GET /stats without ?since=, ending
+	// today
+	defaultStatsDays = 30
+	// maxStatsDays bounds the period, which has a row per day
+	maxStatsDays = 366
+	// defaultTopCodes is the number of codes of GET /stats without ?top=
+	defaultTopCodes = 10
+	// statsPageSize is the number of entries read from the history at once
+	statsPageSize = 1000
+)
+
+// getStats rolls up the history of a period for dashboards: validations and
+// failures per day, the failure rate, the mean duration, the codes found
+// most often and the usage by tenant. The period is ?since= to ?until=, the
+// last 30 days by default, and entries are filtered like GET /history.
+func (s *Server) getStats(c *gin.Context) {
+	if !s.historyEnabled(c) {
+		return
+	}
+	query, err := parseHistoryQuery(c, statsPageSize)
+	if err != nil {
+		problem(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	scopeHistoryQuery(c, &query)
+	if query.Until.IsZero() {
+		query.Until = time.Now().UTC()
+	}
+	if query.Since.IsZero() {
+		query.Since = query.Until.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-defaultStatsDays)
+	}
+	if !query.Since.Before(query.Until) {
+		problem(c, http.StatusBadRequest, gin.H{"error": "since must be before until"})
+		return
+	}
+	if query.Until.Sub(query.Since) > maxStatsDays*24*time.Hour {
+		problem(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the period may span at most %d days", maxStatsDays)})
+		return
+	}
+	top := defaultTopCodes
+	if value := c.Query("top"); value != "" {
+		top, err = strconv.Atoi(value)
+		if err != nil || top < 0 {
+			problem(c, http.StatusBadRequest, gin.H{"error": "top must be a number, 0 or more"})
+			return
+		}
+	}
+
+	stats, err := CollectStats(c.Request.Context(), s.history, query, top)
+	if err != nil {
+		problem(c, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	sendJSON(c, http.StatusOK, stats)
+}
+
+// CollectStats rolls up the entries of history matching query from
+// query.Since to query.Until, which must be set, with the top codes found
+// most often. The sort and pagination of query are replaced.
+func CollectStats(ctx context.Context, history HistoryStore, query HistoryQuery, top int) (*StatsResponse, error) {
+	stats := &StatsResponse{
+		Since:    query.Since,
+		Until:    query.Until,
+		Days:     []DayStats{},
+		TopCodes: []CodeStats{},
+		UseCases: map[string]int{},
+		Profiles: map[string]int{},
+		Tenants:  map[string]int{},
+	}
+	days := map[string]*DayStats{}
+	for day := query.Since.UTC().Truncate(24 * time.Hour); day.Before(query.Until); day = day.AddDate(0, 0, 1) {
+		stats.Days = append(stats.Days, DayStats{Date: day.Format(time.DateOnly)})
+	}
+	for i := range stats.Days {
+		days[stats.Days[i].Date] = &stats.Days[i]
+	}
+
+	codes := map[string]int{}
+	var duration int64
+	query.Sort, query.Desc, query.After, query.Limit = "created_at", false, "", statsPageSize
+	for {
+		entries, err := history.List(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			entry := &entries[i]
+			stats.Validations++
+			duration += entry.DurationMs
+			if entry.Cached {
+				stats.Cached++
+			}
+			day := days[entry.CreatedAt.UTC().Format(time.DateOnly)]
+			if day != nil {
+				day.Validations++
+			}
+			if !entry.Success {
+				stats.Failed++
+				if day != nil {
+					day.Failed++
+				}
+			}
+			if entry.UseCase != "" {
+				stats.UseCases[entry.UseCase]++
+			}
+			if entry.Profile != "" {
+				stats.Profiles[entry.Profile]++
+			}
+			stats.Tenants[entryTenant(entry)]++
+			for _, code := range entry.Codes {
+				codes[code]++
+			}
+		}
+		if len(entries) < query.Limit {
+			break
+		}
+		query.After = sortMember(query.Sort, &entries[len(entries)-1])
+	}
+
+	if stats.Validations > 0 {
+		stats.FailureRate = float64(stats.Failed) / float64(stats.Validations)
+		stats.MeanDurationMs = duration / int64(stats.Validations)
+	}
+	for code, n := range codes {
+		stats.TopCodes = append(stats.TopCodes, CodeStats{Code: code, Validations: n})
+	}
+	sort.Slice(stats.TopCodes, func(i, j int) bool {
+		if stats.TopCodes[i].Validations != stats.TopCodes[j].Validations {
+			return stats.TopCodes[i].Validations > stats.TopCodes[j].Validations
+		}
+		return stats.TopCodes[i].Code < stats.TopCodes[j].Code
+	})
+	if len(stats.TopCodes) > top {
+		stats.TopCodes = stats.TopCodes[:top]
+	}
+	return stats, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/redact"
+)
+
+// eventStream writes NDJSON events to a client, flushing after each one.
+// The shards of a parallel validation send their output concurrently.
+type eventStream struct {
+	mu  sync.Mutex
+	c   *gin.Context
+	enc *json.Encoder
+}
+
+func startStream(c *gin.Context) *eventStream {
+	c.Header("Content-Type", StreamContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	return &eventStream{c: c, enc: json.NewEncoder(c.Writer)}
+}
+
+func (s *eventStream) send(event StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// A client that went away is noticed through the request context
+	_ = s.enc.Encode(event)
+	s.c.Writer.Flush()
+}
+
+// outputRecorder collects command output and forwards complete lines to the
+// stream, if any, with the secrets of redactor masked and, if deterministic,
+// without their timestamps. Writes are serialized by runHHFab; the shards of
+// a parallel validation write to recorders of their own.
+type outputRecorder struct {
+	stream        *eventStream
+	redactor      *redact.Redactor
+	deterministic bool
+	output        bytes.Buffer
+	partial       []byte
+}
+
+func (r *outputRecorder) Write(p []byte) (int, error) {
+	r.output.Write(p)
+	if r.stream == nil {
+		return len(p), nil
+	}
+
+	r.partial = append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		r.stream.send(StreamEvent{Type: StreamOutput, Line: r.line(r.partial[:i])})
+		r.partial = r.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// line returns a line of output as it is streamed.
+func (r *outputRecorder) line(p []byte) string {
+	line := r.redactor.String(string(p))
+	if r.deterministic {
+		line = stripTimestamps(line)
+	}
+	return line
+}
+
+// String flushes a trailing partial line and returns the whole output.
+func (r *outputRecorder) String() string {
+	if r.stream != nil && len(r.partial) > 0 {
+		r.stream.send(StreamEvent{Type: StreamOutput, Line: r.line(r.partial)})
+		r.partial = nil
+	}
+	return r.output.String()
+}
+
+// shard returns a recorder for a shard of a parallel validation, streaming
+// its lines to the stream of r as they come.
+func (r *outputRecorder) shard() *outputRecorder {
+	return &outputRecorder{stream: r.stream, redactor: r.redactor, deterministic: r.deterministic}
+}
+
+// record appends the output of a shard recorder, which has streamed it
+// already.
+func (r *outputRecorder) record(output string) {
+	r.output.WriteString(output)
+}
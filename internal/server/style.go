@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"os"
+
+	"validator/internal/codes"
+	"validator/internal/style"
+	"validator/internal/wiring"
+)
+
+// checkStyle runs the style checks of cfg over the saved uploads, before
+// extraction rewrites them, and returns their findings as warnings
+// attributed to the objects holding the lines, so ignore comments apply.
+func (v *validation) checkStyle(sources []sourceFile, parsed *parsedSources) []Diagnostic {
+	cfg := v.cfg.Style
+	if !cfg.Enabled {
+		return nil
+	}
+	rules := style.Rules{
+		Indentation:   cfg.Indentation,
+		LineLength:    cfg.LineLength,
+		Truthy:        cfg.Truthy,
+		DuplicateKeys: cfg.DuplicateKeys,
+	}
+
+	diagnostics := []Diagnostic{}
+	for _, source := range sources {
+		data, err := os.ReadFile(source.Path)
+		if err != nil {
+			continue
+		}
+		for _, finding := range style.Check(data, rules) {
+			d := Diagnostic{
+				Severity: SeverityWarning,
+				Code:     codes.Style,
+				Message:  fmt.Sprintf("%s (%s)", finding.Message, finding.Rule),
+				Source:   SourceValidator,
+				File:     source.Name,
+				Line:     finding.Line,
+			}
+			if object := objectAt(parsed.objects, source.Name, finding.Line); object != nil {
+				d.Object = object.Key()
+			}
+			diagnostics = append(diagnostics, d)
+		}
+	}
+	return diagnostics
+}
+
+// objectAt returns the object of file starting last at or before line.
+func objectAt(objects []*wiring.Object, file string, line int) *wiring.Object {
+	var found *wiring.Object
+	for _, object := range objects {
+		if object.File == file && object.Line <= line && (found == nil || object.Line > found.Line) {
+			found = object
+		}
+	}
+	return found
+}
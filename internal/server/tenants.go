@@ -0,0 +1,198 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTenant is the tenant of requests that name none.
+const DefaultTenant = "default"
+
+// Keys of the gin context the identity of a request is kept under.
+const (
+	tenantKey        = "tenant"
+	roleKey          = "role"
+	authenticatedKey = "authenticated"
+)
+
+var tenantName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// validTenant reports whether name can name a tenant, in keys, logs and
+// metric labels alike.
+func validTenant(name string) bool {
+	return tenantName.MatchString(name)
+}
+
+// identify resolves the tenant and role of a request from its credentials,
+// see AuthConfig. Requests with credentials that name no tenant are
+// rejected, requests without any belong to the default tenant.
+func (s *Server) identify(c *gin.Context) {
+	id, err := s.currentConfig().authenticate(c.Request)
+	if err != nil {
+		c.Header("WWW-Authenticate", "Bearer")
+		abortProblem(c, http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(tenantKey, id.tenant)
+	c.Set(roleKey, id.role)
+	c.Set(authenticatedKey, id.authenticated)
+	c.Next()
+}
+
+// authenticate returns the tenant and role granted by the API key or JWT
+// of r. The admin token is the admin of the default tenant.
+func (cfg *runtimeConfig) authenticate(r *http.Request) (identity, error) {
+	credential := r.Header.Get("X-API-Key")
+	if credential == "" {
+		credential, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	switch {
+	case credential == "":
+		return identity{tenant: DefaultTenant, role: cfg.Auth.DefaultRole}, nil
+	case cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(cfg.AdminToken)) == 1:
+		return identity{tenant: DefaultTenant, role: RoleAdmin, authenticated: true}, nil
+	}
+	if id, ok := cfg.lookupAPIKey(credential); ok {
+		return id, nil
+	}
+	if (cfg.Auth.JWT.Secret == "" && cfg.jwtKey == nil) || strings.Count(credential, ".") != 2 {
+		return identity{}, errors.New("unknown API key")
+	}
+	claims, err := verifyJWT(credential, cfg.Auth.JWT, cfg.jwtKey, time.Now())
+	if err != nil {
+		return identity{}, err
+	}
+	tenant, _ := claims[cfg.Auth.JWT.TenantClaim].(string)
+	if !validTenant(tenant) {
+		return identity{}, fmt.Errorf("the token has no valid %s claim", cfg.Auth.JWT.TenantClaim)
+	}
+	role := highestRole(claimRoles(claims[cfg.Auth.JWT.RolesClaim]), cfg.Auth.DefaultRole)
+	return identity{tenant: tenant, role: role, authenticated: true}, nil
+}
+
+// apiKey is an API key by its SHA-256, with the identity it grants.
+type apiKey struct {
+	hash     [sha256.Size]byte
+	identity identity
+}
+
+// lookupAPIKey returns the identity the API key grants. Like JWT signatures,
+// keys are compared in constant time, by their hashes so that the length of
+// the configured keys does not leak either, and all of them are compared.
+func (cfg *runtimeConfig) lookupAPIKey(credential string) (identity, bool) {
+	sum := sha256.Sum256([]byte(credential))
+	found := identity{}
+	match := 0
+	for _, key := range cfg.apiKeys {
+		if subtle.ConstantTimeCompare(sum[:], key.hash[:]) == 1 {
+			found, match = key.identity, 1
+		}
+	}
+	return found, match == 1
+}
+
+// tenantOf returns the tenant of a request passed by identify.
+func tenantOf(c *gin.Context) string {
+	if tenant := c.GetString(tenantKey); tenant != "" {
+		return tenant
+	}
+	return DefaultTenant
+}
+
+// isAdmin reports whether the request is an admin of the default tenant,
+// like the admin token, which sees the history, results and jobs of every
+// tenant. Admins of other tenants only see their own.
+func isAdmin(c *gin.Context) bool {
+	return roleOf(c) == RoleAdmin && tenantOf(c) == DefaultTenant
+}
+
+// visibleTo reports whether a request of the tenant, or an admin of the
+// default one, may see something recorded for owner. Old records without an
+// owner belong to the default tenant.
+func visibleTo(c *gin.Context, owner string) bool {
+	if owner == "" {
+		owner = DefaultTenant
+	}
+	return isAdmin(c) || owner == tenantOf(c)
+}
+
+// template returns the template of the tenant by name, or else the shared
+// one, nil if neither exists.
+func (cfg *runtimeConfig) template(tenant, name string) []byte {
+	if template, ok := cfg.tenantTemplates[tenant][name]; ok {
+		return template
+	}
+	return cfg.templates[name]
+}
+
+// templateNames lists the templates a tenant can use.
+func (cfg *runtimeConfig) templateNames(tenant string) []string {
+	names := []string{}
+	for name := range cfg.templates {
+		names = append(names, name)
+	}
+	for name := range cfg.tenantTemplates[tenant] {
+		if cfg.templates[name] == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// tenantSlots counts the validations of every tenant running on the replica
+// against their max_concurrent.
+type tenantSlots struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newTenantSlots() *tenantSlots {
+	return &tenantSlots{running: map[string]int{}}
+}
+
+// acquire takes a slot of the tenant unless max of them are taken already;
+// a zero max never runs out.
+func (t *tenantSlots) acquire(tenant string, max int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if max > 0 && t.running[tenant] >= max {
+		return false
+	}
+	t.running[tenant]++
+	return true
+}
+
+func (t *tenantSlots) release(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running[tenant]--; t.running[tenant] <= 0 {
+		delete(t.running, tenant)
+	}
+}
+
+// logFormat is the access log line of gin with the tenant of the request.
+func logFormat(param gin.LogFormatterParams) string {
+	tenant, _ := param.Keys[tenantKey].(string)
+	if tenant == "" {
+		tenant = "-"
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-10s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		tenant,
+		param.Method,
+		param.Path,
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/topology"
+	"validator/internal/wiring"
+)
+
+// topologyContentTypes are the content types of the graph formats.
+var topologyContentTypes = map[string]string{
+	topology.FormatDOT:     "text/vnd.graphviz; charset=utf-8",
+	topology.FormatMermaid: "text/plain; charset=utf-8",
+	topology.FormatSVG:     "image/svg+xml",
+	topology.FormatDrawIO:  "application/vnd.jgraph.mxfile",
+}
+
+// topologyExtensions are the file extensions of the graph formats.
+var topologyExtensions = map[string]string{
+	topology.FormatDOT:     "dot",
+	topology.FormatMermaid: "mmd",
+	topology.FormatSVG:     "svg",
+	topology.FormatDrawIO:  "drawio",
+}
+
+// postTopology renders the uploaded wiring files as a graph of their
+// switches, servers and connections. The format query parameter selects DOT
+// (the default), Mermaid, SVG or draw.io. The files are parsed but not
+// validated and hhfab is not run; connections whose ports cannot be parsed
+// are left out. The files are uploaded, hence POST, the diagrams of stored
+// results are served by GET /results/:id/diagram.
+func (s *Server) postTopology(c *gin.Context) {
+	format := c.DefaultQuery("format", topology.FormatDOT)
+	contentType, ok := topologyContentTypes[format]
+	if !ok {
+		problem(c, http.StatusBadRequest, gin.H{"error": "unsupported format " + format + ", must be dot, mermaid, svg or drawio"})
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		problem(c, http.StatusBadRequest, gin.H{"error": "failed to parse multipart form: " + err.Error()})
+		return
+	}
+	files := form.File["wiring"]
+	if len(files) == 0 {
+		problem(c, http.StatusBadRequest, gin.H{"error": "wiring file is required"})
+		return
+	}
+
+	objects := []*wiring.Object{}
+	for _, file := range files {
+		f, err := file.Open()
+		if err != nil {
+			problem(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			problem(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		parsed, err := wiring.Parse(data, file.Filename)
+		if err != nil {
+			problem(c, http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		objects = append(objects, parsed...)
+	}
+
+	var graph bytes.Buffer
+	if err := topology.Write(&graph, topology.Build(objects), format); err != nil {
+		problem(c, http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType, graph.Bytes())
+}
+
+// diagram renders the objects of a validation as a diagram in format, nil
+// if it could not be rendered.
+func diagram(format string, objects []*wiring.Object) *Diagram {
+	var graph bytes.Buffer
+	if err := topology.Write(&graph, topology.Build(objects), format); err != nil {
+		return nil
+	}
+	return &Diagram{Format: format, ContentType: topologyContentTypes[format], Content: graph.Bytes()}
+}
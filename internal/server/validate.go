@@ -0,0 +1,964 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"validator/internal/codes"
+	"validator/internal/redact"
+	"validator/internal/rules"
+	"validator/internal/topology"
+	"validator/internal/wiring"
+	"validator/pkg/api"
+)
+
+func (s *Server) validateFiles(c *gin.Context) {
+	started := time.Now()
+
+	// Use one configuration snapshot for the whole request
+	cfg := s.currentConfig()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.timeout())
+	defer cancel()
+
+	async := c.Query("async") == "true"
+	stream := c.Query("stream") == "true"
+	if async && stream {
+		problem(c, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Invalid parameters",
+			Error:   "stream and async cannot be combined",
+		})
+		return
+	}
+	format := c.DefaultQuery("format", formatJSON)
+	if !slices.Contains(resultFormats, format) {
+		problem(c, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Invalid parameters",
+			Error:   fmt.Sprintf("unsupported format %q, must be one of: %s", format, strings.Join(resultFormats, ", ")),
+		})
+		return
+	}
+	if format != formatJSON && (async || stream) {
+		problem(c, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Invalid parameters",
+			Error:   fmt.Sprintf("format=%s cannot be combined with stream or async", format),
+		})
+		return
+	}
+
+	if usage := s.tempUsage.Load(); cfg.overTempQuota(usage) {
+		problem(c, http.StatusServiceUnavailable, ValidateResponse{
+			Success: false,
+			Message: "Temporary disk quota exceeded",
+			Error:   fmt.Sprintf("temporary directories use %d MB of the %d MB quota, retry once running validations finish", usage/(1024*1024), cfg.Temp.QuotaMB),
+		})
+		return
+	}
+
+	// Synchronous validations are refused while an admin paused the queue,
+	// jobs are queued until it is resumed
+	if !async && s.gate.isPaused() {
+		s.paused(c, cfg)
+		return
+	}
+
+	// Turn requests away before reading their uploads while the line for a
+	// worker is full
+	if !async && s.pool.saturated(cfg.Workers.ShedQueue) {
+		s.shed(c, cfg, "")
+		return
+	}
+
+	// Uploads are streamed to the temporary directory of the validation
+	tempDir, err := makeTempDir("validator-*")
+	if err != nil {
+		problem(c, http.StatusInternalServerError, ValidateResponse{
+			Success: false,
+			Message: "Failed to create temporary directory",
+			Error:   err.Error(),
+		})
+		return
+	}
+	defer removeTempDir(tempDir)
+
+	request, status, failure := readJobRequest(c, cfg, tempDir)
+	if request == nil {
+		problem(c, status, failure)
+		return
+	}
+	request.BaseURL = baseURL(c, cfg)
+
+	// Retries with the Idempotency-Key of an earlier request are answered
+	// with its result
+	idempotent, answered := s.claimIdempotency(c, cfg, request, async)
+	if answered {
+		return
+	}
+	defer idempotent.release(c.Request.Context())
+
+	// Jobs carry their uploads to the runner, HTML reports quote them and
+	// canaries validate them once more after the request
+	canary := !async && canaryWanted(cfg, request)
+	if async || format == formatHTML || canary {
+		if err := request.load(); err != nil {
+			problem(c, http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to read uploads",
+				Error:   err.Error(),
+				UseCase: request.useCase(),
+			})
+			return
+		}
+	}
+
+	// Asynchronous validations are queued for the job runners of any replica
+	if async {
+		if job := s.submitJob(c, request); job != nil {
+			idempotent.finishJob(c.Request.Context(), job)
+		}
+		return
+	}
+
+	// Identical requests are answered from the cache without a worker
+	key := s.requestKey(cfg, request)
+	if cached, ok := s.cachedResult(ctx, key); ok {
+		if canary {
+			go s.runCanary(cfg, request, cached.Status, cached.Response)
+		}
+		response := s.recordResult(ctx, request.BaseURL, newHistoryEntry(request, cached.Status, cached.Response, started))
+		idempotent.finish(c.Request.Context(), cached.Status, response)
+		respond(c, request, nil, cached.Status, response)
+		return
+	}
+
+	// Identical requests running already are waited for instead
+	flight, status, response, ok := s.awaitFlight(ctx, s.flightKey(cfg, request, stream))
+	if ok {
+		if canary {
+			go s.runCanary(cfg, request, status, response)
+		}
+		response = s.recordResult(ctx, request.BaseURL, newHistoryEntry(request, status, response, started))
+		idempotent.finish(c.Request.Context(), status, response)
+		respond(c, request, nil, status, response)
+		return
+	}
+	defer flight.abandon()
+
+	// Tenants only run as many validations at once as their quota allows
+	if max := cfg.Tenants[request.Tenant].MaxConcurrent; !s.tenants.acquire(request.Tenant, max) {
+		problem(c, http.StatusTooManyRequests, ValidateResponse{
+			Success: false,
+			Message: "Tenant quota exceeded",
+			Error:   fmt.Sprintf("tenant %s may run %d validations at once, retry once they finish", request.Tenant, max),
+			UseCase: request.useCase(),
+		})
+		return
+	}
+	defer s.tenants.release(request.Tenant)
+
+	// Wait for a free worker before touching hhfab; requests timing out in
+	// line are told to back off like those turned away
+	if err := s.pool.tryAcquire(ctx, cfg.Workers.ShedQueue); err != nil {
+		s.shed(c, cfg, request.useCase())
+		return
+	}
+	defer s.pool.release()
+
+	// Admins cancel the validation by the ID of the request
+	ctx, stop := s.running.start(ctx, c.GetString(requestIDKey))
+	defer stop()
+	v := &validation{cfg: cfg, request: request, dir: tempDir, workspaces: s.workspaces, cache: s.cache, hhfabVersion: s.hhfabVersion(), started: started}
+	if stream {
+		v.startStream = func() *eventStream { return startStream(c) }
+	}
+	status, response = v.run(ctx)
+	status, response = cancelledResult(ctx, status, response)
+	flight.finish(status, response)
+	s.cacheResult(ctx, key, status, response)
+	if canary {
+		go s.runCanary(cfg, request, status, response)
+	}
+	response = s.recordResult(ctx, request.BaseURL, newHistoryEntry(request, status, response, started))
+	idempotent.finish(c.Request.Context(), status, response)
+	respond(c, request, v.stream, status, response)
+}
+
+// JobRequest holds everything a validation needs: the uploads, and the
+// template, baseline and profile they were submitted with, resolved against
+// the configuration of the replica that accepted them.
+type JobRequest struct {
+	Wiring []Upload `json:"wiring"`
+	Fab    *Upload  `json:"fab,omitempty"`
+	// Template replaces the generated fab.yaml of UC1 validations
+	Template []byte    `json:"template,omitempty"`
+	Baseline *Baseline `json:"baseline,omitempty"`
+	// Kinds are the kinds of the wiring documents to validate, all if empty
+	Kinds       []string      `json:"kinds,omitempty"`
+	ProfileName string        `json:"profile_name,omitempty"`
+	Profile     rules.Profile `json:"profile"`
+	// NoCache skips the result cache, for requests with cache=false
+	NoCache bool `json:"no_cache,omitempty"`
+	// Parallel splits the validation into shards of independent objects
+	Parallel bool `json:"parallel,omitempty"`
+	// Incremental scopes the reuse of hhfab results of unchanged groups of
+	// objects, such as a repository; unset validates everything
+	Incremental string `json:"incremental,omitempty"`
+	// Deterministic strips the timestamps and the duration from the result
+	Deterministic bool `json:"deterministic,omitempty"`
+	// Canary runs the request with the candidate hhfab too, sampled or not
+	Canary bool `json:"canary,omitempty"`
+	// Diagram is the format of the topology diagram returned with a
+	// successful result, none if empty
+	Diagram string `json:"diagram,omitempty"`
+	// BaseURL is the address the request was sent to, which links to its
+	// result start with
+	BaseURL string `json:"base_url,omitempty"`
+	// Tenant is the tenant of the request, which results are kept apart by
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Upload is an uploaded file. The uploads of a request are streamed to files
+// of its temporary directory, jobs carry their data to the runner instead.
+type Upload struct {
+	Name string `json:"name"`
+	// Digest is the SHA-256 of the file, which identifies it in cache keys
+	Digest string `json:"digest"`
+	Data   []byte `json:"data,omitempty"`
+	path   string
+}
+
+// load reads the streamed file into Data. The file goes away with the
+// request, so the upload is saved from Data afterwards.
+func (u *Upload) load() error {
+	if u.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(u.path)
+	if err != nil {
+		return err
+	}
+	u.Data, u.path = data, ""
+	return nil
+}
+
+// save moves the upload to path, or writes its data there.
+func (u *Upload) save(path string) error {
+	if u.path != "" {
+		return os.Rename(u.path, path)
+	}
+	return os.WriteFile(path, u.Data, 0644)
+}
+
+func (r *JobRequest) useCase() string {
+	if r.Fab != nil {
+		return "uc2"
+	}
+	return "uc1"
+}
+
+// load reads the uploads into the request, for queueing it as a job.
+func (r *JobRequest) load() error {
+	for i := range r.Wiring {
+		if err := r.Wiring[i].load(); err != nil {
+			return err
+		}
+	}
+	if r.Fab != nil {
+		return r.Fab.load()
+	}
+	return nil
+}
+
+// withoutData returns a copy of the request identifying uploads by digest
+// only and without its address, so that the same request hashes the same
+// whether it was streamed or queued, whichever address it was sent to and
+// whether it was canaried.
+func (r *JobRequest) withoutData() *JobRequest {
+	copied := *r
+	copied.BaseURL = ""
+	copied.Canary = false
+	copied.Wiring = make([]Upload, len(r.Wiring))
+	for i, upload := range r.Wiring {
+		copied.Wiring[i] = Upload{Name: upload.Name, Digest: upload.Digest}
+	}
+	if r.Fab != nil {
+		copied.Fab = &Upload{Name: r.Fab.Name, Digest: r.Fab.Digest}
+	}
+	return &copied
+}
+
+// errUploadTooLarge is returned for parts over their upload limit.
+var errUploadTooLarge = errors.New("file too large")
+
+// uploadTooLarge is the 413 response to a request over an upload limit.
+func uploadTooLarge(field, file string, limit int64, message string) (*JobRequest, int, ValidateResponse) {
+	return nil, http.StatusRequestEntityTooLarge, ValidateResponse{
+		Success: false,
+		Message: "File too large",
+		Error:   message,
+		Limit:   &LimitExceeded{Field: field, File: file, Limit: limit},
+	}
+}
+
+// readJobRequest reads the parameters of a validation, streaming its uploads
+// part by part to files in dir so that large uploads are never held in
+// memory. Requests that cannot be validated return nil with the status and
+// response to send.
+func readJobRequest(c *gin.Context, cfg *runtimeConfig, dir string) (*JobRequest, int, ValidateResponse) {
+	limits := cfg.UploadLimits
+	parseFailed := func(err error) (*JobRequest, int, ValidateResponse) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return uploadTooLarge("request", "", tooLarge.Limit,
+				fmt.Sprintf("the request is larger than %d bytes", tooLarge.Limit))
+		}
+		return nil, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Failed to parse multipart form",
+			Error:   err.Error(),
+		}
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return parseFailed(err)
+	}
+
+	request := &JobRequest{Tenant: tenantOf(c)}
+	var template, baselineName string
+	var baselineData []byte
+	var bundleSize int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return parseFailed(err)
+		}
+
+		field := part.FormName()
+		switch {
+		// Only the first fab file is used, like form values
+		case (field == "wiring" || (field == "fab" && request.Fab == nil)) && part.FileName() != "":
+			// Wiring files stop at whichever of their limits is reached first
+			limit, limitField := limits.Fab, field
+			if field == "wiring" {
+				limit = limits.Wiring
+				if remaining := limits.Bundle - bundleSize; remaining < limit {
+					limit, limitField = remaining, "bundle"
+				}
+			}
+			upload, size, err := streamUpload(part, dir, limit, cfg.Screening)
+			part.Close()
+			var rejected *screenError
+			if errors.As(err, &rejected) {
+				return nil, http.StatusUnprocessableEntity, ValidateResponse{
+					Success:  false,
+					Message:  "Implausible upload",
+					Error:    fmt.Sprintf("%s file %s is not plausibly YAML: %s", field, part.FileName(), rejected.Error()),
+					Rejected: &UploadRejected{Field: field, File: part.FileName(), Reason: rejected.reason, Line: rejected.line, Limit: rejected.limit},
+				}
+			}
+			if errors.Is(err, errUploadTooLarge) {
+				if limitField == "bundle" {
+					return uploadTooLarge("bundle", part.FileName(), limits.Bundle,
+						fmt.Sprintf("the wiring files are larger than %d bytes together", limits.Bundle))
+				}
+				return uploadTooLarge(field, part.FileName(), limit,
+					fmt.Sprintf("%s file %s is larger than %d bytes", field, part.FileName(), limit))
+			}
+			var overRequest *http.MaxBytesError
+			if errors.As(err, &overRequest) {
+				return parseFailed(err)
+			}
+			if err != nil {
+				return nil, http.StatusBadRequest, ValidateResponse{
+					Success: false,
+					Message: fmt.Sprintf("Failed to read %s file", field),
+					Error:   err.Error(),
+				}
+			}
+			if field == "wiring" {
+				bundleSize += size
+			}
+			if field == "fab" {
+				request.Fab = &upload
+			} else {
+				request.Wiring = append(request.Wiring, upload)
+			}
+			continue
+		case field == "baseline" && part.FileName() != "" && baselineName == "":
+			baselineName = part.FileName()
+			baselineData, err = readPart(part, cfg.MaxFileSize)
+		case field == "template" && part.FileName() == "":
+			var value []byte
+			value, err = readPart(part, maxFieldSize)
+			template = string(value)
+		}
+		part.Close()
+		if err != nil {
+			return parseFailed(err)
+		}
+	}
+
+	// Check for required wiring file
+	if len(request.Wiring) == 0 {
+		return nil, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Missing required wiring file",
+			Error:   "wiring file is required",
+		}
+	}
+
+	// UC1 may replace the generated fab.yaml with a configured template
+	if request.useCase() == "uc1" {
+		if template == "" {
+			request.Template = cfg.template(request.Tenant, "default")
+		} else if request.Template = cfg.template(request.Tenant, template); request.Template == nil {
+			return nil, http.StatusBadRequest, ValidateResponse{
+				Success: false,
+				Message: "Unknown template",
+				Error:   fmt.Sprintf("template %q is not configured", template),
+				UseCase: request.useCase(),
+			}
+		}
+	}
+
+	// A baseline lists known findings that do not fail the validation
+	if baselineName != "" {
+		if request.Baseline, err = api.ParseBaseline(baselineData); err != nil {
+			return nil, http.StatusBadRequest, ValidateResponse{
+				Success: false,
+				Message: "Invalid baseline",
+				Error:   fmt.Sprintf("%s: %s", baselineName, err.Error()),
+			}
+		}
+	}
+
+	// Only the documents of the requested kinds of the wiring files are
+	// validated, the fabricator config is always loaded in full
+	request.Kinds = requestedKinds(c.Query("kinds"))
+
+	// A profile selects the native rules and the topology the fabric must have
+	request.ProfileName = c.Query("profile")
+	profile, ok := cfg.profiles[request.ProfileName]
+	if request.ProfileName != "" && !ok {
+		return nil, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Unknown profile",
+			Error:   fmt.Sprintf("profile %q is not configured", request.ProfileName),
+		}
+	}
+	// Strict mode is on when requested or when the profile requires it
+	profile.Strict = profile.Strict || c.Query("strict") == "true"
+	request.Profile = profile
+	request.NoCache = c.Query("cache") == "false"
+	request.Parallel = c.Query("parallel") == "true"
+	request.Incremental = c.Query("incremental")
+	request.Deterministic = cfg.DeterministicOutput || c.Query("deterministic") == "true"
+	request.Canary = c.Query("canary") == "true"
+	request.Diagram = c.Query("diagram")
+	if _, ok := topologyContentTypes[request.Diagram]; request.Diagram != "" && !ok {
+		return nil, http.StatusBadRequest, ValidateResponse{
+			Success: false,
+			Message: "Unsupported diagram format",
+			Error:   fmt.Sprintf("diagram format %q is not supported, must be one of: %s", request.Diagram, strings.Join(topology.Formats, ", ")),
+		}
+	}
+
+	return request, http.StatusOK, ValidateResponse{}
+}
+
+// maxFieldSize limits the form values of a validation.
+const maxFieldSize = 1024
+
+// streamUpload copies an uploaded file to a new file in dir, hashing and
+// screening it on the way, and returns it with its size. It fails with
+// errUploadTooLarge past limit bytes and with a *screenError as soon as the
+// upload is not plausibly YAML, before the offending line is written.
+func streamUpload(part *multipart.Part, dir string, limit int64, screening ScreeningConfig) (Upload, int64, error) {
+	f, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return Upload{}, 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	screen := newScreener(screening)
+	n, err := io.Copy(io.MultiWriter(screen, hash, f), io.LimitReader(part, limit+1))
+	if err != nil {
+		return Upload{}, 0, err
+	}
+	if n > limit {
+		return Upload{}, 0, errUploadTooLarge
+	}
+	if err := screen.finish(); err != nil {
+		return Upload{}, 0, err
+	}
+	if err := f.Close(); err != nil {
+		return Upload{}, 0, err
+	}
+	return Upload{Name: part.FileName(), Digest: hex.EncodeToString(hash.Sum(nil)), path: f.Name()}, n, nil
+}
+
+// readPart reads a part of at most limit bytes into memory.
+func readPart(part *multipart.Part, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(part, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", part.FormName(), limit)
+	}
+	return data, nil
+}
+
+// validation runs a JobRequest in a workspace of workspaces, with dir a
+// temporary directory the caller removes. Incremental validations keep the
+// results of groups of objects in cache, nil if there is none. startStream,
+// if set, is called right before hhfab runs to stream its output.
+type validation struct {
+	cfg          *runtimeConfig
+	request      *JobRequest
+	dir          string
+	workspaces   *workspacePool
+	cache        ResultCache
+	hhfabVersion string
+	started      time.Time
+	startStream  func() *eventStream
+	stream       *eventStream
+	// redactor masks the secrets of the fab file in everything derived
+	// from it
+	redactor *redact.Redactor
+}
+
+// run validates the request and returns the response with its status code,
+// the secrets of the fab file masked, stripped for deterministic requests.
+// The caller holds a worker slot.
+func (v *validation) run(ctx context.Context) (int, ValidateResponse) {
+	v.redactor = v.request.redactor()
+	status, response := v.validate(ctx)
+	redactResponse(v.redactor, &response)
+	if v.request.Deterministic {
+		deterministicResponse(&response)
+	}
+	return status, response
+}
+
+func (v *validation) validate(ctx context.Context) (int, ValidateResponse) {
+	cfg, request, started := v.cfg, v.request, v.started
+	useCase := request.useCase()
+	kinds := request.Kinds
+	baseline := request.Baseline
+	profile, profileName := request.Profile, request.ProfileName
+
+	// Without hhfab the uploads are only checked by the validator itself
+	schemaOnly := cfg.schemaOnly()
+	var mode string
+	if schemaOnly {
+		mode = ModeSchemaOnly
+	}
+
+	// hhfab validates in an initialized workspace of the pool, which is reset
+	// for the next validation afterwards
+	workDir := filepath.Join(v.dir, "work")
+	if schemaOnly {
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to create work directory",
+				Error:   err.Error(),
+			}
+		}
+	} else {
+		ws, initOutput, err := v.workspaces.get(ctx, cfg)
+		if err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to initialize hhfab",
+				Error:   err.Error(),
+				Output:  string(initOutput),
+				UseCase: useCase,
+			}
+		}
+		defer v.workspaces.put(ws, cfg)
+		workDir = ws.dir
+	}
+
+	// Create include directory
+	includeDir := filepath.Join(workDir, "include")
+	if err := os.MkdirAll(includeDir, 0755); err != nil {
+		return http.StatusInternalServerError, ValidateResponse{
+			Success: false,
+			Message: "Failed to create include directory",
+			Error:   err.Error(),
+		}
+	}
+
+	// Save wiring files to include directory, hhfab loads all of them
+	sources := []sourceFile{}
+	for i, wiringFile := range request.Wiring {
+		wiringPath := filepath.Join(includeDir, wiringFileName(i, len(request.Wiring)))
+		sources = append(sources, sourceFile{Name: wiringFile.Name, Path: wiringPath, Kinds: kinds})
+		if err := request.Wiring[i].save(wiringPath); err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to save wiring file",
+				Error:   err.Error(),
+			}
+		}
+	}
+
+	// Apply the configured template on top of the default fab.yaml
+	if request.Template != nil {
+		if err := os.WriteFile(filepath.Join(workDir, "fab.yaml"), request.Template, 0644); err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to write fab template",
+				Error:   err.Error(),
+			}
+		}
+	}
+
+	// Handle UC2: Replace default fab.yaml with user-provided one
+	if useCase == "uc2" {
+		// Remove the default fab.yaml
+		defaultFabPath := filepath.Join(workDir, "fab.yaml")
+		if err := os.Remove(defaultFabPath); err != nil && !os.IsNotExist(err) {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to remove default fab.yaml",
+				Error:   err.Error(),
+			}
+		}
+
+		// Save user-provided fab.yaml
+		fabPath := filepath.Join(workDir, "fab.yaml")
+		sources = append(sources, sourceFile{Name: request.Fab.Name, Path: fabPath})
+		if err := request.Fab.save(fabPath); err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to save fab file",
+				Error:   err.Error(),
+			}
+		}
+	}
+
+	// Parse before extracting so that objects keep their lines in the uploads
+	parsed := parseSources(sources)
+	// Style checks read the uploads before extraction too
+	styled := v.checkStyle(sources, parsed)
+
+	// Incremental validations only have hhfab validate the groups of objects
+	// that changed since an earlier validation in their scope. Parallel
+	// validations split the wiring files into shards of independent objects,
+	// each validated by hhfab in a workspace of its own
+	var incremental *incrementalPlan
+	var shards []shard
+	if request.Incremental != "" && !request.NoCache && !schemaOnly && v.cache != nil {
+		fab, err := os.ReadFile(filepath.Join(workDir, "fab.yaml"))
+		if err == nil || os.IsNotExist(err) {
+			incremental = v.planIncremental(ctx, sources[:len(request.Wiring)], fab)
+		}
+	}
+	if incremental == nil && request.Parallel && !schemaOnly {
+		shards = planShards(sources[:len(request.Wiring)], cfg.Workers.MaxShards)
+	}
+	if changed := incremental.changed(); changed != nil {
+		if err := writeShard(sources[:len(request.Wiring)], changed); err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to extract changed documents",
+				Error:   err.Error(),
+				UseCase: useCase,
+			}
+		}
+	} else if len(kinds) > 0 && incremental == nil {
+		kept, err := extractKinds(sources)
+		if err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to extract documents",
+				Error:   err.Error(),
+				UseCase: useCase,
+			}
+		}
+		// Files that are not valid YAML are left for hhfab to report
+		if kept == 0 && parsed.complete {
+			return http.StatusBadRequest, ValidateResponse{
+				Success: false,
+				Message: "No documents of the requested kinds",
+				Error:   fmt.Sprintf("the wiring files have no documents of kind %s", strings.Join(kinds, ", ")),
+			}
+		}
+	}
+
+	// Check the objects against the CRD schemas first, hhfab stops at the
+	// first invalid field and does not say where it is. Violations
+	// acknowledged by ignore comments or known to the baseline do not fail
+	// the request
+	schemaErrors, suppressed := parsed.suppress(parsed.validateSchemas(cfg.schemas))
+	schemaErrors, baselined := splitBaseline(baseline, schemaErrors)
+	if len(schemaErrors) > 0 {
+		objects := parsed.results(schemaErrors)
+		return http.StatusBadRequest, ValidateResponse{
+			Success:     false,
+			Message:     "Schema validation failed",
+			UseCase:     useCase,
+			Mode:        mode,
+			Profile:     profileName,
+			Error:       firstErrorMessage(schemaErrors),
+			Diagnostics: schemaErrors,
+			Suppressed:  suppressed,
+			Baselined:   baselined,
+			Objects:     objects,
+			Summary:     summarize(schemaErrors, suppressed, baselined, objects, started),
+		}
+	}
+
+	// kubeconform reports the field errors the validator's own schema
+	// checks do not cover, such as formats
+	kubeconform := v.runKubeconform(ctx, sources, parsed)
+
+	// Run hhfab validate and capture exact output, streaming it on request
+	if v.startStream != nil {
+		v.stream = v.startStream()
+	}
+	var err error
+	var diagnostics []Diagnostic
+	var process *Process
+	output := &outputRecorder{stream: v.stream, redactor: v.redactor, deterministic: request.Deterministic}
+	if schemaOnly {
+		diagnostics = parsed.parseDiagnostics()
+	} else if incremental != nil && incremental.changed() == nil {
+		fmt.Fprintf(output, "hhfab validate skipped, the %d groups of objects are unchanged since an earlier validation\n", len(incremental.groups))
+		diagnostics = incremental.reusedDiagnostics()
+	} else if shards != nil {
+		var fab *sourceFile
+		if useCase == "uc2" {
+			fab = &sources[len(sources)-1]
+		}
+		result := v.runShards(ctx, shards, workDir, fab, output)
+		if result.err != nil {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to run parallel validation",
+				Error:   result.err.Error(),
+				UseCase: useCase,
+			}
+		}
+		err, diagnostics, process = result.failed, result.diagnostics, result.process
+		parsed.locate(diagnostics)
+	} else {
+		process, err = cfg.validator().Validate(ctx, workDir, output)
+		if errors.Is(err, errResourceLimits) {
+			return http.StatusInternalServerError, ValidateResponse{
+				Success: false,
+				Message: "Failed to apply resource limits",
+				Error:   err.Error(),
+				UseCase: useCase,
+			}
+		}
+		diagnostics = parseDiagnostics(diagnosticOutput(output.String(), process, request.Deterministic), err != nil)
+		diagnostics = append(diagnostics, resourceDiagnostics(err)...)
+		redactDiagnostics(v.redactor, diagnostics)
+		newSourceMap(workDir, sources).translate(diagnostics)
+		parsed.locate(diagnostics)
+		if incremental != nil {
+			if err == nil {
+				incremental.store(ctx, v.cache, diagnostics)
+			}
+			diagnostics = append(diagnostics, incremental.reusedDiagnostics()...)
+		}
+	}
+
+	outputStr := output.String()
+	checked := parsed.check(ctx, profile, cfg.plugins)
+	diagnostics, acknowledged := parsed.suppress(append(append(append(diagnostics, kubeconform...), styled...), checked...))
+	suppressed = append(suppressed, acknowledged...)
+	diagnostics, known := splitBaseline(baseline, diagnostics)
+	baselined = append(baselined, known...)
+	if profile.Strict {
+		promoteWarnings(diagnostics)
+	}
+	if schemaOnly {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: SeverityWarning,
+			Code:     codes.HHFabSkipped,
+			Message:  "hhfab is not available, only the schemas and native checks were run",
+			Source:   SourceValidator,
+		})
+	}
+	objects := parsed.results(diagnostics)
+
+	if err != nil || hasErrors(diagnostics) {
+		message := outputStr
+		if schemaOnly {
+			message = "Schema-only validation failed"
+		}
+		// Return exact validation output regardless of success/failure
+		response := ValidateResponse{
+			Success:     false,
+			Message:     message, // Use exact output as message
+			Output:      outputStr,
+			UseCase:     useCase,
+			Process:     process,
+			Mode:        mode,
+			Profile:     profileName,
+			Diagnostics: diagnostics,
+			Warnings:    warnings(diagnostics),
+			Suppressed:  suppressed,
+			Baselined:   baselined,
+			Objects:     objects,
+			Summary:     summarize(diagnostics, suppressed, baselined, objects, started),
+			Shards:      len(shards),
+			Incremental: incremental.result(),
+		}
+		// Wiring failing the native checks, or any warning in strict mode,
+		// fails validation even if hhfab passed it
+		if err == nil {
+			response.Error = firstErrorMessage(diagnostics)
+		}
+		return http.StatusBadRequest, response
+	}
+
+	// Success - return exact validation output
+	message := outputStr
+	if schemaOnly {
+		message = "Schema-only validation passed"
+	}
+	var topologyDiagram *Diagram
+	if request.Diagram != "" {
+		topologyDiagram = diagram(request.Diagram, parsed.objects)
+	}
+	return http.StatusOK, ValidateResponse{
+		Success:     true,
+		Message:     message, // Use exact output as message
+		Output:      outputStr,
+		UseCase:     useCase,
+		Process:     process,
+		Mode:        mode,
+		Profile:     profileName,
+		Diagnostics: diagnostics,
+		Warnings:    warnings(diagnostics),
+		Suppressed:  suppressed,
+		Baselined:   baselined,
+		Objects:     objects,
+		Summary:     summarize(diagnostics, suppressed, baselined, objects, started),
+		Shards:      len(shards),
+		Incremental: incremental.result(),
+		Diagram:     topologyDiagram,
+	}
+}
+
+// respond sends the final response, as the result event of a stream if one
+// was started or as a report in the format asked for.
+func respond(c *gin.Context, request *JobRequest, stream *eventStream, status int, response ValidateResponse) {
+	if stream != nil {
+		stream.send(StreamEvent{Type: StreamResult, Status: status, Result: &response})
+		return
+	}
+	if format := c.Query("format"); reportContentTypes[format] != "" {
+		writeFormattedReport(c, request, format, status, response)
+		return
+	}
+	respondJSON(c, status, response)
+}
+
+// wiringFileName names the i-th of n uploaded wiring files inside the include
+// directory. Bundles keep their upload order since hhfab loads files sorted by
+// name.
+func wiringFileName(i, n int) string {
+	if n == 1 {
+		return "wiring.yaml"
+	}
+	return fmt.Sprintf("wiring-%03d.yaml", i+1)
+}
+
+// requestedKinds splits the comma-separated kinds parameter.
+func requestedKinds(param string) []string {
+	kinds := []string{}
+	for _, kind := range strings.Split(param, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// extractKinds rewrites the files with Kinds to only hold the documents of
+// those kinds, so that hhfab only loads them, and returns the number of
+// documents kept. Files that cannot be parsed are left unchanged.
+func extractKinds(files []sourceFile) (int, error) {
+	kept := 0
+	for i := range files {
+		file := &files[i]
+		if len(file.Kinds) == 0 {
+			continue
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return 0, err
+		}
+		objects, err := wiring.Parse(data, file.Name)
+		if err != nil {
+			continue
+		}
+		objects = ofKinds(objects, file.Kinds)
+		if data, file.Lines, err = encodeObjects(objects, file.Name); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(file.Path, data, 0644); err != nil {
+			return 0, err
+		}
+		kept += len(objects)
+	}
+	return kept, nil
+}
+
+// encodeObjects encodes objects parsed from the upload name as a file of
+// their own, and maps the lines of the file to those of the upload.
+func encodeObjects(objects []*wiring.Object, name string) ([]byte, map[int]int, error) {
+	data, err := wiring.Encode(objects)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := wiring.Parse(data, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := map[int]int{}
+	for j, object := range encoded {
+		mapLines(object.Node, objects[j].Node, lines)
+	}
+	return data, lines, nil
+}
+
+func extractErrorMessage(output string) string {
+	lines := strings.Split(output, "\n")
+	for _, line := range lines {
+		if strings.Contains(line, "ERR") {
+			// Extract the error message after "ERR"
+			if idx := strings.Index(line, "ERR "); idx != -1 {
+				return strings.TrimSpace(line[idx+4:])
+			}
+		}
+	}
+	return "Unknown validation error"
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"validator/pkg/api"
+)
+
+const (
+	// webhookAttempts is how often a delivery is tried before it is given
+	// up, waiting webhookBackoff after the first failure and twice as long
+	// after every further one
+	webhookAttempts = 4
+	webhookBackoff  = time.Second
+	// webhookTimeout bounds every attempt
+	webhookTimeout = 10 * time.Second
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// validateWebhooks checks the webhook endpoints of the configuration.
+func validateWebhooks(webhooks []WebhookConfig) error {
+	for _, webhook := range webhooks {
+		u, err := url.Parse(webhook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook url %q must be an http(s) URL", webhook.URL)
+		}
+		if webhook.Secret == "" {
+			return fmt.Errorf("webhook %s: a secret is required", webhook.URL)
+		}
+	}
+	return nil
+}
+
+// webhooksOf returns the endpoints told about validations of the tenant:
+// those of every tenant and those of the tenant itself.
+func (cfg *runtimeConfig) webhooksOf(tenant string) []WebhookConfig {
+	webhooks := append([]WebhookConfig{}, cfg.Webhooks...)
+	return append(webhooks, cfg.Tenants[tenant].Webhooks...)
+}
+
+// notifyWebhooks posts the finished validation of entry to the webhooks of
+// its tenant in the background.
+func (s *Server) notifyWebhooks(entry *HistoryEntry) {
+	webhooks := s.currentConfig().webhooksOf(entryTenant(entry))
+	if len(webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(WebhookEvent{Event: api.WebhookValidationFinished, Entry: entry})
+	if err != nil {
+		log.Printf("Encoding webhook event failed: %v", err)
+		return
+	}
+	for _, webhook := range webhooks {
+		go deliverWebhook(webhook, api.WebhookValidationFinished, body)
+	}
+}
+
+// deliverWebhook posts body to the webhook until it answers with a 2xx
+// status or the attempts run out. Every attempt is signed anew with its
+// timestamp; the delivery ID stays the same so receivers can drop repeats.
+func deliverWebhook(webhook WebhookConfig, event string, body []byte) {
+	delivery := newJobID()
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(webhook, event, delivery, body)
+		if err == nil {
+			webhookDeliveries.WithLabelValues("delivered").Inc()
+			return
+		}
+		if attempt == webhookAttempts {
+			log.Printf("Delivering webhook %s to %s failed: %v", delivery, webhook.URL, err)
+			webhookDeliveries.WithLabelValues("failed").Inc()
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func postWebhook(webhook WebhookConfig, event, delivery string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hh-validator/"+Version)
+	req.Header.Set(api.WebhookEventHeader, event)
+	req.Header.Set(api.WebhookDeliveryHeader, delivery)
+	req.Header.Set(api.WebhookTimestampHeader, timestamp)
+	req.Header.Set(api.WebhookSignatureHeader, signWebhook(webhook.Secret, timestamp, delivery, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("answered with %s", resp.Status)
+	}
+	return nil
+}
+
+// signWebhook returns the signature header of a delivery, see
+// api.WebhookSignatureHeader.
+func signWebhook(secret, timestamp, delivery string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + delivery + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
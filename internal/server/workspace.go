@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// workspace is a directory initialized with `hhfab init`, used by one
+// validation at a time. Resetting it restores the files init created.
+type workspace struct {
+	dir   string
+	hhfab string
+	// defaultFab is the fab.yaml written by init
+	defaultFab []byte
+	// entries are the files and directories init left in dir
+	entries map[string]bool
+	created time.Time
+	uses    int
+}
+
+// newWorkspace initializes a workspace with the backend of cfg. The output
+// of hhfab is returned when init fails.
+func newWorkspace(ctx context.Context, cfg *runtimeConfig) (*workspace, []byte, error) {
+	dir, err := makeTempDir("validator-workspace-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Initialize without uploads to avoid validation during init
+	if output, err := cfg.validator().Init(ctx, dir, "--dev"); err != nil {
+		removeTempDir(dir)
+		return nil, output, fmt.Errorf("hhfab init failed: %s", err.Error())
+	}
+	workspaceInits.Inc()
+
+	ws := &workspace{dir: dir, hhfab: cfg.hhfab(), entries: map[string]bool{}, created: time.Now()}
+	if err := os.MkdirAll(ws.includeDir(), 0755); err != nil {
+		ws.remove()
+		return nil, nil, err
+	}
+	if ws.defaultFab, err = os.ReadFile(ws.fabPath()); err != nil && !os.IsNotExist(err) {
+		ws.remove()
+		return nil, nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		ws.remove()
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		ws.entries[entry.Name()] = true
+	}
+	return ws, nil, nil
+}
+
+func (w *workspace) includeDir() string {
+	return filepath.Join(w.dir, "include")
+}
+
+func (w *workspace) fabPath() string {
+	return filepath.Join(w.dir, "fab.yaml")
+}
+
+// reset empties the include directory, restores the default fab.yaml and
+// removes whatever hhfab validate left next to them.
+func (w *workspace) reset() error {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !w.entries[entry.Name()] {
+			if err := os.RemoveAll(filepath.Join(w.dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.RemoveAll(w.includeDir()); err != nil {
+		return err
+	}
+	if err := os.Mkdir(w.includeDir(), 0755); err != nil {
+		return err
+	}
+	if w.defaultFab == nil {
+		if err := os.Remove(w.fabPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(w.fabPath(), w.defaultFab, 0644)
+}
+
+// reusable reports whether the workspace may serve another validation with
+// cfg, or is due for a full refresh.
+func (w *workspace) reusable(cfg *runtimeConfig) bool {
+	maxAge := time.Duration(cfg.Workspaces.MaxAgeSec) * time.Second
+	return w.hhfab == cfg.hhfab() && w.uses < cfg.Workspaces.MaxUses && time.Since(w.created) < maxAge
+}
+
+func (w *workspace) remove() {
+	if err := removeTempDir(w.dir); err != nil {
+		log.Printf("Failed to remove workspace %s: %v", w.dir, err)
+	}
+}
+
+// workspacePool keeps initialized workspaces between validations so that
+// `hhfab init` does not run for every request. Used workspaces are reset and
+// returned to the pool, and initialized anew in the background once they
+// are due for a refresh. Limits are read on every call so configuration
+// reloads apply to the next validation.
+type workspacePool struct {
+	mu   sync.Mutex
+	idle []*workspace
+	// pending counts workspaces being initialized for the pool
+	pending int
+}
+
+func newWorkspacePool() *workspacePool {
+	return &workspacePool{}
+}
+
+// get returns an idle workspace for cfg, or initializes one if there is
+// none. The output of hhfab is returned when init fails.
+func (p *workspacePool) get(ctx context.Context, cfg *runtimeConfig) (*workspace, []byte, error) {
+	var ws *workspace
+	stale := []*workspace{}
+	p.mu.Lock()
+	for ws == nil && len(p.idle) > 0 {
+		last := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if last.reusable(cfg) {
+			ws = last
+		} else {
+			stale = append(stale, last)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, w := range stale {
+		w.remove()
+	}
+	if len(stale) > 0 {
+		go p.fill(cfg)
+	}
+	if ws != nil {
+		return ws, nil, nil
+	}
+	return newWorkspace(ctx, cfg)
+}
+
+// put resets a workspace after a validation and returns it to the pool.
+// Workspaces that cannot be reset, are due for a refresh or do not fit the
+// pool are removed.
+func (p *workspacePool) put(ws *workspace, cfg *runtimeConfig) {
+	ws.uses++
+	if !ws.reusable(cfg) {
+		ws.remove()
+		go p.fill(cfg)
+		return
+	}
+	if err := ws.reset(); err != nil {
+		log.Printf("Failed to reset workspace %s: %v", ws.dir, err)
+		ws.remove()
+		go p.fill(cfg)
+		return
+	}
+
+	p.mu.Lock()
+	if len(p.idle) < cfg.Workspaces.MaxIdle {
+		p.idle = append(p.idle, ws)
+		ws = nil
+	}
+	p.mu.Unlock()
+	if ws != nil {
+		ws.remove()
+	}
+}
+
+// drain removes the idle workspaces and returns how many there were.
+func (p *workspacePool) drain() int {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, ws := range idle {
+		ws.remove()
+	}
+	return len(idle)
+}
+
+// fill initializes workspaces until the pool holds its maximum of idle
+// ones. Run at startup, it has workspaces ready for the first requests.
+func (p *workspacePool) fill(cfg *runtimeConfig) {
+	for {
+		p.mu.Lock()
+		if len(p.idle)+p.pending >= cfg.Workspaces.MaxIdle {
+			p.mu.Unlock()
+			return
+		}
+		p.pending++
+		p.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout())
+		ws, output, err := newWorkspace(ctx, cfg)
+		cancel()
+
+		p.mu.Lock()
+		p.pending--
+		if err == nil {
+			p.idle = append(p.idle, ws)
+		}
+		p.mu.Unlock()
+		if err != nil {
+			// Validations initialize their own workspace and report the error
+			log.Printf("Failed to initialize a workspace: %v: %s", err, output)
+			return
+		}
+	}
+}
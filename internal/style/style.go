@@ -0,0 +1,152 @@
+// Package style checks the YAML hygiene of uploads the way yamllint does:
+// indentation, line length, truthy values and duplicate keys. hhfab accepts
+// files failing these checks, so they only ever warn; they keep the files
+// of a team consistent and catch values YAML 1.1 readers take for another
+// type.
+package style
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rules selects the checks and their limits, zero values disable a check.
+type Rules struct {
+	// Indentation is the spaces per level of block mappings and
+	// sequences; sequences may also start at the column of their key
+	Indentation int
+	// LineLength caps the characters of a line, lines of a single word
+	// such as URLs, or a key and a single word, excepted
+	LineLength int
+	// Truthy flags booleans spelled other than true and false, such as yes
+	// or On, which YAML 1.1 readers take for booleans and others for
+	// strings
+	Truthy bool
+	// DuplicateKeys flags keys given twice in a mapping, of which only the
+	// last counts
+	DuplicateKeys bool
+}
+
+// The names of the rules, as yamllint calls them.
+const (
+	RuleIndentation   = "indentation"
+	RuleLineLength    = "line-length"
+	RuleTruthy        = "truthy"
+	RuleDuplicateKeys = "key-duplicates"
+)
+
+// Finding is a line breaking a rule.
+type Finding struct {
+	Rule    string
+	Line    int
+	Column  int
+	Message string
+}
+
+// truthy are the plain scalars YAML 1.1 reads as booleans that are not
+// spelled true or false.
+var truthy = map[string]bool{
+	"yes": true, "Yes": true, "YES": true,
+	"no": true, "No": true, "NO": true,
+	"on": true, "On": true, "ON": true,
+	"off": true, "Off": true, "OFF": true,
+	"True": true, "TRUE": true,
+	"False": true, "FALSE": true,
+}
+
+// Check returns the findings of rules in a multi-document YAML file, by
+// line. Files that are not valid YAML are only checked for line length,
+// their syntax errors are reported elsewhere.
+func Check(data []byte, rules Rules) []Finding {
+	findings := []Finding{}
+	if rules.LineLength > 0 {
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, "\r")
+			length := utf8.RuneCountInString(line)
+			if length > rules.LineLength && breakable(line) {
+				findings = append(findings, Finding{
+					Rule:    RuleLineLength,
+					Line:    i + 1,
+					Column:  rules.LineLength + 1,
+					Message: fmt.Sprintf("line too long (%d > %d characters)", length, rules.LineLength),
+				})
+			}
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			break
+		}
+		for _, node := range doc.Content {
+			findings = append(findings, check(node, rules)...)
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].Column < findings[j].Column
+	})
+	return findings
+}
+
+// breakable reports whether a line holds more than a single word, such as
+// a URL, past its comment or sequence indicator and key.
+func breakable(line string) bool {
+	word := strings.TrimLeft(strings.TrimSpace(line), "#- ")
+	if key, value, found := strings.Cut(word, ": "); found && !strings.ContainsRune(key, ' ') {
+		word = strings.TrimSpace(value)
+	}
+	return strings.ContainsRune(word, ' ')
+}
+
+// check applies the rules to node and the nodes below it.
+func check(node *yaml.Node, rules Rules) []Finding {
+	findings := []Finding{}
+	block := node.Style&yaml.FlowStyle == 0
+	switch node.Kind {
+	case yaml.MappingNode:
+		seen := map[string]bool{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if rules.DuplicateKeys && key.Kind == yaml.ScalarNode {
+				if seen[key.Value] {
+					findings = append(findings, Finding{Rule: RuleDuplicateKeys, Line: key.Line, Column: key.Column, Message: fmt.Sprintf("duplication of key %q in mapping", key.Value)})
+				}
+				seen[key.Value] = true
+			}
+			if rules.Indentation > 0 && block && value.Line > key.Line && value.Style&yaml.FlowStyle == 0 {
+				expected := key.Column + rules.Indentation
+				switch {
+				case value.Kind == yaml.MappingNode && value.Column != expected,
+					value.Kind == yaml.SequenceNode && value.Column != expected && value.Column != key.Column:
+					findings = append(findings, Finding{
+						Rule:    RuleIndentation,
+						Line:    value.Line,
+						Column:  value.Column,
+						Message: fmt.Sprintf("wrong indentation: expected %d but found %d", expected-1, value.Column-1),
+					})
+				}
+			}
+			findings = append(findings, check(value, rules)...)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			findings = append(findings, check(item, rules)...)
+		}
+	case yaml.ScalarNode:
+		if rules.Truthy && node.Style == 0 && truthy[node.Value] {
+			findings = append(findings, Finding{Rule: RuleTruthy, Line: node.Line, Column: node.Column, Message: fmt.Sprintf("truthy value %s should be true or false", node.Value)})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,253 @@
+package topology
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var dotShapes = map[string]string{
+	"Switch": "box",
+	"Server": "ellipse",
+}
+
+func writeDOT(w io.Writer, graph *Graph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "graph wiring {")
+	fmt.Fprintln(out, "  node [fontname=\"Helvetica\"];")
+	for _, node := range graph.Nodes {
+		shape, ok := dotShapes[node.Kind]
+		if !ok {
+			shape = "diamond"
+		}
+		attrs := fmt.Sprintf("label=%s, shape=%s", dotQuote(node.label()), shape)
+		if node.Missing {
+			attrs += ", style=dashed, color=red"
+		}
+		fmt.Fprintf(out, "  %s [%s];\n", dotQuote(node.Key()), attrs)
+	}
+	for _, edge := range graph.Edges {
+		attrs := fmt.Sprintf("label=%s, tooltip=%s", dotQuote(edge.Type), dotQuote(edge.Connection))
+		if edge.FromPort != "" {
+			attrs += ", taillabel=" + dotQuote(edge.FromPort)
+		}
+		if edge.ToPort != "" {
+			attrs += ", headlabel=" + dotQuote(edge.ToPort)
+		}
+		fmt.Fprintf(out, "  %s -- %s [%s];\n", dotQuote(edge.From), dotQuote(edge.To), attrs)
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func writeMermaid(w io.Writer, graph *Graph) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "graph TD")
+
+	// Mermaid IDs must be plain words, number the nodes instead
+	ids := map[string]string{}
+	for i, node := range graph.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.Key()] = id
+
+		label := mermaidQuote(node.label())
+		switch node.Kind {
+		case "Switch":
+			fmt.Fprintf(out, "  %s[%s]\n", id, label)
+		case "Server":
+			fmt.Fprintf(out, "  %s(%s)\n", id, label)
+		default:
+			fmt.Fprintf(out, "  %s{{%s}}\n", id, label)
+		}
+		if node.Missing {
+			fmt.Fprintf(out, "  class %s missing\n", id)
+		}
+	}
+	for _, edge := range graph.Edges {
+		label := edge.FromPort
+		if edge.ToPort != "" {
+			label += " - " + edge.ToPort
+		}
+		if label == "" {
+			label = edge.Type
+		}
+		fmt.Fprintf(out, "  %s ---|%s| %s\n", ids[edge.From], mermaidQuote(label), ids[edge.To])
+	}
+	fmt.Fprintln(out, "  classDef missing stroke:#d00,stroke-dasharray:4")
+	return out.Flush()
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// label is the text shown for a node.
+func (n *Node) label() string {
+	if n.Role != "" {
+		return n.Name + " (" + n.Role + ")"
+	}
+	return n.Name
+}
+
+// SVG layout: one row per rank, spines at the top, in pixels.
+const (
+	svgNodeWidth  = 150
+	svgNodeHeight = 36
+	svgGapX       = 20
+	svgGapY       = 90
+	svgMargin     = 20
+)
+
+var svgStrokes = map[string]string{
+	"Switch": "#1f5fa8",
+	"Server": "#2e7d32",
+}
+
+// svgMissingStroke outlines devices that are not defined, dashed.
+const svgMissingStroke = "#d00"
+
+// point is the centre of a node in the layout.
+type point struct{ x, y int }
+
+// layout places the nodes of graph on one row per rank, centred, and returns
+// their centres by key and the size of the drawing.
+func layout(graph *Graph) (centres map[string]point, width, height int) {
+	rows := [][]*Node{}
+	ranks := map[int]int{}
+	for _, node := range graph.Nodes {
+		r := rank(node)
+		row, ok := ranks[r]
+		if !ok {
+			row = len(rows)
+			ranks[r] = row
+			rows = append(rows, nil)
+		}
+		rows[row] = append(rows[row], node)
+	}
+
+	columns := 1
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	width = 2*svgMargin + columns*svgNodeWidth + (columns-1)*svgGapX
+	height = 2*svgMargin + max(len(rows), 1)*svgNodeHeight + max(len(rows)-1, 0)*svgGapY
+
+	centres = map[string]point{}
+	for i, row := range rows {
+		rowWidth := len(row)*svgNodeWidth + (len(row)-1)*svgGapX
+		left := (width - rowWidth) / 2
+		for j, node := range row {
+			centres[node.Key()] = point{
+				x: left + j*(svgNodeWidth+svgGapX) + svgNodeWidth/2,
+				y: svgMargin + i*(svgNodeHeight+svgGapY) + svgNodeHeight/2,
+			}
+		}
+	}
+	return centres, width, height
+}
+
+// writeSVG lays the graph out without Graphviz, for documents that cannot
+// run a renderer, such as standalone HTML reports. Edges are straight lines
+// between the rows, their ports and connection shown as tooltips.
+func writeSVG(w io.Writer, graph *Graph) error {
+	centres, width, height := layout(graph)
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif" font-size="12">`+"\n", width, height, width, height)
+	for _, edge := range graph.Edges {
+		from, to := centres[edge.From], centres[edge.To]
+		title := edge.Connection + " (" + edge.Type + ")"
+		if edge.FromPort != "" || edge.ToPort != "" {
+			title += ": " + edge.FromPort + " - " + edge.ToPort
+		}
+		fmt.Fprintf(out, `  <line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999" stroke-width="1.5"><title>%s</title></line>`+"\n",
+			from.x, from.y, to.x, to.y, svgEscape(title))
+	}
+	for _, node := range graph.Nodes {
+		centre := centres[node.Key()]
+		stroke, ok := svgStrokes[node.Kind]
+		if !ok {
+			stroke = "#6d6d6d"
+		}
+		attrs := fmt.Sprintf(`stroke="%s" stroke-width="1.5" fill="#fff"`, stroke)
+		if node.Missing {
+			attrs = fmt.Sprintf(`stroke="%s" stroke-width="1.5" stroke-dasharray="4" fill="#fff"`, svgMissingStroke)
+		}
+		radius := 0
+		switch node.Kind {
+		case "Server":
+			radius = svgNodeHeight / 2
+		case "Switch":
+			radius = 3
+		}
+		fmt.Fprintf(out, `  <g><title>%s</title><rect x="%d" y="%d" width="%d" height="%d" rx="%d" %s/>`,
+			svgEscape(node.Key()), centre.x-svgNodeWidth/2, centre.y-svgNodeHeight/2, svgNodeWidth, svgNodeHeight, radius, attrs)
+		fmt.Fprintf(out, `<text x="%d" y="%d" text-anchor="middle" dominant-baseline="central">%s</text></g>`+"\n",
+			centre.x, centre.y, svgEscape(node.label()))
+	}
+	fmt.Fprintln(out, "</svg>")
+	return out.Flush()
+}
+
+var svgEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&#39;")
+
+func svgEscape(s string) string {
+	return svgEscaper.Replace(s)
+}
+
+// writeDrawIO writes the layout of writeSVG as an uncompressed draw.io
+// diagram, for design documents that edit the drawing further. Ports and
+// connections are tooltips as in SVG.
+func writeDrawIO(w io.Writer, graph *Graph) error {
+	centres, width, height := layout(graph)
+	ids := map[string]string{}
+	for i, node := range graph.Nodes {
+		ids[node.Key()] = fmt.Sprintf("node-%d", i+1)
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, `<mxfile host="hh-validator">`)
+	fmt.Fprintln(out, `  <diagram id="topology" name="Topology">`)
+	fmt.Fprintf(out, `    <mxGraphModel dx="%d" dy="%d" grid="1" gridSize="10" page="1" pageWidth="%d" pageHeight="%d">`+"\n", width, height, width, height)
+	fmt.Fprintln(out, `      <root>`)
+	fmt.Fprintln(out, `        <mxCell id="0"/>`)
+	fmt.Fprintln(out, `        <mxCell id="1" parent="0"/>`)
+	for _, node := range graph.Nodes {
+		centre := centres[node.Key()]
+		stroke, ok := svgStrokes[node.Kind]
+		if !ok {
+			stroke = "#6d6d6d"
+		}
+		style := "whiteSpace=wrap;fillColor=#ffffff;strokeWidth=1.5;"
+		switch node.Kind {
+		case "Server":
+			style += "rounded=1;arcSize=50;"
+		case "Switch":
+			style += "rounded=1;arcSize=8;"
+		}
+		if node.Missing {
+			stroke = svgMissingStroke
+			style += "dashed=1;"
+		}
+		fmt.Fprintf(out, `        <UserObject id="%s" label="%s" tooltip="%s"><mxCell style="%sstrokeColor=%s;" vertex="1" parent="1"><mxGeometry x="%d" y="%d" width="%d" height="%d" as="geometry"/></mxCell></UserObject>`+"\n",
+			ids[node.Key()], svgEscape(node.label()), svgEscape(node.Key()), style, stroke,
+			centre.x-svgNodeWidth/2, centre.y-svgNodeHeight/2, svgNodeWidth, svgNodeHeight)
+	}
+	for i, edge := range graph.Edges {
+		title := edge.Connection + " (" + edge.Type + ")"
+		if edge.FromPort != "" || edge.ToPort != "" {
+			title += ": " + edge.FromPort + " - " + edge.ToPort
+		}
+		fmt.Fprintf(out, `        <UserObject id="edge-%d" label="" tooltip="%s"><mxCell style="endArrow=none;strokeColor=#999999;strokeWidth=1.5;" edge="1" parent="1" source="%s" target="%s"><mxGeometry relative="1" as="geometry"/></mxCell></UserObject>`+"\n",
+			i+1, svgEscape(title), ids[edge.From], ids[edge.To])
+	}
+	fmt.Fprintln(out, `      </root>`)
+	fmt.Fprintln(out, `    </mxGraphModel>`)
+	fmt.Fprintln(out, `  </diagram>`)
+	fmt.Fprintln(out, `</mxfile>`)
+	return out.Flush()
+}
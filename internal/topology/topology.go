@@ -0,0 +1,167 @@
+// Package topology turns wiring diagrams into graphs of their switches,
+// servers and connections, rendered as Graphviz DOT, Mermaid, SVG or
+// draw.io.
+package topology
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"validator/internal/wiring"
+)
+
+// Output formats of Write.
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatSVG     = "svg"
+	FormatDrawIO  = "drawio"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{FormatDOT, FormatMermaid, FormatSVG, FormatDrawIO}
+
+// External is the node kind standing for the far end of links leaving the
+// fabric, the other kinds are the wiring kinds Switch and Server.
+const External = "External"
+
+// Node is a device of the fabric.
+type Node struct {
+	Kind string
+	Name string
+	// Role is the switch role, e.g. spine or server-leaf
+	Role string
+	// Missing is set for devices that connections refer to but that are not
+	// defined
+	Missing bool
+}
+
+// Key identifies the node, e.g. Switch/leaf-01.
+func (n *Node) Key() string {
+	return n.Kind + "/" + n.Name
+}
+
+// Edge is one link of a connection.
+type Edge struct {
+	From, To         string
+	FromPort, ToPort string
+	// Connection is the name of the Connection, Type its type, e.g. fabric
+	Connection string
+	Type       string
+}
+
+// Graph is the topology of a fabric. Nodes are sorted by rank and name,
+// edges follow the order of the connections.
+type Graph struct {
+	Nodes []*Node
+	Edges []Edge
+}
+
+// Build collects the devices and links of a wiring diagram.
+func Build(objects []*wiring.Object) *Graph {
+	nodes := map[string]*Node{}
+	add := func(node *Node) *Node {
+		if existing := nodes[node.Key()]; existing != nil {
+			return existing
+		}
+		nodes[node.Key()] = node
+		return node
+	}
+
+	for _, object := range objects {
+		switch object.Kind {
+		case "Switch":
+			add(&Node{Kind: object.Kind, Name: object.Name, Role: wiring.Scalar(object.Node, "spec", "role")})
+		case "Server":
+			add(&Node{Kind: object.Kind, Name: object.Name})
+		}
+	}
+
+	graph := &Graph{Edges: []Edge{}}
+	for _, object := range objects {
+		if object.Kind != "Connection" {
+			continue
+		}
+		connectionType := wiring.ConnectionType(object)
+
+		// Endpoints of the same link are the two ends of one cable
+		links := map[string][]wiring.Endpoint{}
+		order := []string{}
+		for _, endpoint := range wiring.Endpoints(object) {
+			if links[endpoint.Link] == nil {
+				order = append(order, endpoint.Link)
+			}
+			links[endpoint.Link] = append(links[endpoint.Link], endpoint)
+		}
+
+		for _, link := range order {
+			ends := links[link]
+			if !ends[0].Valid() || len(ends) > 1 && !ends[1].Valid() {
+				// Malformed ports are reported by the checks, not drawn
+				continue
+			}
+			from := add(&Node{Kind: ends[0].Kind, Name: ends[0].Device, Missing: true})
+			edge := Edge{
+				From:       from.Key(),
+				FromPort:   ends[0].Port,
+				Connection: object.Name,
+				Type:       connectionType,
+			}
+			if len(ends) > 1 {
+				to := add(&Node{Kind: ends[1].Kind, Name: ends[1].Device, Missing: true})
+				edge.To, edge.ToPort = to.Key(), ends[1].Port
+			} else {
+				to := add(&Node{Kind: External, Name: object.Name})
+				edge.To = to.Key()
+			}
+			// Point edges downwards, spines to leaves to servers
+			if rank(nodes[edge.To]) < rank(nodes[edge.From]) {
+				edge.From, edge.To = edge.To, edge.From
+				edge.FromPort, edge.ToPort = edge.ToPort, edge.FromPort
+			}
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		if a, b := rank(graph.Nodes[i]), rank(graph.Nodes[j]); a != b {
+			return a < b
+		}
+		return graph.Nodes[i].Name < graph.Nodes[j].Name
+	})
+	return graph
+}
+
+// rank is the layer of a node from the top: spines, other switches, servers
+// and external peers.
+func rank(node *Node) int {
+	switch {
+	case node.Kind == "Switch" && node.Role == "spine":
+		return 0
+	case node.Kind == "Switch":
+		return 1
+	case node.Kind == "Server":
+		return 2
+	}
+	return 3
+}
+
+// Write renders the graph in the given format.
+func Write(w io.Writer, graph *Graph, format string) error {
+	switch format {
+	case FormatDOT:
+		return writeDOT(w, graph)
+	case FormatMermaid:
+		return writeMermaid(w, graph)
+	case FormatSVG:
+		return writeSVG(w, graph)
+	case FormatDrawIO:
+		return writeDrawIO(w, graph)
+	}
+	return fmt.Errorf("unsupported graph format %q, must be one of: %s", format, strings.Join(Formats, ", "))
+}
@@ -0,0 +1,180 @@
+package wiring
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Conversion types.
+const (
+	Upgraded  = "upgraded"
+	Renamed   = "renamed"
+	Defaulted = "defaulted"
+)
+
+// Conversion is one change Convert made to an object. Upgraded changes of
+// apiVersion go From one version To the next; Renamed fields moved From the old
+// path to Path; Defaulted fields were set To a value at Path.
+type Conversion struct {
+	Object string `json:"object" yaml:"object"`
+	Type   string `json:"type" yaml:"type"`
+	Path   string `json:"path" yaml:"path"`
+	From   string `json:"from,omitempty" yaml:"from,omitempty"`
+	To     string `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+// migration upgrades objects from one API version to the next.
+type migration struct {
+	from, to string
+	// renames and defaults are by kind
+	renames  map[string][]rename
+	defaults map[string][]fieldDefault
+}
+
+// rename moves a field. A scalar moving to a list field becomes its only
+// item.
+type rename struct {
+	from, to string
+	list     bool
+}
+
+// fieldDefault sets a field the newer version requires when it is missing.
+type fieldDefault struct {
+	path, value string
+}
+
+var migrations = []migration{
+	{
+		from: "wiring.githedgehog.com/v1alpha2",
+		to:   "wiring.githedgehog.com/v1beta1",
+		renames: map[string][]rename{
+			"Switch": {
+				{from: "spec.vlanNamespace", to: "spec.vlanNamespaces", list: true},
+			},
+		},
+	},
+	{
+		from: "vpc.githedgehog.com/v1alpha2",
+		to:   "vpc.githedgehog.com/v1beta1",
+		defaults: map[string][]fieldDefault{
+			"VPC": {
+				{path: "spec.ipv4Namespace", value: "default"},
+				{path: "spec.vlanNamespace", value: "default"},
+			},
+		},
+	},
+}
+
+// Replacement returns the API version superseding a deprecated one, or "" if
+// apiVersion is current.
+func Replacement(apiVersion string) string {
+	for _, m := range migrations {
+		if m.from == apiVersion {
+			return m.to
+		}
+	}
+	return ""
+}
+
+// Convert upgrades the objects of a multi-document YAML file from deprecated
+// API versions to the current ones, renaming moved fields and setting fields
+// the newer versions require. The result is in canonical form, see Format;
+// the conversions are listed in document order.
+func Convert(data []byte, file string) ([]byte, []Conversion, error) {
+	conversions := []Conversion{}
+	out, err := rewrite(data, file, func(root *yaml.Node) {
+		conversions = append(conversions, convertObject(root)...)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, conversions, nil
+}
+
+// convertObject applies the migrations from the object's API version on.
+func convertObject(root *yaml.Node) []Conversion {
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	kind := Scalar(root, "kind")
+	object := &Object{Kind: kind, Name: Scalar(root, "metadata", "name"), Namespace: Scalar(root, "metadata", "namespace")}
+	key := object.Key()
+
+	conversions := []Conversion{}
+	for _, m := range migrations {
+		version := Lookup(root, "apiVersion")
+		if version == nil || version.Value != m.from {
+			continue
+		}
+		version.Value = m.to
+		conversions = append(conversions, Conversion{Object: key, Type: Upgraded, Path: "apiVersion", From: m.from, To: m.to})
+
+		for _, r := range m.renames[kind] {
+			value := remove(root, strings.Split(r.from, "."))
+			if value == nil {
+				continue
+			}
+			if r.list && value.Kind == yaml.ScalarNode {
+				value = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{value}}
+			}
+			set(root, strings.Split(r.to, "."), value)
+			conversions = append(conversions, Conversion{Object: key, Type: Renamed, Path: r.to, From: r.from})
+		}
+		for _, d := range m.defaults[kind] {
+			path := strings.Split(d.path, ".")
+			if Lookup(root, path...) != nil {
+				continue
+			}
+			set(root, path, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: d.value})
+			conversions = append(conversions, Conversion{Object: key, Type: Defaulted, Path: d.path, To: d.value})
+		}
+	}
+	return conversions
+}
+
+// remove deletes the field at path and returns its value, or nil if there is
+// none.
+func remove(node *yaml.Node, path []string) *yaml.Node {
+	parent := Lookup(node, path[:len(path)-1]...)
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == path[len(path)-1] {
+			value := parent.Content[i+1]
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// set stores value at path, creating missing mappings on the way and
+// replacing empty values such as a bare spec:.
+func set(node *yaml.Node, path []string, value *yaml.Node) {
+	for i, key := range path {
+		if node.Kind != yaml.MappingNode {
+			*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		var next *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == key {
+				next = node.Content[j+1]
+				if i == len(path)-1 {
+					node.Content[j+1] = value
+					return
+				}
+				break
+			}
+		}
+		if next == nil {
+			next = value
+			if i < len(path)-1 {
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		}
+		node = next
+	}
+}
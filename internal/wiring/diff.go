@@ -0,0 +1,108 @@
+package wiring
+
+import "sort"
+
+// Change types of a diff.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// ObjectChange is how one object differs between two wiring diagrams.
+type ObjectChange struct {
+	Type      string        `json:"type" yaml:"type"`
+	Kind      string        `json:"kind" yaml:"kind"`
+	Name      string        `json:"name" yaml:"name"`
+	Namespace string        `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Fields    []FieldChange `json:"fields,omitempty" yaml:"fields,omitempty"`
+}
+
+// FieldChange is a leaf value that was added, removed or changed. Old is
+// empty for added fields, New for removed ones.
+type FieldChange struct {
+	Path string `json:"path" yaml:"path"`
+	Old  string `json:"old,omitempty" yaml:"old,omitempty"`
+	New  string `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// Diff compares two sets of objects by key. Changes are sorted by kind and
+// name; objects present on both sides with the same fields are left out.
+func Diff(before, after []*Object) []ObjectChange {
+	oldObjects := index(before)
+	newObjects := index(after)
+
+	keys := []string{}
+	for key := range oldObjects {
+		keys = append(keys, key)
+	}
+	for key := range newObjects {
+		if oldObjects[key] == nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []ObjectChange{}
+	for _, key := range keys {
+		oldObject, newObject := oldObjects[key], newObjects[key]
+		object := newObject
+		if object == nil {
+			object = oldObject
+		}
+		change := ObjectChange{Kind: object.Kind, Name: object.Name, Namespace: object.Namespace}
+
+		switch {
+		case oldObject == nil:
+			change.Type = Added
+		case newObject == nil:
+			change.Type = Removed
+		default:
+			change.Type = Changed
+			change.Fields = diffFields(Flatten(oldObject.Node), Flatten(newObject.Node))
+			if len(change.Fields) == 0 {
+				continue
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// index maps objects by key, a later duplicate replaces an earlier one as
+// hhfab would reject the file anyway.
+func index(objects []*Object) map[string]*Object {
+	byKey := map[string]*Object{}
+	for _, object := range objects {
+		byKey[object.Key()] = object
+	}
+	return byKey
+}
+
+func diffFields(before, after []Field) []FieldChange {
+	oldValues := map[string]string{}
+	for _, field := range before {
+		oldValues[field.Path] = field.Value
+	}
+	newValues := map[string]string{}
+	for _, field := range after {
+		newValues[field.Path] = field.Value
+	}
+
+	changes := []FieldChange{}
+	for _, field := range before {
+		if value, ok := newValues[field.Path]; !ok {
+			changes = append(changes, FieldChange{Path: field.Path, Old: field.Value})
+		} else if value != field.Value {
+			changes = append(changes, FieldChange{Path: field.Path, Old: field.Value, New: value})
+		}
+	}
+	for _, field := range after {
+		if _, ok := oldValues[field.Path]; !ok {
+			changes = append(changes, FieldChange{Path: field.Path, New: field.Value})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
@@ -0,0 +1,84 @@
+package wiring
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// endpointKinds maps the keys of Connection endpoints to the kind of object
+// their port refers to, e.g. spec.unbundled.link.server.port names a Server.
+var endpointKinds = map[string]string{
+	"server":  "Server",
+	"switch":  "Switch",
+	"switch1": "Switch",
+	"switch2": "Switch",
+	"spine":   "Switch",
+	"leaf":    "Switch",
+	"leaf1":   "Switch",
+	"leaf2":   "Switch",
+}
+
+// Endpoint is one end of a link of a Connection, a port written
+// <device>/<port>.
+type Endpoint struct {
+	// Kind is the kind of the device, Switch or Server
+	Kind   string
+	Device string
+	Port   string
+
+	// Link is the path of the link the endpoint belongs to, e.g.
+	// spec.bundled.links[0]; Path and Line locate the port field
+	Link  string
+	Path  string
+	Value string
+	Line  int
+}
+
+// Valid reports whether the port is written <device>/<port>.
+func (e Endpoint) Valid() bool {
+	return e.Device != "" && e.Port != ""
+}
+
+// ConnectionType returns the type of a Connection, the key below spec such
+// as unbundled or fabric.
+func ConnectionType(object *Object) string {
+	spec := Lookup(object.Node, "spec")
+	if spec == nil || spec.Kind != yaml.MappingNode || len(spec.Content) == 0 {
+		return ""
+	}
+	return spec.Content[0].Value
+}
+
+// Endpoints lists the endpoints of a Connection sorted by path.
+func Endpoints(object *Object) []Endpoint {
+	endpoints := []Endpoint{}
+	spec := Lookup(object.Node, "spec")
+	if spec == nil {
+		return endpoints
+	}
+	for _, field := range Flatten(spec) {
+		parent, ok := strings.CutSuffix("spec."+field.Path, ".port")
+		if !ok {
+			continue
+		}
+		dot := strings.LastIndex(parent, ".")
+		kind, ok := endpointKinds[parent[dot+1:]]
+		if !ok {
+			continue
+		}
+
+		endpoint := Endpoint{
+			Kind:  kind,
+			Link:  parent[:dot],
+			Path:  "spec." + field.Path,
+			Value: field.Value,
+			Line:  field.Line,
+		}
+		if device, port, found := strings.Cut(field.Value, "/"); found {
+			endpoint.Device, endpoint.Port = device, port
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
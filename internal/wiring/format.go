@@ -0,0 +1,146 @@
+package wiring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyOrder lists the keys that come first, in this order, in the mappings at
+// a path; all other keys follow sorted by name.
+var keyOrder = map[string][]string{
+	"":         {"apiVersion", "kind", "metadata", "spec", "status"},
+	"metadata": {"name", "namespace", "labels", "annotations"},
+}
+
+// unorderedLists are the paths of lists whose order carries no meaning. Format
+// sorts their items when they are all scalars.
+var unorderedLists = map[string]bool{
+	"spec.vlanNamespaces": true,
+	"spec.ipv4Namespaces": true,
+	"spec.groups":         true,
+	"spec.roles":          true,
+}
+
+// Format re-emits a multi-document YAML file in canonical form: keys in a
+// stable order, two-space block indentation, plain scalars where quoting is
+// not needed and unordered lists sorted. Comments are kept, empty documents
+// dropped. Formatting formatted output returns it unchanged.
+func Format(data []byte, file string) ([]byte, error) {
+	return rewrite(data, file, func(*yaml.Node) {})
+}
+
+// rewrite applies change to the root of every document and returns the
+// documents in canonical form.
+func rewrite(data []byte, file string, change func(root *yaml.Node)) ([]byte, error) {
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+		change(doc.Content[0])
+		canonicalize(doc.Content[0], "")
+		if err := enc.Encode(&doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return out.Bytes(), nil
+}
+
+// canonicalize rewrites node, found at path, in canonical form.
+func canonicalize(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		node.Style = 0
+		// A comment above the first key of a document is about the document
+		var head string
+		if path == "" && len(node.Content) > 0 {
+			head, node.Content[0].HeadComment = node.Content[0].HeadComment, ""
+		}
+		sortKeys(node, keyOrder[path])
+		if head != "" {
+			first := node.Content[0]
+			if first.HeadComment != "" {
+				head += "\n" + first.HeadComment
+			}
+			first.HeadComment = head
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			canonicalize(node.Content[i+1], key)
+		}
+	case yaml.SequenceNode:
+		node.Style = 0
+		for _, item := range node.Content {
+			canonicalize(item, path+"[]")
+		}
+		if unorderedLists[path] && scalars(node.Content) {
+			sort.SliceStable(node.Content, func(i, j int) bool {
+				return node.Content[i].Value < node.Content[j].Value
+			})
+		}
+	case yaml.ScalarNode:
+		// The encoder quotes strings that would read as another type
+		if node.Style == yaml.DoubleQuotedStyle || node.Style == yaml.SingleQuotedStyle {
+			node.Style = 0
+		}
+	}
+}
+
+// sortKeys orders the pairs of a mapping by the position of their key in
+// first, then by key.
+func sortKeys(node *yaml.Node, first []string) {
+	rank := func(key string) int {
+		for i, k := range first {
+			if k == key {
+				return i
+			}
+		}
+		return len(first)
+	}
+
+	pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		a, b := pairs[i][0].Value, pairs[j][0].Value
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		return a < b
+	})
+	node.Content = node.Content[:0]
+	for _, pair := range pairs {
+		node.Content = append(node.Content, pair[0], pair[1])
+	}
+}
+
+func scalars(nodes []*yaml.Node) bool {
+	for _, node := range nodes {
+		if node.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
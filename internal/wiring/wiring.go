@@ -0,0 +1,199 @@
+// Package wiring parses Hedgehog wiring diagrams into objects that keep
+// track of where they were defined, for the checks and tooling that look at
+// wiring files without running hhfab.
+package wiring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Object is one Kubernetes-style object of a wiring diagram.
+type Object struct {
+	APIVersion string
+	Kind       string
+	Name       string
+	Namespace  string
+
+	// File and Line locate the start of the object's document.
+	File string
+	Line int
+
+	// Node is the document's root mapping.
+	Node *yaml.Node
+
+	// Suppressions are the ignore comments anywhere in the document.
+	Suppressions []Suppression
+}
+
+// Suppression is a `# hh-validator:ignore CODE [reason]` comment
+// acknowledging the findings of CODE, an ID or name, on the object of its
+// document.
+type Suppression struct {
+	Code   string
+	Reason string
+	// Line is that of the node the comment is attached to
+	Line int
+}
+
+var suppressionComment = regexp.MustCompile(`^#\s*hh-validator:ignore\s+(\S+)\s*(.*)$`)
+
+// Key identifies the object within a fabric, e.g. Switch/spine-01.
+func (o *Object) Key() string {
+	if o.Namespace != "" {
+		return o.Kind + "/" + o.Namespace + "/" + o.Name
+	}
+	return o.Kind + "/" + o.Name
+}
+
+// Parse splits a multi-document wiring file into objects. Empty documents are
+// skipped, documents that are not mappings are an error.
+func Parse(data []byte, file string) ([]*Object, error) {
+	objects := []*Object{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return objects, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		root := doc.Content[0]
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s:%d: expected an object, found %s", file, root.Line, root.ShortTag())
+		}
+		object := &Object{
+			APIVersion: Scalar(root, "apiVersion"),
+			Kind:       Scalar(root, "kind"),
+			Name:       Scalar(root, "metadata", "name"),
+			Namespace:  Scalar(root, "metadata", "namespace"),
+			File:       file,
+			Line:       root.Line,
+			Node:       root,
+		}
+		object.Suppressions = suppressions(&doc)
+		objects = append(objects, object)
+	}
+}
+
+// suppressions collects the ignore comments of every node below node.
+func suppressions(node *yaml.Node) []Suppression {
+	found := []Suppression{}
+	for _, comment := range []string{node.HeadComment, node.LineComment, node.FootComment} {
+		for _, line := range strings.Split(comment, "\n") {
+			if m := suppressionComment.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+				found = append(found, Suppression{Code: m[1], Reason: strings.TrimSpace(m[2]), Line: node.Line})
+			}
+		}
+	}
+	for _, child := range node.Content {
+		found = append(found, suppressions(child)...)
+	}
+	return found
+}
+
+// Encode writes objects as a multi-document YAML file. Objects keep their
+// comments but not their original formatting.
+func Encode(objects []*Object) ([]byte, error) {
+	if len(objects) == 0 {
+		return []byte{}, nil
+	}
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	for _, object := range objects {
+		if err := enc.Encode(object.Node); err != nil {
+			return nil, fmt.Errorf("%s: %w", object.Key(), err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Lookup follows a path of mapping keys from node and returns the node found,
+// or nil.
+func Lookup(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+	return node
+}
+
+// Scalar returns the scalar value at path, or "" if there is none.
+func Scalar(node *yaml.Node, path ...string) string {
+	node = Lookup(node, path...)
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// Field is a leaf value of an object, addressed by its dotted path, e.g.
+// spec.ports[0].name.
+type Field struct {
+	Path  string
+	Value string
+	Line  int
+}
+
+// Flatten lists the leaf values below node sorted by path. Empty mappings
+// and sequences are leaves with the values {} and [].
+func Flatten(node *yaml.Node) []Field {
+	fields := []Field{}
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			if len(node.Content) == 0 {
+				fields = append(fields, Field{Path: path, Value: "{}", Line: node.Line})
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key := node.Content[i].Value
+				if path != "" {
+					key = path + "." + key
+				}
+				walk(node.Content[i+1], key)
+			}
+		case yaml.SequenceNode:
+			if len(node.Content) == 0 {
+				fields = append(fields, Field{Path: path, Value: "[]", Line: node.Line})
+			}
+			for i, item := range node.Content {
+				walk(item, path+"["+strconv.Itoa(i)+"]")
+			}
+		default:
+			fields = append(fields, Field{Path: path, Value: node.Value, Line: node.Line})
+		}
+	}
+	walk(node, "")
+
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+	return fields
+}
@@ -0,0 +1,80 @@
+package api
+
+// QueueState is the state of the validation queue of a replica, answered by
+// GET /admin/queue and the admin endpoints changing it.
+type QueueState struct {
+	// Paused is set while validations wait for POST /admin/queue/resume:
+	// synchronous ones are refused, queued jobs are not started
+	Paused bool `json:"paused"`
+	// Active and Workers are the validations running and the number that
+	// may run at once
+	Active  int `json:"active"`
+	Workers int `json:"workers"`
+	// Waiting are the requests waiting for a worker of the replica
+	Waiting int `json:"waiting"`
+	// Queued are the jobs waiting for a runner of any replica sharing the
+	// job queue
+	Queued int `json:"queued"`
+	// Running are the IDs of the validations running on the replica: job
+	// IDs for jobs, request IDs for synchronous validations
+	Running []string `json:"running"`
+	// Drained reports, for POST /admin/drain, whether the running
+	// validations finished before the timeout
+	Drained *bool `json:"drained,omitempty"`
+}
+
+// CacheFlush counts what POST /admin/cache/flush removed: the cached
+// results and the idle workspaces.
+type CacheFlush struct {
+	Results    int `json:"results"`
+	Workspaces int `json:"workspaces"`
+}
+
+// Cancellation answers POST /admin/jobs/:id/cancel for a validation that is
+// being cancelled.
+type Cancellation struct {
+	ID        string `json:"id"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+// HHFabReleases answers GET /admin/hhfab with the hhfab versions installed
+// in the release directory and those validations and canaries run, if any.
+type HHFabReleases struct {
+	Dir           string   `json:"dir"`
+	Installed     []string `json:"installed"`
+	Use           string   `json:"use,omitempty"`
+	CanaryVersion string   `json:"canary_version,omitempty"`
+}
+
+// HHFabInstall answers POST /admin/hhfab/install with where the release was
+// installed. Downloaded is false when it was installed already.
+type HHFabInstall struct {
+	Version    string `json:"version"`
+	Path       string `json:"path"`
+	Downloaded bool   `json:"downloaded"`
+}
+
+// SelfTest answers POST /selftest with the outcome of validating the bundled
+// fixtures. Passed is set when every fixture validated as expected, Error
+// names those that did not.
+type SelfTest struct {
+	Passed       bool              `json:"passed"`
+	HHFabVersion string            `json:"hhfab_version,omitempty"`
+	Fixtures     []SelfTestFixture `json:"fixtures"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// SelfTestFixture is the outcome of validating a fixture: Valid fixtures are
+// expected to succeed, the others to fail with the diagnostic code Expected.
+// Status and Code are what the validation answered, Error why it did not
+// pass.
+type SelfTestFixture struct {
+	Name       string `json:"name"`
+	Valid      bool   `json:"valid"`
+	Expected   string `json:"expected,omitempty"`
+	Passed     bool   `json:"passed"`
+	Status     int    `json:"status"`
+	Code       string `json:"code,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,198 @@
+// Package api holds the request and response schemas of the validator
+// service, shared by the server, the Go client and the CLI, and importable by
+// other integrations.
+package api
+
+// ModeSchemaOnly is the mode of validations run without hhfab.
+const ModeSchemaOnly = "schema-only"
+
+// MaxFileSize is the upload limit in bytes of servers configured without
+// one.
+const MaxFileSize = 10 * 1024 * 1024
+
+// ValidateResponse is the result of POST /validate.
+type ValidateResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Output  string `json:"output"`
+	UseCase string `json:"use_case"`
+	// Process tells how hhfab validate ran, unset when it did not
+	Process *Process `json:"process,omitempty"`
+	// Mode is schema-only when hhfab was not available and skipped
+	Mode string `json:"mode,omitempty"`
+	// Profile names the validation profile the wiring was checked with
+	Profile     string       `json:"profile,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Warnings repeats the diagnostics of warning severity, which do not fail
+	// validation
+	Warnings []Diagnostic `json:"warnings,omitempty"`
+	// Suppressed lists the diagnostics acknowledged by ignore comments, which
+	// neither fail validation nor count as warnings
+	Suppressed []Diagnostic `json:"suppressed,omitempty"`
+	// Baselined lists the diagnostics known to the baseline of the request,
+	// which do not fail validation either
+	Baselined []Diagnostic `json:"baselined,omitempty"`
+	// Cached is set when the result of an identical earlier request was
+	// returned
+	Cached bool `json:"cached,omitempty"`
+	// Coalesced is set when the result of an identical request validated at
+	// the same time was returned
+	Coalesced bool `json:"coalesced,omitempty"`
+	// Objects lists the objects of the uploaded files with their results
+	Objects []ObjectResult `json:"objects,omitempty"`
+	// Summary counts the findings once the files were validated
+	Summary *Summary `json:"summary,omitempty"`
+	// Shards is the number of hhfab runs a parallel validation was split
+	// into, unset when hhfab ran once
+	Shards int `json:"shards,omitempty"`
+	// Incremental counts the groups of objects an incremental validation
+	// reused earlier hhfab results for
+	Incremental *IncrementalResult `json:"incremental,omitempty"`
+	// Diagram is the topology diagram of a successful validation asked for
+	// with ?diagram=
+	Diagram *Diagram `json:"diagram,omitempty"`
+	// Limit names the upload limit a request answered with 413 exceeded
+	Limit *LimitExceeded `json:"limit,omitempty"`
+	// Rejected tells why an upload answered with 422 is not plausibly YAML
+	Rejected *UploadRejected `json:"rejected,omitempty"`
+	// Overload is set when the request was turned away to shed load
+	Overload *Overload `json:"overload,omitempty"`
+	// Idempotency is set when the Idempotency-Key of the request could not
+	// be replayed
+	Idempotency *IdempotencyConflict `json:"idempotency,omitempty"`
+	// ResultURL links to the result recorded in the history, for sharing
+	ResultURL string `json:"result_url,omitempty"`
+}
+
+// Process is the hhfab validate run of a validation: what it wrote to
+// stdout and to stderr, which Output interleaves, and how it exited. ExitCode
+// is -1 when hhfab was killed by a signal, as it is once TimedOut, when the
+// validation timeout fired before hhfab finished. The runs of a parallel
+// validation are reported together, their output in shard order and the
+// exit of the first that failed.
+type Process struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	Signal   string `json:"signal,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+}
+
+// Overload tells a client turned away by load shedding how many requests
+// were waiting for a worker and when to retry, as does the Retry-After
+// header.
+type Overload struct {
+	Waiting       int `json:"waiting"`
+	ShedQueue     int `json:"shed_queue"`
+	RetryAfterSec int `json:"retry_after_seconds"`
+}
+
+// LimitExceeded is an upload limit a request exceeded. Field is the form
+// field, bundle for the wiring files together or request for the whole
+// request body; File names the upload that crossed the limit.
+type LimitExceeded struct {
+	Field string `json:"field"`
+	File  string `json:"file,omitempty"`
+	Limit int64  `json:"limit"`
+}
+
+// Reasons uploads are rejected for.
+const (
+	// RejectedBinary uploads are no UTF-8 text or hold control characters
+	RejectedBinary = "binary"
+	// RejectedNUL uploads hold NUL bytes
+	RejectedNUL = "nul"
+	// RejectedDepth uploads nest collections deeper than the limit
+	RejectedDepth = "depth"
+	// RejectedAliases uploads hold more anchors and aliases than the limit
+	RejectedAliases = "aliases"
+)
+
+// UploadRejected is why an upload is not plausibly YAML. Field is the form
+// field and File the upload, Line the line it was noticed on and Limit the
+// depth or number of anchors and aliases exceeded.
+type UploadRejected struct {
+	Field  string `json:"field"`
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+	Line   int    `json:"line,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Summary counts the diagnostics and objects of a validation, so clients can
+// gate on them without parsing the output.
+type Summary struct {
+	Errors     int   `json:"errors" yaml:"errors"`
+	Warnings   int   `json:"warnings" yaml:"warnings"`
+	Suppressed int   `json:"suppressed" yaml:"suppressed"`
+	Baselined  int   `json:"baselined" yaml:"baselined"`
+	Objects    int   `json:"objects" yaml:"objects"`
+	DurationMs int64 `json:"duration_ms" yaml:"duration_ms"`
+}
+
+// IncrementalResult tells how many groups of related objects an incremental
+// validation found, and for how many it reused the hhfab results of an
+// earlier validation instead of running hhfab.
+type IncrementalResult struct {
+	Groups int `json:"groups"`
+	Reused int `json:"reused"`
+}
+
+// Diagram is a topology diagram of the validated wiring in Format, such as
+// svg or drawio. Content is base64 in JSON.
+type Diagram struct {
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// Diagnostic is a single finding reported by a validation. Code is a stable
+// identifier from the codes catalog, see GET /explain/:code. File and Line
+// point into the uploaded files, named as uploaded, when the finding could be
+// attributed to one, Object and Path to the offending object and field if
+// known.
+type Diagnostic struct {
+	Severity string `json:"severity" yaml:"severity"`
+	Code     string `json:"code,omitempty" yaml:"code,omitempty"`
+	Message  string `json:"message" yaml:"message"`
+	Source   string `json:"source" yaml:"source"`
+	File     string `json:"file,omitempty" yaml:"file,omitempty"`
+	Line     int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Object   string `json:"object,omitempty" yaml:"object,omitempty"`
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Reason is the justification of the comment suppressing the diagnostic
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// ObjectResult is the result of one object of a validation.
+type ObjectResult struct {
+	Kind      string `json:"kind" yaml:"kind"`
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	File      string `json:"file" yaml:"file"`
+	Line      int    `json:"line" yaml:"line"`
+	Status    string `json:"status" yaml:"status"`
+	// Messages are the diagnostics attributed to the object
+	Messages []string `json:"messages,omitempty" yaml:"messages,omitempty"`
+}
+
+// Object statuses. Objects are unknown when the validation failed with errors
+// that could not be attributed to any object, hhfab stops at the first one.
+const (
+	ObjectPassed  = "passed"
+	ObjectWarning = "warning"
+	ObjectFailed  = "failed"
+	ObjectUnknown = "unknown"
+)
+
+// Diagnostic severities and sources.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+
+	SourceHHFab       = "hhfab"
+	SourceValidator   = "validator"
+	SourceSchema      = "schema"
+	SourceKubeconform = "kubeconform"
+)
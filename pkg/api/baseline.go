@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BaselineVersion is the version of the baseline format.
+const BaselineVersion = 1
+
+// Baseline is a set of known findings. Validations given one only fail on
+// findings it does not list, so new checks can be rolled out over existing
+// wiring and the known findings fixed over time.
+type Baseline struct {
+	Version  int             `json:"version" yaml:"version"`
+	Findings []BaselineEntry `json:"findings" yaml:"findings"`
+}
+
+// BaselineEntry identifies a finding by code, object and field, which stay
+// the same when lines move or messages are reworded. Findings without an
+// object are identified by their message, which is kept for reviewers
+// otherwise.
+type BaselineEntry struct {
+	Code    string `json:"code" yaml:"code"`
+	Object  string `json:"object,omitempty" yaml:"object,omitempty"`
+	Path    string `json:"path,omitempty" yaml:"path,omitempty"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// NewBaseline returns the baseline of diagnostics, sorted and without
+// duplicates so that regenerating it gives small diffs.
+func NewBaseline(diagnostics []Diagnostic) *Baseline {
+	baseline := &Baseline{Version: BaselineVersion, Findings: []BaselineEntry{}}
+	seen := map[BaselineEntry]bool{}
+	for _, d := range diagnostics {
+		entry := BaselineEntry{Code: d.Code, Object: d.Object, Path: d.Path, Message: d.Message}
+		if key := entry.Key(); !seen[key] {
+			seen[key] = true
+			baseline.Findings = append(baseline.Findings, entry)
+		}
+	}
+	sort.Slice(baseline.Findings, func(i, j int) bool {
+		a, b := baseline.Findings[i], baseline.Findings[j]
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		if a.Code != b.Code {
+			return a.Code < b.Code
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Message < b.Message
+	})
+	return baseline
+}
+
+// ParseBaseline reads a baseline written as YAML or JSON.
+func ParseBaseline(data []byte) (*Baseline, error) {
+	baseline := &Baseline{}
+	if err := yaml.Unmarshal(data, baseline); err != nil {
+		return nil, err
+	}
+	if baseline.Version != BaselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d, expected %d", baseline.Version, BaselineVersion)
+	}
+	return baseline, nil
+}
+
+// Key is what entries are matched by: findings of objects by their code,
+// object and field, the others by their message too.
+func (e BaselineEntry) Key() BaselineEntry {
+	if e.Object != "" {
+		e.Message = ""
+	}
+	return e
+}
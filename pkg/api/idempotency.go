@@ -0,0 +1,25 @@
+package api
+
+// IdempotencyKeyHeader names a validation, so that sending it again, such
+// as from a retried CI step, answers with the result of the first request
+// instead of running it twice. IdempotentReplayedHeader is set on such
+// answers.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Reasons a request with an Idempotency-Key is turned away.
+const (
+	// IdempotencyMismatch: the key was used for a different request
+	IdempotencyMismatch = "mismatch"
+	// IdempotencyPending: the first request with the key still runs
+	IdempotencyPending = "pending"
+)
+
+// IdempotencyConflict tells why the Idempotency-Key of a request answered
+// with 409 or 422 could not be replayed.
+type IdempotencyConflict struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
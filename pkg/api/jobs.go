@@ -0,0 +1,116 @@
+package api
+
+import "time"
+
+// Job states.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+)
+
+// Job is an asynchronous validation, submitted with POST /validate?async=true
+// and polled with GET /jobs/:id.
+type Job struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// HTTPStatus is the status code the validation would have been answered
+	// with synchronously, set with Result once the job is done
+	HTTPStatus int               `json:"http_status,omitempty"`
+	Result     *ValidateResponse `json:"result,omitempty"`
+	// Tenant is the tenant that submitted the job, the only one seeing it
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// StreamContentType is the content type of streamed validations.
+const StreamContentType = "application/x-ndjson"
+
+// Stream event types.
+const (
+	StreamOutput = "output"
+	StreamResult = "result"
+)
+
+// StreamEvent is one line of a streamed validation (POST /validate?stream=true).
+// Output events carry hhfab output lines as they are printed, the final
+// result event carries the response and the status code it would have been
+// sent with, since the stream itself always starts with 200.
+type StreamEvent struct {
+	Type   string            `json:"type"`
+	Line   string            `json:"line,omitempty"`
+	Status int               `json:"status,omitempty"`
+	Result *ValidateResponse `json:"result,omitempty"`
+}
+
+// HistoryEntry records a finished validation, listed by GET /history.
+// Listings leave out Result, the response the validation was answered with.
+type HistoryEntry struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Status is the HTTP status code the validation was answered with
+	Status  int    `json:"status"`
+	Success bool   `json:"success"`
+	UseCase string `json:"use_case"`
+	Mode    string `json:"mode,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	// Tenant is the tenant of the validation, empty for the default one in
+	// entries recorded before tenants
+	Tenant string `json:"tenant,omitempty"`
+	// Files names the uploaded wiring files and the fab file
+	Files    []string `json:"files"`
+	Errors   int      `json:"errors"`
+	Warnings int      `json:"warnings"`
+	// Codes are the distinct codes of the diagnostics
+	Codes      []string          `json:"codes,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	Cached     bool              `json:"cached,omitempty"`
+	JobID      string            `json:"job_id,omitempty"`
+	Result     *ValidateResponse `json:"result,omitempty"`
+}
+
+// HistoryResponse is a page of GET /history. NextCursor continues the listing
+// with ?cursor= and is unset on the last page.
+type HistoryResponse struct {
+	Entries    []HistoryEntry `json:"entries"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// StatsResponse rolls up the history between Since and Until for GET /stats.
+type StatsResponse struct {
+	Since       time.Time `json:"since"`
+	Until       time.Time `json:"until"`
+	Validations int       `json:"validations"`
+	Failed      int       `json:"failed"`
+	Cached      int       `json:"cached"`
+	// FailureRate is the share of validations that failed, 0 without any
+	FailureRate    float64 `json:"failure_rate"`
+	MeanDurationMs int64   `json:"mean_duration_ms"`
+	// Days counts the validations of every UTC day of the period, oldest
+	// first, including days without any
+	Days []DayStats `json:"days"`
+	// TopCodes are the diagnostic codes found by the most validations
+	TopCodes []CodeStats `json:"top_codes"`
+	// UseCases and Profiles count the validations by use case and by
+	// profile
+	UseCases map[string]int `json:"use_cases"`
+	Profiles map[string]int `json:"profiles"`
+	// Tenants counts the validations by tenant, of every tenant only for
+	// admins of the default tenant
+	Tenants map[string]int `json:"tenants"`
+}
+
+// DayStats counts the validations of a day, formatted 2006-01-02.
+type DayStats struct {
+	Date        string `json:"date"`
+	Validations int    `json:"validations"`
+	Failed      int    `json:"failed"`
+}
+
+// CodeStats counts the validations that found a diagnostic code.
+type CodeStats struct {
+	Code        string `json:"code"`
+	Validations int    `json:"validations"`
+}
@@ -0,0 +1,35 @@
+package api
+
+// ProblemContentType is the media type of the problem documents (RFC 7807)
+// every response other than 2xx is answered with.
+const ProblemContentType = "application/problem+json"
+
+// Types of problems, which name the kind of failure for clients to branch
+// on; Problem.Title describes it for people.
+const (
+	ProblemValidationFailed = "urn:hh-validator:problem:validation-failed"
+	ProblemInvalidRequest   = "urn:hh-validator:problem:invalid-request"
+	ProblemUnauthorized     = "urn:hh-validator:problem:unauthorized"
+	ProblemForbidden        = "urn:hh-validator:problem:forbidden"
+	ProblemNotFound         = "urn:hh-validator:problem:not-found"
+	ProblemUploadTooLarge   = "urn:hh-validator:problem:upload-too-large"
+	ProblemImplausible      = "urn:hh-validator:problem:implausible-upload"
+	ProblemRateLimited      = "urn:hh-validator:problem:rate-limited"
+	ProblemOverloaded       = "urn:hh-validator:problem:overloaded"
+	ProblemIdempotency      = "urn:hh-validator:problem:idempotency-conflict"
+	ProblemConflict         = "urn:hh-validator:problem:conflict"
+	ProblemUnavailable      = "urn:hh-validator:problem:unavailable"
+	ProblemInternal         = "urn:hh-validator:problem:internal"
+)
+
+// Problem holds the members every problem document has. Documents extend
+// them with the members of the response they stand for, such as the
+// diagnostics of a failed validation, which decode into that response.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance is the ID of the request, as in its X-Request-ID header
+	Instance string `json:"instance,omitempty"`
+}
@@ -0,0 +1,14 @@
+package api
+
+// SchemaHeader pins the shape of the responses a client understands, and
+// names the shape of every response.
+const SchemaHeader = "X-Validator-Schema"
+
+// Versions of the response schema, which is bumped on changes existing
+// clients cannot parse. Every JSON response names its version in
+// schema_version. Version 1 answers errors with message and error alone,
+// version 2 with problem documents.
+const (
+	SchemaVersion    = 2
+	MinSchemaVersion = 1
+)
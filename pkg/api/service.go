@@ -0,0 +1,122 @@
+package api
+
+import "time"
+
+// HealthResponse is the health of the server, answered by GET /health with
+// 503 when it is unhealthy.
+type HealthResponse struct {
+	Status        string           `json:"status"`
+	Service       string           `json:"service"`
+	Version       string           `json:"version"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Error         string           `json:"error,omitempty"`
+	HHFabVersion  string           `json:"hhfab_version,omitempty"`
+	UptimeSeconds int64            `json:"uptime_seconds"`
+	DiskFreeBytes uint64           `json:"disk_free_bytes"`
+	QueueDepth    int              `json:"queue_depth"`
+	Workers       WorkerStatus     `json:"workers"`
+	Dependencies  []ReadinessCheck `json:"dependencies"`
+}
+
+// WorkerStatus is the use of the workers running hhfab.
+type WorkerStatus struct {
+	Active      int     `json:"active"`
+	Max         int     `json:"max"`
+	Utilization float64 `json:"utilization"`
+}
+
+// ReadinessCheck is the outcome of a single readiness probe check.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReadinessResponse is the answer of GET /ready.
+type ReadinessResponse struct {
+	Status string           `json:"status"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// CapabilitiesResponse tells clients which optional features the server
+// supports so they can adapt instead of failing on older servers.
+type CapabilitiesResponse struct {
+	// SchemaVersion is the response schema version of the response, the
+	// one the request pinned or else the latest, SchemaVersions those the
+	// server speaks from the oldest to the latest
+	SchemaVersion  int      `json:"schema_version"`
+	SchemaVersions []int    `json:"schema_versions,omitempty"`
+	Version        string   `json:"version"`
+	UseCases       []string `json:"use_cases"`
+	Streaming      bool     `json:"streaming"`
+	// Async is set when POST /validate?async=true queues validations
+	Async bool `json:"async"`
+	// History is set when finished validations are listed by GET /history
+	History     bool     `json:"history"`
+	Templates   []string `json:"templates"`
+	MaxFileSize int64    `json:"max_file_size"`
+	// MaxRequestSize and UploadLimits bound what POST /validate accepts
+	MaxRequestSize int64        `json:"max_request_size"`
+	UploadLimits   UploadLimits `json:"upload_limits"`
+	// SchemaOnly is set while validations run without hhfab
+	SchemaOnly bool `json:"schema_only"`
+	// Backend is what the validations are currently run with
+	Backend  BackendCapabilities `json:"backend"`
+	Profiles []string            `json:"profiles"`
+	// Plugins names the custom rules run on every validation
+	Plugins []string `json:"plugins"`
+	// Formats lists the result formats of POST /validate?format=
+	Formats []string `json:"formats"`
+	// Tenant is the tenant the credentials of the request name, whose
+	// templates are listed
+	Tenant string `json:"tenant,omitempty"`
+	// Role is what the credentials of the request allow: viewer,
+	// validator or admin
+	Role string `json:"role,omitempty"`
+}
+
+// Roles of requests, as answered in CapabilitiesResponse.Role, each allowed
+// what the ones before it are.
+const (
+	// RoleViewer reads the history, results, jobs and statistics
+	RoleViewer = "viewer"
+	// RoleValidator also validates, formats, converts and generates wiring
+	RoleValidator = "validator"
+	// RoleAdmin also runs the admin endpoints
+	RoleAdmin = "admin"
+)
+
+// BackendCapabilities tells what the backend validations are run with
+// supports.
+type BackendCapabilities struct {
+	// Name is the backend: hhfab, mock or schema-only
+	Name string `json:"name"`
+	// HHFab is set when validations run hhfab validate, unset when only the
+	// schemas and native checks apply
+	HHFab bool `json:"hhfab"`
+	// Samples is set when POST /generate/sample works, Benchmark when POST
+	// /benchmark does
+	Samples   bool `json:"samples"`
+	Benchmark bool `json:"benchmark"`
+	// ResourceLimits is set when the resources limits apply to validations
+	ResourceLimits bool `json:"resource_limits"`
+	// Canary is set when validations may be compared with a candidate
+	// hhfab
+	Canary bool `json:"canary"`
+}
+
+// UploadLimits are the sizes in bytes a wiring file, the fab file and the
+// wiring files together may have.
+type UploadLimits struct {
+	Wiring int64 `json:"wiring"`
+	Fab    int64 `json:"fab"`
+	Bundle int64 `json:"bundle"`
+}
+
+// InfoResponse describes the service, answered by GET /.
+type InfoResponse struct {
+	Service     string   `json:"service"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Endpoints   []string `json:"endpoints"`
+}
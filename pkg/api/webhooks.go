@@ -0,0 +1,37 @@
+package api
+
+// Headers of webhook deliveries.
+const (
+	// WebhookEventHeader names the event, like the event of the body
+	WebhookEventHeader = "X-Validator-Event"
+	// WebhookDeliveryHeader is a random ID of the delivery, the same on
+	// retries, which receivers remember to refuse replays
+	WebhookDeliveryHeader = "X-Validator-Delivery"
+	// WebhookTimestampHeader is the time of the attempt in Unix seconds
+	WebhookTimestampHeader = "X-Validator-Timestamp"
+	// WebhookSignatureHeader is "sha256=" and the hex HMAC-SHA256, keyed
+	// with the secret of the endpoint, of the timestamp, the delivery ID
+	// and the body joined by dots
+	WebhookSignatureHeader = "X-Validator-Signature-256"
+)
+
+// Webhook events.
+const (
+	// WebhookValidationFinished is sent for every finished validation
+	WebhookValidationFinished = "validation.finished"
+	// WebhookSelfTestFailed is sent to the self-test webhooks when the
+	// first self-test fails or one fails after passing,
+	// WebhookSelfTestRecovered when one passes after failing
+	WebhookSelfTestFailed    = "selftest.failed"
+	WebhookSelfTestRecovered = "selftest.recovered"
+)
+
+// WebhookEvent is the body of webhook deliveries. Entry is the history
+// entry of the validation with its result; self-test events carry the
+// SelfTest instead, with the host name of the replica that ran it.
+type WebhookEvent struct {
+	Event    string        `json:"event"`
+	Entry    *HistoryEntry `json:"entry,omitempty"`
+	Host     string        `json:"host,omitempty"`
+	SelfTest *SelfTest     `json:"selftest,omitempty"`
+}
@@ -0,0 +1,309 @@
+// Package client is the Go client of the validator service, for programs
+// validating wiring diagrams without shelling out to the CLI, which uses it
+// as well.
+//
+//	c := client.New("https://validator.example.com", client.WithToken(token), client.WithRetries(3, time.Second))
+//	response, err := c.Validate(ctx, client.File{Name: "wiring.yaml", Data: data}, client.Params{})
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"validator/pkg/api"
+)
+
+// maxRetryDelay caps the exponential growth of the delay between attempts.
+const maxRetryDelay = 30 * time.Second
+
+// Client talks to a validator server. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	token        string
+	authHeader   string
+	retries      int
+	backoff      time.Duration
+	retryHook    func(retry, retries int, delay time.Duration, err error)
+	debugf       func(format string, args ...any)
+	pollInterval time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// New returns a client of the server at baseURL, such as
+// http://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		backoff:      time.Second,
+		retryHook:    func(int, int, time.Duration, error) {},
+		debugf:       func(string, ...any) {},
+		pollInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithHTTPClient sends the requests with httpClient instead of
+// http.DefaultClient, e.g. for TLS settings, proxies or timeouts.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithToken authenticates requests with token, sent as a bearer token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithAuthHeader sends the token as is in header, e.g. X-API-Key, instead of
+// as a bearer token.
+func WithAuthHeader(header string) Option {
+	return func(c *Client) { c.authHeader = header }
+}
+
+// WithRetries retries network errors, 5xx and 429 responses and timeouts up
+// to retries times. The delay starts at backoff and doubles with every
+// retry, at least as long as the server asked for with Retry-After.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = retries, backoff }
+}
+
+// WithRetryHook calls hook before every retry with the error of the failed
+// attempt and the delay until the next one.
+func WithRetryHook(hook func(retry, retries int, delay time.Duration, err error)) Option {
+	return func(c *Client) { c.retryHook = hook }
+}
+
+// WithDebug logs the requests made and the jobs polled with debugf.
+func WithDebug(debugf func(format string, args ...any)) Option {
+	return func(c *Client) { c.debugf = debugf }
+}
+
+// WithPollInterval sets how often asynchronous validations are polled, every
+// second by default.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) { c.pollInterval = interval }
+}
+
+// StatusError is a response that is not a validation result: the server
+// rejected the request with 4xx or failed with 5xx. Failed validations are
+// results, not errors.
+type StatusError struct {
+	StatusCode int
+	// Response is the response of /validate, nil for other endpoints
+	Response *ValidateResponse
+	// Body is the response of other endpoints
+	Body string
+	// Problem is the problem document the server answered with, nil for
+	// servers answering otherwise
+	Problem *api.Problem
+	// RetryAfter is the delay the Retry-After header asked for, if any
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	kind := "request rejected"
+	if e.Temporary() {
+		kind = "server error"
+	}
+	detail := e.Body
+	if e.Problem != nil {
+		detail = e.Problem.Title
+		if e.Problem.Detail != "" {
+			detail = fmt.Sprintf("%s: %s", e.Problem.Title, e.Problem.Detail)
+		}
+	} else if e.Response != nil {
+		detail = e.Response.Message
+		if e.Response.Error != "" {
+			detail = fmt.Sprintf("%s: %s", e.Response.Message, e.Response.Error)
+		}
+	}
+	return fmt.Sprintf("%s (%d): %s", kind, e.StatusCode, detail)
+}
+
+// parseProblem returns the problem document of a response, nil if it is
+// none.
+func parseProblem(resp *http.Response, data []byte) *api.Problem {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), api.ProblemContentType) {
+		return nil
+	}
+	problem := &api.Problem{}
+	if err := json.Unmarshal(data, problem); err != nil || problem.Type == "" {
+		return nil
+	}
+	return problem
+}
+
+// Temporary reports whether the request may succeed when sent again, which
+// is the case for server errors and rate limits.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// ResponseError is a response that could not be parsed, usually from a
+// server of an incompatible version.
+type ResponseError struct {
+	URL    string
+	Status string
+	Err    error
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("failed to parse response of %s (%s): %v", e.URL, e.Status, e.Err)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// newRequest returns an authenticated request to path of the server.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	// Pin the responses to the shape this client understands
+	req.Header.Set(api.SchemaHeader, strconv.Itoa(api.SchemaVersion))
+	switch {
+	case c.token == "":
+	case c.authHeader != "":
+		req.Header.Set(c.authHeader, c.token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// getJSON fetches path and decodes its JSON body into v. Responses other
+// than 200 and the accepted statuses are returned as a *StatusError.
+func (c *Client) getJSON(ctx context.Context, path string, v any, accepted ...int) error {
+	return retry(ctx, c, func() error {
+		req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK && !slices.Contains(accepted, resp.StatusCode) {
+			return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data)), Problem: parseProblem(resp, data), RetryAfter: retryAfter(resp)}
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return &ResponseError{URL: req.URL.String(), Status: resp.Status, Err: err}
+		}
+		return nil
+	})
+}
+
+// Health returns the health of the server. Unhealthy servers answer with 503
+// and their health, which is returned without an error.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	health := &HealthResponse{}
+	if err := c.getJSON(ctx, "/health", health, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+// Capabilities returns the optional features of the server. Servers older
+// than the endpoint answer with a *StatusError of 404.
+func (c *Client) Capabilities(ctx context.Context) (*CapabilitiesResponse, error) {
+	capabilities := &CapabilitiesResponse{}
+	if err := c.getJSON(ctx, "/capabilities", capabilities); err != nil {
+		return nil, err
+	}
+	return capabilities, nil
+}
+
+// Info returns the description of the service.
+func (c *Client) Info(ctx context.Context) (*InfoResponse, error) {
+	info := &InfoResponse{}
+	if err := c.getJSON(ctx, "/", info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// retry calls attempt until it succeeds, fails permanently, ctx is done or
+// the retries of c are used up, and returns the last error.
+func retry(ctx context.Context, c *Client, attempt func() error) error {
+	err := attempt()
+	for retry := 1; retry <= c.retries && err != nil && retryable(ctx, err); retry++ {
+		delay := c.retryDelay(retry)
+		var status *StatusError
+		if errors.As(err, &status) && status.RetryAfter > delay {
+			delay = status.RetryAfter
+		}
+		c.retryHook(retry, c.retries, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		err = attempt()
+	}
+	return err
+}
+
+// retryable reports whether a failed request may succeed when sent again.
+// Only network errors, server errors, unparseable responses and timeouts
+// qualify; validation results and rejected requests would come back the
+// same.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	var response *ResponseError
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &response) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &urlErr) || errors.As(err, &netErr)
+}
+
+// retryDelay returns the jittered delay before the given retry, starting at
+// 1. The delay doubles with every retry and is picked at random from its
+// upper half so that clients failing together do not retry together.
+func (c *Client) retryDelay(retry int) time.Duration {
+	delay := c.backoff << (retry - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter returns the delay of the Retry-After header of resp, if any.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HistoryQuery selects a page of the history of the server. Filters left
+// empty match every entry.
+type HistoryQuery struct {
+	// Sort is created_at, duration_ms, errors or warnings, prefixed with -
+	// for descending order; -created_at by default
+	Sort string
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+	// Limit is the size of the page, 50 by default
+	Limit   int
+	Success *bool
+	UseCase string
+	Mode    string
+	Profile string
+	// Code matches entries with a diagnostic of the code
+	Code string
+	// File matches entries with an upload of the name
+	File  string
+	Since time.Time
+	Until time.Time
+	// Tenant selects the tenant to list with the admin token, which sees
+	// every tenant; other credentials only see their own
+	Tenant string
+}
+
+func (q HistoryQuery) values() url.Values {
+	values := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	set("sort", q.Sort)
+	set("cursor", q.Cursor)
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Success != nil {
+		values.Set("success", strconv.FormatBool(*q.Success))
+	}
+	set("use_case", q.UseCase)
+	set("mode", q.Mode)
+	set("profile", q.Profile)
+	set("code", q.Code)
+	set("file", q.File)
+	set("tenant", q.Tenant)
+	if !q.Since.IsZero() {
+		values.Set("since", q.Since.Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		values.Set("until", q.Until.Format(time.RFC3339Nano))
+	}
+	return values
+}
+
+// History returns a page of the validations recorded by the server. Servers
+// without a history backend answer with a *StatusError.
+func (c *Client) History(ctx context.Context, query HistoryQuery) (*HistoryResponse, error) {
+	path := "/history"
+	if values := query.values(); len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	page := &HistoryResponse{}
+	if err := c.getJSON(ctx, path, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// HistoryEntry returns an entry of the history with its result.
+func (c *Client) HistoryEntry(ctx context.Context, id string) (*HistoryEntry, error) {
+	entry := &HistoryEntry{}
+	if err := c.getJSON(ctx, "/history/"+url.PathEscape(id), entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Stats rolls up the history of the server from query.Since to query.Until,
+// the last 30 days by default, with the top diagnostic codes found most
+// often, 10 if top is 0. The filters of query apply, its sort and
+// pagination do not.
+func (c *Client) Stats(ctx context.Context, query HistoryQuery, top int) (*StatsResponse, error) {
+	values := query.values()
+	values.Del("sort")
+	values.Del("cursor")
+	values.Del("limit")
+	if top > 0 {
+		values.Set("top", strconv.Itoa(top))
+	}
+	path := "/stats"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	stats := &StatsResponse{}
+	if err := c.getJSON(ctx, path, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,22 @@
+package client
+
+import "validator/pkg/api"
+
+// The client returns the schemas of pkg/api.
+type (
+	ValidateResponse     = api.ValidateResponse
+	Summary              = api.Summary
+	Process              = api.Process
+	ObjectResult         = api.ObjectResult
+	Diagnostic           = api.Diagnostic
+	Job                  = api.Job
+	HealthResponse       = api.HealthResponse
+	ReadinessCheck       = api.ReadinessCheck
+	CapabilitiesResponse = api.CapabilitiesResponse
+	InfoResponse         = api.InfoResponse
+	HistoryEntry         = api.HistoryEntry
+	HistoryResponse      = api.HistoryResponse
+	StatsResponse        = api.StatsResponse
+	WebhookEvent         = api.WebhookEvent
+	Problem              = api.Problem
+)
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"validator/pkg/api"
+)
+
+// File is a file to upload. Diagnostics refer to it by Name.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// ReadFile reads the file at path, named after its base name.
+func ReadFile(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: filepath.Base(path), Data: data}, nil
+}
+
+// Params are the optional parameters of a validation.
+type Params struct {
+	// Fab is the fab.yaml to validate the wiring with, UC2; without it the
+	// server generates one, UC1
+	Fab *File
+	// Baseline lists known findings which do not fail the validation
+	Baseline *File
+	// Strict fails on warnings and runs the lint checks too
+	Strict bool
+	// Kinds only validates the wiring documents of these kinds
+	Kinds []string
+	// Profile names the validation profile of the target environment
+	Profile string
+	// Parallel lets the server split the bundle into independent shards
+	Parallel bool
+	// Incremental reuses the server's results of the objects unchanged since
+	// an earlier validation in this scope, such as a repository
+	Incremental string
+	// Deterministic strips the timestamps of the hhfab output and the
+	// duration, so results of identical requests are byte-identical
+	Deterministic bool
+	// Diagram returns a topology diagram in this format, such as svg or
+	// drawio, with a successful result
+	Diagram string
+	// IdempotencyKey names the validation, so that sending it again with the
+	// key, such as from a retried CI step, answers with the result of the
+	// first request; retries of the client send a key of their own without it
+	IdempotencyKey string
+	// NoCache validates even if an identical request has a cached result
+	NoCache bool
+	// Async queues the validation as a job and polls it until it is done, for
+	// at most Wait if set
+	Async bool
+	Wait  time.Duration
+	// Progress is called with the hhfab output lines as the server streams
+	// them, or with the state of the job of an asynchronous validation
+	Progress func(line string)
+}
+
+// query returns the query parameters of a validation with params.
+func (p Params) query() url.Values {
+	query := url.Values{}
+	switch {
+	case p.Async:
+		query.Set("async", "true")
+	case p.Progress != nil:
+		// Servers without streaming support ignore the parameter
+		query.Set("stream", "true")
+	}
+	if p.Strict {
+		query.Set("strict", "true")
+	}
+	if len(p.Kinds) > 0 {
+		query.Set("kinds", strings.Join(p.Kinds, ","))
+	}
+	if p.Profile != "" {
+		query.Set("profile", p.Profile)
+	}
+	if p.Parallel {
+		query.Set("parallel", "true")
+	}
+	if p.Incremental != "" {
+		query.Set("incremental", p.Incremental)
+	}
+	if p.Deterministic {
+		query.Set("deterministic", "true")
+	}
+	if p.Diagram != "" {
+		query.Set("diagram", p.Diagram)
+	}
+	if p.NoCache {
+		query.Set("cache", "false")
+	}
+	return query
+}
+
+// Validate validates a wiring file, see ValidateBundle.
+func (c *Client) Validate(ctx context.Context, wiring File, params Params) (*ValidateResponse, error) {
+	return c.ValidateBundle(ctx, []File{wiring}, params)
+}
+
+// ValidateBundle validates wiring files together, as one fabric. A failed
+// validation is a response with Success false; when the server rejects the
+// request or fails, the response comes with a *StatusError.
+func (c *Client) ValidateBundle(ctx context.Context, wiring []File, params Params) (*ValidateResponse, error) {
+	body, contentType, err := multipartBody(wiring, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retries must not run the validation twice
+	if params.IdempotencyKey == "" && c.retries > 0 {
+		key := make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		params.IdempotencyKey = hex.EncodeToString(key)
+	}
+
+	var response *ValidateResponse
+	err = retry(ctx, c, func() error {
+		response, err = c.validate(ctx, bytes.NewReader(body), contentType, params)
+		return err
+	})
+	return response, err
+}
+
+// multipartBody returns the form uploading the files of a validation.
+func multipartBody(wiring []File, params Params) ([]byte, string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	add := func(field string, file File) error {
+		part, err := writer.CreateFormFile(field, file.Name)
+		if err != nil {
+			return err
+		}
+		_, err = part.Write(file.Data)
+		return err
+	}
+
+	for _, file := range wiring {
+		if err := add("wiring", file); err != nil {
+			return nil, "", fmt.Errorf("failed to add wiring file: %w", err)
+		}
+	}
+	if params.Fab != nil {
+		if err := add("fab", *params.Fab); err != nil {
+			return nil, "", fmt.Errorf("failed to add fab file: %w", err)
+		}
+	}
+	if params.Baseline != nil {
+		if err := add("baseline", *params.Baseline); err != nil {
+			return nil, "", fmt.Errorf("failed to add baseline file: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// validate sends one validation request and reads its result, whether
+// answered directly, streamed or queued as a job.
+func (c *Client) validate(ctx context.Context, body io.Reader, contentType string, params Params) (*ValidateResponse, error) {
+	path := "/validate"
+	if query := params.query(); len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if params.IdempotencyKey != "" {
+		req.Header.Set(api.IdempotencyKeyHeader, params.IdempotencyKey)
+	}
+	c.debugf("Making request to: %s", req.URL)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), api.StreamContentType) {
+		response, status, err := readStream(resp.Body, params.Progress)
+		if err != nil {
+			return nil, err
+		}
+		return response, checkStatus(status, response, 0)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if params.Async && resp.StatusCode == http.StatusAccepted {
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil || job.ID == "" {
+			if err == nil {
+				err = fmt.Errorf("job without an ID")
+			}
+			return nil, &ResponseError{URL: req.URL.String(), Status: resp.Status, Err: err}
+		}
+		job, err := c.waitForJob(ctx, job, params)
+		if err != nil {
+			return nil, err
+		}
+		return job.Result, checkStatus(job.HTTPStatus, job.Result, 0)
+	}
+
+	response := &ValidateResponse{}
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, &ResponseError{URL: req.URL.String(), Status: resp.Status, Err: err}
+	}
+	err = checkStatus(resp.StatusCode, response, retryAfter(resp))
+	if status, ok := err.(*StatusError); ok {
+		status.Problem = parseProblem(resp, data)
+	}
+	return response, err
+}
+
+// checkStatus turns responses that are not validation results into errors.
+// The server answers failed validations with 400 and the hhfab output, while
+// other 4xx responses mean the request itself was rejected.
+func checkStatus(status int, response *ValidateResponse, retryAfter time.Duration) error {
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests ||
+		(status >= http.StatusBadRequest && response.UseCase == "") {
+		return &StatusError{StatusCode: status, Response: response, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// readStream consumes a streamed validation, passing output lines to
+// progress, and returns the final result with its status code.
+func readStream(body io.Reader, progress func(string)) (*ValidateResponse, int, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event api.StreamEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, 0, &ResponseError{URL: "/validate", Status: "stream", Err: err}
+		}
+		switch event.Type {
+		case api.StreamOutput:
+			if progress != nil {
+				progress(event.Line)
+			}
+		case api.StreamResult:
+			if event.Result == nil {
+				return nil, 0, &ResponseError{URL: "/validate", Status: "stream", Err: fmt.Errorf("result without a response")}
+			}
+			return event.Result, event.Status, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read response stream: %w", err)
+	}
+	return nil, 0, &ResponseError{URL: "/validate", Status: "stream", Err: fmt.Errorf("stream ended without a result")}
+}
+
+// Job returns the state of an asynchronous validation.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	job := &Job{}
+	if err := c.getJSON(ctx, "/jobs/"+url.PathEscape(id), job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// waitForJob polls a queued validation until it is done, for at most the
+// Wait of params.
+func (c *Client) waitForJob(ctx context.Context, job *Job, params Params) (*Job, error) {
+	c.debugf("Queued as job %s", job.ID)
+	if params.Wait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, params.Wait)
+		defer cancel()
+	}
+
+	started := time.Now()
+	for job.Status != api.JobDone {
+		if params.Progress != nil {
+			params.Progress(fmt.Sprintf("Job %s %s...", job.ID, job.Status))
+		}
+		select {
+		case <-time.After(c.pollInterval):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("job %s is still %s after %s: %w", job.ID, job.Status, time.Since(started).Round(time.Second), ctx.Err())
+		}
+
+		polled, err := c.Job(ctx, job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("polling job %s failed: %w", job.ID, err)
+		}
+		job = polled
+	}
+
+	if job.Result == nil {
+		return nil, &ResponseError{URL: "/jobs/" + job.ID, Status: api.JobDone, Err: fmt.Errorf("job without a result")}
+	}
+	return job, nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"validator/pkg/api"
+)
+
+// DefaultWebhookMaxAge is how old deliveries a WebhookVerifier accepts
+// without a MaxAge of its own.
+const DefaultWebhookMaxAge = 5 * time.Minute
+
+// ErrInvalidWebhook is returned for deliveries that are forged, tampered
+// with, too old or replayed.
+var ErrInvalidWebhook = errors.New("invalid webhook delivery")
+
+// WebhookVerifier checks that webhook deliveries come from the server: that
+// they are signed with the secret of the endpoint, recent and not seen
+// before. It is safe for concurrent use.
+//
+//	verifier := &client.WebhookVerifier{Secret: secret}
+//	event, err := verifier.Verify(r.Header, body)
+type WebhookVerifier struct {
+	Secret string
+	// MaxAge bounds the age of deliveries, DefaultWebhookMaxAge if zero
+	MaxAge time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// Verify checks a delivery by its headers and body and returns its event.
+// Deliveries are accepted once; retries of a delivery already accepted are
+// refused with ErrInvalidWebhook like replays.
+func (v *WebhookVerifier) Verify(header http.Header, body []byte) (*WebhookEvent, error) {
+	maxAge := v.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultWebhookMaxAge
+	}
+	timestamp := header.Get(api.WebhookTimestampHeader)
+	delivery := header.Get(api.WebhookDeliveryHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || delivery == "" {
+		return nil, fmt.Errorf("%w: missing %s or %s", ErrInvalidWebhook, api.WebhookTimestampHeader, api.WebhookDeliveryHeader)
+	}
+
+	mac := hmac.New(sha256.New, []byte(v.Secret))
+	mac.Write([]byte(timestamp + "." + delivery + "."))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(header.Get(api.WebhookSignatureHeader)), []byte(expected)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidWebhook)
+	}
+	now := time.Now()
+	sent := time.Unix(seconds, 0)
+	if age := now.Sub(sent); age > maxAge || age < -maxAge {
+		return nil, fmt.Errorf("%w: sent at %s", ErrInvalidWebhook, sent.Format(time.RFC3339))
+	}
+
+	v.mu.Lock()
+	for id, at := range v.seen {
+		if now.Sub(at) > maxAge {
+			delete(v.seen, id)
+		}
+	}
+	if _, ok := v.seen[delivery]; ok {
+		v.mu.Unlock()
+		return nil, fmt.Errorf("%w: delivery %s was seen before", ErrInvalidWebhook, delivery)
+	}
+	if v.seen == nil {
+		v.seen = map[string]time.Time{}
+	}
+	v.seen[delivery] = now
+	v.mu.Unlock()
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("decoding webhook event: %w", err)
+	}
+	return &event, nil
+}
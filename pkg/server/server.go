@@ -0,0 +1,115 @@
+// Package server embeds the validator service in other programs, serving
+// the same API with the same handlers as validator-server.
+//
+//	cfg := server.DefaultConfig()
+//	cfg.Backend = server.BackendSchemaOnly
+//	srv, err := server.New(cfg)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer srv.Close()
+//	mux.Handle("/", srv.Router())
+//
+// Run serves the API on a port of its own instead, with the background
+// workers of the service, until its context is cancelled.
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"validator/internal/hhfabmock"
+	"validator/internal/server"
+)
+
+// ServiceConfig holds the settings of the config file of validator-server,
+// by the same names.
+type ServiceConfig = server.Config
+
+// Config configures an embedded server. Start from DefaultConfig: the zero
+// value is not valid.
+type Config struct {
+	ServiceConfig
+	// Port is the port Run listens on, defaults to 8080
+	Port string
+	// ConfigFile, when set, is read instead of ServiceConfig and reloaded
+	// whenever it changes, as validator-server does
+	ConfigFile string
+	// Environment applies the VALIDATOR_* variables validator-server honors,
+	// e.g. VALIDATOR_BACKEND, over ServiceConfig. They always apply over
+	// ConfigFile
+	Environment bool
+	// Debug serves pprof and runtime dumps on DebugAddr, defaulting to
+	// localhost:6060
+	Debug     bool
+	DebugAddr string
+}
+
+// The backends validations are run with, see ServiceConfig.Backend.
+const (
+	BackendHHFab      = server.BackendHHFab
+	BackendMock       = server.BackendMock
+	BackendSchemaOnly = server.BackendSchemaOnly
+)
+
+// DefaultConfig is the configuration of validator-server without a config
+// file: validating with the hhfab on the PATH.
+func DefaultConfig() Config {
+	return Config{ServiceConfig: server.DefaultConfig()}
+}
+
+// Server is an embedded validator service.
+type Server struct {
+	srv *server.Server
+}
+
+// New validates cfg and prepares a Server, connecting to the stores it
+// configures. Nothing is started until Run is called.
+func New(cfg Config) (*Server, error) {
+	opts := server.Options{
+		Port:        cfg.Port,
+		ConfigFile:  cfg.ConfigFile,
+		Environment: cfg.Environment,
+		Debug:       cfg.Debug,
+		DebugAddr:   cfg.DebugAddr,
+	}
+	if cfg.ConfigFile == "" {
+		service := cfg.ServiceConfig
+		opts.Config = &service
+	}
+	srv, err := server.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{srv: srv}, nil
+}
+
+// Router returns the HTTP handler serving the validator API. Without Run,
+// validations are served but jobs are not run and the self-checks behind
+// /readyz and /health are not refreshed.
+func (s *Server) Router() http.Handler {
+	return s.srv.Router()
+}
+
+// Run starts the background workers and serves the API on the configured
+// port until it fails or ctx is cancelled, then waits for the requests in
+// flight. It returns nil after a shutdown.
+func (s *Server) Run(ctx context.Context) error {
+	return s.srv.Run(ctx)
+}
+
+// Close exports the audit events still queued and closes the exporters.
+// Call it once the server no longer serves.
+func (s *Server) Close() error {
+	return s.srv.Close()
+}
+
+// RunMockHHFab runs the hhfab of BackendMock and exits when the program was
+// started as one. The mock backend starts the running program as hhfab, so
+// programs embedding a server with it call RunMockHHFab first thing in main.
+func RunMockHHFab() {
+	if hhfabmock.Invoked() {
+		os.Exit(hhfabmock.Main(os.Args[1:]))
+	}
+}
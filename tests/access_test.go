@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestAddressAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := `access:
+  allow: [10.20.0.0/16, "2001:db8::/32"]
+  deny: [10.20.0.66]
+  trusted_proxies: [192.0.2.10]
+auth:
+  required: true
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	get := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/history", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Addresses are filtered before authentication, which then rejects the
+	// request without credentials
+	assert.Equal(t, http.StatusUnauthorized, get("10.20.3.4:5000", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("[2001:db8::1]:5000", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("[::ffff:10.20.3.4]:5000", ""))
+	assert.Equal(t, http.StatusForbidden, get("10.20.0.66:5000", ""))
+	assert.Equal(t, http.StatusForbidden, get("172.16.0.1:5000", ""))
+
+	// Only trusted proxies forward the address of the client
+	assert.Equal(t, http.StatusUnauthorized, get("192.0.2.10:5000", "10.20.3.4"))
+	assert.Equal(t, http.StatusForbidden, get("192.0.2.10:5000", "10.20.3.4, 10.20.0.66"))
+	assert.Equal(t, http.StatusForbidden, get("172.16.0.1:5000", "10.20.3.4"))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.RemoteAddr = "10.20.3.4:5000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `validator_addresses_denied_total{list="deny"}`)
+	assert.Contains(t, w.Body.String(), `validator_addresses_denied_total{list="allow"}`)
+
+	require.NoError(t, os.WriteFile(configFile, []byte("access:\n  allow: [10.20.0.0/33]\n"), 0644))
+	_, err = server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "access.allow")
+}
+
+func TestRateLimitForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := `backend: mock
+access:
+  trusted_proxies: [192.0.2.10]
+rate_limit:
+  requests_per_minute: 1
+  burst: 1
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	post := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/format", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A forged X-Forwarded-For neither moves an untrusted peer into a new
+	// bucket nor past the limit
+	assert.NotEqual(t, http.StatusTooManyRequests, post("172.16.0.1:5000", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, post("172.16.0.1:5000", "10.0.0.2"))
+	assert.Equal(t, http.StatusTooManyRequests, post("172.16.0.1:5001", ""))
+
+	// Behind a trusted proxy the forwarded clients are limited one by one
+	assert.NotEqual(t, http.StatusTooManyRequests, post("192.0.2.10:5000", "10.0.0.1"))
+	assert.NotEqual(t, http.StatusTooManyRequests, post("192.0.2.10:5000", "10.0.0.2"))
+	assert.Equal(t, http.StatusTooManyRequests, post("192.0.2.10:5000", "10.0.0.1"))
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+func TestAdminEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	slow := filepath.Join(dir, "slow")
+	hhfab := filepath.Join(dir, "hhfab")
+	script := fmt.Sprintf("#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml;;\n  validate) echo \"INF checking\"; [ -f %s ] && exec sleep 10; echo \"INF validated\";;\nesac\n", slow)
+	require.NoError(t, os.WriteFile(hhfab, []byte(script), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nadmin_token: admin-token\nworkspaces:\n  max_idle: 0\ncache:\n  backend: memory\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	call := func(method, path, credential string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	admin := func(method, path string, target any) int {
+		w := call(method, path, "admin-token")
+		if target != nil {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), target), w.Body.String())
+		}
+		return w.Code
+	}
+	validate := func(query, id string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(connectionWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate"+query, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set(server.RequestIDHeader, id)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The endpoints are for admins only
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/admin/queue", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/admin/queue", "wrong").Code)
+
+	// Paused queues refuse validations and readiness until resumed, jobs
+	// are queued meanwhile
+	var state api.QueueState
+	require.Equal(t, http.StatusOK, admin(http.MethodPost, "/admin/queue/pause", &state))
+	assert.True(t, state.Paused)
+	refused := validate("", "paused-1")
+	assert.Equal(t, http.StatusServiceUnavailable, refused.Code)
+	assert.NotEmpty(t, refused.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusServiceUnavailable, call(http.MethodGet, "/readyz", "").Code)
+	queued := validate("?async=true", "paused-2")
+	require.Equal(t, http.StatusAccepted, queued.Code)
+	var job api.Job
+	require.NoError(t, json.Unmarshal(queued.Body.Bytes(), &job))
+	require.Equal(t, http.StatusOK, admin(http.MethodGet, "/admin/queue", &state))
+	assert.Equal(t, 1, state.Queued)
+
+	// Only running validations can be cancelled
+	var problem api.Problem
+	assert.Equal(t, http.StatusConflict, admin(http.MethodPost, "/admin/jobs/"+job.ID+"/cancel", &problem))
+	assert.Equal(t, api.ProblemConflict, problem.Type)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/admin/jobs/missing/cancel", nil))
+
+	require.Equal(t, http.StatusOK, admin(http.MethodPost, "/admin/queue/resume", &state))
+	assert.False(t, state.Paused)
+	assert.Equal(t, http.StatusBadRequest, validate("", "resumed-1").Code)
+
+	// Flushing empties the result cache
+	var flushed api.CacheFlush
+	require.Equal(t, http.StatusOK, admin(http.MethodPost, "/admin/cache/flush", &flushed))
+	assert.Equal(t, 1, flushed.Results)
+
+	// Running validations are cancelled by their request ID, and drains
+	// wait for them
+	require.NoError(t, os.WriteFile(slow, nil, 0644))
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- validate("?cache=false", "slow-1") }()
+	require.Eventually(t, func() bool {
+		admin(http.MethodGet, "/admin/queue", &state)
+		return len(state.Running) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"slow-1"}, state.Running)
+	assert.Equal(t, 1, state.Active)
+
+	state = api.QueueState{}
+	require.Equal(t, http.StatusOK, admin(http.MethodPost, "/admin/drain?timeout=1", &state))
+	assert.True(t, state.Paused)
+	require.NotNil(t, state.Drained)
+	assert.False(t, *state.Drained)
+
+	var cancellation api.Cancellation
+	require.Equal(t, http.StatusAccepted, admin(http.MethodPost, "/admin/jobs/slow-1/cancel", &cancellation))
+	assert.Equal(t, api.Cancellation{ID: "slow-1", Cancelled: true}, cancellation)
+	cancelled := <-done
+	assert.Equal(t, http.StatusServiceUnavailable, cancelled.Code)
+	var response api.ValidateResponse
+	require.NoError(t, json.Unmarshal(cancelled.Body.Bytes(), &response))
+	assert.Equal(t, "Validation cancelled", response.Message)
+	require.NotNil(t, response.Process)
+	assert.Equal(t, "INF checking\n", response.Process.Stdout)
+
+	state = api.QueueState{}
+	require.Equal(t, http.StatusOK, admin(http.MethodPost, "/admin/drain", &state))
+	require.NotNil(t, state.Drained)
+	assert.True(t, *state.Drained)
+	assert.Empty(t, state.Running)
+}
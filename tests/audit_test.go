@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/audit"
+	"validator/internal/server"
+)
+
+func TestAuditExporters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	var hecBodies []string
+	hec := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "Splunk hec-token", r.Header.Get("Authorization"))
+		mu.Lock()
+		hecBodies = append(hecBodies, string(body))
+		mu.Unlock()
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer hec.Close()
+
+	syslog, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer syslog.Close()
+
+	logFile := filepath.Join(dir, "audit.log")
+	config := fmt.Sprintf(`hhfab_path: /nonexistent/hhfab
+schema_only_fallback: true
+tenants:
+  network-team:
+    api_keys: [team-key]
+audit:
+  syslog:
+    address: udp://%s
+    facility: auth
+  http:
+    url: %s/services/collector/event
+    token: hec-token
+    index: security
+  file:
+    path: %s
+`, syslog.LocalAddr(), hec.URL, logFile)
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(connectionWiring))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/validate", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", "team-key")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Without trusted proxies the address of the peer is recorded, not the
+	// one it claims to forward
+	req = httptest.NewRequest(http.MethodGet, "/history", nil)
+	req.RemoteAddr = "172.16.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-API-Key", "stolen-key")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.NoError(t, s.Close())
+
+	// The file holds the events in order, probes are left out
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	var events []audit.Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var event audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.Len(t, events, 2)
+	assert.Equal(t, "POST /validate", events[0].Action)
+	assert.Equal(t, "network-team", events[0].Tenant)
+	assert.Equal(t, server.RoleValidator, events[0].Role)
+	assert.True(t, events[0].Authenticated)
+	assert.NotEqual(t, audit.OutcomeDenied, events[0].Outcome)
+	assert.Equal(t, "GET /history", events[1].Action)
+	assert.Equal(t, audit.OutcomeDenied, events[1].Outcome)
+	assert.Equal(t, http.StatusUnauthorized, events[1].Status)
+	assert.False(t, events[1].Authenticated)
+	assert.Equal(t, "172.16.0.1", events[1].ClientIP)
+	assert.NotContains(t, string(data), "203.0.113.7")
+	info, err := os.Stat(logFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The collector receives them in HEC envelopes
+	mu.Lock()
+	hecBody := strings.Join(hecBodies, "")
+	mu.Unlock()
+	decoder := json.NewDecoder(strings.NewReader(hecBody))
+	type envelope struct {
+		Time   float64     `json:"time"`
+		Source string      `json:"source"`
+		Index  string      `json:"index"`
+		Event  audit.Event `json:"event"`
+	}
+	var envelopes []envelope
+	for decoder.More() {
+		var envelope envelope
+		require.NoError(t, decoder.Decode(&envelope))
+		envelopes = append(envelopes, envelope)
+	}
+	require.Len(t, envelopes, 2)
+	assert.Equal(t, "security", envelopes[0].Index)
+	assert.Equal(t, "hh-validator", envelopes[0].Source)
+	assert.InDelta(t, float64(events[0].Time.UnixMilli())/1000, envelopes[0].Time, 0.001)
+	assert.Equal(t, events[1].Action, envelopes[1].Event.Action)
+	assert.NotContains(t, hecBody, "203.0.113.7")
+
+	// The syslog receiver gets a message per event, denials as warnings of
+	// the auth facility
+	var messages []string
+	buf := make([]byte, 65536)
+	for len(messages) < 2 {
+		syslog.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := syslog.ReadFrom(buf)
+		require.NoError(t, err)
+		messages = append(messages, string(buf[:n]))
+	}
+	assert.Regexp(t, `^<38>1 \d{4}-\d\d-\d\dT[\d:.]+Z \S+ hh-validator \d+ audit \[audit@32473 action="POST /validate" outcome="\w+" status="\d+" tenant="network-team" role="validator" client_ip="[^"]+"\] \{`, messages[0])
+	assert.Regexp(t, `^<36>1 .* \[audit@32473 action="GET /history" outcome="denied" status="401" client_ip="172\.16\.0\.1"\] \{.*"action":"GET /history"`, messages[1])
+	assert.NotContains(t, messages[1], "203.0.113.7")
+}
+
+func TestAuditFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	event := audit.Event{Time: time.Now(), Action: "POST /validate", Path: "/validate", Outcome: audit.OutcomeSuccess, Status: 200}
+	line, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	// Three lines fit a file, the two newest rotated files are kept
+	f, err := audit.NewFile(path, int64(3*(len(line)+1)), 2)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, f.Export([]audit.Event{event}))
+	}
+	require.NoError(t, f.Close())
+	for name, lines := range map[string]int{path: 1, path + ".1": 3, path + ".2": 3} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, lines, strings.Count(string(data), "\n"), name)
+	}
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestAuditConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	for config, message := range map[string]string{
+		"audit:\n  syslog:\n    address: udp://localhost:514\n    facility: nope\n": "is not a syslog facility",
+		"audit:\n  syslog:\n    address: ftp://localhost:514\n":                     "must start with udp://",
+		"audit:\n  http:\n    url: https://splunk:8088/services/collector/event\n":  "audit.http.token is required",
+		"audit:\n  file:\n    max_size_mb: 10\n":                                    "audit.file.path is required",
+	} {
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		_, err := server.New(server.Options{ConfigFile: configFile})
+		assert.ErrorContains(t, err, message)
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestBackendCapabilities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := func(config string) *gin.Engine {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(configFile, []byte(config+"workspaces:\n  max_idle: 0\n"), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+		return s.Router()
+	}
+	capabilities := func(router *gin.Engine) server.CapabilitiesResponse {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var response server.CapabilitiesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	missing := "hhfab_path: " + filepath.Join(t.TempDir(), "hhfab") + "\n"
+
+	hhfab := capabilities(router(missing))
+	assert.Equal(t, server.BackendCapabilities{Name: server.BackendHHFab, HHFab: true, Samples: true, Benchmark: true, ResourceLimits: true, Canary: true}, hhfab.Backend)
+	assert.False(t, hhfab.SchemaOnly)
+
+	// Without hhfab the fallback reports what it is
+	fallback := capabilities(router(missing + "schema_only_fallback: true\n"))
+	assert.Equal(t, server.BackendCapabilities{Name: server.BackendSchemaOnly}, fallback.Backend)
+	assert.True(t, fallback.SchemaOnly)
+
+	mock := capabilities(router("backend: mock\n"))
+	assert.Equal(t, server.BackendMock, mock.Backend.Name)
+	assert.False(t, mock.Backend.Canary)
+
+	// The schema-only backend never runs hhfab, even where it is installed
+	schemaOnly := router("backend: schema-only\n")
+	assert.True(t, capabilities(schemaOnly).SchemaOnly)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/generate/sample", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	schemaOnly.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "the schema-only backend does not generate samples")
+}
@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"validator/internal/codes"
+	"validator/pkg/api"
+)
+
+func TestBaseline(t *testing.T) {
+	baseline := api.NewBaseline([]api.Diagnostic{
+		{Severity: api.SeverityWarning, Code: codes.Unused, Object: "VLANNamespace/lab", Message: "VLANNamespace/lab: unused", Line: 12},
+		{Severity: api.SeverityError, Code: codes.MissingDescription, Object: "Switch/leaf-01", Path: "spec", Message: "Switch/leaf-01: no description"},
+		// Promoted in strict mode, the same finding as the first
+		{Severity: api.SeverityError, Code: codes.Unused, Object: "VLANNamespace/lab", Message: "VLANNamespace/lab: unused"},
+		{Severity: api.SeverityWarning, Code: codes.HHFabSkipped, Message: "hhfab is not available"},
+	})
+	assert.Equal(t, []api.BaselineEntry{
+		{Code: codes.HHFabSkipped, Message: "hhfab is not available"},
+		{Code: codes.MissingDescription, Object: "Switch/leaf-01", Path: "spec", Message: "Switch/leaf-01: no description"},
+		{Code: codes.Unused, Object: "VLANNamespace/lab", Message: "VLANNamespace/lab: unused"},
+	}, baseline.Findings)
+
+	data, err := yaml.Marshal(baseline)
+	require.NoError(t, err)
+	parsed, err := api.ParseBaseline(data)
+	require.NoError(t, err)
+	assert.Equal(t, baseline, parsed)
+
+	// JSON is YAML too
+	parsed, err = api.ParseBaseline([]byte(`{"version": 1, "findings": [{"code": "HHV014", "object": "VLANNamespace/lab"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []api.BaselineEntry{{Code: "HHV014", Object: "VLANNamespace/lab"}}, parsed.Findings)
+
+	_, err = api.ParseBaseline([]byte("findings: []\n"))
+	assert.EqualError(t, err, "unsupported baseline version 0, expected 1")
+}
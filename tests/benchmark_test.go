@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+// benchmarkHHFab logs its inits and validations to calls
+const benchmarkHHFab = `#!/bin/sh
+case "$1" in
+  init) echo init >> %[1]s; echo "spec: {}" > fab.yaml;;
+  validate) echo validate >> %[1]s; sleep 0.01; echo "06:38:17 INF validated";;
+esac
+`
+
+func TestBenchmark(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(fmt.Sprintf(benchmarkHHFab, calls)), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nadmin_token: admin-token\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	benchmark := func(target, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// counts returns the inits and validations since the last call
+	counts := func() (int, int) {
+		data, _ := os.ReadFile(calls)
+		os.Remove(calls)
+		return strings.Count(string(data), "init"), strings.Count(string(data), "validate")
+	}
+
+	for _, tc := range []struct {
+		name, target, body string
+		iterations         int
+	}{
+		{"query", "/benchmark?n=7", "", 7},
+		{"body", "/benchmark", `{"iterations": 3}`, 3},
+		{"query over body", "/benchmark?n=2", `{"iterations": 3}`, 2},
+		{"default", "/benchmark", "", 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := benchmark(tc.target, tc.body, "admin-token")
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var response server.BenchmarkResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.True(t, response.Success)
+			assert.Equal(t, tc.iterations, response.Iterations)
+
+			// Every iteration initializes a workspace of its own
+			inits, validates := counts()
+			assert.Equal(t, tc.iterations, inits)
+			assert.Equal(t, tc.iterations, validates)
+
+			for name, stats := range map[string]*server.LatencyStats{"init": response.Init, "validate": response.Validate} {
+				require.NotNil(t, stats, name)
+				assert.Positive(t, stats.MinMs, name)
+				assert.True(t, stats.MinMs <= stats.P50Ms && stats.P50Ms <= stats.P90Ms && stats.P90Ms <= stats.P99Ms && stats.P99Ms <= stats.MaxMs,
+					"%s percentiles out of order: %+v", name, stats)
+				assert.True(t, stats.MinMs <= stats.MeanMs && stats.MeanMs <= stats.MaxMs, "%s mean out of range: %+v", name, stats)
+			}
+			assert.GreaterOrEqual(t, response.Validate.MinMs, 10.0)
+		})
+	}
+
+	// Iterations out of the limits are refused before hhfab runs
+	for _, n := range []string{"101", "0", "many"} {
+		t.Run("n="+n, func(t *testing.T) {
+			w := benchmark("/benchmark?n="+n, "", "admin-token")
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			var problem api.Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, api.ProblemInvalidRequest, problem.Type)
+		})
+	}
+	w := benchmark("/benchmark", `{"iterations": 101}`, "admin-token")
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "iterations must be between 1 and 100")
+	inits, validates := counts()
+	assert.Zero(t, inits)
+	assert.Zero(t, validates)
+
+	// Benchmarks are for operators only
+	w = benchmark("/benchmark?n=1", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+	inits, _ = counts()
+	assert.Zero(t, inits)
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func testResultCache(t *testing.T, cache server.ResultCache) {
+	ctx := context.Background()
+	require.NoError(t, cache.Ping(ctx))
+
+	_, err := cache.Get(ctx, "a")
+	assert.ErrorIs(t, err, server.ErrCacheMiss)
+
+	result := &server.CachedResult{
+		Status:   http.StatusBadRequest,
+		Response: server.ValidateResponse{Success: false, UseCase: "uc1", Error: "invalid port"},
+	}
+	require.NoError(t, cache.Set(ctx, "a", result))
+	cached, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, result, cached)
+}
+
+func TestCacheMemory(t *testing.T) {
+	cache := server.NewMemoryCache(2, time.Hour)
+	defer cache.Close()
+	testResultCache(t, cache)
+
+	// The oldest results are evicted first
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, "b", &server.CachedResult{Status: http.StatusOK}))
+	require.NoError(t, cache.Set(ctx, "c", &server.CachedResult{Status: http.StatusOK}))
+	_, err := cache.Get(ctx, "a")
+	assert.ErrorIs(t, err, server.ErrCacheMiss)
+	_, err = cache.Get(ctx, "c")
+	assert.NoError(t, err)
+
+	// Results expire after the TTL
+	expiring := server.NewMemoryCache(10, time.Millisecond)
+	require.NoError(t, expiring.Set(ctx, "a", &server.CachedResult{Status: http.StatusOK}))
+	time.Sleep(5 * time.Millisecond)
+	_, err = expiring.Get(ctx, "a")
+	assert.ErrorIs(t, err, server.ErrCacheMiss)
+
+	// Flushing empties the cache
+	flushed, err := cache.Flush(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, flushed)
+	_, err = cache.Get(ctx, "c")
+	assert.ErrorIs(t, err, server.ErrCacheMiss)
+}
+
+func TestCacheRedis(t *testing.T) {
+	redis := miniredis.RunT(t)
+	cache, err := server.NewRedisCache("redis://"+redis.Addr(), "test", time.Minute)
+	require.NoError(t, err)
+	defer cache.Close()
+	testResultCache(t, cache)
+	assert.Equal(t, time.Minute, redis.TTL("test:result:a"))
+
+	// Another replica serves the cached result
+	other, err := server.NewRedisCache("redis://"+redis.Addr(), "test", time.Minute)
+	require.NoError(t, err)
+	defer other.Close()
+	cached, err := other.Get(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, "invalid port", cached.Response.Error)
+
+	// Flushing leaves the keys of other backends alone
+	redis.Set("test:job:1", "{}")
+	flushed, err := other.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, flushed)
+	assert.False(t, redis.Exists("test:result:a"))
+	assert.True(t, redis.Exists("test:job:1"))
+}
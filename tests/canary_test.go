@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+// syncBuffer collects the log of the server while canaries write to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCanary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	current := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(current, []byte("#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml;;\n  validate) echo \"ERR validating: port taken\"; exit 1;;\nesac\n"), 0755))
+	same := filepath.Join(dir, "hhfab-same")
+	data, err := os.ReadFile(current)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(same, data, 0755))
+	lenient := filepath.Join(dir, "hhfab-lenient")
+	require.NoError(t, os.WriteFile(lenient, []byte("#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml;;\n  validate) echo \"INF validated\";;\nesac\n"), 0755))
+
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	router := func(candidate string) *gin.Engine {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		config := fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\ncanary:\n  hhfab_path: %s\n", current, candidate)
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+		return s.Router()
+	}
+	validate := func(router *gin.Engine, query string) int {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(connectionWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate"+query, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	canaries := func(router *gin.Engine, result string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		match := regexp.MustCompile(`validator_canary_validations_total\{result="` + result + `"\} (\d+)`).FindStringSubmatch(w.Body.String())
+		if match == nil {
+			return 0
+		}
+		n, _ := strconv.Atoi(match[1])
+		return n
+	}
+
+	// A candidate finding the same is a match, and the response is that of
+	// the current hhfab
+	sameRouter := router(same)
+	matches := canaries(sameRouter, "match")
+	assert.Equal(t, http.StatusBadRequest, validate(sameRouter, "?canary=true"))
+	assert.Eventually(t, func() bool { return canaries(sameRouter, "match") == matches+1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Without canary=true nothing is sampled at the default rate
+	validate(sameRouter, "?cache=false")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, matches+1, canaries(sameRouter, "match"))
+
+	// Divergences are counted and logged
+	lenientRouter := router(lenient)
+	diverged := canaries(lenientRouter, "diverged")
+	assert.Equal(t, http.StatusBadRequest, validate(lenientRouter, "?canary=true"))
+	assert.Eventually(t, func() bool { return canaries(lenientRouter, "diverged") == diverged+1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, logs.String(), "Canary hhfab "+lenient+" diverged from "+current+" validating wiring.yaml: only current: error HHV000: validating: port taken")
+
+	// Candidates that are not there are errors
+	missingRouter := router(filepath.Join(dir, "missing"))
+	failed := canaries(missingRouter, "error")
+	validate(missingRouter, "?canary=true")
+	assert.Eventually(t, func() bool { return canaries(missingRouter, "error") == failed+1 }, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestClientValidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/validate", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "true", r.URL.Query().Get("strict"))
+		assert.Equal(t, "Switch,Server", r.URL.Query().Get("kinds"))
+		assert.Equal(t, "prod", r.URL.Query().Get("profile"))
+
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		require.Len(t, r.MultipartForm.File["wiring"], 2)
+		assert.Equal(t, "b.yaml", r.MultipartForm.File["wiring"][1].Filename)
+		fab, _, err := r.FormFile("fab")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(fab)
+		assert.Equal(t, "fab", string(data))
+
+		// A failed validation is a result
+		writeJSON(w, http.StatusBadRequest, client.ValidateResponse{Success: false, Message: "Validation failed", UseCase: "uc2"})
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL+"/", client.WithToken("secret"))
+	response, err := c.ValidateBundle(context.Background(), []client.File{
+		{Name: "a.yaml", Data: []byte("a")},
+		{Name: "b.yaml", Data: []byte("b")},
+	}, client.Params{
+		Fab:     &client.File{Name: "fab.yaml", Data: []byte("fab")},
+		Strict:  true,
+		Kinds:   []string{"Switch", "Server"},
+		Profile: "prod",
+	})
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, "uc2", response.UseCase)
+}
+
+func TestClientRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, client.ValidateResponse{Message: "Unknown profile", Error: `profile "nope" is not configured`})
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.WithRetries(3, time.Millisecond))
+	response, err := c.Validate(context.Background(), client.File{Name: "wiring.yaml"}, client.Params{Profile: "nope"})
+	var status *client.StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, http.StatusBadRequest, status.StatusCode)
+	assert.False(t, status.Temporary())
+	assert.Equal(t, `request rejected (400): Unknown profile: profile "nope" is not configured`, err.Error())
+	assert.Equal(t, "Unknown profile", response.Message)
+}
+
+func TestClientRetries(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			writeJSON(w, http.StatusServiceUnavailable, client.ValidateResponse{Message: "Server overloaded"})
+			return
+		}
+		writeJSON(w, http.StatusOK, client.ValidateResponse{Success: true, UseCase: "uc1"})
+	}))
+	defer srv.Close()
+
+	retried := []int{}
+	c := client.New(srv.URL, client.WithRetries(2, time.Millisecond), client.WithRetryHook(func(retry, retries int, delay time.Duration, err error) {
+		retried = append(retried, retry)
+	}))
+	response, err := c.Validate(context.Background(), client.File{Name: "wiring.yaml"}, client.Params{})
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, []int{1, 2}, retried)
+	assert.EqualValues(t, 3, attempts.Load())
+}
+
+func TestClientStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.URL.Query().Get("stream"))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprintln(w, `{"type":"output","line":"INF validating"}`)
+		fmt.Fprintln(w, `{"type":"result","status":200,"result":{"success":true,"use_case":"uc1"}}`)
+	}))
+	defer srv.Close()
+
+	lines := []string{}
+	c := client.New(srv.URL)
+	response, err := c.Validate(context.Background(), client.File{Name: "wiring.yaml"}, client.Params{
+		Progress: func(line string) { lines = append(lines, line) },
+	})
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, []string{"INF validating"}, lines)
+}
+
+func TestClientAsync(t *testing.T) {
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/validate":
+			assert.Equal(t, "true", r.URL.Query().Get("async"))
+			writeJSON(w, http.StatusAccepted, api.Job{ID: "j1", Status: api.JobQueued})
+		case "/jobs/j1":
+			if polls.Add(1) < 2 {
+				writeJSON(w, http.StatusOK, api.Job{ID: "j1", Status: api.JobRunning})
+				return
+			}
+			writeJSON(w, http.StatusOK, api.Job{ID: "j1", Status: api.JobDone, HTTPStatus: http.StatusOK,
+				Result: &client.ValidateResponse{Success: true, UseCase: "uc1"}})
+		}
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.WithPollInterval(time.Millisecond))
+	response, err := c.Validate(context.Background(), client.File{Name: "wiring.yaml"}, client.Params{Async: true})
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+
+	// Jobs still running once the wait is over time out
+	polls.Store(-1000)
+	_, err = c.Validate(context.Background(), client.File{Name: "wiring.yaml"}, client.Params{Async: true, Wait: 20 * time.Millisecond})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			writeJSON(w, http.StatusServiceUnavailable, client.HealthResponse{Status: "unhealthy", Error: "hhfab not found"})
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		}
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	health, err := c.Health(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "unhealthy", health.Status)
+
+	_, err = c.Capabilities(context.Background())
+	var status *client.StatusError
+	require.ErrorAs(t, err, &status)
+	assert.Equal(t, http.StatusNotFound, status.StatusCode)
+}
+
+func TestClientHistory(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/history":
+			query := r.URL.Query()
+			assert.Equal(t, "-duration_ms", query.Get("sort"))
+			assert.Equal(t, "10", query.Get("limit"))
+			assert.Equal(t, "false", query.Get("success"))
+			assert.Equal(t, "2024-05-01T00:00:00Z", query.Get("since"))
+			if query.Get("cursor") == "" {
+				writeJSON(w, http.StatusOK, api.HistoryResponse{Entries: []client.HistoryEntry{{ID: "e1"}}, NextCursor: "c1"})
+				return
+			}
+			assert.Equal(t, "c1", query.Get("cursor"))
+			writeJSON(w, http.StatusOK, api.HistoryResponse{Entries: []client.HistoryEntry{{ID: "e2"}}})
+		case "/history/e2":
+			writeJSON(w, http.StatusOK, client.HistoryEntry{ID: "e2", Result: &client.ValidateResponse{Output: "output"}})
+		}
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	failed := false
+	query := client.HistoryQuery{Sort: "-duration_ms", Limit: 10, Success: &failed, Since: since}
+	ids := []string{}
+	for {
+		page, err := c.History(context.Background(), query)
+		require.NoError(t, err)
+		for _, entry := range page.Entries {
+			ids = append(ids, entry.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"e1", "e2"}, ids)
+
+	entry, err := c.HistoryEntry(context.Background(), "e2")
+	require.NoError(t, err)
+	assert.Equal(t, "output", entry.Result.Output)
+}
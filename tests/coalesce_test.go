@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+// heldHHFab counts its runs in runs and validates once release exists
+const heldHHFab = `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate)
+    echo run >> %s
+    while [ ! -f %s ]; do sleep 0.01; done
+    echo "06:38:17 INF validated";;
+esac
+`
+
+// coalesceServer returns the router of a server whose hhfab holds its runs
+// until the returned release function is called, and the file counting them.
+func coalesceServer(t *testing.T) (*gin.Engine, string, func()) {
+	t.Helper()
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	release := filepath.Join(dir, "release")
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(fmt.Sprintf(heldHHFab, runs, release)), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nworkers:\n  max_concurrent: 4\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\ntenants:\n  team-a:\n    api_keys: [key-a]\n  team-b:\n    api_keys: [key-b]\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	return s.Router(), runs, func() { require.NoError(t, os.WriteFile(release, nil, 0644)) }
+}
+
+// waitForRuns waits until hhfab was started n times.
+func waitForRuns(t *testing.T, runs string, n int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), "run") >= n
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func coalesceValidate(t *testing.T, router *gin.Engine, key, wiring string) server.ValidateResponse {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(wiring))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/validate", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response server.ValidateResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	return response
+}
+
+func TestCoalesceIdenticalRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, runs, release := coalesceServer(t)
+
+	// The first request runs hhfab, the others join it while it is held
+	const n = 5
+	responses := make([]server.ValidateResponse, n)
+	var wg sync.WaitGroup
+	validate := func(i int) {
+		defer wg.Done()
+		responses[i] = coalesceValidate(t, router, "key-a", shardedWiring)
+	}
+	wg.Add(1)
+	go validate(0)
+	waitForRuns(t, runs, 1)
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go validate(i)
+	}
+	time.Sleep(200 * time.Millisecond)
+	release()
+	wg.Wait()
+
+	assert.Equal(t, 1, countRuns(t, runs))
+	assert.False(t, responses[0].Coalesced)
+	for _, response := range responses[1:] {
+		assert.True(t, response.Coalesced)
+		assert.Equal(t, responses[0].Success, response.Success)
+		assert.Equal(t, responses[0].Output, response.Output)
+		assert.Equal(t, responses[0].Diagnostics, response.Diagnostics)
+	}
+	assert.Contains(t, responses[0].Output, "INF validated")
+}
+
+func TestCoalesceDistinctRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, runs, release := coalesceServer(t)
+
+	// Neither another tenant nor other files join a running validation, so
+	// each of them starts an hhfab run of its own while the first is held
+	other := strings.Replace(shardedWiring, "leaf-01", "leaf-03", -1)
+	requests := []struct{ key, wiring string }{
+		{"key-a", shardedWiring},
+		{"key-b", shardedWiring},
+		{"key-a", other},
+	}
+	responses := make([]server.ValidateResponse, len(requests))
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, key, wiring string) {
+			defer wg.Done()
+			responses[i] = coalesceValidate(t, router, key, wiring)
+		}(i, request.key, request.wiring)
+		waitForRuns(t, runs, i+1)
+	}
+	release()
+	wg.Wait()
+
+	assert.Equal(t, len(requests), countRuns(t, runs))
+	for _, response := range responses {
+		assert.False(t, response.Coalesced)
+	}
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"validator/internal/codes"
+)
+
+func TestCodesClassify(t *testing.T) {
+	tests := []struct {
+		message string
+		code    string
+	}{
+		{"validating: loading wiring: object 1: decoding: yaml: line 3: could not find expected ':'", "HHV001"},
+		{"validating: switch leaf-01: port E1/1 already used by connection server-01--leaf-01", "HHV004"},
+		{"validating: connection server-01--leaf-01: unknown switch leaf-99", "HHV005"},
+		{`validating: switch Leaf_01: metadata.name: Invalid value: "Leaf_01": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters`, codes.InvalidName},
+		{"something nobody has seen before", codes.Unclassified},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, codes.Classify(tt.message), tt.message)
+	}
+}
+
+func TestCodesLookup(t *testing.T) {
+	code, ok := codes.Lookup("hhv001")
+	assert.True(t, ok)
+	assert.Equal(t, "HHV001", code.ID)
+	assert.NotEmpty(t, code.Remediation)
+
+	code, ok = codes.Lookup("Port-Conflict")
+	assert.True(t, ok)
+	assert.Equal(t, codes.PortConflict, code.ID)
+
+	_, ok = codes.Lookup("HHV999")
+	assert.False(t, ok)
+
+	names := map[string]bool{}
+	for _, code := range codes.All() {
+		assert.Regexp(t, `^[a-z0-9]+(-[a-z0-9]+)*$`, code.Name, code.ID)
+		assert.False(t, names[code.Name], "duplicate name %s", code.Name)
+		names[code.Name] = true
+		assert.NotEmpty(t, code.Title, code.ID)
+		assert.NotEmpty(t, code.Causes, code.ID)
+		assert.NotEmpty(t, code.Remediation, code.ID)
+	}
+}
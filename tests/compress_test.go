@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+// compressServer returns the router of a server taking requests of up to
+// 20000 bytes with an hhfab passing every wiring.
+func compressServer(t *testing.T) *gin.Engine {
+	t.Helper()
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	script := "#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml;;\n  validate) echo \"06:38:17 INF validated\";;\nesac\n"
+	require.NoError(t, os.WriteFile(hhfab, []byte(script), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nmax_request_size: 20000\nupload_limits:\n  bundle: 1000000\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	return s.Router()
+}
+
+// wiringForm returns a multipart body uploading wiring and its content type.
+func wiringForm(t *testing.T, wiring string) ([]byte, string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(wiring))
+	require.NoError(t, writer.Close())
+	return body.Bytes(), writer.FormDataContentType()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return compressed.Bytes()
+}
+
+func TestCompressResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := compressServer(t)
+	body, contentType := wiringForm(t, shardedWiring)
+
+	for _, tc := range []struct {
+		acceptEncoding string
+		gzip           bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"br, gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+	} {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Header().Values("Vary"), "Accept-Encoding")
+
+			data := w.Body.Bytes()
+			if tc.gzip {
+				assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+				reader, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				data, err = io.ReadAll(reader)
+				require.NoError(t, err)
+			} else {
+				assert.Empty(t, w.Header().Get("Content-Encoding"))
+			}
+			var response server.ValidateResponse
+			require.NoError(t, json.Unmarshal(data, &response))
+			assert.True(t, response.Success)
+		})
+	}
+}
+
+func TestCompressedRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := compressServer(t)
+	send := func(body []byte, contentType, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	problemOf := func(w *httptest.ResponseRecorder) api.Problem {
+		var problem api.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		return problem
+	}
+
+	// A compressed upload is validated like an uncompressed one
+	body, contentType := wiringForm(t, shardedWiring)
+	w := send(gzipped(t, body), contentType, "gzip")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response server.ValidateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Contains(t, response.Output, "INF validated")
+
+	// The request limit applies to the decompressed body, however small the
+	// compressed one is
+	large, largeType := wiringForm(t, shardedWiring+strings.Repeat("# padding\n", 5000))
+	compressed := gzipped(t, large)
+	require.Less(t, len(compressed), 20000)
+	w = send(compressed, largeType, "gzip")
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	assert.Equal(t, api.ProblemUploadTooLarge, problemOf(w).Type)
+	response = server.ValidateResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, &api.LimitExceeded{Field: "request", Limit: 20000}, response.Limit)
+
+	// Bodies that are no gzip or break off are the client's fault
+	compressed = gzipped(t, body)
+	for name, body := range map[string][]byte{
+		"not gzip":  body,
+		"truncated": compressed[:len(compressed)/2],
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := send(body, contentType, "gzip")
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Equal(t, api.ProblemInvalidRequest, problemOf(w).Type)
+		})
+	}
+
+	// Other encodings are refused
+	w = send(body, contentType, "br")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := `cors:
+  allowed_origins: [https://ui.example.com, https://*.lab.example.com]
+  allow_credentials: true
+auth:
+  required: true
+`
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	send := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/validate", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Preflights are answered before authentication
+	preflight := map[string]string{"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "authorization, content-type"}
+	w := send(http.MethodOptions, "https://ui.example.com", preflight)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://ui.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	w = send(http.MethodOptions, "https://ci.lab.example.com", preflight)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://ci.lab.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = send(http.MethodOptions, "https://evil.example.org", preflight)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Pages of allowed origins can read responses, errors included
+	w = send(http.MethodPost, "https://ui.example.com", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "https://ui.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "Retry-After")
+	assert.ElementsMatch(t, []string{"Origin", "Accept-Encoding"}, w.Header().Values("Vary"))
+
+	w = send(http.MethodPost, "https://evil.example.org", nil)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	w = send(http.MethodPost, "", nil)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	for config, message := range map[string]string{
+		"cors:\n  allowed_origins: ['*']\n  allow_credentials: true\n": "cannot be * with allow_credentials",
+		"cors:\n  allowed_origins: [ui.example.com]\n":                 "is not an origin",
+		"cors:\n  allowed_origins: ['https://ui.*.example.com']\n":     "may only start its host with *.",
+	} {
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		_, err := server.New(server.Options{ConfigFile: configFile})
+		assert.ErrorContains(t, err, message)
+	}
+}
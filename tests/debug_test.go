@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s, err := server.New(server.Options{Debug: true})
+	require.NoError(t, err)
+	debug := s.DebugHandler()
+	get := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get(debug, "/debug/pprof/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "heap")
+	assert.Equal(t, http.StatusOK, get(debug, "/debug/pprof/heap").Code)
+	assert.Contains(t, get(debug, "/debug/vars").Body.String(), `"memstats"`)
+	assert.Contains(t, get(debug, "/debug/dump/goroutines").Body.String(), "goroutine ")
+	dump := get(debug, "/debug/dump/heap")
+	assert.Equal(t, http.StatusOK, dump.Code)
+	assert.Contains(t, dump.Body.String(), "go1.7 heap dump")
+
+	// The API never serves them
+	assert.Equal(t, http.StatusNotFound, get(s.Router(), "/debug/pprof/").Code)
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+// clockHHFab is an hhfab whose log lines start with the time, as hhfab's do.
+const clockHHFab = `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate)
+    echo "$(date +%H:%M:%S.%N) INF Hedgehog Fabricator version=v0.40.0"
+    echo "$(date -u +%Y-%m-%dT%H:%M:%S.%NZ) WRN port 7 is unused" >&2
+    echo "$(date +%H:%M:%S) ERR validating: port taken"
+    exit 1;;
+esac
+`
+
+func TestDeterministicOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(clockHHFab), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\n", hhfab)), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	// Problem documents name the request ID, which the client can fix
+	validate := func(query string) string {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(connectionWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate?cache=false"+query, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set(server.RequestIDHeader, "golden-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// Identical requests get byte-identical results, stdout before stderr
+	first := validate("&deterministic=true")
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, first, validate("&deterministic=true"))
+	}
+	var response api.ValidateResponse
+	require.NoError(t, json.Unmarshal([]byte(first), &response))
+	require.NotNil(t, response.Process)
+	assert.Equal(t, "INF Hedgehog Fabricator version=v0.40.0\nERR validating: port taken\n", response.Process.Stdout)
+	assert.Equal(t, "WRN port 7 is unused\n", response.Process.Stderr)
+	assert.Equal(t, response.Process.Stdout+response.Process.Stderr, response.Output)
+	assert.Zero(t, response.Summary.DurationMs)
+
+	// The diagnostics are parsed from the lines with their timestamps
+	assert.Equal(t, "validating: port taken", response.Diagnostics[0].Message)
+	assert.Equal(t, "port 7 is unused", response.Diagnostics[1].Message)
+
+	// Streamed lines are stripped too
+	stream := validate("&deterministic=true&stream=true")
+	assert.Contains(t, stream, `"line":"INF Hedgehog Fabricator version=v0.40.0"`)
+
+	// Without the option the timestamps are kept
+	require.NoError(t, json.Unmarshal([]byte(validate("")), &response))
+	assert.Regexp(t, `^\d\d:\d\d:\d\d\.\d+ INF Hedgehog`, response.Process.Stdout)
+	assert.False(t, strings.HasPrefix(response.Output, "INF"))
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/pkg/client"
+	embedded "validator/pkg/server"
+)
+
+func TestEmbeddedServer(t *testing.T) {
+	cfg := embedded.DefaultConfig()
+	cfg.Backend = embedded.BackendMock
+	cfg.Workspaces.MaxIdle = 0
+	srv, err := embedded.New(cfg)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// The router serves the API of validator-server
+	api := httptest.NewServer(srv.Router())
+	defer api.Close()
+	ctx := context.Background()
+	c := client.New(api.URL)
+	response, err := c.Validate(ctx, client.File{Name: "wiring.yaml", Data: []byte(kubeconformWiring)}, client.Params{})
+	require.NoError(t, err)
+	assert.True(t, response.Success, response.Message)
+	capabilities, err := c.Capabilities(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, embedded.BackendMock, capabilities.Backend.Name)
+
+	// Run serves on the port until cancelled
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	cfg.Port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, listener.Close())
+	srv, err = embedded.New(cfg)
+	require.NoError(t, err)
+	defer srv.Close()
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(runCtx)
+	}()
+	c = client.New("http://localhost:" + cfg.Port)
+	require.Eventually(t, func() bool {
+		health, err := c.Health(ctx)
+		return err == nil && health.Status == "healthy"
+	}, 5*time.Second, 20*time.Millisecond)
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+
+	// Configurations are validated as config files are
+	_, err = embedded.New(embedded.Config{})
+	assert.ErrorContains(t, err, "backend must be")
+
+	// Or read from a config file
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("timeout_seconds: -1\n"), 0644))
+	_, err = embedded.New(embedded.Config{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "timeout_seconds must be positive")
+}
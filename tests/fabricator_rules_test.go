@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/rules"
+	"validator/internal/wiring"
+)
+
+const collapsedCoreFab = `apiVersion: fabricator.githedgehog.com/v1beta1
+kind: Fabricator
+metadata:
+  name: default
+  namespace: fab
+spec:
+  config:
+    fabric:
+      mode: collapsed-core
+---
+apiVersion: fabricator.githedgehog.com/v1beta1
+kind: ControlNode
+metadata:
+  name: control-1
+  namespace: fab
+`
+
+const crossCheckWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: spine-01
+spec:
+  role: spine
+  vlanNamespaces:
+    - default
+    - storage
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: control-2
+spec:
+  type: control
+`
+
+func TestRulesFabricatorConsistency(t *testing.T) {
+	fab, err := wiring.Parse([]byte(collapsedCoreFab), "fab.yaml")
+	require.NoError(t, err)
+	objects, err := wiring.Parse([]byte(crossCheckWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	// Without a fab.yaml there is nothing to compare
+	assert.Empty(t, rules.Check(objects))
+
+	findings := map[string][]rules.Finding{}
+	for _, finding := range rules.Check(append(objects, fab...)) {
+		assert.Equal(t, codes.FabricatorMismatch, finding.Code)
+		findings[finding.Rule] = append(findings[finding.Rule], finding)
+	}
+
+	require.Len(t, findings["control-nodes"], 2)
+	assert.Equal(t, "Server/control-2", findings["control-nodes"][0].Object)
+	assert.Equal(t, "ControlNode/fab/control-1", findings["control-nodes"][1].Object)
+	assert.Equal(t, "fab.yaml", findings["control-nodes"][1].File)
+
+	require.Len(t, findings["vlan-namespaces"], 1)
+	assert.Equal(t, "spec.vlanNamespaces[1]", findings["vlan-namespaces"][0].Path)
+	assert.Equal(t, 9, findings["vlan-namespaces"][0].Line)
+
+	require.Len(t, findings["fabric-mode"], 1)
+	assert.Equal(t, "spec.role", findings["fabric-mode"][0].Path)
+}
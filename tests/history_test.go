@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func testHistoryStore(t *testing.T, history server.HistoryStore) {
+	ctx := context.Background()
+	require.NoError(t, history.Ping(ctx))
+
+	_, err := history.Get(ctx, "a")
+	assert.ErrorIs(t, err, server.ErrHistoryNotFound)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		entry := &server.HistoryEntry{
+			ID:         fmt.Sprintf("e%d", i),
+			CreatedAt:  created.Add(time.Duration(i) * time.Minute),
+			Status:     http.StatusOK,
+			Success:    i%2 == 0,
+			UseCase:    "uc1",
+			Files:      []string{"wiring.yaml"},
+			DurationMs: int64(100 - i),
+			Result:     &server.ValidateResponse{Success: i%2 == 0, Output: "output"},
+		}
+		if !entry.Success {
+			entry.Status, entry.Errors, entry.Codes = http.StatusBadRequest, 1, []string{"HHV101"}
+		}
+		require.NoError(t, history.Add(ctx, entry))
+	}
+
+	// Entries are returned with their result, listings without
+	entry, err := history.Get(ctx, "e1")
+	require.NoError(t, err)
+	assert.Equal(t, "output", entry.Result.Output)
+
+	ids := func(entries []server.HistoryEntry) []string {
+		result := []string{}
+		for _, entry := range entries {
+			assert.Nil(t, entry.Result)
+			result = append(result, entry.ID)
+		}
+		return result
+	}
+	entries, err := history.List(ctx, server.HistoryQuery{Sort: "created_at", Desc: true, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e3", "e2", "e1", "e0"}, ids(entries))
+
+	entries, err = history.List(ctx, server.HistoryQuery{Sort: "duration_ms", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e3", "e2"}, ids(entries))
+
+	failed := false
+	entries, err = history.List(ctx, server.HistoryQuery{Sort: "created_at", Limit: 10, Success: &failed, Code: "HHV101"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e1", "e3"}, ids(entries))
+
+	entries, err = history.List(ctx, server.HistoryQuery{Sort: "created_at", Limit: 10, Since: created.Add(time.Minute), Until: created.Add(3 * time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e1", "e2"}, ids(entries))
+}
+
+func TestHistoryMemory(t *testing.T) {
+	history := server.NewMemoryHistory(4)
+	defer history.Close()
+	testHistoryStore(t, history)
+
+	// The oldest entries are dropped first
+	ctx := context.Background()
+	require.NoError(t, history.Add(ctx, &server.HistoryEntry{ID: "e4", CreatedAt: time.Now()}))
+	_, err := history.Get(ctx, "e0")
+	assert.ErrorIs(t, err, server.ErrHistoryNotFound)
+}
+
+func TestHistoryRedis(t *testing.T) {
+	redis := miniredis.RunT(t)
+	history, err := server.NewRedisHistory("redis://"+redis.Addr(), "test", 4)
+	require.NoError(t, err)
+	defer history.Close()
+	testHistoryStore(t, history)
+
+	// Another replica lists the entries, without the dropped ones
+	other, err := server.NewRedisHistory("redis://"+redis.Addr(), "test", 4)
+	require.NoError(t, err)
+	defer other.Close()
+	ctx := context.Background()
+	require.NoError(t, other.Add(ctx, &server.HistoryEntry{ID: "e4", CreatedAt: time.Now()}))
+	entries, err := history.List(ctx, server.HistoryQuery{Sort: "created_at", Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "e1", entries[0].ID)
+	assert.False(t, redis.Exists("test:history:e0"))
+}
+
+func TestHistoryStats(t *testing.T) {
+	ctx := context.Background()
+	history := server.NewMemoryHistory(100)
+	defer history.Close()
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i, entry := range []server.HistoryEntry{
+		{CreatedAt: day.Add(time.Hour), Success: true, UseCase: "uc1", DurationMs: 100},
+		{CreatedAt: day.Add(2 * time.Hour), UseCase: "uc1", Profile: "prod", DurationMs: 200, Codes: []string{"HHV004", "HHV101"}},
+		{CreatedAt: day.Add(26 * time.Hour), UseCase: "uc2", DurationMs: 300, Codes: []string{"HHV101"}, Cached: true},
+		// Outside the period
+		{CreatedAt: day.Add(-time.Hour), UseCase: "uc1", Codes: []string{"HHV001"}},
+	} {
+		entry.ID = fmt.Sprintf("e%d", i)
+		require.NoError(t, history.Add(ctx, &entry))
+	}
+
+	stats, err := server.CollectStats(ctx, history, server.HistoryQuery{Since: day, Until: day.AddDate(0, 0, 3)}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Validations)
+	assert.Equal(t, 2, stats.Failed)
+	assert.Equal(t, 1, stats.Cached)
+	assert.InDelta(t, 2.0/3, stats.FailureRate, 0.001)
+	assert.Equal(t, int64(200), stats.MeanDurationMs)
+	assert.Equal(t, []server.DayStats{
+		{Date: "2024-05-01", Validations: 2, Failed: 1},
+		{Date: "2024-05-02", Validations: 1, Failed: 1},
+		{Date: "2024-05-03"},
+	}, stats.Days)
+	assert.Equal(t, []server.CodeStats{{Code: "HHV101", Validations: 2}}, stats.TopCodes)
+	assert.Equal(t, map[string]int{"uc1": 2, "uc2": 1}, stats.UseCases)
+	assert.Equal(t, map[string]int{"prod": 1}, stats.Profiles)
+
+	// Filters apply as in listings
+	stats, err = server.CollectStats(ctx, history, server.HistoryQuery{Since: day, Until: day.AddDate(0, 0, 3), UseCase: "uc2"}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Validations)
+}
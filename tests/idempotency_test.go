@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+// idempotencyServer returns the router of a server whose hhfab counts its
+// runs in the returned file.
+func idempotencyServer(t *testing.T) (*gin.Engine, string) {
+	t.Helper()
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	hhfab := filepath.Join(dir, "hhfab")
+	script := fmt.Sprintf("#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml;;\n  validate) echo run >> %s; echo \"INF validated\";;\nesac\n", runs)
+	require.NoError(t, os.WriteFile(hhfab, []byte(script), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	return s.Router(), runs
+}
+
+func countRuns(t *testing.T, runs string) int {
+	data, err := os.ReadFile(runs)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return strings.Count(string(data), "run")
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, runs := idempotencyServer(t)
+	validate := func(key, wiring string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(wiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set(server.IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The replay answers with the first result without running hhfab
+	first := validate("ci-run-1", connectionWiring)
+	assert.Empty(t, first.Header().Get(server.IdempotentReplayedHeader))
+	replay := validate("ci-run-1", connectionWiring)
+	assert.Equal(t, "true", replay.Header().Get(server.IdempotentReplayedHeader))
+	assert.Equal(t, first.Code, replay.Code)
+	assert.JSONEq(t, strings.Replace(first.Body.String(), first.Header().Get(server.RequestIDHeader), replay.Header().Get(server.RequestIDHeader), 1), replay.Body.String())
+	assert.Equal(t, 1, countRuns(t, runs))
+
+	// Reusing the key for other files is refused
+	mismatch := validate("ci-run-1", strings.Replace(connectionWiring, "leaf-01", "leaf-09", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+	var problem struct {
+		api.Problem
+		Idempotency *api.IdempotencyConflict `json:"idempotency"`
+	}
+	require.NoError(t, json.Unmarshal(mismatch.Body.Bytes(), &problem))
+	assert.Equal(t, api.ProblemIdempotency, problem.Type)
+	assert.Equal(t, &api.IdempotencyConflict{Key: "ci-run-1", Reason: api.IdempotencyMismatch}, problem.Idempotency)
+	assert.Equal(t, 1, countRuns(t, runs))
+
+	// Other keys run again, invalid ones are rejected
+	validate("ci-run-2", connectionWiring)
+	assert.Equal(t, 2, countRuns(t, runs))
+	assert.Equal(t, http.StatusBadRequest, validate(strings.Repeat("k", 256), connectionWiring).Code)
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	store := server.NewMemoryIdempotency(10, time.Hour)
+	pending := &server.IdempotencyRecord{RequestHash: "a", Pending: true}
+
+	taken, err := store.Claim(ctx, "key", pending, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, taken)
+
+	// A second request with the key finds the first still running
+	taken, err = store.Claim(ctx, "key", pending, time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, taken)
+	assert.True(t, taken.Pending)
+
+	// Released keys are free again, finished ones hold the answer
+	require.NoError(t, store.Release(ctx, "key"))
+	taken, err = store.Claim(ctx, "key", pending, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, taken)
+	require.NoError(t, store.Finish(ctx, "key", &server.IdempotencyRecord{RequestHash: "a", Status: http.StatusOK, Response: &api.ValidateResponse{Success: true}}))
+	taken, err = store.Claim(ctx, "key", pending, time.Minute)
+	require.NoError(t, err)
+	require.NotNil(t, taken)
+	assert.False(t, taken.Pending)
+	assert.True(t, taken.Response.Success)
+
+	// Claims expire in case their replica went away
+	taken, err = store.Claim(ctx, "other", pending, time.Nanosecond)
+	require.NoError(t, err)
+	assert.Nil(t, taken)
+	time.Sleep(time.Millisecond)
+	taken, err = store.Claim(ctx, "other", pending, time.Minute)
+	require.NoError(t, err)
+	assert.Nil(t, taken)
+}
+
+func TestClientRetriesIdempotently(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, runs := idempotencyServer(t)
+
+	// The answer to the first attempt is lost on the way back
+	var attempts atomic.Int32
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(api.IdempotencyKeyHeader))
+		if attempts.Add(1) == 1 {
+			router.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL, client.WithRetries(2, time.Millisecond))
+	response, err := c.Validate(context.Background(), client.File{Name: "wiring.yaml", Data: []byte(connectionWiring)}, client.Params{})
+	require.NoError(t, err)
+	assert.False(t, response.Success)
+	assert.Equal(t, int32(2), attempts.Load())
+	require.Len(t, keys, 2)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[1])
+	assert.Equal(t, 1, countRuns(t, runs))
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+// incrementalHHFab logs the objects of every run to runs and warns about
+// the switches by their document number, like hhfab does.
+const incrementalHHFab = `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate)
+    echo $(grep -h 'name:' include/*.yaml | sed 's/.*name: //' | sort) >> %s
+    awk 'FNR == 1 && body { n++; body = 0 }
+      /^---/ { if (body) n++; body = 0; next }
+      NF && !/^#/ { body = 1 }
+      /name: leaf-0[12]$/ { print "06:38:17 WRN object " n + 1 ": " $2 " has no description" }' include/*.yaml
+    echo "06:38:17 INF validated";;
+esac
+`
+
+func TestIncrementalValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(fmt.Sprintf(incrementalHHFab, runs)), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\ntenants:\n  team-a:\n    api_keys: [key-a]\n  team-b:\n    api_keys: [key-b]\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	validate := func(key, scope, wiring string) server.ValidateResponse {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(wiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate?incremental="+scope, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response server.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.Incremental)
+		return response
+	}
+	// validated returns the objects of the last hhfab run, "" if there was
+	// none since the previous call
+	logged := 0
+	validated := func() string {
+		data, err := os.ReadFile(runs)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) == logged {
+			return ""
+		}
+		logged = len(lines)
+		return lines[len(lines)-1]
+	}
+	// warned returns the line of the hhfab warning about a switch
+	warned := func(response server.ValidateResponse, name string) int {
+		for _, d := range response.Diagnostics {
+			if d.Source == server.SourceHHFab && d.Object == "Switch/"+name {
+				return d.Line
+			}
+		}
+		t.Fatalf("no hhfab warning about %s in %+v", name, response.Diagnostics)
+		return 0
+	}
+	// at returns the line a switch starts at in a wiring
+	at := func(wiring, name string) int {
+		i := strings.Index(wiring, "kind: Switch\nmetadata:\n  name: "+name+"\n")
+		return strings.Count(wiring[:i], "\n")
+	}
+
+	// The first validation of the scope runs every group
+	first := validate("key-a", "fabric", shardedWiring)
+	assert.Equal(t, &server.IncrementalResult{Groups: 2, Reused: 0}, first.Incremental)
+	assert.Equal(t, "default leaf-01 leaf-02 server-01 server-01--leaf-01 server-02 server-02--leaf-02", validated())
+	assert.Equal(t, at(shardedWiring, "leaf-01"), warned(first, "leaf-01"))
+	assert.Equal(t, at(shardedWiring, "leaf-02"), warned(first, "leaf-02"))
+
+	// A change to leaf-01 revalidates its group only; the warning about the
+	// unchanged leaf-02 is reused at the line leaf-02 moved to
+	longer := strings.Replace(shardedWiring, "  name: leaf-01\n", "  name: leaf-01\nspec:\n  description: first\n  role: server-leaf\n", 1)
+	second := validate("key-a", "fabric", longer)
+	assert.Equal(t, &server.IncrementalResult{Groups: 2, Reused: 1}, second.Incremental)
+	assert.Equal(t, "default leaf-01 server-01 server-01--leaf-01", validated())
+	assert.True(t, second.Success)
+	assert.Equal(t, at(longer, "leaf-01"), warned(second, "leaf-01"))
+	assert.Equal(t, at(shardedWiring, "leaf-02")+3, warned(second, "leaf-02"))
+
+	// Revalidated groups behind a reused one are located in the upload too
+	renamed := strings.ReplaceAll(longer, "server-02/enp2s1", "server-02/enp2s2")
+	fourth := validate("key-a", "fabric", renamed)
+	assert.Equal(t, &server.IncrementalResult{Groups: 2, Reused: 1}, fourth.Incremental)
+	assert.Equal(t, "default leaf-02 server-02 server-02--leaf-02", validated())
+	assert.Equal(t, at(renamed, "leaf-01"), warned(fourth, "leaf-01"))
+	assert.Equal(t, at(renamed, "leaf-02"), warned(fourth, "leaf-02"))
+
+	// A change to the shared namespace every group depends on revalidates
+	// them all
+	namespace := strings.Replace(longer, "  name: default\n", "  name: default\nspec:\n  ranges:\n    - from: 1000\n      to: 2999\n", 1)
+	third := validate("key-a", "fabric", namespace)
+	assert.Equal(t, &server.IncrementalResult{Groups: 2, Reused: 0}, third.Incremental)
+	assert.Equal(t, "default leaf-01 leaf-02 server-01 server-01--leaf-01 server-02 server-02--leaf-02", validated())
+
+	// Another tenant does not reuse the results of the first in the same
+	// scope
+	other := validate("key-b", "fabric", shardedWiring)
+	assert.Equal(t, &server.IncrementalResult{Groups: 2, Reused: 0}, other.Incremental)
+	assert.Equal(t, "default leaf-01 leaf-02 server-01 server-01--leaf-01 server-02 server-02--leaf-02", validated())
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestHHFabIntegrity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	binary := []byte("#!/bin/sh\necho v0.41.1\n")
+	require.NoError(t, os.WriteFile(hhfab, binary, 0755))
+	sum := sha256.Sum256(binary)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nhhfab_sha256: %s\nworkspaces:\n  max_idle: 0\n", hhfab, hex.EncodeToString(sum[:]))
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	integrity := func() server.ReadinessCheck {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var response server.ReadinessResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		for _, check := range response.Checks {
+			if check.Name == "hhfab-integrity" {
+				return check
+			}
+		}
+		t.Fatalf("no integrity check in %s", w.Body.String())
+		return server.ReadinessCheck{}
+	}
+
+	// The binary matches its checksum
+	check := integrity()
+	assert.True(t, check.OK, check.Detail)
+	assert.Equal(t, "sha256 "+hex.EncodeToString(sum[:]), check.Detail)
+
+	// A binary that changed is not ready, and not healthy
+	require.NoError(t, os.WriteFile(hhfab, []byte("#!/bin/sh\necho broken\n"), 0755))
+	check = integrity()
+	assert.False(t, check.OK)
+	assert.Contains(t, check.Detail, "hhfab at "+hhfab+" changed: its sha256 is ")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var health server.HealthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &health))
+	assert.Equal(t, "unhealthy", health.Status)
+	assert.Equal(t, check.Detail, health.Error)
+
+	// Neither is one that went missing
+	require.NoError(t, os.Remove(hhfab))
+	check = integrity()
+	assert.False(t, check.OK)
+	assert.Contains(t, check.Detail, "hhfab at "+hhfab+" is missing")
+
+	// Restoring it makes the server ready again
+	require.NoError(t, os.WriteFile(hhfab, binary, 0755))
+	assert.True(t, integrity().OK)
+
+	// Checksums are validated
+	require.NoError(t, os.WriteFile(configFile, []byte("hhfab_sha256: abc\n"), 0644))
+	_, err = server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "hhfab_sha256 must be 64 hexadecimal digits")
+}
+
+func TestHHFabIntegrityFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	binary := []byte("#!/bin/sh\necho v0.41.1\n")
+	sum := sha256.Sum256(binary)
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nhhfab_sha256: %s\nschema_only_fallback: true\nworkspaces:\n  max_idle: 0\n", hhfab, hex.EncodeToString(sum[:]))
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	defer s.Close()
+	router := s.Router()
+
+	// The fallback validates without the missing hhfab, but the checksum
+	// names a binary that must be there
+	status, _, checks := readiness(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.True(t, checks["hhfab"].OK, checks["hhfab"].Detail)
+	assert.False(t, checks["hhfab-integrity"].OK)
+	assert.Contains(t, checks["hhfab-integrity"].Detail, "hhfab at "+hhfab+" is missing")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Nor does a binary of another checksum pass
+	require.NoError(t, os.WriteFile(hhfab, []byte("#!/bin/sh\necho broken\n"), 0755))
+	status, _, checks = readiness(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Contains(t, checks["hhfab-integrity"].Detail, "hhfab at "+hhfab+" changed: its sha256 is ")
+
+	// Backends without hhfab do not check it
+	require.NoError(t, os.Remove(hhfab))
+	require.NoError(t, os.WriteFile(configFile, []byte(config+"backend: schema-only\n"), 0644))
+	s, err = server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	defer s.Close()
+	_, _, checks = readiness(t, s.Router())
+	assert.True(t, checks["hhfab-integrity"].OK)
+	assert.Equal(t, "not used by the schema-only backend", checks["hhfab-integrity"].Detail)
+}
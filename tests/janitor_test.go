@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestJanitor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, "tmp")
+	require.NoError(t, os.Mkdir(tmp, 0755))
+	t.Setenv("TMPDIR", tmp)
+
+	// Directories a crashed server left behind, one of them still changing,
+	// and one of someone else
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"validator-orphan", "validator-recent", "other-orphan"} {
+		require.NoError(t, os.Mkdir(filepath.Join(tmp, name), 0755))
+	}
+	require.NoError(t, os.Chtimes(filepath.Join(tmp, "validator-orphan"), old, old))
+	require.NoError(t, os.Chtimes(filepath.Join(tmp, "other-orphan"), old, old))
+
+	hhfab := filepath.Join(dir, "hhfab")
+	script := "#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml;;\n  validate) echo \"06:38:17 INF validated\";;\nesac\n"
+	require.NoError(t, os.WriteFile(hhfab, []byte(script), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\ncache:\n  backend: none\nworkspaces:\n  max_idle: 1\ntemp:\n  quota_mb: 1\n  interval_seconds: 1\n  orphan_age_seconds: 60\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	s, err := server.New(server.Options{Port: port, ConfigFile: configFile})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// validate returns the status and body of a validation, 0 while the
+	// server is not listening yet
+	validate := func() (int, string) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(shardedWiring))
+		require.NoError(t, writer.Close())
+		response, err := http.Post("http://127.0.0.1:"+port+"/validate", writer.FormDataContentType(), body)
+		if err != nil {
+			return 0, ""
+		}
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response.StatusCode, string(data)
+	}
+
+	// Only the orphans of the validator are removed
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(tmp, "validator-orphan"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.DirExists(t, filepath.Join(tmp, "validator-recent"))
+	assert.DirExists(t, filepath.Join(tmp, "other-orphan"))
+
+	// The idle workspace of the server is kept however old it looks
+	var workspaces []string
+	require.Eventually(t, func() bool {
+		workspaces, _ = filepath.Glob(filepath.Join(tmp, "validator-workspace-*"))
+		return len(workspaces) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+	require.NoError(t, os.Chtimes(workspaces[0], old, old))
+	time.Sleep(2500 * time.Millisecond)
+	assert.DirExists(t, workspaces[0])
+	require.Eventually(t, func() bool {
+		status, _ := validate()
+		return status == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Over the quota, validations are refused and the idle workspace is
+	// dropped until space is freed
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "validator-recent", "large"), make([]byte, 2*1024*1024), 0644))
+	var refused string
+	require.Eventually(t, func() bool {
+		var status int
+		status, refused = validate()
+		return status == http.StatusServiceUnavailable
+	}, 5*time.Second, 100*time.Millisecond)
+	assert.Contains(t, refused, "Temporary disk quota exceeded")
+	assert.Contains(t, refused, "of the 1 MB quota")
+	require.Eventually(t, func() bool {
+		workspaces, _ = filepath.Glob(filepath.Join(tmp, "validator-workspace-*"))
+		return len(workspaces) == 0
+	}, 5*time.Second, 20*time.Millisecond)
+
+	require.NoError(t, os.Remove(filepath.Join(tmp, "validator-recent", "large")))
+	require.Eventually(t, func() bool {
+		status, _ := validate()
+		return status == http.StatusOK
+	}, 5*time.Second, 100*time.Millisecond)
+}
@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func testJobQueue(t *testing.T, queue server.JobQueue) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, queue.Ping(ctx))
+
+	_, err := queue.Get(ctx, "missing")
+	assert.ErrorIs(t, err, server.ErrJobNotFound)
+
+	for _, id := range []string{"job-1", "job-2"} {
+		job := &server.Job{ID: id, Status: server.JobQueued, CreatedAt: time.Now().UTC()}
+		request := &server.JobRequest{Wiring: []server.Upload{{Name: id + ".yaml", Data: []byte("kind: Switch\n")}}}
+		require.NoError(t, queue.Enqueue(ctx, job, request))
+	}
+	queued, err := queue.Queued(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, queued)
+
+	// Jobs run in the order they were queued
+	job, request, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "job-1", job.ID)
+	assert.Equal(t, server.JobRunning, job.Status)
+	assert.NotNil(t, job.StartedAt)
+	assert.Equal(t, "job-1.yaml", request.Wiring[0].Name)
+	assert.Equal(t, []byte("kind: Switch\n"), request.Wiring[0].Data)
+
+	stored, err := queue.Get(ctx, "job-1")
+	require.NoError(t, err)
+	assert.Equal(t, server.JobRunning, stored.Status)
+
+	finished := time.Now().UTC()
+	job.Status, job.FinishedAt = server.JobDone, &finished
+	job.HTTPStatus, job.Result = http.StatusOK, &server.ValidateResponse{Success: true, UseCase: "uc1"}
+	require.NoError(t, queue.Finish(ctx, job))
+
+	stored, err = queue.Get(ctx, "job-1")
+	require.NoError(t, err)
+	assert.Equal(t, server.JobDone, stored.Status)
+	assert.Equal(t, http.StatusOK, stored.HTTPStatus)
+	require.NotNil(t, stored.Result)
+	assert.True(t, stored.Result.Success)
+
+	job, _, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "job-2", job.ID)
+
+	// Dequeue waits for jobs until its context is done
+	waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer waitCancel()
+	_, _, err = queue.Dequeue(waitCtx)
+	assert.Error(t, err)
+}
+
+func TestJobsMemory(t *testing.T) {
+	queue := server.NewMemoryQueue(time.Hour)
+	defer queue.Close()
+	testJobQueue(t, queue)
+
+	// Running jobs end with the process, there is nothing to recover
+	recovered, err := queue.Recover(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+}
+
+func TestJobsRedis(t *testing.T) {
+	redis := miniredis.RunT(t)
+	queue, err := server.NewRedisQueue("redis://"+redis.Addr(), "test", time.Hour)
+	require.NoError(t, err)
+	defer queue.Close()
+	testJobQueue(t, queue)
+
+	// Finished jobs expire after the retention
+	assert.Greater(t, redis.TTL("test:job:job-1"), time.Duration(0))
+	assert.False(t, redis.Exists("test:request:job-1"))
+
+	// job-2 is still running, as if its replica had stopped
+	ctx := context.Background()
+	recovered, err := queue.Recover(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+	recovered, err = queue.Recover(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+
+	job, err := queue.Get(ctx, "job-2")
+	require.NoError(t, err)
+	assert.Equal(t, server.JobQueued, job.Status)
+	job, request, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "job-2", job.ID)
+	assert.Equal(t, "job-2.yaml", request.Wiring[0].Name)
+
+	// A second replica shares the state
+	other, err := server.NewRedisQueue("redis://"+redis.Addr(), "test", time.Hour)
+	require.NoError(t, err)
+	defer other.Close()
+	job, err = other.Get(ctx, "job-1")
+	require.NoError(t, err)
+	assert.Equal(t, server.JobDone, job.Status)
+}
+
+// catHHFab prints the wiring it validates, so that results show what was
+// uploaded
+const catHHFab = `#!/bin/sh
+if [ "$1" = init ]; then
+	touch fab.yaml
+	exit 0
+fi
+cat include/*.yaml
+`
+
+func TestJobsStreamedUpload(t *testing.T) {
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(catHHFab), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("hhfab_path: "+hhfab+"\n"), 0644))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	s, err := server.New(server.Options{Port: port, ConfigFile: configFile})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	wiring := "apiVersion: wiring.githedgehog.com/v1beta1\nkind: Switch\nmetadata:\n  name: leaf-01\n"
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(wiring))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	var response *http.Response
+	require.Eventually(t, func() bool {
+		response, err = http.Post("http://"+addr+"/validate?async=true", form.FormDataContentType(), bytes.NewReader(body.Bytes()))
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	var job server.Job
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&job))
+	response.Body.Close()
+	require.Equal(t, http.StatusAccepted, response.StatusCode)
+
+	// The upload was streamed to a file removed with the request, the job
+	// still validates it
+	require.Eventually(t, func() bool {
+		response, err := http.Get("http://" + addr + "/jobs/" + job.ID)
+		if err != nil {
+			return false
+		}
+		defer response.Body.Close()
+		job = server.Job{}
+		return json.NewDecoder(response.Body).Decode(&job) == nil && job.Status == server.JobDone
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, http.StatusOK, job.HTTPStatus)
+	require.NotNil(t, job.Result)
+	assert.True(t, job.Result.Success, job.Result.Error)
+	assert.Contains(t, job.Result.Output, "name: leaf-01")
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/server"
+)
+
+// fakeKubeconform finds the role of every switch wrong, once it was given
+// the schema of switches.
+const fakeKubeconform = `#!/bin/sh
+schemas=$(dirname "$(dirname "$5")")
+[ -f "$schemas/wiring.githedgehog.com/switch_v1beta1.json" ] || { echo "no schema" >&2; exit 2; }
+for file; do :; done
+cat <<EOF
+{"resources": [{"filename": "$file", "kind": "Switch", "name": "leaf-01", "version": "wiring.githedgehog.com/v1beta1", "status": "statusInvalid", "msg": "invalid", "validationErrors": [{"path": "/spec/role", "msg": "value must be one of 'spine', 'server-leaf'"}]}]}
+EOF
+exit 1
+`
+
+const kubeconformWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: server-leaf
+  description: leaf-01
+`
+
+func TestKubeconform(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kubeconform := filepath.Join(t.TempDir(), "kubeconform")
+	require.NoError(t, os.WriteFile(kubeconform, []byte(fakeKubeconform), 0755))
+
+	validate := func(settings string) (int, server.ValidateResponse) {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		config := fmt.Sprintf("backend: mock\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\nkubeconform:\n%s", settings)
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(kubeconformWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		s.Router().ServeHTTP(w, req)
+		var response server.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+	finding := func(response server.ValidateResponse) *server.Diagnostic {
+		for i, d := range response.Diagnostics {
+			if d.Source == server.SourceKubeconform {
+				return &response.Diagnostics[i]
+			}
+		}
+		return nil
+	}
+
+	// Findings are warnings by default, located in the upload
+	status, response := validate("  path: " + kubeconform + "\n")
+	d := finding(response)
+	require.NotNil(t, d, response.Diagnostics)
+	assert.Equal(t, server.Diagnostic{
+		Severity: server.SeverityWarning,
+		Code:     codes.InvalidField,
+		Message:  "Switch/leaf-01: spec.role: value must be one of 'spine', 'server-leaf'",
+		Source:   server.SourceKubeconform,
+		File:     "wiring.yaml",
+		Line:     6,
+		Object:   "Switch/leaf-01",
+		Path:     "spec.role",
+	}, *d)
+	assert.Equal(t, http.StatusOK, status)
+
+	// As errors they fail the validation
+	status, response = validate("  path: " + kubeconform + "\n  severity: error\n")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, server.SeverityError, finding(response).Severity)
+
+	// A kubeconform that cannot run is skipped with a warning
+	_, response = validate("  path: " + filepath.Join(t.TempDir(), "kubeconform") + "\n")
+	assert.Contains(t, finding(response).Message, "kubeconform could not run, its checks were skipped")
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestMockBackend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	// hhfab is nowhere to be found
+	config := "hhfab_path: " + filepath.Join(t.TempDir(), "hhfab") + "\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	t.Setenv("VALIDATOR_BACKEND", "mock")
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	validate := func(wiring string) (int, server.ValidateResponse) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(wiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response server.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Samples are canned as well, and pass
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/generate/sample", bytes.NewBufferString("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var sample server.SampleResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sample))
+	assert.Contains(t, sample.Fab, "kind: Fabricator")
+	wiring := sample.Wiring
+
+	status, response := validate(wiring)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, response.Success)
+
+	// Magic comments pick the result
+	status, response = validate("# hh-validator-mock: invalid leaf-01 is not cabled\n" + wiring)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.False(t, response.Success)
+	assert.Contains(t, response.Output, "ERR validating: leaf-01 is not cabled")
+
+	status, response = validate("# hh-validator-mock: warning leaf-01 has no description\n" + wiring)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, response.Success)
+	assert.Contains(t, response.Output, "WRN leaf-01 has no description")
+
+	// The backend must be one that exists
+	t.Setenv("VALIDATOR_BACKEND", "stub")
+	_, err = server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "backend must be hhfab, mock or schema-only")
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/plugins"
+	"validator/internal/rules"
+	"validator/internal/wiring"
+)
+
+// buildExamplePlugin compiles the require-boot example plugin into dir.
+func buildExamplePlugin(t *testing.T, dir string) {
+	cmd := exec.Command("go", "build", "-o", filepath.Join(dir, "require-boot.wasm"), "./examples/plugins/require-boot")
+	cmd.Dir = ".."
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("building the example plugin: %v\n%s", err, output)
+	}
+}
+
+func TestPlugins(t *testing.T) {
+	dir := t.TempDir()
+	buildExamplePlugin(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a plugin"), 0644))
+
+	set, err := plugins.Load(context.Background(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"require-boot"}, set.Names())
+
+	objects, err := wiring.Parse([]byte(`apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: server-leaf
+  boot:
+    serial: ABC123
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-02
+spec:
+  role: server-leaf
+  boot:
+    other: value
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+`), "wiring.yaml")
+	require.NoError(t, err)
+
+	findings := set.Check(context.Background(), objects)
+	require.Len(t, findings, 1)
+	assert.Equal(t, rules.Finding{
+		Rule:     "require-boot",
+		Code:     codes.Plugin,
+		Severity: rules.SeverityWarning,
+		Message:  "Switch/leaf-02: no spec.boot.serial or spec.boot.mac to provision the switch by",
+		Object:   "Switch/leaf-02",
+		File:     "wiring.yaml",
+		Line:     17,
+		Path:     "spec.boot",
+	}, findings[0])
+
+	// Plugins that time out fail instead of passing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	findings = set.Check(ctx, objects)
+	require.Len(t, findings, 1)
+	assert.Equal(t, rules.SeverityError, findings[0].Severity)
+	assert.Contains(t, findings[0].Message, "plugin require-boot failed")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.wasm"), []byte("not wasm"), 0644))
+	_, err = plugins.Load(context.Background(), dir)
+	assert.ErrorContains(t, err, "compiling plugin broken.wasm")
+}
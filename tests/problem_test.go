@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+func TestProblemResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := "hhfab_path: /nonexistent/hhfab\nschema_only_fallback: true\nupload_limits:\n  fab: 16\ntenants:\n  network-team:\n    api_keys: [team-key]\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	send := func(req *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var document map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+		return w, document
+	}
+	upload := func(files map[string]string) *http.Request {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for field, content := range files {
+			part, err := writer.CreateFormFile(field, field+".yaml")
+			require.NoError(t, err)
+			part.Write([]byte(content))
+		}
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+
+	// Failed validations are problems extended by their result
+	w, document := send(upload(map[string]string{"wiring": connectionWiring}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, api.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, api.ProblemValidationFailed, document["type"])
+	assert.Equal(t, float64(http.StatusBadRequest), document["status"])
+	assert.Equal(t, document["message"], document["title"])
+	assert.Equal(t, w.Header().Get(server.RequestIDHeader), document["instance"])
+	assert.NotEmpty(t, document["diagnostics"])
+
+	// Rejected requests name the problem and keep their extensions
+	w, document = send(upload(map[string]string{"wiring": connectionWiring, "fab": strings.Repeat("x", 64)}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, api.ProblemUploadTooLarge, document["type"])
+	assert.Equal(t, "File too large", document["title"])
+	assert.Contains(t, document["detail"], "larger than 16 bytes")
+	assert.Equal(t, "fab", document["limit"].(map[string]any)["field"])
+
+	req := httptest.NewRequest(http.MethodGet, "/history", nil)
+	req.Header.Set("X-API-Key", "stolen-key")
+	req.Header.Set(server.RequestIDHeader, "ci-run-42")
+	w, document = send(req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, api.ProblemUnauthorized, document["type"])
+	assert.Equal(t, "Unauthorized", document["title"])
+	assert.Equal(t, "unknown API key", document["detail"])
+	assert.Equal(t, "ci-run-42", document["instance"])
+	assert.Equal(t, "ci-run-42", w.Header().Get(server.RequestIDHeader))
+
+	w, document = send(httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, api.ProblemNotFound, document["type"])
+	assert.Equal(t, "no endpoint GET /nope", document["detail"])
+
+	// Successful responses stay plain JSON
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "application/json"))
+
+	// The client reports the problem
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	_, err = client.New(srv.URL, client.WithToken("stolen-key")).History(context.Background(), client.HistoryQuery{})
+	var status *client.StatusError
+	require.ErrorAs(t, err, &status)
+	require.NotNil(t, status.Problem)
+	assert.Equal(t, api.ProblemUnauthorized, status.Problem.Type)
+	assert.Equal(t, "request rejected (401): Unauthorized: unknown API key", err.Error())
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+func processValidate(t *testing.T, script string, timeout int) api.ValidateResponse {
+	t.Helper()
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(script), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\ntimeout_seconds: %d\nworkspaces:\n  max_idle: 0\n", hhfab, timeout)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(connectionWiring))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/validate?cache=false", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.Router().ServeHTTP(w, req)
+	var response api.ValidateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response), w.Body.String())
+	return response
+}
+
+func TestProcessStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	response := processValidate(t, `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate) echo "checking wiring"; echo "ERR validating: port taken" >&2; echo "done"; exit 3;;
+esac
+`, 30)
+
+	// Output interleaves the streams the process keeps apart, in the order
+	// the pipes were read
+	require.NotNil(t, response.Process)
+	assert.ElementsMatch(t, []string{"checking wiring", "ERR validating: port taken", "done"}, strings.Split(strings.TrimSuffix(response.Output, "\n"), "\n"))
+	assert.Equal(t, "checking wiring\ndone\n", response.Process.Stdout)
+	assert.Equal(t, "ERR validating: port taken\n", response.Process.Stderr)
+	assert.Equal(t, 3, response.Process.ExitCode)
+	assert.Empty(t, response.Process.Signal)
+	assert.False(t, response.Process.TimedOut)
+}
+
+func TestProcessTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	response := processValidate(t, `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate) echo "checking wiring"; exec sleep 10;;
+esac
+`, 1)
+
+	require.NotNil(t, response.Process)
+	assert.False(t, response.Success)
+	assert.Equal(t, "checking wiring\n", response.Process.Stdout)
+	assert.Equal(t, -1, response.Process.ExitCode)
+	assert.Equal(t, "killed", response.Process.Signal)
+	assert.True(t, response.Process.TimedOut)
+}
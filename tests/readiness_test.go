@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+// readiness fetches /readyz from handler, returning its checks by name.
+func readiness(t *testing.T, handler http.Handler) (int, server.ReadinessResponse, map[string]server.ReadinessCheck) {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var response server.ReadinessResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	checks := map[string]server.ReadinessCheck{}
+	for _, check := range response.Checks {
+		checks[check.Name] = check
+	}
+	return w.Code, response, checks
+}
+
+func TestReadiness(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte("#!/bin/sh\necho v0.41.1\n"), 0755))
+	redis := miniredis.RunT(t)
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\nreadiness:\n  self_check_interval_seconds: 3600\ncache:\n  backend: redis\n  redis_url: redis://%s\n", hhfab, redis.Addr())
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	s, err := server.New(server.Options{Port: port, ConfigFile: configFile})
+	require.NoError(t, err)
+	defer s.Close()
+	router := s.Router()
+
+	// Not ready until hhfab was tried
+	status, response, checks := readiness(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "not ready", response.Status)
+	assert.False(t, checks["hhfab"].OK)
+	assert.Equal(t, "self-check has not completed yet", checks["hhfab"].Detail)
+	assert.True(t, checks["cache"].OK, checks["cache"].Detail)
+
+	// Run checks hhfab in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	require.Eventually(t, func() bool {
+		status, _, _ := readiness(t, router)
+		return status == http.StatusOK
+	}, 5*time.Second, 20*time.Millisecond)
+	_, response, checks = readiness(t, router)
+	assert.Equal(t, "ready", response.Status)
+	for name, check := range checks {
+		assert.True(t, check.OK, "%s: %s", name, check.Detail)
+	}
+
+	// Probes answer from the last self-check, hhfab is not run again
+	require.NoError(t, os.WriteFile(hhfab, []byte("#!/bin/sh\nexit 1\n"), 0755))
+	status, _, checks = readiness(t, router)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, checks["hhfab"].OK)
+
+	// A store that went away makes the server unready, naming it
+	redis.Close()
+	status, response, checks = readiness(t, router)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, "not ready", response.Status)
+	assert.False(t, checks["cache"].OK)
+	assert.Contains(t, checks["cache"].Detail, "redis: ")
+	assert.True(t, checks["hhfab"].OK)
+	assert.True(t, checks["jobs"].OK)
+}
+
+func TestReadinessDisk(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("backend: schema-only\nworkspaces:\n  max_idle: 0\nreadiness:\n  min_free_disk_mb: 1000000000000\n"), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	defer s.Close()
+
+	// hhfab is not needed by the schema-only backend, the disk is full
+	status, _, checks := readiness(t, s.Router())
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.True(t, checks["hhfab"].OK)
+	assert.Equal(t, "not available, validating against schemas only", checks["hhfab"].Detail)
+	assert.False(t, checks["disk"].OK)
+	assert.Contains(t, checks["disk"].Detail, "MB free in ")
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/hhfabrelease"
+	"validator/internal/server"
+)
+
+const releaseBinary = "#!/bin/sh\necho v0.41.1\n"
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseServer serves the files by path and counts the downloads.
+func releaseServer(t *testing.T, files map[string][]byte) (*httptest.Server, *int) {
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		downloads++
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &downloads
+}
+
+func TestHHFabReleaseInstall(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	binary := []byte(releaseBinary)
+	prefix := fmt.Sprintf("/v0.41.1/hhfab-%s-%s", runtime.GOOS, runtime.GOARCH)
+	srv, downloads := releaseServer(t, map[string][]byte{
+		prefix:          binary,
+		prefix + ".sig": []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, binary))),
+		"/bad.sig":      ed25519.Sign(private, []byte("something else")),
+	})
+	dir := t.TempDir()
+	source := hhfabrelease.Source{
+		URL:          srv.URL + "/{version}/hhfab-{os}-{arch}",
+		SignatureURL: srv.URL + "/{version}/hhfab-{os}-{arch}.sig",
+		PublicKey:    public,
+	}
+	release := hhfabrelease.Release{Version: "v0.41.1", SHA256: sha256Hex(binary)}
+
+	// The verified download is installed in the directory of its version
+	path, downloaded, err := source.Install(context.Background(), dir, release)
+	require.NoError(t, err)
+	assert.True(t, downloaded)
+	assert.Equal(t, filepath.Join(dir, "v0.41.1", "hhfab"), path)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&0100)
+	installed, err := hhfabrelease.Installed(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v0.41.1"}, installed)
+
+	// and not downloaded again
+	_, downloaded, err = source.Install(context.Background(), dir, release)
+	require.NoError(t, err)
+	assert.False(t, downloaded)
+	assert.Equal(t, 2, *downloads)
+
+	// Downloads not matching their checksum or signature are not installed
+	other := t.TempDir()
+	_, _, err = source.Install(context.Background(), other, hhfabrelease.Release{Version: "v0.41.1", SHA256: strings.Repeat("0", 64)})
+	assert.ErrorContains(t, err, "checksum mismatch")
+	forged := source
+	forged.SignatureURL = srv.URL + "/bad.sig"
+	_, _, err = forged.Install(context.Background(), other, release)
+	assert.ErrorContains(t, err, "signature does not match the public key")
+	installed, err = hhfabrelease.Installed(other)
+	require.NoError(t, err)
+	assert.Empty(t, installed)
+
+	assert.ErrorContains(t, hhfabrelease.Release{Version: "../v1", SHA256: release.SHA256}.Validate(), "invalid hhfab version")
+}
+
+func TestHHFabReleaseArchive(t *testing.T) {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "bin/hhfab", Mode: 0755, Size: int64(len(releaseBinary)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte(releaseBinary))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	srv, _ := releaseServer(t, map[string][]byte{"/v0.41.1/hhfab.tar.gz": archive.Bytes()})
+
+	// Archives are checked as downloaded, their hhfab is installed
+	source := hhfabrelease.Source{URL: srv.URL + "/{version}/hhfab.tar.gz"}
+	path, _, err := source.Install(context.Background(), t.TempDir(), hhfabrelease.Release{Version: "v0.41.1", SHA256: sha256Hex(archive.Bytes())})
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, releaseBinary, string(data))
+}
+
+func TestHHFabReleaseAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	binary := []byte(releaseBinary)
+	srv, _ := releaseServer(t, map[string][]byte{"/v0.41.1/hhfab": binary})
+	dir := filepath.Join(t.TempDir(), "hhfab")
+	newServer := func(releases string) (*server.Server, error) {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		config := "admin_token: admin-token\nworkspaces:\n  max_idle: 0\nhhfab_releases:\n" + releases
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		return server.New(server.Options{ConfigFile: configFile})
+	}
+	s, err := newServer(fmt.Sprintf("  dir: %s\n  url: %s/{version}/hhfab\n  use: v0.41.1\n", dir, srv.URL))
+	require.NoError(t, err)
+	router := s.Router()
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := admin(http.MethodPost, "/admin/hhfab/install", fmt.Sprintf(`{"version": "v0.41.1", "sha256": %q}`, sha256Hex(binary)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var install server.HHFabInstall
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &install))
+	assert.Equal(t, server.HHFabInstall{Version: "v0.41.1", Path: filepath.Join(dir, "v0.41.1", "hhfab"), Downloaded: true}, install)
+
+	w = admin(http.MethodGet, "/admin/hhfab", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var releases server.HHFabReleases
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &releases))
+	assert.Equal(t, server.HHFabReleases{Dir: dir, Installed: []string{"v0.41.1"}, Use: "v0.41.1"}, releases)
+
+	// Validations run the release in use, which prints its version
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(kubeconformWiring))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/validate", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response server.ValidateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "v0.41.1\n", response.Output)
+
+	w = admin(http.MethodPost, "/admin/hhfab/install", `{"version": "v0.41.2", "sha256": "abc"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = admin(http.MethodPost, "/admin/hhfab/install", fmt.Sprintf(`{"version": "v0.41.2", "sha256": %q}`, sha256Hex(binary)))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "404 Not Found")
+
+	_, err = newServer("  use: v0.41.1\n")
+	assert.ErrorContains(t, err, "hhfab_releases.dir is required")
+	_, err = newServer(fmt.Sprintf("  dir: %s\n  install:\n    - version: v0.41.1\n", dir))
+	assert.ErrorContains(t, err, "hhfab_releases.url is required")
+	_, err = newServer(fmt.Sprintf("  dir: %s\n  url: %s\n  install:\n    - version: v0.41.1\n", dir, srv.URL))
+	assert.ErrorContains(t, err, "sha256 must be 64 hexadecimal digits")
+}
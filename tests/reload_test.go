@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/server"
+	"validator/pkg/client"
+)
+
+func TestConfigReload(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	// Files are replaced as a whole, as mounted ConfigMaps are
+	writeConfig := func(config string) {
+		temp := filepath.Join(dir, "config.yaml.new")
+		require.NoError(t, os.WriteFile(temp, []byte(config), 0644))
+		require.NoError(t, os.Rename(temp, configFile))
+	}
+	config := func(versions string) string {
+		return "backend: mock\nworkspaces:\n  max_idle: 0\nprofiles:\n  team:\n    api_versions: [" + versions + "]\n"
+	}
+	writeConfig(config("wiring.githedgehog.com/v1beta1"))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	_, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	s, err := server.New(server.Options{Port: port, ConfigFile: configFile})
+	require.NoError(t, err)
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	c := client.New("http://" + addr)
+	validate := func() *client.ValidateResponse {
+		response, _ := c.Validate(ctx, client.File{Name: "wiring.yaml", Data: []byte(kubeconformWiring)}, client.Params{Profile: "team"})
+		return response
+	}
+	require.Eventually(t, func() bool {
+		response := validate()
+		return response != nil && response.Success
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// Changes apply to the next validations without a restart
+	writeConfig(config("wiring.githedgehog.com/v1alpha2"))
+	require.Eventually(t, func() bool {
+		response := validate()
+		return response != nil && !response.Success
+	}, 5*time.Second, 20*time.Millisecond)
+	response := validate()
+	require.NotEmpty(t, response.Diagnostics)
+	assert.Equal(t, codes.InvalidField, response.Diagnostics[0].Code)
+	assert.Contains(t, response.Diagnostics[0].Message, "is not allowed by the profile")
+
+	// Invalid changes are ignored, the last valid configuration stays
+	writeConfig("timeout_seconds: -1\n" + config("wiring.githedgehog.com/v1beta1"))
+	time.Sleep(time.Second)
+	response = validate()
+	require.NotNil(t, response)
+	assert.False(t, response.Success)
+
+	writeConfig(config("wiring.githedgehog.com/v1beta1"))
+	require.Eventually(t, func() bool {
+		response := validate()
+		return response != nil && response.Success
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/report"
+	"validator/pkg/api"
+)
+
+func TestReportHTML(t *testing.T) {
+	response := &api.ValidateResponse{
+		Success: false,
+		Message: "Validation failed",
+		UseCase: "uc1",
+		Diagnostics: []api.Diagnostic{{
+			Severity: api.SeverityError,
+			Code:     "HHV004",
+			Message:  "port E1/1 of <leaf-01> already used",
+			Source:   api.SourceHHFab,
+			File:     "wiring.yaml",
+			Line:     2,
+		}},
+		Objects: []api.ObjectResult{{Kind: "Switch", Name: "leaf-01", File: "wiring.yaml", Line: 1, Status: api.ObjectFailed}},
+		Summary: &api.Summary{Errors: 1, Objects: 1},
+	}
+
+	var page bytes.Buffer
+	require.NoError(t, report.WriteHTML(&page, report.Input{
+		Response:  response,
+		Wiring:    []report.File{{Name: "wiring.yaml", Data: []byte(connectionWiring)}},
+		Generated: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}))
+	html := page.String()
+
+	assert.Contains(t, html, `<span class="badge failed">failed</span>`)
+	assert.Contains(t, html, "Generated 2024-05-01T00:00:00Z")
+	// Messages are escaped
+	assert.Contains(t, html, "port E1/1 of &lt;leaf-01&gt; already used")
+	// The offending line is quoted
+	assert.Contains(t, html, `<span class="offending"><span class="number">2</span>kind: Switch</span>`)
+	assert.Contains(t, html, "<svg ")
+	assert.Contains(t, html, "<title>Switch/leaf-01</title>")
+
+	// Wiring that does not parse has no graph
+	page.Reset()
+	require.NoError(t, report.WriteHTML(&page, report.Input{
+		Response: response,
+		Wiring:   []report.File{{Name: "wiring.yaml", Data: []byte("kind: [")}},
+	}))
+	assert.NotContains(t, page.String(), "<svg ")
+	assert.Contains(t, page.String(), "No graph:")
+
+	// Recorded results name the files without their data
+	page.Reset()
+	require.NoError(t, report.WriteHTML(&page, report.Input{
+		Response: response,
+		Wiring:   []report.File{{Name: "wiring.yaml"}},
+	}))
+	assert.Contains(t, page.String(), "<code>wiring.yaml</code>")
+	assert.Contains(t, page.String(), "No graph: the wiring files are not kept with the result")
+	assert.NotContains(t, page.String(), `class="offending"`)
+}
+
+func TestReportMarkdown(t *testing.T) {
+	failed := report.Input{
+		Name: "a.yaml",
+		Response: &api.ValidateResponse{
+			UseCase: "uc1",
+			Output:  "```\nERR port already used",
+			Diagnostics: []api.Diagnostic{{
+				Severity: api.SeverityError,
+				Code:     "HHV004",
+				Message:  "port E1/1 | <used>",
+				File:     "a.yaml",
+				Line:     2,
+			}},
+			Summary: &api.Summary{Errors: 1},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, report.WriteMarkdown(&out, failed))
+	markdown := out.String()
+	assert.True(t, strings.HasPrefix(markdown, "### ❌ Wiring validation failed\n"))
+	assert.Contains(t, markdown, "| 1 | 0 | 0 | 0 | 0 | 0 ms |")
+	// Messages are escaped, fences outgrow the output they quote
+	assert.Contains(t, markdown, "- ❌ **HHV004** `a.yaml:2` port E1/1 \\| &lt;used&gt;")
+	assert.Contains(t, markdown, "````\n```\nERR port already used\n````")
+
+	out.Reset()
+	passed := report.Input{Name: "b.yaml", Response: &api.ValidateResponse{Success: true, UseCase: "uc1"}}
+	unreachable := report.Input{Name: "c.yaml", Err: errors.New("connection refused")}
+	require.NoError(t, report.WriteMarkdown(&out, passed, failed, unreachable))
+	markdown = out.String()
+	assert.True(t, strings.HasPrefix(markdown, "### ⚠️ Wiring validation of 3 files had errors\n"))
+	assert.Contains(t, markdown, "| ✅ | `b.yaml` | uc1 | - | - | - |")
+	// Only validations that did not pass are detailed
+	assert.Contains(t, markdown, "<summary>❌ a.yaml failed</summary>")
+	assert.Contains(t, markdown, "<summary>⚠️ c.yaml could not run</summary>")
+	assert.NotContains(t, markdown, "<summary>✅")
+}
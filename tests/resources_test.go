@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+// hungryHHFab is an hhfab whose validate holds far more memory than a
+// validation should take.
+const hungryHHFab = `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate) head -c 268435456 /dev/zero | tail -c 1 >/dev/null; echo "INF Fabricator config and wiring are valid";;
+esac
+`
+
+func TestResourceLimits(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits need Linux cgroups v2")
+	}
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(hungryHHFab), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+
+	validate := func(resources string) (int, api.ValidateResponse) {
+		config := fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\nresources:\n%s", hhfab, resources)
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(connectionWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		s.Router().ServeHTTP(w, req)
+		var response api.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	// Limits that cannot be applied fail the validation rather than run it
+	// unbounded
+	code, response := validate(fmt.Sprintf("  cgroup_root: %s\n  memory_mb: 64\n", filepath.Join(dir, "cgroup")))
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Equal(t, "Failed to apply resource limits", response.Message)
+	assert.Contains(t, response.Error, "not on a cgroup v2 filesystem")
+
+	require.NoError(t, os.WriteFile(configFile, []byte("resources:\n  memory_mb: -1\n"), 0644))
+	_, err := server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "resources values must not be negative")
+
+	// Runs over the memory limit are killed and reported, where the test
+	// may create cgroups
+	controllers, err := os.ReadFile("/sys/fs/cgroup/cgroup.controllers")
+	if err != nil || !strings.Contains(string(controllers), "memory") || os.Getuid() != 0 {
+		t.Skip("no cgroup v2 memory controller to create cgroups with")
+	}
+	root := fmt.Sprintf("/sys/fs/cgroup/hh-validator-test-%d", os.Getpid())
+	defer os.Remove(root)
+	code, response = validate(fmt.Sprintf("  cgroup_root: %s\n  memory_mb: 32\n", root))
+	if code == http.StatusInternalServerError {
+		t.Skipf("cgroups cannot be created here: %s", response.Error)
+	}
+	assert.False(t, response.Success)
+	require.NotEmpty(t, response.Diagnostics)
+	assert.Equal(t, codes.ResourceLimit, response.Diagnostics[len(response.Diagnostics)-1].Code)
+}
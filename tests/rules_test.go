@@ -0,0 +1,693 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/rules"
+	"validator/internal/wiring"
+)
+
+const connectionWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-01--leaf-01
+spec:
+  unbundled:
+    link:
+      server:
+        port: server-01/enp2s1
+      switch:
+        port: leaf-01/E1/1
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-02--leaf-02
+spec:
+  bundled:
+    links:
+      - server:
+          port: server-02/enp2s1
+        switch:
+          port: leaf-02
+`
+
+func TestRulesConnectionEndpoints(t *testing.T) {
+	objects, err := wiring.Parse([]byte(connectionWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	findings := rules.Check(objects)
+	require.Len(t, findings, 3)
+
+	assert.Equal(t, "connection-endpoints", findings[0].Rule)
+	assert.Equal(t, codes.MissingReference, findings[0].Code)
+	assert.Equal(t, "spec.bundled.links[0].server.port", findings[0].Path)
+	assert.Equal(t, "wiring.yaml", findings[0].File)
+	assert.Equal(t, 31, findings[0].Line)
+	assert.Contains(t, findings[0].Message, "Server/server-02")
+
+	assert.Equal(t, codes.InvalidField, findings[1].Code)
+	assert.Equal(t, "spec.bundled.links[0].switch.port", findings[1].Path)
+
+	assert.Equal(t, "single-homed-servers", findings[2].Rule)
+	assert.Equal(t, rules.SeverityWarning, findings[2].Severity)
+	assert.Equal(t, "Server/server-01", findings[2].Object)
+}
+
+const vlanWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: default
+spec:
+  ranges:
+    - from: 1000
+      to: 2999
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: storage
+spec:
+  ranges:
+    - from: 3000
+      to: 3099
+    - from: 2900
+      to: 3010
+---
+apiVersion: vpc.githedgehog.com/v1beta1
+kind: VPC
+metadata:
+  name: vpc-1
+spec:
+  subnets:
+    default:
+      subnet: 10.0.1.0/24
+      vlan: 1001
+    backup:
+      subnet: 10.0.2.0/24
+      vlan: 3500
+`
+
+func TestRulesVLANRanges(t *testing.T) {
+	objects, err := wiring.Parse([]byte(vlanWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	findings := rules.Check(objects)
+	require.Len(t, findings, 3)
+
+	// The second range of storage overlaps both the default namespace and
+	// the first range of storage
+	assert.Equal(t, codes.Overlap, findings[0].Code)
+	assert.Equal(t, "VLANNamespace/storage", findings[0].Object)
+	assert.Equal(t, "spec.ranges[1]", findings[0].Path)
+	assert.Contains(t, findings[0].Message, "2900-3010 overlaps spec.ranges[0] 1000-2999 of VLANNamespace/default")
+	assert.Contains(t, findings[1].Message, "overlaps spec.ranges[0] 3000-3099 of VLANNamespace/storage")
+
+	assert.Equal(t, codes.OutOfRange, findings[2].Code)
+	assert.Equal(t, "spec.subnets.backup.vlan", findings[2].Path)
+	assert.Equal(t, 32, findings[2].Line)
+}
+
+const subnetWiring = `apiVersion: vpc.githedgehog.com/v1beta1
+kind: IPv4Namespace
+metadata:
+  name: default
+spec:
+  subnets:
+    - 10.0.0.0/16
+    - 169.254.0.0/16
+---
+apiVersion: vpc.githedgehog.com/v1beta1
+kind: VPC
+metadata:
+  name: vpc-1
+spec:
+  subnets:
+    default:
+      subnet: 10.0.1.0/30
+      gateway: 10.0.2.1
+    other:
+      subnet: 10.0.1.0/24
+    outside:
+      subnet: 192.168.0.0/24
+---
+apiVersion: vpc.githedgehog.com/v1beta1
+kind: VPCAttachment
+metadata:
+  name: server-01
+spec:
+  subnet: vpc-1/default
+---
+apiVersion: vpc.githedgehog.com/v1beta1
+kind: VPCAttachment
+metadata:
+  name: server-02
+spec:
+  subnet: vpc-1
+`
+
+func TestRulesSubnets(t *testing.T) {
+	objects, err := wiring.Parse([]byte(subnetWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	byRule := map[string][]rules.Finding{}
+	for _, finding := range rules.Check(objects) {
+		byRule[finding.Rule] = append(byRule[finding.Rule], finding)
+	}
+
+	overlap := byRule["subnet-overlap"]
+	require.Len(t, overlap, 3)
+	assert.Equal(t, "spec.subnets.other.subnet", overlap[0].Path)
+	assert.Contains(t, overlap[0].Message, "overlaps subnet default 10.0.1.0/30 of VPC/vpc-1")
+	assert.Equal(t, codes.OutOfRange, overlap[1].Code)
+	assert.Equal(t, "spec.subnets.default.gateway", overlap[1].Path)
+	assert.Equal(t, "spec.subnets.outside.subnet", overlap[2].Path)
+
+	sizing := byRule["subnet-sizing"]
+	require.Len(t, sizing, 1)
+	assert.Equal(t, codes.SubnetTooSmall, sizing[0].Code)
+	assert.Contains(t, sizing[0].Message, "room for 1 hosts but 2 VPCAttachments")
+
+	reserved := byRule["reserved-subnets"]
+	require.Len(t, reserved, 1)
+	assert.Equal(t, "spec.subnets[1]", reserved[0].Path)
+	assert.Contains(t, reserved[0].Message, "link-local range")
+}
+
+const redundancyWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  redundancy:
+    group: mclag-1
+    type: mclag
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-02
+spec:
+  redundancy:
+    group: mclag-1
+    type: mclag
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-03
+spec:
+  redundancy:
+    group: mclag-2
+    type: mclag
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: leaf-01--mclag-domain--leaf-02
+spec:
+  mclagDomain:
+    peerLinks:
+      - switch1:
+          port: leaf-01/E1/1
+        switch2:
+          port: leaf-02/E1/1
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-01--mclag--leaf-01--leaf-02
+spec:
+  mclag:
+    links:
+      - server:
+          port: server-01/enp2s1
+        switch:
+          port: leaf-01/E1/5
+      - server:
+          port: server-01/enp2s2
+        switch:
+          port: leaf-01/E1/6
+      - server:
+          port: server-01/enp2s3
+        switch:
+          port: leaf-02/E1/5
+`
+
+func TestRulesRedundancyGroups(t *testing.T) {
+	objects, err := wiring.Parse([]byte(redundancyWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	findings := rules.Check(objects)
+	require.Len(t, findings, 3)
+	for _, finding := range findings {
+		assert.Equal(t, "redundancy-groups", finding.Rule)
+		assert.Equal(t, codes.Redundancy, finding.Code)
+	}
+
+	assert.Equal(t, "Switch/leaf-03", findings[0].Object)
+	assert.Contains(t, findings[0].Message, "MCLAG group mclag-2 needs exactly 2 switches, has 1")
+	assert.Equal(t, "spec.mclagDomain.sessionLinks", findings[1].Path)
+	assert.Equal(t, "Connection/server-01--mclag--leaf-01--leaf-02", findings[2].Object)
+	assert.Contains(t, findings[2].Message, "have leaf-01: 2, leaf-02: 1")
+}
+
+const lintWiring = `apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  vlanNamespaces:
+    - default
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: default
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: lab
+`
+
+func TestRulesWarnings(t *testing.T) {
+	objects, err := wiring.Parse([]byte(lintWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	findings := rules.Check(objects)
+	require.Len(t, findings, 2)
+	for _, finding := range findings {
+		assert.Equal(t, rules.SeverityWarning, finding.Severity)
+	}
+
+	assert.Equal(t, codes.Deprecated, findings[0].Code)
+	assert.Equal(t, "apiVersion", findings[0].Path)
+	assert.Equal(t, 1, findings[0].Line)
+	assert.Contains(t, findings[0].Message, "use wiring.githedgehog.com/v1beta1")
+
+	assert.Equal(t, codes.Unused, findings[1].Code)
+	assert.Equal(t, "VLANNamespace/lab", findings[1].Object)
+}
+
+func TestRulesCheckStrict(t *testing.T) {
+	objects, err := wiring.Parse([]byte(lintWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	byRule := map[string][]rules.Finding{}
+	for _, finding := range rules.CheckStrict(objects) {
+		byRule[finding.Rule] = append(byRule[finding.Rule], finding)
+	}
+
+	assert.Len(t, byRule["deprecated-api-versions"], 1)
+	require.Len(t, byRule["unconnected-devices"], 1)
+	assert.Equal(t, "Switch/leaf-01", byRule["unconnected-devices"][0].Object)
+	require.Len(t, byRule["missing-descriptions"], 1)
+	assert.Equal(t, codes.MissingDescription, byRule["missing-descriptions"][0].Code)
+	assert.Empty(t, byRule["unused-ipv4-namespaces"])
+}
+
+const profileWiring = `apiVersion: fabricator.githedgehog.com/v1beta1
+kind: Fabricator
+metadata:
+  name: default
+spec:
+  config:
+    fabric:
+      mode: spine-leaf
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: spine-01
+spec:
+  role: spine
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: server-leaf
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-02
+spec:
+  role: server-leaf
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-03
+spec:
+  role: border-leaf
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: lab
+`
+
+func TestRulesProfiles(t *testing.T) {
+	objects, err := wiring.Parse([]byte(profileWiring), "wiring.yaml")
+	require.NoError(t, err)
+	profiles := rules.Profiles()
+
+	byRule := func(profile rules.Profile) map[string][]rules.Finding {
+		found := map[string][]rules.Finding{}
+		for _, finding := range rules.CheckProfile(objects, profile) {
+			found[finding.Rule] = append(found[finding.Rule], finding)
+		}
+		return found
+	}
+
+	// The lab profile drops the unused namespace warning
+	assert.Len(t, byRule(rules.Profile{})["unused-vlan-namespaces"], 1)
+	assert.Empty(t, byRule(profiles["lab"]))
+
+	// One spine is not enough in production, the lint rules run too
+	prod := byRule(profiles["prod-spine-leaf"])
+	require.Len(t, prod["topology"], 1)
+	assert.Equal(t, codes.Topology, prod["topology"][0].Code)
+	assert.Equal(t, rules.SeverityError, prod["topology"][0].Severity)
+	assert.Equal(t, "the profile requires at least 2 spines, the fabric has 1", prod["topology"][0].Message)
+	assert.NotEmpty(t, prod["missing-descriptions"])
+
+	// Collapsed-core fabrics have no spines and two leaves
+	collapsed := byRule(profiles["collapsed-core"])["topology"]
+	require.Len(t, collapsed, 3)
+	assert.Equal(t, "Fabricator/default", collapsed[0].Object)
+	assert.Equal(t, "spec.config.fabric.mode", collapsed[0].Path)
+	assert.Equal(t, "Switch/spine-01", collapsed[1].Object)
+	assert.Equal(t, "Switch/leaf-03", collapsed[2].Object)
+	assert.Equal(t, "spec.role", collapsed[2].Path)
+
+	// Objects of API versions the profile does not allow are errors
+	assert.Empty(t, byRule(rules.Profile{})["api-versions"])
+	versions := byRule(rules.Profile{APIVersions: []string{"wiring.githedgehog.com/v1beta1"}})["api-versions"]
+	require.Len(t, versions, 1)
+	assert.Equal(t, codes.InvalidField, versions[0].Code)
+	assert.Equal(t, rules.SeverityError, versions[0].Severity)
+	assert.Equal(t, "Fabricator/default", versions[0].Object)
+	assert.Equal(t, "apiVersion", versions[0].Path)
+	assert.Equal(t, 1, versions[0].Line)
+
+	for name, profile := range profiles {
+		assert.NoError(t, profile.Validate(), name)
+	}
+	assert.EqualError(t, rules.Profile{Disable: []string{"no-such-rule"}}.Validate(), `unknown rule "no-such-rule"`)
+	assert.Empty(t, byRule(rules.Profile{Enable: []string{"missing-descriptions"}, Disable: []string{"missing-descriptions"}})["missing-descriptions"])
+}
+
+const redundancyPolicyWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-02
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-02
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-03
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: control-1
+spec:
+  type: control
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-01--mclag--leaf-01--leaf-02
+spec:
+  mclag:
+    links:
+      - server:
+          port: server-01/enp2s1
+        switch:
+          port: leaf-01/E1/1
+      - server:
+          port: server-01/enp2s2
+        switch:
+          port: leaf-02/E1/1
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-02--unbundled--leaf-01
+spec:
+  unbundled:
+    link:
+      server:
+        port: server-02/enp2s1
+      switch:
+        port: leaf-01/E1/2
+`
+
+func TestRulesServerRedundancy(t *testing.T) {
+	objects, err := wiring.Parse([]byte(redundancyPolicyWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	policy := func(findings []rules.Finding) []rules.Finding {
+		found := []rules.Finding{}
+		for _, finding := range findings {
+			if finding.Rule == "server-redundancy" {
+				found = append(found, finding)
+			}
+		}
+		return found
+	}
+
+	// The policy is opt-in, strict mode does not run it
+	assert.Empty(t, policy(rules.CheckStrict(objects)))
+
+	findings := policy(rules.CheckProfile(objects, rules.Profile{Enable: []string{"server-redundancy"}}))
+	require.Len(t, findings, 2)
+	assert.Equal(t, rules.SeverityError, findings[0].Severity)
+	assert.Equal(t, codes.SinglePointOfFailure, findings[0].Code)
+	assert.Equal(t, "Server/server-02: server is only connected to switch leaf-01, the redundancy policy requires two switches or an MCLAG pair", findings[0].Message)
+	assert.Equal(t, 16, findings[0].Line)
+	assert.Equal(t, "Server/server-03: server is not connected to any switch, the redundancy policy requires two switches or an MCLAG pair", findings[1].Message)
+
+	assert.NoError(t, rules.Profile{Enable: []string{"server-redundancy"}}.Validate())
+}
+
+const portWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: spine-01
+spec:
+  role: spine
+  portSpeeds:
+    E1/1: 100G
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: server-leaf
+  portBreakouts:
+    E1/49: 4x25G
+    E1/50: 4x25G
+    E1/51: fast
+  portSpeeds:
+    E1/49/2: 10G
+    E1/50: 100G
+    E1/53: 40G
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: spine-01--fabric--leaf-01
+spec:
+  fabric:
+    links:
+      - spine:
+          port: spine-01/E1/1
+        leaf:
+          port: leaf-01/E1/53
+      - spine:
+          port: spine-01/E1/2
+        leaf:
+          port: leaf-01/E1/54
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-01--unbundled--leaf-01
+spec:
+  unbundled:
+    link:
+      server:
+        port: server-01/enp2s1
+      switch:
+        port: leaf-01/E1/49/5
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-01--bundled--leaf-01
+spec:
+  bundled:
+    links:
+      - server:
+          port: server-01/enp2s2
+        switch:
+          port: leaf-01/E1/50
+      - server:
+          port: server-01/enp2s3
+        switch:
+          port: leaf-01/E1/52
+      - server:
+          port: server-01/enp2s4
+        switch:
+          port: leaf-01/E1/52/1
+`
+
+func TestRulesPorts(t *testing.T) {
+	objects, err := wiring.Parse([]byte(portWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	found := map[string][]rules.Finding{}
+	for _, finding := range rules.Check(objects) {
+		found[finding.Rule] = append(found[finding.Rule], finding)
+	}
+
+	breakouts := found["port-breakouts"]
+	require.Len(t, breakouts, 6)
+	assert.Equal(t, codes.PortMismatch, breakouts[0].Code)
+	assert.Equal(t, "spec.portSpeeds.E1/50", breakouts[0].Path)
+	assert.Equal(t, 22, breakouts[0].Line)
+	assert.Equal(t, codes.InvalidField, breakouts[1].Code)
+	assert.Equal(t, "spec.portBreakouts.E1/51", breakouts[1].Path)
+	assert.Equal(t, "Switch/leaf-01: breakout port E1/49/2 is set to 10G, the breakout 4x25G of E1/49 runs at 25G", breakouts[2].Message)
+
+	assert.Equal(t, "Connection/server-01--unbundled--leaf-01", breakouts[3].Object)
+	assert.Equal(t, codes.PortMismatch, breakouts[3].Code)
+	assert.Contains(t, breakouts[3].Message, "leaf-01/E1/49/5, which does not exist")
+	assert.Equal(t, "spec.bundled.links[0].switch.port", breakouts[4].Path)
+	assert.Contains(t, breakouts[4].Message, "into E1/50/1 to E1/50/4")
+	assert.Equal(t, codes.PortConflict, breakouts[5].Code)
+	assert.Equal(t, "Connection/server-01--bundled--leaf-01: spec.bundled.links[1].switch.port uses leaf-01/E1/52 whole, Connection/server-01--bundled--leaf-01 uses it broken out as leaf-01/E1/52/1", breakouts[5].Message)
+
+	// Links without configured speeds on both ends are not compared
+	speeds := found["port-speeds"]
+	require.Len(t, speeds, 1)
+	assert.Equal(t, codes.PortMismatch, speeds[0].Code)
+	assert.Equal(t, "spec.fabric.links[0].spine.port", speeds[0].Path)
+	assert.Equal(t, "Connection/spine-01--fabric--leaf-01: spine-01/E1/1 runs at 100G, the other end leaf-01/E1/53 at 40G", speeds[0].Message)
+}
+
+const namesWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf.01
+  labels:
+    rack: -r1
+spec:
+  role: server-leaf
+  groups: [Rack_1]
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VPC
+metadata:
+  name: vpc-1
+  labels:
+    team.example.com/owner: network
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VPCAttachment
+metadata:
+  name: Server-01
+spec:
+  connection: server-01--unbundled--leaf-01
+  subnet: vpc-1/Default
+`
+
+func TestRulesObjectNames(t *testing.T) {
+	objects, err := wiring.Parse([]byte(namesWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	naming := func(findings []rules.Finding) []rules.Finding {
+		found := []rules.Finding{}
+		for _, finding := range findings {
+			if finding.Code == codes.InvalidName {
+				found = append(found, finding)
+			}
+		}
+		return found
+	}
+
+	// Switch names are hostnames, dots are not allowed
+	findings := naming(rules.Check(objects))
+	require.Len(t, findings, 5)
+	assert.Equal(t, "object-names", findings[0].Rule)
+	assert.Equal(t, rules.SeverityError, findings[0].Severity)
+	assert.Equal(t, "metadata.name", findings[0].Path)
+	assert.Equal(t, 4, findings[0].Line)
+	assert.Contains(t, findings[0].Message, `Switch/leaf.01: name "leaf.01" must be a lowercase RFC 1123 label`)
+	assert.Equal(t, "metadata.labels.rack", findings[1].Path)
+	assert.Contains(t, findings[1].Message, `label value "-r1" must be empty or at most 63`)
+	assert.Equal(t, "spec.groups[0]", findings[2].Path)
+	assert.Contains(t, findings[2].Message, `spec.groups[0] refers to "Rack_1", whose name must be a lowercase RFC 1123 subdomain`)
+	assert.Equal(t, "VPCAttachment/Server-01", findings[3].Object)
+	assert.Equal(t, "spec.subnet", findings[4].Path)
+	assert.Equal(t, 24, findings[4].Line)
+
+	// Profiles add naming conventions by kind, * for the other kinds
+	profile := rules.Profile{
+		Disable: []string{"object-names"},
+		Naming:  rules.Naming{"VPC": `vpc-\d+`, "*": `[a-z]+-\d{2}`},
+	}
+	require.NoError(t, profile.Validate())
+	findings = naming(rules.CheckProfile(objects, profile))
+	require.Len(t, findings, 2)
+	assert.Equal(t, "naming", findings[0].Rule)
+	assert.Equal(t, `Switch/leaf.01: name "leaf.01" does not match the naming pattern [a-z]+-\d{2} of the profile`, findings[0].Message)
+	assert.Equal(t, "VPCAttachment/Server-01", findings[1].Object)
+
+	assert.ErrorContains(t, rules.Profile{Naming: rules.Naming{"Switch": "leaf-(\\d"}}.Validate(), "naming pattern of Switch")
+}
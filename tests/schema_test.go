@@ -0,0 +1,186 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/schema"
+	"validator/internal/wiring"
+)
+
+const schemaWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: leaf
+  asn: "65101"
+  redundancy:
+    type: mclag
+    grup: mclag-1
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: default
+spec:
+  ranges:
+    - from: 1000
+      to: 5000
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Swtich
+metadata:
+  name: leaf-02
+---
+apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: leaf-03
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+`
+
+func validateSchemas(t *testing.T, bundle *schema.Bundle, content string) map[string][]schema.Violation {
+	objects, err := wiring.Parse([]byte(content), "wiring.yaml")
+	require.NoError(t, err)
+
+	violations := map[string][]schema.Violation{}
+	for _, object := range objects {
+		if found := bundle.Validate(object); len(found) > 0 {
+			violations[object.Key()] = found
+		}
+	}
+	return violations
+}
+
+func TestSchemaValidate(t *testing.T) {
+	bundle, err := schema.Embedded()
+	require.NoError(t, err)
+
+	violations := validateSchemas(t, bundle, schemaWiring)
+	assert.Equal(t, []schema.Violation{
+		{Code: codes.InvalidField, Path: "spec.role", Line: 6, Message: `spec.role is "leaf", must be one of: spine, server-leaf, border-leaf, mixed-leaf, virtual-edge`},
+		{Code: codes.InvalidField, Path: "spec.asn", Line: 7, Message: `spec.asn must be an integer, found a string "65101"`},
+		{Code: codes.InvalidField, Path: "spec.redundancy.grup", Line: 10, Message: "spec.redundancy.grup is not a known field"},
+	}, violations["Switch/leaf-01"])
+	assert.Equal(t, []schema.Violation{
+		{Code: codes.InvalidField, Path: "spec.ranges[0].to", Line: 19, Message: "spec.ranges[0].to is 5000, must be at most 4094"},
+	}, violations["VLANNamespace/default"])
+	assert.Equal(t, []schema.Violation{
+		{Code: codes.UnknownKind, Path: "kind", Line: 22, Message: "unknown kind Swtich in wiring.githedgehog.com/v1beta1"},
+	}, violations["Swtich/leaf-02"])
+	// Deprecated versions and other API groups are not checked
+	assert.Len(t, violations, 3)
+}
+
+func TestSchemaLoad(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "switch.yaml"), []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: switches.wiring.githedgehog.com
+spec:
+  group: wiring.githedgehog.com
+  names:
+    kind: Switch
+  versions:
+    - name: v1beta1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required:
+                - role
+              properties:
+                role:
+                  type: string
+`), 0644))
+
+	bundle, err := schema.Load(dir)
+	require.NoError(t, err)
+	assert.Contains(t, bundle.Kinds(), schema.Kind{APIVersion: "wiring.githedgehog.com/v1beta1", Kind: "Switch", Source: filepath.Join(dir, "switch.yaml")})
+	assert.Contains(t, bundle.Kinds(), schema.Kind{APIVersion: "wiring.githedgehog.com/v1beta1", Kind: "Server", Source: "wiring.yaml"})
+
+	violations := validateSchemas(t, bundle, `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  description: rack 1
+`)
+	assert.Equal(t, []schema.Violation{
+		{Code: codes.InvalidField, Path: "spec.description", Line: 6, Message: "spec.description is not a known field"},
+		{Code: codes.InvalidField, Path: "spec.role", Line: 6, Message: "spec.role is required"},
+	}, violations["Switch/leaf-01"])
+
+	// The embedded bundle is left untouched
+	embedded, err := schema.Embedded()
+	require.NoError(t, err)
+	assert.Empty(t, validateSchemas(t, embedded, `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: server-leaf
+  description: rack 1
+`))
+}
+
+func TestSchemaWriteJSONSchemas(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "port.yaml"), []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: ports.example.com
+spec:
+  group: example.com
+  names:
+    kind: Port
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                speed:
+                  x-kubernetes-int-or-string: true
+                description:
+                  type: string
+                  nullable: true
+                labels:
+                  type: object
+                  x-kubernetes-preserve-unknown-fields: true
+`), 0644))
+	bundle, err := schema.Load(dir)
+	require.NoError(t, err)
+
+	out := t.TempDir()
+	require.NoError(t, bundle.WriteJSONSchemas(out, true))
+	assert.FileExists(t, filepath.Join(out, "wiring.githedgehog.com", "switch_v1beta1.json"))
+	data, err := os.ReadFile(filepath.Join(out, "example.com", "port_v1.json"))
+	require.NoError(t, err)
+	var document map[string]any
+	require.NoError(t, json.Unmarshal(data, &document))
+	spec := document["properties"].(map[string]any)["spec"].(map[string]any)
+	assert.Equal(t, false, spec["additionalProperties"])
+	properties := spec["properties"].(map[string]any)
+	assert.Equal(t, []any{map[string]any{"type": "string"}, map[string]any{"type": "integer"}}, properties["speed"].(map[string]any)["oneOf"])
+	assert.Equal(t, []any{"string", "null"}, properties["description"].(map[string]any)["type"])
+	// Objects preserving unknown fields take any
+	assert.NotContains(t, properties["labels"].(map[string]any), "additionalProperties")
+}
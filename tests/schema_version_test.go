@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+func TestSchemaVersionNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("schema_only_fallback: true\nauth:\n  required: true\n"), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	get := func(path, pinned string) (*httptest.ResponseRecorder, map[string]any) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if pinned != "" {
+			req.Header.Set(api.SchemaHeader, pinned)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var document map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+		return w, document
+	}
+
+	// Responses name their version, the latest unless pinned
+	w, document := get("/health", "")
+	assert.Equal(t, strconv.Itoa(api.SchemaVersion), w.Header().Get(api.SchemaHeader))
+	assert.Equal(t, float64(api.SchemaVersion), document["schema_version"])
+
+	var capabilities api.CapabilitiesResponse
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &capabilities))
+	assert.Equal(t, api.SchemaVersion, capabilities.SchemaVersion)
+	assert.Equal(t, []int{api.MinSchemaVersion, api.SchemaVersion}, capabilities.SchemaVersions)
+
+	w, document = get("/history", "")
+	assert.Equal(t, api.ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, api.ProblemUnauthorized, document["type"])
+	assert.Equal(t, float64(2), document["schema_version"])
+
+	// Version 1 answers errors without problem documents
+	w, document = get("/history", "1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "1", w.Header().Get(api.SchemaHeader))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, map[string]any{"schema_version": float64(1), "error": "an API key or token with the viewer role is required"}, document)
+
+	w, document = get("/capabilities", "1")
+	assert.Equal(t, float64(1), document["schema_version"])
+
+	// Versions the server does not speak are refused
+	for _, pinned := range []string{"0", "3", "latest"} {
+		w, document = get("/health", pinned)
+		assert.Equal(t, http.StatusNotAcceptable, w.Code, pinned)
+		assert.Equal(t, []any{float64(api.MinSchemaVersion), float64(api.SchemaVersion)}, document["supported_versions"])
+	}
+}
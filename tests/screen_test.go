@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+const billionLaughs = `a: &a ["lol","lol","lol","lol","lol","lol","lol","lol","lol"]
+b: &b [*a,*a,*a,*a,*a,*a,*a,*a,*a]
+c: &c [*b,*b,*b,*b,*b,*b,*b,*b,*b]
+d: &d [*c,*c,*c,*c,*c,*c,*c,*c,*c]
+e: &e [*d,*d,*d,*d,*d,*d,*d,*d,*d]
+f: &f [*e,*e,*e,*e,*e,*e,*e,*e,*e]
+g: &g [*f,*f,*f,*f,*f,*f,*f,*f,*f]
+h: &h [*g,*g,*g,*g,*g,*g,*g,*g,*g]
+i: &i [*h,*h,*h,*h,*h,*h,*h,*h,*h]
+`
+
+func TestUploadScreening(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("hhfab_path: /nonexistent/hhfab\nschema_only_fallback: true\n"), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	validate := func(field string, data []byte) (int, api.ValidateResponse) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		files := map[string][]byte{"wiring": []byte(connectionWiring), field: data}
+		for _, name := range []string{"wiring", "fab"} {
+			if files[name] == nil {
+				continue
+			}
+			part, err := writer.CreateFormFile(name, name+".yaml")
+			require.NoError(t, err)
+			part.Write(files[name])
+		}
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response api.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	deepFlow := strings.Repeat("[", 100) + strings.Repeat("]", 100)
+	var deepBlock strings.Builder
+	for i := 0; i < 100; i++ {
+		deepBlock.WriteString(strings.Repeat("  ", i) + "k:\n")
+	}
+	for _, tc := range []struct {
+		name   string
+		field  string
+		data   string
+		reason string
+		line   int
+	}{
+		{"nul", "wiring", "kind: Switch\nname: a\x00b\n", api.RejectedNUL, 2},
+		{"binary", "fab", "\x89PNG\r\n\x1a\n", api.RejectedBinary, 1},
+		{"invalid UTF-8", "wiring", "kind: \xff\xfe\n", api.RejectedBinary, 1},
+		{"deep flow", "wiring", "spec: " + deepFlow + "\n", api.RejectedDepth, 1},
+		{"deep block", "wiring", deepBlock.String(), api.RejectedDepth, 65},
+		{"aliases", "fab", billionLaughs, api.RejectedAliases, 6},
+	} {
+		code, response := validate(tc.field, []byte(tc.data))
+		assert.Equal(t, http.StatusUnprocessableEntity, code, tc.name)
+		if assert.NotNil(t, response.Rejected, tc.name) {
+			assert.Equal(t, api.UploadRejected{Field: tc.field, File: tc.field + ".yaml", Reason: tc.reason, Line: tc.line, Limit: response.Rejected.Limit}, *response.Rejected, tc.name)
+		}
+	}
+
+	// Quoted strings, comments and block scalars are not mistaken for
+	// structure, nor are the deeply nested CRDs of the schemas
+	plausible := `kind: Switch
+metadata:
+  name: "[[[[[[ &a *b"  # [[[[ &c
+  annotations:
+    note: 'it''s [ fine'
+    script: |
+      [[[[[[[[[[ &x *y &z
+spec: {ports: [1, 2, 3]}
+`
+	for _, data := range []string{plausible, connectionWiring} {
+		code, _ := validate("wiring", []byte(data))
+		assert.NotEqual(t, http.StatusUnprocessableEntity, code)
+	}
+	crds, err := filepath.Glob("../internal/schema/crds/*.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, crds)
+	for _, crd := range crds {
+		data, err := os.ReadFile(crd)
+		require.NoError(t, err)
+		code, response := validate("wiring", data)
+		assert.NotEqual(t, http.StatusUnprocessableEntity, code, "%s: %s", crd, response.Error)
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("schema_only_fallback: true\n"), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Contains(t, w.Header().Get("Content-Security-Policy"), "default-src 'none'")
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+
+	config := "security:\n  content_security_policy: \"\"\n  frame_options: SAMEORIGIN\n  hsts_max_age_seconds: 31536000\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err = server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	s.Router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "SAMEORIGIN", w.Header().Get("X-Frame-Options"))
+	assert.Equal(t, "max-age=31536000", w.Header().Get("Strict-Transport-Security"))
+}
+
+func TestCrossOriginProtection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	config := "schema_only_fallback: true\ncors:\n  allowed_origins: [https://ui.example.com]\n"
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	post := func(header map[string]string) int {
+		req := httptest.NewRequest(http.MethodPost, "http://validator.lab:8080/format", strings.NewReader("kind: Switch\n"))
+		req.Header.Set("Content-Type", "application/yaml")
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Forms of other sites are refused, the CLI, the server's own pages and
+	// the origins CORS allows are not
+	assert.Equal(t, http.StatusForbidden, post(map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.org"}))
+	assert.Equal(t, http.StatusForbidden, post(map[string]string{"Origin": "https://evil.example.org"}))
+	assert.Equal(t, http.StatusForbidden, post(map[string]string{"Sec-Fetch-Site": "same-site"}))
+	for _, header := range []map[string]string{
+		nil,
+		{"Sec-Fetch-Site": "same-origin"},
+		{"Origin": "http://validator.lab:8080"},
+		{"Sec-Fetch-Site": "cross-site", "Origin": "https://ui.example.com"},
+	} {
+		assert.NotEqual(t, http.StatusForbidden, post(header), header)
+	}
+
+	require.NoError(t, os.WriteFile(configFile, []byte("security:\n  cross_origin_protection: false\n"), 0644))
+	s, err = server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router = s.Router()
+	assert.NotEqual(t, http.StatusForbidden, post(map[string]string{"Origin": "https://evil.example.org"}))
+}
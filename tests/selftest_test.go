@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/server"
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+func TestSelfTest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	selfTest := func(settings string) (int, server.SelfTest) {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		config := "admin_token: admin-token\nworkspaces:\n  max_idle: 0\n" + settings
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+		router := s.Router()
+
+		// Only admins run it
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/selftest", nil))
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+
+		req := httptest.NewRequest(http.MethodPost, "/selftest", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response server.SelfTest
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	// Every fixture does as expected
+	status, response := selfTest("backend: mock\n")
+	require.Equal(t, http.StatusOK, status, response.Error)
+	assert.True(t, response.Passed)
+	require.Len(t, response.Fixtures, 3)
+	assert.Equal(t, server.SelfTestFixture{Name: "valid", Valid: true, Passed: true, Status: http.StatusOK}, withoutDuration(response.Fixtures[0]))
+	assert.Equal(t, server.SelfTestFixture{Name: "yaml-syntax", Expected: codes.YAMLSyntax, Passed: true, Status: http.StatusBadRequest, Code: codes.YAMLSyntax}, withoutDuration(response.Fixtures[1]))
+	assert.Equal(t, server.SelfTestFixture{Name: "missing-reference", Expected: codes.MissingReference, Passed: true, Status: http.StatusBadRequest, Code: codes.MissingReference}, withoutDuration(response.Fixtures[2]))
+
+	// Without hhfab the checks of the validator catch the known-bad ones
+	status, response = selfTest("backend: schema-only\n")
+	assert.Equal(t, http.StatusOK, status, response.Error)
+
+	// An hhfab that fails everything fails the known-good fixture
+	hhfab := filepath.Join(t.TempDir(), "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte("#!/bin/sh\necho 'permission denied' >&2\nexit 1\n"), 0755))
+	status, response = selfTest(fmt.Sprintf("hhfab_path: %s\n", hhfab))
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.False(t, response.Passed)
+	assert.False(t, response.Fixtures[0].Passed)
+	assert.Contains(t, response.Fixtures[0].Error, "expected the fixture to validate, it failed with 500")
+	assert.Contains(t, response.Error, "self-test failed: valid: expected the fixture to validate")
+}
+
+func TestSelfTestAlerts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var mu sync.Mutex
+	var deliveries []delivery
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, delivery{r.Header.Clone(), body})
+	}))
+	defer receiver.Close()
+	delivered := func(n int) delivery {
+		require.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(deliveries) >= n
+		}, 5*time.Second, 10*time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		return deliveries[n-1]
+	}
+
+	// The mock hhfab, broken while the flag file exists
+	dir := t.TempDir()
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	broken := filepath.Join(dir, "broken")
+	hhfab := filepath.Join(dir, "hhfab")
+	script := fmt.Sprintf("#!/bin/sh\n[ -f %s ] && { echo 'permission denied' >&2; exit 1; }\nHHFAB_MOCK=1 exec %s \"$@\"\n", broken, executable)
+	require.NoError(t, os.WriteFile(hhfab, []byte(script), 0755))
+	require.NoError(t, os.WriteFile(broken, nil, 0644))
+
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("admin_token: admin-token\nhhfab_path: %s\nworkspaces:\n  max_idle: 0\nselftest:\n  webhooks:\n  - url: %s\n    secret: shared-secret\n", hhfab, receiver.URL)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+	selfTest := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/selftest", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	metric := func(name string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			if strings.HasPrefix(line, name+" ") {
+				return strings.TrimPrefix(line, name+" ")
+			}
+		}
+		return ""
+	}
+
+	// A failing self-test is alerted, signed like every webhook
+	require.Equal(t, http.StatusServiceUnavailable, selfTest())
+	verifier := &client.WebhookVerifier{Secret: "shared-secret"}
+	first := delivered(1)
+	event, err := verifier.Verify(first.header, first.body)
+	require.NoError(t, err)
+	assert.Equal(t, api.WebhookSelfTestFailed, event.Event)
+	assert.NotEmpty(t, event.Host)
+	require.NotNil(t, event.SelfTest)
+	assert.False(t, event.SelfTest.Passed)
+	assert.Contains(t, event.SelfTest.Error, "valid: expected the fixture to validate")
+	assert.Equal(t, "0", metric(`validator_selftest_fixture_passed{fixture="valid"}`))
+
+	// Once, however often it fails
+	require.Equal(t, http.StatusServiceUnavailable, selfTest())
+
+	// Passing again is told as well
+	require.NoError(t, os.Remove(broken))
+	require.Equal(t, http.StatusOK, selfTest())
+	second := delivered(2)
+	event, err = verifier.Verify(second.header, second.body)
+	require.NoError(t, err)
+	assert.Equal(t, api.WebhookSelfTestRecovered, event.Event)
+	assert.True(t, event.SelfTest.Passed)
+	assert.Equal(t, "1", metric(`validator_selftest_fixture_passed{fixture="valid"}`))
+	assert.NotEmpty(t, metric(`validator_selftests_total{result="failed",trigger="requested"}`))
+	mu.Lock()
+	assert.Len(t, deliveries, 2)
+	mu.Unlock()
+}
+
+func withoutDuration(fixture server.SelfTestFixture) server.SelfTestFixture {
+	fixture.DurationMs = 0
+	return fixture
+}
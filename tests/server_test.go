@@ -2,7 +2,9 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -10,36 +12,24 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
 )
 
 // Test response structures
-type ValidateResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Output  string `json:"output"`
-	UseCase string `json:"use_case"`
-	Error   string `json:"error,omitempty"`
-}
-
-type HealthResponse struct {
-	Status    string    `json:"status"`
-	Service   string    `json:"service"`
-	Version   string    `json:"version"`
-	Timestamp time.Time `json:"timestamp"`
-}
-
-type InfoResponse struct {
-	Service     string   `json:"service"`
-	Description string   `json:"description"`
-	Version     string   `json:"version"`
-	Endpoints   []string `json:"endpoints"`
-}
+type (
+	ValidateResponse = api.ValidateResponse
+	HealthResponse   = api.HealthResponse
+	InfoResponse     = api.InfoResponse
+)
 
 // Mock server setup
 func setupTestServer() *gin.Engine {
@@ -331,4 +321,72 @@ func extractErrorMessage(output string) string {
 		}
 	}
 	return "Unknown validation error"
-}
\ No newline at end of file
+}
+func TestValidateOverloaded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	release := filepath.Join(dir, "release")
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(fmt.Sprintf(heldHHFab, runs, release)), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nworkers:\n  max_concurrent: 1\n  max_queue: 1\n  shed_queue: 1\n  retry_after_seconds: 7\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	validate := func(ctx context.Context, name string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(strings.Replace(shardedWiring, "leaf-01", name, -1)))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body).WithContext(ctx)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	overloaded := func(w *httptest.ResponseRecorder, waiting int) {
+		t.Helper()
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "7", w.Header().Get("Retry-After"))
+		var problem api.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, api.ProblemOverloaded, problem.Type)
+		var response ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, &api.Overload{Waiting: waiting, ShedQueue: 1, RetryAfterSec: 7}, response.Overload)
+	}
+
+	// The only worker is held by a validation
+	var held sync.WaitGroup
+	defer held.Wait()
+	defer os.WriteFile(release, nil, 0644)
+	hold := func(name string) {
+		held.Add(1)
+		go func() {
+			defer held.Done()
+			validate(context.Background(), name)
+		}()
+	}
+	hold("leaf-01")
+	waitForRuns(t, runs, 1)
+
+	// A request timing out in line is told to back off
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	overloaded(validate(ctx, "leaf-02"), 0)
+
+	// Once the line holds max_queue requests the next is turned away at once
+	hold("leaf-03")
+	require.Eventually(t, func() bool {
+		_, _, checks := readiness(t, router)
+		return !checks["queue"].OK
+	}, 5*time.Second, 10*time.Millisecond)
+	start := time.Now()
+	overloaded(validate(context.Background(), "leaf-04"), 1)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+// shardedWiring holds two groups of related objects sharing a VLAN namespace
+const shardedWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: default
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-01--leaf-01
+spec:
+  unbundled:
+    link:
+      server:
+        port: server-01/enp2s1
+      switch:
+        port: leaf-01/E1/1
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-02
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-02
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Connection
+metadata:
+  name: server-02--leaf-02
+spec:
+  unbundled:
+    link:
+      server:
+        port: server-02/enp2s1
+      switch:
+        port: leaf-02/E1/1
+`
+
+// shardHHFab logs the objects of every run to shards, warns about the shared
+// namespace in each and rejects leaf-02 once release exists.
+const shardHHFab = `#!/bin/sh
+case "$1" in
+  init) echo "spec: {}" > fab.yaml;;
+  validate)
+    echo $(grep -h 'name:' include/*.yaml | sed 's/.*name: //' | sort) >> %[1]s
+    echo "06:38:17 WRN VLANNamespace default overlaps"
+    if grep -q 'name: leaf-02' include/*.yaml; then
+      echo "06:38:17 INF waiting"
+      while [ ! -f %[2]s ]; do sleep 0.05; done
+      echo "06:38:17 ERR validating: leaf-02 has no ports"
+      exit 1
+    fi
+    echo "06:38:17 INF validated";;
+esac
+`
+
+func TestParallelValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	shards := filepath.Join(dir, "shards")
+	release := filepath.Join(dir, "release")
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(fmt.Sprintf(shardHHFab, shards, release)), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf("hhfab_path: %s\nworkers:\n  max_shards: 4\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n", hhfab)
+	require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	ts := httptest.NewServer(s.Router())
+	defer ts.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(shardedWiring))
+	require.NoError(t, writer.Close())
+	// leaf-02 waits for release, which is created anyway after a while so
+	// that output held back until the end fails the test instead of hanging
+	timer := time.AfterFunc(5*time.Second, func() { os.WriteFile(release, nil, 0644) })
+	defer timer.Stop()
+	resp, err := http.Post(ts.URL+"/validate?parallel=true&stream=true", writer.FormDataContentType(), body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result *server.StreamEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event server.StreamEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		if event.Type == server.StreamOutput && strings.Contains(event.Line, "INF waiting") {
+			_, err := os.Stat(release)
+			assert.True(t, os.IsNotExist(err), "the output of a shard is streamed while it runs")
+			require.NoError(t, os.WriteFile(release, nil, 0644))
+		}
+		if event.Type == server.StreamResult {
+			result = &event
+		}
+	}
+	require.NoError(t, scanner.Err())
+	require.NotNil(t, result)
+
+	// Every group is validated on its own, with the shared namespace
+	data, err := os.ReadFile(shards)
+	require.NoError(t, err)
+	runs := strings.Split(strings.TrimSpace(string(data)), "\n")
+	sort.Strings(runs)
+	assert.Equal(t, []string{
+		"default leaf-01 server-01 server-01--leaf-01",
+		"default leaf-02 server-02 server-02--leaf-02",
+	}, runs)
+
+	// The failure of one shard fails the validation, the warning both
+	// shards gave is reported once
+	assert.False(t, result.Result.Success)
+	messages := []string{}
+	for _, d := range result.Result.Diagnostics {
+		if d.Source == server.SourceHHFab {
+			messages = append(messages, d.Message)
+		}
+	}
+	sort.Strings(messages)
+	assert.Equal(t, []string{"VLANNamespace default overlaps", "validating: leaf-02 has no ports"}, messages)
+	assert.Contains(t, result.Result.Output, "INF validated")
+	assert.Contains(t, result.Result.Output, "ERR validating: leaf-02 has no ports")
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/codes"
+	"validator/internal/server"
+	"validator/internal/style"
+)
+
+const styleWiring = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+  labels:
+    managed: yes
+spec:
+  role: server-leaf
+  description: leaf-01
+  description: the first leaf of the rack, carrying the servers of the first row from the top to the bottom
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+   name: default
+spec:
+  ranges:
+  - from: 1000
+    to: 2999
+  - {from: 3000, to: 4000}
+`
+
+func TestStyleCheck(t *testing.T) {
+	rules := style.Rules{Indentation: 2, LineLength: 80, Truthy: true, DuplicateKeys: true}
+	findings := style.Check([]byte(styleWiring), rules)
+	assert.Equal(t, []style.Finding{
+		{Rule: style.RuleTruthy, Line: 6, Column: 14, Message: "truthy value yes should be true or false"},
+		{Rule: style.RuleDuplicateKeys, Line: 10, Column: 3, Message: `duplication of key "description" in mapping`},
+		{Rule: style.RuleLineLength, Line: 10, Column: 81, Message: "line too long (107 > 80 characters)"},
+		{Rule: style.RuleIndentation, Line: 15, Column: 4, Message: "wrong indentation: expected 2 but found 3"},
+	}, findings)
+
+	// Zero values disable the checks, single words may be long
+	assert.Empty(t, style.Check([]byte(styleWiring), style.Rules{}))
+	assert.Empty(t, style.Check([]byte("url: https://example.com/"+strings.Repeat("a", 100)+"\n"), rules))
+	assert.Empty(t, style.Check([]byte("spec:\n    role: spine\n"), style.Rules{Indentation: 4}))
+	assert.Empty(t, style.Check([]byte("enabled: 'yes'\nother: true\n"), rules))
+}
+
+func TestStyleValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	validate := func(config, wiring string) (int, server.ValidateResponse) {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(configFile, []byte("backend: mock\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n"+config), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(wiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		s.Router().ServeHTTP(w, req)
+		var response server.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+	styled := func(diagnostics []server.Diagnostic) []server.Diagnostic {
+		found := []server.Diagnostic{}
+		for _, d := range diagnostics {
+			if d.Code == codes.Style {
+				found = append(found, d)
+			}
+		}
+		return found
+	}
+	wiring := strings.Replace(kubeconformWiring, "spec:\n", "spec:\n  description: leaf-01\n", 1)
+
+	// Off by default
+	status, response := validate("", wiring)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, styled(response.Diagnostics))
+
+	// Findings warn, attributed to their object
+	status, response = validate("style:\n  enabled: true\n", wiring)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []server.Diagnostic{{
+		Severity: server.SeverityWarning,
+		Code:     codes.Style,
+		Message:  `duplication of key "description" in mapping (key-duplicates)`,
+		Source:   server.SourceValidator,
+		File:     "wiring.yaml",
+		Line:     8,
+		Object:   "Switch/leaf-01",
+	}}, styled(response.Diagnostics))
+
+	// Ignore comments apply
+	_, response = validate("style:\n  enabled: true\n", "# hh-validator:ignore yaml-style\n"+wiring)
+	assert.Empty(t, styled(response.Diagnostics))
+	assert.Len(t, styled(response.Suppressed), 1)
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("style:\n  line_length: -1\n"), 0644))
+	_, err := server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "style values must not be negative")
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/hhfabmock"
+	"validator/internal/hhfabtape"
+	"validator/internal/server"
+)
+
+// TestMain lets the test binary stand in for hhfab when it is linked as
+// hhfab, recording and replaying its runs, and when servers with the mock
+// backend run it.
+func TestMain(m *testing.M) {
+	if hhfabtape.Invoked() {
+		os.Exit(hhfabtape.Main(os.Args[1:]))
+	}
+	if hhfabmock.Invoked() {
+		os.Exit(hhfabmock.Main(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// tapeHHFab returns an hhfab that is the test binary, recording to and
+// replaying from tape.
+func tapeHHFab(t *testing.T, tape string) string {
+	t.Helper()
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	hhfab := filepath.Join(t.TempDir(), "hhfab")
+	require.NoError(t, os.Symlink(executable, hhfab))
+	t.Setenv(hhfabtape.TapeEnv, tape)
+	return hhfab
+}
+
+func TestTapeRecordReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	tape := filepath.Join(dir, "hhfab.tape")
+	recorded := filepath.Join(dir, "real-hhfab")
+	script := "#!/bin/sh\ncase \"$1\" in\n  init) echo \"spec: {}\" > fab.yaml; echo initialized;;\n  validate) grep -q leaf-09 include/*.yaml && { echo \"ERR validating: leaf-09 is not cabled\" >&2; exit 1; }; echo \"INF validated\"; echo ok > result.txt;;\nesac\n"
+	require.NoError(t, os.WriteFile(recorded, []byte(script), 0755))
+	hhfab := tapeHHFab(t, tape)
+
+	validate := func(wiring string) (int, string) {
+		configFile := filepath.Join(t.TempDir(), "config.yaml")
+		config := fmt.Sprintf("hhfab_path: %s\nworkspaces:\n  max_idle: 0\ncache:\n  backend: none\n", hhfab)
+		require.NoError(t, os.WriteFile(configFile, []byte(config), 0644))
+		s, err := server.New(server.Options{ConfigFile: configFile})
+		require.NoError(t, err)
+
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(wiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate?deterministic=true", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set(server.RequestIDHeader, "tape-1")
+		w := httptest.NewRecorder()
+		s.Router().ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	failing := bytes.Replace([]byte(connectionWiring), []byte("leaf-01"), []byte("leaf-09"), 1)
+
+	// Recording passes the runs through to the real hhfab
+	t.Setenv(hhfabtape.RecordEnv, recorded)
+	passedStatus, passed := validate(connectionWiring)
+	failedStatus, failed := validate(string(failing))
+	assert.Contains(t, failed, "leaf-09 is not cabled")
+
+	runs, err := hhfabtape.Load(tape)
+	require.NoError(t, err)
+	require.Len(t, runs, 4)
+	assert.Equal(t, []string{"init", "--dev"}, runs[0].Args)
+	assert.Equal(t, "spec: {}\n", string(runs[0].Files["fab.yaml"]))
+	assert.Equal(t, []string{"validate"}, runs[1].Args)
+	assert.Contains(t, runs[1].Dir, "include/wiring.yaml")
+	assert.Equal(t, "ok\n", string(runs[1].Files["result.txt"]))
+	assert.Equal(t, 1, runs[3].ExitCode)
+
+	// Replays answer the same without it
+	t.Setenv(hhfabtape.RecordEnv, "")
+	require.NoError(t, os.Remove(recorded))
+	status, response := validate(connectionWiring)
+	assert.Equal(t, passedStatus, status)
+	assert.Equal(t, passed, response)
+	status, response = validate(string(failing))
+	assert.Equal(t, failedStatus, status)
+	assert.Equal(t, failed, response)
+
+	// Files that were not recorded are not replayed
+	_, response = validate(string(bytes.Replace(failing, []byte("leaf-09"), []byte("leaf-07"), 1)))
+	assert.Contains(t, response, "hhfabtape: no run of hhfab validate with these files is recorded")
+}
@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+)
+
+const tenantsConfig = `hhfab_path: /nonexistent/hhfab
+schema_only_fallback: true
+admin_token: admin-token
+auth:
+  required: true
+  jwt:
+    secret: jwt-secret
+    issuer: idp
+tenants:
+  team-a:
+    api_keys: [key-a]
+    templates_dir: %s
+  team-b:
+    api_keys: [key-b]
+history:
+  backend: memory
+`
+
+// signJWT returns an HS256 token of the claims.
+func signJWT(t *testing.T, secret string, claims map[string]any) string {
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestTenants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	require.NoError(t, os.Mkdir(templates, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(templates, "lab.yaml"), []byte("spec: {}\n"), 0644))
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(tenantsConfig, templates)), 0644))
+
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	call := func(method, path, credential string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+		if body == nil {
+			body = &bytes.Buffer{}
+		}
+		req := httptest.NewRequest(method, path, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	validate := func(credential string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(connectionWiring))
+		require.NoError(t, writer.Close())
+		return call(http.MethodPost, "/validate", credential, body, writer.FormDataContentType())
+	}
+
+	// Credentials name the tenant, whose templates are listed
+	var capabilities api.CapabilitiesResponse
+	w := call(http.MethodGet, "/capabilities", "key-a", nil, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &capabilities))
+	assert.Equal(t, "team-a", capabilities.Tenant)
+	assert.Contains(t, capabilities.Templates, "lab")
+
+	token := signJWT(t, "jwt-secret", map[string]any{"tenant": "team-c", "iss": "idp", "exp": time.Now().Add(time.Hour).Unix()})
+	w = call(http.MethodGet, "/capabilities", token, nil, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &capabilities))
+	assert.Equal(t, "team-c", capabilities.Tenant)
+	assert.NotContains(t, capabilities.Templates, "lab")
+
+	// Unknown keys, forged or expired tokens and missing credentials are
+	// refused
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/capabilities", "key-x", nil, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/capabilities", "key", nil, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/capabilities", "key-a ", nil, "").Code)
+	forged := signJWT(t, "other-secret", map[string]any{"tenant": "team-a", "iss": "idp"})
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/capabilities", forged, nil, "").Code)
+	expired := signJWT(t, "jwt-secret", map[string]any{"tenant": "team-a", "iss": "idp", "exp": time.Now().Add(-time.Hour).Unix()})
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/capabilities", expired, nil, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/history", "", nil, "").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/livez", "", nil, "").Code)
+
+	// Validations are only seen by their tenant and the admin token
+	w = validate("key-a")
+	var response api.ValidateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.NotEmpty(t, response.ResultURL, w.Body.String())
+	path := response.ResultURL[len("http://example.com"):]
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, path, "key-a", nil, "").Code)
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, path, "key-b", nil, "").Code)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, path, "admin-token", nil, "").Code)
+
+	// The same wiring of another tenant is not answered from its cache
+	w = validate("key-b")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.False(t, response.Cached)
+
+	entries := func(credential, query string) []api.HistoryEntry {
+		var page api.HistoryResponse
+		w := call(http.MethodGet, "/history"+query, credential, nil, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return page.Entries
+	}
+	require.Len(t, entries("key-a", ""), 1)
+	assert.Equal(t, "team-a", entries("key-a", "")[0].Tenant)
+	// Tenants cannot list other tenants, the admin token can
+	assert.Len(t, entries("key-b", "?tenant=team-a"), 1)
+	assert.Len(t, entries("admin-token", ""), 2)
+	assert.Len(t, entries("admin-token", "?tenant=team-b"), 1)
+
+	var stats api.StatsResponse
+	w = call(http.MethodGet, "/stats", "admin-token", nil, "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, map[string]int{"team-a": 1, "team-b": 1}, stats.Tenants)
+}
+
+const rolesConfig = `hhfab_path: /nonexistent/hhfab
+schema_only_fallback: true
+admin_token: admin-token
+auth:
+  default_role: viewer
+  jwt:
+    secret: jwt-secret
+tenants:
+  team-a:
+    api_keys:
+      - key-a
+      - key: key-admin
+        roles: [viewer, admin]
+      - key: key-validator
+        roles: [validator]
+history:
+  backend: memory
+`
+
+func TestRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(rolesConfig), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	validate := func(credential string) int {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(connectionWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if credential != "" {
+			req.Header.Set("X-API-Key", credential)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	role := func(credential string) string {
+		req := httptest.NewRequest(http.MethodGet, "/capabilities", nil)
+		req.Header.Set("X-API-Key", credential)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var capabilities api.CapabilitiesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &capabilities))
+		return capabilities.Role
+	}
+
+	viewer := signJWT(t, "jwt-secret", map[string]any{"tenant": "team-b", "roles": "viewer"})
+	validator := signJWT(t, "jwt-secret", map[string]any{"tenant": "team-b", "roles": []string{"validator", "unknown"}})
+	unset := signJWT(t, "jwt-secret", map[string]any{"tenant": "team-b"})
+
+	// Keys and tokens without roles, and anonymous requests, have the
+	// default role
+	assert.Equal(t, "viewer", role("key-a"))
+	assert.Equal(t, "admin", role("key-admin"))
+	assert.Equal(t, "validator", role(validator))
+	assert.Equal(t, "viewer", role(unset))
+	assert.Equal(t, "admin", role("admin-token"))
+
+	// Viewers cannot validate; anonymous requests are asked for credentials
+	denied := []int{http.StatusUnauthorized, http.StatusForbidden}
+	assert.Equal(t, http.StatusUnauthorized, validate(""))
+	assert.Equal(t, http.StatusForbidden, validate("key-a"))
+	assert.Equal(t, http.StatusForbidden, validate(viewer))
+	assert.NotContains(t, denied, validate("key-validator"))
+	assert.NotContains(t, denied, validate(validator))
+	assert.NotContains(t, denied, validate("key-admin"))
+
+	// Anyone may read, only admins run benchmarks
+	for _, credential := range []string{"", "key-a", viewer} {
+		req := httptest.NewRequest(http.MethodGet, "/history", nil)
+		req.Header.Set("X-API-Key", credential)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, credential)
+	}
+	benchmark := func(credential string) int {
+		req := httptest.NewRequest(http.MethodPost, "/benchmark?iterations=0", nil)
+		req.Header.Set("X-API-Key", credential)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, benchmark(""))
+	assert.Equal(t, http.StatusForbidden, benchmark("key-validator"))
+	assert.NotEqual(t, http.StatusForbidden, benchmark("key-admin"))
+
+	// Unknown roles of keys are refused
+	require.NoError(t, os.WriteFile(configFile, []byte(strings.Replace(rolesConfig, "roles: [validator]", "roles: [owner]", 1)), 0644))
+	_, err = server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, `unknown role "owner"`)
+}
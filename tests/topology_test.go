@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/internal/topology"
+	"validator/internal/wiring"
+)
+
+func TestTopologyBuild(t *testing.T) {
+	objects, err := wiring.Parse([]byte(connectionWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	graph := topology.Build(objects)
+
+	keys := []string{}
+	for _, node := range graph.Nodes {
+		keys = append(keys, node.Key())
+	}
+	// The link with a malformed port is left out
+	assert.Equal(t, []string{"Switch/leaf-01", "Server/server-01"}, keys)
+
+	require.Len(t, graph.Edges, 1)
+	assert.Equal(t, topology.Edge{
+		From:       "Switch/leaf-01",
+		To:         "Server/server-01",
+		FromPort:   "E1/1",
+		ToPort:     "enp2s1",
+		Connection: "server-01--leaf-01",
+		Type:       "unbundled",
+	}, graph.Edges[0])
+
+	var dot bytes.Buffer
+	require.NoError(t, topology.Write(&dot, graph, topology.FormatDOT))
+	assert.Contains(t, dot.String(), `"Switch/leaf-01" -- "Server/server-01"`)
+
+	var mermaid bytes.Buffer
+	require.NoError(t, topology.Write(&mermaid, graph, topology.FormatMermaid))
+	assert.Contains(t, mermaid.String(), `n0 ---|"E1/1 - enp2s1"| n1`)
+
+	var svg bytes.Buffer
+	require.NoError(t, topology.Write(&svg, graph, topology.FormatSVG))
+	assert.True(t, strings.HasPrefix(svg.String(), "<svg "))
+	assert.Contains(t, svg.String(), "<title>server-01--leaf-01 (unbundled): E1/1 - enp2s1</title>")
+
+	var drawio bytes.Buffer
+	require.NoError(t, topology.Write(&drawio, graph, topology.FormatDrawIO))
+	assert.True(t, strings.HasPrefix(drawio.String(), "<mxfile "))
+	assert.Contains(t, drawio.String(), `label="leaf-01" tooltip="Switch/leaf-01"`)
+	assert.Contains(t, drawio.String(), `tooltip="server-01--leaf-01 (unbundled): E1/1 - enp2s1"`)
+	assert.Contains(t, drawio.String(), `source="node-1" target="node-2"`)
+}
+
+func TestValidateDiagram(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("backend: mock\nworkspaces:\n  max_idle: 0\nhistory:\n  backend: memory\n"), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+	router := s.Router()
+
+	validate := func(query string) (int, server.ValidateResponse) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(kubeconformWiring))
+		require.NoError(t, writer.Close())
+		req := httptest.NewRequest(http.MethodPost, "/validate"+query, body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response server.ValidateResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	// Successful results carry the diagram, base64 in JSON
+	status, response := validate("?diagram=svg")
+	require.Equal(t, http.StatusOK, status, response.Error)
+	require.NotNil(t, response.Diagram)
+	assert.Equal(t, topology.FormatSVG, response.Diagram.Format)
+	assert.Equal(t, "image/svg+xml", response.Diagram.ContentType)
+	assert.Contains(t, string(response.Diagram.Content), "leaf-01 (server-leaf)")
+
+	// and the recorded result offers it for download
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(response.ResultURL, "http://example.com")+"/diagram", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename=topology-.+\.svg$`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, response.Diagram.Content, w.Body.Bytes())
+
+	// Without ?diagram= there is none
+	_, response = validate("")
+	assert.Nil(t, response.Diagram)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(response.ResultURL, "http://example.com")+"/diagram", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	status, response = validate("?diagram=png")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, response.Error, "must be one of: dot, mermaid, svg, drawio")
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+	"validator/pkg/api"
+	"validator/pkg/client"
+)
+
+const webhooksConfig = `hhfab_path: /nonexistent/hhfab
+schema_only_fallback: true
+webhooks:
+  - url: %s
+    secret: shared-secret
+`
+
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The receiver fails the first attempt, so the delivery is retried
+	var mu sync.Mutex
+	var deliveries []delivery
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		deliveries = append(deliveries, delivery{r.Header.Clone(), body})
+		if len(deliveries) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf(webhooksConfig, receiver.URL)), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(connectionWiring))
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/validate", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	s.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(deliveries) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	first, retry := deliveries[0], deliveries[1]
+	assert.Equal(t, first.header.Get(api.WebhookDeliveryHeader), retry.header.Get(api.WebhookDeliveryHeader))
+	assert.Equal(t, api.WebhookValidationFinished, retry.header.Get(api.WebhookEventHeader))
+
+	verifier := &client.WebhookVerifier{Secret: "shared-secret"}
+	event, err := verifier.Verify(retry.header, retry.body)
+	require.NoError(t, err)
+	assert.Equal(t, api.WebhookValidationFinished, event.Event)
+	require.NotNil(t, event.Entry)
+	assert.Equal(t, []string{"wiring.yaml"}, event.Entry.Files)
+	assert.NotNil(t, event.Entry.Result)
+
+	// Replays, tampered bodies, other secrets and stale timestamps are
+	// refused
+	_, err = verifier.Verify(retry.header, retry.body)
+	assert.ErrorIs(t, err, client.ErrInvalidWebhook)
+	_, err = (&client.WebhookVerifier{Secret: "shared-secret"}).Verify(retry.header, append(retry.body, ' '))
+	assert.ErrorIs(t, err, client.ErrInvalidWebhook)
+	_, err = (&client.WebhookVerifier{Secret: "other-secret"}).Verify(retry.header, retry.body)
+	assert.ErrorIs(t, err, client.ErrInvalidWebhook)
+	// Timestamps have a resolution of seconds, so wait for the next one
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	_, err = (&client.WebhookVerifier{Secret: "shared-secret", MaxAge: time.Nanosecond}).Verify(retry.header, retry.body)
+	assert.ErrorIs(t, err, client.ErrInvalidWebhook)
+
+	// Webhooks need a secret
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf("webhooks:\n  - url: %s\n", receiver.URL)), 0644))
+	_, err = server.New(server.Options{ConfigFile: configFile})
+	assert.ErrorContains(t, err, "a secret is required")
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/wiring"
+)
+
+const wiringBefore = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: spine-01
+spec:
+  role: spine
+  asn: 65000
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  role: server-leaf
+`
+
+const wiringAfter = `apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: spine-01
+spec:
+  role: leaf
+  description: moved
+---
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-02
+spec:
+  role: server-leaf
+`
+
+func TestWiringParse(t *testing.T) {
+	objects, err := wiring.Parse([]byte(wiringBefore), "wiring.yaml")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	assert.Equal(t, "Switch/spine-01", objects[0].Key())
+	assert.Equal(t, 1, objects[0].Line)
+	assert.Equal(t, "leaf-01", objects[1].Name)
+	assert.Equal(t, 9, objects[1].Line)
+	assert.Equal(t, "server-leaf", wiring.Scalar(objects[1].Node, "spec", "role"))
+
+	_, err = wiring.Parse([]byte("- not\n- an object\n"), "list.yaml")
+	assert.ErrorContains(t, err, "list.yaml:1")
+}
+
+func TestWiringDiff(t *testing.T) {
+	before, err := wiring.Parse([]byte(wiringBefore), "before.yaml")
+	require.NoError(t, err)
+	after, err := wiring.Parse([]byte(wiringAfter), "after.yaml")
+	require.NoError(t, err)
+
+	changes := wiring.Diff(before, after)
+	require.Len(t, changes, 3)
+
+	assert.Equal(t, wiring.Removed, changes[0].Type)
+	assert.Equal(t, "leaf-01", changes[0].Name)
+	assert.Equal(t, wiring.Added, changes[1].Type)
+	assert.Equal(t, "leaf-02", changes[1].Name)
+
+	assert.Equal(t, wiring.Changed, changes[2].Type)
+	assert.Equal(t, []wiring.FieldChange{
+		{Path: "spec.asn", Old: "65000"},
+		{Path: "spec.description", New: "moved"},
+		{Path: "spec.role", Old: "spine", New: "leaf"},
+	}, changes[2].Fields)
+
+	assert.Empty(t, wiring.Diff(before, before))
+}
+
+const unformattedWiring = `# rack 1
+kind: Switch
+apiVersion: wiring.githedgehog.com/v1beta1
+spec:
+    role: "server-leaf"
+    vlanNamespaces: [lab, default]
+    asn: "65101"
+metadata: {name: leaf-01}
+---
+`
+
+const formattedWiring = `# rack 1
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  asn: "65101"
+  role: server-leaf
+  vlanNamespaces:
+    - default
+    - lab
+`
+
+func TestWiringFormat(t *testing.T) {
+	formatted, err := wiring.Format([]byte(unformattedWiring), "wiring.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, formattedWiring, string(formatted))
+
+	again, err := wiring.Format(formatted, "wiring.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, formattedWiring, string(again))
+
+	_, err = wiring.Format([]byte("kind: [Switch"), "broken.yaml")
+	assert.ErrorContains(t, err, "broken.yaml")
+}
+
+const oldWiring = `apiVersion: wiring.githedgehog.com/v1alpha2
+kind: Switch
+metadata:
+  name: leaf-01
+spec:
+  vlanNamespace: lab
+---
+apiVersion: vpc.githedgehog.com/v1alpha2
+kind: VPC
+metadata:
+  name: vpc-1
+spec:
+  vlanNamespace: lab
+`
+
+func TestWiringConvert(t *testing.T) {
+	converted, changes, err := wiring.Convert([]byte(oldWiring), "wiring.yaml")
+	require.NoError(t, err)
+
+	objects, err := wiring.Parse(converted, "wiring.yaml")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "wiring.githedgehog.com/v1beta1", objects[0].APIVersion)
+	assert.Equal(t, "lab", wiring.Scalar(wiring.Lookup(objects[0].Node, "spec", "vlanNamespaces").Content[0]))
+	assert.Equal(t, "default", wiring.Scalar(objects[1].Node, "spec", "ipv4Namespace"))
+	assert.Equal(t, "lab", wiring.Scalar(objects[1].Node, "spec", "vlanNamespace"))
+
+	assert.Equal(t, []wiring.Conversion{
+		{Object: "Switch/leaf-01", Type: wiring.Upgraded, Path: "apiVersion", From: "wiring.githedgehog.com/v1alpha2", To: "wiring.githedgehog.com/v1beta1"},
+		{Object: "Switch/leaf-01", Type: wiring.Renamed, Path: "spec.vlanNamespaces", From: "spec.vlanNamespace"},
+		{Object: "VPC/vpc-1", Type: wiring.Upgraded, Path: "apiVersion", From: "vpc.githedgehog.com/v1alpha2", To: "vpc.githedgehog.com/v1beta1"},
+		{Object: "VPC/vpc-1", Type: wiring.Defaulted, Path: "spec.ipv4Namespace", To: "default"},
+	}, changes)
+
+	_, changes, err = wiring.Convert(converted, "wiring.yaml")
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestWiringEncode(t *testing.T) {
+	objects, err := wiring.Parse([]byte(wiringBefore), "wiring.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, objects)
+
+	data, err := wiring.Encode(objects[1:])
+	require.NoError(t, err)
+	encoded, err := wiring.Parse(data, "wiring.yaml")
+	require.NoError(t, err)
+	require.Len(t, encoded, len(objects)-1)
+	for i, object := range encoded {
+		assert.Equal(t, objects[i+1].Key(), object.Key())
+	}
+
+	data, err = wiring.Encode(nil)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestWiringSuppressions(t *testing.T) {
+	objects, err := wiring.Parse([]byte(`# hh-validator:ignore HHV014 kept for the next rack
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: VLANNamespace
+metadata:
+  name: lab # hh-validator:ignore missing-description
+spec:
+  ranges: []
+---
+# a comment that is no suppression
+apiVersion: wiring.githedgehog.com/v1beta1
+kind: Server
+metadata:
+  name: server-01
+`), "wiring.yaml")
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+
+	assert.Equal(t, []wiring.Suppression{
+		{Code: "HHV014", Reason: "kept for the next rack", Line: 2},
+		{Code: "missing-description", Line: 5},
+	}, objects[0].Suppressions)
+	assert.Empty(t, objects[1].Suppressions)
+}
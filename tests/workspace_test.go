@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"validator/internal/server"
+)
+
+// workspaceHHFab counts its inits in inits and logs the workspace every run
+// validates in, the fab.yaml and the included files, to runs. Runs leave a
+// file behind.
+const workspaceHHFab = `#!/bin/sh
+case "$1" in
+  init) echo init >> %s; echo "spec: default" > fab.yaml;;
+  validate)
+    echo "$PWD|$(cat fab.yaml)|$(ls include | tr '\n' ' ')" >> %s
+    touch leftover
+    echo "06:38:17 INF validated";;
+esac
+`
+
+// workspaceRun is a validation as workspaceHHFab logged it.
+type workspaceRun struct {
+	dir, fab, include string
+}
+
+// workspaceServer returns the router of a server with the workspaces
+// settings of config, validating with workspaceHHFab, and functions
+// returning the inits so far and the last run.
+func workspaceServer(t *testing.T, config string) (*gin.Engine, func() int, func() workspaceRun) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", filepath.Join(dir, "tmp"))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "tmp"), 0755))
+	inits := filepath.Join(dir, "inits")
+	runs := filepath.Join(dir, "runs")
+	hhfab := filepath.Join(dir, "hhfab")
+	require.NoError(t, os.WriteFile(hhfab, []byte(fmt.Sprintf(workspaceHHFab, inits, runs)), 0755))
+	configFile := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(fmt.Sprintf("hhfab_path: %s\ncache:\n  backend: none\nworkspaces:\n%s", hhfab, config)), 0644))
+	s, err := server.New(server.Options{ConfigFile: configFile})
+	require.NoError(t, err)
+
+	initCount := func() int {
+		data, _ := os.ReadFile(inits)
+		return strings.Count(string(data), "init")
+	}
+	lastRun := func() workspaceRun {
+		data, err := os.ReadFile(runs)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		fields := strings.SplitN(lines[len(lines)-1], "|", 3)
+		require.Len(t, fields, 3)
+		return workspaceRun{fields[0], fields[1], strings.TrimSpace(fields[2])}
+	}
+	return s.Router(), initCount, lastRun
+}
+
+// workspaceValidate validates the wiring, with fab if it is not empty.
+func workspaceValidate(t *testing.T, router *gin.Engine, fab string) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("wiring", "wiring.yaml")
+	require.NoError(t, err)
+	part.Write([]byte(shardedWiring))
+	if fab != "" {
+		part, err = writer.CreateFormFile("fab", "fab.yaml")
+		require.NoError(t, err)
+		part.Write([]byte(fab))
+	}
+	require.NoError(t, writer.Close())
+	req := httptest.NewRequest(http.MethodPost, "/validate", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestWorkspaceReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, inits, lastRun := workspaceServer(t, "  max_idle: 1\n  max_uses: 10\n")
+
+	// A UC2 validation brings its own fab.yaml
+	workspaceValidate(t, router, "spec: {custom: true}\n")
+	first := lastRun()
+	assert.Equal(t, "spec: {custom: true}", first.fab)
+	assert.Equal(t, 1, inits())
+
+	// The idle workspace is back to what init left: the default fab.yaml,
+	// an empty include directory and nothing else
+	assert.Equal(t, []string{filepath.Join(os.Getenv("TMPDIR"), filepath.Base(first.dir))}, globWorkspaces(t))
+	fab, err := os.ReadFile(filepath.Join(first.dir, "fab.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "spec: default\n", string(fab))
+	include, err := os.ReadDir(filepath.Join(first.dir, "include"))
+	require.NoError(t, err)
+	assert.Empty(t, include)
+	assert.NoFileExists(t, filepath.Join(first.dir, "leftover"))
+
+	// The next validation reuses it without running init again
+	workspaceValidate(t, router, "")
+	second := lastRun()
+	assert.Equal(t, workspaceRun{first.dir, "spec: default", first.include}, second)
+	assert.Equal(t, 1, inits())
+}
+
+func TestWorkspaceRefresh(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("max uses", func(t *testing.T) {
+		router, inits, lastRun := workspaceServer(t, "  max_idle: 1\n  max_uses: 2\n")
+		workspaceValidate(t, router, "")
+		first := lastRun()
+		workspaceValidate(t, router, "")
+		assert.Equal(t, first.dir, lastRun().dir)
+
+		// The used up workspace is replaced in the background
+		require.Eventually(t, func() bool { return inits() == 2 }, 5*time.Second, 10*time.Millisecond)
+		assert.NoDirExists(t, first.dir)
+		require.Eventually(t, func() bool { return len(globWorkspaces(t)) == 1 }, 5*time.Second, 10*time.Millisecond)
+		workspaceValidate(t, router, "")
+		assert.NotEqual(t, first.dir, lastRun().dir)
+		assert.Equal(t, 2, inits())
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		router, inits, lastRun := workspaceServer(t, "  max_idle: 1\n  max_age_seconds: 1\n")
+		workspaceValidate(t, router, "")
+		first := lastRun()
+
+		// A workspace over its age is initialized anew instead of reused
+		time.Sleep(1100 * time.Millisecond)
+		workspaceValidate(t, router, "")
+		assert.NotEqual(t, first.dir, lastRun().dir)
+		assert.NoDirExists(t, first.dir)
+
+		// The pool is refilled in the background, keeping one of the two
+		require.Eventually(t, func() bool { return inits() == 3 && len(globWorkspaces(t)) == 1 }, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+// globWorkspaces returns the workspaces in the temporary directory.
+func globWorkspaces(t *testing.T) []string {
+	workspaces, err := filepath.Glob(filepath.Join(os.Getenv("TMPDIR"), "validator-workspace-*"))
+	require.NoError(t, err)
+	return workspaces
+}